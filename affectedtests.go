@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// TestSelection is the tests of one package a change needs run.
+type TestSelection struct {
+	Package string   `json:"package"`
+	Dir     string   `json:"dir"`             // relative to the module directory, as go test takes it
+	All     bool     `json:"all"`             // the change is not confined to functions: run every test
+	Tests   []string `json:"tests,omitempty"` // test, fuzz and example functions, when not All
+}
+
+// Run returns the -run pattern selecting the tests of s, or "" for all.
+func (s TestSelection) Run() string {
+	if s.All {
+		return ""
+	}
+	return "^(" + strings.Join(s.Tests, "|") + ")$"
+}
+
+// PackagesChangedOutsideFuncs returns the project packages with changes, as
+// returned by changedLines, that no function spans: declarations outside
+// function bodies, and files changed or deleted as a whole. Changes to such
+// declarations can affect any test of the package. dir is the module
+// directory.
+func (c *Collector) PackagesChangedOutsideFuncs(dir string, changed map[string][]lineRange) []string {
+	funcs := make(map[string][]*FuncNode) // by absolute file
+	for _, fn := range c.Funcs {
+		if fn.File != "" {
+			funcs[absFile(dir, fn.File)] = append(funcs[absFile(dir, fn.File)], fn)
+		}
+	}
+	byDir := make(map[string]string) // absolute directory -> package
+	files := make(map[string]*FileNode)
+	for _, f := range c.Files {
+		files[absFile(dir, f.Path)] = f
+		byDir[filepath.Dir(absFile(dir, f.Path))] = strings.TrimSuffix(f.Package, "_test")
+	}
+
+	pkgs := make(map[string]bool)
+	for file, ranges := range changed {
+		f, ok := files[file]
+		if !ok {
+			// Deleted files leave their package behind.
+			if pkg, ok := byDir[filepath.Dir(file)]; ok && ranges == nil {
+				pkgs[pkg] = true
+			}
+			continue
+		}
+		outside := ranges == nil
+		for _, r := range ranges {
+			spanned := false
+			for _, fn := range funcs[file] {
+				if r.From >= fn.Line && r.To <= max(fn.EndLine, fn.Line) {
+					spanned = true
+					break
+				}
+			}
+			outside = outside || !spanned
+		}
+		if outside {
+			pkgs[strings.TrimSuffix(f.Package, "_test")] = true
+		}
+	}
+	names := make([]string, 0, len(pkgs))
+	for p := range pkgs {
+		names = append(names, p)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AffectedTests returns, by package, the tests reaching the changes of imp
+// and the packages wholly to test, as returned by
+// PackagesChangedOutsideFuncs that have tests. Benchmarks are left out, as
+// go test only runs them with -bench.
+func (c *Collector) AffectedTests(imp Impact, whole []string) []TestSelection {
+	hasTests := make(map[string]bool)
+	for _, f := range c.Files {
+		if isTestFile(f.Path) {
+			hasTests[strings.TrimSuffix(f.Package, "_test")] = true
+		}
+	}
+	sels := make(map[string]*TestSelection)
+	selection := func(pkg string) *TestSelection {
+		pkg = strings.TrimSuffix(pkg, "_test") // external test packages run with their package
+		if sels[pkg] == nil {
+			dir := "./" + c.relPath(pkg)
+			if pkg == c.RootModule {
+				dir = "."
+			}
+			sels[pkg] = &TestSelection{Package: pkg, Dir: dir}
+		}
+		return sels[pkg]
+	}
+	for _, pkg := range whole {
+		if hasTests[pkg] {
+			selection(pkg).All = true
+		}
+	}
+	for _, t := range imp.Tests {
+		if s := selection(t.Package); !s.All && !strings.HasPrefix(c.Funcs[t.FullName].Name, "Benchmark") {
+			s.Tests = append(s.Tests, regexp.QuoteMeta(c.Funcs[t.FullName].Name))
+		}
+	}
+	var out []TestSelection
+	for _, s := range sels {
+		if !s.All && len(s.Tests) == 0 {
+			continue
+		}
+		sort.Strings(s.Tests)
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Package < out[j].Package })
+	return out
+}
+
+// WriteTestCommands prints one go test command per package of sels.
+func WriteTestCommands(w io.Writer, sels []TestSelection) {
+	for _, s := range sels {
+		if s.All {
+			fmt.Fprintf(w, "go test %s\n", s.Dir)
+			continue
+		}
+		fmt.Fprintf(w, "go test -run '%s' %s\n", s.Run(), s.Dir)
+	}
+}
+
+// runAffectedTests implements the affected-tests subcommand.
+func runAffectedTests(args []string) error {
+	cmd := flag.NewFlagSet("affected-tests", flag.ExitOnError)
+	dir := cmd.String("dir", ".", "Project root directory")
+	spec := cmd.String("changed-files", "", "Changed files, comma-separated and relative to the repository root, or a git diff range such as origin/main...HEAD")
+	format := cmd.String("format", "commands", "Output format: commands (go test command lines), packages (package directories) or json")
+	tags := cmd.String("tags", "", "Comma-separated build tags for package loading")
+	cmd.Usage = func() {
+		fmt.Fprintln(cmd.Output(), "Usage: go-callgraph-neo4j affected-tests --changed-files <files|range> [flags] [packages]")
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+	if *spec == "" || (*format != "commands" && *format != "packages" && *format != "json") {
+		cmd.Usage()
+		os.Exit(1)
+	}
+	patterns := cmd.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	absDir, err := filepath.Abs(*dir)
+	if err != nil {
+		return err
+	}
+	changed, err := changedLines(absDir, *spec)
+	if err != nil {
+		return err
+	}
+	log.Printf("Changed Go files: %d", len(changed))
+	collector, err := analyzeInMemory(absDir, *tags, patterns, true)
+	if err != nil {
+		return err
+	}
+	// Declarations outside functions may be used by any function of their
+	// package, so all of them count as changed.
+	whole := collector.PackagesChangedOutsideFuncs(absDir, changed)
+	funcs := collector.ChangedFuncs(absDir, changed)
+	for name, fn := range collector.Funcs {
+		if slices.Contains(whole, strings.TrimSuffix(fn.Package, "_test")) {
+			funcs = append(funcs, name)
+		}
+	}
+	imp := collector.ImpactOf(absDir, funcs, 0)
+	sels := collector.AffectedTests(imp, whole)
+	log.Printf("Affected tests in %d packages", len(sels))
+
+	switch *format {
+	case "packages":
+		for _, s := range sels {
+			fmt.Println(s.Dir)
+		}
+	case "json":
+		if sels == nil {
+			sels = []TestSelection{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(sels)
+	default:
+		WriteTestCommands(os.Stdout, sels)
+	}
+	return nil
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/token"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// Semver impacts of API changes, from the largest.
+const (
+	semverMajor = "major"
+	semverMinor = "minor"
+	semverPatch = "patch"
+)
+
+// APIChange is a change of the exported API between two revisions.
+type APIChange struct {
+	Symbol string `json:"symbol"` // import path, function full name or type key
+	Kind   string `json:"kind"`   // package, func, method, type, const, var, field or interface method
+	Change string `json:"change"` // added, removed or changed
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new,omitempty"`
+	Impact string `json:"impact"` // major or minor
+}
+
+// APIDiff is the API changes between two revisions and the version bump
+// they call for.
+type APIDiff struct {
+	Old     string      `json:"old"`
+	New     string      `json:"new"`
+	Impact  string      `json:"impact"` // major, minor or patch
+	Changes []APIChange `json:"changes"`
+}
+
+// apiDecl is a declaration of the exported API.
+type apiDecl struct {
+	Kind    string // package, func, method, type, const or var
+	Package string
+	Decl    string   // such as func (*Client) Do(context.Context) error
+	Methods []string // method set of an interface
+	Fields  []string // exported fields of a struct
+}
+
+// apiDecls returns the exported API of the analysed project by symbol: the
+// packages other modules can import, which are neither main, internal nor
+// test packages, and their exported functions, types, constants and
+// variables, and exported methods and fields of exported types. Signatures
+// leave out parameter names, which callers do not depend on.
+func (c *Collector) apiDecls() map[string]apiDecl {
+	importable := func(path string) bool {
+		p, ok := c.Packages[path]
+		return ok && p.Name != "main" && !isTestPackage(path) &&
+			!slices.Contains(strings.Split(path, "/"), "internal")
+	}
+	decls := make(map[string]apiDecl)
+	for path, p := range c.Packages {
+		if importable(path) {
+			decls[path] = apiDecl{Kind: "package", Package: path, Decl: "package " + p.Name}
+			for _, v := range p.Values {
+				kind, rest, _ := strings.Cut(v, " ")
+				decls[path+"."+apiMemberName(rest)] = apiDecl{Kind: kind, Package: path, Decl: v}
+			}
+		}
+	}
+	for name, fn := range c.Funcs {
+		if !fn.Exported || fn.File == "" || fn.Synthetic != "" || isTestFile(fn.File) || !importable(fn.Package) {
+			continue
+		}
+		sig := strings.TrimPrefix(fn.APISignature, "func")
+		if !fn.IsMethod {
+			decls[name] = apiDecl{Kind: "func", Package: fn.Package, Decl: "func " + fn.Name + sig}
+			continue
+		}
+		if token.IsExported(fn.Receiver) {
+			recv := fn.Receiver
+			if fn.ReceiverPtr {
+				recv = "*" + recv
+			}
+			decls[name] = apiDecl{Kind: "method", Package: fn.Package, Decl: "func (" + recv + ") " + fn.Name + sig}
+		}
+	}
+	typeDecl := func(key, name, pkg, file string, exported bool, underlying string, methods, fields []string) {
+		if exported && !isTestFile(file) && importable(pkg) {
+			decls[key] = apiDecl{Kind: "type", Package: pkg, Decl: "type " + name + " " + underlying, Methods: methods, Fields: fields}
+		}
+	}
+	for key, s := range c.Structs {
+		typeDecl(key, s.Name, s.Package, s.File, s.Exported, "struct", nil, s.Fields)
+	}
+	for key, i := range c.Interfaces {
+		typeDecl(key, i.Name, i.Package, i.File, i.Exported, "interface", i.MethodSet, nil)
+	}
+	for key, t := range c.NamedTypes {
+		typeDecl(key, t.Name, t.Package, t.File, t.Exported, t.Underlying, nil, nil)
+	}
+	for key, a := range c.Aliases {
+		typeDecl(key, a.Name, a.Package, a.File, a.Exported, "= "+a.TargetType, nil, nil)
+	}
+	return decls
+}
+
+// DiffAPI compares the API declarations of two revisions. Removing or
+// changing a declaration is a major change, adding one a minor change, as
+// is moving a method from a pointer to a value receiver, which only adds it
+// to the method set of the value type.
+// Interfaces are also compared method by method: any change to the method
+// set is major, as adding a method breaks the types implementing it,
+// except additions to an interface with unexported methods, which only its
+// own package can implement. Structs are compared field by field, where
+// only additions are minor. The symbols of added and removed packages are
+// not listed apart.
+func DiffAPI(oldDecls, newDecls map[string]apiDecl) []APIChange {
+	var changes []APIChange
+	symbols := sortedKeys(oldDecls)
+	for _, sym := range sortedKeys(newDecls) {
+		if _, ok := oldDecls[sym]; !ok {
+			symbols = append(symbols, sym)
+		}
+	}
+	slices.Sort(symbols)
+	for _, sym := range symbols {
+		o, inOld := oldDecls[sym]
+		n, inNew := newDecls[sym]
+		switch {
+		case !inNew:
+			if _, ok := newDecls[o.Package]; ok || o.Kind == "package" {
+				changes = append(changes, APIChange{Symbol: sym, Kind: o.Kind, Change: "removed", Old: o.Decl, Impact: semverMajor})
+			}
+		case !inOld:
+			if _, ok := oldDecls[n.Package]; ok || n.Kind == "package" {
+				changes = append(changes, APIChange{Symbol: sym, Kind: n.Kind, Change: "added", New: n.Decl, Impact: semverMinor})
+			}
+		case o.Kind == "method" && o.Decl == strings.Replace(n.Decl, "func (", "func (*", 1):
+			changes = append(changes, APIChange{Symbol: sym, Kind: n.Kind, Change: "changed", Old: o.Decl, New: n.Decl, Impact: semverMinor})
+		case o.Decl != n.Decl:
+			changes = append(changes, APIChange{Symbol: sym, Kind: n.Kind, Change: "changed", Old: o.Decl, New: n.Decl, Impact: semverMajor})
+		default:
+			sealed := slices.ContainsFunc(o.Methods, func(m string) bool { return !token.IsExported(apiMemberName(m)) })
+			addImpact := semverMajor
+			if sealed {
+				addImpact = semverMinor
+			}
+			changes = append(changes, diffMembers(sym, "interface method", o.Methods, n.Methods, addImpact)...)
+			changes = append(changes, diffMembers(sym, "field", o.Fields, n.Fields, semverMinor)...)
+		}
+	}
+	return changes
+}
+
+// diffMembers compares the old and new members of sym, methods of an
+// interface or fields of a struct, as kind. Removing or changing one is
+// major, adding one has addImpact.
+func diffMembers(sym, kind string, oldSet, newSet []string, addImpact string) []APIChange {
+	byName := func(set []string) map[string]string {
+		m := make(map[string]string, len(set))
+		for _, member := range set {
+			m[apiMemberName(member)] = member
+		}
+		return m
+	}
+	oldMembers, newMembers := byName(oldSet), byName(newSet)
+	var changes []APIChange
+	for _, name := range sortedKeys(oldMembers) {
+		switch n, ok := newMembers[name]; {
+		case !ok:
+			changes = append(changes, APIChange{Symbol: sym + "." + name, Kind: kind, Change: "removed", Old: oldMembers[name], Impact: semverMajor})
+		case n != oldMembers[name]:
+			changes = append(changes, APIChange{Symbol: sym + "." + name, Kind: kind, Change: "changed", Old: oldMembers[name], New: n, Impact: semverMajor})
+		}
+	}
+	for _, name := range sortedKeys(newMembers) {
+		if _, ok := oldMembers[name]; !ok {
+			changes = append(changes, APIChange{Symbol: sym + "." + name, Kind: kind, Change: "added", New: newMembers[name], Impact: addImpact})
+		}
+	}
+	return changes
+}
+
+// apiMemberName returns the name of a method, field or value as rendered
+// for apidiff, such as Do in "Do(context.Context) error", Size in
+// "Size int" or Reader in the embedded field "*bufio.Reader".
+func apiMemberName(member string) string {
+	name := member
+	if i := strings.IndexAny(name, " ([="); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.TrimPrefix(name, "*")
+	return name[strings.LastIndexByte(name, '.')+1:]
+}
+
+// semverImpact returns the largest impact of changes.
+func semverImpact(changes []APIChange) string {
+	impact := semverPatch
+	for _, c := range changes {
+		if c.Impact == semverMajor {
+			return semverMajor
+		}
+		impact = semverMinor
+	}
+	return impact
+}
+
+// analyzeRevision analyses the project in absDir as of the git revision
+// rev, checked out into a temporary worktree.
+func analyzeRevision(absDir, rev, tags string) (*Collector, error) {
+	top, err := runGit(absDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := runGit(absDir, "rev-parse", "--show-prefix")
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := os.MkdirTemp("", "callgraph-apidiff-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	top, worktree := strings.TrimSpace(top), filepath.Join(tmp, "src")
+	if _, err := runGit(top, "worktree", "add", "--detach", worktree, rev); err != nil {
+		return nil, err
+	}
+	defer runGit(top, "worktree", "remove", "--force", worktree)
+	log.Printf("Analysing %s...", rev)
+	return analyzeInMemory(filepath.Join(worktree, strings.TrimSpace(prefix)), tags, []string{"./..."}, false)
+}
+
+// WriteAPIDiff prints d, breaking changes first.
+func WriteAPIDiff(w io.Writer, d APIDiff) {
+	breaking := 0
+	for _, c := range d.Changes {
+		if c.Impact == semverMajor {
+			breaking++
+		}
+	}
+	fmt.Fprintf(w, "API changes from %s to %s: %s (%d breaking, %d compatible)\n",
+		d.Old, d.New, d.Impact, breaking, len(d.Changes)-breaking)
+	for _, impact := range []string{semverMajor, semverMinor} {
+		title := map[string]string{semverMajor: "Breaking", semverMinor: "Compatible"}[impact]
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for i, c := range slices.DeleteFunc(slices.Clone(d.Changes), func(c APIChange) bool { return c.Impact != impact }) {
+			if i == 0 {
+				fmt.Fprintf(w, "\n%s:\n", title)
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", c.Change, c.Kind, c.Symbol, apiChangeDecl(c))
+		}
+		tw.Flush()
+	}
+}
+
+// WriteAPIDiffMarkdown prints d as Markdown, for release notes.
+func WriteAPIDiffMarkdown(w io.Writer, d APIDiff) {
+	fmt.Fprintf(w, "### API changes from %s to %s\n\n", d.Old, d.New)
+	fmt.Fprintf(w, "Semver impact: **%s**.\n", d.Impact)
+	if len(d.Changes) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\n| Impact | Change | Kind | Symbol | Declaration |")
+	fmt.Fprintln(w, "| --- | --- | --- | --- | --- |")
+	for _, c := range d.Changes {
+		fmt.Fprintf(w, "| %s | %s | %s | `%s` | `%s` |\n", c.Impact, c.Change, c.Kind, c.Symbol,
+			strings.ReplaceAll(apiChangeDecl(c), "|", `\|`))
+	}
+}
+
+// apiChangeDecl returns the declaration of c, old -> new if it changed.
+func apiChangeDecl(c APIChange) string {
+	switch {
+	case c.Old == "":
+		return c.New
+	case c.New == "":
+		return c.Old
+	}
+	return c.Old + " -> " + c.New
+}
+
+// runAPIDiff implements the apidiff subcommand.
+func runAPIDiff(args []string) error {
+	cmd := flag.NewFlagSet("apidiff", flag.ExitOnError)
+	dir := cmd.String("dir", ".", "Project root directory, in a git repository")
+	tags := cmd.String("tags", "", "Comma-separated build tags for package loading")
+	format := cmd.String("format", "text", "Output format: text, json, markdown, or impact (just major, minor or patch)")
+	cmd.Usage = func() {
+		fmt.Fprintln(cmd.Output(), "Usage: go-callgraph-neo4j apidiff [flags] <old revision> [<new revision>]")
+		fmt.Fprintln(cmd.Output(), "Without a new revision, the old one is compared with the working tree.")
+		cmd.PrintDefaults()
+	}
+	pos := parseInterspersed(cmd, args)
+	if len(pos) == 0 || len(pos) > 2 ||
+		(*format != "text" && *format != "json" && *format != "markdown" && *format != "impact") {
+		cmd.Usage()
+		os.Exit(1)
+	}
+	absDir, err := filepath.Abs(*dir)
+	if err != nil {
+		return err
+	}
+	oldC, err := analyzeRevision(absDir, pos[0], *tags)
+	if err != nil {
+		return err
+	}
+	d := APIDiff{Old: pos[0], New: "the working tree"}
+	var newC *Collector
+	if len(pos) == 2 {
+		d.New = pos[1]
+		newC, err = analyzeRevision(absDir, pos[1], *tags)
+	} else {
+		newC, err = analyzeInMemory(absDir, *tags, []string{"./..."}, false)
+	}
+	if err != nil {
+		return err
+	}
+	d.Changes = append([]APIChange{}, DiffAPI(oldC.apiDecls(), newC.apiDecls())...)
+	d.Impact = semverImpact(d.Changes)
+	slices.SortStableFunc(d.Changes, func(a, b APIChange) int {
+		if a.Impact != b.Impact {
+			return strings.Compare(a.Impact, b.Impact) // major before minor
+		}
+		return 0
+	})
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(d)
+	case "markdown":
+		WriteAPIDiffMarkdown(os.Stdout, d)
+	case "impact":
+		fmt.Println(d.Impact)
+	default:
+		WriteAPIDiff(os.Stdout, d)
+	}
+	return nil
+}
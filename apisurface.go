@@ -0,0 +1,464 @@
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Usage of an exported symbol, from the widest: used from other modules,
+// from other packages of its module, required by an interface it
+// satisfies, only from tests, only from its own package, or not at all.
+// The last three make it a candidate for unexporting.
+const (
+	apiUsageExternal  = "external"
+	apiUsageModule    = "module"
+	apiUsageInterface = "interface"
+	apiUsageTests     = "tests"
+	apiUsagePackage   = "package"
+	apiUsageUnused    = "unused"
+)
+
+// APISymbol is an exported function, method or type of the API surface,
+// with the functions referring to it: callers of a function, and for a
+// type, the functions calling its methods or naming it in their signature
+// and the types of other packages implementing it.
+type APISymbol struct {
+	Name         string `json:"name"` // function full name or type key
+	Kind         string `json:"kind"` // func, method, struct, interface or type
+	Package      string `json:"package"`
+	File         string `json:"file"`
+	Line         int    `json:"line"`
+	InPackage    int    `json:"in_package"`    // from its own package
+	InModule     int    `json:"in_module"`     // from other packages of its module
+	OtherModules int    `json:"other_modules"` // from other modules loaded into the same graph
+	InTests      int    `json:"in_tests"`      // from test files, any package
+	Usage        string `json:"usage"`
+	Candidate    bool   `json:"candidate"` // may be unexported
+}
+
+// apiGraph is what the API surface is computed from, as read from a call
+// graph: every project function with its callers, the exported types,
+// which types implement which interfaces, and the package names.
+type apiGraph struct {
+	Funcs      []apiFunc
+	Types      []apiType
+	Implements [][2]string       // type key, interface key
+	Packages   map[string]string // import path -> package name
+	Modules    map[string]string // import path -> module path
+}
+
+// apiFunc is a project function of an apiGraph.
+type apiFunc struct {
+	Name, Package, File string
+	Line                int
+	Exported, IsMethod  bool
+	Generated           bool
+	Satisfies           bool // implements a method of a project interface
+	Receiver, Signature string
+	Callers             []apiCaller
+}
+
+// apiCaller is a project function calling an apiFunc.
+type apiCaller struct {
+	Name, Package, File string
+}
+
+// apiType is an exported type of an apiGraph.
+type apiType struct {
+	Key, Name, Package, File string
+	Line                     int
+	Kind                     string // struct, interface or type
+}
+
+// signatureIdent matches the identifiers of a signature, qualified by a
+// package name or not.
+var signatureIdent = regexp.MustCompile(`[\pL_][\pL\pN_]*(?:\.[\pL_][\pL\pN_]*)?`)
+
+// BuildAPISurface returns the exported functions, methods and types of the
+// non-main project packages, sorted by package and name. Test files,
+// generated code and methods of unexported types are left out. Types are
+// only seen used through calls to their methods, signatures and
+// implementations: a type only used in composite literals, conversions or
+// field accesses outside its package counts as unused there.
+func BuildAPISurface(g *apiGraph) []APISymbol {
+	surface := func(pkg, file string, generated bool) bool {
+		return !generated && !isTestFile(file) && !isTestPackage(pkg) && g.Packages[pkg] != "main"
+	}
+	// ref records that a function of callerPkg, declared in callerFile,
+	// refers to s.
+	ref := func(s *APISymbol, callerPkg, callerFile string) {
+		switch {
+		case isTestFile(callerFile):
+			s.InTests++
+		case callerPkg == s.Package:
+			s.InPackage++
+		case g.Modules[callerPkg] == g.Modules[s.Package]:
+			s.InModule++
+		default:
+			s.OtherModules++
+		}
+	}
+
+	var syms []APISymbol
+	satisfies := make(map[int]bool)
+	for _, fn := range g.Funcs {
+		if !fn.Exported || !surface(fn.Package, fn.File, fn.Generated) || fn.IsMethod && !token.IsExported(fn.Receiver) {
+			continue
+		}
+		s := APISymbol{Name: fn.Name, Kind: "func", Package: fn.Package, File: fn.File, Line: fn.Line}
+		if fn.IsMethod {
+			s.Kind = "method"
+		}
+		seen := make(map[string]bool)
+		for _, c := range fn.Callers {
+			if !seen[c.Name] {
+				seen[c.Name] = true
+				ref(&s, c.Package, c.File)
+			}
+		}
+		satisfies[len(syms)] = fn.Satisfies
+		syms = append(syms, s)
+	}
+
+	types := make(map[string]int)       // key -> index in syms
+	qualified := make(map[string][]int) // package name and type name -> indexes in syms
+	for _, t := range g.Types {
+		if !surface(t.Package, t.File, false) {
+			continue
+		}
+		types[t.Key] = len(syms)
+		qualified[g.Packages[t.Package]+"."+t.Name] = append(qualified[g.Packages[t.Package]+"."+t.Name], len(syms))
+		syms = append(syms, APISymbol{Name: t.Key, Kind: t.Kind, Package: t.Package, File: t.File, Line: t.Line})
+	}
+	for _, fn := range g.Funcs {
+		// The types named in its signature, qualified by package name
+		// unless of its own package.
+		refs := make(map[int]bool)
+		for _, ident := range signatureIdent.FindAllString(fn.Signature, -1) {
+			if strings.Contains(ident, ".") {
+				for _, i := range qualified[ident] {
+					if syms[i].Package != fn.Package {
+						refs[i] = true
+					}
+				}
+			} else if i, ok := types[fn.Package+"."+ident]; ok {
+				refs[i] = true
+			}
+		}
+		if i, ok := types[fn.Package+"."+fn.Receiver]; ok && fn.IsMethod {
+			delete(refs, i) // a type's own methods are not references to it
+		}
+		for i := range refs {
+			ref(&syms[i], fn.Package, fn.File)
+		}
+	}
+	// Callers of a method from other packages refer to its type.
+	for _, fn := range g.Funcs {
+		i, ok := types[fn.Package+"."+fn.Receiver]
+		if !fn.IsMethod || !ok {
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, c := range fn.Callers {
+			if c.Package != fn.Package && !seen[c.Name] {
+				seen[c.Name] = true
+				ref(&syms[i], c.Package, c.File)
+			}
+		}
+	}
+	// So do the types of other packages implementing an interface.
+	for _, impl := range g.Implements {
+		i, ok := types[impl[1]]
+		if pkg, _ := splitTypeKey(impl[0]); ok && pkg != syms[i].Package {
+			ref(&syms[i], pkg, "")
+		}
+	}
+
+	for i := range syms {
+		s := &syms[i]
+		switch {
+		case s.OtherModules > 0:
+			s.Usage = apiUsageExternal
+		case s.InModule > 0:
+			s.Usage = apiUsageModule
+		case satisfies[i]:
+			s.Usage = apiUsageInterface
+		case s.InTests > 0:
+			s.Usage = apiUsageTests
+		case s.InPackage > 0:
+			s.Usage = apiUsagePackage
+		default:
+			s.Usage = apiUsageUnused
+		}
+		s.Candidate = s.Usage == apiUsageTests || s.Usage == apiUsagePackage || s.Usage == apiUsageUnused
+	}
+	sort.Slice(syms, func(i, j int) bool {
+		if syms[i].Package != syms[j].Package {
+			return syms[i].Package < syms[j].Package
+		}
+		return syms[i].Name < syms[j].Name
+	})
+	return syms
+}
+
+// splitTypeKey splits a type key into its package path and name.
+func splitTypeKey(key string) (pkg, name string) {
+	i := strings.LastIndexByte(key, '.')
+	if i < 0 {
+		return "", key
+	}
+	return key[:i], key[i+1:]
+}
+
+// apiGraph implements callGraphReader on the analysed project.
+func (c *Collector) apiGraph() (*apiGraph, error) {
+	g := &apiGraph{Packages: make(map[string]string), Modules: make(map[string]string)}
+	for path, p := range c.Packages {
+		g.Packages[path], g.Modules[path] = p.Name, p.Module
+	}
+	satisfies := make(map[string]bool)
+	for _, e := range c.Implements {
+		g.Implements = append(g.Implements, [2]string{e.Struct, e.Interface})
+		for _, fn := range e.MethodFuncs {
+			satisfies[fn] = true
+		}
+	}
+	callers := make(map[string][]apiCaller)
+	for _, e := range c.Calls {
+		if caller, ok := c.Funcs[e.CallerFullName]; ok && !e.External {
+			callers[e.CalleeFullName] = append(callers[e.CalleeFullName],
+				apiCaller{Name: caller.FullName, Package: caller.Package, File: caller.File})
+		}
+	}
+	for name, fn := range c.Funcs {
+		if fn.File == "" || fn.Synthetic != "" {
+			continue
+		}
+		g.Funcs = append(g.Funcs, apiFunc{
+			Name: name, Package: fn.Package, File: fn.File, Line: fn.Line,
+			Exported: fn.Exported, IsMethod: fn.IsMethod, Generated: fn.Generated, Satisfies: satisfies[name],
+			Receiver: fn.Receiver, Signature: fn.Signature, Callers: callers[name],
+		})
+	}
+	for key, s := range c.Structs {
+		if s.Exported && !s.Generated {
+			g.Types = append(g.Types, apiType{Key: key, Name: s.Name, Package: s.Package, File: s.File, Line: s.Line, Kind: "struct"})
+		}
+	}
+	for key, i := range c.Interfaces {
+		if i.Exported && !i.Generated {
+			g.Types = append(g.Types, apiType{Key: key, Name: i.Name, Package: i.Package, File: i.File, Line: i.Line, Kind: "interface"})
+		}
+	}
+	for key, t := range c.NamedTypes {
+		if t.Exported && !t.Generated {
+			g.Types = append(g.Types, apiType{Key: key, Name: t.Name, Package: t.Package, File: t.File, Line: t.Line, Kind: "type"})
+		}
+	}
+	return g, nil
+}
+
+// apiGraph implements callGraphReader. Callers include the functions of
+// every module loaded into the database, or into the project: their calls
+// into this module's functions are CALLS_EXTERNAL edges to the same nodes.
+func (r *neo4jReader) apiGraph() (*apiGraph, error) {
+	g := &apiGraph{Packages: make(map[string]string), Modules: make(map[string]string)}
+	recs, err := r.read(`MATCH (p:GoPackage) WHERE p.deleted IS NULL
+		 RETURN p.import_path AS path, p.name AS name, p.module AS module`, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range recs {
+		path, _, _ := neo4j.GetRecordValue[string](rec, "path")
+		g.Packages[path], _, _ = neo4j.GetRecordValue[string](rec, "name")
+		g.Modules[path], _, _ = neo4j.GetRecordValue[string](rec, "module")
+	}
+
+	recs, err = r.read(`MATCH (f:GoFunc)
+		 WHERE f.deleted IS NULL AND f.file IS NOT NULL AND f.synthetic IS NULL
+		 OPTIONAL MATCH (caller:GoFunc)-[:ACCURATE_CALLS|CALLS_EXTERNAL]->(f)
+		 WHERE caller.deleted IS NULL AND caller.file IS NOT NULL
+		 WITH f, collect({name: caller.full_name, package: caller.package, file: caller.file}) AS callers
+		 RETURN f.full_name AS name, f.package AS package, f.file AS file, f.line AS line,
+		        coalesce(f.exported, false) AS exported, coalesce(f.is_method, false) AS is_method,
+		        coalesce(f.generated, false) AS generated, EXISTS { (f)-[:SATISFIES]->() } AS satisfies,
+		        coalesce(f.receiver, '') AS receiver, coalesce(f.signature, '') AS signature, callers`, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range recs {
+		var fn apiFunc
+		fn.Name, _, _ = neo4j.GetRecordValue[string](rec, "name")
+		fn.Package, _, _ = neo4j.GetRecordValue[string](rec, "package")
+		fn.File, _, _ = neo4j.GetRecordValue[string](rec, "file")
+		line, _, _ := neo4j.GetRecordValue[int64](rec, "line")
+		fn.Line = int(line)
+		fn.Exported, _, _ = neo4j.GetRecordValue[bool](rec, "exported")
+		fn.IsMethod, _, _ = neo4j.GetRecordValue[bool](rec, "is_method")
+		fn.Generated, _, _ = neo4j.GetRecordValue[bool](rec, "generated")
+		fn.Satisfies, _, _ = neo4j.GetRecordValue[bool](rec, "satisfies")
+		fn.Receiver, _, _ = neo4j.GetRecordValue[string](rec, "receiver")
+		fn.Signature, _, _ = neo4j.GetRecordValue[string](rec, "signature")
+		callers, _, _ := neo4j.GetRecordValue[[]any](rec, "callers")
+		for _, c := range callers {
+			m, _ := c.(map[string]any)
+			name, _ := m["name"].(string)
+			if name == "" {
+				continue // the null caller of a function without callers
+			}
+			pkg, _ := m["package"].(string)
+			file, _ := m["file"].(string)
+			fn.Callers = append(fn.Callers, apiCaller{Name: name, Package: pkg, File: file})
+		}
+		g.Funcs = append(g.Funcs, fn)
+	}
+
+	recs, err = r.read(`MATCH (t:GoStruct|GoInterface|GoNamedType)
+		 WHERE t.deleted IS NULL AND t.exported AND NOT coalesce(t.generated, false)
+		 RETURN t.key AS key, t.name AS name, t.package AS package, t.file AS file, t.line AS line,
+		        t:GoStruct AS struct, t:GoInterface AS interface`, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range recs {
+		var t apiType
+		t.Key, _, _ = neo4j.GetRecordValue[string](rec, "key")
+		t.Name, _, _ = neo4j.GetRecordValue[string](rec, "name")
+		t.Package, _, _ = neo4j.GetRecordValue[string](rec, "package")
+		t.File, _, _ = neo4j.GetRecordValue[string](rec, "file")
+		line, _, _ := neo4j.GetRecordValue[int64](rec, "line")
+		t.Line = int(line)
+		t.Kind = "type"
+		if isStruct, _, _ := neo4j.GetRecordValue[bool](rec, "struct"); isStruct {
+			t.Kind = "struct"
+		} else if isIface, _, _ := neo4j.GetRecordValue[bool](rec, "interface"); isIface {
+			t.Kind = "interface"
+		}
+		g.Types = append(g.Types, t)
+	}
+
+	recs, err = r.read(`MATCH (t:GoStruct|GoNamedType)-[:IMPLEMENTS]->(i:GoInterface)
+		 WHERE t.deleted IS NULL AND i.deleted IS NULL
+		 RETURN t.key AS type, i.key AS iface`, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range recs {
+		t, _, _ := neo4j.GetRecordValue[string](rec, "type")
+		i, _, _ := neo4j.GetRecordValue[string](rec, "iface")
+		g.Implements = append(g.Implements, [2]string{t, i})
+	}
+	return g, nil
+}
+
+// LabelUnexportCandidates sets api_usage on the nodes of the API surface
+// and replaces the UnexportCandidate label with one on the candidates.
+func (l *Neo4jLoader) LabelUnexportCandidates(syms []APISymbol) error {
+	if err := l.runCypher("MATCH (n:UnexportCandidate) REMOVE n:UnexportCandidate", nil); err != nil {
+		return err
+	}
+	var funcs, types []map[string]any
+	for _, s := range syms {
+		if s.Kind == "func" || s.Kind == "method" {
+			funcs = append(funcs, map[string]any{"id": funcID(s.Name), "usage": s.Usage, "candidate": s.Candidate})
+		} else {
+			types = append(types, map[string]any{"id": typeID(s.Name), "usage": s.Usage, "candidate": s.Candidate})
+		}
+	}
+	err := l.runBatch(
+		`UNWIND $batch AS row
+		 MATCH (f:GoFunc {id: row.id})
+		 SET f.api_usage = row.usage
+		 FOREACH (_ IN CASE WHEN row.candidate THEN [1] ELSE [] END | SET f:UnexportCandidate)`,
+		funcs,
+	)
+	if err != nil {
+		return err
+	}
+	return l.runBatch(
+		`UNWIND $batch AS row
+		 MATCH (t:GoStruct|GoInterface|GoNamedType {id: row.id})
+		 SET t.api_usage = row.usage
+		 FOREACH (_ IN CASE WHEN row.candidate THEN [1] ELSE [] END | SET t:UnexportCandidate)`,
+		types,
+	)
+}
+
+// apiCounts returns the symbols per usage.
+func apiCounts(syms []APISymbol) map[string]int {
+	counts := make(map[string]int)
+	for _, s := range syms {
+		counts[s.Usage]++
+	}
+	return counts
+}
+
+// WriteAPISurfaceReport prints the exported symbols and candidates per
+// package, then the candidates for unexporting.
+func WriteAPISurfaceReport(w io.Writer, syms []APISymbol) {
+	counts := apiCounts(syms)
+	candidates := counts[apiUsageUnused] + counts[apiUsagePackage] + counts[apiUsageTests]
+	fmt.Fprintf(w, "API surface: %d exported symbols, %d candidates for unexporting (%d unused, %d used only in their package, %d only from tests)\n",
+		len(syms), candidates, counts[apiUsageUnused], counts[apiUsagePackage], counts[apiUsageTests])
+	if len(syms) == 0 {
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Package\tExported\tCandidates")
+	for i := 0; i < len(syms); {
+		j, n := i, 0
+		for ; j < len(syms) && syms[j].Package == syms[i].Package; j++ {
+			if syms[j].Candidate {
+				n++
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", syms[i].Package, j-i, n)
+		i = j
+	}
+	tw.Flush()
+	if candidates == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\nCandidates for unexporting:")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, s := range syms {
+		if s.Candidate {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s:%d\n", s.Name, s.Kind, s.Usage, s.File, s.Line)
+		}
+	}
+	tw.Flush()
+}
+
+// WriteAPISurfaceMarkdown prints the candidates for unexporting as a
+// Markdown table.
+func WriteAPISurfaceMarkdown(w io.Writer, syms []APISymbol) {
+	counts := apiCounts(syms)
+	fmt.Fprintln(w, "## API surface")
+	fmt.Fprintf(w, "\n%d exported symbols: %d used from other modules, %d from other packages, %d required by interfaces, %d only from tests, %d only in their package, %d unused.\n",
+		len(syms), counts[apiUsageExternal], counts[apiUsageModule], counts[apiUsageInterface],
+		counts[apiUsageTests], counts[apiUsagePackage], counts[apiUsageUnused])
+	fmt.Fprintln(w, "\n### Candidates for unexporting")
+	fmt.Fprintln(w)
+	n := 0
+	for _, s := range syms {
+		if !s.Candidate {
+			continue
+		}
+		if n == 0 {
+			fmt.Fprintln(w, "| Symbol | Kind | Usage | Location |")
+			fmt.Fprintln(w, "| --- | --- | --- | --- |")
+		}
+		n++
+		fmt.Fprintf(w, "| `%s` | %s | %s | %s:%d |\n", strings.ReplaceAll(s.Name, "|", `\|`), s.Kind, s.Usage, s.File, s.Line)
+	}
+	if n == 0 {
+		fmt.Fprintln(w, "None.")
+	}
+}
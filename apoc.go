@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// Load strategies of --load-strategy.
+const (
+	loadUnwind = "unwind" // each batch shard in one transaction
+	loadAPOC   = "apoc"   // relationship shards through apoc.periodic.iterate
+)
+
+// defaultIterateBatchSize is how many rows apoc.periodic.iterate commits
+// at once by default.
+const defaultIterateBatchSize = 1000
+
+// batchPrefix starts every statement runBatch runs.
+const batchPrefix = "UNWIND $batch AS row"
+
+// relationshipMerge matches a statement merging a relationship, which
+// locks both of its nodes.
+var relationshipMerge = regexp.MustCompile(`MERGE \(\w*\)<?-\[`)
+
+// UseAPOCIterate makes the batches merging relationships run through
+// apoc.periodic.iterate, which commits every batchSize rows. Small
+// transactions hold the locks of high-degree nodes, such as common utility
+// functions, briefly instead of for a whole shard. Without APOC, it warns
+// and keeps plain UNWIND batches.
+func (l *Neo4jLoader) UseAPOCIterate(batchSize int) error {
+	if batchSize <= 0 {
+		return fmt.Errorf("invalid APOC batch size %d: want a positive number of rows", batchSize)
+	}
+	res, err := l.read("RETURN apoc.version() AS version", nil)
+	if err != nil || len(res.Records) == 0 {
+		log.Printf("Warning: APOC plugin not available, loading relationships with UNWIND batches (%v)", err)
+		return nil
+	}
+	version, _ := res.Records[0].Get("version")
+	log.Printf("Loading relationships with APOC %v periodic.iterate, %d rows per transaction", version, batchSize)
+	l.iterateBatchSize = batchSize
+	return nil
+}
+
+// iterateStatement returns the batch statement cypher run through
+// apoc.periodic.iterate, failing if any of its transactions failed, or
+// false when cypher runs as it is: without UseAPOCIterate, or when it
+// does not merge relationships.
+func (l *Neo4jLoader) iterateStatement(cypher string) (string, bool) {
+	action, ok := strings.CutPrefix(strings.TrimSpace(cypher), batchPrefix)
+	if l.iterateBatchSize == 0 || !ok || !relationshipMerge.MatchString(action) {
+		return "", false
+	}
+	// The action is a literal so that Names and Project rewrite it with the
+	// rest of the statement; the project parameter is passed on to it.
+	literal := strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", " ").Replace(strings.TrimSpace(action))
+	params := "batch: $batch"
+	if l.Project != "" {
+		params += ", project: $project"
+	}
+	return fmt.Sprintf(`CALL apoc.periodic.iterate('%s RETURN row', '%s',
+		 {batchSize: %d, parallel: false, params: {%s}})
+		 YIELD failedBatches, errorMessages
+		 CALL apoc.util.validate(failedBatches > 0, 'apoc.periodic.iterate failed: %%s', [apoc.convert.toJson(errorMessages)])
+		 RETURN failedBatches`, batchPrefix, literal, l.iterateBatchSize, params), true
+}
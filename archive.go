@@ -0,0 +1,617 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// archiveFormat names graph archives in their manifest.
+const archiveFormat = "go-callgraph-neo4j-archive"
+
+// archiveVersion changes whenever the layout or the encoding of graph
+// archives changes; archives of a later version are refused.
+const archiveVersion = 1
+
+// archiveMarkerLabels are the labels only added to nodes of another label,
+// such as GoFunc:External, so nodes are not exported by them.
+var archiveMarkerLabels = []string{"External", "Synthetic", "Unreachable", "Vulnerable", "EntryPoint", "Hot", "Hotspot", "UnexportCandidate"}
+
+// archiveImportBatch is how many rows an import writes per statement.
+const archiveImportBatch = 5000
+
+// archiveManifest is the manifest.json leading a graph archive.
+type archiveManifest struct {
+	Format        string         `json:"format"`
+	Version       int            `json:"version"`
+	Tool          string         `json:"tool"`
+	ExportedAt    time.Time      `json:"exported_at"`
+	Nodes         map[string]int `json:"nodes"`         // by label, in nodes/<label>.jsonl
+	Relationships map[string]int `json:"relationships"` // by type, in relationships/<type>.jsonl
+}
+
+// archiveNode is a line of a nodes file. Ref identifies the node within
+// the archive, for the relationships.
+type archiveNode struct {
+	Ref        int            `json:"ref"`
+	Labels     []string       `json:"labels"`
+	Properties map[string]any `json:"properties"`
+}
+
+// archiveRel is a line of a relationships file.
+type archiveRel struct {
+	Start      int            `json:"start"`
+	End        int            `json:"end"`
+	Properties map[string]any `json:"properties"`
+}
+
+// ExportArchive writes the graph of l to path as a tar of JSON Lines files,
+// gzipped if path ends in .gz or .tgz: a manifest, then the nodes by label
+// and the relationships by type, all under their default names. The
+// project property is left out, so the archive imports into any project.
+func ExportArchive(l *Neo4jLoader, path string) (*archiveManifest, error) {
+	tmp, err := os.MkdirTemp("", "callgraph-archive-")
+	if err != nil {
+		return nil, fmt.Errorf("cannot export archive: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	manifest := &archiveManifest{
+		Format: archiveFormat, Version: archiveVersion, Tool: toolVersion(), ExportedAt: time.Now().UTC(),
+		Nodes: make(map[string]int), Relationships: make(map[string]int),
+	}
+	defaults := defaultLabels(l.Names)
+	version, err := l.ServerVersion()
+	if err != nil {
+		return nil, fmt.Errorf("cannot export archive: %w", err)
+	}
+
+	var files []string
+	refs := make(map[string]int) // element id -> ref
+	for _, label := range graphLabels {
+		if slices.Contains(archiveMarkerLabels, label) {
+			continue
+		}
+		name := "nodes/" + label + ".jsonl"
+		n, err := writeArchiveFile(filepath.Join(tmp, filepath.FromSlash(name)), func(enc *json.Encoder) (int, error) {
+			count := 0
+			err := l.stream("MATCH (n:"+label+") RETURN "+elementID(version, "n")+" AS id, labels(n) AS labels, properties(n) AS props", nil,
+				func(rec *neo4j.Record) error {
+					id, _, _ := neo4j.GetRecordValue[string](rec, "id")
+					if _, ok := refs[id]; ok {
+						return nil // exported under another label
+					}
+					refs[id] = len(refs) + 1
+					node := archiveNode{Ref: refs[id]}
+					stored, _, _ := neo4j.GetRecordValue[[]any](rec, "labels")
+					for _, s := range stored {
+						if label, ok := defaults[fmt.Sprint(s)]; ok {
+							node.Labels = append(node.Labels, label)
+						}
+					}
+					props, _, _ := neo4j.GetRecordValue[map[string]any](rec, "props")
+					var err error
+					if node.Properties, err = archiveProperties(props); err != nil {
+						return fmt.Errorf("node %s: %w", id, err)
+					}
+					count++
+					return enc.Encode(node)
+				})
+			return count, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cannot export %s nodes: %w", label, err)
+		}
+		if n > 0 {
+			manifest.Nodes[label] = n
+			files = append(files, name)
+		}
+	}
+
+	dangling := 0
+	for _, relType := range graphRelTypes {
+		name := "relationships/" + relType + ".jsonl"
+		n, err := writeArchiveFile(filepath.Join(tmp, filepath.FromSlash(name)), func(enc *json.Encoder) (int, error) {
+			count := 0
+			err := l.stream("MATCH (a)-[r:"+relType+"]->(b) RETURN "+elementID(version, "a")+" AS start, "+elementID(version, "b")+" AS end, properties(r) AS props", nil,
+				func(rec *neo4j.Record) error {
+					start, _, _ := neo4j.GetRecordValue[string](rec, "start")
+					end, _, _ := neo4j.GetRecordValue[string](rec, "end")
+					if refs[start] == 0 || refs[end] == 0 {
+						dangling++ // from or to a node of another tool
+						return nil
+					}
+					rel := archiveRel{Start: refs[start], End: refs[end]}
+					props, _, _ := neo4j.GetRecordValue[map[string]any](rec, "props")
+					var err error
+					if rel.Properties, err = archiveProperties(props); err != nil {
+						return fmt.Errorf("%s relationship: %w", relType, err)
+					}
+					count++
+					return enc.Encode(rel)
+				})
+			return count, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cannot export %s relationships: %w", relType, err)
+		}
+		if n > 0 {
+			manifest.Relationships[relType] = n
+			files = append(files, name)
+		}
+	}
+	if dangling > 0 {
+		log.Printf("Warning: left out %d relationships to nodes that are not part of the graph", dangling)
+	}
+	return manifest, writeArchive(path, tmp, manifest, files)
+}
+
+// defaultLabels maps the configured names of the graph's labels to their
+// default names.
+func defaultLabels(names *GraphNames) map[string]string {
+	defaults := make(map[string]string, len(graphLabels))
+	for _, label := range graphLabels {
+		defaults[names.Name(label)] = label
+	}
+	return defaults
+}
+
+// writeArchiveFile creates the file path and writes JSON lines to it with
+// write, returning how many it wrote.
+func writeArchiveFile(path string, write func(*json.Encoder) (int, error)) (int, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	n, err := write(json.NewEncoder(f))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// writeArchive writes the archive to path: the manifest, then files from
+// dir in order.
+func writeArchive(path, dir string, manifest *archiveManifest, files []string) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("cannot write archive: %w", err)
+	}
+	defer out.Close()
+	w := io.Writer(out)
+	var gz *gzip.Writer
+	if strings.HasSuffix(path, ".gz") || strings.HasSuffix(path, ".tgz") {
+		gz = gzip.NewWriter(out)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{Name: "manifest.json", Mode: 0o644, Size: int64(len(data)), ModTime: manifest.ExportedAt}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("cannot write archive: %w", err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("cannot write archive: %w", err)
+	}
+	for _, name := range files {
+		if err := addArchiveFile(tw, filepath.Join(dir, filepath.FromSlash(name)), name, manifest.ExportedAt); err != nil {
+			return fmt.Errorf("cannot write archive: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("cannot write archive: %w", err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return fmt.Errorf("cannot write archive: %w", err)
+		}
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("cannot write archive: %w", err)
+	}
+	return nil
+}
+
+// addArchiveFile copies the file src into tw as name.
+func addArchiveFile(tw *tar.Writer, src, name string, modTime time.Time) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: fi.Size(), ModTime: modTime}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// archiveProperties returns the properties of a node or relationship as
+// archived, without project.
+func archiveProperties(props map[string]any) (map[string]any, error) {
+	archived := make(map[string]any, len(props))
+	for k, v := range props {
+		if k == "project" {
+			continue
+		}
+		value, err := archiveValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("property %s: %w", k, err)
+		}
+		archived[k] = value
+	}
+	return archived, nil
+}
+
+// archiveValue returns a property value in the JSON of archives. Datetimes
+// and whole floats are tagged objects, so that they are read back with
+// their type rather than as a string and an integer.
+func archiveValue(v any) (any, error) {
+	switch v := v.(type) {
+	case nil, bool, string, int64:
+		return v, nil
+	case float64:
+		if v == math.Trunc(v) {
+			return map[string]any{"$float": v}, nil
+		}
+		return v, nil
+	case time.Time:
+		return map[string]any{"$datetime": v.Format(time.RFC3339Nano)}, nil
+	case []any:
+		list := make([]any, len(v))
+		for i, e := range v {
+			var err error
+			if list[i], err = archiveValue(e); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("unsupported value of type %T", v)
+}
+
+// propertyValue returns the property value of v, decoded from an archive
+// with numbers kept as json.Number.
+func propertyValue(v any) (any, error) {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		return v.Float64()
+	case map[string]any:
+		if f, ok := v["$float"].(json.Number); ok {
+			return f.Float64()
+		}
+		if s, ok := v["$datetime"].(string); ok {
+			return time.Parse(time.RFC3339Nano, s)
+		}
+		return nil, fmt.Errorf("unsupported value %v", v)
+	case []any:
+		list := make([]any, len(v))
+		for i, e := range v {
+			var err error
+			if list[i], err = propertyValue(e); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	}
+	return v, nil
+}
+
+// propertyValues decodes the archived properties of a node or relationship
+// in place, leaving out project, which the loader sets.
+func propertyValues(props map[string]any) error {
+	delete(props, "project")
+	for k, v := range props {
+		value, err := propertyValue(v)
+		if err != nil {
+			return fmt.Errorf("property %s: %w", k, err)
+		}
+		props[k] = value
+	}
+	return nil
+}
+
+// ImportArchive creates the nodes and relationships of the archive src,
+// written by ExportArchive, in the graph of l under its names and project.
+// Nodes carry the ArchiveImport label and their archive ref while the
+// relationships are created.
+func ImportArchive(l *Neo4jLoader, src string) (*archiveManifest, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read archive: %w", err)
+	}
+	defer f.Close()
+	r := io.Reader(f)
+	if strings.HasSuffix(src, ".gz") || strings.HasSuffix(src, ".tgz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read archive %s: %w", src, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	header, err := tr.Next()
+	if err != nil || header.Name != "manifest.json" {
+		return nil, fmt.Errorf("%s is not a graph archive: it does not start with manifest.json", src)
+	}
+	var manifest archiveManifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("cannot read the manifest of %s: %w", src, err)
+	}
+	if manifest.Format != archiveFormat {
+		return nil, fmt.Errorf("%s is not a graph archive: format %q", src, manifest.Format)
+	}
+	if manifest.Version > archiveVersion {
+		return nil, fmt.Errorf("archive %s has version %d, written by %s; this version reads up to %d",
+			src, manifest.Version, manifest.Tool, archiveVersion)
+	}
+
+	// Refs are only unique within one archive, so the nodes left by an
+	// import that failed would join the relationships of this one.
+	if stale, err := hasNodes(l, "ArchiveImport"); err != nil {
+		return nil, err
+	} else if stale {
+		return nil, errors.New("the graph holds the nodes of an archive import that failed; import again with --clean to delete them")
+	}
+	if err := l.runCypher("CREATE INDEX archive_import_ref IF NOT EXISTS FOR (n:ArchiveImport) ON (n.archive_ref)", nil); err != nil {
+		return nil, err
+	}
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read archive %s: %w", src, err)
+		}
+		dir, file := path.Split(header.Name)
+		kind, _ := strings.CutSuffix(file, ".jsonl")
+		switch {
+		case dir == "nodes/" && slices.Contains(graphLabels, kind):
+			log.Printf("Importing %d %s nodes...", manifest.Nodes[kind], kind)
+			err = importArchiveNodes(l, tr)
+		case dir == "relationships/" && slices.Contains(graphRelTypes, kind):
+			log.Printf("Importing %d %s relationships...", manifest.Relationships[kind], kind)
+			err = importArchiveRels(l, kind, tr)
+		default:
+			err = fmt.Errorf("unknown entry")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot import %s of %s: %w", header.Name, src, err)
+		}
+	}
+
+	for {
+		res, err := l.query(`MATCH (n:ArchiveImport) WITH n LIMIT $limit
+			 REMOVE n:ArchiveImport, n.archive_ref
+			 RETURN count(n) AS done`, map[string]any{"limit": archiveImportBatch})
+		if err != nil {
+			return nil, err
+		}
+		if done, _, _ := neo4j.GetRecordValue[int64](res.Records[0], "done"); done == 0 {
+			break
+		}
+	}
+	return &manifest, l.runCypher("DROP INDEX archive_import_ref IF EXISTS", nil)
+}
+
+// hasNodes reports whether the graph of l has a node with one of labels.
+func hasNodes(l *Neo4jLoader, labels ...string) (bool, error) {
+	for _, label := range labels {
+		res, err := l.read("MATCH (n:"+label+") WITH n LIMIT 1 RETURN count(n) AS found", nil)
+		if err != nil {
+			return false, fmt.Errorf("failed to read the graph: %w", err)
+		}
+		if found, _, _ := neo4j.GetRecordValue[int64](res.Records[0], "found"); found > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// importArchiveNodes creates the nodes of a nodes file, a statement per
+// set of labels.
+func importArchiveNodes(l *Neo4jLoader, r io.Reader) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	groups := make(map[string][]map[string]any) // labels -> rows
+	flush := func(labels string) error {
+		err := l.runBatch(
+			`UNWIND $batch AS row
+			 CREATE (n:ArchiveImport:`+labels+` {archive_ref: row.ref})
+			 SET n += row.props`,
+			groups[labels])
+		delete(groups, labels)
+		return err
+	}
+	for {
+		var node archiveNode
+		if err := dec.Decode(&node); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+		for _, label := range node.Labels {
+			if !slices.Contains(graphLabels, label) {
+				return fmt.Errorf("node %d has unknown label %q", node.Ref, label)
+			}
+		}
+		if len(node.Labels) == 0 {
+			return fmt.Errorf("node %d has no label", node.Ref)
+		}
+		if err := propertyValues(node.Properties); err != nil {
+			return fmt.Errorf("node %d: %w", node.Ref, err)
+		}
+		labels := strings.Join(node.Labels, ":")
+		groups[labels] = append(groups[labels], map[string]any{"ref": node.Ref, "props": node.Properties})
+		if len(groups[labels]) == archiveImportBatch {
+			if err := flush(labels); err != nil {
+				return err
+			}
+		}
+	}
+	for labels := range groups {
+		if err := flush(labels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importArchiveRels creates the relationships of type relType from a
+// relationships file, between the nodes imported before.
+func importArchiveRels(l *Neo4jLoader, relType string, r io.Reader) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var batch []map[string]any
+	flush := func() error {
+		err := l.runBatch(
+			`UNWIND $batch AS row
+			 MATCH (a:ArchiveImport {archive_ref: row.start}), (b:ArchiveImport {archive_ref: row.end})
+			 CREATE (a)-[r:`+relType+`]->(b)
+			 SET r += row.props`,
+			batch)
+		batch = nil
+		return err
+	}
+	for {
+		var rel archiveRel
+		if err := dec.Decode(&rel); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+		if err := propertyValues(rel.Properties); err != nil {
+			return fmt.Errorf("relationship %d->%d: %w", rel.Start, rel.End, err)
+		}
+		batch = append(batch, map[string]any{"start": rel.Start, "end": rel.End, "props": rel.Properties})
+		if len(batch) == archiveImportBatch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	return flush()
+}
+
+// runExportArchive implements export archive.
+func runExportArchive(args []string) error {
+	cmd := flag.NewFlagSet("export archive", flag.ExitOnError)
+	neo4jURI := cmd.String("neo4j-uri", "bolt://localhost:7687", "Neo4j URI: bolt:// for one server, neo4j:// to route in a cluster")
+	neo4jUser := cmd.String("neo4j-user", "neo4j", "Neo4j username")
+	neo4jPass := cmd.String("neo4j-pass", "", "Neo4j password")
+	out := cmd.String("out", "", "Archive file to write, gzipped if it ends in .gz or .tgz")
+	graphOpts := addGraphFlags(cmd)
+	cmd.Usage = func() {
+		fmt.Fprintln(cmd.Output(), "Usage: go-callgraph-neo4j export archive --out <file.tar[.gz]> --neo4j-pass <password> [flags]")
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+	if *neo4jPass == "" || *out == "" || cmd.NArg() > 0 {
+		cmd.Usage()
+		os.Exit(1)
+	}
+	loader, err := openLoader(*neo4jURI, *neo4jUser, *neo4jPass, graphOpts)
+	if err != nil {
+		return err
+	}
+	defer loader.Close()
+	manifest, err := ExportArchive(loader, *out)
+	if err != nil {
+		return err
+	}
+	log.Printf("Exported %s to %s", manifest, *out)
+	return nil
+}
+
+// runImport implements the import subcommand.
+func runImport(args []string) error {
+	cmd := flag.NewFlagSet("import", flag.ExitOnError)
+	neo4jURI := cmd.String("neo4j-uri", "bolt://localhost:7687", "Neo4j URI: bolt:// for one server, neo4j:// to route in a cluster")
+	neo4jUser := cmd.String("neo4j-user", "neo4j", "Neo4j username")
+	neo4jPass := cmd.String("neo4j-pass", "", "Neo4j password")
+	in := cmd.String("in", "", "Archive file written by export archive")
+	clean := cmd.Bool("clean", false, "Delete the graph (of --project only, with it) before importing")
+	merge := cmd.Bool("merge", false, "Import into a graph that is not empty, beside the nodes already there")
+	graphOpts := addGraphFlags(cmd)
+	cmd.Usage = func() {
+		fmt.Fprintln(cmd.Output(), "Usage: go-callgraph-neo4j import archive --in <file.tar[.gz]> --neo4j-pass <password> [flags]")
+		cmd.PrintDefaults()
+	}
+	pos := parseInterspersed(cmd, args)
+	if len(pos) != 1 || pos[0] != "archive" || *neo4jPass == "" || *in == "" {
+		cmd.Usage()
+		os.Exit(1)
+	}
+	loader, err := openLoader(*neo4jURI, *neo4jUser, *neo4jPass, graphOpts)
+	if err != nil {
+		return err
+	}
+	defer loader.Close()
+	if *clean {
+		if err := loader.CleanGraph(); err != nil {
+			return err
+		}
+		if err := loader.runCypher("MATCH (n:ArchiveImport) DETACH DELETE n", nil); err != nil {
+			return err
+		}
+	} else if !*merge {
+		labels := slices.DeleteFunc(slices.Clone(graphLabels), func(l string) bool { return l == "ArchiveImport" })
+		if found, err := hasNodes(loader, labels...); err != nil {
+			return err
+		} else if found {
+			return errors.New("the graph is not empty: import with --clean to replace it, or with --merge to import beside it")
+		}
+	}
+	if err := loader.CreateIndexes(); err != nil {
+		return err
+	}
+	manifest, err := ImportArchive(loader, *in)
+	if err != nil {
+		return err
+	}
+	log.Printf("Imported %s from %s", manifest, *in)
+	return nil
+}
+
+// String summarizes the archive's contents.
+func (m *archiveManifest) String() string {
+	nodes, rels := 0, 0
+	for _, n := range m.Nodes {
+		nodes += n
+	}
+	for _, n := range m.Relationships {
+		rels += n
+	}
+	return fmt.Sprintf("%d nodes and %d relationships (archive version %d)", nodes, rels, m.Version)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Dependency kinds an ArchRule forbids.
+const (
+	ruleDepend = "depend on" // imports or calls
+	ruleImport = "import"
+	ruleCall   = "call"
+)
+
+// ArchRule forbids the packages matching From to depend on those matching
+// To. Patterns are module-relative package patterns, as in --layers.
+type ArchRule struct {
+	From, To string
+	Kind     string // depend on, import or call
+	Line     int    // line in the rules file
+}
+
+// String returns the rule as written in the rules file.
+func (r ArchRule) String() string {
+	return r.From + " must not " + r.Kind + " " + r.To
+}
+
+// parseArchRules reads a rules file of lines of the form
+// "<pattern> must not depend on|import|call <pattern>", where '#' starts a
+// comment.
+func parseArchRules(path string) ([]ArchRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open rules: %w", err)
+	}
+	defer f.Close()
+
+	var rules []ArchRule
+	sc := bufio.NewScanner(f)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		r := ArchRule{From: fields[0], Line: lineNo}
+		switch {
+		case len(fields) == 6 && fields[3] == "depend" && fields[4] == "on":
+			r.Kind, r.To = ruleDepend, fields[5]
+		case len(fields) == 5 && (fields[3] == ruleImport || fields[3] == ruleCall):
+			r.Kind, r.To = fields[3], fields[4]
+		}
+		if r.To == "" || fields[1] != "must" || fields[2] != "not" {
+			return nil, fmt.Errorf("%s:%d: want <pattern> must not depend on|import|call <pattern>", path, lineNo)
+		}
+		rules = append(rules, r)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// ArchViolation is an import or call breaking an ArchRule.
+type ArchViolation struct {
+	Rule     ArchRule
+	From, To string     // packages
+	Caller   string     // full name of the calling function; empty for imports
+	Callee   string     // full name of the called function
+	Sites    []CallSite // call sites
+}
+
+// CheckArchRules returns the imports and calls between project packages
+// that break rules, by rule, then package and function.
+func (c *Collector) CheckArchRules(rules []ArchRule) []ArchViolation {
+	var violations []ArchViolation
+	for _, r := range rules {
+		matches := func(from, to string) bool {
+			return from != to && c.matchPackage(r.From, from) && c.matchPackage(r.To, to)
+		}
+		var found []ArchViolation
+		if r.Kind != ruleCall {
+			for path, p := range c.Packages {
+				for _, imp := range p.Imports {
+					if matches(path, imp) {
+						found = append(found, ArchViolation{Rule: r, From: path, To: imp})
+					}
+				}
+			}
+		}
+		if r.Kind != ruleImport {
+			for _, e := range c.Calls {
+				caller, ok1 := c.Funcs[e.CallerFullName]
+				callee, ok2 := c.Funcs[e.CalleeFullName]
+				// Initializing imported packages follows from the import.
+				if ok1 && ok2 && matches(caller.Package, callee.Package) && !c.isPackageInitializer(e.CalleeFullName) {
+					found = append(found, ArchViolation{
+						Rule: r, From: caller.Package, To: callee.Package,
+						Caller: e.CallerFullName, Callee: e.CalleeFullName, Sites: e.Sites,
+					})
+				}
+			}
+		}
+		sort.Slice(found, func(i, j int) bool {
+			a, b := found[i], found[j]
+			if a.From != b.From {
+				return a.From < b.From
+			}
+			if a.To != b.To {
+				return a.To < b.To
+			}
+			if a.Caller != b.Caller {
+				return a.Caller < b.Caller
+			}
+			return a.Callee < b.Callee
+		})
+		violations = append(violations, found...)
+	}
+	return violations
+}
+
+// WriteArchReport prints the violations returned by CheckArchRules grouped
+// by rule.
+func WriteArchReport(w io.Writer, rulesFile string, violations []ArchViolation) {
+	fmt.Fprintf(w, "Architecture rule violations: %d\n", len(violations))
+	prev := -1
+	for _, v := range violations {
+		if v.Rule.Line != prev {
+			prev = v.Rule.Line
+			fmt.Fprintf(w, "\n%s:%d: %s\n", rulesFile, v.Rule.Line, v.Rule)
+		}
+		if v.Caller == "" {
+			fmt.Fprintf(w, "  %s imports %s\n", v.From, v.To)
+			continue
+		}
+		fmt.Fprintf(w, "  %s calls %s at %s\n", v.Caller, v.Callee, joinSites(v.Sites))
+	}
+}
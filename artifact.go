@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// graphArtifactVersion changes whenever GraphArtifact changes shape, so
+// that a load refuses an analysis written by another version of the tool.
+const graphArtifactVersion = 5
+
+// GraphArtifact is the analysis of a project ready to load into Neo4j,
+// written by analyze --out and read by load --in. It holds everything the
+// load needs, so the load runs without the source or the Go toolchain.
+type GraphArtifact struct {
+	Version   int
+	Tool      string // version of the tool that analysed
+	Dir       string // absolute project directory, keying the load checkpoint
+	Module    string
+	Patterns  []string
+	Configs   []string // build configurations
+	Flags     []string // flags of the analysis, for the AnalysisRun
+	GitSHA    string
+	GitDirty  bool
+	StartedAt time.Time
+	Duration  time.Duration // of the analysis
+
+	Collector *Collector
+	Layers    []Layer
+
+	Vulnerabilities bool     // govulncheck findings were collected
+	DeadCode        bool     // dead code was searched for
+	Dead            []string // full names of the unreachable functions
+
+	// EmbedTexts are the texts to embed by function full name, kept when
+	// the analysis ran with --embed-url.
+	EmbedTexts map[string]string
+}
+
+// deadFuncs returns the unreachable functions of a.
+func (a *GraphArtifact) deadFuncs() []*FuncNode {
+	dead := make([]*FuncNode, 0, len(a.Dead))
+	for _, name := range a.Dead {
+		if fn, ok := a.Collector.Funcs[name]; ok {
+			dead = append(dead, fn)
+		}
+	}
+	return dead
+}
+
+// WriteGraphArtifact writes a to path, replacing an earlier file at once.
+// The analysis options that hold source, such as the overlay, are left out.
+func WriteGraphArtifact(path string, a *GraphArtifact) error {
+	stored := *a
+	c := *a.Collector
+	c.Context, c.Deadline, c.Overlay = nil, time.Time{}, nil
+	c.HandlerSignatures, c.MQRules, c.Exclude = nil, nil, nil
+	stored.Collector, stored.Version, stored.Tool = &c, graphArtifactVersion, toolVersion()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("cannot write analysis: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := gob.NewEncoder(tmp).Encode(&stored); err != nil {
+		tmp.Close()
+		return fmt.Errorf("cannot encode analysis: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("cannot write analysis: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("cannot write analysis: %w", err)
+	}
+	return nil
+}
+
+// ReadGraphArtifact reads the analysis written to path by
+// WriteGraphArtifact.
+func ReadGraphArtifact(path string) (*GraphArtifact, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read analysis: %w", err)
+	}
+	defer f.Close()
+	var a GraphArtifact
+	if err := gob.NewDecoder(f).Decode(&a); err != nil {
+		return nil, fmt.Errorf("cannot decode analysis %s: %w", path, err)
+	}
+	if a.Version != graphArtifactVersion {
+		return nil, fmt.Errorf("analysis %s has format %d, written by %s; this version reads format %d, analyse again with it",
+			path, a.Version, a.Tool, graphArtifactVersion)
+	}
+	if a.Collector == nil {
+		return nil, fmt.Errorf("analysis %s holds no graph", path)
+	}
+	return &a, nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// graphSchemaPrompt describes the loaded graph to the model translating
+// questions into Cypher.
+const graphSchemaPrompt = `You translate questions about a Go code base into one read-only Cypher query over its call graph in Neo4j.
+
+Nodes:
+- GoPackage {import_path, name, module, layer, loc, statements, cycle_id, prod_reachable}
+- GoFile {path, package, loc, owners}
+- GoFunc {full_name, name, package, file, line, exported, receiver, is_method, signature, doc, loc, statements, complexity, in_degree, out_degree, prod_reachable, recursive, deprecated, generated, returns_error, takes_context, panics, may_panic}
+  full_name is the import path, receiver type and name joined with dots: example.com/app/internal/orders.Service.CreateOrder.
+  Extra labels: External (dependency or standard library functions), Unreachable (dead code), Synthetic, Hotspot (god functions, with hotspot_reasons and hotspot_score).
+- Packages, files, functions and types gone from the code may remain with deleted: true and deleted_at.
+- GoStruct, GoInterface, GoNamedType {key, name, package, file, line, exported}; key is the import path and name joined with a dot.
+- GoModule {path, version}
+- HttpEndpoint {method, path, key}
+- GrpcService {name}, GrpcMethod {full_name}
+- SqlQuery {text}, DbTable {name}, Topic {key}, Layer {name}
+- AnalysisRun {id, module, version, algorithm, git_sha, git_dirty, flags, started_at, analysis_seconds, load_seconds}: one load
+
+Relationships:
+- (GoFunc)-[:ACCURATE_CALLS {is_dynamic, site, sites, call_count, call_exprs}]->(GoFunc): calls between project functions; is_dynamic marks interface dispatch, call_count counts the call sites, sites lists them as file:line and call_exprs holds the source of each call
+- (GoFunc)-[:CALLS_EXTERNAL {is_dynamic, site, sites, call_count, call_exprs}]->(GoFunc:External)
+- (GoStruct|GoNamedType)-[:IMPLEMENTS]->(GoInterface)
+- (GoStruct|GoNamedType)-[:HAS_METHOD]->(GoFunc)
+- (GoFunc|GoStruct|GoInterface|GoNamedType)-[:IN_PACKAGE]->(GoPackage)
+- (GoPackage)-[:CONTAINS]->(GoFile), (GoFunc)-[:DEFINED_IN]->(GoFile)
+- (GoPackage)-[:IN_MODULE]->(GoModule), (GoPackage)-[:IN_LAYER]->(Layer)
+- (HttpEndpoint)-[:HANDLED_BY]->(GoFunc)
+- (GrpcService)-[:HAS_RPC]->(GrpcMethod)-[:IMPLEMENTED_BY]->(GoFunc)
+- (GoFunc)-[:EXECUTES]->(SqlQuery)-[:READS_TABLE|WRITES_TABLE]->(DbTable)
+- (GoFunc)-[:PUBLISHES_TO|CONSUMES_FROM]->(Topic)
+- (GoFunc)-[:CALLS_SERVICE]->(GrpcMethod|HttpEndpoint)
+- (AnalysisRun)-[:PRODUCED]->(GoPackage)
+
+Rules:
+- Reply with the Cypher query only, no explanation.
+- Never create, update or delete anything.
+- Leave out nodes with deleted: true unless the question is about removed code.
+- Match names loosely, e.g. toLower(f.full_name) CONTAINS 'refund', unless the question gives a full name.
+- Return properties such as full_name, file and line rather than whole nodes, and add LIMIT 100 unless the question asks for a count.`
+
+// cypherFence matches a Markdown code block around a model's answer.
+var cypherFence = regexp.MustCompile("(?s)^```[a-zA-Z]*\\s*(.*?)\\s*```$")
+
+// CypherTranslator turns questions into Cypher with an OpenAI-compatible
+// chat completions endpoint.
+type CypherTranslator struct {
+	URL    string // e.g. https://api.openai.com/v1/chat/completions
+	Model  string
+	APIKey string // sent as a bearer token if set
+	HTTP   *http.Client
+}
+
+// Translate returns the Cypher query answering question.
+func (t *CypherTranslator) Translate(ctx context.Context, question string) (string, error) {
+	var res struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	err := postJSON(ctx, t.HTTP, t.URL, t.APIKey, map[string]any{
+		"model":       t.Model,
+		"temperature": 0,
+		"messages": []map[string]string{
+			{"role": "system", "content": graphSchemaPrompt},
+			{"role": "user", "content": question},
+		},
+	}, &res)
+	if err != nil {
+		return "", fmt.Errorf("LLM request failed: %w", err)
+	}
+	if len(res.Choices) == 0 {
+		return "", fmt.Errorf("LLM returned no answer")
+	}
+	cypher := strings.TrimSpace(res.Choices[0].Message.Content)
+	if m := cypherFence.FindStringSubmatch(cypher); m != nil {
+		cypher = m[1]
+	}
+	if cypher == "" {
+		return "", fmt.Errorf("LLM returned an empty query")
+	}
+	return cypher, nil
+}
+
+// runReadOnly runs cypher with params in a read transaction, which the
+// server refuses to write in, and returns its columns and at most limit
+// rows. The last result reports that there were more.
+func runReadOnly(ctx context.Context, driver neo4j.DriverWithContext, cypher string, params map[string]any, limit int) ([]string, [][]any, bool, error) {
+	session := driver.NewSession(ctx, neo4j.SessionConfig{AccessMode: neo4j.AccessModeRead})
+	defer session.Close(ctx)
+	var keys []string
+	var rows [][]any
+	more := false
+	_, err := session.ExecuteRead(ctx, func(tx neo4j.ManagedTransaction) (any, error) {
+		keys, rows, more = nil, nil, false // the work may be retried
+		res, err := tx.Run(ctx, cypher, params)
+		if err != nil {
+			return nil, err
+		}
+		if keys, err = res.Keys(); err != nil {
+			return nil, err
+		}
+		for res.Next(ctx) {
+			if len(rows) == limit {
+				more = true
+				break
+			}
+			rows = append(rows, res.Record().Values)
+		}
+		return nil, res.Err()
+	})
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("query failed: %w", err)
+	}
+	return keys, rows, more, nil
+}
+
+// formatValue renders a result value in a table cell: nodes by their
+// full_name, key, import_path, path or name, relationships by type.
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case neo4j.Node:
+		for _, prop := range []string{"full_name", "key", "import_path", "path", "name"} {
+			if p, ok := v.Props[prop]; ok {
+				return fmt.Sprint(p)
+			}
+		}
+		return "(" + strings.Join(v.Labels, ":") + ")"
+	case neo4j.Relationship:
+		return "[:" + v.Type + "]"
+	case neo4j.Path:
+		parts := make([]string, len(v.Nodes))
+		for i, n := range v.Nodes {
+			parts[i] = formatValue(n)
+		}
+		return strings.Join(parts, " -> ")
+	case []any:
+		parts := make([]string, len(v))
+		for i, e := range v {
+			parts[i] = formatValue(e)
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case string:
+		return strings.ReplaceAll(v, "\n", " ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// writeAnswer prints the Cypher query and its results as a table.
+func writeAnswer(w io.Writer, cypher string, keys []string, rows [][]any, more bool) {
+	fmt.Fprintf(w, "Cypher:\n  %s\n\n", strings.ReplaceAll(cypher, "\n", "\n  "))
+	if len(rows) == 0 {
+		fmt.Fprintln(w, "No results.")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(keys, "\t"))
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, v := range row {
+			cells[i] = formatValue(v)
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	tw.Flush()
+	if more {
+		fmt.Fprintf(w, "\nShowing the first %d rows.\n", len(rows))
+	} else {
+		fmt.Fprintf(w, "\nRows: %d\n", len(rows))
+	}
+}
+
+// askGraph answers question over the graph loaded into Neo4j. The model
+// is told the default names of the graph, which its query is rewritten
+// from, and the query is scoped to the project of r.
+func askGraph(w io.Writer, r *neo4jReader, t *CypherTranslator, question string, limit int) error {
+	ctx := context.Background()
+	if t.HTTP == nil {
+		t.HTTP = &http.Client{Timeout: 2 * time.Minute}
+	}
+	cypher, err := t.Translate(ctx, question)
+	if err != nil {
+		return err
+	}
+	cypher, params, err := r.loader.prepare(cypher, nil)
+	if err != nil {
+		return err
+	}
+	keys, rows, more, err := runReadOnly(ctx, r.loader.driver, cypher, params, limit)
+	if err != nil {
+		fmt.Fprintf(w, "Cypher:\n  %s\n\n", strings.ReplaceAll(cypher, "\n", "\n  "))
+		return err
+	}
+	writeAnswer(w, cypher, keys, rows, more)
+	return nil
+}
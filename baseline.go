@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// baselineVersion changes whenever Baseline changes shape.
+const baselineVersion = 1
+
+// Regression kinds of report --fail-on.
+const (
+	regressionCycles     = "new-cycles"
+	regressionForbidden  = "new-forbidden-deps"
+	regressionComplexity = "complexity-increase"
+)
+
+// Baseline is the architecture debt of a project at one point, committed
+// so that CI fails only on what gets worse.
+type Baseline struct {
+	Version        int            `json:"version"`
+	PackageCycles  [][]string     `json:"package_cycles"`  // packages of each cycle, sorted
+	ForbiddenDeps  []ForbiddenDep `json:"forbidden_deps"`  // architecture rule violations
+	FuncComplexity map[string]int `json:"func_complexity"` // cyclomatic complexity by full name
+}
+
+// ForbiddenDep is a dependency between two packages breaking an
+// architecture rule, however many imports and calls make it.
+type ForbiddenDep struct {
+	Rule string `json:"rule"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Regression is something worse than in the baseline.
+type Regression struct {
+	Kind   string `json:"kind"`   // one of the --fail-on kinds
+	Name   string `json:"name"`   // the cycle, dependency or function
+	Detail string `json:"detail"` // what changed
+}
+
+// CurrentBaseline returns the baseline of the analysed project. Package
+// cycles are found with MarkPackageCycles; violations are those returned
+// by CheckArchRules.
+func (c *Collector) CurrentBaseline(violations []ArchViolation) *Baseline {
+	b := &Baseline{Version: baselineVersion, PackageCycles: [][]string{}, ForbiddenDeps: []ForbiddenDep{},
+		FuncComplexity: make(map[string]int)}
+	for _, cycle := range c.MarkPackageCycles() {
+		sorted := slices.Clone(cycle)
+		slices.Sort(sorted)
+		b.PackageCycles = append(b.PackageCycles, sorted)
+	}
+	for _, v := range violations {
+		dep := ForbiddenDep{Rule: v.Rule.String(), From: v.From, To: v.To}
+		if !slices.Contains(b.ForbiddenDeps, dep) {
+			b.ForbiddenDeps = append(b.ForbiddenDeps, dep)
+		}
+	}
+	for name, fn := range c.Funcs {
+		if fn.File != "" && !fn.Generated && fn.Synthetic == "" {
+			b.FuncComplexity[name] = fn.Complexity
+		}
+	}
+	return b
+}
+
+// Regressions returns what got worse in cur since base, of the kinds in
+// failOn: package cycles not within a cycle of the baseline, dependencies
+// breaking a rule that the baseline did not break, and functions more
+// complex than in the baseline. Functions new since the baseline are not
+// compared.
+func (base *Baseline) Regressions(cur *Baseline, failOn []string) []Regression {
+	var regs []Regression
+	if slices.Contains(failOn, regressionCycles) {
+		for _, cycle := range cur.PackageCycles {
+			known := slices.ContainsFunc(base.PackageCycles, func(old []string) bool {
+				return !slices.ContainsFunc(cycle, func(p string) bool { return !slices.Contains(old, p) })
+			})
+			if !known {
+				regs = append(regs, Regression{Kind: regressionCycles, Name: strings.Join(cycle, " <-> "),
+					Detail: fmt.Sprintf("cycle of %d packages", len(cycle))})
+			}
+		}
+	}
+	if slices.Contains(failOn, regressionForbidden) {
+		for _, dep := range cur.ForbiddenDeps {
+			if !slices.Contains(base.ForbiddenDeps, dep) {
+				regs = append(regs, Regression{Kind: regressionForbidden, Name: dep.From + " -> " + dep.To, Detail: dep.Rule})
+			}
+		}
+	}
+	if slices.Contains(failOn, regressionComplexity) {
+		for _, name := range sortedKeys(cur.FuncComplexity) {
+			old, ok := base.FuncComplexity[name]
+			if now := cur.FuncComplexity[name]; ok && now > old {
+				regs = append(regs, Regression{Kind: regressionComplexity, Name: name,
+					Detail: fmt.Sprintf("complexity %d -> %d", old, now)})
+			}
+		}
+	}
+	return regs
+}
+
+// parseFailOn parses the comma-separated regression kinds of --fail-on.
+func parseFailOn(s string) ([]string, error) {
+	kinds := splitList(s)
+	for _, k := range kinds {
+		if k != regressionCycles && k != regressionForbidden && k != regressionComplexity {
+			return nil, fmt.Errorf("unknown regression %q: want %s, %s or %s", k, regressionCycles, regressionForbidden, regressionComplexity)
+		}
+	}
+	return kinds, nil
+}
+
+// ReadBaseline reads a baseline written by WriteBaseline.
+func ReadBaseline(path string) (*Baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read baseline: %w", err)
+	}
+	var b Baseline
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("cannot read baseline %s: %w", path, err)
+	}
+	if b.Version != baselineVersion {
+		return nil, fmt.Errorf("baseline %s has version %d, want %d; write it again with --update-baseline", path, b.Version, baselineVersion)
+	}
+	return &b, nil
+}
+
+// WriteBaseline writes b to path, indented and sorted so that its diffs
+// stay readable under version control.
+func WriteBaseline(path string, b *Baseline) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// WriteRegressions prints regressions grouped by kind.
+func WriteRegressions(w io.Writer, baselinePath string, regs []Regression) {
+	if len(regs) == 0 {
+		fmt.Fprintf(w, "No regressions against %s\n", baselinePath)
+		return
+	}
+	fmt.Fprintf(w, "Regressions against %s: %d\n", baselinePath, len(regs))
+	kind := ""
+	for _, r := range regs {
+		if r.Kind != kind {
+			kind = r.Kind
+			fmt.Fprintf(w, "\n%s:\n", kind)
+		}
+		fmt.Fprintf(w, "  %s: %s\n", r.Name, r.Detail)
+	}
+}
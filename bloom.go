@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// bloomCategory styles the nodes of one label in a Bloom perspective.
+type bloomCategory struct {
+	ID                    int             `json:"id"`
+	Name                  string          `json:"name"`
+	Color                 string          `json:"color"`
+	Size                  int             `json:"size"`
+	Icon                  string          `json:"icon"`
+	Labels                []string        `json:"labels"`
+	Properties            []bloomProperty `json:"properties"`
+	HideDefaultProperties []string        `json:"hideDefaultProperties"`
+	HiddenProperties      []string        `json:"hiddenProperties"`
+	TextSize              int             `json:"textSize"`
+	TextAlign             string          `json:"textAlign"`
+	StyleRules            []any           `json:"styleRules"`
+	CreatedAt             int64           `json:"createdAt"`
+	LastEditedAt          int64           `json:"lastEditedAt"`
+}
+
+// bloomProperty is a node property shown by a Bloom category.
+type bloomProperty struct {
+	Name      string `json:"name"`
+	Exclude   bool   `json:"exclude"`
+	IsCaption bool   `json:"isCaption"`
+	DataType  string `json:"dataType"`
+}
+
+// bloomRelType is a relationship type of a Bloom perspective.
+type bloomRelType struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Color      string `json:"color"`
+	Size       int    `json:"size"`
+	Properties []any  `json:"properties"`
+}
+
+// bloomTemplate is a Bloom search phrase backed by a Cypher query.
+type bloomTemplate struct {
+	ID              string       `json:"id"`
+	Name            string       `json:"name"`
+	Text            string       `json:"text"`
+	Cypher          string       `json:"cypher"`
+	Params          []bloomParam `json:"params"`
+	HasCypherErrors bool         `json:"hasCypherErrors"`
+	CreatedAt       int64        `json:"createdAt"`
+}
+
+// bloomParam is a parameter of a search phrase, suggested from the values
+// of a node property.
+type bloomParam struct {
+	Name            string `json:"name"`
+	DataType        string `json:"dataType"`
+	SuggestionLabel string `json:"suggestionLabel"`
+	SuggestionProp  string `json:"suggestionProp"`
+}
+
+// bloomPerspective is a Neo4j Bloom perspective, in the format Bloom
+// exports and imports.
+type bloomPerspective struct {
+	ID                      string          `json:"id"`
+	Name                    string          `json:"name"`
+	Categories              []bloomCategory `json:"categories"`
+	CategoryIndex           int             `json:"categoryIndex"`
+	RelationshipTypes       []bloomRelType  `json:"relationshipTypes"`
+	Templates               []bloomTemplate `json:"templates"`
+	HiddenRelationshipTypes []string        `json:"hiddenRelationshipTypes"`
+	HiddenCategories        []string        `json:"hiddenCategories"`
+	HideUncategorisedData   bool            `json:"hideUncategorisedData"`
+	CreatedAt               int64           `json:"createdAt"`
+	LastEditedAt            int64           `json:"lastEditedAt"`
+	Version                 string          `json:"version"`
+}
+
+// bloomCategories lists the node labels styled by the perspective with
+// their color, size and properties, the first of which is the caption.
+var bloomCategories = []struct {
+	label, color string
+	size         int
+	props        []string
+}{
+	{"GoPackage", "#F79767", 3, []string{"import_path", "name", "layer", "loc", "file_count"}},
+	{"GoInterface", "#C990C0", 2, []string{"name", "key", "package", "file", "line"}},
+	{"GoStruct", "#57C7E3", 2, []string{"name", "key", "package", "file", "line"}},
+	{"GoNamedType", "#8DCC93", 2, []string{"name", "key", "package", "file", "line"}},
+	{"GoFunc", "#68BDF6", 1, []string{"name", "full_name", "package", "file", "line", "complexity", "in_degree", "out_degree"}},
+	{"GoFile", "#D9C8AE", 1, []string{"path", "package", "loc"}},
+	{"GoModule", "#ECB5C9", 3, []string{"path", "version"}},
+	{"HttpEndpoint", "#F16667", 2, []string{"key", "method", "path"}},
+	{"GrpcService", "#FFC454", 2, []string{"name"}},
+	{"GrpcMethod", "#FFC454", 1, []string{"full_name"}},
+	{"Layer", "#4C8EDA", 3, []string{"name"}},
+}
+
+// bloomRelTypes lists the relationship types of the perspective.
+var bloomRelTypes = []string{
+	"ACCURATE_CALLS", "CALLS_EXTERNAL", "IMPLEMENTS", "SATISFIES", "HAS_METHOD", "IN_PACKAGE",
+	"CONTAINS", "DEFINED_IN", "IN_MODULE", "REQUIRES", "HANDLED_BY", "HAS_RPC", "IMPLEMENTED_BY",
+	"IN_LAYER", "LAYER_DEPENDS_ON", "INITIALIZES_BEFORE", "CALLS_SERVICE",
+}
+
+// bloomTemplates lists the search phrases of the perspective: the phrase,
+// its query and, per parameter, the label and property suggesting values.
+var bloomTemplates = []struct {
+	text, cypher string
+	params       [][3]string
+}{
+	{"callers of $func",
+		"MATCH (caller:GoFunc)-[r:ACCURATE_CALLS]->(f:GoFunc {full_name: $func}) RETURN caller, r, f",
+		[][3]string{{"$func", "GoFunc", "full_name"}}},
+	{"callees of $func",
+		"MATCH (f:GoFunc {full_name: $func})-[r:ACCURATE_CALLS|CALLS_EXTERNAL]->(callee:GoFunc) RETURN f, r, callee",
+		[][3]string{{"$func", "GoFunc", "full_name"}}},
+	{"call path from $from to $to",
+		"MATCH p = shortestPath((a:GoFunc {full_name: $from})-[:ACCURATE_CALLS*..10]->(b:GoFunc {full_name: $to})) RETURN p",
+		[][3]string{{"$from", "GoFunc", "full_name"}, {"$to", "GoFunc", "full_name"}}},
+	{"implementations of $iface",
+		"MATCH (t)-[r:IMPLEMENTS]->(i:GoInterface {key: $iface}) RETURN t, r, i",
+		[][3]string{{"$iface", "GoInterface", "key"}}},
+	{"methods of $type",
+		"MATCH (t {key: $type})-[r:HAS_METHOD]->(m:GoFunc) WHERE t:GoStruct OR t:GoNamedType RETURN t, r, m",
+		[][3]string{{"$type", "GoStruct", "key"}}},
+	{"contents of package $pkg",
+		"MATCH (n)-[r:IN_PACKAGE]->(p:GoPackage {import_path: $pkg}) RETURN n, r, p",
+		[][3]string{{"$pkg", "GoPackage", "import_path"}}},
+	{"handler of $endpoint",
+		"MATCH (e:HttpEndpoint {key: $endpoint})-[r:HANDLED_BY]->(f:GoFunc) RETURN e, r, f",
+		[][3]string{{"$endpoint", "HttpEndpoint", "key"}}},
+}
+
+// newBloomPerspective returns the perspective for the graph of module
+// loaded with names and project.
+func newBloomPerspective(module string, names *GraphNames, project string) bloomPerspective {
+	now := time.Now().UnixMilli()
+	p := bloomPerspective{
+		ID:                      "go-callgraph-" + module,
+		Name:                    "Go call graph: " + module,
+		CategoryIndex:           len(bloomCategories),
+		HiddenRelationshipTypes: []string{},
+		HiddenCategories:        []string{},
+		CreatedAt:               now,
+		LastEditedAt:            now,
+		Version:                 "2.0.0",
+	}
+	for i, c := range bloomCategories {
+		cat := bloomCategory{
+			ID: i + 1, Name: names.Name(c.label), Color: c.color, Size: c.size, Icon: "no-icon",
+			Labels: []string{names.Name(c.label)}, HideDefaultProperties: []string{}, HiddenProperties: []string{},
+			TextSize: 1, TextAlign: "top", StyleRules: []any{}, CreatedAt: now, LastEditedAt: now,
+		}
+		for j, prop := range c.props {
+			dataType := "string"
+			switch prop {
+			case "line", "loc", "file_count", "complexity", "in_degree", "out_degree":
+				dataType = "integer"
+			}
+			cat.Properties = append(cat.Properties, bloomProperty{Name: prop, IsCaption: j == 0, DataType: dataType})
+		}
+		p.Categories = append(p.Categories, cat)
+	}
+	for _, t := range bloomRelTypes {
+		t = names.Name(t)
+		p.RelationshipTypes = append(p.RelationshipTypes, bloomRelType{ID: t, Name: t, Color: "#A5ABB6", Size: 1, Properties: []any{}})
+	}
+	for i, t := range bloomTemplates {
+		tmpl := bloomTemplate{
+			ID: fmt.Sprintf("template-%d", i+1), Name: t.text, Text: t.text, Cypher: projectCypher(names.Rewrite(t.cypher), project), CreatedAt: now,
+		}
+		for _, param := range t.params {
+			tmpl.Params = append(tmpl.Params, bloomParam{Name: param[0], DataType: "String", SuggestionLabel: names.Name(param[1]), SuggestionProp: param[2]})
+		}
+		p.Templates = append(p.Templates, tmpl)
+	}
+	return p
+}
+
+// WriteBloomPerspective writes a Neo4j Bloom perspective for the graph of
+// module to path, ready to import from Bloom's perspective gallery: it
+// styles the node labels of the graph and adds search phrases such as
+// "callers of $func". The perspective uses names and project, as the graph
+// was loaded with.
+func WriteBloomPerspective(path, module string, names *GraphNames, project string) error {
+	data, err := json.MarshalIndent(newBloomPerspective(module, names, project), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write Bloom perspective: %w", err)
+	}
+	return nil
+}
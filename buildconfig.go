@@ -0,0 +1,388 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// BuildConfig is one set of build constraints to analyse the project under.
+// Empty fields keep the toolchain defaults.
+type BuildConfig struct {
+	GOOS   string
+	GOARCH string
+	Tags   []string
+}
+
+// String names the configuration as goos/goarch[:tag,tag], the form used in
+// --build-matrix and in build_config properties.
+func (b BuildConfig) String() string {
+	goos, goarch := b.GOOS, b.GOARCH
+	if goos == "" {
+		goos = "default"
+	}
+	if goarch == "" {
+		goarch = "default"
+	}
+	s := goos + "/" + goarch
+	if len(b.Tags) > 0 {
+		s += ":" + strings.Join(b.Tags, ",")
+	}
+	return s
+}
+
+// Env returns the environment overrides selecting the configuration.
+func (b BuildConfig) Env() []string {
+	var env []string
+	if b.GOOS != "" {
+		env = append(env, "GOOS="+b.GOOS)
+	}
+	if b.GOARCH != "" {
+		env = append(env, "GOARCH="+b.GOARCH)
+	}
+	return env
+}
+
+// BuildFlags returns the go build flags selecting the configuration.
+func (b BuildConfig) BuildFlags() []string {
+	if len(b.Tags) == 0 {
+		return nil
+	}
+	return []string{"-tags=" + strings.Join(b.Tags, ",")}
+}
+
+// parseBuildConfigs returns the configurations to analyse. Without a matrix
+// that is the single configuration given by goos, goarch and tags; otherwise
+// one per semicolon-separated goos/goarch[:tag,tag] entry, each also built
+// with tags.
+func parseBuildConfigs(matrix, goos, goarch, tags string) ([]BuildConfig, error) {
+	baseTags := splitList(tags)
+	if strings.TrimSpace(matrix) == "" {
+		return []BuildConfig{{GOOS: goos, GOARCH: goarch, Tags: baseTags}}, nil
+	}
+	if goos != "" || goarch != "" {
+		return nil, fmt.Errorf("--goos and --goarch cannot be combined with --build-matrix")
+	}
+
+	var configs []BuildConfig
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(matrix, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		platform, entryTags, _ := strings.Cut(entry, ":")
+		goos, goarch, ok := strings.Cut(platform, "/")
+		if !ok || goos == "" || goarch == "" {
+			return nil, fmt.Errorf("build configuration %q: want goos/goarch[:tag,tag]", entry)
+		}
+		bc := BuildConfig{GOOS: goos, GOARCH: goarch}
+		bc.Tags = append(append(bc.Tags, baseTags...), splitList(entryTags)...)
+		if seen[bc.String()] {
+			return nil, fmt.Errorf("duplicate build configuration %q", bc)
+		}
+		seen[bc.String()] = true
+		configs = append(configs, bc)
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("no build configurations in %q", matrix)
+	}
+	return configs, nil
+}
+
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// MergeBuildConfigs combines the results of analysing the project under
+// several build configurations into one collector. Nodes and edges found in
+// every configuration are merged as usual; the others get BuildConfigs
+// listing the configurations they were found in. collectors[i] must hold
+// the results for configs[i].
+func MergeBuildConfigs(configs []BuildConfig, collectors []*Collector) *Collector {
+	names := make([]string, len(configs))
+	for i, bc := range configs {
+		names[i] = bc.String()
+	}
+	merged := NewCollector(collectors[0].RootModule)
+	merged.WithSource = collectors[0].WithSource
+	merged.SourceMaxBytes = collectors[0].SourceMaxBytes
+	merged.PointerReceivers = collectors[0].PointerReceivers
+	merged.LabelSynthetic = collectors[0].LabelSynthetic
+	merged.MayPanic = collectors[0].MayPanic
+	merged.HandlerSignatures = collectors[0].HandlerSignatures
+	merged.MQRules = collectors[0].MQRules
+	merged.Overlay = collectors[0].Overlay
+	merged.Deadline = collectors[len(collectors)-1].Deadline
+	merged.Coverage = 1
+
+	pkgs := make([]map[string]*PackageNode, len(collectors))
+	files := make([]map[string]*FileNode, len(collectors))
+	structs := make([]map[string]*StructNode, len(collectors))
+	ifaces := make([]map[string]*InterfaceNode, len(collectors))
+	named := make([]map[string]*NamedTypeNode, len(collectors))
+	aliases := make([]map[string]*AliasNode, len(collectors))
+	funcs := make([]map[string]*FuncNode, len(collectors))
+	externals := make([]map[string]*ExternalFuncNode, len(collectors))
+	grpc := make([]map[string]*GRPCService, len(collectors))
+	for i, c := range collectors {
+		pkgs[i], structs[i], ifaces[i] = c.Packages, c.Structs, c.Interfaces
+		named[i], aliases[i], funcs[i] = c.NamedTypes, c.Aliases, c.Funcs
+		files[i], externals[i], grpc[i] = c.Files, c.ExternalFuncs, c.GRPCServices
+
+		merged.Partial = merged.Partial || c.Partial
+		merged.Static = merged.Static || c.Static
+		merged.Coverage = min(merged.Coverage, c.Coverage)
+		for k, v := range c.modules {
+			merged.modules[k] = v
+		}
+		for k, v := range c.deprecated {
+			merged.deprecated[k] = v
+		}
+	}
+	mergeNodes(merged.Packages, pkgs, names, func(n *PackageNode, in []string) { n.BuildConfigs = in })
+	mergeNodes(merged.Files, files, names, func(n *FileNode, in []string) { n.BuildConfigs = in })
+	mergeNodes(merged.Structs, structs, names, func(n *StructNode, in []string) { n.BuildConfigs = in })
+	mergeNodes(merged.Interfaces, ifaces, names, func(n *InterfaceNode, in []string) { n.BuildConfigs = in })
+	mergeNodes(merged.NamedTypes, named, names, func(n *NamedTypeNode, in []string) { n.BuildConfigs = in })
+	mergeNodes(merged.Aliases, aliases, names, func(n *AliasNode, in []string) { n.BuildConfigs = in })
+	mergeNodes(merged.Funcs, funcs, names, func(n *FuncNode, in []string) { n.BuildConfigs = in })
+	mergeNodes(merged.ExternalFuncs, externals, names, func(n *ExternalFuncNode, in []string) { n.BuildConfigs = in })
+	mergeNodes(merged.GRPCServices, grpc, names, func(n *GRPCService, in []string) { n.BuildConfigs = in })
+	mergePackageSizes(merged, pkgs)
+
+	merged.Calls = mergeEdges(collectors, names,
+		func(c *Collector) []CallEdge { return c.Calls },
+		func(e CallEdge) string { return e.CallerFullName + "|" + e.CalleeFullName },
+		func(e *CallEdge, in []string) { e.BuildConfigs = in },
+		func(dst *CallEdge, src CallEdge) {
+			// Sites differ between configurations when their files do.
+			for _, s := range src.Sites {
+				if !slices.Contains(dst.Sites, s) {
+					dst.Sites = append(dst.Sites, s)
+					dst.Count++
+				}
+			}
+			for _, s := range src.DetachedContext {
+				if !slices.Contains(dst.DetachedContext, s) {
+					dst.DetachedContext = append(dst.DetachedContext, s)
+				}
+			}
+			sortSites(dst.Sites)
+			sortSites(dst.DetachedContext)
+			dst.IsDynamic = dst.IsDynamic || src.IsDynamic
+			dst.MayPanic = dst.MayPanic || src.MayPanic
+		})
+	merged.Implements = mergeEdges(collectors, names,
+		func(c *Collector) []ImplementsEdge { return c.Implements },
+		func(e ImplementsEdge) string { return e.Struct + "|" + e.Interface },
+		func(e *ImplementsEdge, in []string) { e.BuildConfigs = in },
+		func(*ImplementsEdge, ImplementsEdge) {})
+	merged.Endpoints = mergeEdges(collectors, names,
+		func(c *Collector) []HTTPEndpoint { return c.Endpoints },
+		func(e HTTPEndpoint) string { return e.Key() + "|" + e.Handler + "|" + e.Site.String() },
+		func(e *HTTPEndpoint, in []string) { e.BuildConfigs = in },
+		func(*HTTPEndpoint, HTTPEndpoint) {})
+	merged.Queries = mergeEdges(collectors, names,
+		func(c *Collector) []SQLQuery { return c.Queries },
+		func(q SQLQuery) string { return q.Caller + "|" + q.Text },
+		func(q *SQLQuery, in []string) { q.BuildConfigs = in },
+		func(dst *SQLQuery, src SQLQuery) {
+			for _, s := range src.Sites {
+				if !slices.Contains(dst.Sites, s) {
+					dst.Sites = append(dst.Sites, s)
+				}
+			}
+			sortSites(dst.Sites)
+		})
+	merged.Topics = mergeEdges(collectors, names,
+		func(c *Collector) []TopicUse { return c.Topics },
+		func(u TopicUse) string { return u.Func + "|" + u.Role + "|" + u.Key() },
+		func(u *TopicUse, in []string) { u.BuildConfigs = in },
+		func(dst *TopicUse, src TopicUse) {
+			for _, s := range src.Sites {
+				if !slices.Contains(dst.Sites, s) {
+					dst.Sites = append(dst.Sites, s)
+				}
+			}
+			sortSites(dst.Sites)
+		})
+	merged.ConfigReads = mergeEdges(collectors, names,
+		func(c *Collector) []ConfigRead { return c.ConfigReads },
+		func(r ConfigRead) string { return r.Func + "|" + r.Struct + "." + r.Field + "|" + r.Kind + "|" + r.Key },
+		func(r *ConfigRead, in []string) { r.BuildConfigs = in },
+		func(dst *ConfigRead, src ConfigRead) {
+			for _, s := range src.Sites {
+				if !slices.Contains(dst.Sites, s) {
+					dst.Sites = append(dst.Sites, s)
+				}
+			}
+			sortSites(dst.Sites)
+		})
+	merged.Outbound = mergeEdges(collectors, names,
+		func(c *Collector) []ServiceCall { return c.Outbound },
+		func(s ServiceCall) string { return s.Func + "|" + s.Protocol + "|" + s.Key() },
+		func(s *ServiceCall, in []string) { s.BuildConfigs = in },
+		func(dst *ServiceCall, src ServiceCall) {
+			for _, s := range src.Sites {
+				if !slices.Contains(dst.Sites, s) {
+					dst.Sites = append(dst.Sites, s)
+				}
+			}
+			sortSites(dst.Sites)
+		})
+	merged.Wiring = mergeEdges(collectors, names,
+		func(c *Collector) []DIEdge { return c.Wiring },
+		func(e DIEdge) string {
+			return e.Kind + "|" + e.Framework + "|" + e.Func + "|" + e.Struct + "|" + e.Type
+		},
+		func(e *DIEdge, in []string) { e.BuildConfigs = in },
+		func(dst *DIEdge, src DIEdge) {
+			for _, s := range src.Sites {
+				if !slices.Contains(dst.Sites, s) {
+					dst.Sites = append(dst.Sites, s)
+				}
+			}
+			sortSites(dst.Sites)
+		})
+	merged.FuncValues = mergeEdges(collectors, names,
+		func(c *Collector) []FuncValueUse { return c.FuncValues },
+		func(u FuncValueUse) string {
+			return u.Holder + "|" + u.Func + "|" + u.Kind + "|" + u.Callee + "|" + u.Param + "|" + u.Struct + "|" + u.Field
+		},
+		func(u *FuncValueUse, in []string) { u.BuildConfigs = in },
+		func(dst *FuncValueUse, src FuncValueUse) {
+			for _, s := range src.Sites {
+				if !slices.Contains(dst.Sites, s) {
+					dst.Sites = append(dst.Sites, s)
+				}
+			}
+			sortSites(dst.Sites)
+		})
+	merged.SyncUses = mergeEdges(collectors, names,
+		func(c *Collector) []SyncUse { return c.SyncUses },
+		func(u SyncUse) string { return u.Func + "|" + u.Var + "|" + u.Op },
+		func(u *SyncUse, in []string) { u.BuildConfigs = in },
+		func(dst *SyncUse, src SyncUse) {
+			for _, f := range src.Guarded {
+				if !slices.Contains(dst.Guarded, f) {
+					dst.Guarded = append(dst.Guarded, f)
+				}
+			}
+			for _, s := range src.Sites {
+				if !slices.Contains(dst.Sites, s) {
+					dst.Sites = append(dst.Sites, s)
+				}
+			}
+			sortSites(dst.Sites)
+		})
+	merged.ErrorFlows = mergeEdges(collectors, names,
+		func(c *Collector) []ErrorFlow { return c.ErrorFlows },
+		func(f ErrorFlow) string { return f.Callee + "|" + f.Caller + "|" + f.Kind },
+		func(f *ErrorFlow, in []string) { f.BuildConfigs = in },
+		func(dst *ErrorFlow, src ErrorFlow) {
+			for _, s := range src.Sites {
+				if !slices.Contains(dst.Sites, s) {
+					dst.Sites = append(dst.Sites, s)
+				}
+			}
+			sortSites(dst.Sites)
+		})
+	return merged
+}
+
+// mergeNodes unions the node maps of all configurations into dst, keeping
+// the first configuration's node for each key. Nodes missing from some
+// configurations get the names of those they were found in.
+func mergeNodes[T any](dst map[string]T, srcs []map[string]T, names []string, setConfigs func(T, []string)) {
+	found := make(map[string][]string)
+	for i, src := range srcs {
+		for key, n := range src {
+			if _, ok := dst[key]; !ok {
+				dst[key] = n
+			}
+			found[key] = append(found[key], names[i])
+		}
+	}
+	for key, in := range found {
+		if len(in) < len(names) {
+			setConfigs(dst[key], in)
+		}
+	}
+}
+
+// mergePackageSizes sets the sizes of the merged packages from the merged
+// files and functions, so that a package counts the files and statements
+// of every configuration rather than those of the first configuration
+// having it. Test files are left out, as in the package of one
+// configuration. Errors of the package in any configuration are kept.
+func mergePackageSizes(merged *Collector, pkgs []map[string]*PackageNode) {
+	generated := make(map[string]int)
+	for path, p := range merged.Packages {
+		p.Files, p.LOC, p.Statements = 0, 0, 0
+		for _, src := range pkgs {
+			if n, ok := src[path]; ok && n != p {
+				for _, err := range n.Errors {
+					p.Errors = appendUnique(p.Errors, err)
+				}
+			}
+		}
+	}
+	for _, f := range merged.Files {
+		if p, ok := merged.Packages[f.Package]; ok && !strings.HasSuffix(f.Path, "_test.go") {
+			p.Files++
+			p.LOC += f.LOC
+			if f.Generated {
+				generated[f.Package]++
+			}
+		}
+	}
+	for path, p := range merged.Packages {
+		p.Generated = p.Files > 0 && generated[path] == p.Files
+	}
+	for _, fn := range merged.Funcs {
+		if p, ok := merged.Packages[fn.Package]; ok && !strings.HasSuffix(fn.File, "_test.go") {
+			p.Statements += fn.Statements
+		}
+	}
+}
+
+// mergeEdges is mergeNodes for edge lists, identifying edges by key. An
+// edge found again in a later configuration is folded into the first with
+// combine.
+func mergeEdges[E any](collectors []*Collector, names []string, edges func(*Collector) []E, key func(E) string, setConfigs func(*E, []string), combine func(*E, E)) []E {
+	var merged []E
+	index := make(map[string]int)
+	var found [][]string
+	for i, c := range collectors {
+		for _, e := range edges(c) {
+			k := key(e)
+			j, ok := index[k]
+			if !ok {
+				j = len(merged)
+				index[k] = j
+				merged = append(merged, e)
+				found = append(found, nil)
+			} else {
+				combine(&merged[j], e)
+			}
+			// An edge can repeat within one configuration.
+			if n := len(found[j]); n == 0 || found[j][n-1] != names[i] {
+				found[j] = append(found[j], names[i])
+			}
+		}
+	}
+	for j := range merged {
+		if len(found[j]) < len(names) {
+			setConfigs(&merged[j], found[j])
+		}
+	}
+	return merged
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/modfile"
+)
+
+// analysisCacheVersion changes whenever the cached Collector changes shape,
+// so that older cache entries are ignored.
+const analysisCacheVersion = 3
+
+// AnalysisInputs is what decides the result of the analysis besides the
+// source files, keying the analysis cache.
+type AnalysisInputs struct {
+	Module   string
+	Patterns []string
+	Configs  []string // build configurations
+	Env      []string // --env overrides
+	Tests    bool     // test variants loaded
+	Overlay  map[string][]byte
+
+	// The collector options.
+	WithSource        bool
+	SourceMaxBytes    int
+	PointerReceivers  bool
+	LabelSynthetic    bool
+	MayPanic          bool
+	HandlerSignatures []string
+	MQRules           []MQRule
+	Exclude           []string
+}
+
+// analysisCacheEntry is what the cache stores: the exported fields of the
+// collector after analysis, options left out, and the deprecation notes
+// the reports still need.
+type analysisCacheEntry struct {
+	Collector  *Collector
+	Deprecated map[string]string
+}
+
+// analysisCacheKey hashes in the inputs, the Go toolchain and this tool's
+// versions, and the Go and module files under dir and under the local
+// directories its go.mod replaces modules with or its go.work uses.
+func analysisCacheKey(dir string, in AnalysisInputs) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "v%d\n%s\n", analysisCacheVersion, toolVersion())
+	goVersion, err := exec.Command("go", "env", "GOVERSION").Output()
+	if err != nil {
+		return "", fmt.Errorf("cannot get the Go version: %w", err)
+	}
+	h.Write(goVersion)
+	inputs, err := json.Marshal(in)
+	if err != nil {
+		return "", err
+	}
+	h.Write(inputs)
+
+	roots, err := localModuleDirs(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, root := range roots {
+		if err := hashSourceTree(h, root); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// localModuleDirs returns dir and the directories of the modules that its
+// go.mod replaces with local paths or its go.work uses, sorted.
+func localModuleDirs(dir string) ([]string, error) {
+	dirs := map[string]bool{dir: true}
+	if data, err := os.ReadFile(filepath.Join(dir, "go.mod")); err == nil {
+		f, err := modfile.ParseLax("go.mod", data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse go.mod: %w", err)
+		}
+		for _, r := range f.Replace {
+			if r.New.Version == "" {
+				dirs[absUnder(dir, r.New.Path)] = true
+			}
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "go.work")); err == nil {
+		f, err := modfile.ParseWork("go.work", data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse go.work: %w", err)
+		}
+		for _, u := range f.Use {
+			dirs[absUnder(dir, u.Path)] = true
+		}
+	}
+	sorted := make([]string, 0, len(dirs))
+	for d := range dirs {
+		sorted = append(sorted, d)
+	}
+	sort.Strings(sorted)
+	return sorted, nil
+}
+
+// absUnder resolves path relative to dir.
+func absUnder(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(dir, path)
+}
+
+// hashSourceTree writes the path and content hash of every file under root
+// that the go command reads to h, skipping the directories it ignores.
+func hashSourceTree(h io.Writer, root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != root && (name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch {
+		case strings.HasSuffix(name, ".go"), name == "go.mod", name == "go.sum",
+			name == "go.work", name == "go.work.sum", name == "modules.txt":
+		default:
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		fmt.Fprintf(h, "%s %x\n", path, sum)
+		return nil
+	})
+}
+
+// analysisCachePath returns the file caching the analysis keyed by key.
+func analysisCachePath(cacheDir, key string) string {
+	return filepath.Join(cacheDir, "analysis-"+key[:32]+".gob")
+}
+
+// ReadAnalysisCache decodes the analysis cached under key into c, a
+// collector configured with the options of the analysis, and reports
+// whether there was one.
+func ReadAnalysisCache(cacheDir, key string, c *Collector) (bool, error) {
+	f, err := os.Open(analysisCachePath(cacheDir, key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("cannot read analysis cache: %w", err)
+	}
+	defer f.Close()
+	// Options are not stored, so decoding keeps those of c.
+	entry := analysisCacheEntry{Collector: c, Deprecated: c.deprecated}
+	if err := gob.NewDecoder(f).Decode(&entry); err != nil {
+		return false, fmt.Errorf("cannot decode analysis cache %s: %w", f.Name(), err)
+	}
+	return true, nil
+}
+
+// WriteAnalysisCache stores the analysis of c under key.
+func WriteAnalysisCache(cacheDir, key string, c *Collector) error {
+	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+		return fmt.Errorf("cannot write analysis cache: %w", err)
+	}
+	stored := *c
+	stored.Context, stored.Deadline, stored.Overlay, stored.Stream = nil, time.Time{}, nil, nil
+	stored.WithSource, stored.SourceMaxBytes = false, 0
+	stored.PointerReceivers, stored.LabelSynthetic, stored.MayPanic = false, false, false
+	stored.HandlerSignatures, stored.MQRules, stored.Exclude = nil, nil, nil
+
+	path := analysisCachePath(cacheDir, key)
+	tmp, err := os.CreateTemp(cacheDir, filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("cannot write analysis cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := gob.NewEncoder(tmp).Encode(analysisCacheEntry{Collector: &stored, Deprecated: c.deprecated}); err != nil {
+		tmp.Close()
+		return fmt.Errorf("cannot encode analysis cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("cannot write analysis cache: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("cannot write analysis cache: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// maxCallExprBytes caps the call expression text stored on a call site;
+// calls passing function literals can otherwise span whole screens.
+const maxCallExprBytes = 256
+
+// String returns the site as file:line.
+func (s CallSite) String() string {
+	return fmt.Sprintf("%s:%d", s.File, s.Line)
+}
+
+// joinSites lists call sites as file:line, comma-separated.
+func joinSites(sites []CallSite) string {
+	s := make([]string, len(sites))
+	for i, site := range sites {
+		s[i] = site.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+// siteLess orders call sites by file, line and column.
+func siteLess(a, b CallSite) bool {
+	if a.File != b.File {
+		return a.File < b.File
+	}
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Column < b.Column
+}
+
+// sortSites sorts call sites by position.
+func sortSites(sites []CallSite) {
+	sort.Slice(sites, func(i, j int) bool { return siteLess(sites[i], sites[j]) })
+}
+
+// callSiteIndex finds the call expression behind an SSA call instruction
+// position: the opening parenthesis of an ordinary call, or the go or
+// defer keyword of a go or defer statement.
+type callSiteIndex struct {
+	fset    *token.FileSet
+	exprs   map[token.Pos]*ast.CallExpr
+	overlay map[string][]byte
+	src     map[string][]byte // file name -> contents, read on demand
+}
+
+// newCallSiteIndex indexes the call expressions of the project packages
+// among pkgs and their dependencies.
+func (c *Collector) newCallSiteIndex(pkgs []*packages.Package) *callSiteIndex {
+	idx := &callSiteIndex{
+		exprs:   make(map[token.Pos]*ast.CallExpr),
+		overlay: c.Overlay,
+		src:     make(map[string][]byte),
+	}
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if !c.isProjectPackage(pkg.PkgPath) {
+			return
+		}
+		idx.fset = pkg.Fset
+		for _, file := range pkg.Syntax {
+			ast.Inspect(file, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.CallExpr:
+					idx.exprs[n.Lparen] = n
+				case *ast.GoStmt:
+					idx.exprs[n.Go] = n.Call
+				case *ast.DeferStmt:
+					idx.exprs[n.Defer] = n.Call
+				}
+				return true
+			})
+		}
+	})
+	return idx
+}
+
+// site returns the CallSite at pos, with relative file names. Positions
+// with no indexed call expression get only their start.
+func (idx *callSiteIndex) site(c *Collector, fset *token.FileSet, pos token.Pos) CallSite {
+	p := fset.Position(pos)
+	site := CallSite{File: c.intern(c.relPath(p.Filename)), Line: p.Line, Column: p.Column}
+	call, ok := idx.exprs[pos]
+	if !ok || fset != idx.fset {
+		return site
+	}
+	start, end := fset.Position(call.Pos()), fset.Position(call.End())
+	site.Line, site.Column = start.Line, start.Column
+	site.EndLine, site.EndColumn = end.Line, end.Column
+
+	src, ok := idx.src[start.Filename]
+	if !ok {
+		if src, ok = idx.overlay[start.Filename]; !ok {
+			src, _ = os.ReadFile(start.Filename) // unreadable files just get no text
+		}
+		idx.src[start.Filename] = src
+	}
+	if src != nil {
+		expr, truncated := snippet(src, start.Offset, end.Offset, maxCallExprBytes)
+		if truncated {
+			expr += "…"
+		}
+		site.Expr = expr
+	}
+	return site
+}
+
+// syntaxFuncs names the functions around syntax nodes as SSA names them.
+type syntaxFuncs struct {
+	c     *Collector
+	prog  *ssa.Program
+	names map[token.Pos]string // function literal or init declaration -> full name, built on demand
+}
+
+// newSyntaxFuncs returns a syntaxFuncs for the functions of prog.
+func (c *Collector) newSyntaxFuncs(prog *ssa.Program) *syntaxFuncs {
+	return &syntaxFuncs{c: c, prog: prog}
+}
+
+// enclosing returns the full name of the innermost function around the
+// node at the top of stack, or the package initializer at package level.
+func (sf *syntaxFuncs) enclosing(pkg *packages.Package, stack []ast.Node) string {
+	for i := len(stack) - 1; i >= 0; i-- {
+		switch f := stack[i].(type) {
+		case *ast.FuncLit:
+			return sf.funcLit(f)
+		case *ast.FuncDecl:
+			if f.Recv == nil && f.Name.Name == "init" {
+				return sf.name(f.Pos()) // init#N
+			}
+			if fn, ok := pkg.TypesInfo.Defs[f.Name].(*types.Func); ok {
+				return sf.c.funcFullName(pkg.PkgPath, fn)
+			}
+		}
+	}
+	return pkg.PkgPath + ".init"
+}
+
+// funcLit returns the full name SSA gives the closure of lit.
+func (sf *syntaxFuncs) funcLit(lit *ast.FuncLit) string {
+	return sf.name(lit.Pos())
+}
+
+// name returns the full name of the project function literal or init
+// function whose syntax starts at pos.
+func (sf *syntaxFuncs) name(pos token.Pos) string {
+	if sf.names == nil {
+		sf.names = make(map[token.Pos]string)
+		for fn := range ssautil.AllFunctions(sf.prog) {
+			if fn.Pkg == nil || !sf.c.isProjectPackage(fn.Pkg.Pkg.Path()) {
+				continue
+			}
+			switch syntax := fn.Syntax().(type) {
+			case *ast.FuncLit:
+				sf.names[syntax.Pos()] = sf.c.ssaFuncName(fn)
+			case *ast.FuncDecl:
+				if syntax.Recv == nil && syntax.Name.Name == "init" {
+					sf.names[syntax.Pos()] = sf.c.ssaFuncName(fn)
+				}
+			}
+		}
+	}
+	return sf.names[pos]
+}
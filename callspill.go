@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// callSpill holds the call edges found during extraction, one per call
+// site, in a temporary file rather than in memory, while SSA and the call
+// graph take most of it. Once extraction is over, merge reads them back
+// as one edge per caller and callee.
+type callSpill struct {
+	file *os.File
+	buf  *bufio.Writer
+	enc  *gob.Encoder
+	err  error // first write error
+}
+
+// newCallSpill creates the temporary file of a callSpill; Close removes it.
+func newCallSpill() (*callSpill, error) {
+	f, err := os.CreateTemp("", "callgraph-calls-*.gob")
+	if err != nil {
+		return nil, fmt.Errorf("cannot create the call edge file: %w", err)
+	}
+	buf := bufio.NewWriterSize(f, 1<<20)
+	return &callSpill{file: f, buf: buf, enc: gob.NewEncoder(buf)}, nil
+}
+
+// add writes e to the file.
+func (s *callSpill) add(e CallEdge) {
+	if s.err == nil {
+		s.err = s.enc.Encode(&e)
+	}
+}
+
+// merge reads the edges back, merging those between the same functions
+// into one edge listing all sites, in the order of first appearance.
+// Names and file paths go through intern, so that each is kept once
+// however many edges repeat it.
+func (s *callSpill) merge(intern func(string) string) ([]CallEdge, error) {
+	if s.err == nil {
+		s.err = s.buf.Flush()
+	}
+	if s.err != nil {
+		return nil, fmt.Errorf("cannot write the call edge file %s: %w", s.file.Name(), s.err)
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	dec := gob.NewDecoder(bufio.NewReaderSize(s.file, 1<<20))
+	index := make(map[[2]string]int)
+	var merged []CallEdge
+	for {
+		var e CallEdge
+		if err := dec.Decode(&e); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot read the call edge file %s: %w", s.file.Name(), err)
+		}
+		e.CallerFullName, e.CalleeFullName = intern(e.CallerFullName), intern(e.CalleeFullName)
+		for i := range e.Sites {
+			e.Sites[i].File = intern(e.Sites[i].File)
+		}
+		for i := range e.DetachedContext {
+			e.DetachedContext[i].File = intern(e.DetachedContext[i].File)
+		}
+		key := [2]string{e.CallerFullName, e.CalleeFullName}
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(merged)
+			merged = append(merged, e)
+			continue
+		}
+		m := &merged[i]
+		m.IsDynamic = m.IsDynamic || e.IsDynamic
+		m.Sites = append(m.Sites, e.Sites...)
+		m.Count += e.Count
+		m.MayPanic = m.MayPanic || e.MayPanic
+		m.DetachedContext = append(m.DetachedContext, e.DetachedContext...)
+	}
+	for i := range merged {
+		sortSites(merged[i].Sites)
+		sortSites(merged[i].DetachedContext)
+	}
+	return merged, nil
+}
+
+// Close removes the file.
+func (s *callSpill) Close() {
+	s.file.Close()
+	os.Remove(s.file.Name())
+}
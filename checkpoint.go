@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Checkpoint records how far a load got, so that a load interrupted by a
+// crash or cancellation can resume with --resume instead of starting over.
+// The load is a sequence of named steps, each a sequence of write
+// statements; the checkpoint is saved after every statement.
+type Checkpoint struct {
+	// Fingerprint identifies the load: the module, flags, git state and
+	// entity counts. Resuming a load with another fingerprint is refused.
+	Fingerprint string `json:"fingerprint"`
+
+	// LoadedAt is when the interrupted load started, reused by its
+	// resumption to stamp the nodes with --soft-delete.
+	LoadedAt time.Time `json:"loaded_at"`
+
+	Done       []string `json:"done"`           // completed steps, in order
+	Step       string   `json:"step,omitempty"` // the step in progress
+	Statements int      `json:"statements"`     // statements of Step completed
+
+	path string
+	skip int // statements of the step being resumed left to skip
+}
+
+// checkpointPath returns the file keeping the checkpoint of the loads of
+// the module in dir into the project's graph, in the user cache directory.
+func checkpointPath(dir, project string) string {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		cache = os.TempDir()
+	}
+	sum := sha256.Sum256([]byte(dir + "\x00" + project))
+	return filepath.Join(cache, "go-callgraph-neo4j", "checkpoint-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// loadFingerprint identifies a load by what decides the statements it
+// runs: the module, the flags other than --resume, the git state of the
+// analysed code and the number of entities of each kind.
+func loadFingerprint(module string, flags []string, gitSHA string, gitDirty bool, counts map[string]int) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s %t\n", module, gitSHA, gitDirty)
+	for _, f := range flags {
+		if !strings.HasPrefix(f, "resume=") {
+			fmt.Fprintln(h, f)
+		}
+	}
+	kinds := make([]string, 0, len(counts))
+	for kind := range counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Fprintf(h, "%s=%d\n", kind, counts[kind])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// NewCheckpoint returns an empty checkpoint for a load starting at
+// loadedAt, saved to path.
+func NewCheckpoint(path, fingerprint string, loadedAt time.Time) *Checkpoint {
+	return &Checkpoint{Fingerprint: fingerprint, LoadedAt: loadedAt, path: path}
+}
+
+// ReadCheckpoint reads the checkpoint saved to path, or returns nil if
+// there is none.
+func ReadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read checkpoint: %w", err)
+	}
+	cp := &Checkpoint{path: path}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("cannot parse checkpoint %s: %w", path, err)
+	}
+	return cp, nil
+}
+
+// String summarizes the progress recorded by the checkpoint.
+func (c *Checkpoint) String() string {
+	s := fmt.Sprintf("%d steps done", len(c.Done))
+	if c.Step != "" {
+		s += fmt.Sprintf(", %s at statement %d", c.Step, c.Statements+1)
+	}
+	return s
+}
+
+// done reports whether step completed before.
+func (c *Checkpoint) done(step string) bool {
+	for _, d := range c.Done {
+		if d == step {
+			return true
+		}
+	}
+	return false
+}
+
+// begin records that step started. Unless restart is set, the statements
+// the step completed before an interruption are skipped.
+func (c *Checkpoint) begin(step string, restart bool) error {
+	c.skip = 0
+	if c.Step == step && !restart {
+		c.skip = c.Statements
+	} else {
+		c.Step, c.Statements = step, 0
+	}
+	return c.save()
+}
+
+// skipStatement reports whether the next statement of the step completed
+// before an interruption, consuming it.
+func (c *Checkpoint) skipStatement() bool {
+	if c.skip == 0 {
+		return false
+	}
+	c.skip--
+	return true
+}
+
+// statementDone records that a statement of the current step completed.
+func (c *Checkpoint) statementDone() error {
+	c.Statements++
+	return c.save()
+}
+
+// finish records that the current step completed.
+func (c *Checkpoint) finish() error {
+	c.Done = append(c.Done, c.Step)
+	c.Step, c.Statements = "", 0
+	return c.save()
+}
+
+// save writes the checkpoint to its file, replacing the earlier one at
+// once so that a crash never leaves it half written.
+func (c *Checkpoint) save() error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return fmt.Errorf("cannot save checkpoint: %w", err)
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("cannot save checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("cannot save checkpoint: %w", err)
+	}
+	return nil
+}
+
+// Remove deletes the checkpoint file once the load completed.
+func (c *Checkpoint) Remove() error {
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// sortRows orders rows by their JSON encoding, so that a batch built by
+// ranging over maps splits into the same shards on every run.
+func sortRows(rows []map[string]any) error {
+	keys := make([][]byte, len(rows))
+	for i, row := range rows {
+		data, err := json.Marshal(row)
+		if err != nil {
+			return fmt.Errorf("cannot order row %s: %w", describeRow(row), err)
+		}
+		keys[i] = data
+	}
+	sort.Sort(rowsByKey{rows, keys})
+	return nil
+}
+
+// rowsByKey sorts rows along with their keys.
+type rowsByKey struct {
+	rows []map[string]any
+	keys [][]byte
+}
+
+func (r rowsByKey) Len() int           { return len(r.rows) }
+func (r rowsByKey) Less(i, j int) bool { return bytes.Compare(r.keys[i], r.keys[j]) < 0 }
+func (r rowsByKey) Swap(i, j int) {
+	r.rows[i], r.rows[j] = r.rows[j], r.rows[i]
+	r.keys[i], r.keys[j] = r.keys[j], r.keys[i]
+}
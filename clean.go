@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+// runClean implements the clean subcommand.
+func runClean(args []string) error {
+	cmd := flag.NewFlagSet("clean", flag.ExitOnError)
+	neo4jURI := cmd.String("neo4j-uri", "bolt://localhost:7687", "Neo4j URI: bolt:// for one server, neo4j:// to route in a cluster")
+	neo4jUser := cmd.String("neo4j-user", "neo4j", "Neo4j username")
+	neo4jPass := cmd.String("neo4j-pass", "", "Neo4j password")
+	edgesOnly := cmd.Bool("edges-only", false, "Delete the relationships only and keep the nodes")
+	var pkgs stringList
+	cmd.Var(&pkgs, "package", "Import path of a package to delete with its files, functions and types (repeatable)")
+	graphOpts := addGraphFlags(cmd)
+	cmd.Usage = func() {
+		fmt.Fprintln(cmd.Output(), "Usage: go-callgraph-neo4j clean --neo4j-pass <password> [--edges-only | --package <path>...] [flags]")
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+	if *neo4jPass == "" || cmd.NArg() > 0 || (*edgesOnly && len(pkgs) > 0) {
+		cmd.Usage()
+		os.Exit(1)
+	}
+
+	loader, err := openLoader(*neo4jURI, *neo4jUser, *neo4jPass, graphOpts)
+	if err != nil {
+		return err
+	}
+	defer loader.Close()
+	switch {
+	case *edgesOnly:
+		return loader.CleanEdges()
+	case len(pkgs) > 0:
+		return loader.CleanPackages(pkgs)
+	default:
+		return loader.CleanGraph()
+	}
+}
+
+// runOrphans implements the orphans subcommand.
+func runOrphans(args []string) error {
+	cmd := flag.NewFlagSet("orphans", flag.ExitOnError)
+	neo4jURI := cmd.String("neo4j-uri", "bolt://localhost:7687", "Neo4j URI: bolt:// for one server, neo4j:// to route in a cluster")
+	neo4jUser := cmd.String("neo4j-user", "neo4j", "Neo4j username")
+	neo4jPass := cmd.String("neo4j-pass", "", "Neo4j password")
+	dryRun := cmd.Bool("dry-run", false, "List the orphan functions instead of deleting them")
+	graphOpts := addGraphFlags(cmd)
+	cmd.Usage = func() {
+		fmt.Fprintln(cmd.Output(), "Usage: go-callgraph-neo4j orphans --neo4j-pass <password> [flags]")
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+	if *neo4jPass == "" || cmd.NArg() > 0 {
+		cmd.Usage()
+		os.Exit(1)
+	}
+
+	loader, err := openLoader(*neo4jURI, *neo4jUser, *neo4jPass, graphOpts)
+	if err != nil {
+		return err
+	}
+	defer loader.Close()
+	if *dryRun {
+		names, err := loader.Orphans()
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		log.Printf("%d orphan functions", len(names))
+		return nil
+	}
+	deleted, err := loader.DeleteOrphans()
+	if err != nil {
+		return err
+	}
+	log.Printf("Deleted %d orphan functions", deleted)
+	return nil
+}
+
+// openLoader connects to Neo4j and returns a loader for the graph chosen
+// by graphOpts.
+func openLoader(uri, user, pass string, graphOpts *graphFlags) (*Neo4jLoader, error) {
+	names, err := graphOpts.names()
+	if err != nil {
+		return nil, err
+	}
+	loader, err := NewNeo4jLoader(context.Background(), uri, user, pass)
+	if err != nil {
+		return nil, err
+	}
+	loader.Names = names
+	loader.Project = *graphOpts.project
+	return loader, nil
+}
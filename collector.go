@@ -1,11 +1,16 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"go/token"
 	"go/types"
+	"slices"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/callgraph/static"
 	"golang.org/x/tools/go/callgraph/vta"
 	"golang.org/x/tools/go/packages"
 	"golang.org/x/tools/go/ssa"
@@ -16,13 +21,97 @@ import (
 // from Go packages using static analysis.
 type Collector struct {
 	RootModule string
+	Deadline   time.Time       // zero means no analysis time limit
+	Context    context.Context // cancelled to abandon the analysis; nil never is
+
+	WithSource     bool // capture function source text
+	SourceMaxBytes int  // truncate captured source; <= 0 means no limit
+
+	Overlay map[string][]byte // file contents replacing those on disk, by absolute path
+
+	// PointerReceivers names pointer-receiver methods pkg.(*T).Method
+	// instead of pkg.T.Method. It must be set before collecting.
+	PointerReceivers bool
+
+	// LabelSynthetic keeps SSA wrappers, thunks and bound method wrappers
+	// as GoFunc nodes marked Synthetic. By default calls through them are
+	// collapsed into calls to the functions they wrap.
+	LabelSynthetic bool
+
+	// MayPanic computes which functions a panic can leave, propagated
+	// through the call graph up to the functions that recover.
+	MayPanic bool
+
+	// HandlerSignatures are normalized signatures (see shapeOf) of
+	// functions to mark as handler entry points.
+	HandlerSignatures []string
+
+	// MQRules match the calls and literals naming message queue topics.
+	MQRules []MQRule
+
+	// Exclude are module-relative package patterns (internal/gen/...) whose
+	// function bodies are not built into SSA, which saves analysis time.
+	// Their declarations are kept, so their functions are nodes without
+	// outgoing calls.
+	Exclude []string
+
+	// Stream, if set, receives the nodes and relationships of the graph
+	// as they are collected, with the properties known at that point.
+	Stream GraphSink
 
 	Packages   map[string]*PackageNode
+	Files      map[string]*FileNode
 	Structs    map[string]*StructNode
 	Interfaces map[string]*InterfaceNode
+	NamedTypes map[string]*NamedTypeNode
+	Aliases    map[string]*AliasNode
 	Funcs      map[string]*FuncNode
 	Calls      []CallEdge
 	Implements []ImplementsEdge
+	Modules    map[string]*ModuleNode
+	Requires   []RequireEdge
+	Vulns      []VulnFinding
+	Endpoints  []HTTPEndpoint
+	Outbound   []ServiceCall
+	Queries    []SQLQuery
+	Topics     []TopicUse
+	Profile    *ProfileData // pprof samples, if a profile was given
+
+	// ExternalFuncs holds stubs for dependency functions that call or are
+	// called by project functions.
+	ExternalFuncs map[string]*ExternalFuncNode
+	modules       map[string]*packages.Module // package path -> providing module
+	deprecated    map[string]string           // symbol key -> deprecation note, dependencies included
+	escapes       map[*ssa.Function]bool      // functions a panic can leave, with MayPanic
+	names         map[*ssa.Function]string    // memoized ssaFuncName
+	interned      map[string]string           // names and paths shared by nodes and edges, see intern
+	calls         *callSpill                  // call edges being extracted
+
+	// GRPCServices holds the gRPC services declared or served by the
+	// project, by proto name.
+	GRPCServices map[string]*GRPCService
+
+	// ConfigReads are the environment variables and configuration keys
+	// read by project code.
+	ConfigReads []ConfigRead
+
+	// Wiring holds the provider and injection edges declared to the
+	// dependency injection frameworks.
+	Wiring []DIEdge
+
+	// FuncValues are the uses of project functions as values.
+	FuncValues []FuncValueUse
+
+	// ErrorFlows are the calls whose error the caller returns or ignores.
+	ErrorFlows []ErrorFlow
+
+	// SyncUses are the sync primitives of project structs and variables,
+	// and the calls of their methods.
+	SyncUses []SyncUse
+
+	Partial  bool    // analysis stopped early at Deadline
+	Coverage float64 // estimated fraction of the call graph extracted
+	Static   bool    // VTA missed Deadline and the static call graph was used
 }
 
 // NewCollector creates a Collector scoped to the given root module path.
@@ -30,9 +119,20 @@ func NewCollector(rootModule string) *Collector {
 	return &Collector{
 		RootModule: rootModule,
 		Packages:   make(map[string]*PackageNode),
+		Files:      make(map[string]*FileNode),
 		Structs:    make(map[string]*StructNode),
 		Interfaces: make(map[string]*InterfaceNode),
+		NamedTypes: make(map[string]*NamedTypeNode),
+		Aliases:    make(map[string]*AliasNode),
 		Funcs:      make(map[string]*FuncNode),
+		Modules:    make(map[string]*ModuleNode),
+
+		ExternalFuncs: make(map[string]*ExternalFuncNode),
+		modules:       make(map[string]*packages.Module),
+		deprecated:    make(map[string]string),
+		names:         make(map[*ssa.Function]string),
+		interned:      make(map[string]string),
+		GRPCServices:  make(map[string]*GRPCService),
 	}
 }
 
@@ -41,6 +141,16 @@ func (c *Collector) isProjectPackage(pkgPath string) bool {
 	return strings.HasPrefix(pkgPath, c.RootModule)
 }
 
+// excluded reports whether pkgPath matches one of the Exclude patterns.
+func (c *Collector) excluded(pkgPath string) bool {
+	for _, pattern := range c.Exclude {
+		if c.isProjectPackage(pkgPath) && c.matchPackage(pattern, pkgPath) {
+			return true
+		}
+	}
+	return false
+}
+
 // relPath strips the module prefix from a full file or package path,
 // returning a path relative to the project root.
 func (c *Collector) relPath(fullPath string) string {
@@ -60,6 +170,10 @@ func (c *Collector) CollectTypes(pkgs []*packages.Package) {
 		if !c.isProjectPackage(pkg.PkgPath) {
 			return
 		}
+		// A package recompiled for a test binary, such as p [p.test] with
+		// the test files of p, has the path of the package itself, whose
+		// node is kept; see below.
+		prev := c.Packages[pkg.PkgPath]
 
 		// Package node
 		c.Packages[pkg.PkgPath] = &PackageNode{
@@ -67,15 +181,25 @@ func (c *Collector) CollectTypes(pkgs []*packages.Package) {
 			Name:       pkg.Name,
 			Dir:        c.relPath(pkg.PkgPath),
 		}
+		if pkg.Module != nil {
+			c.Packages[pkg.PkgPath].Module = pkg.Module.Path
+		}
+		for _, err := range pkg.Errors {
+			c.Packages[pkg.PkgPath].Errors = appendUnique(c.Packages[pkg.PkgPath].Errors, err.Error())
+		}
 
 		scope := pkg.Types.Scope()
 		for _, name := range scope.Names() {
 			obj := scope.Lookup(name)
 			pos := pkg.Fset.Position(obj.Pos())
-			file := c.relPath(pos.Filename)
+			file := c.intern(c.relPath(pos.Filename))
 
 			switch o := obj.(type) {
 			case *types.TypeName:
+				if o.IsAlias() {
+					c.collectAlias(pkg, o, file, pos.Line)
+					break
+				}
 				switch t := o.Type().Underlying().(type) {
 				case *types.Struct:
 					key := pkg.PkgPath + "." + name
@@ -86,41 +210,70 @@ func (c *Collector) CollectTypes(pkgs []*packages.Package) {
 						Line:       pos.Line,
 						Exported:   o.Exported(),
 						FieldCount: t.NumFields(),
+						Fields:     exportedFields(t, pkg.Types),
 					}
 				case *types.Interface:
 					key := pkg.PkgPath + "." + name
 					c.Interfaces[key] = &InterfaceNode{
-						Name:     name,
-						Package:  pkg.PkgPath,
-						File:     file,
-						Line:     pos.Line,
-						Exported: o.Exported(),
-						Methods:  t.NumMethods(),
+						Name:      name,
+						Package:   pkg.PkgPath,
+						File:      file,
+						Line:      pos.Line,
+						Exported:  o.Exported(),
+						Methods:   t.NumMethods(),
+						MethodSet: methodSet(t, pkg.Types),
+					}
+				default:
+					key := pkg.PkgPath + "." + name
+					c.NamedTypes[key] = &NamedTypeNode{
+						Name:       name,
+						Package:    pkg.PkgPath,
+						File:       file,
+						Line:       pos.Line,
+						Exported:   o.Exported(),
+						Kind:       typeKind(t),
+						Underlying: types.TypeString(t, nameQualifier(pkg.Types)),
 					}
 				}
 
 			case *types.Func:
 				sig := o.Type().(*types.Signature)
 				fn := &FuncNode{
-					Name:     name,
-					FullName: pkg.PkgPath + "." + name,
-					Package:  pkg.PkgPath,
-					File:     file,
-					Line:     pos.Line,
-					Exported: o.Exported(),
+					Name:      name,
+					FullName:  pkg.PkgPath + "." + name,
+					Package:   pkg.PkgPath,
+					File:      file,
+					Line:      pos.Line,
+					Exported:  o.Exported(),
+					Signature: signatureString(sig, pkg.Types),
+
+					APISignature: apiSignatureString(sig, pkg.Types),
+					TakesContext: takesContext(sig),
+				}
+				if c.isHandler(sig) {
+					fn.EntryPoint = entryPointHandler
 				}
 				if recv := sig.Recv(); recv != nil {
-					recvType := recv.Type()
-					if ptr, ok := recvType.(*types.Pointer); ok {
-						recvType = ptr.Elem()
-					}
-					if named, ok := recvType.(*types.Named); ok {
+					if named, ptr := receiverNamed(recv.Type()); named != nil {
 						fn.Receiver = named.Obj().Name()
+						fn.ReceiverPtr = ptr
 						fn.IsMethod = true
-						fn.FullName = pkg.PkgPath + "." + fn.Receiver + "." + name
+						fn.FullName = c.methodFullName(pkg.PkgPath, fn.Receiver, ptr, name)
 					}
 				}
 				c.Funcs[fn.FullName] = fn
+
+			case *types.Const:
+				if o.Exported() {
+					c.Packages[pkg.PkgPath].Values = append(c.Packages[pkg.PkgPath].Values,
+						"const "+name+" "+types.TypeString(unnamedParams(o.Type()), nameQualifier(pkg.Types))+" = "+o.Val().ExactString())
+				}
+
+			case *types.Var:
+				if o.Exported() {
+					c.Packages[pkg.PkgPath].Values = append(c.Packages[pkg.PkgPath].Values,
+						"var "+name+" "+types.TypeString(unnamedParams(o.Type()), nameQualifier(pkg.Types)))
+				}
 			}
 		}
 
@@ -132,94 +285,402 @@ func (c *Collector) CollectTypes(pkgs []*packages.Package) {
 					for i := 0; i < named.NumMethods(); i++ {
 						m := named.Method(i)
 						pos := pkg.Fset.Position(m.Pos())
-						file := c.relPath(pos.Filename)
+						file := c.intern(c.relPath(pos.Filename))
+						sig := m.Type().(*types.Signature)
+						_, ptr := receiverNamed(sig.Recv().Type())
 						fn := &FuncNode{
-							Name:     m.Name(),
-							FullName: pkg.PkgPath + "." + name + "." + m.Name(),
-							Package:  pkg.PkgPath,
-							File:     file,
-							Line:     pos.Line,
-							Exported: m.Exported(),
-							Receiver: name,
-							IsMethod: true,
+							Name:      m.Name(),
+							FullName:  c.methodFullName(pkg.PkgPath, name, ptr, m.Name()),
+							Package:   pkg.PkgPath,
+							File:      file,
+							Line:      pos.Line,
+							Exported:  m.Exported(),
+							Receiver:  name,
+							IsMethod:  true,
+							Signature: signatureString(sig, pkg.Types),
+
+							APISignature: apiSignatureString(sig, pkg.Types),
+							ReceiverPtr:  ptr,
+							TakesContext: takesContext(sig),
+						}
+						if c.isHandler(sig) {
+							fn.EntryPoint = entryPointHandler
 						}
 						c.Funcs[fn.FullName] = fn
 					}
 				}
 			}
 		}
+
+		c.collectSizeMetrics(pkg)
+		c.collectFiles(pkg)
+		c.collectImports(pkg)
+		c.collectLayerDirective(pkg)
+		if prev != nil {
+			node := c.Packages[pkg.PkgPath]
+			if pkg.ID != pkg.PkgPath {
+				node, prev = prev, node
+				c.Packages[pkg.PkgPath] = node
+			}
+			for _, err := range prev.Errors {
+				node.Errors = appendUnique(node.Errors, err)
+			}
+		}
+		c.streamPackage(pkg)
 	})
 }
 
-// CollectCallGraph builds SSA, runs VTA, and extracts CALLS edges.
-func (c *Collector) CollectCallGraph(pkgs []*packages.Package) {
-	// Build SSA
+// collectAlias records a type alias declaration (type Foo = bar.Baz).
+func (c *Collector) collectAlias(pkg *packages.Package, tn *types.TypeName, file string, line int) {
+	target := types.Unalias(tn.Type())
+	alias := &AliasNode{
+		Name:       tn.Name(),
+		Package:    pkg.PkgPath,
+		File:       file,
+		Line:       line,
+		Exported:   tn.Exported(),
+		TargetType: types.TypeString(target, nameQualifier(pkg.Types)),
+	}
+	if named, ok := target.(*types.Named); ok && named.Obj().Pkg() != nil {
+		obj := named.Origin().Obj()
+		alias.Target = obj.Pkg().Path() + "." + obj.Name()
+	}
+	c.Aliases[pkg.PkgPath+"."+tn.Name()] = alias
+}
+
+// CollectCallGraph builds SSA, runs VTA, and extracts CALLS edges. When
+// Context is cancelled, it stops early and leaves the collector incomplete.
+// The edges are spilled to a temporary file until extraction is over, and
+// an error is returned if it cannot be written.
+func (c *Collector) CollectCallGraph(pkgs []*packages.Package) error {
+	// Remember which module provides each package for external stubs.
+	// Standard library packages have no module.
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		c.modules[pkg.PkgPath] = pkg.Module
+	})
+
+	// Build SSA for the requested packages and for every project package
+	// they import, so calls between them resolve when only some package
+	// patterns were loaded.
 	prog, ssaPkgs := ssautil.AllPackages(pkgs, ssa.InstantiateGenerics)
+	var build []*ssa.Package
 	for _, p := range ssaPkgs {
-		if p != nil {
-			p.Build()
+		if p != nil && !c.excluded(p.Pkg.Path()) {
+			build = append(build, p)
+		}
+	}
+	for _, p := range prog.AllPackages() {
+		if c.isProjectPackage(p.Pkg.Path()) && !c.excluded(p.Pkg.Path()) {
+			build = append(build, p) // Build is a no-op when built already
 		}
 	}
+	endSSA := timePhase("ssa")
+	building := startProgress("Building SSA", len(build), "packages")
+	for _, p := range build {
+		p.Build()
+		building.Add(1)
+	}
+	building.Finish()
+	endSSA()
 
 	// Run VTA (Variable Type Analysis) -- best balance of precision vs speed.
-	cg := vta.CallGraph(ssautil.AllFunctions(prog), nil)
-
-	// Extract edges -- only between project functions.
-	callgraph.GraphVisitEdges(cg, func(edge *callgraph.Edge) error {
-		caller := edge.Caller.Func
-		callee := edge.Callee.Func
+	endVTA := timePhase("vta")
+	vtaRun := startProgress("Running VTA", 0, "")
+	cg, resolved := c.buildCallGraph(prog)
+	vtaRun.Finish()
+	endVTA()
+	if cg == nil {
+		return nil // interrupted
+	}
+	if c.MayPanic {
+		c.escapes = panicEscapes(cg)
+	}
 
-		if caller.Pkg == nil || callee.Pkg == nil {
+	// Extract edges node by node so the analysis deadline can stop
+	// extraction between nodes. Coverage is the fraction of call graph
+	// nodes whose outgoing edges were extracted, scaled by the share of
+	// call sites the call graph resolves.
+	defer timePhase("calls")()
+	sites := c.newCallSiteIndex(pkgs)
+	visited := 0
+	spill, err := newCallSpill()
+	if err != nil {
+		return err
+	}
+	defer spill.Close()
+	c.calls = spill
+	extracting := startProgress("Extracting calls", len(cg.Nodes), "functions")
+	for _, node := range cg.Nodes {
+		if c.interrupted() {
+			extracting.Finish()
 			return nil
 		}
+		if c.deadlineExceeded() {
+			c.Partial = true
+			break
+		}
+		visited++
+		extracting.Add(1)
+		if c.LabelSynthetic {
+			for _, edge := range node.Out {
+				c.addCallEdge(prog, sites, edge)
+			}
+			continue
+		}
+		if syntheticKind(node.Func) != "" {
+			continue // its callees are attributed to its callers below
+		}
+		for _, edge := range node.Out {
+			if syntheticKind(edge.Callee.Func) == "" {
+				c.addCallEdge(prog, sites, edge)
+				continue
+			}
+			for _, target := range syntheticTargets(edge.Callee) {
+				c.addCallEdge(prog, sites, &callgraph.Edge{Caller: edge.Caller, Site: edge.Site, Callee: target})
+			}
+		}
+	}
+	extracting.Finish()
+	c.Coverage = resolved
+	if len(cg.Nodes) > 0 {
+		c.Coverage *= float64(visited) / float64(len(cg.Nodes))
+	}
+	c.calls = nil
+	merged, err := spill.merge(c.intern)
+	if err != nil {
+		return err
+	}
+	c.Calls = append(c.Calls, merged...)
+	c.collectPanics(prog)
+	c.collectErrorFlow(prog, cg, sites)
 
-		callerPkg := caller.Pkg.Pkg.Path()
-		calleePkg := callee.Pkg.Pkg.Path()
+	// Detect what project code does beyond calling functions: the
+	// services it serves and calls, its queries, topics, configuration and
+	// dependency injection wiring.
+	funcs := c.newSyntaxFuncs(prog)
+	c.collectRoutes(funcs, pkgs, sites)
+	clients := c.collectGRPCServices(pkgs)
+	c.collectServiceCalls(funcs, pkgs, sites, clients)
+	c.collectQueries(funcs, pkgs, sites)
+	c.collectTopics(funcs, pkgs, sites)
+	c.collectConfigReads(funcs, pkgs, sites)
+	c.collectWiring(funcs, pkgs, sites)
+	c.collectSyncUses(funcs, pkgs, sites)
+	c.collectFuncValues(prog, sites)
+	return nil
+}
 
-		if !c.isProjectPackage(callerPkg) && !c.isProjectPackage(calleePkg) {
-			return nil
-		}
+// vtaRunning is set while a VTA run goes on, including one abandoned at
+// the analysis deadline, which cannot be stopped.
+var vtaRunning atomic.Bool
 
-		// Build full names matching our FuncNode naming.
-		callerName := buildSSAFuncName(caller)
-		calleeName := buildSSAFuncName(callee)
+// buildCallGraph runs VTA over all functions in prog, and returns the call
+// graph with the fraction of project call sites it resolves, 1 for VTA.
+// When the analysis deadline passes first, it falls back to the static
+// call graph (direct calls only) and marks the result partial and static.
+// VTA cannot be interrupted, so the abandoned run finishes in the
+// background; no other is started until it does, nor once the deadline
+// has passed. When Context is cancelled first, it returns nil.
+func (c *Collector) buildCallGraph(prog *ssa.Program) (*callgraph.Graph, float64) {
+	funcs := ssautil.AllFunctions(prog)
+	if c.Deadline.IsZero() && c.Context == nil {
+		return vta.CallGraph(funcs, nil), 1
+	}
+	fallback := func() (*callgraph.Graph, float64) {
+		c.Partial, c.Static = true, true
+		return static.CallGraph(prog), c.staticCallShare(funcs)
+	}
+	if c.interrupted() {
+		return nil, 0
+	}
+	if c.deadlineExceeded() || !vtaRunning.CompareAndSwap(false, true) {
+		return fallback()
+	}
 
-		site := ""
-		if edge.Site != nil {
-			pos := prog.Fset.Position(edge.Site.Pos())
-			site = fmt.Sprintf("%s:%d", c.relPath(pos.Filename), pos.Line)
-		}
+	var timeout <-chan time.Time
+	if !c.Deadline.IsZero() {
+		timeout = time.After(time.Until(c.Deadline))
+	}
+	var cancel <-chan struct{}
+	if c.Context != nil {
+		cancel = c.Context.Done()
+	}
+	done := make(chan *callgraph.Graph, 1)
+	go func() {
+		done <- vta.CallGraph(funcs, nil)
+		vtaRunning.Store(false)
+	}()
+	select {
+	case cg := <-done:
+		return cg, 1
+	case <-timeout:
+		return fallback()
+	case <-cancel:
+		return nil, 0
+	}
+}
 
-		c.Calls = append(c.Calls, CallEdge{
-			CallerFullName: callerName,
-			CalleeFullName: calleeName,
-			IsDynamic:      edge.Site != nil && edge.Site.Common().IsInvoke(),
-			Site:           site,
-		})
-
-		// Register functions discovered during call graph analysis.
-		if _, ok := c.Funcs[callerName]; !ok && c.isProjectPackage(callerPkg) {
-			c.Funcs[callerName] = &FuncNode{
-				Name:     caller.Name(),
-				FullName: callerName,
-				Package:  callerPkg,
-				Exported: caller.Object() != nil && caller.Object().Exported(),
-			}
+// staticCallShare returns the fraction of the call sites in project
+// functions whose callee is known statically, those the static call graph
+// resolves.
+func (c *Collector) staticCallShare(funcs map[*ssa.Function]bool) float64 {
+	sites, static := 0, 0
+	for fn := range funcs {
+		if fn.Pkg == nil || !c.isProjectPackage(fn.Pkg.Pkg.Path()) {
+			continue
 		}
-		if _, ok := c.Funcs[calleeName]; !ok && c.isProjectPackage(calleePkg) {
-			c.Funcs[calleeName] = &FuncNode{
-				Name:     callee.Name(),
-				FullName: calleeName,
-				Package:  calleePkg,
-				Exported: callee.Object() != nil && callee.Object().Exported(),
+		for _, b := range fn.Blocks {
+			for _, instr := range b.Instrs {
+				if call, ok := instr.(ssa.CallInstruction); ok {
+					sites++
+					if call.Common().StaticCallee() != nil {
+						static++
+					}
+				}
 			}
 		}
+	}
+	if sites == 0 {
+		return 1
+	}
+	return float64(static) / float64(sites)
+}
 
-		return nil
-	})
+// interrupted reports whether Context, if any, was cancelled.
+func (c *Collector) interrupted() bool {
+	return c.Context != nil && c.Context.Err() != nil
 }
 
-// CollectImplementsFromPackages checks which structs implement which interfaces.
+// deadlineExceeded reports whether the analysis deadline, if any, has passed.
+func (c *Collector) deadlineExceeded() bool {
+	return !c.Deadline.IsZero() && time.Now().After(c.Deadline)
+}
+
+// addCallEdge records edge if it touches a project function, registering
+// any project functions first discovered through the call graph.
+func (c *Collector) addCallEdge(prog *ssa.Program, sites *callSiteIndex, edge *callgraph.Edge) {
+	caller := edge.Caller.Func
+	callee := edge.Callee.Func
+
+	callerPkg := c.intern(c.ssaFuncPkg(caller))
+	calleePkg := c.intern(c.ssaFuncPkg(callee))
+	if callerPkg == "" || calleePkg == "" {
+		return
+	}
+
+	if !c.isProjectPackage(callerPkg) && !c.isProjectPackage(calleePkg) {
+		return
+	}
+
+	// Build full names matching our FuncNode naming.
+	callerName := c.ssaFuncName(caller)
+	calleeName := c.ssaFuncName(callee)
+
+	_, isGo := edge.Site.(*ssa.Go) // panics do not cross goroutines
+	var site, detached []CallSite
+	if edge.Site != nil && edge.Site.Pos().IsValid() {
+		site = []CallSite{sites.site(c, prog.Fset, edge.Site.Pos())}
+		if c.isProjectPackage(callerPkg) && detachesContext(caller, callee, edge.Site) {
+			detached = site
+		}
+	}
+
+	call := CallEdge{
+		CallerFullName: callerName,
+		CalleeFullName: calleeName,
+		IsDynamic:      edge.Site != nil && edge.Site.Common().IsInvoke(),
+		Sites:          site,
+		Count:          1,
+		External:       !c.isProjectPackage(calleePkg),
+		MayPanic:       c.escapes[callee] && !isGo,
+
+		DetachedContext: detached,
+	}
+	c.calls.add(call)
+
+	// Register functions discovered during call graph analysis;
+	// dependency functions on either end become external stubs.
+	for _, end := range []struct {
+		fn        *ssa.Function
+		pkg, name string
+	}{{caller, callerPkg, callerName}, {callee, calleePkg, calleeName}} {
+		if c.isProjectPackage(end.pkg) {
+			c.addDiscoveredFunc(end.fn, end.pkg, end.name)
+		} else {
+			c.addExternalFunc(end.fn, end.pkg, end.name)
+		}
+	}
+	if c.Stream != nil {
+		c.Stream.Edge(callGraphEdge(call))
+	}
+}
+
+// addDiscoveredFunc registers a project function first seen in the call
+// graph, such as a synthetic wrapper or a function of an unloaded file.
+func (c *Collector) addDiscoveredFunc(fn *ssa.Function, pkgPath, name string) {
+	if _, ok := c.Funcs[name]; ok {
+		return
+	}
+	var pkg *types.Package // qualifies the signature's types
+	if fn.Pkg != nil {
+		pkg = fn.Pkg.Pkg
+	} else if obj := fn.Object(); obj != nil {
+		pkg = obj.Pkg()
+	}
+	node := &FuncNode{
+		Name:      fn.Name(),
+		FullName:  name,
+		Package:   pkgPath,
+		Exported:  fn.Object() != nil && fn.Object().Exported(),
+		Signature: signatureString(fn.Signature, pkg),
+		Synthetic: syntheticKind(fn),
+
+		APISignature: apiSignatureString(fn.Signature, pkg),
+		TakesContext: takesContext(fn.Signature),
+	}
+	if node.Synthetic == "" && c.isHandler(fn.Signature) {
+		node.EntryPoint = entryPointHandler // e.g. a handler closure
+	}
+	// init functions are not in package scope, so CollectTypes misses them.
+	if isInitFunc(fn.Name()) && fn.Syntax() != nil {
+		start := fn.Prog.Fset.Position(fn.Syntax().Pos())
+		node.File, node.Line = c.intern(c.relPath(start.Filename)), start.Line
+		node.EndLine = fn.Prog.Fset.Position(fn.Syntax().End()).Line
+		node.LOC = node.EndLine - start.Line + 1
+	}
+	c.Funcs[name] = node
+	c.streamFunc(node)
+}
+
+// addExternalFunc registers a stub for a dependency function, attributed to
+// the module that provides its package.
+func (c *Collector) addExternalFunc(fn *ssa.Function, pkgPath, name string) {
+	if _, ok := c.ExternalFuncs[name]; ok {
+		return
+	}
+	ext := &ExternalFuncNode{
+		Name:     fn.Name(),
+		FullName: name,
+		Package:  pkgPath,
+		Module:   "std",
+
+		Deprecated:   c.deprecated[name],
+		TakesContext: takesContext(fn.Signature),
+	}
+	if mod := c.modules[pkgPath]; mod != nil {
+		ext.Module, ext.Version = mod.Path, mod.Version
+		if mod.Replace != nil && mod.Replace.Version != "" {
+			ext.Version = mod.Replace.Version
+		}
+	}
+	c.ExternalFuncs[name] = ext
+	if c.Stream != nil {
+		c.Stream.Node(externalFuncGraphNode(ext))
+	}
+}
+
+// CollectImplementsFromPackages checks which structs and named non-struct
+// types implement which interfaces.
 func (c *Collector) CollectImplementsFromPackages(pkgs []*packages.Package) {
 	var ifaces []struct {
 		key  string
@@ -241,7 +702,7 @@ func (c *Collector) CollectImplementsFromPackages(pkgs []*packages.Package) {
 		scope := pkg.Types.Scope()
 		for _, name := range scope.Names() {
 			obj := scope.Lookup(name)
-			if tn, ok := obj.(*types.TypeName); ok {
+			if tn, ok := obj.(*types.TypeName); ok && !tn.IsAlias() {
 				switch t := tn.Type().Underlying().(type) {
 				case *types.Interface:
 					if t.NumMethods() > 0 { // skip empty interfaces
@@ -259,6 +720,15 @@ func (c *Collector) CollectImplementsFromPackages(pkgs []*packages.Package) {
 						name string
 						pkg  string
 					}{pkg.PkgPath + "." + name, tn.Type(), name, pkg.PkgPath})
+				default:
+					// Named non-struct types (type IDs []ID, type ID string)
+					// can implement interfaces too.
+					concretes = append(concretes, struct {
+						key  string
+						typ  types.Type
+						name string
+						pkg  string
+					}{pkg.PkgPath + "." + name, tn.Type(), name, pkg.PkgPath})
 				}
 			}
 		}
@@ -272,45 +742,224 @@ func (c *Collector) CollectImplementsFromPackages(pkgs []*packages.Package) {
 			if seen[edgeKey] {
 				continue
 			}
-			// Check T implements I
-			if types.Implements(concrete.typ, iface.typ) {
-				c.Implements = append(c.Implements, ImplementsEdge{
-					Struct:    concrete.key,
-					Interface: iface.key,
-				})
-				seen[edgeKey] = true
-				continue
+			// Check T implements I, then *T implements I.
+			recvKind := "value"
+			satisfier := concrete.typ
+			if !types.Implements(satisfier, iface.typ) {
+				recvKind = "pointer"
+				satisfier = types.NewPointer(concrete.typ)
+				if !types.Implements(satisfier, iface.typ) {
+					continue
+				}
 			}
-			// Check *T implements I
-			ptr := types.NewPointer(concrete.typ)
-			if types.Implements(ptr, iface.typ) {
-				c.Implements = append(c.Implements, ImplementsEdge{
-					Struct:    concrete.key,
-					Interface: iface.key,
-				})
-				seen[edgeKey] = true
+			edge := ImplementsEdge{
+				Struct:    concrete.key,
+				Interface: iface.key,
+				Receiver:  recvKind,
 			}
+			for i := 0; i < iface.typ.NumMethods(); i++ {
+				name := iface.typ.Method(i).Name()
+				edge.Methods = append(edge.Methods, name)
+				obj, _, _ := types.LookupFieldOrMethod(satisfier, false, iface.typ.Method(i).Pkg(), name)
+				if m, ok := obj.(*types.Func); ok && m.Pkg() != nil {
+					edge.MethodFuncs = append(edge.MethodFuncs, c.funcFullName(m.Pkg().Path(), m))
+				} else {
+					edge.MethodFuncs = append(edge.MethodFuncs, "")
+				}
+			}
+			c.Implements = append(c.Implements, edge)
+			if label := c.typeLabel(edge.Struct); c.Stream != nil && label != "" {
+				c.Stream.Edge(implementsGraphEdge(edge, label))
+			}
+			seen[edgeKey] = true
+		}
+	}
+}
+
+// typeKind names the kind of an underlying type: "slice", "map", "func",
+// "string", "int", ...
+func typeKind(t types.Type) string {
+	switch t := t.(type) {
+	case *types.Basic:
+		return t.Name()
+	case *types.Slice:
+		return "slice"
+	case *types.Array:
+		return "array"
+	case *types.Map:
+		return "map"
+	case *types.Chan:
+		return "chan"
+	case *types.Signature:
+		return "func"
+	case *types.Pointer:
+		return "pointer"
+	case *types.TypeParam:
+		return "typeparam"
+	}
+	return "other"
+}
+
+// methodSet renders the methods of iface, embedded ones included, as
+// "Name(param types) results", in the order of their names.
+func methodSet(iface *types.Interface, pkg *types.Package) []string {
+	var methods []string
+	for i := 0; i < iface.NumMethods(); i++ {
+		m := iface.Method(i)
+		sig := apiSignatureString(m.Type().(*types.Signature), pkg)
+		methods = append(methods, m.Name()+strings.TrimPrefix(sig, "func"))
+	}
+	slices.Sort(methods)
+	return methods
+}
+
+// signatureString renders sig as "func(ctx context.Context, id string) (*Order, error)":
+// types from pkg are unqualified, others are qualified by package name.
+func signatureString(sig *types.Signature, pkg *types.Package) string {
+	return types.TypeString(sig, nameQualifier(pkg))
+}
+
+// apiSignatureString renders sig as signatureString does, without the
+// names of its parameters and results, as "func(context.Context, string)
+// (*Order, error)", so that renaming a parameter does not change it.
+func apiSignatureString(sig *types.Signature, pkg *types.Package) string {
+	typeParams := ""
+	if tps := sig.TypeParams(); tps.Len() > 0 {
+		var list []string
+		for i := 0; i < tps.Len(); i++ {
+			tp := tps.At(i)
+			list = append(list, tp.Obj().Name()+" "+types.TypeString(tp.Constraint(), nameQualifier(pkg)))
+		}
+		typeParams = "[" + strings.Join(list, ", ") + "]"
+	}
+	sig = unnamedParams(sig).(*types.Signature)
+	return "func" + typeParams + strings.TrimPrefix(types.TypeString(sig, nameQualifier(pkg)), "func")
+}
+
+// unnamedParams returns t with the parameters and results of the function
+// types it is made of unnamed, and without their receiver and type
+// parameters.
+func unnamedParams(t types.Type) types.Type {
+	switch t := t.(type) {
+	case *types.Signature:
+		unnamed := func(tuple *types.Tuple) *types.Tuple {
+			vars := make([]*types.Var, tuple.Len())
+			for i := range vars {
+				vars[i] = types.NewParam(token.NoPos, nil, "", unnamedParams(tuple.At(i).Type()))
+			}
+			return types.NewTuple(vars...)
+		}
+		return types.NewSignatureType(nil, nil, nil, unnamed(t.Params()), unnamed(t.Results()), t.Variadic())
+	case *types.Pointer:
+		return types.NewPointer(unnamedParams(t.Elem()))
+	case *types.Slice:
+		return types.NewSlice(unnamedParams(t.Elem()))
+	case *types.Array:
+		return types.NewArray(unnamedParams(t.Elem()), t.Len())
+	case *types.Map:
+		return types.NewMap(unnamedParams(t.Key()), unnamedParams(t.Elem()))
+	case *types.Chan:
+		return types.NewChan(t.Dir(), unnamedParams(t.Elem()))
+	}
+	return t
+}
+
+// exportedFields renders the exported fields of s as "Name Type", and
+// embedded fields of an exported type as the type, in the order of their
+// names.
+func exportedFields(s *types.Struct, pkg *types.Package) []string {
+	var fields []string
+	for i := 0; i < s.NumFields(); i++ {
+		f := s.Field(i)
+		if !f.Exported() {
+			continue
+		}
+		typ := types.TypeString(unnamedParams(f.Type()), nameQualifier(pkg))
+		if f.Embedded() {
+			fields = append(fields, typ)
+		} else {
+			fields = append(fields, f.Name()+" "+typ)
+		}
+	}
+	slices.SortFunc(fields, func(a, b string) int { return strings.Compare(apiMemberName(a), apiMemberName(b)) })
+	return fields
+}
+
+// nameQualifier qualifies types by package name, leaving types from pkg
+// unqualified.
+func nameQualifier(pkg *types.Package) types.Qualifier {
+	return func(other *types.Package) string {
+		if other == pkg {
+			return ""
 		}
+		return other.Name()
+	}
+}
+
+// ssaFuncName returns the full name of an SSA function, computed once per
+// function.
+func (c *Collector) ssaFuncName(fn *ssa.Function) string {
+	if name, ok := c.names[fn]; ok {
+		return name
+	}
+	name := c.intern(c.buildSSAFuncName(fn))
+	c.names[fn] = name
+	return name
+}
+
+// intern returns the collector's copy of s, so that a name, package path
+// or file path repeated across nodes and edges is kept in memory once.
+func (c *Collector) intern(s string) string {
+	if interned, ok := c.interned[s]; ok {
+		return interned
 	}
+	c.interned[s] = s
+	return s
 }
 
 // buildSSAFuncName derives a full name for an SSA function that matches
 // the naming convention used by FuncNode.FullName.
-func buildSSAFuncName(fn *ssa.Function) string {
+func (c *Collector) buildSSAFuncName(fn *ssa.Function) string {
+	if kind := syntheticKind(fn); kind != "" {
+		_, name := c.syntheticName(fn, kind)
+		return name
+	}
 	if fn.Pkg == nil {
 		return fn.String()
 	}
 	pkgPath := fn.Pkg.Pkg.Path()
 
+	// Anonymous function: name it after its enclosing function so closures
+	// inside methods keep the receiver (pkg.Type.Method$1).
+	if parent := fn.Parent(); parent != nil {
+		return c.ssaFuncName(parent) + strings.TrimPrefix(fn.Name(), parent.Name())
+	}
+
 	// Method: (*Type).Method or Type.Method
 	if recv := fn.Signature.Recv(); recv != nil {
-		recvType := recv.Type()
-		if ptr, ok := recvType.(*types.Pointer); ok {
-			recvType = ptr.Elem()
-		}
-		if named, ok := recvType.(*types.Named); ok {
-			return pkgPath + "." + named.Obj().Name() + "." + fn.Name()
+		if named, ptr := receiverNamed(recv.Type()); named != nil {
+			return c.methodFullName(pkgPath, named.Obj().Name(), ptr, fn.Name())
 		}
 	}
 	return pkgPath + "." + fn.Name()
 }
+
+// methodFullName builds the FuncNode.FullName of a method: pkg.T.Method,
+// or pkg.(*T).Method for pointer receivers with PointerReceivers.
+func (c *Collector) methodFullName(pkgPath, recv string, ptr bool, name string) string {
+	if ptr && c.PointerReceivers {
+		return pkgPath + ".(*" + recv + ")." + name
+	}
+	return pkgPath + "." + recv + "." + name
+}
+
+// receiverNamed returns the named type of a method receiver and whether
+// the receiver is a pointer to it, or nil if the receiver is not named.
+func receiverNamed(t types.Type) (*types.Named, bool) {
+	ptr, isPtr := t.(*types.Pointer)
+	if isPtr {
+		t = ptr.Elem()
+	}
+	named, _ := t.(*types.Named)
+	return named, isPtr
+}
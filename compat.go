@@ -0,0 +1,316 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ServerVersion is the version of a Neo4j server. Calendar versions such
+// as 2025.01 follow 5.x and compare as later.
+type ServerVersion struct {
+	Major, Minor int
+}
+
+// parseServerVersion parses a version such as 4.4.26, 5.13.0 or
+// 2025.01.0-aura.
+func parseServerVersion(s string) (ServerVersion, error) {
+	parts := strings.SplitN(s, ".", 3)
+	if len(parts) < 2 {
+		return ServerVersion{}, fmt.Errorf("invalid Neo4j version %q", s)
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return ServerVersion{}, fmt.Errorf("invalid Neo4j version %q", s)
+	}
+	minor, err := strconv.Atoi(strings.TrimRight(parts[1], "-abcdefghijklmnopqrstuvwxyz"))
+	if err != nil {
+		return ServerVersion{}, fmt.Errorf("invalid Neo4j version %q", s)
+	}
+	return ServerVersion{Major: major, Minor: minor}, nil
+}
+
+// AtLeast reports whether v is major.minor or later.
+func (v ServerVersion) AtLeast(major, minor int) bool {
+	return v.Major > major || v.Major == major && v.Minor >= minor
+}
+
+func (v ServerVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+// elementID returns the Cypher expression of the element id of variable,
+// a node or relationship, as a string on the server of version v:
+// elementId() from Neo4j 5, the string of id() on 4.4, which has no
+// elementId().
+func elementID(v ServerVersion, variable string) string {
+	if !v.AtLeast(5, 0) {
+		return "toString(id(" + variable + "))"
+	}
+	return "elementId(" + variable + ")"
+}
+
+// elementIDCall matches elementId() of a variable.
+var elementIDCall = regexp.MustCompile(`elementId\((\w+)\)`)
+
+// countSubquery matches the opening of a COUNT subquery.
+var countSubquery = regexp.MustCompile(`COUNT \{\s*`)
+
+// nodeListNode matches a node pattern with its variable, labels and
+// property map as submatches.
+var nodeListNode = regexp.MustCompile(`\((\w*)(?::([\w|]+))?\s*(\{[^{}]*\})?\)`)
+
+// matchClause matches the start of a MATCH clause.
+var matchClause = regexp.MustCompile(`\b(OPTIONAL\s+)?MATCH\s+`)
+
+// clauseKeyword matches a keyword starting the clause after a pattern.
+var clauseKeyword = regexp.MustCompile(`^(WHERE|MATCH|OPTIONAL|WITH|RETURN|CALL|UNWIND|SET|MERGE|CREATE|DELETE|DETACH|REMOVE|FOREACH|ORDER|SKIP|LIMIT|UNION|USING)\b`)
+
+// pathVariable matches the variable a pattern is assigned to, as p in
+// p = (a)-->(b).
+var pathVariable = regexp.MustCompile(`^(\w+)\s*=\s*`)
+
+// relVariable matches the variable of a relationship pattern.
+var relVariable = regexp.MustCompile(`\[(\w+)`)
+
+// propertyVariables matches the variables a property map reads from, such
+// as row in {id: row.id}, but not parameters.
+var propertyVariables = regexp.MustCompile(`(^|[^$\w])([A-Za-z_]\w*)\.`)
+
+// cypher4 rewrites a statement written for Neo4j 5 into the Cypher of 4.4:
+// elementId() becomes the string of id(), COUNT subqueries become size()
+// of a pattern, and patterns with a label disjunction such as
+// (s:GoStruct|GoNamedType {id: row.id}) become a UNION subquery matching
+// each label, which keeps using the label's index. In an OPTIONAL MATCH,
+// where a subquery would drop the rows without a match, the disjunction
+// becomes a WHERE predicate instead.
+func cypher4(cypher string) string {
+	cypher = elementIDCall.ReplaceAllString(cypher, "toString(id($1))")
+	cypher = rewriteCountSubqueries(cypher)
+	var b strings.Builder
+	last := 0
+	for _, m := range matchClause.FindAllStringSubmatchIndex(cypher, -1) {
+		start, from := m[0], m[1]
+		if start < last {
+			continue
+		}
+		end := clauseEnd(cypher, from)
+		patterns := strings.TrimSpace(cypher[from:end])
+		where := strings.HasPrefix(cypher[end:], "WHERE ")
+		var clause string
+		var ok bool
+		if m[2] >= 0 {
+			clause, end, ok = optionalLabelDisjunctions(cypher, from, end, where)
+		} else {
+			clause, ok = splitLabelDisjunctions(patterns, cypher[:start])
+			if ok && where {
+				clause += " WITH *" // the WHERE now follows a subquery
+			}
+			clause += " "
+		}
+		if !ok {
+			continue
+		}
+		b.WriteString(cypher[last:start])
+		b.WriteString(clause)
+		last = end
+	}
+	b.WriteString(cypher[last:])
+	return b.String()
+}
+
+// rewriteCountSubqueries replaces the COUNT subqueries over a single
+// pattern by size() of the pattern. The pattern may hold property maps,
+// such as the project of scopeToProject.
+func rewriteCountSubqueries(cypher string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range countSubquery.FindAllStringIndex(cypher, -1) {
+		if m[0] < last {
+			continue
+		}
+		end := closingBrace(cypher, m[1])
+		if end < 0 {
+			break
+		}
+		pattern := strings.TrimSpace(cypher[m[1]:end])
+		if !strings.HasPrefix(pattern, "(") || clauseKeyword.MatchString(pattern) || strings.Contains(pattern, " WHERE ") {
+			continue
+		}
+		b.WriteString(cypher[last:m[0]])
+		b.WriteString("size(" + pattern + ")")
+		last = end + 1
+	}
+	b.WriteString(cypher[last:])
+	return b.String()
+}
+
+// closingBrace returns the offset of the brace closing the one before
+// from, or -1.
+func closingBrace(cypher string, from int) int {
+	depth := 1
+	for i := from; i < len(cypher); i++ {
+		switch cypher[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// clauseEnd returns the offset of the clause following the pattern of a
+// MATCH clause starting at from: its keyword, the bracket closing an
+// enclosing subquery or the end of cypher.
+func clauseEnd(cypher string, from int) int {
+	depth := 0
+	for i := from; i < len(cypher); i++ {
+		switch c := cypher[i]; c {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		case '\'', '"', '`':
+			if j := strings.IndexByte(cypher[i+1:], c); j >= 0 {
+				i += j + 1
+			}
+		default:
+			if depth == 0 && (i == 0 || strings.ContainsRune(" \t\n", rune(cypher[i-1]))) && clauseKeyword.MatchString(cypher[i:]) {
+				return i
+			}
+		}
+	}
+	return len(cypher)
+}
+
+// splitPatterns splits the comma-separated patterns of a MATCH clause.
+func splitPatterns(patterns string) []string {
+	var parts []string
+	depth, last := 0, 0
+	for i, c := range patterns {
+		switch c {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(patterns[last:i]))
+				last = i + 1
+			}
+		}
+	}
+	return append(parts, strings.TrimSpace(patterns[last:]))
+}
+
+// disjunctionNodes returns the node patterns of pattern with a variable
+// and a label disjunction, as submatch indexes of nodeListNode.
+func disjunctionNodes(pattern string) [][]int {
+	var nodes [][]int
+	for _, n := range nodeListNode.FindAllStringSubmatchIndex(pattern, -1) {
+		if n[2] < n[3] && n[4] >= 0 && strings.Contains(pattern[n[4]:n[5]], "|") {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// splitLabelDisjunctions returns the patterns of a MATCH clause following
+// before as clauses of Neo4j 4.4, a UNION subquery per pattern with a
+// label disjunction matching each combination of labels, or false if
+// there is none. The subqueries import the variables bound before.
+func splitLabelDisjunctions(patterns, before string) (string, bool) {
+	found := false
+	var clauses []string
+	for _, pattern := range splitPatterns(patterns) {
+		nodes := disjunctionNodes(pattern)
+		if len(nodes) == 0 {
+			clauses = append(clauses, "MATCH "+pattern)
+			continue
+		}
+		found = true
+		var imports, returns []string
+		add := func(v string) {
+			if v == "" || slices.Contains(imports, v) || slices.Contains(returns, v) {
+				return
+			}
+			if regexp.MustCompile(`\b` + v + `\b`).MatchString(before) {
+				imports = append(imports, v)
+			} else {
+				returns = append(returns, v)
+			}
+		}
+		if m := pathVariable.FindStringSubmatch(pattern); m != nil {
+			add(m[1])
+		}
+		for _, n := range nodeListNode.FindAllStringSubmatch(pattern, -1) {
+			add(n[1])
+		}
+		for _, r := range relVariable.FindAllStringSubmatch(pattern, -1) {
+			add(r[1])
+		}
+		for _, v := range propertyVariables.FindAllStringSubmatch(pattern, -1) {
+			if !slices.Contains(imports, v[2]) {
+				imports = append(imports, v[2])
+			}
+		}
+		with := ""
+		if len(imports) > 0 {
+			with = "WITH " + strings.Join(imports, ", ") + " "
+		}
+		variants := []string{pattern}
+		for i := len(nodes) - 1; i >= 0; i-- { // from the end, keeping the offsets of the others
+			n := nodes[i]
+			var next []string
+			for _, v := range variants {
+				for _, label := range strings.Split(pattern[n[4]:n[5]], "|") {
+					next = append(next, v[:n[4]]+label+v[n[5]:])
+				}
+			}
+			variants = next
+		}
+		parts := make([]string, len(variants))
+		for i, v := range variants {
+			parts[i] = fmt.Sprintf("%sMATCH %s RETURN %s", with, v, strings.Join(returns, ", "))
+		}
+		clauses = append(clauses, "CALL { "+strings.Join(parts, " UNION ")+" }")
+	}
+	return strings.Join(clauses, " "), found
+}
+
+// optionalLabelDisjunctions returns the OPTIONAL MATCH clause of cypher
+// whose patterns span from:end with its label disjunctions moved to its
+// WHERE, and the end of what it replaces, or false if there is none.
+func optionalLabelDisjunctions(cypher string, from, end int, where bool) (string, int, bool) {
+	patterns := cypher[from:end]
+	nodes := disjunctionNodes(patterns)
+	if len(nodes) == 0 {
+		return "", 0, false
+	}
+	var preds []string
+	for i := len(nodes) - 1; i >= 0; i-- {
+		n := nodes[i]
+		variable := patterns[n[2]:n[3]]
+		var labels []string
+		for _, label := range strings.Split(patterns[n[4]:n[5]], "|") {
+			labels = append(labels, variable+":"+label)
+		}
+		preds = append([]string{"(" + strings.Join(labels, " OR ") + ")"}, preds...)
+		patterns = patterns[:n[4]-1] + patterns[n[5]:]
+	}
+	clause := "OPTIONAL MATCH " + strings.TrimSpace(patterns) + " WHERE " + strings.Join(preds, " AND ")
+	if !where {
+		return clause + " ", end, true
+	}
+	condFrom := end + len("WHERE ")
+	condEnd := clauseEnd(cypher, condFrom)
+	return clause + " AND (" + strings.TrimSpace(cypher[condFrom:condEnd]) + ") ", condEnd, true
+}
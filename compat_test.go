@@ -0,0 +1,136 @@
+package main
+
+import "testing"
+
+func TestCypher4(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{
+			name: "elementId",
+			in:   "MATCH (n) WHERE elementId(n) = $id RETURN n",
+			want: "MATCH (n) WHERE toString(id(n)) = $id RETURN n",
+		},
+		{
+			name: "count subquery",
+			in:   "MATCH (f:GoFunc) SET f.in_degree = COUNT { (f)<-[:ACCURATE_CALLS]-() }",
+			want: "MATCH (f:GoFunc) SET f.in_degree = size((f)<-[:ACCURATE_CALLS]-())",
+		},
+		{
+			name: "count subquery scoped to a project",
+			in:   "MATCH (f:GoFunc {project: $project}) SET f.out_degree = COUNT { (f)-[:ACCURATE_CALLS {project: $project}]->() }",
+			want: "MATCH (f:GoFunc {project: $project}) SET f.out_degree = size((f)-[:ACCURATE_CALLS {project: $project}]->())",
+		},
+		{
+			name: "count subquery with a MATCH is kept",
+			in:   "RETURN COUNT { MATCH (n)--() WHERE n.x }",
+			want: "RETURN COUNT { MATCH (n)--() WHERE n.x }",
+		},
+		{
+			name: "node list",
+			in:   "UNWIND $batch AS row MATCH (s:GoStruct|GoNamedType {id: row.sid}), (f:GoFunc {id: row.id}) MERGE (s)-[:HAS]->(f)",
+			want: "UNWIND $batch AS row CALL { WITH row MATCH (s:GoStruct {id: row.sid}) RETURN s UNION WITH row MATCH (s:GoNamedType {id: row.sid}) RETURN s } MATCH (f:GoFunc {id: row.id}) MERGE (s)-[:HAS]->(f)",
+		},
+		{
+			name: "node followed by WHERE",
+			in:   "MATCH (n:GoStruct|GoAlias) WHERE n.package IN $paths DETACH DELETE n",
+			want: "CALL { MATCH (n:GoStruct) RETURN n UNION MATCH (n:GoAlias) RETURN n } WITH * WHERE n.package IN $paths DETACH DELETE n",
+		},
+		{
+			name: "chain",
+			in:   "MATCH (t:GoStruct|GoNamedType)-[:IMPLEMENTS]->(i:GoInterface) RETURN t.id, i.id",
+			want: "CALL { MATCH (t:GoStruct)-[:IMPLEMENTS]->(i:GoInterface) RETURN t, i UNION MATCH (t:GoNamedType)-[:IMPLEMENTS]->(i:GoInterface) RETURN t, i } RETURN t.id, i.id",
+		},
+		{
+			name: "chain from a bound variable",
+			in:   "MATCH (f:GoFunc {id: $id}) MATCH (f)-[r:USES]->(t:A|B) RETURN r, t",
+			want: "MATCH (f:GoFunc {id: $id}) CALL { WITH f MATCH (f)-[r:USES]->(t:A) RETURN t, r UNION WITH f MATCH (f)-[r:USES]->(t:B) RETURN t, r } RETURN r, t",
+		},
+		{
+			name: "chain of two disjunctions",
+			in:   "MATCH (a:A|B)-->(c:C|D) RETURN a, c",
+			want: "CALL { MATCH (a:A)-->(c:C) RETURN a, c UNION MATCH (a:B)-->(c:C) RETURN a, c UNION MATCH (a:A)-->(c:D) RETURN a, c UNION MATCH (a:B)-->(c:D) RETURN a, c } RETURN a, c",
+		},
+		{
+			name: "optional match",
+			in:   "MATCH (f:GoFunc) OPTIONAL MATCH (f)-[:USES]->(t:A|B) RETURN f, t",
+			want: "MATCH (f:GoFunc) OPTIONAL MATCH (f)-[:USES]->(t) WHERE (t:A OR t:B) RETURN f, t",
+		},
+		{
+			name: "optional match with WHERE",
+			in:   "MATCH (f:GoFunc) OPTIONAL MATCH (f)-[:USES]->(t:A|B) WHERE t.x OR t.y RETURN f, t",
+			want: "MATCH (f:GoFunc) OPTIONAL MATCH (f)-[:USES]->(t) WHERE (t:A OR t:B) AND (t.x OR t.y) RETURN f, t",
+		},
+		{
+			name: "relationship type disjunction is kept",
+			in:   "MATCH (f:GoFunc)-[r:ACCURATE_CALLS|CALLS_EXTERNAL]->(g:GoFunc) RETURN g",
+			want: "MATCH (f:GoFunc)-[r:ACCURATE_CALLS|CALLS_EXTERNAL]->(g:GoFunc) RETURN g",
+		},
+		{
+			name: "fulltext index",
+			in:   "CREATE FULLTEXT INDEX go_type_text IF NOT EXISTS FOR (n:GoStruct|GoInterface) ON EACH [n.name]",
+			want: "CREATE FULLTEXT INDEX go_type_text IF NOT EXISTS FOR (n:GoStruct|GoInterface) ON EACH [n.name]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cypher4(tt.in); got != tt.want {
+				t.Errorf("cypher4(%q)\n got %q\nwant %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseServerVersion(t *testing.T) {
+	tests := []struct {
+		in   string
+		want ServerVersion
+	}{
+		{"4.4.26", ServerVersion{4, 4}},
+		{"5.13.0", ServerVersion{5, 13}},
+		{"2025.01.0-aura", ServerVersion{2025, 1}},
+	}
+	for _, tt := range tests {
+		got, err := parseServerVersion(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("parseServerVersion(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := parseServerVersion("five"); err == nil {
+		t.Error("parseServerVersion(\"five\") succeeded")
+	}
+}
+
+func TestElementID(t *testing.T) {
+	if got := elementID(ServerVersion{5, 13}, "n"); got != "elementId(n)" {
+		t.Errorf("elementID(5.13) = %q", got)
+	}
+	if got := elementID(ServerVersion{4, 4}, "n"); got != "toString(id(n))" {
+		t.Errorf("elementID(4.4) = %q", got)
+	}
+}
+
+// The reader queries of report api, scoped to a project, as run on 4.4.
+func TestCypher4ScopedLabelDisjunctions(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{
+			in:   "MATCH (t:GoStruct|GoInterface) WHERE t.deleted IS NULL RETURN t.key AS key",
+			want: "CALL { MATCH (t:GoStruct {project: $project}) RETURN t UNION MATCH (t:GoInterface {project: $project}) RETURN t } WITH * WHERE t.deleted IS NULL RETURN t.key AS key",
+		},
+		{
+			in:   "MATCH (t:GoStruct|GoNamedType)-[:IMPLEMENTS]->(i:GoInterface) WHERE i.deleted IS NULL RETURN t.key AS type, i.key AS iface",
+			want: "CALL { MATCH (t:GoStruct {project: $project})-[:IMPLEMENTS {project: $project}]->(i:GoInterface {project: $project}) RETURN t, i UNION MATCH (t:GoNamedType {project: $project})-[:IMPLEMENTS {project: $project}]->(i:GoInterface {project: $project}) RETURN t, i } WITH * WHERE i.deleted IS NULL RETURN t.key AS type, i.key AS iface",
+		},
+		{
+			in:   "UNWIND $batch AS row MATCH (t:GoStruct|GoNamedType {id: row.id}) SET t.api_usage = row.usage",
+			want: "UNWIND $batch AS row CALL { WITH row MATCH (t:GoStruct {project: $project, id: row.id}) RETURN t UNION WITH row MATCH (t:GoNamedType {project: $project, id: row.id}) RETURN t } SET t.api_usage = row.usage",
+		},
+	}
+	for _, tt := range tests {
+		if got := cypher4(scopeToProject(tt.in, "$project")); got != tt.want {
+			t.Errorf("cypher4(scopeToProject(%q))\n got %q\nwant %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// defaultConfigFile is the config file name written by `init`.
+const defaultConfigFile = "go-callgraph-neo4j.conf"
+
+// applyConfigFile sets flags in fs from a config file of "name = value"
+// lines, where name is a flag name without dashes and '#' starts a comment.
+// Repeatable flags may appear on several lines. Flags given on the command
+// line take precedence over the file.
+func applyConfigFile(fs *flag.FlagSet, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot open config: %w", err)
+	}
+	defer f.Close()
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(fl *flag.Flag) { explicit[fl.Name] = true })
+
+	sc := bufio.NewScanner(f)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("%s:%d: want name = value", path, lineNo)
+		}
+		name = strings.TrimLeft(strings.TrimSpace(name), "-")
+		value = strings.TrimSpace(value)
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("%s:%d: unknown flag %q", path, lineNo, name)
+		}
+		if explicit[name] {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+	}
+	return sc.Err()
+}
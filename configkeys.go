@@ -0,0 +1,176 @@
+package main
+
+import (
+	"go/ast"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// Kinds of configuration a ConfigRead reads.
+const (
+	configEnv = "env"    // environment variable
+	configKey = "config" // key of a configuration library
+)
+
+// envTags are the struct tags naming the environment variable a field is
+// loaded from: caarlos0/env and cleanenv use env, kelseyhightower/envconfig
+// uses envconfig (without the prefix passed to envconfig.Process).
+var envTags = []string{"env", "envconfig"}
+
+// configSource returns the library a call of fn reads configuration
+// through, its kind, and the indexes of its key arguments, or "" if fn
+// reads none.
+func configSource(fn *types.Func) (source, kind string, args []int) {
+	if fn.Pkg() == nil {
+		return "", "", nil
+	}
+	sig := fn.Type().(*types.Signature)
+	switch path, name := fn.Pkg().Path(), fn.Name(); {
+	case path == "os" && (name == "Getenv" || name == "LookupEnv"),
+		path == "syscall" && name == "Getenv":
+		return "os", configEnv, []int{0}
+	case strings.HasPrefix(path, "github.com/spf13/viper"):
+		if strings.HasPrefix(name, "Get") || name == "IsSet" || name == "Sub" || name == "UnmarshalKey" || name == "InConfig" {
+			return "viper", configKey, stringParams(sig, "key")
+		}
+	case strings.HasPrefix(path, "github.com/knadh/koanf"):
+		if !strings.HasPrefix(name, "Set") && name != "Delete" && name != "Cut" {
+			return "koanf", configKey, stringParams(sig, "path")
+		}
+	}
+	return "", "", nil
+}
+
+// stringParams returns the index of the string parameter of sig with the
+// given name, if any.
+func stringParams(sig *types.Signature, name string) []int {
+	for i := 0; i < sig.Params().Len(); i++ {
+		p := sig.Params().At(i)
+		if b, ok := p.Type().(*types.Basic); ok && b.Kind() == types.String && p.Name() == name {
+			return []int{i}
+		}
+	}
+	return nil
+}
+
+// collectConfigReads records the constant environment variable names and
+// configuration keys read in the project packages among pkgs, and the
+// struct fields tagged with environment variable names.
+func (c *Collector) collectConfigReads(funcs *syntaxFuncs, pkgs []*packages.Package, sites *callSiteIndex) {
+	index := make(map[string]int) // func|kind|key -> position in c.ConfigReads
+	add := func(r ConfigRead, site CallSite) {
+		key := r.Func + "|" + r.Kind + "|" + r.Key
+		if i, ok := index[key]; ok {
+			c.ConfigReads[i].Sites = append(c.ConfigReads[i].Sites, site)
+			return
+		}
+		r.Sites = []CallSite{site}
+		index[key] = len(c.ConfigReads)
+		c.ConfigReads = append(c.ConfigReads, r)
+	}
+
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if !c.isProjectPackage(pkg.PkgPath) || pkg.TypesInfo == nil {
+			return
+		}
+		info := pkg.TypesInfo
+		for _, file := range pkg.Syntax {
+			var stack []ast.Node
+			ast.Inspect(file, func(n ast.Node) bool {
+				if n == nil {
+					stack = stack[:len(stack)-1]
+					return true
+				}
+				stack = append(stack, n)
+				switch n := n.(type) {
+				case *ast.TypeSpec:
+					c.configTags(pkg, n)
+				case *ast.CallExpr:
+					fn, _ := typeutil.Callee(info, n).(*types.Func)
+					if fn == nil {
+						return true
+					}
+					if fn.Name() == "BindEnv" && fn.Pkg() != nil && strings.HasPrefix(fn.Pkg().Path(), "github.com/spf13/viper") {
+						c.viperBindEnv(info, n, funcs.enclosing(pkg, stack), sites.site(c, pkg.Fset, n.Lparen), add)
+						return true
+					}
+					source, kind, args := configSource(fn)
+					for _, i := range args {
+						if i >= len(n.Args) {
+							continue
+						}
+						key, ok := constString(info, n.Args[i])
+						if !ok || key == "" {
+							continue
+						}
+						if kind == configKey {
+							key = strings.ToLower(key) // viper and koanf keys are case-insensitive
+						}
+						r := ConfigRead{Kind: kind, Key: key, Source: source, Func: funcs.enclosing(pkg, stack)}
+						add(r, sites.site(c, pkg.Fset, n.Lparen))
+					}
+				}
+				return true
+			})
+		}
+	})
+	for i := range c.ConfigReads {
+		sortSites(c.ConfigReads[i].Sites)
+	}
+}
+
+// viperBindEnv records the configuration key bound by a viper
+// BindEnv(key, env...) call and the environment variables it names. The
+// variable derived from the key when none are named depends on the
+// prefix and key replacer set at run time, so it is not recorded.
+func (c *Collector) viperBindEnv(info *types.Info, call *ast.CallExpr, caller string, site CallSite, add func(ConfigRead, CallSite)) {
+	keys := constStrings(info, call.Args)
+	if len(keys) == 0 || len(keys) != len(call.Args) {
+		return
+	}
+	key := strings.ToLower(keys[0])
+	add(ConfigRead{Kind: configKey, Key: key, Source: "viper", Func: caller}, site)
+	for _, env := range keys[1:] {
+		add(ConfigRead{Kind: configEnv, Key: env, Source: "viper", Func: caller}, site)
+	}
+}
+
+// configTags records the fields of the struct declared by spec, nested
+// struct types included, whose tags name environment variables.
+func (c *Collector) configTags(pkg *packages.Package, spec *ast.TypeSpec) {
+	obj := pkg.TypesInfo.Defs[spec.Name]
+	if obj == nil || obj.Parent() != pkg.Types.Scope() {
+		return // local types have no node
+	}
+	if _, ok := spec.Type.(*ast.StructType); !ok {
+		return
+	}
+	structKey := pkg.PkgPath + "." + obj.Name()
+	ast.Inspect(spec.Type, func(n ast.Node) bool {
+		field, ok := n.(*ast.Field)
+		if !ok || field.Tag == nil || len(field.Names) == 0 {
+			return true
+		}
+		tag, err := strconv.Unquote(field.Tag.Value)
+		if err != nil {
+			return true
+		}
+		for _, name := range envTags {
+			value, ok := reflect.StructTag(tag).Lookup(name)
+			key, _, _ := strings.Cut(value, ",") // env:"PORT,required"
+			if !ok || key == "" || key == "-" {
+				continue
+			}
+			c.ConfigReads = append(c.ConfigReads, ConfigRead{
+				Kind: configEnv, Key: key, Source: name,
+				Struct: structKey, Field: field.Names[0].Name,
+			})
+		}
+		return true
+	})
+}
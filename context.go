@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"go/types"
+	"io"
+	"sort"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// isContext reports whether t is context.Context.
+func isContext(t types.Type) bool {
+	named, ok := types.Unalias(t).(*types.Named)
+	return ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == "context" && named.Obj().Name() == "Context"
+}
+
+// takesContext reports whether the first parameter of sig, the receiver
+// aside, is a context.Context.
+func takesContext(sig *types.Signature) bool {
+	return sig.Params().Len() > 0 && isContext(sig.Params().At(0).Type())
+}
+
+// detachesContext reports whether site, a call from caller to callee that
+// both take a context, passes the callee a new context from
+// context.Background or context.TODO instead of deriving it from the
+// caller's, so the callee escapes its cancellation and deadline.
+func detachesContext(caller, callee *ssa.Function, site ssa.CallInstruction) bool {
+	if site == nil || !takesContext(caller.Signature) || !takesContext(callee.Signature) {
+		return false
+	}
+	common := site.Common()
+	i := 0
+	if !common.IsInvoke() && common.Signature().Recv() != nil {
+		i++ // the receiver comes first
+	}
+	if i >= len(common.Args) {
+		return false
+	}
+	call, ok := common.Args[i].(*ssa.Call)
+	if !ok {
+		return false
+	}
+	fn := call.Call.StaticCallee()
+	return fn != nil && fn.Pkg != nil && fn.Pkg.Pkg.Path() == "context" && (fn.Name() == "Background" || fn.Name() == "TODO")
+}
+
+// DetachedContextCalls returns the call edges where a project function
+// taking a context passes context.Background or context.TODO to a function
+// taking one, sorted by caller then callee.
+func (c *Collector) DetachedContextCalls() []CallEdge {
+	var calls []CallEdge
+	for _, e := range c.Calls {
+		if len(e.DetachedContext) > 0 {
+			calls = append(calls, e)
+		}
+	}
+	sort.Slice(calls, func(i, j int) bool {
+		if calls[i].CallerFullName != calls[j].CallerFullName {
+			return calls[i].CallerFullName < calls[j].CallerFullName
+		}
+		return calls[i].CalleeFullName < calls[j].CalleeFullName
+	})
+	return calls
+}
+
+// WriteContextReport prints the calls detaching their callee from the
+// caller's context, grouped by caller.
+func (c *Collector) WriteContextReport(w io.Writer, calls []CallEdge) {
+	fmt.Fprintf(w, "Calls passing a new context from a function given one: %d\n", len(calls))
+	prev := ""
+	for _, e := range calls {
+		if e.CallerFullName != prev {
+			prev = e.CallerFullName
+			fmt.Fprintf(w, "\n%s\n", e.CallerFullName)
+		}
+		fmt.Fprintf(w, "  calls %s at %s\n", e.CalleeFullName, joinSites(e.DetachedContext))
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"golang.org/x/tools/cover"
+)
+
+// CollectCoverage reads a Go coverage profile (go test -coverprofile) and
+// sets CoverStmts and CoveredPct on every function with statements in it.
+// Profile blocks are attributed to the function whose lines enclose them,
+// so closures count toward their enclosing function as with
+// `go tool cover -func`. It returns the number of functions covered by the
+// profile.
+func (c *Collector) CollectCoverage(path string) (int, error) {
+	profiles, err := cover.ParseProfiles(path)
+	if err != nil {
+		return 0, fmt.Errorf("cannot read coverage profile: %w", err)
+	}
+	// Profiles name files import-path style: <package path>/<file name>.
+	byFile := make(map[string][]*FuncNode)
+	for _, fn := range c.Funcs {
+		if fn.File != "" && fn.EndLine > 0 {
+			key := fn.Package + "/" + filepath.Base(fn.File)
+			byFile[key] = append(byFile[key], fn)
+		}
+	}
+
+	covered := make(map[*FuncNode]int)
+	for _, p := range profiles {
+		for _, b := range p.Blocks {
+			for _, fn := range byFile[p.FileName] {
+				if b.StartLine < fn.Line || b.EndLine > fn.EndLine {
+					continue
+				}
+				fn.CoverStmts += b.NumStmt
+				if b.Count > 0 {
+					covered[fn] += b.NumStmt
+				}
+				break
+			}
+		}
+	}
+
+	n := 0
+	for _, fns := range byFile {
+		for _, fn := range fns {
+			if fn.CoverStmts > 0 {
+				fn.CoveredPct = 100 * float64(covered[fn]) / float64(fn.CoverStmts)
+				n++
+			}
+		}
+	}
+	return n, nil
+}
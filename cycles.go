@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+)
+
+// stronglyConnected returns the strongly connected components of the
+// directed graph given by edges (node -> successors) over nodes that form
+// a cycle: those of more than one node, and single nodes with an edge to
+// themselves. Members are sorted, and components ordered by size, largest
+// first, then by first member.
+func stronglyConnected(nodes []string, edges map[string][]string) [][]string {
+	// Tarjan's algorithm.
+	index := make(map[string]int, len(nodes))
+	low := make(map[string]int, len(nodes))
+	onStack := make(map[string]bool)
+	var stack []string
+	var sccs [][]string
+	var visit func(v string)
+	visit = func(v string) {
+		index[v] = len(index)
+		low[v] = index[v]
+		stack = append(stack, v)
+		onStack[v] = true
+		for _, w := range edges[v] {
+			if _, seen := index[w]; !seen {
+				visit(w)
+				low[v] = min(low[v], low[w])
+			} else if onStack[w] {
+				low[v] = min(low[v], index[w])
+			}
+		}
+		if low[v] != index[v] {
+			return
+		}
+		var scc []string
+		for {
+			w := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[w] = false
+			scc = append(scc, w)
+			if w == v {
+				break
+			}
+		}
+		if len(scc) > 1 || slices.Contains(edges[v], v) {
+			sort.Strings(scc)
+			sccs = append(sccs, scc)
+		}
+	}
+	for _, v := range nodes {
+		if _, seen := index[v]; !seen {
+			visit(v)
+		}
+	}
+	sort.Slice(sccs, func(i, j int) bool {
+		if len(sccs[i]) != len(sccs[j]) {
+			return len(sccs[i]) > len(sccs[j])
+		}
+		return sccs[i][0] < sccs[j][0]
+	})
+	return sccs
+}
+
+// MarkRecursion finds the directly and mutually recursive project
+// functions, the cycles of the call graph, marks them Recursive and numbers
+// each group of mutually recursive functions with SCCID, starting at 1. It
+// returns the groups as numbered.
+func (c *Collector) MarkRecursion() [][]string {
+	nodes := make([]string, 0, len(c.Funcs))
+	for name, fn := range c.Funcs {
+		fn.Recursive, fn.SCCID = false, 0
+		nodes = append(nodes, name)
+	}
+	sort.Strings(nodes)
+	edges := make(map[string][]string)
+	for _, e := range c.Calls {
+		if _, ok := c.Funcs[e.CalleeFullName]; ok && !e.External {
+			edges[e.CallerFullName] = append(edges[e.CallerFullName], e.CalleeFullName)
+		}
+	}
+	sccs := stronglyConnected(nodes, edges)
+	for i, scc := range sccs {
+		for _, name := range scc {
+			c.Funcs[name].Recursive = true
+			c.Funcs[name].SCCID = i + 1
+		}
+	}
+	return sccs
+}
+
+// packageCalls returns, for each project package, the number of calls its
+// functions make to those of each other project package.
+func (c *Collector) packageCalls() map[[2]string]int {
+	calls := make(map[[2]string]int)
+	for _, e := range c.Calls {
+		caller, ok1 := c.Funcs[e.CallerFullName]
+		callee, ok2 := c.Funcs[e.CalleeFullName]
+		if ok1 && ok2 && caller.Package != callee.Package {
+			calls[[2]string{caller.Package, callee.Package}] += e.Count
+		}
+	}
+	return calls
+}
+
+// MarkPackageCycles finds the dependency cycles among project packages,
+// the strongly connected components of their imports and calls, and
+// numbers the packages of each with CycleID, starting at 1. It returns the
+// cycles as numbered. The compiler rejects import cycles, so cycles close
+// through calls against the imports: interface methods and function values
+// an imported package calls back into its importer with.
+func (c *Collector) MarkPackageCycles() [][]string {
+	nodes := make([]string, 0, len(c.Packages))
+	edges := make(map[string][]string)
+	for path, p := range c.Packages {
+		p.CycleID = 0
+		nodes = append(nodes, path)
+		for _, imp := range p.Imports {
+			if _, ok := c.Packages[imp]; ok {
+				edges[path] = append(edges[path], imp)
+			}
+		}
+	}
+	for pair := range c.packageCalls() {
+		if _, ok := c.Packages[pair[0]]; ok && !slices.Contains(edges[pair[0]], pair[1]) {
+			edges[pair[0]] = append(edges[pair[0]], pair[1])
+		}
+	}
+	sort.Strings(nodes)
+	sccs := stronglyConnected(nodes, edges)
+	for i, scc := range sccs {
+		for _, path := range scc {
+			c.Packages[path].CycleID = i + 1
+		}
+	}
+	return sccs
+}
+
+// WritePackageCycleReport prints the dependency cycles returned by
+// MarkPackageCycles with the imports and calls between their packages,
+// the edges to cut to break them.
+func (c *Collector) WritePackageCycleReport(w io.Writer, sccs [][]string) {
+	calls := c.packageCalls()
+	fmt.Fprintf(w, "Package dependency cycles: %d\n", len(sccs))
+	for i, scc := range sccs {
+		fmt.Fprintf(w, "\nCycle %d (%d packages):\n", i+1, len(scc))
+		for _, path := range scc {
+			fmt.Fprintf(w, "  %s\n", path)
+			for _, dep := range scc {
+				imports := slices.Contains(c.Packages[path].Imports, dep)
+				switch n := calls[[2]string{path, dep}]; {
+				case imports && n > 0:
+					fmt.Fprintf(w, "    imports %s (%d calls)\n", dep, n)
+				case imports:
+					fmt.Fprintf(w, "    imports %s\n", dep)
+				case n > 0:
+					fmt.Fprintf(w, "    calls back %s (%d calls)\n", dep, n)
+				}
+			}
+		}
+	}
+}
+
+// WriteRecursionReport prints the groups of recursive functions returned
+// by MarkRecursion, mutually recursive ones first.
+func WriteRecursionReport(w io.Writer, sccs [][]string) {
+	direct := 0
+	for _, scc := range sccs {
+		if len(scc) == 1 {
+			direct++
+		}
+	}
+	fmt.Fprintf(w, "Recursion: %d directly recursive functions, %d mutually recursive groups\n", direct, len(sccs)-direct)
+	for i, scc := range sccs {
+		if len(scc) == 1 {
+			if i == len(sccs)-direct {
+				fmt.Fprintln(w, "\nDirectly recursive:")
+			}
+			fmt.Fprintf(w, "  [%d] %s\n", i+1, scc[0])
+			continue
+		}
+		fmt.Fprintf(w, "\nGroup %d (%d functions):\n", i+1, len(scc))
+		for _, name := range scc {
+			fmt.Fprintf(w, "  %s\n", name)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Entry point kinds accepted by --entry-points.
+const (
+	entryMain     = "main"     // main functions of main packages
+	entryExported = "exported" // exported functions and methods of library packages
+	entryTests    = "tests"    // Test/Benchmark/Fuzz/Example functions in _test.go files
+)
+
+// parseEntryKinds validates a comma-separated list of entry point kinds.
+func parseEntryKinds(s string) ([]string, error) {
+	var kinds []string
+	for _, k := range strings.Split(s, ",") {
+		k = strings.TrimSpace(k)
+		switch k {
+		case "":
+			continue
+		case entryMain, entryExported, entryTests:
+			kinds = append(kinds, k)
+		default:
+			return nil, fmt.Errorf("unknown entry point kind %q (want %s, %s or %s)", k, entryMain, entryExported, entryTests)
+		}
+	}
+	if len(kinds) == 0 {
+		return nil, fmt.Errorf("no entry point kinds given")
+	}
+	return kinds, nil
+}
+
+// hasEntryKind reports whether kind is among kinds.
+func hasEntryKind(kinds []string, kind string) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// entryPoints returns the functions of the given kinds. Package initializers
+// are always included since they run whenever their package is linked.
+func (c *Collector) entryPoints(kinds []string) []string {
+	var roots []string
+	for _, fn := range c.Funcs {
+		pkgName := ""
+		if pkg, ok := c.Packages[fn.Package]; ok {
+			pkgName = pkg.Name
+		}
+		switch {
+		case isInitFunc(fn.Name) && !fn.IsMethod:
+		case hasEntryKind(kinds, entryMain) && pkgName == "main" && fn.Name == "main" && !fn.IsMethod &&
+			!strings.HasSuffix(fn.Package, ".test"): // generated test main
+		case hasEntryKind(kinds, entryExported) && pkgName != "main" && fn.Exported:
+		case hasEntryKind(kinds, entryTests) && isTestFunc(fn):
+		default:
+			continue
+		}
+		roots = append(roots, fn.FullName)
+	}
+	return roots
+}
+
+// isTestFunc reports whether fn is a function run by `go test`.
+func isTestFunc(fn *FuncNode) bool {
+	if fn.IsMethod || !isTestFile(fn.File) {
+		return false
+	}
+	for _, prefix := range []string{"Test", "Benchmark", "Fuzz", "Example"} {
+		if strings.HasPrefix(fn.Name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTestFile reports whether file is a Go test source file.
+func isTestFile(file string) bool {
+	return strings.HasSuffix(file, "_test.go")
+}
+
+// isTestPackage reports whether pkgPath is an external test package or the
+// generated main package of a test binary.
+func isTestPackage(pkgPath string) bool {
+	return strings.HasSuffix(pkgPath, "_test") || strings.HasSuffix(pkgPath, ".test")
+}
+
+// FindDeadCode marks every source-level project function that is not
+// reachable from entry points of the given kinds as Unreachable and returns
+// them sorted by full name.
+func (c *Collector) FindDeadCode(kinds []string) []*FuncNode {
+	reachable := c.reachableFrom(c.entryPoints(kinds))
+	var dead []*FuncNode
+	for name, fn := range c.Funcs {
+		// Functions without a file are synthetic (wrappers, closures
+		// discovered only through SSA) and not actionable.
+		fn.Unreachable = !reachable[name] && fn.File != "" && c.isProjectPackage(fn.Package)
+		if fn.Unreachable {
+			dead = append(dead, fn)
+		}
+	}
+	sort.Slice(dead, func(i, j int) bool { return dead[i].FullName < dead[j].FullName })
+	return dead
+}
+
+// WriteDeadCodeReport prints a summary of unreachable functions grouped by
+// package, followed by the full list with source locations.
+func WriteDeadCodeReport(w io.Writer, dead []*FuncNode, total int) {
+	fmt.Fprintf(w, "Dead code: %d of %d functions unreachable\n", len(dead), total)
+	if len(dead) == 0 {
+		return
+	}
+
+	byPkg := make(map[string]int)
+	for _, fn := range dead {
+		byPkg[fn.Package]++
+	}
+	pkgs := make([]string, 0, len(byPkg))
+	for p := range byPkg {
+		pkgs = append(pkgs, p)
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		if byPkg[pkgs[i]] != byPkg[pkgs[j]] {
+			return byPkg[pkgs[i]] > byPkg[pkgs[j]]
+		}
+		return pkgs[i] < pkgs[j]
+	})
+
+	fmt.Fprintln(w, "\nBy package:")
+	for _, p := range pkgs {
+		fmt.Fprintf(w, "  %6d  %s\n", byPkg[p], p)
+	}
+	fmt.Fprintln(w, "\nFunctions:")
+	for _, fn := range dead {
+		fmt.Fprintf(w, "  %s (%s:%d)\n", fn.FullName, fn.File, fn.Line)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"io"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// deprecationNote returns the text of the "Deprecated:" paragraph of a doc
+// comment, or "" if the symbol is not deprecated.
+func deprecationNote(doc *ast.CommentGroup) string {
+	if doc == nil {
+		return ""
+	}
+	for _, para := range strings.Split(doc.Text(), "\n\n") {
+		if note, ok := strings.CutPrefix(strings.TrimSpace(para), "Deprecated:"); ok {
+			if note = strings.Join(strings.Fields(note), " "); note != "" {
+				return note
+			}
+			return "deprecated"
+		}
+	}
+	return ""
+}
+
+// CollectDeprecations scans the doc comments of all loaded packages,
+// dependencies included, for "Deprecated:" paragraphs and marks the
+// matching project types and functions. Dependency deprecations are kept so
+// external stubs created later are marked too. Run it after CollectTypes.
+func (c *Collector) CollectDeprecations(pkgs []*packages.Package) {
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if pkg.TypesInfo == nil {
+			return
+		}
+		for _, file := range pkg.Syntax {
+			for _, decl := range file.Decls {
+				switch d := decl.(type) {
+				case *ast.FuncDecl:
+					note := deprecationNote(d.Doc)
+					if note == "" {
+						continue
+					}
+					if obj, ok := pkg.TypesInfo.Defs[d.Name].(*types.Func); ok {
+						c.deprecated[c.funcFullName(pkg.PkgPath, obj)] = note
+					}
+				case *ast.GenDecl:
+					for _, spec := range d.Specs {
+						ts, ok := spec.(*ast.TypeSpec)
+						if !ok {
+							continue
+						}
+						doc := ts.Doc
+						if doc == nil && len(d.Specs) == 1 {
+							doc = d.Doc
+						}
+						if note := deprecationNote(doc); note != "" {
+							c.deprecated[pkg.PkgPath+"."+ts.Name.Name] = note
+						}
+					}
+				}
+			}
+		}
+	})
+
+	for key, s := range c.Structs {
+		s.Deprecated = c.deprecated[key]
+	}
+	for key, i := range c.Interfaces {
+		i.Deprecated = c.deprecated[key]
+	}
+	for key, t := range c.NamedTypes {
+		t.Deprecated = c.deprecated[key]
+	}
+	for key, a := range c.Aliases {
+		a.Deprecated = c.deprecated[key]
+	}
+	for name, fn := range c.Funcs {
+		fn.Deprecated = c.deprecated[name]
+	}
+}
+
+// DeprecatedCalls returns the call edges from project functions into
+// deprecated functions, sorted by callee then caller.
+func (c *Collector) DeprecatedCalls() []CallEdge {
+	var calls []CallEdge
+	for _, e := range c.Calls {
+		if _, ok := c.Funcs[e.CallerFullName]; ok && c.deprecated[e.CalleeFullName] != "" {
+			calls = append(calls, e)
+		}
+	}
+	sort.Slice(calls, func(i, j int) bool {
+		if calls[i].CalleeFullName != calls[j].CalleeFullName {
+			return calls[i].CalleeFullName < calls[j].CalleeFullName
+		}
+		return calls[i].CallerFullName < calls[j].CallerFullName
+	})
+	return calls
+}
+
+// WriteDeprecatedReport prints calls into deprecated functions grouped by
+// callee, with the deprecation note.
+func (c *Collector) WriteDeprecatedReport(w io.Writer, calls []CallEdge) {
+	fmt.Fprintf(w, "Calls into deprecated functions: %d\n", len(calls))
+	prev := ""
+	for _, e := range calls {
+		if e.CalleeFullName != prev {
+			prev = e.CalleeFullName
+			fmt.Fprintf(w, "\n%s\n  Deprecated: %s\n", e.CalleeFullName, c.deprecated[e.CalleeFullName])
+		}
+		fmt.Fprintf(w, "  called by %s at %s\n", e.CallerFullName, joinSites(e.Sites))
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"go/ast"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// Kinds of a DIEdge.
+const (
+	diProvides = "provides"
+	diInjects  = "injects"
+)
+
+// Import paths of the supported dependency injection frameworks.
+const (
+	wirePackage = "github.com/google/wire"
+	fxPackage   = "go.uber.org/fx"
+	digPackage  = "go.uber.org/dig"
+)
+
+// wiringCollector gathers the DIEdges of one package.
+type wiringCollector struct {
+	*syntaxFuncs
+	c     *Collector
+	pkg   *packages.Package
+	site  CallSite
+	index map[string]int // kind|framework|func|struct|type -> position in c.Wiring
+}
+
+// collectWiring records the providers and consumers registered with
+// google/wire provider sets and injectors, uber fx (Provide, Decorate,
+// Invoke) and dig containers in the project packages among pkgs: the types
+// each constructor provides, and the types injected into its parameters.
+// Only named types are recorded, so the edges link project types.
+func (c *Collector) collectWiring(funcs *syntaxFuncs, pkgs []*packages.Package, sites *callSiteIndex) {
+	index := make(map[string]int)
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if !c.isProjectPackage(pkg.PkgPath) || pkg.TypesInfo == nil {
+			return
+		}
+		w := &wiringCollector{syntaxFuncs: funcs, c: c, pkg: pkg, index: index}
+		for _, file := range pkg.Syntax {
+			ast.Inspect(file, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				fn, _ := typeutil.Callee(pkg.TypesInfo, call).(*types.Func)
+				if fn == nil || fn.Pkg() == nil {
+					return true
+				}
+				w.site = sites.site(c, pkg.Fset, call.Lparen)
+				w.call(fn, call)
+				return true
+			})
+		}
+	})
+	for i := range c.Wiring {
+		sortSites(c.Wiring[i].Sites)
+	}
+}
+
+// call records the wiring declared by a call of fn.
+func (w *wiringCollector) call(fn *types.Func, call *ast.CallExpr) {
+	method := fn.Type().(*types.Signature).Recv() != nil
+	switch path, name := fn.Pkg().Path(), fn.Name(); {
+	case path == wirePackage && (name == "NewSet" || name == "Build"):
+		for _, arg := range call.Args {
+			w.wireProvider(arg)
+		}
+	case path == fxPackage && !method && (name == "Provide" || name == "Decorate"):
+		for _, arg := range call.Args {
+			w.function("fx", arg, true)
+		}
+	case path == fxPackage && !method && name == "Invoke":
+		for _, arg := range call.Args {
+			w.function("fx", arg, false)
+		}
+	case path == digPackage && method && len(call.Args) > 0 && (name == "Provide" || name == "Decorate"):
+		w.function("dig", call.Args[0], true)
+	case path == digPackage && method && len(call.Args) > 0 && name == "Invoke":
+		w.function("dig", call.Args[0], false)
+	}
+}
+
+// wireProvider records an argument of wire.NewSet or wire.Build: a
+// constructor, wire.Struct, wire.FieldsOf or wire.Bind. Nested provider
+// sets are recorded where they are declared.
+func (w *wiringCollector) wireProvider(arg ast.Expr) {
+	info := w.pkg.TypesInfo
+	call, ok := ast.Unparen(arg).(*ast.CallExpr)
+	if !ok {
+		w.function("wire", arg, true)
+		return
+	}
+	fn, _ := typeutil.Callee(info, call).(*types.Func)
+	if fn == nil || fn.Pkg() == nil || fn.Pkg().Path() != wirePackage || len(call.Args) == 0 {
+		return
+	}
+	// The first argument is new(T) or new(*T).
+	ptr, ok := info.TypeOf(call.Args[0]).(*types.Pointer)
+	if !ok {
+		return
+	}
+	target := typeKeyOf(ptr.Elem())
+	if target == "" {
+		return
+	}
+	fields := constStrings(info, call.Args[1:])
+	switch fn.Name() {
+	case "Struct":
+		w.add(DIEdge{Kind: diProvides, Framework: "wire", Struct: target, Type: target})
+		for _, t := range structFieldTypes(ptr.Elem(), fields) {
+			w.add(DIEdge{Kind: diInjects, Framework: "wire", Struct: target, Type: t})
+		}
+	case "FieldsOf":
+		for _, t := range structFieldTypes(ptr.Elem(), fields) {
+			w.add(DIEdge{Kind: diProvides, Framework: "wire", Struct: target, Type: t})
+		}
+	case "Bind":
+		if len(call.Args) == 2 {
+			if impl, ok := info.TypeOf(call.Args[1]).(*types.Pointer); ok && typeKeyOf(impl.Elem()) != "" {
+				w.add(DIEdge{Kind: diProvides, Framework: "wire", Struct: typeKeyOf(impl.Elem()), Type: target})
+			}
+		}
+	}
+}
+
+// function records the function expr registers as a provider, with the
+// types of its results and parameters, or as a consumer, with the types of
+// its parameters. fx.Annotate and fx.Annotated are looked through; other
+// expressions than functions and function literals are skipped.
+func (w *wiringCollector) function(framework string, expr ast.Expr, provider bool) {
+	info := w.pkg.TypesInfo
+	expr = ast.Unparen(expr)
+	var name string
+	switch x := expr.(type) {
+	case *ast.FuncLit:
+		name = w.funcLit(x)
+	case *ast.Ident, *ast.SelectorExpr:
+		id, _ := x.(*ast.Ident)
+		if sel, ok := x.(*ast.SelectorExpr); ok {
+			id = sel.Sel
+		}
+		if fn, ok := info.Uses[id].(*types.Func); ok && fn.Pkg() != nil {
+			name = w.c.funcFullName(fn.Pkg().Path(), fn)
+		}
+	case *ast.CallExpr:
+		if fn, ok := typeutil.Callee(info, x).(*types.Func); ok && fn.Pkg() != nil &&
+			fn.Pkg().Path() == fxPackage && fn.Name() == "Annotate" && len(x.Args) > 0 {
+			w.function(framework, x.Args[0], provider)
+		}
+		return
+	case *ast.CompositeLit:
+		for _, kv := range keyValues(x) {
+			if kv.key == "Target" { // fx.Annotated
+				w.function(framework, kv.value, provider)
+			}
+		}
+		return
+	}
+	sig, ok := info.TypeOf(expr).(*types.Signature)
+	if name == "" || !ok {
+		return
+	}
+	if provider {
+		for i := 0; i < sig.Results().Len(); i++ {
+			for _, t := range diTypes(sig.Results().At(i).Type()) {
+				w.add(DIEdge{Kind: diProvides, Framework: framework, Func: name, Type: t})
+			}
+		}
+	}
+	for i := 0; i < sig.Params().Len(); i++ {
+		for _, t := range diTypes(sig.Params().At(i).Type()) {
+			w.add(DIEdge{Kind: diInjects, Framework: framework, Func: name, Type: t})
+		}
+	}
+}
+
+// add records e at the current registration site.
+func (w *wiringCollector) add(e DIEdge) {
+	key := e.Kind + "|" + e.Framework + "|" + e.Func + "|" + e.Struct + "|" + e.Type
+	if i, ok := w.index[key]; ok {
+		w.c.Wiring[i].Sites = append(w.c.Wiring[i].Sites, w.site)
+		return
+	}
+	e.Sites = []CallSite{w.site}
+	w.index[key] = len(w.c.Wiring)
+	w.c.Wiring = append(w.c.Wiring, e)
+}
+
+// diTypes returns the keys of the named types a constructor parameter or
+// result of type t stands for: t itself, through pointers and slices (fx
+// value groups), or for dig.In and dig.Out parameter structs (fx.In and
+// fx.Out are aliases of them) the types of their fields. Errors and other
+// unnamed types are left out.
+func diTypes(t types.Type) []string {
+	for {
+		switch u := t.(type) {
+		case *types.Pointer:
+			t = u.Elem()
+			continue
+		case *types.Slice:
+			t = u.Elem()
+			continue
+		}
+		break
+	}
+	if st, ok := t.Underlying().(*types.Struct); ok && isDIParamStruct(st) {
+		var keys []string
+		for i := 0; i < st.NumFields(); i++ {
+			if f := st.Field(i); !f.Embedded() {
+				keys = append(keys, diTypes(f.Type())...)
+			}
+		}
+		return keys
+	}
+	if key := typeKeyOf(t); key != "" {
+		return []string{key}
+	}
+	return nil
+}
+
+// isDIParamStruct reports whether st embeds dig.In or dig.Out.
+func isDIParamStruct(st *types.Struct) bool {
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		if named, ok := types.Unalias(f.Type()).(*types.Named); ok && f.Embedded() &&
+			named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == digPackage &&
+			(named.Obj().Name() == "In" || named.Obj().Name() == "Out") {
+			return true
+		}
+	}
+	return false
+}
+
+// structFieldTypes returns the named types of the fields of struct type t
+// with the given names, all of them for "*".
+func structFieldTypes(t types.Type, names []string) []string {
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem() // wire.FieldsOf(new(*T), ...)
+	}
+	st, ok := t.Underlying().(*types.Struct)
+	if !ok {
+		return nil
+	}
+	var keys []string
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		for _, name := range names {
+			if name == f.Name() || name == "*" && !strings.HasPrefix(f.Name(), "_") {
+				keys = append(keys, diTypes(f.Type())...)
+				break
+			}
+		}
+	}
+	return keys
+}
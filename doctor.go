@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RepoProfile summarizes the properties of a repository that drive the
+// choice of analysis settings.
+type RepoProfile struct {
+	Module     string
+	GoFiles    int
+	TestFiles  int
+	LOC        int
+	Generics   int      // declarations with type parameters
+	Mains      []string // module-relative dirs of main packages
+	Vendored   bool
+	GoWork     string // path of the governing go.work, if any
+	NonProd    []string
+	ParseFails int
+}
+
+// Size thresholds (non-test LOC) used by the recommendations.
+const (
+	largeRepoLOC = 200_000
+	hugeRepoLOC  = 1_000_000
+)
+
+// InspectRepo scans the module rooted at dir without type-checking it.
+func InspectRepo(dir string) (*RepoProfile, error) {
+	module, err := detectModulePath(dir)
+	if err != nil {
+		return nil, err
+	}
+	p := &RepoProfile{Module: module}
+
+	if _, err := os.Stat(filepath.Join(dir, "vendor", "modules.txt")); err == nil {
+		p.Vendored = true
+	}
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, "go.work")); err == nil {
+			p.GoWork = filepath.Join(d, "go.work")
+			break
+		}
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+
+	mains := make(map[string]bool)
+	nonProd := make(map[string]bool)
+	fset := token.NewFileSet()
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		if d.IsDir() {
+			name := d.Name()
+			if path != dir && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			// Nested modules are analysed separately.
+			if path != dir {
+				if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+					return filepath.SkipDir
+				}
+			}
+			for _, np := range nonProdDirs {
+				if name == np {
+					nonProd[filepath.ToSlash(rel)] = true
+				}
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") {
+			return nil
+		}
+		if isTestFile(path) {
+			p.TestFiles++
+			return nil
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		p.GoFiles++
+		p.LOC += bytes.Count(src, []byte("\n"))
+		f, err := parser.ParseFile(fset, path, src, parser.SkipObjectResolution)
+		if err != nil {
+			p.ParseFails++
+			return nil
+		}
+		p.Generics += countGenericDecls(f)
+		if f.Name.Name == "main" && hasMainFunc(f) {
+			mains[filepath.ToSlash(filepath.Dir(rel))] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for m := range mains {
+		p.Mains = append(p.Mains, m)
+	}
+	sort.Strings(p.Mains)
+	for np := range nonProd {
+		p.NonProd = append(p.NonProd, np)
+	}
+	sort.Strings(p.NonProd)
+	return p, nil
+}
+
+// countGenericDecls counts function and type declarations with type parameters.
+func countGenericDecls(f *ast.File) int {
+	n := 0
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Type.TypeParams != nil {
+				n++
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				if ts, ok := spec.(*ast.TypeSpec); ok && ts.TypeParams != nil {
+					n++
+				}
+			}
+		}
+	}
+	return n
+}
+
+// hasMainFunc reports whether f declares func main().
+func hasMainFunc(f *ast.File) bool {
+	for _, decl := range f.Decls {
+		if fd, ok := decl.(*ast.FuncDecl); ok && fd.Recv == nil && fd.Name.Name == "main" {
+			return true
+		}
+	}
+	return false
+}
+
+// Recommendation is a suggested setting with its rationale. Flag and Value
+// are empty for advice that has no corresponding flag.
+type Recommendation struct {
+	Flag   string
+	Value  string
+	Reason string
+}
+
+// Recommend derives analysis settings from a repository profile.
+func Recommend(p *RepoProfile) []Recommendation {
+	var recs []Recommendation
+	recs = append(recs, Recommendation{
+		Reason: "call graph algorithm: VTA (the only supported algorithm; precise for interface calls)",
+	})
+
+	switch {
+	case p.LOC >= hugeRepoLOC:
+		recs = append(recs,
+			Recommendation{"max-analysis-time", "45m", fmt.Sprintf("%d LOC: bound the analysis and load partial results rather than run unbounded", p.LOC)},
+			Recommendation{"batch-max-bytes", "1048576", "many nodes: smaller batches keep each transaction light"},
+			Recommendation{Reason: "memory: expect tens of GB for SSA; set GOMEMLIMIT close to the machine's RAM"},
+		)
+	case p.LOC >= largeRepoLOC:
+		recs = append(recs,
+			Recommendation{"max-analysis-time", "20m", fmt.Sprintf("%d LOC: bound the analysis time", p.LOC)},
+			Recommendation{Reason: "memory: expect several GB for SSA; set GOMEMLIMIT if the machine is shared"},
+		)
+	}
+
+	if p.Generics > 0 {
+		recs = append(recs, Recommendation{
+			Reason: fmt.Sprintf("%d generic declarations: every instantiation becomes its own SSA function, so analysis takes longer", p.Generics),
+		})
+	}
+	if len(p.Mains) > 1 {
+		recs = append(recs, Recommendation{
+			Reason: fmt.Sprintf("%d main packages (%s): use --roots with one of them for a per-service graph", len(p.Mains), strings.Join(p.Mains, ", ")),
+		})
+	}
+	if p.Vendored {
+		recs = append(recs, Recommendation{"env", "GOFLAGS=-mod=vendor", "vendor/modules.txt present: load dependencies from vendor/"})
+	}
+	if p.GoWork != "" {
+		recs = append(recs, Recommendation{"env", "GOWORK=off", fmt.Sprintf("%s found: analyse this module on its own", p.GoWork)})
+	}
+	if len(p.NonProd) > 0 {
+		recs = append(recs, Recommendation{
+			Reason: fmt.Sprintf("non-production dirs (%s): filter with prod_reachable = true in queries", strings.Join(p.NonProd, ", ")),
+		})
+	}
+	if p.TestFiles > 0 {
+		recs = append(recs, Recommendation{"dead-code", "true", fmt.Sprintf("%d test files: tests count as entry points for dead code", p.TestFiles)})
+	}
+	return recs
+}
+
+// WriteDoctorReport prints the profile and recommendations.
+func WriteDoctorReport(w io.Writer, p *RepoProfile, recs []Recommendation) {
+	fmt.Fprintf(w, "Module:        %s\n", p.Module)
+	fmt.Fprintf(w, "Go files:      %d (+%d test files), %d LOC\n", p.GoFiles, p.TestFiles, p.LOC)
+	fmt.Fprintf(w, "Generics:      %d declarations\n", p.Generics)
+	fmt.Fprintf(w, "Main packages: %d\n", len(p.Mains))
+	fmt.Fprintf(w, "Vendored:      %t\n", p.Vendored)
+	if p.GoWork != "" {
+		fmt.Fprintf(w, "Workspace:     %s\n", p.GoWork)
+	}
+	if p.ParseFails > 0 {
+		fmt.Fprintf(w, "Unparsable:    %d files\n", p.ParseFails)
+	}
+	fmt.Fprintln(w, "\nRecommendations:")
+	for _, r := range recs {
+		if r.Flag != "" {
+			fmt.Fprintf(w, "  --%s=%s\n      %s\n", r.Flag, r.Value, r.Reason)
+		} else {
+			fmt.Fprintf(w, "  * %s\n", r.Reason)
+		}
+	}
+}
+
+// WriteConfig writes recommendations as a config file readable by --config.
+// Advice without a flag is kept as comments.
+func WriteConfig(w io.Writer, dir string, recs []Recommendation) error {
+	var b strings.Builder
+	b.WriteString("# Generated by `go-callgraph-neo4j init`. Use with --config.\n")
+	b.WriteString("# Flags given on the command line override values here.\n\n")
+	fmt.Fprintf(&b, "dir = %s\n", dir)
+	b.WriteString("# neo4j-uri = bolt://localhost:7687\n")
+	b.WriteString("# neo4j-user = neo4j\n")
+	for _, r := range recs {
+		fmt.Fprintf(&b, "\n# %s\n", r.Reason)
+		if r.Flag != "" {
+			fmt.Fprintf(&b, "%s = %s\n", r.Flag, r.Value)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// runDoctor implements the `doctor` and `init` subcommands. init also writes
+// the recommendations to a config file.
+func runDoctor(name string, args []string) error {
+	cmd := flag.NewFlagSet(name, flag.ExitOnError)
+	dir := cmd.String("dir", ".", "Project root directory")
+	out := cmd.String("out", "", "Config file to write (init only; default <dir>/"+defaultConfigFile+")")
+	force := cmd.Bool("force", false, "Overwrite an existing config file (init only)")
+	cmd.Parse(args)
+
+	absDir, err := filepath.Abs(*dir)
+	if err != nil {
+		return err
+	}
+	p, err := InspectRepo(absDir)
+	if err != nil {
+		return err
+	}
+	recs := Recommend(p)
+	WriteDoctorReport(os.Stdout, p, recs)
+	if name != "init" {
+		return nil
+	}
+
+	path := *out
+	if path == "" {
+		path = filepath.Join(absDir, defaultConfigFile)
+	}
+	mode := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if *force {
+		mode = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(path, mode, 0o644)
+	if err != nil {
+		return fmt.Errorf("cannot write config (use --force to overwrite): %w", err)
+	}
+	if err := WriteConfig(f, absDir, recs); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("\nWrote %s. Run:\n  go-callgraph-neo4j --config %s --neo4j-pass <password>\n", path, path)
+	return nil
+}
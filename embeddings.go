@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// embeddingAttempts is how many times a failed embeddings request is tried.
+const embeddingAttempts = 3
+
+// EmbeddingClient computes text embeddings with an OpenAI-compatible
+// embeddings endpoint, as served by OpenAI, Azure, Ollama, vLLM and others.
+type EmbeddingClient struct {
+	URL       string // e.g. https://api.openai.com/v1/embeddings
+	Model     string
+	APIKey    string // sent as a bearer token if set
+	BatchSize int    // texts per request
+	HTTP      *http.Client
+}
+
+// Embed returns the embeddings of texts, in order, batching the requests.
+func (e *EmbeddingClient) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += e.BatchSize {
+		batch := texts[start:min(start+e.BatchSize, len(texts))]
+		var vecs [][]float32
+		var err error
+		for attempt := 1; attempt <= embeddingAttempts; attempt++ {
+			if vecs, err = e.embedBatch(ctx, batch); err == nil {
+				break
+			}
+			if attempt < embeddingAttempts {
+				time.Sleep(time.Duration(attempt) * 2 * time.Second)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, vecs...)
+	}
+	return out, nil
+}
+
+// embedBatch sends one embeddings request.
+func (e *EmbeddingClient) embedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	var res struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	err := postJSON(ctx, e.HTTP, e.URL, e.APIKey, map[string]any{"model": e.Model, "input": texts}, &res)
+	if err != nil {
+		return nil, fmt.Errorf("embeddings request failed: %w", err)
+	}
+	if len(res.Data) != len(texts) {
+		return nil, fmt.Errorf("embeddings response has %d embeddings for %d inputs", len(res.Data), len(texts))
+	}
+	sort.Slice(res.Data, func(i, j int) bool { return res.Data[i].Index < res.Data[j].Index })
+	vecs := make([][]float32, len(res.Data))
+	for i, d := range res.Data {
+		vecs[i] = d.Embedding
+	}
+	return vecs, nil
+}
+
+// postJSON posts body as JSON to url, with apiKey as a bearer token if
+// set, and decodes the JSON response into out.
+func postJSON(ctx context.Context, client *http.Client, url, apiKey string, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// embeddingText returns the text embedded for fn: its full name, doc
+// comment and source, or signature when the source was not captured.
+func embeddingText(fn *FuncNode) string {
+	var b strings.Builder
+	b.WriteString(fn.FullName)
+	b.WriteString("\n")
+	if fn.Doc != "" {
+		b.WriteString(fn.Doc)
+	}
+	if fn.Source != "" {
+		b.WriteString(fn.Source)
+	} else {
+		b.WriteString(fn.Signature)
+	}
+	return b.String()
+}
+
+// FuncEmbedding is the embedding of a function and the hash of the model
+// and text it was computed from.
+type FuncEmbedding struct {
+	FullName string
+	Hash     string
+	Vector   []float32
+}
+
+// embeddingHash identifies an embedding input: the model and the text.
+func embeddingHash(model, text string) string {
+	sum := sha256.Sum256([]byte(model + "\x00" + text))
+	return hex.EncodeToString(sum[:16])
+}
+
+// EmbedFuncs computes the embeddings of the texts by function full name,
+// skipping those whose hash is in known, the hashes of the embeddings
+// already stored. It returns the new embeddings sorted by full name.
+func (e *EmbeddingClient) EmbedFuncs(ctx context.Context, texts map[string]string, known map[string]string) ([]FuncEmbedding, error) {
+	var todo []FuncEmbedding
+	var inputs []string
+	names := make([]string, 0, len(texts))
+	for name := range texts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		hash := embeddingHash(e.Model, texts[name])
+		if known[name] == hash {
+			continue
+		}
+		todo = append(todo, FuncEmbedding{FullName: name, Hash: hash})
+		inputs = append(inputs, texts[name])
+	}
+	vecs, err := e.Embed(ctx, inputs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range todo {
+		todo[i].Vector = vecs[i]
+	}
+	return todo, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"go/types"
+	"strings"
+)
+
+// Kinds of functions labeled EntryPoint.
+const (
+	entryPointMain     = "main"      // main.main of a main package
+	entryPointInit     = "init"      // init functions and package initializers
+	entryPointTestMain = "test_main" // TestMain in a _test.go file
+	entryPointHandler  = "handler"   // matches one of Collector.HandlerSignatures
+)
+
+// defaultHandlerSignatures are the --handler-signatures matched when none
+// are given: net/http, gin, echo and fiber handlers.
+const defaultHandlerSignatures = "func(http.ResponseWriter, *http.Request);func(*gin.Context);func(echo.Context) error;func(*fiber.Ctx) error"
+
+// parseHandlerSignatures splits a semicolon-separated list of function
+// signatures into their normalized forms.
+func parseHandlerSignatures(s string) []string {
+	var sigs []string
+	for _, sig := range strings.Split(s, ";") {
+		if sig = normalizeSignature(sig); sig != "" {
+			sigs = append(sigs, sig)
+		}
+	}
+	return sigs
+}
+
+// normalizeSignature drops the white space from a signature so spacing
+// differences don't matter when comparing.
+func normalizeSignature(sig string) string {
+	return strings.Join(strings.Fields(sig), "")
+}
+
+// shapeOf returns the normalized signature of sig without receiver and
+// parameter names, with types qualified by package name:
+// func(http.ResponseWriter,*http.Request).
+func shapeOf(sig *types.Signature) string {
+	qualifier := func(p *types.Package) string { return p.Name() }
+	tuple := func(t *types.Tuple, variadic bool) []string {
+		var s []string
+		for i := 0; i < t.Len(); i++ {
+			typ := t.At(i).Type()
+			if variadic && i == t.Len()-1 {
+				s = append(s, "..."+types.TypeString(typ.(*types.Slice).Elem(), qualifier))
+				continue
+			}
+			s = append(s, types.TypeString(typ, qualifier))
+		}
+		return s
+	}
+	shape := "func(" + strings.Join(tuple(sig.Params(), sig.Variadic()), ",") + ")"
+	switch results := tuple(sig.Results(), false); len(results) {
+	case 0:
+	case 1:
+		shape += results[0]
+	default:
+		shape += "(" + strings.Join(results, ",") + ")"
+	}
+	return normalizeSignature(shape)
+}
+
+// isHandler reports whether a function with signature sig matches one of
+// the configured handler signatures.
+func (c *Collector) isHandler(sig *types.Signature) bool {
+	if len(c.HandlerSignatures) == 0 {
+		return false
+	}
+	shape := shapeOf(sig)
+	for _, h := range c.HandlerSignatures {
+		if h == shape {
+			return true
+		}
+	}
+	return false
+}
+
+// MarkEntryPoints sets EntryPoint on main functions, init functions and
+// package initializers, and TestMain functions. Handlers are marked while
+// collecting, where their types are known. It returns the number of entry
+// points by kind.
+func (c *Collector) MarkEntryPoints() map[string]int {
+	counts := make(map[string]int)
+	for _, fn := range c.Funcs {
+		pkgName := ""
+		if pkg, ok := c.Packages[fn.Package]; ok {
+			pkgName = pkg.Name
+		}
+		switch {
+		case fn.IsMethod || fn.Synthetic != "":
+		case fn.Name == "main" && pkgName == "main" && !strings.HasSuffix(fn.Package, ".test"):
+			fn.EntryPoint = entryPointMain
+		case isInitFunc(fn.Name):
+			fn.EntryPoint = entryPointInit
+		case fn.Name == "TestMain" && isTestFile(fn.File):
+			fn.EntryPoint = entryPointTestMain
+		}
+		if fn.EntryPoint != "" {
+			counts[fn.EntryPoint]++
+		}
+	}
+	return counts
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"go/token"
+	"go/types"
+	"slices"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/ssa"
+)
+
+// Kinds of an ErrorFlow.
+const (
+	errorReturned = "returned" // returned as is
+	errorWrapped  = "wrapped"  // returned after passing through a function returning an error
+	errorIgnored  = "ignored"  // discarded without being looked at
+)
+
+// errorConstructors create or wrap the errors they return rather than fail,
+// so the errors of calls to them are not recorded.
+var errorConstructors = map[string]bool{
+	"errors.New": true, "errors.Join": true, "fmt.Errorf": true,
+	"github.com/pkg/errors.New": true, "github.com/pkg/errors.Errorf": true,
+	"github.com/pkg/errors.Wrap": true, "github.com/pkg/errors.Wrapf": true,
+	"github.com/pkg/errors.WithMessage": true, "github.com/pkg/errors.WithMessagef": true,
+	"github.com/pkg/errors.WithStack": true,
+}
+
+// errorType is the predeclared error interface.
+var errorType = types.Universe.Lookup("error").Type().Underlying().(*types.Interface)
+
+// returnsError reports whether a result of sig is an error.
+func returnsError(sig *types.Signature) bool {
+	return len(errorResults(sig)) > 0
+}
+
+// errorResults returns the indexes of the results of sig implementing error.
+func errorResults(sig *types.Signature) []int {
+	var idx []int
+	for i := 0; i < sig.Results().Len(); i++ {
+		if types.Implements(sig.Results().At(i).Type(), errorType) {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+// collectErrorFlow marks the functions of cg returning errors and records,
+// for each call from project code to such a function, whether the caller
+// returns the error, wraps it into one it returns, or ignores it.
+func (c *Collector) collectErrorFlow(prog *ssa.Program, cg *callgraph.Graph, sites *callSiteIndex) {
+	index := make(map[string]int) // callee|caller|kind -> position in c.ErrorFlows
+	for fn, node := range cg.Nodes {
+		if fn == nil || (syntheticKind(fn) != "" && !c.LabelSynthetic) {
+			continue
+		}
+		name := c.ssaFuncName(fn)
+		if returnsError(fn.Signature) {
+			if n, ok := c.Funcs[name]; ok {
+				n.ReturnsError = true
+			} else if n, ok := c.ExternalFuncs[name]; ok {
+				n.ReturnsError = true
+			}
+		}
+		if !c.isProjectPackage(c.ssaFuncPkg(fn)) {
+			continue
+		}
+		fates := make(map[ssa.CallInstruction]string)
+		for _, e := range node.Out {
+			if e.Site == nil {
+				continue
+			}
+			kind, ok := fates[e.Site]
+			if !ok {
+				kind = errorFate(e.Site)
+				fates[e.Site] = kind
+			}
+			if kind == "" {
+				continue
+			}
+			targets := []*callgraph.Node{e.Callee}
+			if syntheticKind(e.Callee.Func) != "" && !c.LabelSynthetic {
+				targets = syntheticTargets(e.Callee)
+			}
+			for _, t := range targets {
+				if c.ssaFuncPkg(t.Func) == "" || errorConstructors[c.ssaFuncName(t.Func)] {
+					continue
+				}
+				f := ErrorFlow{Callee: c.ssaFuncName(t.Func), Caller: name, Kind: kind}
+				site := sites.site(c, prog.Fset, e.Site.Pos())
+				key := f.Callee + "|" + f.Caller + "|" + f.Kind
+				if i, ok := index[key]; ok {
+					if !slices.Contains(c.ErrorFlows[i].Sites, site) {
+						c.ErrorFlows[i].Sites = append(c.ErrorFlows[i].Sites, site)
+					}
+					continue
+				}
+				f.Sites = []CallSite{site}
+				index[key] = len(c.ErrorFlows)
+				c.ErrorFlows = append(c.ErrorFlows, f)
+			}
+		}
+	}
+	for i := range c.ErrorFlows {
+		sortSites(c.ErrorFlows[i].Sites)
+	}
+}
+
+// errorFate returns what the calling function does with the error
+// returned by call: errorReturned, errorWrapped, errorIgnored, or "" when
+// the call returns no error or the error is otherwise handled.
+func errorFate(call ssa.CallInstruction) string {
+	idx := errorResults(call.Common().Signature())
+	if len(idx) == 0 {
+		return ""
+	}
+	v := call.Value()
+	if v == nil {
+		return errorIgnored // go and defer statements drop results
+	}
+	var errs []ssa.Value
+	if call.Common().Signature().Results().Len() == 1 {
+		errs = []ssa.Value{v}
+	} else {
+		for _, ref := range *v.Referrers() {
+			if ext, ok := ref.(*ssa.Extract); ok && ext.Index == idx[len(idx)-1] {
+				errs = append(errs, ext)
+			}
+		}
+	}
+	used := false
+	for _, err := range errs {
+		if len(*err.Referrers()) > 0 {
+			used = true
+		}
+		if fate := errorValueFate(err, false, make(map[ssa.Value]bool)); fate != "" {
+			return fate
+		}
+	}
+	if !used {
+		return errorIgnored
+	}
+	return ""
+}
+
+// errorValueFate follows the error value v through phis, conversions and
+// calls returning errors (fmt.Errorf, errors.Join, wrapping helpers) to a
+// return of the enclosing function.
+func errorValueFate(v ssa.Value, wrapped bool, seen map[ssa.Value]bool) string {
+	if seen[v] {
+		return ""
+	}
+	seen[v] = true
+	result := ""
+	for _, ref := range *v.Referrers() {
+		var next ssa.Value
+		nextWrapped := wrapped
+		switch ref := ref.(type) {
+		case *ssa.Return:
+			if wrapped {
+				return errorWrapped
+			}
+			return errorReturned
+		case *ssa.Phi, *ssa.MakeInterface, *ssa.ChangeInterface, *ssa.ChangeType:
+			next = ref.(ssa.Value)
+		case *ssa.Call:
+			if returnsError(ref.Call.Signature()) {
+				next, nextWrapped = ref, true
+			}
+		case *ssa.Store:
+			if ref.Val != v {
+				break
+			}
+			switch addr := ref.Addr.(type) {
+			case *ssa.IndexAddr:
+				// Variadic arguments, as of fmt.Errorf, go through an array.
+				if call, _ := variadicCall(addr); call != nil && call.Value() != nil && returnsError(call.Common().Signature()) {
+					next, nextWrapped = call.Value(), true
+				}
+			case *ssa.Alloc:
+				// Results go through a local in functions with defers.
+				for _, r := range *addr.Referrers() {
+					if load, ok := r.(*ssa.UnOp); ok && load.Op == token.MUL {
+						if fate := errorValueFate(load, wrapped, seen); fate != "" {
+							result = fate
+						}
+					}
+				}
+			}
+		}
+		if next == nil {
+			continue
+		}
+		// A call returning several results is followed through its error.
+		if tuple, ok := next.Type().(*types.Tuple); ok && tuple.Len() > 1 {
+			for _, r := range *next.Referrers() {
+				if ext, ok := r.(*ssa.Extract); ok && types.Implements(ext.Type(), errorType) {
+					if fate := errorValueFate(ext, nextWrapped, seen); fate != "" {
+						return fate
+					}
+				}
+			}
+			continue
+		}
+		if fate := errorValueFate(next, nextWrapped, seen); fate != "" {
+			result = fate
+			if fate == errorReturned {
+				return fate
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// runExport implements the export subcommand.
+func runExport(args []string) error {
+	if len(args) > 0 && args[0] == "archive" {
+		return runExportArchive(args[1:])
+	}
+	if len(args) > 0 && args[0] == "parquet" {
+		return runExportParquet(args[1:])
+	}
+	if len(args) > 0 && args[0] == "lookup" {
+		return runExportLookup(args[1:])
+	}
+	cmd := flag.NewFlagSet("export", flag.ExitOnError)
+	neo4jURI := cmd.String("neo4j-uri", "bolt://localhost:7687", "Neo4j URI: bolt:// for one server, neo4j:// to route in a cluster")
+	neo4jUser := cmd.String("neo4j-user", "neo4j", "Neo4j username")
+	neo4jPass := cmd.String("neo4j-pass", "", "Neo4j password; without it the project in --dir is analysed in memory")
+	dir := cmd.String("dir", ".", "Project root directory, when analysing in memory")
+	tags := cmd.String("tags", "", "Comma-separated build tags, when analysing in memory")
+	focus := cmd.String("focus", "", "Function or package to center the export on")
+	depth := cmd.Int("depth", 2, "Levels of calls to include around the focus")
+	direction := cmd.String("direction", "both", "Calls to follow from the focus: callers, callees or both")
+	external := cmd.Bool("external", false, "Include calls to dependencies and the standard library")
+	maxFuncs := cmd.Int("max-nodes", 100, "Most functions to include")
+	out := cmd.String("out", "", "Write the export to this file instead of stdout")
+	graphOpts := addGraphFlags(cmd)
+	cmd.Usage = func() {
+		fmt.Fprintln(cmd.Output(), "Usage: go-callgraph-neo4j export mermaid|html-viz --focus <symbol|package> [flags]")
+		fmt.Fprintln(cmd.Output(), "       go-callgraph-neo4j export archive --out <file.tar[.gz]> --neo4j-pass <password> [flags]")
+		fmt.Fprintln(cmd.Output(), "       go-callgraph-neo4j export parquet --out <dir> --neo4j-pass <password> [flags]")
+		fmt.Fprintln(cmd.Output(), "       go-callgraph-neo4j export lookup [--out <file.json>] [flags]")
+		cmd.PrintDefaults()
+	}
+	pos := parseInterspersed(cmd, args)
+	if len(pos) != 1 || (pos[0] != "mermaid" && pos[0] != "html-viz") || *focus == "" || *depth < 1 || *maxFuncs < 1 ||
+		(*direction != "callers" && *direction != "callees" && *direction != "both") {
+		cmd.Usage()
+		os.Exit(1)
+	}
+
+	names, err := graphOpts.names()
+	if err != nil {
+		return err
+	}
+	g, closeGraph, err := openCallGraph(*neo4jURI, *neo4jUser, *neo4jPass, names, *graphOpts.project, *dir, *tags)
+	if err != nil {
+		return err
+	}
+	defer closeGraph()
+	roots, err := resolveFocus(g, *focus)
+	if err != nil {
+		return err
+	}
+	funcs, calls, truncated, err := Neighborhood(g, roots, *depth,
+		*direction != "callees", *direction != "callers", *external, max(*maxFuncs, len(roots)))
+	if err != nil {
+		return err
+	}
+	if truncated {
+		log.Printf("Warning: stopped at %d functions; raise --max-nodes or lower --depth for the whole neighborhood", len(funcs))
+	}
+	log.Printf("Exporting %d functions and %d calls", len(funcs), len(calls))
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("failed to create export: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if pos[0] == "html-viz" {
+		return WriteHTMLViz(w, roots, funcs, calls)
+	}
+	WriteMermaid(w, roots, funcs, calls)
+	return nil
+}
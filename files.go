@@ -0,0 +1,78 @@
+package main
+
+import (
+	"go/ast"
+	"go/build/constraint"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// collectFiles records a FileNode for each source file of pkg and marks the
+// package generated if all of its files carry a "Code generated" header.
+func (c *Collector) collectFiles(pkg *packages.Package) {
+	generated := 0
+	for _, file := range pkg.Syntax {
+		tf := pkg.Fset.File(file.Pos())
+		if tf == nil {
+			continue
+		}
+		f := &FileNode{
+			Path:      c.relPath(tf.Name()),
+			Package:   pkg.PkgPath,
+			LOC:       tf.LineCount(),
+			Generated: ast.IsGenerated(file),
+		}
+		f.BuildConstraint, f.BuildTags = buildConstraint(file)
+		if f.Generated {
+			generated++
+		}
+		c.Files[f.Path] = f
+	}
+	c.Packages[pkg.PkgPath].Generated = generated > 0 && generated == len(pkg.Syntax)
+}
+
+// buildConstraint returns the //go:build expression of file and the tags
+// it mentions, or "" and nil if it has none.
+func buildConstraint(file *ast.File) (string, []string) {
+	for _, cg := range file.Comments {
+		if cg.Pos() >= file.Package {
+			break
+		}
+		for _, comment := range cg.List {
+			if !constraint.IsGoBuild(comment.Text) {
+				continue
+			}
+			expr, err := constraint.Parse(comment.Text)
+			if err != nil {
+				return strings.TrimSpace(strings.TrimPrefix(comment.Text, "//go:build")), nil
+			}
+			seen := make(map[string]bool)
+			constraintTags(expr, seen)
+			tags := make([]string, 0, len(seen))
+			for tag := range seen {
+				tags = append(tags, tag)
+			}
+			sort.Strings(tags)
+			return expr.String(), tags
+		}
+	}
+	return "", nil
+}
+
+// constraintTags adds the tags mentioned in x to tags.
+func constraintTags(x constraint.Expr, tags map[string]bool) {
+	switch x := x.(type) {
+	case *constraint.TagExpr:
+		tags[x.Tag] = true
+	case *constraint.NotExpr:
+		constraintTags(x.X, tags)
+	case *constraint.AndExpr:
+		constraintTags(x.X, tags)
+		constraintTags(x.Y, tags)
+	case *constraint.OrExpr:
+		constraintTags(x.X, tags)
+		constraintTags(x.Y, tags)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// Kinds of a FuncValueUse.
+const (
+	funcValueArg     = "arg"
+	funcValueField   = "field"
+	funcValueGlobal  = "global"
+	funcValueElement = "element"
+	funcValueMap     = "map"
+	funcValueReturn  = "return"
+)
+
+// collectFuncValues records where project functions, closures and method
+// values are used as values by project code, found in the SSA of prog:
+// the arguments, struct fields, variables, slice and map elements and
+// results they flow into directly.
+func (c *Collector) collectFuncValues(prog *ssa.Program, sites *callSiteIndex) {
+	index := make(map[string]int) // holder|func|kind|callee|param|struct|field -> position in c.FuncValues
+	add := func(u FuncValueUse, pos token.Pos) {
+		key := u.Holder + "|" + u.Func + "|" + u.Kind + "|" + u.Callee + "|" + u.Param + "|" + u.Struct + "|" + u.Field
+		i, ok := index[key]
+		if !ok {
+			i = len(c.FuncValues)
+			index[key] = i
+			c.FuncValues = append(c.FuncValues, u)
+		}
+		if pos.IsValid() {
+			c.FuncValues[i].Sites = append(c.FuncValues[i].Sites, sites.site(c, prog.Fset, pos))
+		}
+	}
+
+	for fn := range ssautil.AllFunctions(prog) {
+		if !c.isProjectPackage(c.ssaFuncPkg(fn)) || (syntheticKind(fn) != "" && !c.LabelSynthetic) {
+			continue
+		}
+		holder := c.ssaFuncName(fn)
+		for _, b := range fn.Blocks {
+			for _, instr := range b.Instrs {
+				for _, u := range c.funcValueUses(instr) {
+					u.Holder = holder
+					add(u, instr.Pos())
+				}
+			}
+		}
+	}
+	for i := range c.FuncValues {
+		sortSites(c.FuncValues[i].Sites)
+	}
+}
+
+// funcValueUses returns the uses of project functions as values by instr,
+// with Holder left for the caller to set.
+func (c *Collector) funcValueUses(instr ssa.Instruction) []FuncValueUse {
+	var uses []FuncValueUse
+	use := func(v ssa.Value, u FuncValueUse) {
+		if name := c.funcValueName(v); name != "" {
+			u.Func = name
+			uses = append(uses, u)
+		}
+	}
+	switch instr := instr.(type) {
+	case ssa.CallInstruction:
+		common := instr.Common()
+		for i, arg := range common.Args {
+			use(arg, c.funcValueArg(common, i))
+		}
+	case *ssa.Store:
+		switch addr := instr.Addr.(type) {
+		case *ssa.FieldAddr:
+			ptr, _ := addr.X.Type().Underlying().(*types.Pointer)
+			if ptr == nil {
+				break
+			}
+			if st, ok := ptr.Elem().Underlying().(*types.Struct); ok {
+				use(instr.Val, FuncValueUse{Kind: funcValueField, Struct: typeKeyOf(ptr.Elem()), Field: st.Field(addr.Field).Name()})
+			}
+		case *ssa.Global:
+			name := addr.Name()
+			if addr.Pkg != nil {
+				name = addr.Pkg.Pkg.Path() + "." + name
+			}
+			use(instr.Val, FuncValueUse{Kind: funcValueGlobal, Field: name})
+		case *ssa.IndexAddr:
+			// Variadic arguments are stored into an array sliced for the call.
+			if call, i := variadicCall(addr); call != nil {
+				use(instr.Val, c.funcValueArg(call.Common(), i))
+			} else {
+				use(instr.Val, FuncValueUse{Kind: funcValueElement})
+			}
+		}
+	case *ssa.MapUpdate:
+		use(instr.Value, FuncValueUse{Kind: funcValueMap})
+	case *ssa.Return:
+		for _, r := range instr.Results {
+			use(r, FuncValueUse{Kind: funcValueReturn})
+		}
+	}
+	return uses
+}
+
+// funcValueArg describes argument i of a call: the statically called
+// function and the name of the parameter, if known.
+func (c *Collector) funcValueArg(common *ssa.CallCommon, i int) FuncValueUse {
+	u := FuncValueUse{Kind: funcValueArg}
+	if callee := common.StaticCallee(); callee != nil {
+		u.Callee = c.funcValueName(callee)
+		if u.Callee == "" {
+			u.Callee = c.ssaFuncName(callee)
+		}
+	}
+	sig := common.Signature()
+	if !common.IsInvoke() && sig.Recv() != nil {
+		i-- // the receiver comes first
+	}
+	if i >= 0 && i < sig.Params().Len() {
+		u.Param = sig.Params().At(i).Name()
+	}
+	return u
+}
+
+// variadicCall returns the call passing the array addr indexes, sliced, as
+// its argument i, if any.
+func variadicCall(addr *ssa.IndexAddr) (ssa.CallInstruction, int) {
+	alloc, ok := addr.X.(*ssa.Alloc)
+	if !ok {
+		return nil, 0
+	}
+	for _, ref := range *alloc.Referrers() {
+		slice, ok := ref.(*ssa.Slice)
+		if !ok {
+			continue
+		}
+		for _, sref := range *slice.Referrers() {
+			if call, ok := sref.(ssa.CallInstruction); ok {
+				for i, arg := range call.Common().Args {
+					if arg == slice {
+						return call, i
+					}
+				}
+			}
+		}
+	}
+	return nil, 0
+}
+
+// funcValueName returns the full name of the project function v holds,
+// looking through closures, conversions and interfaces, or "". Method
+// values and expressions are attributed to the method unless synthetic
+// functions are kept.
+func (c *Collector) funcValueName(v ssa.Value) string {
+	var fn *ssa.Function
+	for fn == nil {
+		switch x := v.(type) {
+		case *ssa.Function:
+			fn = x
+		case *ssa.MakeClosure:
+			v = x.Fn
+		case *ssa.ChangeType:
+			v = x.X
+		case *ssa.MakeInterface:
+			v = x.X
+		case *ssa.Convert:
+			v = x.X
+		default:
+			return ""
+		}
+	}
+	if syntheticKind(fn) != "" && !c.LabelSynthetic {
+		if obj, ok := fn.Object().(*types.Func); ok && obj.Pkg() != nil && c.isProjectPackage(obj.Pkg().Path()) {
+			return c.funcFullName(obj.Pkg().Path(), obj)
+		}
+		return ""
+	}
+	if !c.isProjectPackage(c.ssaFuncPkg(fn)) {
+		return ""
+	}
+	return c.ssaFuncName(fn)
+}
@@ -0,0 +1,91 @@
+package main
+
+import "strings"
+
+// isGeneratedFile reports whether the project file at path carries the
+// standard "// Code generated ... DO NOT EDIT." header.
+func (c *Collector) isGeneratedFile(path string) bool {
+	f, ok := c.Files[path]
+	return ok && f.Generated
+}
+
+// isGeneratedFunc reports whether fn is declared in a generated file.
+// Closures found only by the call graph have no file and follow their
+// enclosing function.
+func (c *Collector) isGeneratedFunc(fn *FuncNode) bool {
+	if fn.File == "" {
+		if i := strings.IndexByte(fn.FullName, '$'); i > 0 {
+			if parent, ok := c.Funcs[fn.FullName[:i]]; ok {
+				return c.isGeneratedFile(parent.File)
+			}
+		}
+	}
+	return c.isGeneratedFile(fn.File)
+}
+
+// MarkGenerated flags types and functions declared in generated files with
+// Generated. Run it after CollectCallGraph so closures are included. It
+// returns the number of generated functions.
+func (c *Collector) MarkGenerated() int {
+	n := 0
+	for _, fn := range c.Funcs {
+		fn.Generated = c.isGeneratedFunc(fn)
+		if fn.Generated {
+			n++
+		}
+	}
+	for _, s := range c.Structs {
+		s.Generated = c.isGeneratedFile(s.File)
+	}
+	for _, i := range c.Interfaces {
+		i.Generated = c.isGeneratedFile(i.File)
+	}
+	for _, t := range c.NamedTypes {
+		t.Generated = c.isGeneratedFile(t.File)
+	}
+	for _, a := range c.Aliases {
+		a.Generated = c.isGeneratedFile(a.File)
+	}
+	return n
+}
+
+// SkipGenerated removes generated packages, files, types and functions,
+// together with the edges touching them.
+func (c *Collector) SkipGenerated() {
+	for name, fn := range c.Funcs {
+		if fn.Generated {
+			delete(c.Funcs, name)
+		}
+	}
+	for k, s := range c.Structs {
+		if s.Generated {
+			delete(c.Structs, k)
+		}
+	}
+	for k, i := range c.Interfaces {
+		if i.Generated {
+			delete(c.Interfaces, k)
+		}
+	}
+	for k, t := range c.NamedTypes {
+		if t.Generated {
+			delete(c.NamedTypes, k)
+		}
+	}
+	for k, a := range c.Aliases {
+		if a.Generated {
+			delete(c.Aliases, k)
+		}
+	}
+	for path, p := range c.Packages {
+		if p.Generated {
+			delete(c.Packages, path)
+		}
+	}
+	for path, f := range c.Files {
+		if f.Generated {
+			delete(c.Files, path)
+		}
+	}
+	c.pruneEdges()
+}
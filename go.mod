@@ -3,11 +3,11 @@ module go-callgraph-neo4j
 go 1.22.0
 
 require (
+	github.com/google/pprof v0.0.0-20241029153458-d1b30febd7db
 	github.com/neo4j/neo4j-go-driver/v5 v5.28.0
+	golang.org/x/mod v0.22.0
 	golang.org/x/tools v0.29.0
+	google.golang.org/protobuf v1.34.2
 )
 
-require (
-	golang.org/x/mod v0.22.0 // indirect
-	golang.org/x/sync v0.10.0 // indirect
-)
+require golang.org/x/sync v0.10.0 // indirect
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Heuristics of the god function and god package analysis, as named in
+// --hotspot-thresholds and in hotspot_reasons.
+const (
+	hotspotFanIn         = "fan-in"
+	hotspotFanOut        = "fan-out"
+	hotspotStatements    = "statements"
+	hotspotComplexity    = "complexity"
+	hotspotPkgFuncs      = "pkg-funcs"
+	hotspotPkgStatements = "pkg-statements"
+	hotspotPkgAfferent   = "pkg-afferent"
+	hotspotPkgEfferent   = "pkg-efferent"
+	hotspotSignals       = "signals"
+)
+
+// HotspotThresholds are the limits beyond which a function or a package
+// is suspect. It is labelled Hotspot when it exceeds at least Signals of
+// them: a function only called from everywhere is a utility, one also
+// long and branchy is doing too much.
+type HotspotThresholds struct {
+	FanIn, FanOut, Statements, Complexity int // per function
+	PkgFuncs, PkgStatements               int // per package
+	PkgAfferent, PkgEfferent              int // project packages depending on it and it depends on
+	Signals                               int // thresholds to exceed
+}
+
+// defaultHotspotThresholds are the thresholds without --hotspot-thresholds.
+var defaultHotspotThresholds = HotspotThresholds{
+	FanIn: 20, FanOut: 15, Statements: 80, Complexity: 20,
+	PkgFuncs: 100, PkgStatements: 2000, PkgAfferent: 10, PkgEfferent: 10,
+	Signals: 2,
+}
+
+// parseHotspotThresholds parses a --hotspot-thresholds spec, comma-separated
+// name=value pairs overriding the defaults, such as "fan-out=25,signals=3".
+func parseHotspotThresholds(spec string) (HotspotThresholds, error) {
+	t := defaultHotspotThresholds
+	fields := map[string]*int{
+		hotspotFanIn: &t.FanIn, hotspotFanOut: &t.FanOut, hotspotStatements: &t.Statements,
+		hotspotComplexity: &t.Complexity, hotspotPkgFuncs: &t.PkgFuncs, hotspotPkgStatements: &t.PkgStatements,
+		hotspotPkgAfferent: &t.PkgAfferent, hotspotPkgEfferent: &t.PkgEfferent, hotspotSignals: &t.Signals,
+	}
+	for _, part := range splitList(spec) {
+		name, value, ok := strings.Cut(part, "=")
+		field := fields[strings.TrimSpace(name)]
+		if !ok || field == nil {
+			return t, fmt.Errorf("invalid threshold %q: want name=value, name one of %s", part, strings.Join(sortedKeys(fields), ", "))
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n < 1 {
+			return t, fmt.Errorf("invalid threshold %q: want a positive integer", part)
+		}
+		*field = n
+	}
+	return t, nil
+}
+
+// GodFunc is a function labelled Hotspot, with the thresholds it exceeds.
+type GodFunc struct {
+	FuncHotspot
+	Score   float64  `json:"score"`
+	Reasons []string `json:"reasons"`
+}
+
+// GodPackage is a package labelled Hotspot, with the thresholds it
+// exceeds.
+type GodPackage struct {
+	Package    string   `json:"package"`
+	Funcs      int      `json:"funcs"`
+	Statements int      `json:"statements"`
+	Afferent   int      `json:"afferent"`
+	Efferent   int      `json:"efferent"`
+	Score      float64  `json:"score"`
+	Reasons    []string `json:"reasons"`
+}
+
+// hotspotCheck is one threshold of a function or package: its heuristic,
+// the measured value and the limit.
+type hotspotCheck struct {
+	name         string
+	value, limit int
+}
+
+// hotspotScore returns the heuristics of checks exceeding their limit and
+// the score of the node, the sum of each value over its limit, so that
+// nodes far beyond several limits rank first.
+func hotspotScore(checks []hotspotCheck) (reasons []string, score float64) {
+	for _, ch := range checks {
+		score += float64(ch.value) / float64(ch.limit)
+		if ch.value > ch.limit {
+			reasons = append(reasons, ch.name)
+		}
+	}
+	return reasons, score
+}
+
+// MarkHotspots sets Hotspot and HotspotScore on the project functions and
+// packages exceeding at least t.Signals thresholds, generated code, tests
+// and synthetic functions aside, and returns them by score, highest first.
+// Fan-in and fan-out count distinct project functions, as in Hotspots;
+// package coupling is that of ComputePackageMetrics, which must run first.
+func (c *Collector) MarkHotspots(t HotspotThresholds) ([]GodFunc, []GodPackage) {
+	fanIn, fanOut := c.funcFans()
+	pkgFuncs := make(map[string]int)
+	pkgStmts := make(map[string]int)
+	funcs := []GodFunc{}
+	for name, fn := range c.Funcs {
+		fn.Hotspot, fn.HotspotScore = nil, 0
+		if !hotspotCounted(fn) {
+			continue
+		}
+		pkgFuncs[fn.Package]++
+		pkgStmts[fn.Package] += fn.Statements
+		reasons, score := hotspotScore([]hotspotCheck{
+			{hotspotFanIn, fanIn[name], t.FanIn},
+			{hotspotFanOut, fanOut[name], t.FanOut},
+			{hotspotStatements, fn.Statements, t.Statements},
+			{hotspotComplexity, fn.Complexity, t.Complexity},
+		})
+		if len(reasons) < t.Signals {
+			continue
+		}
+		fn.Hotspot, fn.HotspotScore = reasons, score
+		funcs = append(funcs, GodFunc{
+			FuncHotspot: FuncHotspot{
+				FullName: name, File: fn.File, Line: fn.Line, FanIn: fanIn[name], FanOut: fanOut[name],
+				Complexity: fn.Complexity, LOC: fn.LOC, Statements: fn.Statements,
+			},
+			Score: score, Reasons: reasons,
+		})
+	}
+	sort.Slice(funcs, func(i, j int) bool {
+		if funcs[i].Score != funcs[j].Score {
+			return funcs[i].Score > funcs[j].Score
+		}
+		return funcs[i].FullName < funcs[j].FullName
+	})
+
+	pkgs := []GodPackage{}
+	for path, p := range c.Packages {
+		p.Hotspot, p.HotspotScore = nil, 0
+		if isTestPackage(path) || p.Generated {
+			continue
+		}
+		reasons, score := hotspotScore([]hotspotCheck{
+			{hotspotPkgFuncs, pkgFuncs[path], t.PkgFuncs},
+			{hotspotPkgStatements, pkgStmts[path], t.PkgStatements},
+			{hotspotPkgAfferent, p.Afferent, t.PkgAfferent},
+			{hotspotPkgEfferent, p.Efferent, t.PkgEfferent},
+		})
+		if len(reasons) < t.Signals {
+			continue
+		}
+		p.Hotspot, p.HotspotScore = reasons, score
+		pkgs = append(pkgs, GodPackage{
+			Package: path, Funcs: pkgFuncs[path], Statements: pkgStmts[path],
+			Afferent: p.Afferent, Efferent: p.Efferent, Score: score, Reasons: reasons,
+		})
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		if pkgs[i].Score != pkgs[j].Score {
+			return pkgs[i].Score > pkgs[j].Score
+		}
+		return pkgs[i].Package < pkgs[j].Package
+	})
+	return funcs, pkgs
+}
+
+// WriteHotspotReport prints the god functions and packages returned by
+// MarkHotspots, highest score first.
+func WriteHotspotReport(w io.Writer, funcs []GodFunc, pkgs []GodPackage) {
+	fmt.Fprintf(w, "God functions: %d\n", len(funcs))
+	if len(funcs) > 0 {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "#\tFunction\tScore\tFan-in\tFan-out\tStatements\tComplexity\tExceeds\tLocation")
+		for i, f := range funcs {
+			fmt.Fprintf(tw, "%d\t%s\t%.1f\t%d\t%d\t%d\t%d\t%s\t%s:%d\n", i+1, f.FullName, f.Score,
+				f.FanIn, f.FanOut, f.Statements, f.Complexity, strings.Join(f.Reasons, ","), f.File, f.Line)
+		}
+		tw.Flush()
+	}
+	fmt.Fprintf(w, "God packages: %d\n", len(pkgs))
+	if len(pkgs) > 0 {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "#\tPackage\tScore\tFunctions\tStatements\tCa\tCe\tExceeds")
+		for i, p := range pkgs {
+			fmt.Fprintf(tw, "%d\t%s\t%.1f\t%d\t%d\t%d\t%d\t%s\n", i+1, p.Package, p.Score,
+				p.Funcs, p.Statements, p.Afferent, p.Efferent, strings.Join(p.Reasons, ","))
+		}
+		tw.Flush()
+	}
+}
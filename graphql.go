@@ -0,0 +1,1420 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// This file is a small GraphQL engine for serve --graphql: a parser of
+// query documents and an executor over a schema of object, scalar and
+// enum types with resolver functions. It supports variables, aliases,
+// fragments, @skip and @include, and the introspection queries GraphQL
+// clients and code generators send. There are no mutations or
+// subscriptions, interfaces, unions or input objects.
+
+// Limits of a query: nesting of its selections and values, and fields
+// completed by its execution, so that a deep or wide query, or fragments
+// spreading each other within their fields, cannot exhaust the server.
+const (
+	maxGQLDepth  = 32
+	maxGQLFields = 50000
+)
+
+// gqlType is a named type of a schema.
+type gqlType struct {
+	kind   string // OBJECT, SCALAR or ENUM
+	name   string
+	doc    string
+	fields []*gqlField // of objects
+	values []string    // of enums
+}
+
+// field returns the field name of an object type, or nil.
+func (t *gqlType) field(name string) *gqlField {
+	for _, f := range t.fields {
+		if f.name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// gqlField is a field of an object type. Its type is written as in SDL,
+// such as [Function!]!. Fields without a resolver read prop, or their own
+// name, from a parent map.
+type gqlField struct {
+	name    string
+	typ     string
+	doc     string
+	args    []gqlArg
+	prop    string
+	resolve func(ctx context.Context, parent any, args map[string]any) (any, error)
+}
+
+// gqlArg is an argument of a field, with its default value if it has one.
+type gqlArg struct {
+	name string
+	typ  string
+	def  any
+	doc  string
+}
+
+// gqlSchema is a schema of named types with its query root.
+type gqlSchema struct {
+	types map[string]*gqlType
+	order []string // type names in order of definition
+	query *gqlType
+}
+
+// newGQLSchema returns a schema with the built-in scalars and the
+// introspection types, to which the query root and its types are added.
+func newGQLSchema() *gqlSchema {
+	s := &gqlSchema{types: make(map[string]*gqlType)}
+	for _, name := range []string{"String", "Int", "Float", "Boolean", "ID"} {
+		s.add(&gqlType{kind: "SCALAR", name: name})
+	}
+	s.addIntrospection()
+	return s
+}
+
+// add adds t to the schema.
+func (s *gqlSchema) add(t *gqlType) *gqlType {
+	s.types[t.name] = t
+	s.order = append(s.order, t.name)
+	return t
+}
+
+// object adds an object type with fields.
+func (s *gqlSchema) object(name, doc string, fields ...*gqlField) *gqlType {
+	return s.add(&gqlType{kind: "OBJECT", name: name, doc: doc, fields: fields})
+}
+
+// gqlError is an error of a GraphQL response.
+type gqlError struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+// gqlResponse is the response to a GraphQL request.
+type gqlResponse struct {
+	Data   any        `json:"data"`
+	Errors []gqlError `json:"errors,omitempty"`
+}
+
+// gqlResult is the value of an object in a response, keeping the fields
+// in the order they were selected.
+type gqlResult []gqlEntry
+
+type gqlEntry struct {
+	key   string
+	value any
+}
+
+func (r gqlResult) MarshalJSON() ([]byte, error) {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, e := range r {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(e.key)
+		value, err := json.Marshal(e.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return []byte(b.String()), nil
+}
+
+// Execute runs the operation operationName, or the only one, of the query
+// document query with variables.
+func (s *gqlSchema) Execute(ctx context.Context, query, operationName string, variables map[string]any) *gqlResponse {
+	doc, err := parseGQL(query)
+	if err != nil {
+		return &gqlResponse{Errors: []gqlError{{Message: err.Error()}}}
+	}
+	var op *gqlOperation
+	for _, o := range doc.operations {
+		if operationName == "" && len(doc.operations) > 1 {
+			return &gqlResponse{Errors: []gqlError{{Message: "operationName is required for a document of several operations"}}}
+		}
+		if operationName == "" || o.name == operationName {
+			op = o
+		}
+	}
+	if op == nil {
+		return &gqlResponse{Errors: []gqlError{{Message: fmt.Sprintf("no operation named %q", operationName)}}}
+	}
+	if op.kind != "query" {
+		return &gqlResponse{Errors: []gqlError{{Message: fmt.Sprintf("%s operations are not supported", op.kind)}}}
+	}
+	if errs := s.validate(doc, op); len(errs) > 0 {
+		return &gqlResponse{Errors: errs}
+	}
+	ex := &gqlExecution{schema: s, doc: doc, vars: make(map[string]any)}
+	for _, v := range op.vars {
+		value, ok := variables[v.name]
+		if !ok && v.hasDef {
+			value, ok = ex.value(v.def)
+		}
+		if !ok || value == nil {
+			if strings.HasSuffix(v.typ, "!") {
+				return &gqlResponse{Errors: []gqlError{{Message: fmt.Sprintf("variable $%s of type %s is required", v.name, v.typ)}}}
+			}
+			if ok {
+				ex.vars[v.name] = nil
+			}
+			continue
+		}
+		if value, err = coerceGQLInput(s, v.typ, value); err != nil {
+			return &gqlResponse{Errors: []gqlError{{Message: fmt.Sprintf("variable $%s: %v", v.name, err)}}}
+		}
+		ex.vars[v.name] = value
+	}
+	data, invalid := ex.selectionSet(ctx, s.query, nil, op.selections, nil)
+	resp := &gqlResponse{Errors: ex.errors}
+	if !invalid {
+		resp.Data = data
+	}
+	return resp
+}
+
+// validate checks op and the fragments of doc against the schema before
+// they are executed: that the fields and arguments exist, that required
+// arguments are given, that variables are defined, and that exactly the
+// fields of object types select subfields. A document failing it is not
+// executed.
+func (s *gqlSchema) validate(doc *gqlDocument, op *gqlOperation) []gqlError {
+	v := &gqlValidation{schema: s, doc: doc, vars: make(map[string]bool)}
+	for _, d := range op.vars {
+		v.vars[d.name] = true
+	}
+	v.selections(s.query, op.selections)
+	for _, name := range sortedKeys(doc.fragments) {
+		frag := doc.fragments[name]
+		t := s.types[frag.on]
+		if t == nil || t.kind != "OBJECT" {
+			v.fail("fragment %q is on %q, which is not an object type", name, frag.on)
+			continue
+		}
+		v.selections(t, frag.selections)
+	}
+	return v.errors
+}
+
+// gqlValidation is the state of the validation of a document.
+type gqlValidation struct {
+	schema *gqlSchema
+	doc    *gqlDocument
+	vars   map[string]bool // variables defined by the operation
+	errors []gqlError
+}
+
+func (v *gqlValidation) fail(format string, args ...any) {
+	v.errors = append(v.errors, gqlError{Message: fmt.Sprintf(format, args...)})
+}
+
+// selections checks sels selected on the object type t. Fragment spreads
+// are checked once, with the fragments of the document.
+func (v *gqlValidation) selections(t *gqlType, sels []*gqlSelection) {
+	for _, sel := range sels {
+		for _, d := range sel.directives {
+			v.values(d.args)
+		}
+		switch {
+		case sel.spread != "":
+			if _, ok := v.doc.fragments[sel.spread]; !ok {
+				v.fail("unknown fragment %q", sel.spread)
+			}
+		case sel.inline:
+			on := t
+			if sel.on != "" {
+				if on = v.schema.types[sel.on]; on == nil || on.kind != "OBJECT" {
+					v.fail("inline fragment on %q, which is not an object type", sel.on)
+					continue
+				}
+			}
+			v.selections(on, sel.selections)
+		case sel.name == "__typename":
+			if sel.selections != nil {
+				v.fail("field \"__typename\" of type String! must not have a selection of subfields")
+			}
+		default:
+			v.field(t, sel)
+		}
+	}
+}
+
+// field checks the field sel selected on the object type t.
+func (v *gqlValidation) field(t *gqlType, sel *gqlSelection) {
+	def := t.field(sel.name)
+	if def == nil {
+		v.fail("cannot query field %q on type %q", sel.name, t.name)
+		return
+	}
+	for _, name := range sortedKeys(sel.args) {
+		if !slices.ContainsFunc(def.args, func(a gqlArg) bool { return a.name == name }) {
+			v.fail("unknown argument %q of field %q", name, def.name)
+		}
+	}
+	v.values(sel.args)
+	for _, a := range def.args {
+		value, ok := sel.args[a.name]
+		if _, null := value.(gqlNull); (!ok || null) && a.def == nil && strings.HasSuffix(a.typ, "!") {
+			v.fail("argument %q of type %s of field %q is required", a.name, a.typ, def.name)
+		}
+	}
+	named := strings.Trim(def.typ, "[]!")
+	if ft := v.schema.types[named]; ft.kind == "OBJECT" {
+		if sel.selections == nil {
+			v.fail("field %q of type %s must have a selection of subfields", def.name, def.typ)
+			return
+		}
+		v.selections(ft, sel.selections)
+	} else if sel.selections != nil {
+		v.fail("field %q of type %s must not have a selection of subfields", def.name, def.typ)
+	}
+}
+
+// values checks that the variables used by argument values are defined.
+func (v *gqlValidation) values(args map[string]any) {
+	var walk func(value any)
+	walk = func(value any) {
+		switch value := value.(type) {
+		case gqlVariable:
+			if !v.vars[string(value)] {
+				v.fail("variable $%s is not defined", value)
+			}
+		case []any:
+			for _, item := range value {
+				walk(item)
+			}
+		case map[string]any:
+			for _, k := range sortedKeys(value) {
+				walk(value[k])
+			}
+		}
+	}
+	for _, k := range sortedKeys(args) {
+		walk(args[k])
+	}
+}
+
+// gqlExecution is the state of the execution of an operation.
+type gqlExecution struct {
+	schema *gqlSchema
+	doc    *gqlDocument
+	vars   map[string]any
+	errors []gqlError
+	fields int  // fields completed so far
+	halted bool // a limit was exceeded
+}
+
+func (ex *gqlExecution) fail(path []any, format string, args ...any) {
+	ex.errors = append(ex.errors, gqlError{Message: fmt.Sprintf(format, args...), Path: slices.Clone(path)})
+}
+
+// selectionSet executes the selections on parent, a value of the object
+// type t. It reports whether the object is invalid: null where a
+// non-null field was null.
+func (ex *gqlExecution) selectionSet(ctx context.Context, t *gqlType, parent any, sels []*gqlSelection, path []any) (gqlResult, bool) {
+	if ex.halted {
+		return nil, true
+	}
+	depth := 0
+	for _, key := range path {
+		if _, ok := key.(string); ok {
+			depth++
+		}
+	}
+	if depth >= maxGQLDepth {
+		ex.fail(path, "the query is nested deeper than %d fields", maxGQLDepth)
+		ex.halted = true
+		return nil, true
+	}
+	var keys []string
+	groups := make(map[string][]*gqlSelection)
+	if err := ex.collect(t, sels, &keys, groups, make(map[string]bool)); err != nil {
+		ex.fail(path, "%v", err)
+		return nil, true
+	}
+	result := make(gqlResult, 0, len(keys))
+	for _, key := range keys {
+		if ex.fields++; ex.fields > maxGQLFields {
+			ex.fail(path, "the query selects more than %d fields", maxGQLFields)
+			ex.halted = true
+			return nil, true
+		}
+		fields := groups[key]
+		f := fields[0]
+		fieldPath := append(slices.Clone(path), key)
+		if f.name == "__typename" {
+			result = append(result, gqlEntry{key, t.name})
+			continue
+		}
+		def := t.field(f.name)
+		if def == nil {
+			ex.fail(fieldPath, "cannot query field %q on type %q", f.name, t.name)
+			result = append(result, gqlEntry{key, nil})
+			continue
+		}
+		var sub []*gqlSelection
+		for _, g := range fields {
+			sub = append(sub, g.selections...)
+		}
+		args, err := ex.arguments(def, f)
+		var value any
+		if err == nil {
+			value, err = ex.resolve(ctx, def, parent, args)
+		}
+		if err != nil {
+			ex.fail(fieldPath, "%v", err)
+			if strings.HasSuffix(def.typ, "!") {
+				return nil, true
+			}
+			result = append(result, gqlEntry{key, nil})
+			continue
+		}
+		completed, invalid := ex.complete(ctx, def.typ, value, sub, fieldPath)
+		if invalid {
+			return nil, true
+		}
+		result = append(result, gqlEntry{key, completed})
+	}
+	return result, false
+}
+
+// resolve returns the value of the field def of parent.
+func (ex *gqlExecution) resolve(ctx context.Context, def *gqlField, parent any, args map[string]any) (any, error) {
+	if def.resolve != nil {
+		return def.resolve(ctx, parent, args)
+	}
+	props, _ := parent.(map[string]any)
+	prop := def.prop
+	if prop == "" {
+		prop = def.name
+	}
+	return props[prop], nil
+}
+
+// complete returns value as a value of typ, running the selections on
+// objects. It reports whether the value is invalid: null for a non-null
+// type, which makes the nearest nullable enclosing value null.
+func (ex *gqlExecution) complete(ctx context.Context, typ string, value any, sels []*gqlSelection, path []any) (any, bool) {
+	if inner, ok := strings.CutSuffix(typ, "!"); ok {
+		reported := len(ex.errors)
+		completed, invalid := ex.complete(ctx, inner, value, sels, path)
+		if completed == nil {
+			// Only report the null if no error below already explains it.
+			if len(ex.errors) == reported {
+				ex.fail(path, "cannot return null for non-null type %s", typ)
+			}
+			invalid = true
+		}
+		return completed, invalid
+	}
+	if value == nil {
+		return nil, false
+	}
+	if strings.HasPrefix(typ, "[") {
+		items, ok := value.([]any)
+		if !ok {
+			ex.fail(path, "expected a list for %s, got %T", typ, value)
+			return nil, false
+		}
+		list := make([]any, len(items))
+		for i, item := range items {
+			completed, invalid := ex.complete(ctx, typ[1:len(typ)-1], item, sels, append(slices.Clone(path), i))
+			if invalid {
+				return nil, false
+			}
+			list[i] = completed
+		}
+		return list, false
+	}
+	t := ex.schema.types[typ]
+	switch t.kind {
+	case "OBJECT":
+		result, invalid := ex.selectionSet(ctx, t, value, sels, path)
+		if invalid {
+			return nil, false
+		}
+		return result, false
+	case "SCALAR":
+		completed, err := serializeGQLScalar(typ, value)
+		if err != nil {
+			ex.fail(path, "%v", err)
+		}
+		return completed, false
+	}
+	return fmt.Sprint(value), false // enum
+}
+
+// collect groups the fields selected by sels on type t by response key,
+// following fragments and the @skip and @include directives.
+func (ex *gqlExecution) collect(t *gqlType, sels []*gqlSelection, keys *[]string, groups map[string][]*gqlSelection, visited map[string]bool) error {
+	for _, sel := range sels {
+		include, err := ex.included(sel.directives)
+		if err != nil {
+			return err
+		}
+		if !include {
+			continue
+		}
+		switch {
+		case sel.spread != "":
+			frag, ok := ex.doc.fragments[sel.spread]
+			if !ok {
+				return fmt.Errorf("unknown fragment %q", sel.spread)
+			}
+			if visited[sel.spread] || frag.on != t.name {
+				continue
+			}
+			visited[sel.spread] = true
+			if err := ex.collect(t, frag.selections, keys, groups, visited); err != nil {
+				return err
+			}
+		case sel.inline:
+			if sel.on != "" && sel.on != t.name {
+				continue
+			}
+			if err := ex.collect(t, sel.selections, keys, groups, visited); err != nil {
+				return err
+			}
+		default:
+			key := sel.alias
+			if key == "" {
+				key = sel.name
+			}
+			if _, ok := groups[key]; !ok {
+				*keys = append(*keys, key)
+			}
+			groups[key] = append(groups[key], sel)
+		}
+	}
+	return nil
+}
+
+// included reports whether the @skip and @include directives keep a
+// selection.
+func (ex *gqlExecution) included(directives []gqlDirective) (bool, error) {
+	for _, d := range directives {
+		if d.name != "skip" && d.name != "include" {
+			continue
+		}
+		value, ok := ex.value(d.args["if"])
+		cond, isBool := value.(bool)
+		if !ok || !isBool {
+			return false, fmt.Errorf("@%s requires a Boolean if argument", d.name)
+		}
+		if cond == (d.name == "skip") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// arguments returns the arguments of the field f, coerced to the
+// argument types of def, with defaults.
+func (ex *gqlExecution) arguments(def *gqlField, f *gqlSelection) (map[string]any, error) {
+	for name := range f.args {
+		if !slices.ContainsFunc(def.args, func(a gqlArg) bool { return a.name == name }) {
+			return nil, fmt.Errorf("unknown argument %q of field %q", name, def.name)
+		}
+	}
+	args := make(map[string]any, len(def.args))
+	for _, a := range def.args {
+		value, ok := ex.value(f.args[a.name])
+		if !ok && a.def != nil {
+			value, ok = a.def, true
+		}
+		if !ok || value == nil {
+			if strings.HasSuffix(a.typ, "!") {
+				return nil, fmt.Errorf("argument %q of type %s is required", a.name, a.typ)
+			}
+			args[a.name] = nil
+			continue
+		}
+		coerced, err := coerceGQLInput(ex.schema, a.typ, value)
+		if err != nil {
+			return nil, fmt.Errorf("argument %q: %w", a.name, err)
+		}
+		args[a.name] = coerced
+	}
+	return args, nil
+}
+
+// value returns a literal with its variables replaced, and false if it is
+// absent or an unset variable.
+func (ex *gqlExecution) value(v any) (any, bool) {
+	switch v := v.(type) {
+	case nil:
+		return nil, false
+	case gqlVariable:
+		value, ok := ex.vars[string(v)]
+		return value, ok
+	case gqlNull:
+		return nil, true
+	case gqlEnumValue:
+		return string(v), true
+	case []any:
+		list := make([]any, 0, len(v))
+		for _, item := range v {
+			value, _ := ex.value(item)
+			list = append(list, value)
+		}
+		return list, true
+	case map[string]any:
+		obj := make(map[string]any, len(v))
+		for k, item := range v {
+			if value, ok := ex.value(item); ok {
+				obj[k] = value
+			}
+		}
+		return obj, true
+	}
+	return v, true
+}
+
+// coerceGQLInput converts an argument or variable value to typ.
+func coerceGQLInput(s *gqlSchema, typ string, value any) (any, error) {
+	typ = strings.TrimSuffix(typ, "!")
+	if value == nil {
+		return nil, nil
+	}
+	if strings.HasPrefix(typ, "[") {
+		inner := typ[1 : len(typ)-1]
+		items, ok := value.([]any)
+		if !ok {
+			items = []any{value}
+		}
+		list := make([]any, len(items))
+		for i, item := range items {
+			coerced, err := coerceGQLInput(s, inner, item)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = coerced
+		}
+		return list, nil
+	}
+	switch typ {
+	case "Int":
+		switch v := value.(type) {
+		case int64:
+			return v, nil
+		case float64: // from JSON variables
+			if v == math.Trunc(v) && math.Abs(v) <= math.MaxInt32 {
+				return int64(v), nil
+			}
+		}
+	case "Float":
+		switch v := value.(type) {
+		case int64:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		}
+	case "String":
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+	case "ID":
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case int64:
+			return strconv.FormatInt(v, 10), nil
+		}
+	case "Boolean":
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+	default:
+		if t := s.types[typ]; t != nil && t.kind == "ENUM" {
+			if v, ok := value.(string); ok && slices.ContainsFunc(t.values, func(e string) bool { return e == v }) {
+				return v, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%v is not a valid %s", value, typ)
+}
+
+// serializeGQLScalar returns value as a value of the scalar typ.
+func serializeGQLScalar(typ string, value any) (any, error) {
+	switch typ {
+	case "Int":
+		switch v := value.(type) {
+		case int64, int:
+			return v, nil
+		case float64:
+			return int64(v), nil
+		}
+	case "Float":
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case int64:
+			return float64(v), nil
+		case int:
+			return float64(v), nil
+		}
+	case "Boolean":
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+	default:
+		return fmt.Sprint(value), nil
+	}
+	return nil, fmt.Errorf("%v is not a valid %s", value, typ)
+}
+
+// SDL returns the schema in the GraphQL schema definition language,
+// without the built-in scalars and introspection types.
+func (s *gqlSchema) SDL() string {
+	var b strings.Builder
+	for _, name := range s.order {
+		t := s.types[name]
+		if t.kind == "SCALAR" || strings.HasPrefix(name, "__") {
+			continue
+		}
+		writeGQLDescription(&b, "", t.doc)
+		if t.kind == "ENUM" {
+			fmt.Fprintf(&b, "enum %s {\n  %s\n}\n\n", name, strings.Join(t.values, "\n  "))
+			continue
+		}
+		fmt.Fprintf(&b, "type %s {\n", name)
+		for _, f := range t.fields {
+			if strings.HasPrefix(f.name, "__") {
+				continue // introspection entry points are implicit
+			}
+			writeGQLDescription(&b, "  ", f.doc)
+			b.WriteString("  " + f.name)
+			if len(f.args) > 0 {
+				args := make([]string, len(f.args))
+				for i, a := range f.args {
+					args[i] = a.name + ": " + a.typ
+					if a.def != nil {
+						args[i] += " = " + gqlLiteral(a.def)
+					}
+				}
+				b.WriteString("(" + strings.Join(args, ", ") + ")")
+			}
+			b.WriteString(": " + f.typ + "\n")
+		}
+		b.WriteString("}\n\n")
+	}
+	return b.String()
+}
+
+func writeGQLDescription(b *strings.Builder, indent, doc string) {
+	if doc != "" {
+		fmt.Fprintf(b, "%s\"\"\"%s\"\"\"\n", indent, doc)
+	}
+}
+
+// gqlLiteral returns a default value as a GraphQL literal.
+func gqlLiteral(v any) string {
+	switch v := v.(type) {
+	case string:
+		data, _ := json.Marshal(v)
+		return string(data)
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = gqlLiteral(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	return fmt.Sprint(v)
+}
+
+// addIntrospection adds the introspection types and the __schema and
+// __type fields, which are added to the query root by setQuery.
+func (s *gqlSchema) addIntrospection() {
+	s.add(&gqlType{kind: "ENUM", name: "__TypeKind", values: []string{
+		"SCALAR", "OBJECT", "INTERFACE", "UNION", "ENUM", "INPUT_OBJECT", "LIST", "NON_NULL",
+	}})
+	s.add(&gqlType{kind: "ENUM", name: "__DirectiveLocation", values: []string{
+		"QUERY", "MUTATION", "SUBSCRIPTION", "FIELD", "FRAGMENT_DEFINITION", "FRAGMENT_SPREAD", "INLINE_FRAGMENT",
+	}})
+	none := func(context.Context, any, map[string]any) (any, error) { return nil, nil }
+	s.object("__Schema", "",
+		&gqlField{name: "description", typ: "String", resolve: none},
+		&gqlField{name: "types", typ: "[__Type!]!", resolve: func(context.Context, any, map[string]any) (any, error) {
+			types := make([]any, len(s.order))
+			for i, name := range s.order {
+				types[i] = gqlTypeRef{schema: s, named: s.types[name]}
+			}
+			return types, nil
+		}},
+		&gqlField{name: "queryType", typ: "__Type!", resolve: func(context.Context, any, map[string]any) (any, error) {
+			return gqlTypeRef{schema: s, named: s.query}, nil
+		}},
+		&gqlField{name: "mutationType", typ: "__Type", resolve: none},
+		&gqlField{name: "subscriptionType", typ: "__Type", resolve: none},
+		&gqlField{name: "directives", typ: "[__Directive!]!", resolve: func(context.Context, any, map[string]any) (any, error) {
+			var directives []any
+			for _, name := range []string{"include", "skip"} {
+				directives = append(directives, map[string]any{
+					"name":         name,
+					"locations":    []any{"FIELD", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"},
+					"args":         []any{gqlArgRef{schema: s, arg: gqlArg{name: "if", typ: "Boolean!"}}},
+					"isRepeatable": false,
+				})
+			}
+			return directives, nil
+		}},
+	)
+	typeRef := func(parent any) gqlTypeRef { ref, _ := parent.(gqlTypeRef); return ref }
+	s.object("__Type", "",
+		&gqlField{name: "kind", typ: "__TypeKind!", resolve: func(_ context.Context, parent any, _ map[string]any) (any, error) {
+			return typeRef(parent).kind(), nil
+		}},
+		&gqlField{name: "name", typ: "String", resolve: func(_ context.Context, parent any, _ map[string]any) (any, error) {
+			if t := typeRef(parent); t.named != nil {
+				return t.named.name, nil
+			}
+			return nil, nil
+		}},
+		&gqlField{name: "description", typ: "String", resolve: func(_ context.Context, parent any, _ map[string]any) (any, error) {
+			if t := typeRef(parent); t.named != nil && t.named.doc != "" {
+				return t.named.doc, nil
+			}
+			return nil, nil
+		}},
+		&gqlField{name: "specifiedByURL", typ: "String", resolve: none},
+		&gqlField{name: "fields", typ: "[__Field!]", args: []gqlArg{{name: "includeDeprecated", typ: "Boolean", def: false}},
+			resolve: func(_ context.Context, parent any, _ map[string]any) (any, error) {
+				t := typeRef(parent)
+				if t.kind() != "OBJECT" {
+					return nil, nil
+				}
+				fields := make([]any, 0, len(t.named.fields))
+				for _, f := range t.named.fields {
+					if !strings.HasPrefix(f.name, "__") {
+						fields = append(fields, gqlFieldRef{schema: s, field: f})
+					}
+				}
+				return fields, nil
+			}},
+		&gqlField{name: "interfaces", typ: "[__Type!]", resolve: func(_ context.Context, parent any, _ map[string]any) (any, error) {
+			if typeRef(parent).kind() == "OBJECT" {
+				return []any{}, nil
+			}
+			return nil, nil
+		}},
+		&gqlField{name: "possibleTypes", typ: "[__Type!]", resolve: none},
+		&gqlField{name: "enumValues", typ: "[__EnumValue!]", args: []gqlArg{{name: "includeDeprecated", typ: "Boolean", def: false}},
+			resolve: func(_ context.Context, parent any, _ map[string]any) (any, error) {
+				t := typeRef(parent)
+				if t.kind() != "ENUM" {
+					return nil, nil
+				}
+				values := make([]any, len(t.named.values))
+				for i, v := range t.named.values {
+					values[i] = map[string]any{"name": v, "isDeprecated": false}
+				}
+				return values, nil
+			}},
+		&gqlField{name: "inputFields", typ: "[__InputValue!]", args: []gqlArg{{name: "includeDeprecated", typ: "Boolean", def: false}}, resolve: none},
+		&gqlField{name: "ofType", typ: "__Type", resolve: func(_ context.Context, parent any, _ map[string]any) (any, error) {
+			if of := typeRef(parent).ofType(); of != nil {
+				return *of, nil
+			}
+			return nil, nil
+		}},
+		&gqlField{name: "isOneOf", typ: "Boolean", resolve: none},
+	)
+	s.object("__Field", "",
+		&gqlField{name: "name", typ: "String!", resolve: func(_ context.Context, parent any, _ map[string]any) (any, error) {
+			return parent.(gqlFieldRef).field.name, nil
+		}},
+		&gqlField{name: "description", typ: "String", resolve: func(_ context.Context, parent any, _ map[string]any) (any, error) {
+			if doc := parent.(gqlFieldRef).field.doc; doc != "" {
+				return doc, nil
+			}
+			return nil, nil
+		}},
+		&gqlField{name: "args", typ: "[__InputValue!]!", args: []gqlArg{{name: "includeDeprecated", typ: "Boolean", def: false}},
+			resolve: func(_ context.Context, parent any, _ map[string]any) (any, error) {
+				f := parent.(gqlFieldRef).field
+				args := make([]any, len(f.args))
+				for i, a := range f.args {
+					args[i] = gqlArgRef{schema: s, arg: a}
+				}
+				return args, nil
+			}},
+		&gqlField{name: "type", typ: "__Type!", resolve: func(_ context.Context, parent any, _ map[string]any) (any, error) {
+			return s.typeRef(parent.(gqlFieldRef).field.typ), nil
+		}},
+		&gqlField{name: "isDeprecated", typ: "Boolean!", resolve: func(context.Context, any, map[string]any) (any, error) { return false, nil }},
+		&gqlField{name: "deprecationReason", typ: "String", resolve: none},
+	)
+	s.object("__InputValue", "",
+		&gqlField{name: "name", typ: "String!", resolve: func(_ context.Context, parent any, _ map[string]any) (any, error) {
+			return parent.(gqlArgRef).arg.name, nil
+		}},
+		&gqlField{name: "description", typ: "String", resolve: func(_ context.Context, parent any, _ map[string]any) (any, error) {
+			if doc := parent.(gqlArgRef).arg.doc; doc != "" {
+				return doc, nil
+			}
+			return nil, nil
+		}},
+		&gqlField{name: "type", typ: "__Type!", resolve: func(_ context.Context, parent any, _ map[string]any) (any, error) {
+			return s.typeRef(parent.(gqlArgRef).arg.typ), nil
+		}},
+		&gqlField{name: "defaultValue", typ: "String", resolve: func(_ context.Context, parent any, _ map[string]any) (any, error) {
+			if def := parent.(gqlArgRef).arg.def; def != nil {
+				return gqlLiteral(def), nil
+			}
+			return nil, nil
+		}},
+		&gqlField{name: "isDeprecated", typ: "Boolean!", resolve: func(context.Context, any, map[string]any) (any, error) { return false, nil }},
+		&gqlField{name: "deprecationReason", typ: "String", resolve: none},
+	)
+	s.object("__EnumValue", "",
+		&gqlField{name: "name", typ: "String!"},
+		&gqlField{name: "description", typ: "String", resolve: none},
+		&gqlField{name: "isDeprecated", typ: "Boolean!"},
+		&gqlField{name: "deprecationReason", typ: "String", resolve: none},
+	)
+	s.object("__Directive", "",
+		&gqlField{name: "name", typ: "String!"},
+		&gqlField{name: "description", typ: "String", resolve: none},
+		&gqlField{name: "locations", typ: "[__DirectiveLocation!]!"},
+		&gqlField{name: "args", typ: "[__InputValue!]!", args: []gqlArg{{name: "includeDeprecated", typ: "Boolean", def: false}}},
+		&gqlField{name: "isRepeatable", typ: "Boolean!"},
+	)
+}
+
+// setQuery makes t the query root, with the introspection fields.
+func (s *gqlSchema) setQuery(t *gqlType) {
+	t.fields = append(t.fields,
+		&gqlField{name: "__schema", typ: "__Schema!", resolve: func(context.Context, any, map[string]any) (any, error) {
+			return map[string]any{}, nil
+		}},
+		&gqlField{name: "__type", typ: "__Type", args: []gqlArg{{name: "name", typ: "String!"}},
+			resolve: func(_ context.Context, _ any, args map[string]any) (any, error) {
+				if t := s.types[args["name"].(string)]; t != nil {
+					return gqlTypeRef{schema: s, named: t}, nil
+				}
+				return nil, nil
+			}},
+	)
+	s.query = t
+}
+
+// gqlTypeRef is a type as seen by introspection: a named type, or a list
+// or non-null wrapper of another.
+type gqlTypeRef struct {
+	schema  *gqlSchema
+	named   *gqlType
+	wrapper string // LIST or NON_NULL
+	of      string // wrapped type, written as in SDL
+}
+
+// typeRef returns the introspection type of a type written as in SDL.
+func (s *gqlSchema) typeRef(typ string) gqlTypeRef {
+	if inner, ok := strings.CutSuffix(typ, "!"); ok {
+		return gqlTypeRef{schema: s, wrapper: "NON_NULL", of: inner}
+	}
+	if strings.HasPrefix(typ, "[") {
+		return gqlTypeRef{schema: s, wrapper: "LIST", of: typ[1 : len(typ)-1]}
+	}
+	return gqlTypeRef{schema: s, named: s.types[typ]}
+}
+
+func (r gqlTypeRef) kind() string {
+	if r.wrapper != "" {
+		return r.wrapper
+	}
+	return r.named.kind
+}
+
+func (r gqlTypeRef) ofType() *gqlTypeRef {
+	if r.wrapper == "" {
+		return nil
+	}
+	of := r.schema.typeRef(r.of)
+	return &of
+}
+
+// gqlFieldRef and gqlArgRef are fields and arguments as seen by
+// introspection.
+type gqlFieldRef struct {
+	schema *gqlSchema
+	field  *gqlField
+}
+
+type gqlArgRef struct {
+	schema *gqlSchema
+	arg    gqlArg
+}
+
+// Query documents.
+
+type gqlDocument struct {
+	operations []*gqlOperation
+	fragments  map[string]*gqlFragment
+}
+
+type gqlOperation struct {
+	kind       string // query, mutation or subscription
+	name       string
+	vars       []gqlVarDef
+	selections []*gqlSelection
+}
+
+type gqlVarDef struct {
+	name   string
+	typ    string
+	def    any
+	hasDef bool
+}
+
+type gqlFragment struct {
+	on         string
+	selections []*gqlSelection
+}
+
+// gqlSelection is a field, a fragment spread or an inline fragment.
+type gqlSelection struct {
+	alias, name string
+	args        map[string]any
+	directives  []gqlDirective
+	selections  []*gqlSelection
+
+	spread string // name of a spread fragment
+	inline bool   // an inline fragment, on the type on if set
+	on     string
+}
+
+type gqlDirective struct {
+	name string
+	args map[string]any
+}
+
+// Literals in documents other than numbers, strings, booleans, lists and
+// objects.
+type (
+	gqlVariable  string
+	gqlEnumValue string
+	gqlNull      struct{}
+)
+
+// gqlParser parses a query document.
+type gqlParser struct {
+	src   string
+	pos   int
+	kind  byte // kind of the current token: n(ame), i(nt), f(loat), s(tring), p(unctuator) or 0 at the end
+	text  string
+	at    int // offset of the current token
+	depth int // nesting of the selection sets, lists and objects being parsed
+}
+
+// parseGQL parses a query document.
+func parseGQL(src string) (doc *gqlDocument, err error) {
+	p := &gqlParser{src: strings.TrimPrefix(src, "\ufeff")}
+	defer func() {
+		if r := recover(); r != nil {
+			perr, ok := r.(gqlSyntaxError)
+			if !ok {
+				panic(r)
+			}
+			doc, err = nil, perr
+		}
+	}()
+	p.next()
+	doc = &gqlDocument{fragments: make(map[string]*gqlFragment)}
+	for p.kind != 0 {
+		switch {
+		case p.is('p', "{"):
+			doc.operations = append(doc.operations, &gqlOperation{kind: "query", selections: p.selectionSet()})
+		case p.is('n', "query"), p.is('n', "mutation"), p.is('n', "subscription"):
+			op := &gqlOperation{kind: p.text}
+			p.next()
+			if p.kind == 'n' {
+				op.name = p.name()
+			}
+			if p.is('p', "(") {
+				op.vars = p.varDefs()
+			}
+			p.directives()
+			op.selections = p.selectionSet()
+			doc.operations = append(doc.operations, op)
+		case p.is('n', "fragment"):
+			p.next()
+			name := p.name()
+			p.expectName("on")
+			frag := &gqlFragment{on: p.name()}
+			p.directives()
+			frag.selections = p.selectionSet()
+			doc.fragments[name] = frag
+		default:
+			p.fail("expected an operation or fragment, found %q", p.text)
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, fmt.Errorf("the document has no operation")
+	}
+	return doc, nil
+}
+
+// gqlSyntaxError is a syntax error of a query document.
+type gqlSyntaxError struct {
+	line, col int
+	msg       string
+}
+
+func (e gqlSyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at %d:%d: %s", e.line, e.col, e.msg)
+}
+
+func (p *gqlParser) fail(format string, args ...any) {
+	line := 1 + strings.Count(p.src[:p.at], "\n")
+	col := p.at - strings.LastIndexByte(p.src[:p.at], '\n')
+	panic(gqlSyntaxError{line, col, fmt.Sprintf(format, args...)})
+}
+
+func (p *gqlParser) is(kind byte, text string) bool {
+	return p.kind == kind && p.text == text
+}
+
+func (p *gqlParser) expect(punct string) {
+	if !p.is('p', punct) {
+		p.fail("expected %q, found %q", punct, p.text)
+	}
+	p.next()
+}
+
+func (p *gqlParser) expectName(name string) {
+	if !p.is('n', name) {
+		p.fail("expected %q, found %q", name, p.text)
+	}
+	p.next()
+}
+
+func (p *gqlParser) name() string {
+	if p.kind != 'n' {
+		p.fail("expected a name, found %q", p.text)
+	}
+	name := p.text
+	p.next()
+	return name
+}
+
+func (p *gqlParser) varDefs() []gqlVarDef {
+	var defs []gqlVarDef
+	p.expect("(")
+	for !p.is('p', ")") {
+		p.expect("$")
+		v := gqlVarDef{name: p.name()}
+		p.expect(":")
+		v.typ = p.typeRef()
+		if p.is('p', "=") {
+			p.next()
+			v.def, v.hasDef = p.value(true), true
+			if _, null := v.def.(gqlNull); null {
+				v.def = nil
+			}
+		}
+		p.directives()
+		defs = append(defs, v)
+	}
+	p.next()
+	return defs
+}
+
+// typeRef parses a type, returning it as written in SDL.
+func (p *gqlParser) typeRef() string {
+	var typ string
+	if p.is('p', "[") {
+		defer p.nest()()
+		p.next()
+		typ = "[" + p.typeRef() + "]"
+		p.expect("]")
+	} else {
+		typ = p.name()
+	}
+	if p.is('p', "!") {
+		p.next()
+		typ += "!"
+	}
+	return typ
+}
+
+// nest enters a selection set, list or object, failing beyond
+// maxGQLDepth; the returned function leaves it.
+func (p *gqlParser) nest() func() {
+	if p.depth++; p.depth > maxGQLDepth {
+		p.fail("nesting deeper than %d levels", maxGQLDepth)
+	}
+	return func() { p.depth-- }
+}
+
+func (p *gqlParser) selectionSet() []*gqlSelection {
+	defer p.nest()()
+	var sels []*gqlSelection
+	p.expect("{")
+	for !p.is('p', "}") {
+		sels = append(sels, p.selection())
+	}
+	p.next()
+	if len(sels) == 0 {
+		p.fail("empty selection set")
+	}
+	return sels
+}
+
+func (p *gqlParser) selection() *gqlSelection {
+	if p.is('p', "...") {
+		p.next()
+		if p.kind == 'n' && p.text != "on" {
+			return &gqlSelection{spread: p.name(), directives: p.directives()}
+		}
+		sel := &gqlSelection{inline: true}
+		if p.is('n', "on") {
+			p.next()
+			sel.on = p.name()
+		}
+		sel.directives = p.directives()
+		sel.selections = p.selectionSet()
+		return sel
+	}
+	sel := &gqlSelection{name: p.name()}
+	if p.is('p', ":") {
+		p.next()
+		sel.alias, sel.name = sel.name, p.name()
+	}
+	if p.is('p', "(") {
+		sel.args = p.arguments(false)
+	}
+	sel.directives = p.directives()
+	if p.is('p', "{") {
+		sel.selections = p.selectionSet()
+	}
+	return sel
+}
+
+func (p *gqlParser) arguments(constant bool) map[string]any {
+	args := make(map[string]any)
+	p.expect("(")
+	for !p.is('p', ")") {
+		name := p.name()
+		p.expect(":")
+		args[name] = p.value(constant)
+	}
+	p.next()
+	return args
+}
+
+func (p *gqlParser) directives() []gqlDirective {
+	var directives []gqlDirective
+	for p.is('p', "@") {
+		p.next()
+		d := gqlDirective{name: p.name()}
+		if p.is('p', "(") {
+			d.args = p.arguments(false)
+		}
+		directives = append(directives, d)
+	}
+	return directives
+}
+
+// value parses a value; variables are not allowed in constant ones.
+func (p *gqlParser) value(constant bool) any {
+	switch p.kind {
+	case 'i':
+		n, err := strconv.ParseInt(p.text, 10, 64)
+		if err != nil {
+			p.fail("invalid integer %s", p.text)
+		}
+		p.next()
+		return n
+	case 'f':
+		f, err := strconv.ParseFloat(p.text, 64)
+		if err != nil {
+			p.fail("invalid float %s", p.text)
+		}
+		p.next()
+		return f
+	case 's':
+		s := p.text
+		p.next()
+		return s
+	case 'n':
+		name := p.name()
+		switch name {
+		case "true":
+			return true
+		case "false":
+			return false
+		case "null":
+			return gqlNull{}
+		}
+		return gqlEnumValue(name)
+	}
+	switch {
+	case p.is('p', "$") && !constant:
+		p.next()
+		return gqlVariable(p.name())
+	case p.is('p', "["):
+		defer p.nest()()
+		p.next()
+		list := []any{}
+		for !p.is('p', "]") {
+			list = append(list, p.value(constant))
+		}
+		p.next()
+		return list
+	case p.is('p', "{"):
+		defer p.nest()()
+		p.next()
+		obj := make(map[string]any)
+		for !p.is('p', "}") {
+			name := p.name()
+			p.expect(":")
+			obj[name] = p.value(constant)
+		}
+		p.next()
+		return obj
+	}
+	p.fail("expected a value, found %q", p.text)
+	return nil
+}
+
+// next reads the next token.
+func (p *gqlParser) next() {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+			continue
+		}
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' && c != ',' {
+			break
+		}
+		p.pos++
+	}
+	p.at = p.pos
+	if p.pos >= len(p.src) {
+		p.kind, p.text = 0, "<end>"
+		return
+	}
+	c := p.src[p.pos]
+	switch {
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		end := p.pos + 1
+		for end < len(p.src) && isGQLNameByte(p.src[end]) {
+			end++
+		}
+		p.kind, p.text, p.pos = 'n', p.src[p.pos:end], end
+	case c == '-' || c >= '0' && c <= '9':
+		end := p.pos + 1
+		float := false
+		for end < len(p.src) {
+			d := p.src[end]
+			if d == '.' || d == 'e' || d == 'E' || (d == '+' || d == '-') && (p.src[end-1] == 'e' || p.src[end-1] == 'E') {
+				float = true
+			} else if d < '0' || d > '9' {
+				break
+			}
+			end++
+		}
+		p.kind, p.text, p.pos = 'i', p.src[p.pos:end], end
+		if float {
+			p.kind = 'f'
+		}
+	case c == '"':
+		p.kind, p.text = 's', p.stringValue()
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.kind, p.text, p.pos = 'p', "...", p.pos+3
+	case strings.IndexByte("!$&()=:@[]{}|", c) >= 0:
+		p.kind, p.text, p.pos = 'p', string(c), p.pos+1
+	default:
+		r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.fail("unexpected character %q", r)
+	}
+}
+
+func isGQLNameByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// stringValue reads a string or block string at the current position.
+func (p *gqlParser) stringValue() string {
+	if strings.HasPrefix(p.src[p.pos:], `"""`) {
+		end := strings.Index(p.src[p.pos+3:], `"""`)
+		for end >= 0 && p.src[p.pos+3+end-1] == '\\' {
+			next := strings.Index(p.src[p.pos+3+end+3:], `"""`)
+			if next < 0 {
+				end = -1
+				break
+			}
+			end += 3 + next
+		}
+		if end < 0 {
+			p.fail("unterminated block string")
+		}
+		s := strings.ReplaceAll(p.src[p.pos+3:p.pos+3+end], `\"""`, `"""`)
+		p.pos += 3 + end + 3
+		return strings.TrimSpace(s)
+	}
+	var b strings.Builder
+	for i := p.pos + 1; i < len(p.src); i++ {
+		c := p.src[i]
+		switch c {
+		case '"':
+			p.pos = i + 1
+			return b.String()
+		case '\n':
+			p.fail("unterminated string")
+		case '\\':
+			if i+1 >= len(p.src) {
+				p.fail("unterminated string")
+			}
+			i++
+			switch e := p.src[i]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'u':
+				if i+5 > len(p.src) {
+					p.fail("invalid unicode escape")
+				}
+				n, err := strconv.ParseUint(p.src[i+1:i+5], 16, 32)
+				if err != nil {
+					p.fail("invalid unicode escape")
+				}
+				b.WriteRune(rune(n))
+				i += 4
+			default:
+				b.WriteByte(e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	p.fail("unterminated string")
+	return ""
+}
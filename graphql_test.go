@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testGQLSchema returns a schema of items, each with first copies of
+// itself as children, so queries can nest and widen as far as they like.
+func testGQLSchema() *gqlSchema {
+	s := newGQLSchema()
+	s.add(&gqlType{kind: "ENUM", name: "Color", values: []string{"RED", "BLUE"}})
+	s.object("Item", "An item.",
+		&gqlField{name: "name", typ: "String!"},
+		&gqlField{name: "size", typ: "Int"},
+		&gqlField{name: "color", typ: "Color"},
+		&gqlField{name: "children", typ: "[Item!]!", args: []gqlArg{{name: "first", typ: "Int", def: int64(2)}},
+			resolve: func(_ context.Context, parent any, args map[string]any) (any, error) {
+				list := make([]any, args["first"].(int64))
+				for i := range list {
+					list[i] = parent
+				}
+				return list, nil
+			}},
+	)
+	query := s.object("Query", "The root.",
+		&gqlField{name: "item", typ: "Item", args: []gqlArg{{name: "name", typ: "String!"}},
+			resolve: func(_ context.Context, _ any, args map[string]any) (any, error) {
+				if args["name"] == "none" {
+					return nil, nil
+				}
+				return map[string]any{"name": args["name"], "size": int64(3), "color": "RED"}, nil
+			}},
+		&gqlField{name: "count", typ: "Int!", resolve: func(context.Context, any, map[string]any) (any, error) {
+			return int64(7), nil
+		}},
+	)
+	s.setQuery(query)
+	return s
+}
+
+func TestParseGQL(t *testing.T) {
+	doc, err := parseGQL(`
+		# a comment
+		query Q($n: String! = "a", $first: Int) { item(name: $n) { ...F children(first: $first) { name } } }
+		fragment F on Item { name size }
+		{ count }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.operations) != 2 || doc.operations[0].name != "Q" || len(doc.operations[0].vars) != 2 {
+		t.Errorf("operations = %+v", doc.operations)
+	}
+	if f := doc.fragments["F"]; f == nil || f.on != "Item" || len(f.selections) != 2 {
+		t.Errorf("fragment F = %+v", f)
+	}
+
+	for _, src := range []string{
+		``,
+		`{`,
+		`{ }`,
+		`{ item(name: "a" }`,
+		`{ item(name: "unterminated) { name } }`,
+		`query ($n: ) { count }`,
+		`fragment F on Item { name }`,
+		`{ count } garbage`,
+		strings.Repeat("{ item(name: \"a\") ", maxGQLDepth+1) + strings.Repeat("}", maxGQLDepth+1),
+	} {
+		if _, err := parseGQL(src); err == nil {
+			t.Errorf("parseGQL(%q) succeeded", src)
+		}
+	}
+}
+
+func TestGQLExecute(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		operation string
+		vars      map[string]any
+		want      string
+	}{
+		{
+			name:  "fields and aliases",
+			query: `{ count a: item(name: "a") { name size color } b: item(name: "none") { name } }`,
+			want:  `{"data":{"count":7,"a":{"name":"a","size":3,"color":"RED"},"b":null}}`,
+		},
+		{
+			name:  "fragments",
+			query: `{ item(name: "a") { ...F ... on Item { size } ... { color } } } fragment F on Item { name __typename }`,
+			want:  `{"data":{"item":{"name":"a","__typename":"Item","size":3,"color":"RED"}}}`,
+		},
+		{
+			name:  "fragments spreading each other",
+			query: `{ item(name: "a") { ...A } } fragment A on Item { name ...B } fragment B on Item { size ...A }`,
+			want:  `{"data":{"item":{"name":"a","size":3}}}`,
+		},
+		{
+			name:  "variables and defaults",
+			query: `query ($n: String!, $first: Int = 1) { item(name: $n) { children(first: $first) { name } } }`,
+			vars:  map[string]any{"n": "v"},
+			want:  `{"data":{"item":{"children":[{"name":"v"}]}}}`,
+		},
+		{
+			name:  "argument default",
+			query: `{ item(name: "a") { children { name } } }`,
+			want:  `{"data":{"item":{"children":[{"name":"a"},{"name":"a"}]}}}`,
+		},
+		{
+			name:  "skip and include",
+			query: `query ($yes: Boolean!) { count @skip(if: $yes) item(name: "a") @include(if: $yes) { name } }`,
+			vars:  map[string]any{"yes": true},
+			want:  `{"data":{"item":{"name":"a"}}}`,
+		},
+		{
+			name:      "operation name",
+			query:     `query A { count } query B { item(name: "b") { name } }`,
+			operation: "B",
+			want:      `{"data":{"item":{"name":"b"}}}`,
+		},
+		{
+			name:  "operation name required",
+			query: `query A { count } query B { count }`,
+			want:  `{"data":null,"errors":[{"message":"operationName is required for a document of several operations"}]}`,
+		},
+		{
+			name:  "missing variable",
+			query: `query ($n: String!) { item(name: $n) { name } }`,
+			want:  `{"data":null,"errors":[{"message":"variable $n of type String! is required"}]}`,
+		},
+		{
+			name:  "variable of the wrong type",
+			query: `query ($first: Int) { item(name: "a") { children(first: $first) { name } } }`,
+			vars:  map[string]any{"first": "two"},
+			want:  `{"data":null,"errors":[{"message":"variable $first: two is not a valid Int"}]}`,
+		},
+		{
+			name:  "mutation",
+			query: `mutation { count }`,
+			want:  `{"data":null,"errors":[{"message":"mutation operations are not supported"}]}`,
+		},
+		{
+			name:  "syntax error",
+			query: `{ item(name: "a") { name }`,
+			want:  `{"data":null,"errors":[{"message":"syntax error at 1:27: expected a name, found \"\u003cend\u003e\""}]}`,
+		},
+		{
+			name:  "object field without subfields",
+			query: `{ count item(name: "a") }`,
+			want:  `{"data":null,"errors":[{"message":"field \"item\" of type Item must have a selection of subfields"}]}`,
+		},
+		{
+			name:  "scalar field with subfields",
+			query: `{ count { value } }`,
+			want:  `{"data":null,"errors":[{"message":"field \"count\" of type Int! must not have a selection of subfields"}]}`,
+		},
+		{
+			name:  "missing required argument",
+			query: `{ count item { name } }`,
+			want:  `{"data":null,"errors":[{"message":"argument \"name\" of type String! of field \"item\" is required"}]}`,
+		},
+		{
+			name:  "null required argument",
+			query: `{ item(name: null) { name } }`,
+			want:  `{"data":null,"errors":[{"message":"argument \"name\" of type String! of field \"item\" is required"}]}`,
+		},
+		{
+			name:  "unknown field and argument",
+			query: `{ item(name: "a", color: RED) { name weight } }`,
+			want:  `{"data":null,"errors":[{"message":"unknown argument \"color\" of field \"item\""},{"message":"cannot query field \"weight\" on type \"Item\""}]}`,
+		},
+		{
+			name:  "unknown fragment and undefined variable",
+			query: `{ item(name: $n) { ...F } }`,
+			want:  `{"data":null,"errors":[{"message":"variable $n is not defined"},{"message":"unknown fragment \"F\""}]}`,
+		},
+		{
+			name:  "invalid fragment",
+			query: `{ count } fragment F on Item { name { first } }`,
+			want:  `{"data":null,"errors":[{"message":"field \"name\" of type String! must not have a selection of subfields"}]}`,
+		},
+		{
+			name:  "fragment on a scalar",
+			query: `{ item(name: "a") { ... on Int { name } } }`,
+			want:  `{"data":null,"errors":[{"message":"inline fragment on \"Int\", which is not an object type"}]}`,
+		},
+		{
+			name:  "introspection",
+			query: `{ __type(name: "Color") { kind enumValues { name } } }`,
+			want:  `{"data":{"__type":{"kind":"ENUM","enumValues":[{"name":"RED"},{"name":"BLUE"}]}}}`,
+		},
+	}
+	s := testGQLSchema()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := s.Execute(context.Background(), tt.query, tt.operation, tt.vars)
+			got, err := json.Marshal(resp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Execute(%q)\n got %s\nwant %s", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGQLLimits(t *testing.T) {
+	s := testGQLSchema()
+	// Fragments spreading each other within their fields nest without
+	// bound, however shallow the document.
+	resp := s.Execute(context.Background(),
+		`{ item(name: "a") { ...A } } fragment A on Item { children(first: 1) { ...B } } fragment B on Item { children(first: 1) { ...A } }`,
+		"", nil)
+	if len(resp.Errors) != 1 || !strings.Contains(resp.Errors[0].Message, "nested deeper than 32 fields") {
+		t.Errorf("deep query: %+v", resp)
+	}
+
+	// Ten levels of ten children complete 10^10 fields.
+	query := `{ item(name: "a") ` + strings.Repeat(`{ children(first: 10) `, 10) + `{ name }` + strings.Repeat(` }`, 11)
+	resp = s.Execute(context.Background(), query, "", nil)
+	if len(resp.Errors) != 1 || !strings.Contains(resp.Errors[0].Message, "more than 50000 fields") {
+		t.Errorf("wide query: %+v", resp)
+	}
+}
+
+func TestGraphQLHandler(t *testing.T) {
+	srv := httptest.NewServer(graphQLHandler(testGQLSchema()))
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "POST",
+			method:     http.MethodPost,
+			target:     "/graphql",
+			body:       `{"query": "query ($n: String!) { item(name: $n) { name } }", "variables": {"n": "p"}}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"data":{"item":{"name":"p"}}}`,
+		},
+		{
+			name:       "GET",
+			method:     http.MethodGet,
+			target:     `/graphql?query=query+($n:+String!)+{+item(name:+$n)+{+name+}+}&variables={"n":"g"}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"data":{"item":{"name":"g"}}}`,
+		},
+		{
+			name:       "body too large",
+			method:     http.MethodPost,
+			target:     "/graphql",
+			body:       `{"query": "{ count }", "padding": "` + strings.Repeat("x", maxGraphQLBody) + `"}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "invalid JSON",
+			method:     http.MethodPost,
+			target:     "/graphql",
+			body:       `{"query": `,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "missing query",
+			method:     http.MethodPost,
+			target:     "/graphql",
+			body:       `{}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "method",
+			method:     http.MethodPut,
+			target:     "/graphql",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, srv.URL+tt.target, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantBody != "" {
+				var got json.RawMessage
+				if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != tt.wantBody {
+					t.Errorf("body = %s, want %s", got, tt.wantBody)
+				}
+			}
+		})
+	}
+
+	resp, err := http.Get(srv.URL + "/graphql/schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	sdl, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(sdl), "item(name: String!): Item") {
+		t.Errorf("schema does not declare the item field:\n%s", sdl)
+	}
+}
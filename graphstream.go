@@ -0,0 +1,457 @@
+package main
+
+import (
+	"go/types"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// GraphNode is a node of the collected graph as it would be loaded: its
+// key, labels and properties, named as in Neo4j. The key is the value of
+// the property the loader merges on: id for functions and types,
+// import_path for packages, path for files and modules.
+type GraphNode struct {
+	Key    string
+	Labels []string // primary label first
+	Props  map[string]any
+}
+
+// GraphEdge is a relationship of the collected graph. Start and End are
+// node keys; their labels tell apart a package from the module of the
+// same path.
+type GraphEdge struct {
+	Type       string
+	Start      string
+	StartLabel string
+	End        string
+	EndLabel   string
+	Props      map[string]any
+}
+
+// WalkGraph calls node for every node of the collected graph, then edge
+// for every relationship, in a stable order, and stops at the first
+// error. It covers the code structure: modules, packages, files, types,
+// functions, calls and implementations. The rest of what a load writes,
+// such as routes, SQL or layers, is left out.
+func (c *Collector) WalkGraph(node func(GraphNode) error, edge func(GraphEdge) error) error {
+	for _, path := range sortedKeys(c.Modules) {
+		if err := node(moduleGraphNode(c.Modules[path])); err != nil {
+			return err
+		}
+	}
+	for _, path := range sortedKeys(c.Packages) {
+		if err := node(packageGraphNode(c.Packages[path])); err != nil {
+			return err
+		}
+	}
+	for _, path := range sortedKeys(c.Files) {
+		if err := node(fileGraphNode(c.Files[path])); err != nil {
+			return err
+		}
+	}
+	for _, key := range sortedKeys(c.Structs) {
+		if err := node(structGraphNode(key, c.Structs[key])); err != nil {
+			return err
+		}
+	}
+	for _, key := range sortedKeys(c.Interfaces) {
+		if err := node(interfaceGraphNode(key, c.Interfaces[key])); err != nil {
+			return err
+		}
+	}
+	for _, key := range sortedKeys(c.NamedTypes) {
+		if err := node(namedTypeGraphNode(key, c.NamedTypes[key])); err != nil {
+			return err
+		}
+	}
+	for _, key := range sortedKeys(c.Aliases) {
+		if err := node(aliasGraphNode(key, c.Aliases[key])); err != nil {
+			return err
+		}
+	}
+	for _, name := range sortedKeys(c.Funcs) {
+		if err := node(funcGraphNode(c.Funcs[name])); err != nil {
+			return err
+		}
+	}
+	for _, name := range sortedKeys(c.ExternalFuncs) {
+		if err := node(externalFuncGraphNode(c.ExternalFuncs[name])); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range c.Requires {
+		if err := edge(requireGraphEdge(r)); err != nil {
+			return err
+		}
+	}
+	for _, path := range sortedKeys(c.Packages) {
+		p := c.Packages[path]
+		if _, ok := c.Modules[p.Module]; ok {
+			if err := edge(GraphEdge{Type: "IN_MODULE", Start: path, StartLabel: "GoPackage", End: p.Module, EndLabel: "GoModule"}); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range sortedKeys(c.ExternalFuncs) {
+		fn := c.ExternalFuncs[name]
+		if _, ok := c.Modules[fn.Module]; ok {
+			if err := edge(GraphEdge{Type: "IN_MODULE", Start: funcID(name), StartLabel: "GoFunc", End: fn.Module, EndLabel: "GoModule"}); err != nil {
+				return err
+			}
+		}
+	}
+	for _, path := range sortedKeys(c.Files) {
+		f := c.Files[path]
+		if _, ok := c.Packages[f.Package]; ok {
+			if err := edge(GraphEdge{Type: "CONTAINS", Start: f.Package, StartLabel: "GoPackage", End: path, EndLabel: "GoFile"}); err != nil {
+				return err
+			}
+		}
+	}
+	inPackage := func(key, label, pkg string) error {
+		if _, ok := c.Packages[pkg]; !ok {
+			return nil
+		}
+		return edge(GraphEdge{Type: "IN_PACKAGE", Start: key, StartLabel: label, End: pkg, EndLabel: "GoPackage"})
+	}
+	for _, key := range sortedKeys(c.Structs) {
+		if err := inPackage(typeID(key), "GoStruct", c.Structs[key].Package); err != nil {
+			return err
+		}
+	}
+	for _, key := range sortedKeys(c.Interfaces) {
+		if err := inPackage(typeID(key), "GoInterface", c.Interfaces[key].Package); err != nil {
+			return err
+		}
+	}
+	for _, key := range sortedKeys(c.NamedTypes) {
+		if err := inPackage(typeID(key), "GoNamedType", c.NamedTypes[key].Package); err != nil {
+			return err
+		}
+	}
+	for _, key := range sortedKeys(c.Aliases) {
+		a := c.Aliases[key]
+		if err := inPackage(typeID(key), "GoAlias", a.Package); err != nil {
+			return err
+		}
+		if label := c.typeLabel(a.Target); label != "" {
+			if err := edge(GraphEdge{Type: "ALIAS_OF", Start: typeID(key), StartLabel: "GoAlias", End: typeID(a.Target), EndLabel: label}); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range sortedKeys(c.Funcs) {
+		for _, e := range c.funcGraphEdges(c.Funcs[name]) {
+			if err := edge(e); err != nil {
+				return err
+			}
+		}
+	}
+	for _, call := range c.Calls {
+		if err := edge(callGraphEdge(call)); err != nil {
+			return err
+		}
+	}
+	for _, impl := range c.Implements {
+		label := c.typeLabel(impl.Struct)
+		if label == "" {
+			continue
+		}
+		if err := edge(implementsGraphEdge(impl, label)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamPackage sends to Stream what CollectTypes found in pkg: the
+// package, its files, types and functions, and the relationships between
+// them and to the packages visited before it.
+func (c *Collector) streamPackage(pkg *packages.Package) {
+	if c.Stream == nil {
+		return
+	}
+	c.Stream.Node(packageGraphNode(c.Packages[pkg.PkgPath]))
+	for _, file := range pkg.Syntax {
+		tf := pkg.Fset.File(file.Pos())
+		if tf == nil {
+			continue
+		}
+		f := c.Files[c.relPath(tf.Name())]
+		c.Stream.Node(fileGraphNode(f))
+		c.Stream.Edge(GraphEdge{Type: "CONTAINS", Start: pkg.PkgPath, StartLabel: "GoPackage", End: f.Path, EndLabel: "GoFile"})
+	}
+	inPackage := func(key, label string) {
+		c.Stream.Edge(GraphEdge{Type: "IN_PACKAGE", Start: typeID(key), StartLabel: label, End: pkg.PkgPath, EndLabel: "GoPackage"})
+	}
+	var funcs []*FuncNode
+	scope := pkg.Types.Scope()
+	for _, name := range scope.Names() {
+		key := pkg.PkgPath + "." + name
+		switch {
+		case c.Structs[key] != nil:
+			c.Stream.Node(structGraphNode(key, c.Structs[key]))
+			inPackage(key, "GoStruct")
+		case c.Interfaces[key] != nil:
+			c.Stream.Node(interfaceGraphNode(key, c.Interfaces[key]))
+			inPackage(key, "GoInterface")
+		case c.NamedTypes[key] != nil:
+			c.Stream.Node(namedTypeGraphNode(key, c.NamedTypes[key]))
+			inPackage(key, "GoNamedType")
+		case c.Aliases[key] != nil:
+			a := c.Aliases[key]
+			c.Stream.Node(aliasGraphNode(key, a))
+			inPackage(key, "GoAlias")
+			if label := c.typeLabel(a.Target); label != "" {
+				c.Stream.Edge(GraphEdge{Type: "ALIAS_OF", Start: typeID(key), StartLabel: "GoAlias", End: typeID(a.Target), EndLabel: label})
+			}
+		case c.Funcs[key] != nil:
+			funcs = append(funcs, c.Funcs[key])
+		}
+		if tn, ok := scope.Lookup(name).(*types.TypeName); ok {
+			if named, ok := tn.Type().(*types.Named); ok {
+				for i := 0; i < named.NumMethods(); i++ {
+					m := named.Method(i)
+					_, ptr := receiverNamed(m.Type().(*types.Signature).Recv().Type())
+					if fn := c.Funcs[c.methodFullName(pkg.PkgPath, name, ptr, m.Name())]; fn != nil {
+						funcs = append(funcs, fn)
+					}
+				}
+			}
+		}
+	}
+	for _, fn := range funcs {
+		c.streamFunc(fn)
+	}
+}
+
+// streamFunc sends a project function and its relationships to Stream.
+func (c *Collector) streamFunc(fn *FuncNode) {
+	if c.Stream == nil {
+		return
+	}
+	c.Stream.Node(funcGraphNode(fn))
+	for _, e := range c.funcGraphEdges(fn) {
+		c.Stream.Edge(e)
+	}
+}
+
+// streamModules sends to Stream what CollectModules found: the modules,
+// their requirements and the packages and dependency functions in them.
+func (c *Collector) streamModules() {
+	if c.Stream == nil {
+		return
+	}
+	for _, path := range sortedKeys(c.Modules) {
+		c.Stream.Node(moduleGraphNode(c.Modules[path]))
+	}
+	for _, r := range c.Requires {
+		c.Stream.Edge(requireGraphEdge(r))
+	}
+	for _, path := range sortedKeys(c.Packages) {
+		if p := c.Packages[path]; c.Modules[p.Module] != nil {
+			c.Stream.Edge(GraphEdge{Type: "IN_MODULE", Start: path, StartLabel: "GoPackage", End: p.Module, EndLabel: "GoModule"})
+		}
+	}
+	for _, name := range sortedKeys(c.ExternalFuncs) {
+		if fn := c.ExternalFuncs[name]; c.Modules[fn.Module] != nil {
+			c.Stream.Edge(GraphEdge{Type: "IN_MODULE", Start: funcID(name), StartLabel: "GoFunc", End: fn.Module, EndLabel: "GoModule"})
+		}
+	}
+}
+
+// moduleGraphNode returns the node of a module.
+func moduleGraphNode(m *ModuleNode) GraphNode {
+	return GraphNode{Key: m.Path, Labels: []string{"GoModule"}, Props: graphProps(map[string]any{
+		"path": m.Path, "version": nullIfEmpty(m.Version), "main": m.Main, "indirect": m.Indirect,
+		"replace": nullIfEmpty(m.Replace), "go_version": nullIfEmpty(m.GoVersion), "sum": nullIfEmpty(m.Sum),
+	})}
+}
+
+// packageGraphNode returns the node of a project package.
+func packageGraphNode(p *PackageNode) GraphNode {
+	labels := []string{"GoPackage"}
+	if len(p.Hotspot) > 0 {
+		labels = append(labels, "Hotspot")
+	}
+	return GraphNode{Key: p.ImportPath, Labels: labels, Props: graphProps(map[string]any{
+		"import_path": p.ImportPath, "name": p.Name, "dir": p.Dir, "module": p.Module,
+		"prod_reachable": p.ProdReachable, "generated": p.Generated, "layer": nullIfEmpty(p.Layer),
+		"file_count": p.Files, "loc": p.LOC, "statements": p.Statements,
+		"build_config": nullIfNone(p.BuildConfigs), "analysis_errors": nullIfNone(p.Errors),
+		"init_order": p.InitOrder, "init_funcs": p.InitFuncs, "cycle_id": nullIfNoID(p.CycleID),
+		"afferent_coupling": p.Afferent, "efferent_coupling": p.Efferent, "instability": p.Instability,
+		"abstractness": p.Abstractness, "distance": p.Distance,
+		"hotspot_reasons": nullIfNone(p.Hotspot), "hotspot_score": nullIfNoScore(p.HotspotScore),
+	})}
+}
+
+// fileGraphNode returns the node of a source file.
+func fileGraphNode(f *FileNode) GraphNode {
+	return GraphNode{Key: f.Path, Labels: []string{"GoFile"}, Props: graphProps(map[string]any{
+		"path": f.Path, "package": f.Package, "loc": f.LOC, "generated": f.Generated,
+		"build_constraint": nullIfEmpty(f.BuildConstraint), "build_tags": nullIfNone(f.BuildTags),
+		"owners": nullIfNone(f.Owners), "last_author": nullIfEmpty(f.LastAuthor),
+		"last_modified": nullIfZero(f.LastModified), "build_config": nullIfNone(f.BuildConfigs),
+	})}
+}
+
+// structGraphNode returns the node of the struct with the given key.
+func structGraphNode(key string, s *StructNode) GraphNode {
+	return GraphNode{Key: typeID(key), Labels: []string{"GoStruct"}, Props: graphProps(map[string]any{
+		"id": typeID(key), "key": key, "name": s.Name, "package": s.Package, "file": s.File, "line": s.Line,
+		"exported": s.Exported, "field_count": s.FieldCount, "deprecated": s.Deprecated != "",
+		"deprecation": nullIfEmpty(s.Deprecated), "generated": s.Generated, "build_config": nullIfNone(s.BuildConfigs),
+	})}
+}
+
+// interfaceGraphNode returns the node of the interface with the given key.
+func interfaceGraphNode(key string, i *InterfaceNode) GraphNode {
+	return GraphNode{Key: typeID(key), Labels: []string{"GoInterface"}, Props: graphProps(map[string]any{
+		"id": typeID(key), "key": key, "name": i.Name, "package": i.Package, "file": i.File, "line": i.Line,
+		"exported": i.Exported, "method_count": i.Methods, "method_set": i.MethodSet, "deprecated": i.Deprecated != "",
+		"deprecation": nullIfEmpty(i.Deprecated), "generated": i.Generated, "build_config": nullIfNone(i.BuildConfigs),
+	})}
+}
+
+// namedTypeGraphNode returns the node of the named type with the given key.
+func namedTypeGraphNode(key string, t *NamedTypeNode) GraphNode {
+	return GraphNode{Key: typeID(key), Labels: []string{"GoNamedType"}, Props: graphProps(map[string]any{
+		"id": typeID(key), "key": key, "name": t.Name, "package": t.Package, "file": t.File, "line": t.Line,
+		"exported": t.Exported, "type_kind": t.Kind, "underlying": t.Underlying, "deprecated": t.Deprecated != "",
+		"deprecation": nullIfEmpty(t.Deprecated), "generated": t.Generated, "build_config": nullIfNone(t.BuildConfigs),
+	})}
+}
+
+// aliasGraphNode returns the node of the alias with the given key.
+func aliasGraphNode(key string, a *AliasNode) GraphNode {
+	return GraphNode{Key: typeID(key), Labels: []string{"GoAlias"}, Props: graphProps(map[string]any{
+		"id": typeID(key), "key": key, "name": a.Name, "package": a.Package, "file": a.File, "line": a.Line,
+		"exported": a.Exported, "target": a.Target, "target_type": a.TargetType, "deprecated": a.Deprecated != "",
+		"deprecation": nullIfEmpty(a.Deprecated), "generated": a.Generated, "build_config": nullIfNone(a.BuildConfigs),
+	})}
+}
+
+// funcGraphNode returns the node of a project function.
+func funcGraphNode(fn *FuncNode) GraphNode {
+	labels := []string{"GoFunc"}
+	if fn.Synthetic != "" {
+		labels = append(labels, "Synthetic")
+	}
+	if fn.EntryPoint != "" {
+		labels = append(labels, "EntryPoint")
+	}
+	if fn.Unreachable {
+		labels = append(labels, "Unreachable")
+	}
+	if len(fn.Hotspot) > 0 {
+		labels = append(labels, "Hotspot")
+	}
+	return GraphNode{Key: funcID(fn.FullName), Labels: labels, Props: graphProps(map[string]any{
+		"id": funcID(fn.FullName), "full_name": fn.FullName, "name": fn.Name, "package": fn.Package,
+		"file": fn.File, "line": fn.Line, "end_line": fn.EndLine, "exported": fn.Exported,
+		"receiver": fn.Receiver, "receiver_ptr": fn.ReceiverPtr, "is_method": fn.IsMethod, "signature": fn.Signature,
+		"loc": fn.LOC, "statements": fn.Statements, "complexity": fn.Complexity, "prod_reachable": fn.ProdReachable,
+		"doc": nullIfEmpty(fn.Doc), "source": nullIfEmpty(fn.Source), "source_truncated": fn.SourceTruncated,
+		"deprecated": fn.Deprecated != "", "deprecation": nullIfEmpty(fn.Deprecated),
+		"generated": fn.Generated, "build_config": nullIfNone(fn.BuildConfigs),
+		"owners": nullIfNone(fn.Owners), "last_author": nullIfEmpty(fn.LastAuthor),
+		"last_modified": nullIfZero(fn.LastModified), "covered_pct": coveredPct(fn),
+		"synthetic": nullIfEmpty(fn.Synthetic), "entry_point": nullIfEmpty(fn.EntryPoint),
+		"returns_error": fn.ReturnsError, "takes_context": fn.TakesContext,
+		"recursive": fn.Recursive, "scc_id": nullIfNoID(fn.SCCID),
+		"hotspot_reasons": nullIfNone(fn.Hotspot), "hotspot_score": nullIfNoScore(fn.HotspotScore),
+	})}
+}
+
+// externalFuncGraphNode returns the node of a dependency function.
+func externalFuncGraphNode(fn *ExternalFuncNode) GraphNode {
+	return GraphNode{Key: funcID(fn.FullName), Labels: []string{"GoFunc", "External"}, Props: graphProps(map[string]any{
+		"id": funcID(fn.FullName), "full_name": fn.FullName, "name": fn.Name, "package": fn.Package,
+		"module": fn.Module, "version": nullIfEmpty(fn.Version),
+		"deprecated": fn.Deprecated != "", "deprecation": nullIfEmpty(fn.Deprecated),
+		"returns_error": fn.ReturnsError, "takes_context": fn.TakesContext, "build_config": nullIfNone(fn.BuildConfigs),
+	})}
+}
+
+// requireGraphEdge returns the REQUIRES relationship of a requirement.
+func requireGraphEdge(r RequireEdge) GraphEdge {
+	return GraphEdge{Type: "REQUIRES", Start: r.From, StartLabel: "GoModule", End: r.To, EndLabel: "GoModule",
+		Props: map[string]any{"version": r.Version, "indirect": r.Indirect}}
+}
+
+// callGraphEdge returns the relationship of a call, ACCURATE_CALLS or
+// CALLS_EXTERNAL.
+func callGraphEdge(call CallEdge) GraphEdge {
+	typ := "ACCURATE_CALLS"
+	if call.External {
+		typ = "CALLS_EXTERNAL"
+	}
+	props := map[string]any{"is_dynamic": call.IsDynamic, "call_count": call.Count, "build_config": nullIfNone(call.BuildConfigs)}
+	if len(call.Sites) > 0 {
+		sites := make([]string, len(call.Sites))
+		for i, s := range call.Sites {
+			sites[i] = s.String()
+		}
+		props["site"], props["sites"] = sites[0], sites
+	}
+	return GraphEdge{Type: typ, Start: funcID(call.CallerFullName), StartLabel: "GoFunc",
+		End: funcID(call.CalleeFullName), EndLabel: "GoFunc", Props: graphProps(props)}
+}
+
+// implementsGraphEdge returns the IMPLEMENTS relationship of impl, whose
+// implementing type has the given label.
+func implementsGraphEdge(impl ImplementsEdge, label string) GraphEdge {
+	return GraphEdge{Type: "IMPLEMENTS", Start: typeID(impl.Struct), StartLabel: label,
+		End: typeID(impl.Interface), EndLabel: "GoInterface", Props: graphProps(map[string]any{
+			"receiver": impl.Receiver, "methods": impl.Methods, "method_funcs": impl.MethodFuncs,
+			"build_config": nullIfNone(impl.BuildConfigs),
+		})}
+}
+
+// funcGraphEdges returns the relationships of a project function to its
+// package, file and receiver type, those present in the graph.
+func (c *Collector) funcGraphEdges(fn *FuncNode) []GraphEdge {
+	var edges []GraphEdge
+	if _, ok := c.Packages[fn.Package]; ok {
+		edges = append(edges, GraphEdge{Type: "IN_PACKAGE", Start: funcID(fn.FullName), StartLabel: "GoFunc", End: fn.Package, EndLabel: "GoPackage"})
+	}
+	if _, ok := c.Files[fn.File]; ok {
+		edges = append(edges, GraphEdge{Type: "DEFINED_IN", Start: funcID(fn.FullName), StartLabel: "GoFunc", End: fn.File, EndLabel: "GoFile"})
+	}
+	if fn.IsMethod && fn.Receiver != "" {
+		recv := fn.Package + "." + fn.Receiver
+		if label := c.typeLabel(recv); label == "GoStruct" || label == "GoNamedType" {
+			edges = append(edges, GraphEdge{Type: "HAS_METHOD", Start: typeID(recv), StartLabel: label, End: funcID(fn.FullName), EndLabel: "GoFunc"})
+		}
+	}
+	return edges
+}
+
+// typeLabel returns the label of the type node with the given key, or ""
+// if the type is not part of the graph.
+func (c *Collector) typeLabel(key string) string {
+	switch {
+	case c.Structs[key] != nil:
+		return "GoStruct"
+	case c.Interfaces[key] != nil:
+		return "GoInterface"
+	case c.NamedTypes[key] != nil:
+		return "GoNamedType"
+	case c.Aliases[key] != nil:
+		return "GoAlias"
+	}
+	return ""
+}
+
+// graphProps drops the null properties of props, which the loader would
+// not store, and returns it.
+func graphProps(props map[string]any) map[string]any {
+	for k, v := range props {
+		if v == nil {
+			delete(props, k)
+		}
+	}
+	return props
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/types"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// grpcPackage is the import path of grpc-go, which declares ServiceDesc.
+const grpcPackage = "google.golang.org/grpc"
+
+// FullMethod returns the gRPC method name of m in service, as sent on the
+// wire and seen by interceptors: /orders.v1.OrderService/GetOrder.
+func (m GRPCMethod) FullMethod(service string) string {
+	return "/" + service + "/" + m.Name
+}
+
+// collectGRPCServices finds the gRPC services declared by generated code in
+// project packages or dependencies and the project types serving them.
+// Services declared by dependencies are kept only if the project serves
+// them. It returns all services found, by the type key of their generated
+// client interface, for matching client calls.
+func (c *Collector) collectGRPCServices(pkgs []*packages.Package) map[string]*GRPCService {
+	descs := make(map[types.Object]*GRPCService)     // ServiceDesc variable -> service
+	registers := make(map[types.Object]*GRPCService) // RegisterXServer -> service
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if _, ok := pkg.Imports[grpcPackage]; ok && pkg.TypesInfo != nil {
+			c.grpcDescriptors(pkg, descs, registers)
+		}
+	})
+
+	registered := make(map[*GRPCService]map[string]bool)
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if !c.isProjectPackage(pkg.PkgPath) || pkg.TypesInfo == nil {
+			return
+		}
+		info := pkg.TypesInfo
+		for _, file := range pkg.Syntax {
+			ast.Inspect(file, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				svc, impl := grpcRegistration(info, call, descs, registers)
+				if svc == nil {
+					return true
+				}
+				// Generated RegisterXServer functions pass on an interface.
+				t := info.TypeOf(impl)
+				if key := typeKeyOf(t); key != "" && !types.IsInterface(t) {
+					if registered[svc] == nil {
+						registered[svc] = make(map[string]bool)
+					}
+					registered[svc][key] = true
+				}
+				return true
+			})
+		}
+	})
+
+	clients := make(map[string]*GRPCService)
+	for _, svc := range descs {
+		if server, ok := strings.CutSuffix(svc.Interface, "Server"); ok {
+			clients[server+"Client"] = svc
+		}
+		if impls := registered[svc]; len(impls) > 0 {
+			for key := range impls {
+				svc.Impls = append(svc.Impls, key)
+			}
+			svc.Registered = true
+		} else {
+			svc.Impls = c.grpcImplementers(pkgs, svc)
+		}
+		if len(svc.Impls) == 0 && !c.isProjectPackage(svc.Package) {
+			continue
+		}
+		sort.Strings(svc.Impls)
+		c.GRPCServices[svc.Name] = svc
+	}
+	c.grpcImplMethods(pkgs)
+	return clients
+}
+
+// grpcDescriptors records the grpc.ServiceDesc variables of pkg, and the
+// functions of pkg passing one to RegisterService (the generated
+// RegisterXServer functions).
+func (c *Collector) grpcDescriptors(pkg *packages.Package, descs, registers map[types.Object]*GRPCService) {
+	info := pkg.TypesInfo
+	for _, file := range pkg.Syntax {
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				vs, ok := spec.(*ast.ValueSpec)
+				if !ok || len(vs.Names) != len(vs.Values) {
+					continue
+				}
+				for i, name := range vs.Names {
+					obj := info.Defs[name]
+					if obj == nil || !isGRPCType(obj.Type(), "ServiceDesc") {
+						continue
+					}
+					if svc := parseServiceDesc(info, vs.Values[i]); svc != nil {
+						svc.Package = pkg.PkgPath
+						descs[obj] = svc
+					}
+				}
+			}
+		}
+	}
+	for _, file := range pkg.Syntax {
+		for _, decl := range file.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok || fd.Body == nil {
+				continue
+			}
+			ast.Inspect(fd.Body, func(n ast.Node) bool {
+				if call, ok := n.(*ast.CallExpr); ok {
+					if svc, _ := grpcRegistration(info, call, descs, nil); svc != nil {
+						registers[info.Defs[fd.Name]] = svc
+					}
+				}
+				return true
+			})
+		}
+	}
+}
+
+// parseServiceDesc reads a grpc.ServiceDesc composite literal. It returns
+// nil if the service name is not a constant.
+func parseServiceDesc(info *types.Info, expr ast.Expr) *GRPCService {
+	lit, ok := ast.Unparen(expr).(*ast.CompositeLit)
+	if !ok {
+		return nil
+	}
+	svc := &GRPCService{}
+	for _, kv := range keyValues(lit) {
+		switch kv.key {
+		case "ServiceName":
+			svc.Name, _ = constString(info, kv.value)
+		case "HandlerType":
+			// (*OrderServiceServer)(nil)
+			if ptr, ok := info.TypeOf(kv.value).(*types.Pointer); ok {
+				svc.Interface = typeKeyOf(ptr.Elem())
+			}
+		case "Methods", "Streams":
+			list, ok := ast.Unparen(kv.value).(*ast.CompositeLit)
+			if !ok {
+				continue
+			}
+			for _, elt := range list.Elts {
+				if m, ok := parseMethodDesc(info, elt); ok {
+					svc.Methods = append(svc.Methods, m)
+				}
+			}
+		}
+	}
+	if svc.Name == "" {
+		return nil
+	}
+	return svc
+}
+
+// parseMethodDesc reads a grpc.MethodDesc or grpc.StreamDesc literal.
+func parseMethodDesc(info *types.Info, expr ast.Expr) (GRPCMethod, bool) {
+	lit, ok := ast.Unparen(expr).(*ast.CompositeLit)
+	if !ok {
+		return GRPCMethod{}, false
+	}
+	var m GRPCMethod
+	for _, kv := range keyValues(lit) {
+		switch kv.key {
+		case "MethodName", "StreamName":
+			m.Name, _ = constString(info, kv.value)
+		case "ClientStreams":
+			m.ClientStreaming = constBool(info, kv.value)
+		case "ServerStreams":
+			m.ServerStreaming = constBool(info, kv.value)
+		}
+	}
+	return m, m.Name != ""
+}
+
+// grpcRegistration reports the service registered by call, a call of
+// RegisterService with a known descriptor or of a function in registers,
+// and the expression of the registered implementation.
+func grpcRegistration(info *types.Info, call *ast.CallExpr, descs, registers map[types.Object]*GRPCService) (*GRPCService, ast.Expr) {
+	fn := typeutil.Callee(info, call)
+	if fn == nil || len(call.Args) != 2 {
+		return nil, nil
+	}
+	if svc, ok := registers[fn]; ok {
+		return svc, call.Args[1]
+	}
+	if fn.Name() != "RegisterService" {
+		return nil, nil
+	}
+	arg := ast.Unparen(call.Args[0])
+	if u, ok := arg.(*ast.UnaryExpr); ok {
+		arg = ast.Unparen(u.X)
+	}
+	var id *ast.Ident
+	switch x := arg.(type) {
+	case *ast.Ident:
+		id = x
+	case *ast.SelectorExpr:
+		id = x.Sel
+	}
+	if id == nil {
+		return nil, nil
+	}
+	if svc, ok := descs[info.Uses[id]]; ok {
+		return svc, call.Args[1]
+	}
+	return nil, nil
+}
+
+// grpcImplementers returns the type keys of the project types implementing
+// the server interface of svc, leaving out the generated Unimplemented and
+// Unsafe helpers.
+func (c *Collector) grpcImplementers(pkgs []*packages.Package, svc *GRPCService) []string {
+	iface := c.grpcInterface(pkgs, svc)
+	if iface == nil {
+		return nil
+	}
+	var impls []string
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if !c.isProjectPackage(pkg.PkgPath) || pkg.Types == nil {
+			return
+		}
+		scope := pkg.Types.Scope()
+		for _, name := range scope.Names() {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || tn.IsAlias() || types.IsInterface(tn.Type()) ||
+				strings.HasPrefix(name, "Unimplemented") || strings.HasPrefix(name, "Unsafe") {
+				continue
+			}
+			if types.Implements(tn.Type(), iface) || types.Implements(types.NewPointer(tn.Type()), iface) {
+				impls = append(impls, pkg.PkgPath+"."+name)
+			}
+		}
+	})
+	return impls
+}
+
+// grpcInterface returns the server interface of svc.
+func (c *Collector) grpcInterface(pkgs []*packages.Package, svc *GRPCService) *types.Interface {
+	var iface *types.Interface
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if pkg.PkgPath != svc.Package || pkg.Types == nil {
+			return
+		}
+		name := strings.TrimPrefix(svc.Interface, svc.Package+".")
+		if tn, ok := pkg.Types.Scope().Lookup(name).(*types.TypeName); ok {
+			iface, _ = tn.Type().Underlying().(*types.Interface)
+		}
+	})
+	return iface
+}
+
+// grpcImplMethods sets the Impls of each method of the collected services
+// to the methods of their implementations.
+func (c *Collector) grpcImplMethods(pkgs []*packages.Package) {
+	named := make(map[string]types.Type)
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if !c.isProjectPackage(pkg.PkgPath) || pkg.Types == nil {
+			return
+		}
+		scope := pkg.Types.Scope()
+		for _, name := range scope.Names() {
+			if tn, ok := scope.Lookup(name).(*types.TypeName); ok && !tn.IsAlias() {
+				named[pkg.PkgPath+"."+name] = tn.Type()
+			}
+		}
+	})
+	for _, svc := range c.GRPCServices {
+		for i := range svc.Methods {
+			m := &svc.Methods[i]
+			m.Impls = make([]string, len(svc.Impls))
+			for j, key := range svc.Impls {
+				t, ok := named[key]
+				if !ok {
+					continue
+				}
+				obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(t), false, nil, m.Name)
+				if fn, ok := obj.(*types.Func); ok && fn.Pkg() != nil {
+					m.Impls[j] = c.funcFullName(fn.Pkg().Path(), fn)
+				}
+			}
+		}
+	}
+}
+
+// keyValue is one keyed element of a composite literal.
+type keyValue struct {
+	key   string
+	value ast.Expr
+}
+
+// keyValues returns the elements of lit keyed by field name.
+func keyValues(lit *ast.CompositeLit) []keyValue {
+	var kvs []keyValue
+	for _, elt := range lit.Elts {
+		if kv, ok := elt.(*ast.KeyValueExpr); ok {
+			if id, ok := kv.Key.(*ast.Ident); ok {
+				kvs = append(kvs, keyValue{id.Name, kv.Value})
+			}
+		}
+	}
+	return kvs
+}
+
+// isGRPCType reports whether t is the grpc-go type with the given name.
+func isGRPCType(t types.Type, name string) bool {
+	named, ok := t.(*types.Named)
+	return ok && named.Obj().Name() == name && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == grpcPackage
+}
+
+// typeKeyOf returns the type key of a named type or pointer to one, or ""
+// for other types.
+func typeKeyOf(t types.Type) string {
+	named, _ := receiverNamed(t)
+	if named == nil || named.Obj().Pkg() == nil {
+		return ""
+	}
+	return named.Obj().Pkg().Path() + "." + named.Obj().Name()
+}
+
+// constBool returns the value of a constant boolean expression, or false.
+func constBool(info *types.Info, expr ast.Expr) bool {
+	tv, ok := info.Types[expr]
+	return ok && tv.Value != nil && tv.Value.Kind() == constant.Bool && constant.BoolVal(tv.Value)
+}
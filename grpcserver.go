@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// streamGraphMethod is the gRPC method streaming the graph, declared in
+// proto/callgraph.proto.
+const streamGraphMethod = "/callgraph.v1.CallGraph/StreamGraph"
+
+// gRPC status codes used by the server.
+const (
+	grpcOK            = 0
+	grpcCanceled      = 1
+	grpcInvalidArg    = 3
+	grpcUnimplemented = 12
+	grpcInternal      = 13
+)
+
+// ServeGraphGRPC serves the graph of c over gRPC on addr until ctx is
+// done. gRPC runs on HTTP/2 without TLS, as most clients expect on a
+// local port.
+func ServeGraphGRPC(ctx context.Context, addr string, c *Collector) error {
+	srv, err := newGRPCServer(grpcGraphHandler(c))
+	if err != nil {
+		return fmt.Errorf("cannot serve gRPC: %w", err)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("cannot serve gRPC: %w", err)
+	}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	log.Printf("Serving the graph over gRPC at %s (%s); interrupt to stop", displayAddr(addr), streamGraphMethod)
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("cannot serve gRPC: %w", err)
+	}
+	return nil
+}
+
+// grpcGraphHandler serves the CallGraph service over the gRPC protocol on
+// HTTP/2: length-prefixed protobuf messages, and the status in trailers.
+func grpcGraphHandler(c *Collector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.ProtoMajor != 2 {
+			http.Error(w, "gRPC requires POST over HTTP/2", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc+proto")
+		if r.URL.Path != streamGraphMethod {
+			grpcStatus(w, grpcUnimplemented, "unknown method "+r.URL.Path)
+			return
+		}
+		msg, err := readGRPCMessage(r.Body)
+		if err != nil {
+			grpcStatus(w, grpcInvalidArg, err.Error())
+			return
+		}
+		req, err := decodeStreamGraphRequest(msg)
+		if err != nil {
+			grpcStatus(w, grpcInvalidArg, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		flusher, _ := w.(http.Flusher)
+		send := func(element []byte) error {
+			if err := r.Context().Err(); err != nil {
+				return err
+			}
+			frame := make([]byte, 5, 5+len(element))
+			binary.BigEndian.PutUint32(frame[1:], uint32(len(element)))
+			if _, err := w.Write(append(frame, element...)); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			return nil
+		}
+		err = c.WalkGraph(
+			func(n GraphNode) error {
+				if len(req.labels) > 0 && !slices.ContainsFunc(n.Labels, func(l string) bool { return slices.Contains(req.labels, l) }) {
+					return nil
+				}
+				var b protoBuf
+				b.message(1, encodeGraphNode(n))
+				return send(b)
+			},
+			func(e GraphEdge) error {
+				if req.nodesOnly || len(req.types) > 0 && !slices.Contains(req.types, e.Type) {
+					return nil
+				}
+				var b protoBuf
+				b.message(2, encodeGraphEdge(e))
+				return send(b)
+			})
+		switch {
+		case err == nil:
+			grpcStatus(w, grpcOK, "")
+		case r.Context().Err() != nil:
+			grpcStatus(w, grpcCanceled, "cancelled by the client")
+		default:
+			grpcStatus(w, grpcInternal, err.Error())
+		}
+	})
+}
+
+// grpcStatus ends a gRPC response with a status in the trailers.
+func grpcStatus(w http.ResponseWriter, code int, message string) {
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", message)
+	}
+}
+
+// readGRPCMessage reads the one length-prefixed message of a unary or
+// server-streaming request.
+func readGRPCMessage(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, fmt.Errorf("cannot read request: %w", err)
+	}
+	if prefix[0] != 0 {
+		return nil, errors.New("compressed requests are not supported")
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > 1<<20 {
+		return nil, fmt.Errorf("request of %d bytes is too large", size)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, fmt.Errorf("cannot read request: %w", err)
+	}
+	return msg, nil
+}
+
+// streamGraphRequest is a decoded StreamGraphRequest.
+type streamGraphRequest struct {
+	labels    []string
+	types     []string
+	nodesOnly bool
+}
+
+// decodeStreamGraphRequest decodes a StreamGraphRequest, skipping the
+// fields it does not know.
+func decodeStreamGraphRequest(msg []byte) (*streamGraphRequest, error) {
+	req := &streamGraphRequest{}
+	for len(msg) > 0 {
+		tag, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return nil, errors.New("malformed request")
+		}
+		msg = msg[n:]
+		field, wire := tag>>3, tag&7
+		var value uint64
+		var data []byte
+		switch wire {
+		case 0: // varint
+			if value, n = binary.Uvarint(msg); n <= 0 {
+				return nil, errors.New("malformed request")
+			}
+			msg = msg[n:]
+		case 1: // 64-bit
+			n = 8
+		case 2: // length-delimited
+			size, m := binary.Uvarint(msg)
+			if m <= 0 || size > uint64(len(msg)-m) {
+				return nil, errors.New("malformed request")
+			}
+			data, msg = msg[m:m+int(size)], msg[m+int(size):]
+		case 5: // 32-bit
+			n = 4
+		default:
+			return nil, fmt.Errorf("malformed request: wire type %d", wire)
+		}
+		if wire == 1 || wire == 5 {
+			if len(msg) < n {
+				return nil, errors.New("malformed request")
+			}
+			msg = msg[n:]
+		}
+		switch {
+		case field == 1 && wire == 2:
+			req.labels = append(req.labels, string(data))
+		case field == 2 && wire == 2:
+			req.types = append(req.types, string(data))
+		case field == 3 && wire == 0:
+			req.nodesOnly = value != 0
+		}
+	}
+	return req, nil
+}
+
+// encodeGraphNode encodes n as a Node message.
+func encodeGraphNode(n GraphNode) protoBuf {
+	var b protoBuf
+	b.string(1, n.Key)
+	for _, l := range n.Labels {
+		b.string(2, l)
+	}
+	b.properties(3, n.Props)
+	return b
+}
+
+// encodeGraphEdge encodes e as a Relationship message.
+func encodeGraphEdge(e GraphEdge) protoBuf {
+	var b protoBuf
+	b.string(1, e.Type)
+	b.string(2, e.Start)
+	b.string(3, e.StartLabel)
+	b.string(4, e.End)
+	b.string(5, e.EndLabel)
+	b.properties(6, e.Props)
+	return b
+}
+
+// protoBuf is a protobuf message being encoded. Fields are appended in
+// the order written; zero scalars are left out, as proto3 does, except in
+// oneofs, which always write their field.
+type protoBuf []byte
+
+func (b *protoBuf) tag(field, wire int) {
+	*b = binary.AppendUvarint(*b, uint64(field<<3|wire))
+}
+
+func (b *protoBuf) bytes(field int, data []byte) {
+	b.tag(field, 2)
+	*b = binary.AppendUvarint(*b, uint64(len(data)))
+	*b = append(*b, data...)
+}
+
+func (b *protoBuf) string(field int, s string) {
+	if s != "" {
+		b.bytes(field, []byte(s))
+	}
+}
+
+func (b *protoBuf) message(field int, m protoBuf) {
+	b.bytes(field, m)
+}
+
+// properties encodes props as a map<string, Value> field.
+func (b *protoBuf) properties(field int, props map[string]any) {
+	for _, k := range sortedKeys(props) {
+		var entry protoBuf
+		entry.string(1, k)
+		entry.message(2, protoValue(props[k]))
+		b.message(field, entry)
+	}
+}
+
+// protoValue encodes a property value as a Value message.
+func protoValue(v any) protoBuf {
+	var b protoBuf
+	switch v := v.(type) {
+	case string:
+		b.bytes(1, []byte(v))
+	case int:
+		b.tag(2, 0)
+		b = binary.AppendUvarint(b, uint64(int64(v)))
+	case int64:
+		b.tag(2, 0)
+		b = binary.AppendUvarint(b, uint64(v))
+	case float64:
+		b.tag(3, 1)
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(v))
+	case bool:
+		b.tag(4, 0)
+		if v {
+			b = append(b, 1)
+		} else {
+			b = append(b, 0)
+		}
+	case []string:
+		var list protoBuf
+		for _, s := range v {
+			list.message(1, protoValue(s))
+		}
+		b.message(5, list)
+	case []int:
+		var list protoBuf
+		for _, i := range v {
+			list.message(1, protoValue(i))
+		}
+		b.message(5, list)
+	case time.Time:
+		b.bytes(6, []byte(v.Format(time.RFC3339Nano)))
+	default:
+		b.bytes(1, []byte(fmt.Sprint(v)))
+	}
+	return b
+}
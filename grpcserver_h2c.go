@@ -0,0 +1,13 @@
+//go:build go1.24
+
+package main
+
+import "net/http"
+
+// newGRPCServer returns a server of h speaking HTTP/2 without TLS, which
+// net/http supports from Go 1.24.
+func newGRPCServer(h http.Handler) (*http.Server, error) {
+	srv := &http.Server{Handler: h, Protocols: new(http.Protocols)}
+	srv.Protocols.SetUnencryptedHTTP2(true)
+	return srv, nil
+}
@@ -0,0 +1,14 @@
+//go:build !go1.24
+
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+// newGRPCServer fails: net/http serves HTTP/2 without TLS only from Go
+// 1.24.
+func newGRPCServer(http.Handler) (*http.Server, error) {
+	return nil, errors.New("serving gRPC requires the tool to be built with Go 1.24 or later")
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// callGraphProto returns the descriptor of proto/callgraph.proto, which
+// TestCallGraphProtoDescriptor keeps in step with the file.
+func callGraphProto(t *testing.T) protoreflect.FileDescriptor {
+	t.Helper()
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string, repeated bool, oneof *int32) *descriptorpb.FieldDescriptorProto {
+		label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		if repeated {
+			label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+		}
+		f := &descriptorpb.FieldDescriptorProto{Name: proto.String(name), Number: proto.Int32(number),
+			Type: typ.Enum(), Label: label.Enum(), JsonName: proto.String(name), OneofIndex: oneof}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	const (
+		str = descriptorpb.FieldDescriptorProto_TYPE_STRING
+		msg = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+	)
+	properties := func(number int32) (*descriptorpb.FieldDescriptorProto, *descriptorpb.DescriptorProto) {
+		return field("properties", number, msg, "PropertiesEntry", true, nil),
+			&descriptorpb.DescriptorProto{Name: proto.String("PropertiesEntry"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("key", 1, str, "", false, nil),
+					field("value", 2, msg, ".callgraph.v1.Value", false, nil),
+				},
+				Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)}}
+	}
+	oneof := proto.Int32(0)
+	nodeProps, nodeEntry := properties(3)
+	relProps, relEntry := properties(6)
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("callgraph.proto"),
+		Package: proto.String("callgraph.v1"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("StreamGraphRequest"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("labels", 1, str, "", true, nil),
+				field("relationship_types", 2, str, "", true, nil),
+				field("nodes_only", 3, descriptorpb.FieldDescriptorProto_TYPE_BOOL, "", false, nil),
+			}},
+			{Name: proto.String("GraphElement"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("node", 1, msg, ".callgraph.v1.Node", false, oneof),
+				field("relationship", 2, msg, ".callgraph.v1.Relationship", false, oneof),
+			}, OneofDecl: []*descriptorpb.OneofDescriptorProto{{Name: proto.String("element")}}},
+			{Name: proto.String("Node"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("key", 1, str, "", false, nil),
+				field("labels", 2, str, "", true, nil),
+				nodeProps,
+			}, NestedType: []*descriptorpb.DescriptorProto{nodeEntry}},
+			{Name: proto.String("Relationship"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("type", 1, str, "", false, nil),
+				field("start_key", 2, str, "", false, nil),
+				field("start_label", 3, str, "", false, nil),
+				field("end_key", 4, str, "", false, nil),
+				field("end_label", 5, str, "", false, nil),
+				relProps,
+			}, NestedType: []*descriptorpb.DescriptorProto{relEntry}},
+			{Name: proto.String("Value"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("string_value", 1, str, "", false, oneof),
+				field("int_value", 2, descriptorpb.FieldDescriptorProto_TYPE_INT64, "", false, oneof),
+				field("double_value", 3, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE, "", false, oneof),
+				field("bool_value", 4, descriptorpb.FieldDescriptorProto_TYPE_BOOL, "", false, oneof),
+				field("list_value", 5, msg, ".callgraph.v1.ListValue", false, oneof),
+				field("datetime_value", 6, str, "", false, oneof),
+			}, OneofDecl: []*descriptorpb.OneofDescriptorProto{{Name: proto.String("kind")}}},
+			{Name: proto.String("ListValue"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("values", 1, msg, ".callgraph.v1.Value", true, nil),
+			}},
+		},
+	}
+	// Map entry types are named relative to their message.
+	for _, m := range file.MessageType {
+		for _, f := range m.Field {
+			if f.GetTypeName() == "PropertiesEntry" {
+				f.TypeName = proto.String(".callgraph.v1." + m.GetName() + ".PropertiesEntry")
+			}
+		}
+	}
+	fd, err := protodesc.NewFile(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fd
+}
+
+func TestCallGraphProtoDescriptor(t *testing.T) {
+	src, err := os.ReadFile("proto/callgraph.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fields declared in the file, as message.field = number.
+	var declared []string
+	var message string
+	for _, m := range regexp.MustCompile(`(?m)^message (\w+)|^\s+(?:repeated )?(?:map<\w+, \w+>|\w+) (\w+) = (\d+);`).FindAllSubmatch(src, -1) {
+		if m[1] != nil {
+			message = string(m[1])
+			continue
+		}
+		declared = append(declared, message+"."+string(m[2])+" = "+string(m[3]))
+	}
+	var described []string
+	msgs := callGraphProto(t).Messages()
+	for i := 0; i < msgs.Len(); i++ {
+		fields := msgs.Get(i).Fields()
+		for j := 0; j < fields.Len(); j++ {
+			f := fields.Get(j)
+			described = append(described, string(msgs.Get(i).Name())+"."+string(f.Name())+" = "+strconv.Itoa(int(f.Number())))
+		}
+	}
+	slices.Sort(declared)
+	slices.Sort(described)
+	if !slices.Equal(declared, described) {
+		t.Errorf("proto/callgraph.proto declares\n%q\nthe test descriptor has\n%q", declared, described)
+	}
+}
+
+func TestDecodeStreamGraphRequest(t *testing.T) {
+	fd := callGraphProto(t)
+	req := dynamicpb.NewMessage(fd.Messages().ByName("StreamGraphRequest"))
+	fields := req.Descriptor().Fields()
+	labels := req.Mutable(fields.ByName("labels")).List()
+	labels.Append(protoreflect.ValueOfString("GoFunc"))
+	labels.Append(protoreflect.ValueOfString("GoPackage"))
+	req.Mutable(fields.ByName("relationship_types")).List().Append(protoreflect.ValueOfString("ACCURATE_CALLS"))
+	req.Set(fields.ByName("nodes_only"), protoreflect.ValueOfBool(true))
+	msg, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fields of a later version of the message are skipped.
+	msg = binary.AppendUvarint(msg, 9<<3|0)
+	msg = binary.AppendUvarint(msg, 300)
+	msg = binary.AppendUvarint(msg, 10<<3|1)
+	msg = binary.LittleEndian.AppendUint64(msg, 1)
+	msg = binary.AppendUvarint(msg, 11<<3|5)
+	msg = binary.LittleEndian.AppendUint32(msg, 1)
+
+	got, err := decodeStreamGraphRequest(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got.labels, []string{"GoFunc", "GoPackage"}) || !slices.Equal(got.types, []string{"ACCURATE_CALLS"}) || !got.nodesOnly {
+		t.Errorf("decodeStreamGraphRequest = %+v", got)
+	}
+
+	for _, bad := range [][]byte{{0x0a}, {0x0a, 5, 'a'}, {0x09, 1, 2}, {0x0b}, {0x80}} {
+		if _, err := decodeStreamGraphRequest(bad); err == nil {
+			t.Errorf("decodeStreamGraphRequest(%x) succeeded", bad)
+		}
+	}
+}
+
+func TestEncodeGraphElements(t *testing.T) {
+	fd := callGraphProto(t)
+	modified := time.Date(2024, 5, 6, 7, 8, 9, 10, time.UTC)
+	var node protoBuf
+	node.message(1, encodeGraphNode(GraphNode{Key: "k", Labels: []string{"GoFunc", "External"}, Props: map[string]any{
+		"name": "F", "line": 12, "calls": int64(-3), "share": 0.25, "exported": false,
+		"tags": []string{"a", "b"}, "lines": []int{1, 2}, "last_modified": modified,
+	}}))
+	elem := dynamicpb.NewMessage(fd.Messages().ByName("GraphElement"))
+	if err := proto.Unmarshal(node, elem); err != nil {
+		t.Fatal(err)
+	}
+	n := elem.Get(elem.Descriptor().Fields().ByName("node")).Message()
+	nf := n.Descriptor().Fields()
+	if got := n.Get(nf.ByName("key")).String(); got != "k" {
+		t.Errorf("key = %q", got)
+	}
+	if got := n.Get(nf.ByName("labels")).List(); got.Len() != 2 || got.Get(1).String() != "External" {
+		t.Errorf("labels = %v", got)
+	}
+	props := n.Get(nf.ByName("properties")).Map()
+	value := func(key string) (string, protoreflect.Value) {
+		v := props.Get(protoreflect.ValueOfString(key).MapKey()).Message()
+		which := v.WhichOneof(v.Descriptor().Oneofs().ByName("kind"))
+		if which == nil {
+			t.Fatalf("property %s has no value", key)
+		}
+		return string(which.Name()), v.Get(which)
+	}
+	for key, want := range map[string]any{
+		"name": "string_value F", "line": "int_value 12", "calls": "int_value -3", "share": "double_value 0.25",
+		"exported": "bool_value false", "last_modified": "datetime_value 2024-05-06T07:08:09.00000001Z",
+	} {
+		kind, v := value(key)
+		if got := kind + " " + v.String(); got != want {
+			t.Errorf("%s = %s, want %s", key, got, want)
+		}
+	}
+	for key, want := range map[string][]string{"tags": {"a", "b"}, "lines": {"1", "2"}} {
+		kind, v := value(key)
+		list := v.Message().Get(v.Message().Descriptor().Fields().ByName("values")).List()
+		var got []string
+		for i := 0; i < list.Len(); i++ {
+			item := list.Get(i).Message()
+			got = append(got, item.Get(item.WhichOneof(item.Descriptor().Oneofs().ByName("kind"))).String())
+		}
+		if kind != "list_value" || !slices.Equal(got, want) {
+			t.Errorf("%s = %s %q, want %q", key, kind, got, want)
+		}
+	}
+
+	var rel protoBuf
+	rel.message(2, encodeGraphEdge(GraphEdge{Type: "ACCURATE_CALLS", Start: "a", StartLabel: "GoFunc",
+		End: "b", EndLabel: "GoFunc", Props: map[string]any{"call_count": 2}}))
+	elem = dynamicpb.NewMessage(fd.Messages().ByName("GraphElement"))
+	if err := proto.Unmarshal(rel, elem); err != nil {
+		t.Fatal(err)
+	}
+	r := elem.Get(elem.Descriptor().Fields().ByName("relationship")).Message()
+	rf := r.Descriptor().Fields()
+	for name, want := range map[protoreflect.Name]string{"type": "ACCURATE_CALLS", "start_key": "a", "start_label": "GoFunc", "end_key": "b", "end_label": "GoFunc"} {
+		if got := r.Get(rf.ByName(name)).String(); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if got := r.Get(rf.ByName("properties")).Map().Len(); got != 1 {
+		t.Errorf("%d properties, want 1", got)
+	}
+}
+
+func TestGRPCGraphHandler(t *testing.T) {
+	c := NewCollector("example.com/m")
+	c.Modules["example.com/m"] = &ModuleNode{Path: "example.com/m", Main: true}
+	c.Modules["example.com/dep"] = &ModuleNode{Path: "example.com/dep", Version: "v1.0.0"}
+	c.Requires = []RequireEdge{{From: "example.com/m", To: "example.com/dep", Version: "v1.0.0"}}
+	c.Packages["example.com/m/a"] = &PackageNode{ImportPath: "example.com/m/a", Name: "a", Module: "example.com/m"}
+
+	srv := httptest.NewUnstartedServer(grpcGraphHandler(c))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	fd := callGraphProto(t)
+
+	call := func(fill func(req *dynamicpb.Message)) (elements []string, status string) {
+		t.Helper()
+		req := dynamicpb.NewMessage(fd.Messages().ByName("StreamGraphRequest"))
+		fill(req)
+		msg, err := proto.Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frame := binary.BigEndian.AppendUint32([]byte{0}, uint32(len(msg)))
+		resp, err := srv.Client().Post(srv.URL+streamGraphMethod, "application/grpc", bytes.NewReader(append(frame, msg...)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for len(body) > 0 {
+			if len(body) < 5 || body[0] != 0 {
+				t.Fatalf("malformed frame %x", body)
+			}
+			size := binary.BigEndian.Uint32(body[1:5])
+			elem := dynamicpb.NewMessage(fd.Messages().ByName("GraphElement"))
+			if err := proto.Unmarshal(body[5:5+size], elem); err != nil {
+				t.Fatal(err)
+			}
+			which := elem.WhichOneof(elem.Descriptor().Oneofs().ByName("element"))
+			m := elem.Get(which).Message()
+			key := m.Get(m.Descriptor().Fields().Get(0)).String()
+			if which.Name() == "relationship" {
+				key += " " + m.Get(m.Descriptor().Fields().ByName("start_key")).String() + " " + m.Get(m.Descriptor().Fields().ByName("end_key")).String()
+			}
+			elements = append(elements, string(which.Name())+" "+key)
+			body = body[5+size:]
+		}
+		return elements, resp.Trailer.Get("Grpc-Status")
+	}
+
+	elements, status := call(func(*dynamicpb.Message) {})
+	want := []string{
+		"node example.com/dep", "node example.com/m", "node example.com/m/a",
+		"relationship REQUIRES example.com/m example.com/dep",
+		"relationship IN_MODULE example.com/m/a example.com/m",
+	}
+	if status != "0" || !slices.Equal(elements, want) {
+		t.Errorf("StreamGraph = %q, status %s; want %q, status 0", elements, status, want)
+	}
+
+	elements, status = call(func(req *dynamicpb.Message) {
+		fields := req.Descriptor().Fields()
+		req.Mutable(fields.ByName("labels")).List().Append(protoreflect.ValueOfString("GoPackage"))
+		req.Mutable(fields.ByName("relationship_types")).List().Append(protoreflect.ValueOfString("IN_MODULE"))
+	})
+	want = []string{"node example.com/m/a", "relationship IN_MODULE example.com/m/a example.com/m"}
+	if status != "0" || !slices.Equal(elements, want) {
+		t.Errorf("StreamGraph of GoPackage and IN_MODULE = %q, status %s; want %q", elements, status, want)
+	}
+
+	elements, _ = call(func(req *dynamicpb.Message) {
+		req.Set(req.Descriptor().Fields().ByName("nodes_only"), protoreflect.ValueOfBool(true))
+	})
+	if len(elements) != 3 {
+		t.Errorf("StreamGraph of nodes only = %q", elements)
+	}
+
+	resp, err := srv.Client().Post(srv.URL+"/callgraph.v1.CallGraph/Other", "application/grpc", bytes.NewReader([]byte{0, 0, 0, 0, 0}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if got := resp.Trailer.Get("Grpc-Status"); got != "12" {
+		t.Errorf("unknown method: status %s, want 12", got)
+	}
+	if resp, err := srv.Client().Get(srv.URL + streamGraphMethod); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("GET: %v %v", resp, err)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// FuncHotspot is a function ranked by the hotspots report.
+type FuncHotspot struct {
+	FullName   string `json:"full_name"`
+	File       string `json:"file"`
+	Line       int    `json:"line"`
+	FanIn      int    `json:"fan_in"`  // project functions calling it
+	FanOut     int    `json:"fan_out"` // project functions it calls
+	Complexity int    `json:"complexity"`
+	LOC        int    `json:"loc"`
+	Statements int    `json:"statements"`
+}
+
+// PackageHotspot is a package ranked by coupling: the project packages
+// depending on it and those it depends on, through imports and calls.
+type PackageHotspot struct {
+	Package  string `json:"package"`
+	Afferent int    `json:"afferent"` // packages depending on it
+	Efferent int    `json:"efferent"` // packages it depends on
+	CallsIn  int    `json:"calls_in"` // call sites in other packages calling it
+	CallsOut int    `json:"calls_out"`
+}
+
+// Hotspots holds the top functions by each metric and the most coupled
+// packages.
+type Hotspots struct {
+	FanIn      []FuncHotspot    `json:"fan_in"`
+	FanOut     []FuncHotspot    `json:"fan_out"`
+	Complexity []FuncHotspot    `json:"complexity"`
+	Size       []FuncHotspot    `json:"size"`
+	Coupling   []PackageHotspot `json:"coupling"`
+}
+
+// Hotspots ranks the project functions by fan-in, fan-out, cyclomatic
+// complexity and size in statements, and the packages by coupling, keeping
+// the top n of each. Generated code, tests and synthetic functions are left
+// out; fan-in and fan-out count distinct project functions, as in_degree
+// and out_degree do.
+func (c *Collector) Hotspots(n int) Hotspots {
+	fanIn, fanOut := c.funcFans()
+	var funcs []FuncHotspot
+	for name, fn := range c.Funcs {
+		if !hotspotCounted(fn) {
+			continue
+		}
+		funcs = append(funcs, FuncHotspot{
+			FullName: name, File: fn.File, Line: fn.Line,
+			FanIn: fanIn[name], FanOut: fanOut[name],
+			Complexity: fn.Complexity, LOC: fn.LOC, Statements: fn.Statements,
+		})
+	}
+	top := func(metric func(FuncHotspot) int) []FuncHotspot {
+		sort.Slice(funcs, func(i, j int) bool {
+			if a, b := metric(funcs[i]), metric(funcs[j]); a != b {
+				return a > b
+			}
+			return funcs[i].FullName < funcs[j].FullName
+		})
+		out := []FuncHotspot{}
+		for _, f := range funcs {
+			if len(out) == n || metric(f) == 0 {
+				break
+			}
+			out = append(out, f)
+		}
+		return out
+	}
+	h := Hotspots{
+		FanIn:      top(func(f FuncHotspot) int { return f.FanIn }),
+		FanOut:     top(func(f FuncHotspot) int { return f.FanOut }),
+		Complexity: top(func(f FuncHotspot) int { return f.Complexity }),
+		Size:       top(func(f FuncHotspot) int { return f.Statements }),
+		Coupling:   []PackageHotspot{},
+	}
+
+	deps, calls := c.packageDependencies()
+	pkgs := make(map[string]*PackageHotspot)
+	pkg := func(path string) *PackageHotspot {
+		if pkgs[path] == nil {
+			pkgs[path] = &PackageHotspot{Package: path}
+		}
+		return pkgs[path]
+	}
+	for pair := range deps {
+		pkg(pair[0]).Efferent++
+		pkg(pair[1]).Afferent++
+		pkg(pair[0]).CallsOut += calls[pair]
+		pkg(pair[1]).CallsIn += calls[pair]
+	}
+	for _, p := range pkgs {
+		h.Coupling = append(h.Coupling, *p)
+	}
+	sort.Slice(h.Coupling, func(i, j int) bool {
+		a, b := h.Coupling[i], h.Coupling[j]
+		if a.Afferent+a.Efferent != b.Afferent+b.Efferent {
+			return a.Afferent+a.Efferent > b.Afferent+b.Efferent
+		}
+		return a.Package < b.Package
+	})
+	if len(h.Coupling) > n {
+		h.Coupling = h.Coupling[:n]
+	}
+	return h
+}
+
+// hotspotCounted reports whether fn is ranked by the hotspot analyses:
+// declared in a project file that is neither generated nor a test.
+func hotspotCounted(fn *FuncNode) bool {
+	return fn.File != "" && !fn.Generated && fn.Synthetic == "" && !isTestFile(fn.File)
+}
+
+// funcFans returns the fan-in and fan-out of the project functions: the
+// distinct project functions calling them and they call, calls from tests
+// aside.
+func (c *Collector) funcFans() (fanIn, fanOut map[string]int) {
+	fanIn = make(map[string]int)
+	fanOut = make(map[string]int)
+	for _, e := range c.Calls {
+		caller, ok1 := c.Funcs[e.CallerFullName]
+		_, ok2 := c.Funcs[e.CalleeFullName]
+		if !ok1 || !ok2 || e.External || isTestFile(caller.File) {
+			continue
+		}
+		fanIn[e.CalleeFullName]++
+		fanOut[e.CallerFullName]++
+	}
+	return fanIn, fanOut
+}
+
+// hotspotTables returns the tables of h as titles, headers and rows.
+func hotspotTables(h Hotspots) (titles []string, headers [][]string, rows [][][]string) {
+	funcHeader := []string{"#", "Function", "Fan-in", "Fan-out", "Complexity", "Statements", "LOC", "Location"}
+	funcRows := func(fs []FuncHotspot) [][]string {
+		out := make([][]string, len(fs))
+		for i, f := range fs {
+			out[i] = []string{
+				fmt.Sprint(i + 1), f.FullName, fmt.Sprint(f.FanIn), fmt.Sprint(f.FanOut),
+				fmt.Sprint(f.Complexity), fmt.Sprint(f.Statements), fmt.Sprint(f.LOC),
+				fmt.Sprintf("%s:%d", f.File, f.Line),
+			}
+		}
+		return out
+	}
+	for _, t := range []struct {
+		title string
+		fs    []FuncHotspot
+	}{
+		{"Functions by fan-in", h.FanIn},
+		{"Functions by fan-out", h.FanOut},
+		{"Functions by complexity", h.Complexity},
+		{"Functions by size", h.Size},
+	} {
+		titles = append(titles, t.title)
+		headers = append(headers, funcHeader)
+		rows = append(rows, funcRows(t.fs))
+	}
+	pkgRows := make([][]string, len(h.Coupling))
+	for i, p := range h.Coupling {
+		pkgRows[i] = []string{
+			fmt.Sprint(i + 1), p.Package, fmt.Sprint(p.Afferent), fmt.Sprint(p.Efferent),
+			fmt.Sprint(p.CallsIn), fmt.Sprint(p.CallsOut),
+		}
+	}
+	titles = append(titles, "Packages by coupling")
+	headers = append(headers, []string{"#", "Package", "Afferent", "Efferent", "Calls in", "Calls out"})
+	rows = append(rows, pkgRows)
+	return titles, headers, rows
+}
+
+// WriteHotspots prints h as aligned text tables.
+func WriteHotspots(w io.Writer, h Hotspots) {
+	titles, headers, rows := hotspotTables(h)
+	for i, title := range titles {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s:\n", title)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(headers[i], "\t"))
+		for _, row := range rows[i] {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		tw.Flush()
+	}
+}
+
+// WriteHotspotsMarkdown prints h as Markdown tables.
+func WriteHotspotsMarkdown(w io.Writer, h Hotspots) {
+	titles, headers, rows := hotspotTables(h)
+	fmt.Fprintln(w, "## Hotspots")
+	for i, title := range titles {
+		fmt.Fprintf(w, "\n### %s\n\n", title)
+		if len(rows[i]) == 0 {
+			fmt.Fprintln(w, "None.")
+			continue
+		}
+		fmt.Fprintf(w, "| %s |\n", strings.Join(headers[i], " | "))
+		fmt.Fprintf(w, "|%s\n", strings.Repeat(" --- |", len(headers[i])))
+		for _, row := range rows[i] {
+			cells := make([]string, len(row))
+			for j, cell := range row {
+				cells[j] = strings.ReplaceAll(cell, "|", `\|`)
+			}
+			cells[1] = "`" + cells[1] + "`"
+			fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | "))
+		}
+	}
+}
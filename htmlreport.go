@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Package diagram geometry, in SVG user units.
+const (
+	diagramRowHeight = 90
+	diagramBoxHeight = 28
+	diagramCharWidth = 7
+	diagramGap       = 24
+	diagramMargin    = 20
+)
+
+// htmlTable is a titled table of the HTML report.
+type htmlTable struct {
+	Title  string
+	Header []string
+	Rows   [][]string
+}
+
+// implMatrixRow is a concrete type and, per interface column, "value",
+// "pointer" or "".
+type implMatrixRow struct {
+	Type  string
+	Cells []string
+}
+
+// htmlReport is the data rendered by htmlReportTemplate.
+type htmlReport struct {
+	Module        string
+	Stats         [][2]string
+	Diagram       template.HTML
+	Hotspots      []htmlTable
+	Interfaces    []string
+	Matrix        []implMatrixRow
+	Dead          []*FuncNode
+	PackageCycles [][]string
+	Recursion     [][]string
+}
+
+// WriteHTMLReport renders a self-contained HTML architecture report: a
+// package dependency diagram, the hotspots h, an interface implementation
+// matrix, the dead functions and the package and call cycles. The cycles
+// must have been marked with MarkPackageCycles and MarkRecursion.
+func (c *Collector) WriteHTMLReport(w io.Writer, h Hotspots, dead []*FuncNode, pkgCycles, recursion [][]string) error {
+	pkgs := 0
+	for path := range c.Packages {
+		if !isTestPackage(path) {
+			pkgs++
+		}
+	}
+	r := htmlReport{
+		Module: c.RootModule,
+		Stats: [][2]string{
+			{"Packages", fmt.Sprint(pkgs)},
+			{"Functions", fmt.Sprint(len(c.Funcs))},
+			{"Calls", fmt.Sprint(len(c.Calls))},
+			{"Interfaces", fmt.Sprint(len(c.Interfaces))},
+			{"Unreachable functions", fmt.Sprint(len(dead))},
+			{"Package cycles", fmt.Sprint(len(pkgCycles))},
+		},
+		Diagram:       c.packageDiagram(),
+		Dead:          dead,
+		PackageCycles: pkgCycles,
+		Recursion:     recursion,
+	}
+	titles, headers, rows := hotspotTables(h)
+	for i := range titles {
+		r.Hotspots = append(r.Hotspots, htmlTable{Title: titles[i], Header: headers[i], Rows: rows[i]})
+	}
+	r.Interfaces, r.Matrix = c.implementationMatrix()
+	return htmlReportTemplate.Execute(w, r)
+}
+
+// shortPackage returns pkgPath relative to the module, or "." for its root.
+func (c *Collector) shortPackage(pkgPath string) string {
+	if pkgPath == c.RootModule {
+		return "."
+	}
+	return c.relPath(pkgPath)
+}
+
+// implementationMatrix returns the interfaces with implementations and,
+// for each implementing type, which of them it implements and how.
+func (c *Collector) implementationMatrix() ([]string, []implMatrixRow) {
+	column := make(map[string]int)
+	var ifaces []string
+	byType := make(map[string]map[string]string)
+	for _, e := range c.Implements {
+		if _, ok := column[e.Interface]; !ok {
+			column[e.Interface] = 0
+			ifaces = append(ifaces, e.Interface)
+		}
+		if byType[e.Struct] == nil {
+			byType[e.Struct] = make(map[string]string)
+		}
+		byType[e.Struct][e.Interface] = e.Receiver
+	}
+	sort.Strings(ifaces)
+	for i, iface := range ifaces {
+		column[iface] = i
+	}
+	rows := make([]implMatrixRow, 0, len(byType))
+	for typ, impls := range byType {
+		row := implMatrixRow{Type: typ, Cells: make([]string, len(ifaces))}
+		for iface, recv := range impls {
+			row.Cells[column[iface]] = recv
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Type < rows[j].Type })
+	return ifaces, rows
+}
+
+// packageDiagram draws the imports between project packages as an SVG,
+// importers above the packages they import, each package on the row below
+// its deepest importer. Packages in a dependency cycle are highlighted.
+func (c *Collector) packageDiagram() template.HTML {
+	var paths []string
+	for path := range c.Packages {
+		if !isTestPackage(path) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	imports := make(map[string][]string)
+	importers := make(map[string][]string)
+	for _, path := range paths {
+		for _, imp := range c.Packages[path].Imports {
+			if _, ok := c.Packages[imp]; ok && !isTestPackage(imp) && imp != path {
+				imports[path] = append(imports[path], imp)
+				importers[imp] = append(importers[imp], path)
+			}
+		}
+	}
+	// Imports cannot form cycles, so the depths are well defined.
+	depth := make(map[string]int)
+	var depthOf func(path string) int
+	depthOf = func(path string) int {
+		if d, ok := depth[path]; ok {
+			return d
+		}
+		depth[path] = 0
+		d := 0
+		for _, imp := range importers[path] {
+			d = max(d, depthOf(imp)+1)
+		}
+		depth[path] = d
+		return d
+	}
+	var rows [][]string
+	for _, path := range paths {
+		d := depthOf(path)
+		for len(rows) <= d {
+			rows = append(rows, nil)
+		}
+		rows[d] = append(rows[d], path)
+	}
+
+	type box struct{ x, y, w int }
+	boxes := make(map[string]box)
+	width := 0
+	for d, row := range rows {
+		x := diagramMargin
+		for _, path := range row {
+			w := len(c.shortPackage(path))*diagramCharWidth + 16
+			boxes[path] = box{x, diagramMargin + d*diagramRowHeight, w}
+			x += w + diagramGap
+		}
+		width = max(width, x)
+	}
+	height := diagramMargin*2 + max(len(rows)-1, 0)*diagramRowHeight + diagramBoxHeight
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="monospace" font-size="12">`, width, height)
+	b.WriteString(`<defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="6" markerHeight="6" orient="auto"><path d="M0,0L10,5L0,10z" fill="#888"/></marker></defs>`)
+	for _, path := range paths {
+		from := boxes[path]
+		for _, imp := range imports[path] {
+			to := boxes[imp]
+			fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#bbb" marker-end="url(#arrow)"/>`,
+				from.x+from.w/2, from.y+diagramBoxHeight, to.x+to.w/2, to.y)
+		}
+	}
+	for _, path := range paths {
+		bx := boxes[path]
+		fill := "#eef4ff"
+		if c.Packages[path].CycleID > 0 {
+			fill = "#ffe4e1"
+		}
+		fmt.Fprintf(&b, `<g><title>%s</title><rect x="%d" y="%d" width="%d" height="%d" rx="4" fill="%s" stroke="#4a6fa5"/>`,
+			template.HTMLEscapeString(path), bx.x, bx.y, bx.w, diagramBoxHeight, fill)
+		fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text></g>`, bx.x+8, bx.y+18, template.HTMLEscapeString(c.shortPackage(path)))
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// htmlReportTemplate is the page of the HTML report.
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Architecture report: {{.Module}}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.6em; } h2 { margin-top: 2em; border-bottom: 1px solid #ddd; } h3 { font-size: 1.05em; }
+table { border-collapse: collapse; margin: 0.5em 0 1.5em; font-size: 0.9em; }
+th, td { border: 1px solid #ddd; padding: 0.25em 0.6em; text-align: left; }
+th { background: #f5f5f5; }
+code, td.name { font-family: monospace; }
+.diagram { overflow: auto; border: 1px solid #ddd; padding: 0.5em; }
+.matrix td.cell { text-align: center; }
+.stats td:last-child { text-align: right; }
+</style>
+</head>
+<body>
+<h1>Architecture report: <code>{{.Module}}</code></h1>
+<table class="stats">
+{{range .Stats}}<tr><td>{{index . 0}}</td><td>{{index . 1}}</td></tr>
+{{end}}</table>
+
+<h2>Package dependencies</h2>
+<p>Importers are drawn above the packages they import; packages in a dependency cycle are red.</p>
+<div class="diagram">{{.Diagram}}</div>
+
+<h2>Hotspots</h2>
+{{range .Hotspots}}<h3>{{.Title}}</h3>
+{{if .Rows}}<table>
+<tr>{{range .Header}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range $i, $c := .}}<td{{if eq $i 1}} class="name"{{end}}>{{$c}}</td>{{end}}</tr>
+{{end}}</table>
+{{else}}<p>None.</p>
+{{end}}{{end}}
+<h2>Interface implementations</h2>
+{{if .Interfaces}}<p>✓ marks a type implementing the interface, * one whose pointer does.</p>
+<table class="matrix">
+<tr><th>Type</th>{{range .Interfaces}}<th><code>{{.}}</code></th>{{end}}</tr>
+{{range .Matrix}}<tr><td class="name">{{.Type}}</td>{{range .Cells}}<td class="cell">{{if eq . "value"}}✓{{else if eq . "pointer"}}*{{end}}</td>{{end}}</tr>
+{{end}}</table>
+{{else}}<p>No project interface has implementations.</p>
+{{end}}
+<h2>Dead code</h2>
+{{if .Dead}}<table>
+<tr><th>Function</th><th>Location</th><th>Statements</th></tr>
+{{range .Dead}}<tr><td class="name">{{.FullName}}</td><td>{{.File}}:{{.Line}}</td><td>{{.Statements}}</td></tr>
+{{end}}</table>
+{{else}}<p>No unreachable functions.</p>
+{{end}}
+<h2>Cycles</h2>
+<h3>Package dependency cycles</h3>
+{{if .PackageCycles}}<ol>
+{{range .PackageCycles}}<li>{{range $i, $p := .}}{{if $i}} ↔ {{end}}<code>{{$p}}</code>{{end}}</li>
+{{end}}</ol>
+{{else}}<p>None.</p>
+{{end}}<h3>Recursive functions</h3>
+{{if .Recursion}}<ol>
+{{range .Recursion}}<li>{{range $i, $f := .}}{{if $i}} ↔ {{end}}<code>{{$f}}</code>{{end}}</li>
+{{end}}</ol>
+{{else}}<p>None.</p>
+{{end}}
+</body>
+</html>
+`))
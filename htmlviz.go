@@ -0,0 +1,237 @@
+package main
+
+import (
+	"html/template"
+	"io"
+)
+
+// vizNode is a function of the interactive viewer.
+type vizNode struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Package string `json:"pkg"`
+	Focus   bool   `json:"focus,omitempty"`
+}
+
+// vizEdge is a call of the interactive viewer, between indexes of its nodes.
+type vizEdge struct {
+	Source  int  `json:"source"`
+	Target  int  `json:"target"`
+	Dynamic bool `json:"dynamic,omitempty"`
+}
+
+// vizGraph is the subgraph embedded in the interactive viewer.
+type vizGraph struct {
+	Nodes []vizNode `json:"nodes"`
+	Edges []vizEdge `json:"edges"`
+}
+
+// WriteHTMLViz writes a standalone HTML page exploring funcs and calls, as
+// returned by Neighborhood, with no external scripts: a force-directed
+// view that starts from the focus functions and their neighbors, expands
+// a function's neighbors on double click, and can search functions and
+// hide packages.
+func WriteHTMLViz(w io.Writer, focus, funcs []string, calls []callHop) error {
+	index := make(map[string]int, len(funcs))
+	g := vizGraph{Nodes: make([]vizNode, len(funcs)), Edges: make([]vizEdge, 0, len(calls))}
+	for i, name := range funcs {
+		index[name] = i
+		pkg := funcPackage(name)
+		g.Nodes[i] = vizNode{ID: name, Name: name[min(len(pkg)+1, len(name)):], Package: pkg}
+	}
+	for _, f := range focus {
+		g.Nodes[index[f]].Focus = true
+	}
+	for _, c := range calls {
+		g.Edges = append(g.Edges, vizEdge{Source: index[c.From], Target: index[c.Edge.Func], Dynamic: c.Edge.Dynamic})
+	}
+	return htmlVizTemplate.Execute(w, g)
+}
+
+// htmlVizTemplate is the page of the interactive viewer.
+var htmlVizTemplate = template.Must(template.New("viz").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Call graph</title>
+<style>
+html, body { margin: 0; height: 100%; font-family: system-ui, sans-serif; font-size: 13px; }
+#app { display: flex; height: 100%; }
+#side { width: 280px; padding: 10px; border-right: 1px solid #ddd; overflow: auto; box-sizing: border-box; }
+#side input[type=search] { width: 100%; box-sizing: border-box; }
+#side button { margin: 6px 4px 0 0; }
+#pkgs label { display: block; white-space: nowrap; overflow: hidden; text-overflow: ellipsis; }
+#details { margin-top: 12px; word-break: break-all; }
+svg { flex: 1; cursor: grab; }
+.edge { stroke: #aaa; } .edge.dynamic { stroke-dasharray: 4 3; }
+.node circle { stroke: #333; stroke-width: 1; } .node.focus circle { stroke: #c90; stroke-width: 3; }
+.node.match circle { stroke: #d00; stroke-width: 3; } .node.selected text { font-weight: bold; }
+.node text { font-family: monospace; font-size: 11px; pointer-events: none; }
+</style>
+</head>
+<body>
+<div id="app">
+<div id="side">
+<input type="search" id="search" placeholder="Search functions, Enter to show">
+<div><button id="all">Show all</button><button id="reset">Reset</button></div>
+<div id="details">Double-click a function to expand its callers and callees.</div>
+<h4>Packages</h4>
+<div id="pkgs"></div>
+</div>
+<svg id="view"><defs><marker id="arrow" viewBox="0 0 10 10" refX="18" refY="5" markerWidth="6" markerHeight="6" orient="auto"><path d="M0,0L10,5L0,10z" fill="#aaa"/></marker></defs><g id="scene"></g></svg>
+</div>
+<script>
+const graph = {{.}};
+const NS = "http://www.w3.org/2000/svg";
+const svg = document.getElementById("view"), scene = document.getElementById("scene");
+const nodes = graph.nodes, edges = graph.edges;
+const adj = nodes.map(() => []);
+edges.forEach(e => { adj[e.source].push(e.target); adj[e.target].push(e.source); });
+const pkgs = [...new Set(nodes.map(n => n.pkg))].sort();
+const hidden = new Set();
+let visible = new Set(), matches = new Set(), selected = -1;
+let view = {x: 0, y: 0, k: 1};
+
+function color(pkg) {
+  let h = 0;
+  for (const ch of pkg) h = (h * 31 + ch.charCodeAt(0)) % 360;
+  return "hsl(" + h + ",60%,75%)";
+}
+nodes.forEach((n, i) => { const a = i * 2.4; n.x = Math.cos(a) * 10 * Math.sqrt(i); n.y = Math.sin(a) * 10 * Math.sqrt(i); n.vx = 0; n.vy = 0; });
+
+function shown(i) { return visible.has(i) && !hidden.has(nodes[i].pkg); }
+function reveal(i) { visible.add(i); adj[i].forEach(j => visible.add(j)); }
+function reset() {
+  visible = new Set(); matches = new Set(); selected = -1;
+  nodes.forEach((n, i) => { if (n.focus) reveal(i); });
+  render();
+}
+
+let elems = [];
+function render() {
+  scene.textContent = "";
+  elems = [];
+  edges.forEach(e => {
+    if (!shown(e.source) || !shown(e.target)) return;
+    const l = document.createElementNS(NS, "line");
+    l.setAttribute("class", "edge" + (e.dynamic ? " dynamic" : ""));
+    l.setAttribute("marker-end", "url(#arrow)");
+    scene.appendChild(l);
+    elems.push({line: l, e});
+  });
+  nodes.forEach((n, i) => {
+    if (!shown(i)) return;
+    const g = document.createElementNS(NS, "g");
+    g.setAttribute("class", "node" + (n.focus ? " focus" : "") + (matches.has(i) ? " match" : "") + (i === selected ? " selected" : ""));
+    const c = document.createElementNS(NS, "circle");
+    c.setAttribute("r", 7);
+    c.setAttribute("fill", color(n.pkg));
+    const t = document.createElementNS(NS, "text");
+    t.setAttribute("x", 10); t.setAttribute("y", 4);
+    t.textContent = n.name;
+    const title = document.createElementNS(NS, "title");
+    title.textContent = n.id;
+    g.append(c, t, title);
+    g.addEventListener("mousedown", ev => { ev.stopPropagation(); drag = {node: n}; select(i); });
+    g.addEventListener("dblclick", ev => { ev.stopPropagation(); reveal(i); render(); });
+    scene.appendChild(g);
+    elems.push({g, n});
+  });
+  heat = 1;
+}
+
+function select(i) {
+  selected = i;
+  const n = nodes[i];
+  const callers = edges.filter(e => e.target === i).length, callees = edges.filter(e => e.source === i).length;
+  const d = document.getElementById("details");
+  d.textContent = "";
+  const b = document.createElement("b"); b.textContent = n.id;
+  d.append(b, document.createElement("br"), "Callers: " + callers + ", callees: " + callees + " in this export");
+}
+
+let heat = 1;
+function tick() {
+  if (heat > 0.01) {
+    const vs = [...visible].filter(shown).map(i => nodes[i]);
+    for (let a = 0; a < vs.length; a++) {
+      for (let b = a + 1; b < vs.length; b++) {
+        const p = vs[a], q = vs[b];
+        let dx = q.x - p.x, dy = q.y - p.y, d2 = dx * dx + dy * dy || 0.01;
+        const f = 900 / d2, d = Math.sqrt(d2);
+        dx /= d; dy /= d;
+        p.vx -= dx * f; p.vy -= dy * f; q.vx += dx * f; q.vy += dy * f;
+      }
+    }
+    edges.forEach(e => {
+      if (!shown(e.source) || !shown(e.target)) return;
+      const p = nodes[e.source], q = nodes[e.target];
+      const dx = q.x - p.x, dy = q.y - p.y, d = Math.sqrt(dx * dx + dy * dy) || 0.01;
+      const f = (d - 90) * 0.02;
+      p.vx += dx / d * f; p.vy += dy / d * f; q.vx -= dx / d * f; q.vy -= dy / d * f;
+    });
+    vs.forEach(n => {
+      n.vx -= n.x * 0.002; n.vy -= n.y * 0.002;
+      if (drag && drag.node === n) { n.vx = n.vy = 0; return; }
+      n.x += Math.max(-20, Math.min(20, n.vx * heat)); n.y += Math.max(-20, Math.min(20, n.vy * heat));
+      n.vx *= 0.5; n.vy *= 0.5;
+    });
+    heat *= 0.99;
+  }
+  elems.forEach(el => {
+    if (el.line) {
+      const p = nodes[el.e.source], q = nodes[el.e.target];
+      el.line.setAttribute("x1", p.x); el.line.setAttribute("y1", p.y);
+      el.line.setAttribute("x2", q.x); el.line.setAttribute("y2", q.y);
+    } else {
+      el.g.setAttribute("transform", "translate(" + el.n.x + "," + el.n.y + ")");
+    }
+  });
+  const r = svg.getBoundingClientRect();
+  scene.setAttribute("transform", "translate(" + (r.width / 2 + view.x) + "," + (r.height / 2 + view.y) + ") scale(" + view.k + ")");
+  requestAnimationFrame(tick);
+}
+
+let drag = null;
+svg.addEventListener("mousedown", ev => { drag = {pan: true, x: ev.clientX, y: ev.clientY}; });
+window.addEventListener("mousemove", ev => {
+  if (!drag) return;
+  if (drag.pan) {
+    view.x += ev.clientX - drag.x; view.y += ev.clientY - drag.y;
+    drag.x = ev.clientX; drag.y = ev.clientY;
+  } else {
+    const r = svg.getBoundingClientRect();
+    drag.node.x = (ev.clientX - r.left - r.width / 2 - view.x) / view.k;
+    drag.node.y = (ev.clientY - r.top - r.height / 2 - view.y) / view.k;
+    heat = Math.max(heat, 0.3);
+  }
+});
+window.addEventListener("mouseup", () => { drag = null; });
+svg.addEventListener("wheel", ev => { ev.preventDefault(); view.k *= ev.deltaY < 0 ? 1.1 : 1 / 1.1; }, {passive: false});
+
+document.getElementById("search").addEventListener("keydown", ev => {
+  if (ev.key !== "Enter") return;
+  const q = ev.target.value.trim().toLowerCase();
+  matches = new Set();
+  if (q) nodes.forEach((n, i) => { if (n.id.toLowerCase().includes(q)) { matches.add(i); visible.add(i); } });
+  render();
+});
+document.getElementById("all").addEventListener("click", () => { nodes.forEach((n, i) => visible.add(i)); render(); });
+document.getElementById("reset").addEventListener("click", reset);
+const pkgList = document.getElementById("pkgs");
+pkgs.forEach(p => {
+  const label = document.createElement("label"), box = document.createElement("input");
+  box.type = "checkbox"; box.checked = true;
+  box.addEventListener("change", () => { if (box.checked) hidden.delete(p); else hidden.add(p); render(); });
+  const swatch = document.createElement("span");
+  swatch.textContent = "● "; swatch.style.color = color(p);
+  label.title = p;
+  label.append(box, swatch, p);
+  pkgList.appendChild(label);
+});
+reset();
+requestAnimationFrame(tick);
+</script>
+</body>
+</html>
+`))
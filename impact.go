@@ -0,0 +1,461 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// impactCommentLimit caps the items listed per section of a PR comment.
+const impactCommentLimit = 50
+
+// lineRange is a span of changed lines, 1-based and inclusive.
+type lineRange struct{ From, To int }
+
+// hunkHeader matches the new-file part of a unified diff hunk header.
+var hunkHeader = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// changedLines returns the lines changed by spec, by absolute file path: a
+// git diff range such as origin/main...HEAD, diffed in the repository
+// containing dir, or a comma- or space-separated list of files, relative to
+// the repository root as git prints them, changed as a whole (nil ranges).
+// Deleted files count as changed as a whole.
+func changedLines(dir, spec string) (map[string][]lineRange, error) {
+	root := repoRoot(dir)
+	changed := make(map[string][]lineRange)
+	if !strings.Contains(spec, "..") {
+		for _, f := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == ' ' || r == '\n' }) {
+			if !filepath.IsAbs(f) {
+				f = filepath.Join(root, f)
+			}
+			changed[filepath.Clean(f)] = nil
+		}
+		return changed, nil
+	}
+	out, err := runGit(root, "diff", "--unified=0", "--no-color", "--no-ext-diff", spec, "--", "*.go")
+	if err != nil {
+		return nil, err
+	}
+	file, old := "", ""
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case strings.HasPrefix(line, "--- "):
+			old = ""
+			if path, ok := strings.CutPrefix(line, "--- a/"); ok {
+				old = path
+			}
+		case strings.HasPrefix(line, "+++ "):
+			file = ""
+			if path, ok := strings.CutPrefix(line, "+++ b/"); ok {
+				file = filepath.Join(root, path)
+				changed[file] = []lineRange{}
+			} else if line == "+++ /dev/null" && old != "" {
+				changed[filepath.Join(root, old)] = nil
+			}
+		case file != "" && strings.HasPrefix(line, "@@ "):
+			m := hunkHeader.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("git diff %s: bad hunk header %q", spec, line)
+			}
+			start, _ := strconv.Atoi(m[1])
+			count := 1
+			if m[2] != "" {
+				count, _ = strconv.Atoi(m[2])
+			}
+			r := lineRange{start, start + count - 1}
+			if count == 0 {
+				// A pure deletion: the lines around it.
+				r = lineRange{start, start + 1}
+			}
+			changed[file] = append(changed[file], r)
+		}
+	}
+	return changed, nil
+}
+
+// ImpactedFunc is a function changed, or reached from a changed one by
+// walking the call graph backwards.
+type ImpactedFunc struct {
+	FullName string `json:"full_name"`
+	Package  string `json:"package"`
+	File     string `json:"file"` // relative to the repository root
+	Line     int    `json:"line"`
+	Depth    int    `json:"depth"`         // calls away from a changed function; 0 if changed
+	Via      string `json:"via,omitempty"` // the affected function it calls on a shortest path
+}
+
+// ImpactedEndpoint is an HTTP route or gRPC method served by an affected
+// function.
+type ImpactedEndpoint struct {
+	Protocol string `json:"protocol"` // http or grpc
+	Name     string `json:"name"`     // "GET /orders/{id}" or /orders.v1.OrderService/GetOrder
+	Handler  string `json:"handler"`
+}
+
+// Impact is what a change can affect.
+type Impact struct {
+	Changed   []ImpactedFunc     `json:"changed"`
+	Affected  []ImpactedFunc     `json:"affected"` // callers of changed functions, transitively
+	Packages  []string           `json:"packages"` // of changed and affected functions
+	Endpoints []ImpactedEndpoint `json:"endpoints"`
+	Tests     []ImpactedFunc     `json:"tests"`
+}
+
+// ChangedFuncs returns the full names of the project functions whose lines
+// intersect changed, as returned by changedLines, with the closures they
+// contain. dir is the module directory.
+func (c *Collector) ChangedFuncs(dir string, changed map[string][]lineRange) []string {
+	var names []string
+	for name, fn := range c.Funcs {
+		if fn.File == "" {
+			continue
+		}
+		ranges, ok := changed[absFile(dir, fn.File)]
+		if !ok {
+			continue
+		}
+		end := max(fn.EndLine, fn.Line)
+		hit := ranges == nil
+		for _, r := range ranges {
+			if r.From <= end && r.To >= fn.Line {
+				hit = true
+			}
+		}
+		if hit {
+			names = append(names, name)
+		}
+	}
+	// Closures have no lines of their own; they change with their function.
+	for _, name := range names {
+		for closure := range c.Funcs {
+			if strings.HasPrefix(closure, name+"$") {
+				names = append(names, closure)
+			}
+		}
+	}
+	sort.Strings(names)
+	return slices.Compact(names)
+}
+
+// ImpactOf walks the call graph backwards from the changed functions, up
+// to maxDepth calls away (0 for no limit), and returns the functions,
+// packages, endpoints and tests they affect. dir is the module directory.
+func (c *Collector) ImpactOf(dir string, changed []string, maxDepth int) Impact {
+	root := repoRoot(dir)
+	impacted := func(name string, depth int, via string) *ImpactedFunc {
+		fn := c.Funcs[name]
+		file := absFile(dir, fn.File)
+		if rel, err := filepath.Rel(root, file); err == nil {
+			file = filepath.ToSlash(rel)
+		}
+		return &ImpactedFunc{FullName: name, Package: fn.Package, File: file, Line: fn.Line, Depth: depth, Via: via}
+	}
+	callers := make(map[string][]string)
+	for _, e := range c.Calls {
+		if _, ok := c.Funcs[e.CalleeFullName]; ok && !e.External {
+			callers[e.CalleeFullName] = append(callers[e.CalleeFullName], e.CallerFullName)
+		}
+	}
+	funcs := make(map[string]*ImpactedFunc)
+	queue := make([]string, 0, len(changed))
+	for _, name := range changed {
+		if _, ok := c.Funcs[name]; ok && funcs[name] == nil {
+			funcs[name] = impacted(name, 0, "")
+			queue = append(queue, name)
+		}
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		depth := funcs[name].Depth + 1
+		if maxDepth > 0 && depth > maxDepth {
+			continue
+		}
+		cs := callers[name]
+		sort.Strings(cs)
+		for _, caller := range cs {
+			if funcs[caller] == nil {
+				funcs[caller] = impacted(caller, depth, name)
+				queue = append(queue, caller)
+			}
+		}
+	}
+
+	imp := Impact{Changed: []ImpactedFunc{}, Affected: []ImpactedFunc{}, Packages: []string{}, Endpoints: []ImpactedEndpoint{}, Tests: []ImpactedFunc{}}
+	pkgs := make(map[string]bool)
+	for _, f := range funcs {
+		if f.Depth == 0 {
+			imp.Changed = append(imp.Changed, *f)
+		} else {
+			imp.Affected = append(imp.Affected, *f)
+		}
+		if isTestFunc(c.Funcs[f.FullName]) {
+			imp.Tests = append(imp.Tests, *f)
+		}
+		pkgs[f.Package] = true
+	}
+	for _, fs := range [][]ImpactedFunc{imp.Changed, imp.Affected, imp.Tests} {
+		sort.Slice(fs, func(i, j int) bool {
+			if fs[i].Depth != fs[j].Depth {
+				return fs[i].Depth < fs[j].Depth
+			}
+			return fs[i].FullName < fs[j].FullName
+		})
+	}
+	for p := range pkgs {
+		imp.Packages = append(imp.Packages, p)
+	}
+	sort.Strings(imp.Packages)
+
+	for _, ep := range c.Endpoints {
+		if funcs[ep.Handler] != nil {
+			name := strings.TrimSpace(ep.Method + " " + ep.Path)
+			imp.Endpoints = append(imp.Endpoints, ImpactedEndpoint{Protocol: "http", Name: name, Handler: ep.Handler})
+		}
+	}
+	for _, svc := range c.GRPCServices {
+		for _, m := range svc.Methods {
+			for _, impl := range m.Impls {
+				if funcs[impl] != nil {
+					name := "/" + svc.Name + "/" + m.Name
+					imp.Endpoints = append(imp.Endpoints, ImpactedEndpoint{Protocol: "grpc", Name: name, Handler: impl})
+				}
+			}
+		}
+	}
+	sort.Slice(imp.Endpoints, func(i, j int) bool {
+		a, b := imp.Endpoints[i], imp.Endpoints[j]
+		if a.Protocol != b.Protocol {
+			return a.Protocol > b.Protocol // http first
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Handler < b.Handler
+	})
+	return imp
+}
+
+// WriteImpactComment prints imp as Markdown for a pull request comment.
+func WriteImpactComment(w io.Writer, imp Impact) {
+	fmt.Fprintln(w, "### Call graph impact")
+	fmt.Fprintln(w)
+	if len(imp.Changed) == 0 {
+		fmt.Fprintln(w, "No Go functions changed.")
+		return
+	}
+	fmt.Fprintf(w, "%d changed functions affect %d more in %d packages, %d endpoints and %d tests.\n",
+		len(imp.Changed), len(imp.Affected), len(imp.Packages), len(imp.Endpoints), len(imp.Tests))
+
+	section := func(title string, n int, item func(i int) string) {
+		if n == 0 {
+			return
+		}
+		fmt.Fprintf(w, "\n<details><summary>%s (%d)</summary>\n\n", title, n)
+		for i := 0; i < n && i < impactCommentLimit; i++ {
+			fmt.Fprintf(w, "- %s\n", item(i))
+		}
+		if n > impactCommentLimit {
+			fmt.Fprintf(w, "- … and %d more\n", n-impactCommentLimit)
+		}
+		fmt.Fprintln(w, "\n</details>")
+	}
+	section("Endpoints", len(imp.Endpoints), func(i int) string {
+		e := imp.Endpoints[i]
+		return fmt.Sprintf("`%s` (%s) served by `%s`", e.Name, e.Protocol, e.Handler)
+	})
+	section("Changed functions", len(imp.Changed), func(i int) string {
+		f := imp.Changed[i]
+		return fmt.Sprintf("`%s` %s:%d", f.FullName, f.File, f.Line)
+	})
+	section("Affected functions", len(imp.Affected), func(i int) string {
+		f := imp.Affected[i]
+		return fmt.Sprintf("`%s` calls `%s` (depth %d)", f.FullName, f.Via, f.Depth)
+	})
+	section("Packages", len(imp.Packages), func(i int) string { return "`" + imp.Packages[i] + "`" })
+	section("Tests", len(imp.Tests), func(i int) string {
+		return fmt.Sprintf("`%s` (%s)", imp.Tests[i].FullName, imp.Tests[i].File)
+	})
+}
+
+// githubAnnotationLimit is the most annotations the GitHub Checks API
+// accepts in one request.
+const githubAnnotationLimit = 50
+
+// GitHubCheckOutput is the output of a GitHub check run, as sent to the
+// Checks API to create or update one.
+type GitHubCheckOutput struct {
+	Title       string             `json:"title"`
+	Summary     string             `json:"summary"` // Markdown
+	Annotations []GitHubAnnotation `json:"annotations"`
+}
+
+// GitHubAnnotation marks a line of a file of a check run.
+type GitHubAnnotation struct {
+	Path            string `json:"path"`
+	StartLine       int    `json:"start_line"`
+	EndLine         int    `json:"end_line"`
+	AnnotationLevel string `json:"annotation_level"` // notice, warning or failure
+	Title           string `json:"title"`
+	Message         string `json:"message"`
+}
+
+// GitHubImpact returns imp as the output of a check run: the PR comment as
+// summary, and a notice on every changed function listing what it affects.
+// Affected functions, endpoints and tests count toward the change they
+// reach first. Only the first githubAnnotationLimit changed functions
+// are annotated.
+func GitHubImpact(imp Impact) GitHubCheckOutput {
+	var summary strings.Builder
+	WriteImpactComment(&summary, imp)
+	out := GitHubCheckOutput{
+		Title:       fmt.Sprintf("%d changed functions affect %d more", len(imp.Changed), len(imp.Affected)),
+		Summary:     summary.String(),
+		Annotations: []GitHubAnnotation{},
+	}
+
+	via := make(map[string]string)
+	for _, f := range imp.Affected {
+		via[f.FullName] = f.Via
+	}
+	change := func(name string) string {
+		for via[name] != "" {
+			name = via[name]
+		}
+		return name
+	}
+	type reach struct {
+		callers   int
+		packages  map[string]bool
+		endpoints []string
+		tests     int
+	}
+	reached := make(map[string]*reach)
+	for _, f := range imp.Changed {
+		reached[f.FullName] = &reach{packages: make(map[string]bool)}
+	}
+	for _, f := range imp.Affected {
+		r := reached[change(f.FullName)]
+		r.callers++
+		r.packages[f.Package] = true
+	}
+	for _, e := range imp.Endpoints {
+		r := reached[change(e.Handler)]
+		r.endpoints = append(r.endpoints, "`"+e.Name+"`")
+	}
+	for _, f := range imp.Tests {
+		reached[change(f.FullName)].tests++
+	}
+
+	for _, f := range imp.Changed {
+		if len(out.Annotations) == githubAnnotationLimit {
+			break
+		}
+		if f.File == "" {
+			continue
+		}
+		r := reached[f.FullName]
+		msg := fmt.Sprintf("Called by %d functions in %d packages", r.callers, len(r.packages))
+		if len(r.endpoints) > 0 {
+			msg += fmt.Sprintf(", serving %d endpoints: %s", len(r.endpoints), strings.Join(r.endpoints, ", "))
+		}
+		msg += fmt.Sprintf(", reached by %d tests.", r.tests)
+		out.Annotations = append(out.Annotations, GitHubAnnotation{
+			Path: f.File, StartLine: f.Line, EndLine: f.Line, AnnotationLevel: "notice",
+			Title: "Impact of changing " + f.FullName, Message: msg,
+		})
+	}
+	return out
+}
+
+// analyzeInMemory loads the packages matching patterns in absDir, with
+// their tests if tests is set, and builds the call graph and interface
+// implementations, for the subcommands that analyse the project in memory.
+func analyzeInMemory(absDir, tags string, patterns []string, tests bool) (*Collector, error) {
+	modulePath, err := detectModulePath(absDir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot detect Go module: %w", err)
+	}
+	cfg := &packages.Config{
+		Mode:       loadMode,
+		Dir:        absDir,
+		BuildFlags: BuildConfig{Tags: splitList(tags)}.BuildFlags(),
+		Tests:      tests,
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load packages: %w", err)
+	}
+	if n := packages.PrintErrors(pkgs); n > 0 {
+		log.Printf("Warning: %d package errors (continuing anyway)", n)
+	}
+	collector := NewCollector(modulePath)
+	collector.CollectTypes(pkgs)
+	if err := collector.CollectCallGraph(pkgs); err != nil {
+		return nil, err
+	}
+	collector.CollectImplementsFromPackages(pkgs)
+	return collector, nil
+}
+
+// runImpact implements the impact subcommand.
+func runImpact(args []string) error {
+	cmd := flag.NewFlagSet("impact", flag.ExitOnError)
+	dir := cmd.String("dir", ".", "Project root directory")
+	spec := cmd.String("changed-files", "", "Changed files, comma-separated and relative to the repository root, or a git diff range such as origin/main...HEAD")
+	format := cmd.String("format", "json", "Output format: json, comment (Markdown for a pull request) or github (check run output with annotations)")
+	depth := cmd.Int("max-depth", 0, "Follow callers at most this many calls away from a change (0 = unlimited)")
+	tags := cmd.String("tags", "", "Comma-separated build tags for package loading")
+	cmd.Usage = func() {
+		fmt.Fprintln(cmd.Output(), "Usage: go-callgraph-neo4j impact --changed-files <files|range> [flags] [packages]")
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+	if *spec == "" || (*format != "json" && *format != "comment" && *format != "github") {
+		cmd.Usage()
+		os.Exit(1)
+	}
+	patterns := cmd.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	absDir, err := filepath.Abs(*dir)
+	if err != nil {
+		return err
+	}
+	changed, err := changedLines(absDir, *spec)
+	if err != nil {
+		return err
+	}
+	log.Printf("Changed Go files: %d", len(changed))
+	collector, err := analyzeInMemory(absDir, *tags, patterns, true)
+	if err != nil {
+		return err
+	}
+	imp := collector.ImpactOf(absDir, collector.ChangedFuncs(absDir, changed), *depth)
+	log.Printf("Impact: %d changed functions, %d affected, %d endpoints, %d tests",
+		len(imp.Changed), len(imp.Affected), len(imp.Endpoints), len(imp.Tests))
+	if *format == "comment" {
+		WriteImpactComment(os.Stdout, imp)
+		return nil
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if *format == "github" {
+		enc.SetEscapeHTML(false)
+		return enc.Encode(GitHubImpact(imp))
+	}
+	return enc.Encode(imp)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"sort"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// collectImports records the project packages imported by pkg.
+func (c *Collector) collectImports(pkg *packages.Package) {
+	node := c.Packages[pkg.PkgPath]
+	for path := range pkg.Imports {
+		if c.isProjectPackage(path) {
+			node.Imports = append(node.Imports, path)
+		}
+	}
+	sort.Strings(node.Imports)
+}
+
+// CollectInitOrder numbers the project packages in the order the Go runtime
+// initializes them: a package is initialized after all the packages it
+// imports, and among the packages that are ready, the one with the smallest
+// import path goes first (the rule since Go 1.21). It also counts each
+// package's init functions. Run it once all packages are collected.
+func (c *Collector) CollectInitOrder() {
+	for _, fn := range c.Funcs {
+		if p, ok := c.Packages[fn.Package]; ok && !fn.IsMethod && isInitFunc(fn.Name) && fn.Name != "init" {
+			p.InitFuncs++
+		}
+	}
+
+	pending := make(map[string]int) // package -> imports not yet initialized
+	importers := make(map[string][]string)
+	for path, p := range c.Packages {
+		for _, imp := range p.Imports {
+			if _, ok := c.Packages[imp]; ok {
+				pending[path]++
+				importers[imp] = append(importers[imp], path)
+			}
+		}
+	}
+	var ready []string
+	for path := range c.Packages {
+		if pending[path] == 0 {
+			ready = append(ready, path)
+		}
+	}
+	for order := 1; len(ready) > 0; order++ {
+		sort.Strings(ready)
+		path := ready[0]
+		ready = ready[1:]
+		c.Packages[path].InitOrder = order
+		for _, imp := range importers[path] {
+			if pending[imp]--; pending[imp] == 0 {
+				ready = append(ready, imp)
+			}
+		}
+	}
+}
+
+// isPackageInitializer reports whether name is the synthetic initializer
+// (pkg.init) of a project or dependency package.
+func (c *Collector) isPackageInitializer(name string) bool {
+	if fn, ok := c.Funcs[name]; ok {
+		return !fn.IsMethod && fn.FullName == fn.Package+".init"
+	}
+	if fn, ok := c.ExternalFuncs[name]; ok {
+		return fn.FullName == fn.Package+".init"
+	}
+	return false
+}
+
+// InitCalls returns the calls made while initializing project packages:
+// those of package-level variable initializers and of init functions, as
+// made by each package's synthetic initializer. Calls to the initializers
+// of imported packages are left out; they are INITIALIZES_BEFORE edges.
+// CallerFullName holds the import path of the package.
+func (c *Collector) InitCalls() []CallEdge {
+	var calls []CallEdge
+	for _, e := range c.Calls {
+		fn, ok := c.Funcs[e.CallerFullName]
+		if !ok || !c.isPackageInitializer(fn.FullName) || c.isPackageInitializer(e.CalleeFullName) {
+			continue
+		}
+		e.CallerFullName = fn.Package
+		calls = append(calls, e)
+	}
+	return calls
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// layerDirective is the comment directive naming the layer or bounded
+// context of a package: //callgraph:layer domain.
+const layerDirective = "//callgraph:layer"
+
+// Layer is a named architectural layer covering a set of packages. Layers
+// are ordered top-down: a layer may call the layers listed after it.
+type Layer struct {
+	Name     string
+	Patterns []string // module-relative package patterns
+
+	// Unordered layers, named only by directives, are bounded contexts
+	// rather than levels: calls between them have no direction.
+	Unordered bool
+}
+
+// parseLayers parses a --layers spec of the form
+// "handler=internal/handler/...;service=internal/service/...,internal/app;repo=internal/repo/...",
+// listing layers from top to bottom.
+func parseLayers(spec string) ([]Layer, error) {
+	var layers []Layer
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, patterns, ok := strings.Cut(part, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.TrimSpace(patterns) == "" {
+			return nil, fmt.Errorf("invalid layer %q: want name=pattern[,pattern...]", part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate layer %q", name)
+		}
+		seen[name] = true
+		l := Layer{Name: name}
+		for _, p := range strings.Split(patterns, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				l.Patterns = append(l.Patterns, p)
+			}
+		}
+		layers = append(layers, l)
+	}
+	return layers, nil
+}
+
+// parseLayersFile reads layer definitions from a file of
+// "name = pattern[, pattern...]" lines, listing layers from top to bottom.
+// '#' starts a comment.
+func parseLayersFile(path string) ([]Layer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open layers: %w", err)
+	}
+	defer f.Close()
+
+	var lines []string
+	sc := bufio.NewScanner(f)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if _, err := parseLayers(line); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		lines = append(lines, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	layers, err := parseLayers(strings.Join(lines, ";"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return layers, nil
+}
+
+// collectLayerDirective records the layer named by a //callgraph:layer
+// directive in the header or package doc comment of one of pkg's files,
+// the first found if several are.
+func (c *Collector) collectLayerDirective(pkg *packages.Package) {
+	for _, file := range pkg.Syntax {
+		for _, cg := range file.Comments {
+			if len(file.Decls) > 0 && cg.Pos() >= file.Decls[0].Pos() {
+				break
+			}
+			for _, comment := range cg.List {
+				name, ok := strings.CutPrefix(comment.Text, layerDirective+" ")
+				if name = strings.TrimSpace(name); ok && name != "" {
+					c.Packages[pkg.PkgPath].LayerDirective = name
+					return
+				}
+			}
+		}
+	}
+}
+
+// hasLayerDirectives reports whether a Go file under dir, outside the
+// directories the go command ignores, has a //callgraph:layer line before
+// its declarations. It lets a layer report without --layers fail before
+// the analysis when no package can name a layer.
+func hasLayerDirectives(dir string) bool {
+	found := false
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if found {
+			return filepath.SkipAll
+		}
+		if err != nil {
+			return nil // unreadable, like a file without directives
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != dir && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(name, ".go") {
+			found = fileHasLayerDirective(path)
+		}
+		return nil
+	})
+	return found
+}
+
+// fileHasLayerDirective reports whether the Go file at path has a
+// //callgraph:layer line before its first declaration.
+func fileHasLayerDirective(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if strings.HasPrefix(line, layerDirective+" ") {
+			return true
+		}
+		for _, decl := range []string{"func ", "type ", "var ", "const "} {
+			if strings.HasPrefix(line, decl) {
+				return false
+			}
+		}
+	}
+	return false
+}
+
+// AssignLayers sets PackageNode.Layer to the layer named by the package's
+// directive, or else to the first layer with a pattern matching the
+// package. Packages matching no layer are left unassigned. It returns
+// layers followed by the layers only named by directives, sorted by name;
+// those have no place in the top-down order.
+func (c *Collector) AssignLayers(layers []Layer) []Layer {
+	known := make(map[string]bool)
+	for _, l := range layers {
+		known[l.Name] = true
+	}
+	var extra []string
+	for path, pkg := range c.Packages {
+		pkg.Layer = pkg.LayerDirective
+		if pkg.Layer != "" {
+			if !known[pkg.Layer] {
+				known[pkg.Layer] = true
+				extra = append(extra, pkg.Layer)
+			}
+			continue
+		}
+		for _, l := range layers {
+			if c.matchAnyPackage(l.Patterns, path) {
+				pkg.Layer = l.Name
+				break
+			}
+		}
+	}
+	sort.Strings(extra)
+	all := slices.Clone(layers)
+	for _, name := range extra {
+		all = append(all, Layer{Name: name, Unordered: true})
+	}
+	return all
+}
+
+// matchAnyPackage reports whether pkgPath matches one of patterns.
+func (c *Collector) matchAnyPackage(patterns []string, pkgPath string) bool {
+	for _, p := range patterns {
+		if c.matchPackage(p, pkgPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// funcLayer returns the layer of the package declaring the named function.
+func (c *Collector) funcLayer(name string) string {
+	fn, ok := c.Funcs[name]
+	if !ok {
+		return ""
+	}
+	if pkg, ok := c.Packages[fn.Package]; ok {
+		return pkg.Layer
+	}
+	return ""
+}
+
+// LayerTransition aggregates the calls from one layer into another.
+type LayerTransition struct {
+	From, To  string
+	Sites     int    // static call sites
+	Direction string // "down", "skip" (bypasses a layer), "up" (against the intended order) or "across" (between unordered layers)
+}
+
+// layerOrder returns the position of each ordered layer, top first.
+func layerOrder(layers []Layer) map[string]int {
+	order := make(map[string]int, len(layers))
+	for i, l := range layers {
+		if !l.Unordered {
+			order[l.Name] = i
+		}
+	}
+	return order
+}
+
+// layerDirection classifies a dependency of layer from on layer to, as in
+// LayerTransition.
+func layerDirection(order map[string]int, from, to string) string {
+	f, ok1 := order[from]
+	t, ok2 := order[to]
+	switch d := t - f; {
+	case !ok1 || !ok2:
+		return "across"
+	case d < 0:
+		return "up"
+	case d > 1:
+		return "skip"
+	}
+	return "down"
+}
+
+// LayerChain is a sequence of layers connected through a function that is
+// called across a layer boundary and itself calls across another.
+type LayerChain struct {
+	Layers  []string
+	Weight  int      // number of caller→via→callee function paths, weighted by call sites
+	Example []string // the heaviest function path
+}
+
+// LayerHotPaths computes layer transitions and the most frequent
+// three-layer chains. Weights are static call-site counts.
+func (c *Collector) LayerHotPaths(layers []Layer) ([]LayerTransition, []LayerChain) {
+	order := layerOrder(layers)
+
+	type hop struct{ from, to string }
+	sites := make(map[hop]int) // function-level cross-layer hop -> call sites
+	trans := make(map[hop]int) // layer-level transition -> call sites
+	for _, e := range c.Calls {
+		lf, lt := c.funcLayer(e.CallerFullName), c.funcLayer(e.CalleeFullName)
+		if lf == "" || lt == "" || lf == lt {
+			continue
+		}
+		sites[hop{e.CallerFullName, e.CalleeFullName}] += e.Count
+		trans[hop{lf, lt}] += e.Count
+	}
+
+	var transitions []LayerTransition
+	for t, n := range trans {
+		transitions = append(transitions, LayerTransition{From: t.from, To: t.to, Sites: n, Direction: layerDirection(order, t.from, t.to)})
+	}
+	sort.Slice(transitions, func(i, j int) bool {
+		if transitions[i].Sites != transitions[j].Sites {
+			return transitions[i].Sites > transitions[j].Sites
+		}
+		return transitions[i].From+transitions[i].To < transitions[j].From+transitions[j].To
+	})
+
+	in := make(map[string][]hop)
+	out := make(map[string][]hop)
+	for h := range sites {
+		in[h.to] = append(in[h.to], h)
+		out[h.from] = append(out[h.from], h)
+	}
+	chains := make(map[string]*LayerChain)
+	best := make(map[string]int)
+	for via, ins := range in {
+		for _, a := range ins {
+			for _, b := range out[via] {
+				ls := []string{c.funcLayer(a.from), c.funcLayer(via), c.funcLayer(b.to)}
+				key := strings.Join(ls, "→")
+				w := sites[a] * sites[b]
+				ch, ok := chains[key]
+				if !ok {
+					ch = &LayerChain{Layers: ls}
+					chains[key] = ch
+				}
+				ch.Weight += w
+				if w > best[key] {
+					best[key] = w
+					ch.Example = []string{a.from, via, b.to}
+				}
+			}
+		}
+	}
+	result := make([]LayerChain, 0, len(chains))
+	for _, ch := range chains {
+		result = append(result, *ch)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Weight != result[j].Weight {
+			return result[i].Weight > result[j].Weight
+		}
+		return strings.Join(result[i].Layers, "→") < strings.Join(result[j].Layers, "→")
+	})
+	return transitions, result
+}
+
+// LayerDependency aggregates the imports and calls from the packages of
+// one layer into those of another.
+type LayerDependency struct {
+	From, To  string
+	Imports   int    // package imports
+	Calls     int    // static call sites
+	Direction string // as in LayerTransition
+}
+
+// LayerDependencies returns the dependencies between the layers assigned
+// by AssignLayers, sorted by layer names.
+func (c *Collector) LayerDependencies(layers []Layer) []LayerDependency {
+	order := layerOrder(layers)
+	deps := make(map[[2]string]*LayerDependency)
+	dep := func(from, to string) *LayerDependency {
+		key := [2]string{from, to}
+		if deps[key] == nil {
+			deps[key] = &LayerDependency{From: from, To: to, Direction: layerDirection(order, from, to)}
+		}
+		return deps[key]
+	}
+	for _, p := range c.Packages {
+		for _, imp := range p.Imports {
+			if q, ok := c.Packages[imp]; ok && p.Layer != "" && q.Layer != "" && p.Layer != q.Layer {
+				dep(p.Layer, q.Layer).Imports++
+			}
+		}
+	}
+	for _, e := range c.Calls {
+		from, to := c.funcLayer(e.CallerFullName), c.funcLayer(e.CalleeFullName)
+		if from != "" && to != "" && from != to {
+			dep(from, to).Calls += e.Count
+		}
+	}
+	result := make([]LayerDependency, 0, len(deps))
+	for _, d := range deps {
+		result = append(result, *d)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].From != result[j].From {
+			return result[i].From < result[j].From
+		}
+		return result[i].To < result[j].To
+	})
+	return result
+}
+
+// WriteLayerReport prints layer transitions and the top n layer chains.
+func WriteLayerReport(w io.Writer, transitions []LayerTransition, chains []LayerChain, n int) {
+	fmt.Fprintln(w, "Layer transitions (static call sites):")
+	if len(transitions) == 0 {
+		fmt.Fprintln(w, "  none")
+	}
+	for _, t := range transitions {
+		fmt.Fprintf(w, "  %6d  %s → %s (%s)\n", t.Sites, t.From, t.To, t.Direction)
+	}
+
+	fmt.Fprintln(w, "\nHot layer chains:")
+	if len(chains) == 0 {
+		fmt.Fprintln(w, "  none")
+	}
+	for i, ch := range chains {
+		if i >= n {
+			break
+		}
+		fmt.Fprintf(w, "  %6d  %s\n", ch.Weight, strings.Join(ch.Layers, " → "))
+		fmt.Fprintf(w, "          e.g. %s\n", strings.Join(ch.Example, " → "))
+	}
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
 )
@@ -12,16 +15,65 @@ import (
 // using batch UNWIND queries.
 type Neo4jLoader struct {
 	driver neo4j.DriverWithContext
-	ctx    context.Context
+	ctx    context.Context // runs statements; never cancelled
+	stop   context.Context // cancelled to stop the load between statements
+
+	// MaxBatchBytes caps the estimated serialized size of a single UNWIND
+	// batch; larger batches are split into shards.
+	MaxBatchBytes int
+
+	// Names renames the labels, relationship types and indexes of every
+	// statement; nil keeps the default names.
+	Names *GraphNames
+
+	// Project scopes every statement to the project's part of a shared
+	// database, stamping what it writes with a project property; empty
+	// leaves statements unscoped.
+	Project string
+
+	// Checkpoint, if set, records the steps and statements of the load
+	// that completed, and skips those completed before an interruption.
+	Checkpoint *Checkpoint
+
+	// Metrics, if set, measures the latency and errors of the statements.
+	Metrics *Metrics
+
+	step             string         // the step RunStep is running, naming its progress
+	iterateBatchSize int            // rows per apoc.periodic.iterate transaction; 0 without UseAPOCIterate
+	version          *ServerVersion // the server's version, once asked
 }
 
+// defaultMaxBatchBytes keeps batches well below sizes that make the server
+// reject or choke on a single Bolt message.
+const defaultMaxBatchBytes = 4 << 20
+
 // NewNeo4jLoader connects to Neo4j and returns a ready-to-use loader.
+// Cancelling ctx stops the load once the statement running completes, so
+// that the checkpoint matches what was written.
 func NewNeo4jLoader(ctx context.Context, uri, user, password string) (*Neo4jLoader, error) {
 	driver, err := neo4j.NewDriverWithContext(uri, neo4j.BasicAuth(user, password, ""))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create neo4j driver: %w", err)
 	}
-	return &Neo4jLoader{driver: driver, ctx: ctx}, nil
+	l := &Neo4jLoader{driver: driver, ctx: context.WithoutCancel(ctx), stop: ctx, MaxBatchBytes: defaultMaxBatchBytes}
+	if scheme, _, _ := strings.Cut(uri, "://"); strings.HasPrefix(scheme, "bolt") {
+		l.warnIfClustered()
+	}
+	return l, nil
+}
+
+// warnIfClustered warns when the loader connects directly to a member of
+// a cluster, which rejects writes unless it leads the database. Servers
+// that are not clustered, or do not tell, get no warning.
+func (l *Neo4jLoader) warnIfClustered() {
+	res, err := neo4j.ExecuteQuery(l.ctx, l.driver, "CALL dbms.cluster.overview() YIELD id RETURN count(id) AS members",
+		nil, neo4j.EagerResultTransformer)
+	if err != nil || len(res.Records) == 0 {
+		return
+	}
+	if members, _, _ := neo4j.GetRecordValue[int64](res.Records[0], "members"); members > 1 {
+		log.Printf("Warning: connected with bolt:// to one of %d cluster members; use a neo4j:// URI to route writes to the leader", members)
+	}
 }
 
 // Close releases the underlying Neo4j driver resources.
@@ -29,26 +81,540 @@ func (l *Neo4jLoader) Close() {
 	l.driver.Close(l.ctx)
 }
 
-// runCypher runs a single Cypher statement with optional parameters.
+// runCypher runs a single Cypher statement with optional parameters: a
+// write statement of the load, counted by Checkpoint. Once the loader's
+// context is cancelled, it fails without running the statement.
 func (l *Neo4jLoader) runCypher(cypher string, params map[string]any) error {
-	_, err := neo4j.ExecuteQuery(l.ctx, l.driver, cypher, params, neo4j.EagerResultTransformer)
-	return err
+	if err := l.stop.Err(); err != nil {
+		return fmt.Errorf("load interrupted: %w", err)
+	}
+	if l.Checkpoint == nil {
+		_, err := l.query(cypher, params)
+		return err
+	}
+	if l.Checkpoint.skipStatement() {
+		return nil
+	}
+	if _, err := l.query(cypher, params); err != nil {
+		return err
+	}
+	return l.Checkpoint.statementDone()
+}
+
+// RunStep runs step name of a load with Checkpoint: not at all if it
+// completed before an interruption, else past the statements it completed
+// then, or from its start if restart is set, for steps whose statements
+// depend on what the graph already holds.
+func (l *Neo4jLoader) RunStep(name string, restart bool, run func() error) error {
+	l.step = name
+	defer func() { l.step = "" }()
+	if l.Checkpoint == nil {
+		return run()
+	}
+	if l.Checkpoint.done(name) {
+		log.Printf("Skipping %s, done before the interruption", name)
+		return nil
+	}
+	if err := l.Checkpoint.begin(name, restart); err != nil {
+		return err
+	}
+	if err := run(); err != nil {
+		return err
+	}
+	return l.Checkpoint.finish()
+}
+
+// query runs a single Cypher statement, which a cluster routes to its
+// leader, and returns its records.
+func (l *Neo4jLoader) query(cypher string, params map[string]any) (*neo4j.EagerResult, error) {
+	return l.execute(cypher, params, neo4j.ExecuteQueryWithWritersRouting())
+}
+
+// read runs a single read-only Cypher statement, which a cluster may route
+// to a follower, and returns its records. The driver's bookmarks make the
+// follower wait until it has the writes of the load.
+func (l *Neo4jLoader) read(cypher string, params map[string]any) (*neo4j.EagerResult, error) {
+	return l.execute(cypher, params, neo4j.ExecuteQueryWithReadersRouting())
+}
+
+// execute runs a single Cypher statement with routing and returns its
+// records.
+func (l *Neo4jLoader) execute(cypher string, params map[string]any, routing neo4j.ExecuteQueryConfigurationOption) (*neo4j.EagerResult, error) {
+	cypher, params, err := l.prepare(cypher, params)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	res, err := neo4j.ExecuteQuery(l.ctx, l.driver, cypher, params, neo4j.EagerResultTransformer, routing)
+	l.Metrics.ObserveQuery(time.Since(start), err)
+	return res, err
+}
+
+// stream runs a single read-only Cypher statement like read, but passes
+// each record to visit as it arrives instead of holding them all. It is
+// not retried, since visit may have seen records already.
+func (l *Neo4jLoader) stream(cypher string, params map[string]any, visit func(*neo4j.Record) error) error {
+	cypher, params, err := l.prepare(cypher, params)
+	if err != nil {
+		return err
+	}
+	session := l.driver.NewSession(l.ctx, neo4j.SessionConfig{
+		AccessMode:      neo4j.AccessModeRead,
+		BookmarkManager: l.driver.ExecuteQueryBookmarkManager(),
+	})
+	defer session.Close(l.ctx)
+	res, err := session.Run(l.ctx, cypher, params)
+	if err != nil {
+		return err
+	}
+	for res.Next(l.ctx) {
+		if err := visit(res.Record()); err != nil {
+			return err
+		}
+	}
+	return res.Err()
+}
+
+// prepare returns a statement with Names, scoped to Project and rewritten
+// for the server's version, with its parameters.
+func (l *Neo4jLoader) prepare(cypher string, params map[string]any) (string, map[string]any, error) {
+	version, err := l.ServerVersion()
+	if err != nil {
+		return "", nil, err
+	}
+	cypher = l.Names.Rewrite(cypher)
+	if l.Project != "" {
+		cypher, params = scopeToProject(cypher, "$project"), withProject(params, l.Project)
+	}
+	if !version.AtLeast(5, 0) {
+		cypher = cypher4(cypher)
+	}
+	return cypher, params, nil
+}
+
+// minServerVersion is the oldest Neo4j the statements can be rewritten for.
+var minServerVersion = ServerVersion{Major: 4, Minor: 4}
+
+// ServerVersion returns the version of the Neo4j server, asked on first
+// use. Servers older than minServerVersion are an error.
+func (l *Neo4jLoader) ServerVersion() (ServerVersion, error) {
+	if l.version != nil {
+		return *l.version, nil
+	}
+	res, err := neo4j.ExecuteQuery(l.ctx, l.driver,
+		"CALL dbms.components() YIELD name, versions WHERE name = 'Neo4j Kernel' RETURN versions[0] AS version",
+		nil, neo4j.EagerResultTransformer, neo4j.ExecuteQueryWithReadersRouting())
+	if err != nil {
+		return ServerVersion{}, fmt.Errorf("cannot read the Neo4j version: %w", err)
+	}
+	if len(res.Records) == 0 {
+		return ServerVersion{}, fmt.Errorf("cannot read the Neo4j version: no Neo4j Kernel component")
+	}
+	text, _, _ := neo4j.GetRecordValue[string](res.Records[0], "version")
+	version, err := parseServerVersion(text)
+	if err != nil {
+		return ServerVersion{}, err
+	}
+	if !version.AtLeast(minServerVersion.Major, minServerVersion.Minor) {
+		return ServerVersion{}, fmt.Errorf("Neo4j %s is not supported: want %s or later", text, minServerVersion)
+	}
+	l.version = &version
+	return version, nil
+}
+
+// runBatch runs an UNWIND $batch statement, splitting the rows into shards
+// whose estimated serialized size stays under MaxBatchBytes, and merging
+// relationships through apoc.periodic.iterate after UseAPOCIterate. With a
+// Checkpoint, the rows are ordered first so that a resumed load gets the
+// same shards.
+func (l *Neo4jLoader) runBatch(cypher string, batch []map[string]any) error {
+	if l.Checkpoint != nil {
+		if err := sortRows(batch); err != nil {
+			return err
+		}
+	}
+	shards, err := shardBatch(batch, l.MaxBatchBytes)
+	if err != nil {
+		return err
+	}
+	if iterate, ok := l.iterateStatement(cypher); ok {
+		cypher = iterate
+	}
+	name := "Writing batches"
+	if l.step != "" {
+		name = "Writing " + l.step
+	}
+	writing := startProgress(name, len(batch), "rows")
+	defer writing.Finish()
+	for i, shard := range shards {
+		if err := l.runCypher(cypher, map[string]any{"batch": shard}); err != nil {
+			return fmt.Errorf("batch shard %d/%d (%d rows): %w", i+1, len(shards), len(shard), err)
+		}
+		writing.Add(len(shard))
+	}
+	return nil
+}
+
+// shardBatch splits rows into consecutive shards of at most maxBytes each,
+// estimating row size by its JSON encoding. A row that alone exceeds
+// maxBytes is reported as an error naming the offending row.
+func shardBatch(rows []map[string]any, maxBytes int) ([][]map[string]any, error) {
+	var shards [][]map[string]any
+	var cur []map[string]any
+	curBytes := 0
+	for _, row := range rows {
+		data, err := json.Marshal(row)
+		if err != nil {
+			return nil, fmt.Errorf("cannot estimate size of row %s: %w", describeRow(row), err)
+		}
+		size := len(data)
+		if size > maxBytes {
+			return nil, fmt.Errorf("row %s is %d bytes, over the %d byte batch limit (raise --batch-max-bytes)",
+				describeRow(row), size, maxBytes)
+		}
+		if curBytes+size > maxBytes && len(cur) > 0 {
+			shards = append(shards, cur)
+			cur, curBytes = nil, 0
+		}
+		cur = append(cur, row)
+		curBytes += size
+	}
+	if len(cur) > 0 {
+		shards = append(shards, cur)
+	}
+	return shards, nil
+}
+
+// describeRow identifies a batch row in diagnostics by its key property.
+func describeRow(row map[string]any) string {
+	for _, k := range []string{"fullname", "key", "path", "caller"} {
+		if v, ok := row[k]; ok {
+			return fmt.Sprintf("%s=%v", k, v)
+		}
+	}
+	return fmt.Sprintf("with %d fields", len(row))
+}
+
+// nullIfEmpty maps "" to nil so that SET removes the property instead of
+// storing an empty string.
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// nullIfZero maps the zero time to nil, like nullIfEmpty.
+func nullIfZero(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+// coveredPct returns fn's covered_pct, or nil if the coverage profile has
+// no statements of fn.
+func coveredPct(fn *FuncNode) any {
+	if fn.CoverStmts == 0 {
+		return nil
+	}
+	return fn.CoveredPct
+}
+
+// nullIfNoID maps the zero component number (scc_id, cycle_id) to nil.
+func nullIfNoID(id int) any {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// nullIfNoScore maps the zero hotspot score to nil.
+func nullIfNoScore(score float64) any {
+	if score == 0 {
+		return nil
+	}
+	return score
+}
+
+// nullIfNone maps an empty list to nil, like nullIfEmpty.
+func nullIfNone(list []string) any {
+	if len(list) == 0 {
+		return nil
+	}
+	return list
 }
 
 // CleanGraph removes all previously loaded call-graph nodes and relationships.
 func (l *Neo4jLoader) CleanGraph() error {
-	log.Println("Cleaning existing accurate graph data...")
+	if l.Project != "" {
+		log.Printf("Cleaning existing accurate graph data of project %s...", l.Project)
+	} else {
+		log.Println("Cleaning existing accurate graph data...")
+	}
+	if err := l.deleteEdges(); err != nil {
+		return err
+	}
 	queries := []string{
-		"MATCH ()-[r:ACCURATE_CALLS]->() DELETE r",
-		"MATCH ()-[r:IMPLEMENTS]->() DELETE r",
-		"MATCH ()-[r:IN_PACKAGE]->() DELETE r",
-		"MATCH ()-[r:HAS_METHOD]->() DELETE r",
 		"MATCH (n:GoPackage) DETACH DELETE n",
+		"MATCH (n:GoFile) DETACH DELETE n",
 		"MATCH (n:GoFunc) DETACH DELETE n",
 		"MATCH (n:GoStruct) DETACH DELETE n",
 		"MATCH (n:GoInterface) DETACH DELETE n",
+		"MATCH (n:GoNamedType) DETACH DELETE n",
+		"MATCH (n:GoAlias) DETACH DELETE n",
+		"MATCH (n:GoModule) DETACH DELETE n",
+		"MATCH (n:GoAnalysis) DETACH DELETE n",
+		"MATCH (n:HttpEndpoint) DETACH DELETE n",
+		"MATCH (n:GrpcService) DETACH DELETE n",
+		"MATCH (n:GrpcMethod) DETACH DELETE n",
+		"MATCH (n:SqlQuery) DETACH DELETE n",
+		"MATCH (n:DbTable) DETACH DELETE n",
+		"MATCH (n:Topic) DETACH DELETE n",
+		"MATCH (n:EnvVar) DETACH DELETE n",
+		"MATCH (n:ConfigKey) DETACH DELETE n",
+		"MATCH (n:HttpRequest) DETACH DELETE n",
+		"MATCH (n:SyncVar) DETACH DELETE n",
+		"MATCH (n:Layer) DETACH DELETE n",
+	}
+	for _, q := range queries {
+		if err := l.runCypher(q, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CleanEdges removes all previously loaded relationships and keeps the
+// nodes, so that a load recreates the edges between them.
+func (l *Neo4jLoader) CleanEdges() error {
+	log.Println("Cleaning existing accurate graph relationships...")
+	return l.deleteEdges()
+}
+
+// deleteEdges deletes the relationships of every type the loader writes.
+func (l *Neo4jLoader) deleteEdges() error {
+	queries := []string{
+		"MATCH ()-[r:ACCURATE_CALLS]->() DELETE r",
+		"MATCH ()-[r:CALLS_EXTERNAL]->() DELETE r",
+		"MATCH ()-[r:IMPLEMENTS]->() DELETE r",
+		"MATCH ()-[r:SATISFIES]->() DELETE r",
+		"MATCH ()-[r:ALIAS_OF]->() DELETE r",
+		"MATCH ()-[r:REQUIRES]->() DELETE r",
+		"MATCH ()-[r:IN_MODULE]->() DELETE r",
+		"MATCH ()-[r:REACHES_VULN]->() DELETE r",
+		"MATCH ()-[r:IN_PACKAGE]->() DELETE r",
+		"MATCH ()-[r:HAS_METHOD]->() DELETE r",
+		"MATCH ()-[r:RUNTIME_CALLS]->() DELETE r",
+		"MATCH ()-[r:CONTAINS]->() DELETE r",
+		"MATCH ()-[r:DEFINED_IN]->() DELETE r",
+		"MATCH ()-[r:INITIALIZES_BEFORE]->() DELETE r",
+		"MATCH ()-[r:INIT_CALLS]->() DELETE r",
+		"MATCH ()-[r:HANDLED_BY]->() DELETE r",
+		"MATCH ()-[r:HAS_RPC]->() DELETE r",
+		"MATCH ()-[r:IMPLEMENTED_BY]->() DELETE r",
+		"MATCH ()-[r:EXECUTES]->() DELETE r",
+		"MATCH ()-[r:READS_TABLE]->() DELETE r",
+		"MATCH ()-[r:WRITES_TABLE]->() DELETE r",
+		"MATCH ()-[r:PUBLISHES_TO]->() DELETE r",
+		"MATCH ()-[r:CONSUMES_FROM]->() DELETE r",
+		"MATCH ()-[r:READS_CONFIG]->() DELETE r",
+		"MATCH ()-[r:SENDS_REQUEST]->() DELETE r",
+		"MATCH ()-[r:CALLS_SERVICE]->() DELETE r",
+		"MATCH ()-[r:PROVIDES]->() DELETE r",
+		"MATCH ()-[r:INJECTS]->() DELETE r",
+		"MATCH ()-[r:PASSES_FUNC]->() DELETE r",
+		"MATCH ()-[r:REGISTERED_AS]->() DELETE r",
+		"MATCH ()-[r:MAY_PANIC]->() DELETE r",
+		"MATCH ()-[r:PROPAGATES_ERROR_TO]->() DELETE r",
+		"MATCH ()-[r:IGNORES_ERROR]->() DELETE r",
+		"MATCH ()-[r:GUARDS]->() DELETE r",
+		"MATCH ()-[r:LOCKS]->() DELETE r",
+		"MATCH ()-[r:IN_LAYER]->() DELETE r",
+		"MATCH ()-[r:LAYER_DEPENDS_ON]->() DELETE r",
+	}
+	for _, q := range queries {
+		if err := l.runCypher(q, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CleanPackages removes the packages with the given import paths: their
+// GoPackage nodes, files, functions and types, with all their
+// relationships. Calls from other packages into them are recreated by the
+// next load of the packages.
+func (l *Neo4jLoader) CleanPackages(paths []string) error {
+	log.Printf("Cleaning %d packages...", len(paths))
+	queries := []string{
+		"MATCH (n:GoFunc) WHERE n.package IN $paths DETACH DELETE n",
+		"MATCH (n:GoStruct|GoInterface|GoNamedType|GoAlias) WHERE n.package IN $paths DETACH DELETE n",
+		"MATCH (n:GoFile) WHERE n.package IN $paths DETACH DELETE n",
+		"MATCH (n:GoPackage) WHERE n.import_path IN $paths DETACH DELETE n",
 	}
 	for _, q := range queries {
+		if err := l.runCypher(q, map[string]any{"paths": paths}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarkRemoved stamps the live nodes with loadedAt, the start of the load,
+// and marks the nodes of their labels in the packages of module that the
+// load did not write, which are gone from the code, with deleted: true and
+// deleted_at. Nodes of other modules, such as dependency functions or the
+// code of another module loaded into the same database, are left alone.
+// Nodes that come back lose the mark.
+func (l *Neo4jLoader) MarkRemoved(module string, live []LiveNodes, loadedAt time.Time) error {
+	log.Println("Marking removed nodes...")
+	for _, nodes := range live {
+		batch := make([]map[string]any, 0, len(nodes.Values))
+		for _, v := range nodes.Values {
+			batch = append(batch, map[string]any{"key": v, "at": loadedAt})
+		}
+		err := l.runBatch(
+			`UNWIND $batch AS row
+			 MATCH (n:`+nodes.Label+` {`+nodes.Key+`: row.key})
+			 SET n.loaded_at = row.at
+			 REMOVE n.deleted, n.deleted_at`,
+			batch,
+		)
+		if err != nil {
+			return err
+		}
+		res, err := l.query(
+			`MATCH (n:`+nodes.Label+`)
+			 WHERE (n.`+nodes.Package+` = $module OR n.`+nodes.Package+` STARTS WITH $module + '/')
+			   AND n.deleted IS NULL AND (n.loaded_at IS NULL OR n.loaded_at < $at)
+			 SET n.deleted = true, n.deleted_at = $at
+			 RETURN count(n) AS removed`,
+			map[string]any{"module": module, "at": loadedAt})
+		if err != nil {
+			return err
+		}
+		if removed, _, _ := neo4j.GetRecordValue[int64](res.Records[0], "removed"); removed > 0 {
+			log.Printf("Marked %d removed %s nodes", removed, nodes.Label)
+		}
+	}
+	return nil
+}
+
+// CountNodes returns how many nodes of the label of nodes have one of
+// its key values; more than the values means duplicates.
+func (l *Neo4jLoader) CountNodes(nodes LiveNodes) (int64, error) {
+	var total int64
+	err := l.readBatches(nodes.Values,
+		`UNWIND $batch AS key
+		 MATCH (n:`+nodes.Label+` {`+nodes.Key+`: key})
+		 RETURN count(n) AS found`,
+		func(rec *neo4j.Record) {
+			found, _, _ := neo4j.GetRecordValue[int64](rec, "found")
+			total += found
+		})
+	return total, err
+}
+
+// MissingCalls returns the calls that have no ACCURATE_CALLS or
+// CALLS_EXTERNAL edge between their functions.
+func (l *Neo4jLoader) MissingCalls(calls []CallEdge) ([]CallEdge, error) {
+	ids := make([]string, len(calls))
+	byID := make(map[string]CallEdge, len(calls))
+	for i, c := range calls {
+		ids[i] = funcID(c.CallerFullName) + ">" + funcID(c.CalleeFullName)
+		byID[ids[i]] = c
+	}
+	var missing []CallEdge
+	err := l.readBatches(ids,
+		`UNWIND $batch AS pair
+		 WITH pair, split(pair, '>') AS ends
+		 WHERE NOT EXISTS { (:GoFunc {id: ends[0]})-[:ACCURATE_CALLS|CALLS_EXTERNAL]->(:GoFunc {id: ends[1]}) }
+		 RETURN pair`,
+		func(rec *neo4j.Record) {
+			pair, _, _ := neo4j.GetRecordValue[string](rec, "pair")
+			missing = append(missing, byID[pair])
+		})
+	return missing, err
+}
+
+// Placeholders returns the full names of the functions with the given ids
+// that are stored as bare placeholders, without a package.
+func (l *Neo4jLoader) Placeholders(ids []string) ([]string, error) {
+	var names []string
+	err := l.readBatches(ids,
+		`UNWIND $batch AS id
+		 MATCH (f:GoFunc {id: id}) WHERE f.package IS NULL
+		 RETURN f.full_name AS name`,
+		func(rec *neo4j.Record) {
+			name, _, _ := neo4j.GetRecordValue[string](rec, "name")
+			names = append(names, name)
+		})
+	return names, err
+}
+
+// readBatches runs an UNWIND $batch query over values in shards of
+// readBatchSize and passes each record to visit.
+func (l *Neo4jLoader) readBatches(values []string, cypher string, visit func(*neo4j.Record)) error {
+	for start := 0; start < len(values); start += readBatchSize {
+		res, err := l.read(cypher, map[string]any{"batch": values[start:min(start+readBatchSize, len(values))]})
+		if err != nil {
+			return fmt.Errorf("failed to read back the graph: %w", err)
+		}
+		for _, rec := range res.Records {
+			visit(rec)
+		}
+	}
+	return nil
+}
+
+// readBatchSize is how many keys a read-back query looks up at once.
+const readBatchSize = 10000
+
+// orphanFuncs matches the GoFunc placeholders LoadCalls merges for call
+// ends that never got a package: functions of an earlier load that are
+// gone, or calls loaded without their functions. The External symbols
+// LoadVulns merges have no package or file either, but they are not
+// placeholders.
+const orphanFuncs = "MATCH (f:GoFunc) WHERE f.package IS NULL AND f.file IS NULL AND NOT f:External"
+
+// Orphans returns the full names of the placeholder functions that
+// DeleteOrphans removes.
+func (l *Neo4jLoader) Orphans() ([]string, error) {
+	res, err := l.read(orphanFuncs+" RETURN f.full_name AS name ORDER BY name", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read orphan functions: %w", err)
+	}
+	names := make([]string, 0, len(res.Records))
+	for _, rec := range res.Records {
+		name, _, _ := neo4j.GetRecordValue[string](rec, "name")
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// DeleteOrphans removes the placeholder functions with their calls and
+// returns how many there were.
+func (l *Neo4jLoader) DeleteOrphans() (int64, error) {
+	res, err := l.query(orphanFuncs+" DETACH DELETE f RETURN count(f) AS deleted", nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete orphan functions: %w", err)
+	}
+	deleted, _, _ := neo4j.GetRecordValue[int64](res.Records[0], "deleted")
+	return deleted, nil
+}
+
+// CreateFullTextIndexes ensures the full-text indexes for symbol search
+// exist: go_func_text over the names and doc comments of functions and
+// go_type_text over the names of structs and interfaces. The simple
+// analyzer splits names at dots and slashes, so each part is searchable.
+func (l *Neo4jLoader) CreateFullTextIndexes() error {
+	log.Println("Creating full-text indexes...")
+	indexes := []string{
+		"CREATE FULLTEXT INDEX go_func_text IF NOT EXISTS FOR (n:GoFunc) ON EACH [n.name, n.full_name, n.doc] OPTIONS {indexConfig: {`fulltext.analyzer`: 'simple'}}",
+		"CREATE FULLTEXT INDEX go_type_text IF NOT EXISTS FOR (n:GoStruct|GoInterface) ON EACH [n.name, n.key] OPTIONS {indexConfig: {`fulltext.analyzer`: 'simple'}}",
+	}
+	for _, q := range indexes {
 		if err := l.runCypher(q, nil); err != nil {
 			return err
 		}
@@ -61,9 +627,29 @@ func (l *Neo4jLoader) CreateIndexes() error {
 	log.Println("Creating indexes...")
 	indexes := []string{
 		"CREATE INDEX go_pkg_path IF NOT EXISTS FOR (n:GoPackage) ON (n.import_path)",
+		"CREATE INDEX go_module_path IF NOT EXISTS FOR (n:GoModule) ON (n.path)",
+		"CREATE INDEX go_file_path IF NOT EXISTS FOR (n:GoFile) ON (n.path)",
 		"CREATE INDEX go_func_fullname IF NOT EXISTS FOR (n:GoFunc) ON (n.full_name)",
 		"CREATE INDEX go_struct_key IF NOT EXISTS FOR (n:GoStruct) ON (n.key)",
 		"CREATE INDEX go_iface_key IF NOT EXISTS FOR (n:GoInterface) ON (n.key)",
+		"CREATE INDEX go_named_key IF NOT EXISTS FOR (n:GoNamedType) ON (n.key)",
+		"CREATE INDEX go_alias_key IF NOT EXISTS FOR (n:GoAlias) ON (n.key)",
+		"CREATE INDEX go_func_id IF NOT EXISTS FOR (n:GoFunc) ON (n.id)",
+		"CREATE INDEX go_struct_id IF NOT EXISTS FOR (n:GoStruct) ON (n.id)",
+		"CREATE INDEX go_iface_id IF NOT EXISTS FOR (n:GoInterface) ON (n.id)",
+		"CREATE INDEX go_named_id IF NOT EXISTS FOR (n:GoNamedType) ON (n.id)",
+		"CREATE INDEX go_alias_id IF NOT EXISTS FOR (n:GoAlias) ON (n.id)",
+		"CREATE INDEX http_endpoint_key IF NOT EXISTS FOR (n:HttpEndpoint) ON (n.key)",
+		"CREATE INDEX grpc_service_name IF NOT EXISTS FOR (n:GrpcService) ON (n.name)",
+		"CREATE INDEX grpc_method_name IF NOT EXISTS FOR (n:GrpcMethod) ON (n.full_name)",
+		"CREATE INDEX sql_query_id IF NOT EXISTS FOR (n:SqlQuery) ON (n.id)",
+		"CREATE INDEX db_table_name IF NOT EXISTS FOR (n:DbTable) ON (n.name)",
+		"CREATE INDEX topic_key IF NOT EXISTS FOR (n:Topic) ON (n.key)",
+		"CREATE INDEX env_var_name IF NOT EXISTS FOR (n:EnvVar) ON (n.name)",
+		"CREATE INDEX config_key_key IF NOT EXISTS FOR (n:ConfigKey) ON (n.key)",
+		"CREATE INDEX http_request_key IF NOT EXISTS FOR (n:HttpRequest) ON (n.key)",
+		"CREATE INDEX sync_var_key IF NOT EXISTS FOR (n:SyncVar) ON (n.key)",
+		"CREATE INDEX analysis_run_id IF NOT EXISTS FOR (n:AnalysisRun) ON (n.id)",
 	}
 	for _, q := range indexes {
 		if err := l.runCypher(q, nil); err != nil {
@@ -73,22 +659,134 @@ func (l *Neo4jLoader) CreateIndexes() error {
 	return nil
 }
 
+// idMigrations lists the nodes keyed by symbol ID with the property they
+// were keyed by before, from which MigrateIDs computes their ID.
+var idMigrations = []struct {
+	label, key string
+	id         func(string) string
+}{
+	{"GoFunc", "full_name", funcID},
+	{"GoStruct", "key", typeID},
+	{"GoInterface", "key", typeID},
+	{"GoNamedType", "key", typeID},
+	{"GoAlias", "key", typeID},
+}
+
+// MigrateIDs sets the id of the function and type nodes loaded by
+// versions without symbol IDs, so that this load merges on them instead
+// of creating duplicates. A node without an id that duplicates one with
+// it, left by a load before the migration, is deleted.
+func (l *Neo4jLoader) MigrateIDs() error {
+	for _, m := range idMigrations {
+		migrated := 0
+		for {
+			res, err := l.read("MATCH (n:"+m.label+") WHERE n.id IS NULL AND n."+m.key+" IS NOT NULL RETURN DISTINCT n."+m.key+" AS key LIMIT $limit",
+				map[string]any{"limit": readBatchSize})
+			if err != nil {
+				return fmt.Errorf("failed to read %s nodes without an id: %w", m.label, err)
+			}
+			if len(res.Records) == 0 {
+				break
+			}
+			batch := make([]map[string]any, 0, len(res.Records))
+			for _, rec := range res.Records {
+				key, _, _ := neo4j.GetRecordValue[string](rec, "key")
+				batch = append(batch, map[string]any{"key": key, "id": m.id(key)})
+			}
+			if err := l.runBatch(
+				`UNWIND $batch AS row
+				 MATCH (n:`+m.label+` {`+m.key+`: row.key}), (d:`+m.label+` {id: row.id})
+				 WHERE n.id IS NULL AND coalesce(n.project, '') = coalesce(d.project, '')
+				 DETACH DELETE n`,
+				batch); err != nil {
+				return err
+			}
+			if err := l.runBatch(
+				`UNWIND $batch AS row
+				 MATCH (n:`+m.label+` {`+m.key+`: row.key}) WHERE n.id IS NULL
+				 SET n.id = row.id`,
+				batch); err != nil {
+				return err
+			}
+			migrated += len(batch)
+		}
+		if migrated > 0 {
+			log.Printf("Set the id of %d %s nodes of an earlier load", migrated, m.label)
+		}
+	}
+	return nil
+}
+
 // LoadPackages upserts GoPackage nodes.
 func (l *Neo4jLoader) LoadPackages(pkgs map[string]*PackageNode) error {
 	log.Printf("Loading %d packages...", len(pkgs))
 	batch := make([]map[string]any, 0, len(pkgs))
 	for _, p := range pkgs {
 		batch = append(batch, map[string]any{
-			"path": p.ImportPath,
-			"name": p.Name,
-			"dir":  p.Dir,
+			"path":   p.ImportPath,
+			"name":   p.Name,
+			"dir":    p.Dir,
+			"mod":    p.Module,
+			"prod":   p.ProdReachable,
+			"gen":    p.Generated,
+			"layer":  nullIfEmpty(p.Layer),
+			"files":  p.Files,
+			"loc":    p.LOC,
+			"stmts":  p.Statements,
+			"build":  nullIfNone(p.BuildConfigs),
+			"errors": nullIfNone(p.Errors),
+			"order":  p.InitOrder,
+			"inits":  p.InitFuncs,
+			"cycle":  nullIfNoID(p.CycleID),
+			"ca":     p.Afferent,
+			"ce":     p.Efferent,
+			"inst":   p.Instability,
+			"abst":   p.Abstractness,
+			"dist":   p.Distance,
+			"hot":    nullIfNone(p.Hotspot),
+			"score":  nullIfNoScore(p.HotspotScore),
 		})
 	}
-	return l.runCypher(
+	return l.runBatch(
 		`UNWIND $batch AS row
 		 MERGE (n:GoPackage {import_path: row.path})
-		 SET n.name = row.name, n.dir = row.dir`,
-		map[string]any{"batch": batch},
+		 SET n.name = row.name, n.dir = row.dir, n.module = row.mod, n.prod_reachable = row.prod,
+		     n.generated = row.gen, n.layer = row.layer, n.file_count = row.files, n.loc = row.loc, n.statements = row.stmts,
+		     n.build_config = row.build, n.analysis_errors = row.errors,
+		     n.init_order = row.order, n.init_funcs = row.inits, n.cycle_id = row.cycle,
+		     n.afferent_coupling = row.ca, n.efferent_coupling = row.ce, n.instability = row.inst,
+		     n.abstractness = row.abst, n.distance = row.dist,
+		     n.hotspot_reasons = row.hot, n.hotspot_score = row.score
+		 REMOVE n:Hotspot
+		 FOREACH (_ IN CASE WHEN row.hot IS NOT NULL THEN [1] ELSE [] END | SET n:Hotspot)`,
+		batch,
+	)
+}
+
+// LoadFiles upserts GoFile nodes and CONTAINS edges from their packages.
+func (l *Neo4jLoader) LoadFiles(files map[string]*FileNode) error {
+	log.Printf("Loading %d files...", len(files))
+	batch := make([]map[string]any, 0, len(files))
+	for _, f := range files {
+		batch = append(batch, map[string]any{
+			"path": f.Path, "pkg": f.Package, "loc": f.LOC, "generated": f.Generated,
+			"constraint": nullIfEmpty(f.BuildConstraint), "tags": nullIfNone(f.BuildTags),
+			"owners": nullIfNone(f.Owners), "last_author": nullIfEmpty(f.LastAuthor),
+			"last_modified": nullIfZero(f.LastModified),
+			"build":         nullIfNone(f.BuildConfigs),
+		})
+	}
+	return l.runBatch(
+		`UNWIND $batch AS row
+		 MERGE (n:GoFile {path: row.path})
+		 SET n.package = row.pkg, n.loc = row.loc, n.generated = row.generated,
+		     n.build_constraint = row.constraint, n.build_tags = row.tags,
+		     n.owners = row.owners, n.last_author = row.last_author,
+		     n.last_modified = row.last_modified, n.build_config = row.build
+		 WITH n, row
+		 MATCH (p:GoPackage {import_path: row.pkg})
+		 MERGE (p)-[:CONTAINS]->(n)`,
+		batch,
 	)
 }
 
@@ -98,20 +796,24 @@ func (l *Neo4jLoader) LoadStructs(structs map[string]*StructNode) error {
 	batch := make([]map[string]any, 0, len(structs))
 	for key, s := range structs {
 		batch = append(batch, map[string]any{
-			"key": key, "name": s.Name, "pkg": s.Package,
+			"id": typeID(key), "key": key, "name": s.Name, "pkg": s.Package,
 			"file": s.File, "line": s.Line, "exported": s.Exported,
-			"fields": s.FieldCount,
+			"fields": s.FieldCount, "deprecated": s.Deprecated != "",
+			"deprecation": nullIfEmpty(s.Deprecated), "generated": s.Generated,
+			"build": nullIfNone(s.BuildConfigs),
 		})
 	}
-	return l.runCypher(
+	return l.runBatch(
 		`UNWIND $batch AS row
-		 MERGE (n:GoStruct {key: row.key})
-		 SET n.name = row.name, n.package = row.pkg, n.file = row.file,
-		     n.line = row.line, n.exported = row.exported, n.field_count = row.fields
+		 MERGE (n:GoStruct {id: row.id})
+		 SET n.key = row.key, n.name = row.name, n.package = row.pkg, n.file = row.file,
+		     n.line = row.line, n.exported = row.exported, n.field_count = row.fields,
+		     n.deprecated = row.deprecated, n.deprecation = row.deprecation,
+		     n.generated = row.generated, n.build_config = row.build
 		 WITH n, row
 		 MATCH (p:GoPackage {import_path: row.pkg})
 		 MERGE (n)-[:IN_PACKAGE]->(p)`,
-		map[string]any{"batch": batch},
+		batch,
 	)
 }
 
@@ -121,107 +823,1415 @@ func (l *Neo4jLoader) LoadInterfaces(ifaces map[string]*InterfaceNode) error {
 	batch := make([]map[string]any, 0, len(ifaces))
 	for key, i := range ifaces {
 		batch = append(batch, map[string]any{
-			"key": key, "name": i.Name, "pkg": i.Package,
+			"id": typeID(key), "key": key, "name": i.Name, "pkg": i.Package,
 			"file": i.File, "line": i.Line, "exported": i.Exported,
-			"methods": i.Methods,
+			"methods": i.Methods, "method_set": i.MethodSet, "deprecated": i.Deprecated != "",
+			"deprecation": nullIfEmpty(i.Deprecated), "generated": i.Generated,
+			"build": nullIfNone(i.BuildConfigs),
 		})
 	}
-	return l.runCypher(
+	return l.runBatch(
+		`UNWIND $batch AS row
+		 MERGE (n:GoInterface {id: row.id})
+		 SET n.key = row.key, n.name = row.name, n.package = row.pkg, n.file = row.file,
+		     n.line = row.line, n.exported = row.exported, n.method_count = row.methods, n.method_set = row.method_set,
+		     n.deprecated = row.deprecated, n.deprecation = row.deprecation,
+		     n.generated = row.generated, n.build_config = row.build
+		 WITH n, row
+		 MATCH (p:GoPackage {import_path: row.pkg})
+		 MERGE (n)-[:IN_PACKAGE]->(p)`,
+		batch,
+	)
+}
+
+// LoadNamedTypes upserts GoNamedType nodes and links them to their packages.
+func (l *Neo4jLoader) LoadNamedTypes(named map[string]*NamedTypeNode) error {
+	log.Printf("Loading %d named types...", len(named))
+	batch := make([]map[string]any, 0, len(named))
+	for key, t := range named {
+		batch = append(batch, map[string]any{
+			"id": typeID(key), "key": key, "name": t.Name, "pkg": t.Package,
+			"file": t.File, "line": t.Line, "exported": t.Exported,
+			"kind": t.Kind, "underlying": t.Underlying,
+			"deprecated": t.Deprecated != "", "deprecation": nullIfEmpty(t.Deprecated),
+			"generated": t.Generated, "build": nullIfNone(t.BuildConfigs),
+		})
+	}
+	return l.runBatch(
 		`UNWIND $batch AS row
-		 MERGE (n:GoInterface {key: row.key})
-		 SET n.name = row.name, n.package = row.pkg, n.file = row.file,
-		     n.line = row.line, n.exported = row.exported, n.method_count = row.methods
+		 MERGE (n:GoNamedType {id: row.id})
+		 SET n.key = row.key, n.name = row.name, n.package = row.pkg, n.file = row.file,
+		     n.line = row.line, n.exported = row.exported,
+		     n.type_kind = row.kind, n.underlying = row.underlying,
+		     n.deprecated = row.deprecated, n.deprecation = row.deprecation,
+		     n.generated = row.generated, n.build_config = row.build
 		 WITH n, row
 		 MATCH (p:GoPackage {import_path: row.pkg})
 		 MERGE (n)-[:IN_PACKAGE]->(p)`,
-		map[string]any{"batch": batch},
+		batch,
+	)
+}
+
+// LoadAliases upserts GoAlias nodes, links them to their packages, and
+// creates ALIAS_OF edges to the aliased struct, interface or named type
+// when it is part of the graph. Aliases must be loaded after those types.
+func (l *Neo4jLoader) LoadAliases(aliases map[string]*AliasNode) error {
+	log.Printf("Loading %d type aliases...", len(aliases))
+	batch := make([]map[string]any, 0, len(aliases))
+	for key, a := range aliases {
+		batch = append(batch, map[string]any{
+			"id": typeID(key), "key": key, "name": a.Name, "pkg": a.Package,
+			"file": a.File, "line": a.Line, "exported": a.Exported,
+			"target": a.Target, "target_id": typeID(a.Target), "target_type": a.TargetType,
+			"deprecated": a.Deprecated != "", "deprecation": nullIfEmpty(a.Deprecated),
+			"generated": a.Generated, "build": nullIfNone(a.BuildConfigs),
+		})
+	}
+	return l.runBatch(
+		`UNWIND $batch AS row
+		 MERGE (n:GoAlias {id: row.id})
+		 SET n.key = row.key, n.name = row.name, n.package = row.pkg, n.file = row.file,
+		     n.line = row.line, n.exported = row.exported,
+		     n.target = row.target, n.target_type = row.target_type,
+		     n.deprecated = row.deprecated, n.deprecation = row.deprecation,
+		     n.generated = row.generated, n.build_config = row.build
+		 WITH n, row
+		 MATCH (p:GoPackage {import_path: row.pkg})
+		 MERGE (n)-[:IN_PACKAGE]->(p)
+		 WITH n, row
+		 MATCH (t:GoStruct|GoInterface|GoNamedType|GoAlias {id: row.target_id})
+		 MERGE (n)-[:ALIAS_OF]->(t)`,
+		batch,
 	)
 }
 
-// LoadFuncs upserts GoFunc nodes, links them to packages, and creates
-// HAS_METHOD edges from structs to their methods.
+// LoadFuncs upserts GoFunc nodes, links them to packages and files, and
+// creates HAS_METHOD edges from structs and named types to their methods.
 func (l *Neo4jLoader) LoadFuncs(funcs map[string]*FuncNode) error {
 	log.Printf("Loading %d functions...", len(funcs))
 	batch := make([]map[string]any, 0, len(funcs))
 	for _, fn := range funcs {
 		batch = append(batch, map[string]any{
-			"fullname": fn.FullName, "name": fn.Name, "pkg": fn.Package,
+			"id": funcID(fn.FullName), "fullname": fn.FullName, "name": fn.Name, "pkg": fn.Package,
 			"file": fn.File, "line": fn.Line, "exported": fn.Exported,
-			"receiver": fn.Receiver, "is_method": fn.IsMethod,
+			"receiver": fn.Receiver, "receiver_ptr": fn.ReceiverPtr, "is_method": fn.IsMethod, "signature": fn.Signature,
+			"end_line": fn.EndLine, "loc": fn.LOC, "stmts": fn.Statements, "complexity": fn.Complexity,
+			"prod":   fn.ProdReachable,
+			"doc":    nullIfEmpty(fn.Doc),
+			"source": nullIfEmpty(fn.Source), "source_truncated": fn.SourceTruncated,
+			"deprecated": fn.Deprecated != "", "deprecation": nullIfEmpty(fn.Deprecated),
+			"generated": fn.Generated, "build": nullIfNone(fn.BuildConfigs),
+			"owners": nullIfNone(fn.Owners), "last_author": nullIfEmpty(fn.LastAuthor),
+			"last_modified": nullIfZero(fn.LastModified), "covered_pct": coveredPct(fn),
+			"synthetic": nullIfEmpty(fn.Synthetic), "returns_error": fn.ReturnsError,
+			"takes_context": fn.TakesContext, "recursive": fn.Recursive, "scc_id": nullIfNoID(fn.SCCID),
+			"hotspot": nullIfNone(fn.Hotspot), "hotspot_score": nullIfNoScore(fn.HotspotScore),
 		})
 	}
-	err := l.runCypher(
+	err := l.runBatch(
 		`UNWIND $batch AS row
-		 MERGE (n:GoFunc {full_name: row.fullname})
-		 SET n.name = row.name, n.package = row.pkg, n.file = row.file,
+		 MERGE (n:GoFunc {id: row.id})
+		 SET n.full_name = row.fullname, n.name = row.name, n.package = row.pkg, n.file = row.file,
 		     n.line = row.line, n.exported = row.exported,
-		     n.receiver = row.receiver, n.is_method = row.is_method
+		     n.receiver = row.receiver, n.receiver_ptr = row.receiver_ptr, n.is_method = row.is_method,
+		     n.signature = row.signature,
+		     n.end_line = row.end_line, n.loc = row.loc, n.statements = row.stmts,
+		     n.complexity = row.complexity, n.prod_reachable = row.prod, n.doc = row.doc,
+		     n.source = row.source, n.source_truncated = row.source_truncated,
+		     n.deprecated = row.deprecated, n.deprecation = row.deprecation,
+		     n.generated = row.generated, n.build_config = row.build,
+		     n.owners = row.owners, n.last_author = row.last_author,
+		     n.last_modified = row.last_modified, n.covered_pct = row.covered_pct,
+		     n.synthetic = row.synthetic, n.returns_error = row.returns_error,
+		     n.takes_context = row.takes_context, n.recursive = row.recursive, n.scc_id = row.scc_id,
+		     n.hotspot_reasons = row.hotspot, n.hotspot_score = row.hotspot_score
+		 REMOVE n:Hotspot
+		 FOREACH (_ IN CASE WHEN row.synthetic IS NOT NULL THEN [1] ELSE [] END | SET n:Synthetic)
+		 FOREACH (_ IN CASE WHEN row.hotspot IS NOT NULL THEN [1] ELSE [] END | SET n:Hotspot)
 		 WITH n, row
 		 MATCH (p:GoPackage {import_path: row.pkg})
 		 MERGE (n)-[:IN_PACKAGE]->(p)`,
-		map[string]any{"batch": batch},
+		batch,
+	)
+	if err != nil {
+		return err
+	}
+
+	// DEFINED_IN edges (function -> file). Files must be loaded first.
+	defined := make([]map[string]any, 0, len(funcs))
+	for _, fn := range funcs {
+		if fn.File != "" {
+			defined = append(defined, map[string]any{"id": funcID(fn.FullName), "file": fn.File})
+		}
+	}
+	err = l.runBatch(
+		`UNWIND $batch AS row
+		 MATCH (f:GoFunc {id: row.id}), (file:GoFile {path: row.file})
+		 MERGE (f)-[:DEFINED_IN]->(file)`,
+		defined,
 	)
 	if err != nil {
 		return err
 	}
 
-	// HAS_METHOD edges (struct -> method)
+	// HAS_METHOD edges (struct or named type -> method)
 	methods := make([]map[string]any, 0)
 	for _, fn := range funcs {
 		if fn.IsMethod && fn.Receiver != "" {
 			methods = append(methods, map[string]any{
-				"skey":     fn.Package + "." + fn.Receiver,
-				"fullname": fn.FullName,
+				"sid": typeID(fn.Package + "." + fn.Receiver),
+				"id":  funcID(fn.FullName),
 			})
 		}
 	}
 	if len(methods) > 0 {
-		return l.runCypher(
+		return l.runBatch(
 			`UNWIND $batch AS row
-			 MATCH (s:GoStruct {key: row.skey}), (f:GoFunc {full_name: row.fullname})
+			 MATCH (s:GoStruct|GoNamedType {id: row.sid}), (f:GoFunc {id: row.id})
 			 MERGE (s)-[:HAS_METHOD]->(f)`,
-			map[string]any{"batch": methods},
+			methods,
 		)
 	}
 	return nil
 }
 
-// LoadCalls upserts ACCURATE_CALLS relationships between GoFunc nodes.
+// LoadExternalFuncs upserts stub GoFunc:External nodes for dependency
+// functions, carrying their module and version.
+func (l *Neo4jLoader) LoadExternalFuncs(funcs map[string]*ExternalFuncNode) error {
+	log.Printf("Loading %d external functions...", len(funcs))
+	batch := make([]map[string]any, 0, len(funcs))
+	for _, fn := range funcs {
+		batch = append(batch, map[string]any{
+			"id": funcID(fn.FullName), "fullname": fn.FullName, "name": fn.Name, "pkg": fn.Package,
+			"module": fn.Module, "version": fn.Version,
+			"deprecated": fn.Deprecated != "", "deprecation": nullIfEmpty(fn.Deprecated),
+			"returns_error": fn.ReturnsError, "takes_context": fn.TakesContext,
+			"build": nullIfNone(fn.BuildConfigs),
+		})
+	}
+	return l.runBatch(
+		`UNWIND $batch AS row
+		 MERGE (n:GoFunc {id: row.id})
+		 SET n:External, n.full_name = row.fullname, n.name = row.name, n.package = row.pkg,
+		     n.module = row.module, n.version = row.version,
+		     n.deprecated = row.deprecated, n.deprecation = row.deprecation,
+		     n.returns_error = row.returns_error, n.takes_context = row.takes_context,
+		     n.build_config = row.build`,
+		batch,
+	)
+}
+
+// LoadCalls upserts ACCURATE_CALLS relationships between GoFunc nodes, and
+// CALLS_EXTERNAL relationships for calls into dependency functions.
 func (l *Neo4jLoader) LoadCalls(calls []CallEdge) error {
 	log.Printf("Loading %d call edges...", len(calls))
 	batch := make([]map[string]any, 0, len(calls))
+	external := make([]map[string]any, 0)
 	for _, c := range calls {
-		batch = append(batch, map[string]any{
-			"caller":  c.CallerFullName,
-			"callee":  c.CalleeFullName,
+		row := map[string]any{
+			"caller":  funcID(c.CallerFullName),
+			"callee":  funcID(c.CalleeFullName),
+			"from":    c.CallerFullName,
+			"to":      c.CalleeFullName,
 			"dynamic": c.IsDynamic,
-			"site":    c.Site,
-		})
+			"count":   c.Count,
+			"build":   nullIfNone(c.BuildConfigs),
+		}
+		addSiteProps(row, c.Sites)
+		var detached []string
+		for _, s := range c.DetachedContext {
+			detached = append(detached, s.String())
+		}
+		row["detached"] = nullIfNone(detached)
+		if c.External {
+			external = append(external, row)
+		} else {
+			batch = append(batch, row)
+		}
 	}
-	return l.runCypher(
+	err := l.runBatch(
 		`UNWIND $batch AS row
-		 MERGE (caller:GoFunc {full_name: row.caller})
-		 MERGE (callee:GoFunc {full_name: row.callee})
+		 MERGE (caller:GoFunc {id: row.caller}) ON CREATE SET caller.full_name = row.from
+		 MERGE (callee:GoFunc {id: row.callee}) ON CREATE SET callee.full_name = row.to
 		 MERGE (caller)-[r:ACCURATE_CALLS]->(callee)
-		 SET r.is_dynamic = row.dynamic, r.site = row.site`,
-		map[string]any{"batch": batch},
+		 SET r.is_dynamic = row.dynamic, r.site = row.sites[0], r.sites = row.sites,
+		     r.columns = row.columns, r.end_lines = row.end_lines, r.end_columns = row.end_columns,
+		     r.call_exprs = row.exprs, r.call_count = row.count, r.build_config = row.build,
+		     r.detached_context = row.detached`,
+		batch,
+	)
+	if err != nil {
+		return err
+	}
+	return l.runBatch(
+		`UNWIND $batch AS row
+		 MERGE (caller:GoFunc {id: row.caller}) ON CREATE SET caller.full_name = row.from
+		 MERGE (callee:GoFunc {id: row.callee}) ON CREATE SET callee.full_name = row.to
+		 MERGE (caller)-[r:CALLS_EXTERNAL]->(callee)
+		 SET r.is_dynamic = row.dynamic, r.site = row.sites[0], r.sites = row.sites,
+		     r.columns = row.columns, r.end_lines = row.end_lines, r.end_columns = row.end_columns,
+		     r.call_exprs = row.exprs, r.call_count = row.count, r.build_config = row.build,
+		     r.detached_context = row.detached`,
+		external,
 	)
 }
 
-// LoadImplements upserts IMPLEMENTS relationships between GoStruct and GoInterface nodes.
+// addSiteProps adds the call site properties of an edge to its batch row
+// as parallel lists, one entry per site. Rows without sites get none.
+func addSiteProps(row map[string]any, sites []CallSite) {
+	if len(sites) == 0 {
+		return
+	}
+	var names, exprs []string
+	var cols, endLines, endCols []int
+	for _, s := range sites {
+		names = append(names, s.String())
+		cols = append(cols, s.Column)
+		endLines = append(endLines, s.EndLine)
+		endCols = append(endCols, s.EndColumn)
+		exprs = append(exprs, s.Expr)
+	}
+	row["sites"], row["columns"], row["exprs"] = names, cols, exprs
+	row["end_lines"], row["end_columns"] = endLines, endCols
+}
+
+// LoadModules upserts GoModule nodes and REQUIRES edges, then links
+// GoPackage and external GoFunc nodes to their modules with IN_MODULE.
+// It must run after packages and external functions are loaded.
+func (l *Neo4jLoader) LoadModules(mods map[string]*ModuleNode, reqs []RequireEdge) error {
+	log.Printf("Loading %d modules, %d requirements...", len(mods), len(reqs))
+	batch := make([]map[string]any, 0, len(mods))
+	for _, m := range mods {
+		batch = append(batch, map[string]any{
+			"path": m.Path, "version": m.Version, "main": m.Main,
+			"indirect": m.Indirect, "replace": m.Replace,
+			"go": m.GoVersion, "sum": m.Sum,
+		})
+	}
+	err := l.runBatch(
+		`UNWIND $batch AS row
+		 MERGE (m:GoModule {path: row.path})
+		 SET m.version = row.version, m.main = row.main, m.indirect = row.indirect,
+		     m.replace = row.replace, m.go_version = row.go, m.sum = row.sum`,
+		batch,
+	)
+	if err != nil {
+		return err
+	}
+
+	edges := make([]map[string]any, 0, len(reqs))
+	for _, r := range reqs {
+		edges = append(edges, map[string]any{
+			"from": r.From, "to": r.To, "version": r.Version, "indirect": r.Indirect,
+		})
+	}
+	err = l.runBatch(
+		`UNWIND $batch AS row
+		 MATCH (a:GoModule {path: row.from})
+		 MERGE (b:GoModule {path: row.to})
+		 MERGE (a)-[r:REQUIRES]->(b)
+		 SET r.version = row.version, r.indirect = row.indirect`,
+		edges,
+	)
+	if err != nil {
+		return err
+	}
+
+	return l.runCypher(
+		`MATCH (n:GoPackage|External) WHERE n.module IS NOT NULL
+		 MATCH (m:GoModule {path: n.module})
+		 MERGE (n)-[:IN_MODULE]->(m)`,
+		nil,
+	)
+}
+
+// LoadVulns marks vulnerable modules and functions with the Vulnerable
+// label and their OSV IDs, and writes REACHES_VULN edges from the project
+// functions whose call traces reach a vulnerable symbol. Labels and edges
+// from previous runs are replaced. It must run after modules are loaded.
+func (l *Neo4jLoader) LoadVulns(vulns []VulnFinding) error {
+	log.Printf("Loading %d vulnerability findings...", len(vulns))
+	if err := l.runCypher("MATCH (n:Vulnerable) REMOVE n:Vulnerable, n.osv_ids", nil); err != nil {
+		return err
+	}
+	if err := l.runCypher("MATCH ()-[r:REACHES_VULN]->() DELETE r", nil); err != nil {
+		return err
+	}
+
+	modIDs := make(map[string][]string)
+	funcIDs := make(map[string][]string)
+	funcMods := make(map[string]VulnFinding)
+	var reaches []map[string]any
+	for _, v := range vulns {
+		modIDs[v.Module] = appendUnique(modIDs[v.Module], v.OSV)
+		if v.Symbol == "" {
+			continue
+		}
+		funcIDs[v.Symbol] = appendUnique(funcIDs[v.Symbol], v.OSV)
+		funcMods[v.Symbol] = v
+		if v.Entry != "" {
+			reaches = append(reaches, map[string]any{"entry": funcID(v.Entry), "symbol": funcID(v.Symbol), "osv": v.OSV})
+		}
+	}
+
+	mods := make([]map[string]any, 0, len(modIDs))
+	for path, ids := range modIDs {
+		mods = append(mods, map[string]any{"path": path, "ids": ids})
+	}
+	err := l.runBatch(
+		`UNWIND $batch AS row
+		 MERGE (m:GoModule {path: row.path})
+		 SET m:Vulnerable, m.osv_ids = row.ids`,
+		mods,
+	)
+	if err != nil {
+		return err
+	}
+
+	funcs := make([]map[string]any, 0, len(funcIDs))
+	for name, ids := range funcIDs {
+		v := funcMods[name]
+		funcs = append(funcs, map[string]any{
+			"id": funcID(name), "fullname": name, "ids": ids, "module": v.Module, "version": v.Version,
+		})
+	}
+	err = l.runBatch(
+		`UNWIND $batch AS row
+		 MERGE (f:GoFunc {id: row.id})
+		 ON CREATE SET f:External, f.full_name = row.fullname, f.module = row.module, f.version = row.version
+		 SET f:Vulnerable, f.osv_ids = row.ids`,
+		funcs,
+	)
+	if err != nil {
+		return err
+	}
+
+	return l.runBatch(
+		`UNWIND $batch AS row
+		 MATCH (e:GoFunc {id: row.entry}), (v:GoFunc {id: row.symbol})
+		 MERGE (e)-[:REACHES_VULN {osv: row.osv}]->(v)`,
+		reaches,
+	)
+}
+
+// appendUnique appends s to list unless it is already present.
+func appendUnique(list []string, s string) []string {
+	for _, x := range list {
+		if x == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// LoadAnalysis upserts the GoAnalysis node describing how complete the
+// loaded call graph is for module: the package patterns and build
+// configurations analysed, the call graph algorithm (vta, or static when
+// VTA did not finish in time) and how much of the call graph was
+// extracted.
+func (l *Neo4jLoader) LoadAnalysis(module, algorithm string, partial bool, coverage float64, configs, patterns []string) error {
+	return l.runCypher(
+		`MERGE (a:GoAnalysis {module: $module})
+		 SET a.algorithm = $algorithm, a.partial = $partial, a.coverage = $coverage,
+		     a.build_configs = $configs, a.patterns = $patterns, a.loaded_at = datetime()`,
+		map[string]any{
+			"module": module, "algorithm": algorithm, "partial": partial, "coverage": coverage,
+			"configs": configs, "patterns": patterns,
+		},
+	)
+}
+
+// LoadAnalysisRun creates the AnalysisRun node of run, with PRODUCED
+// edges to the GoAnalysis node of its module and the packages it loaded.
+// Runs are kept by CleanGraph, as a history of the loads.
+func (l *Neo4jLoader) LoadAnalysisRun(run *AnalysisRun, pkgs map[string]*PackageNode) error {
+	err := l.runCypher(
+		`MERGE (r:AnalysisRun {id: $id})
+		 SET r += $props
+		 WITH r
+		 MATCH (a:GoAnalysis {module: $module})
+		 MERGE (r)-[:PRODUCED]->(a)`,
+		map[string]any{"id": run.ID, "module": run.Module, "props": run.props()},
+	)
+	if err != nil {
+		return err
+	}
+	batch := make([]map[string]any, 0, len(pkgs))
+	for _, p := range pkgs {
+		batch = append(batch, map[string]any{"run": run.ID, "path": p.ImportPath})
+	}
+	return l.runBatch(
+		`UNWIND $batch AS row
+		 MATCH (r:AnalysisRun {id: row.run}), (p:GoPackage {import_path: row.path})
+		 MERGE (r)-[:PRODUCED]->(p)`,
+		batch,
+	)
+}
+
+// MarkUnreachable replaces the Unreachable label set on GoFunc nodes with
+// the given dead functions.
+func (l *Neo4jLoader) MarkUnreachable(dead []*FuncNode) error {
+	log.Printf("Labeling %d unreachable functions...", len(dead))
+	if err := l.runCypher("MATCH (f:GoFunc:Unreachable) REMOVE f:Unreachable", nil); err != nil {
+		return err
+	}
+	batch := make([]map[string]any, 0, len(dead))
+	for _, fn := range dead {
+		batch = append(batch, map[string]any{"id": funcID(fn.FullName)})
+	}
+	return l.runBatch(
+		`UNWIND $batch AS row
+		 MATCH (f:GoFunc {id: row.id})
+		 SET f:Unreachable`,
+		batch,
+	)
+}
+
+// LabelEntryPoints replaces the EntryPoint label and entry_point kind set
+// on GoFunc nodes with those of funcs.
+func (l *Neo4jLoader) LabelEntryPoints(funcs map[string]*FuncNode) error {
+	if err := l.runCypher("MATCH (f:GoFunc:EntryPoint) REMOVE f:EntryPoint, f.entry_point", nil); err != nil {
+		return err
+	}
+	batch := make([]map[string]any, 0)
+	for _, fn := range funcs {
+		if fn.EntryPoint != "" {
+			batch = append(batch, map[string]any{"id": funcID(fn.FullName), "kind": fn.EntryPoint})
+		}
+	}
+	log.Printf("Labeling %d entry points...", len(batch))
+	return l.runBatch(
+		`UNWIND $batch AS row
+		 MATCH (f:GoFunc {id: row.id})
+		 SET f:EntryPoint, f.entry_point = row.kind`,
+		batch,
+	)
+}
+
+// LoadProfile writes pprof sample values onto GoFunc nodes (profile_flat,
+// profile_cum and their share of the total as *_pct) and call edges
+// (profile_value, profile_pct). Functions and edges at or above hotPct
+// percent of the total are labeled Hot / marked hot: true. Values from an
+// earlier profile are removed first.
+func (l *Neo4jLoader) LoadProfile(p *ProfileData, hotPct float64) error {
+	log.Printf("Loading profile samples for %d functions and %d call edges...", len(p.Cum), len(p.Edges))
+	resets := []string{
+		`MATCH (f:GoFunc) WHERE f.profile_cum IS NOT NULL
+		 REMOVE f:Hot, f.profile_flat, f.profile_cum, f.profile_flat_pct, f.profile_cum_pct, f.profile_unit`,
+		`MATCH ()-[r:ACCURATE_CALLS|CALLS_EXTERNAL]->() WHERE r.profile_value IS NOT NULL
+		 REMOVE r.profile_value, r.profile_pct, r.hot`,
+	}
+	for _, q := range resets {
+		if err := l.runCypher(q, nil); err != nil {
+			return err
+		}
+	}
+	pct := func(v int64) float64 {
+		if p.Total == 0 {
+			return 0
+		}
+		return 100 * float64(v) / float64(p.Total)
+	}
+	funcs := make([]map[string]any, 0, len(p.Cum))
+	for name, cum := range p.Cum {
+		funcs = append(funcs, map[string]any{
+			"id": funcID(name), "flat": p.Flat[name], "cum": cum,
+			"flat_pct": pct(p.Flat[name]), "cum_pct": pct(cum), "hot": pct(cum) >= hotPct,
+			"unit": p.Unit,
+		})
+	}
+	err := l.runBatch(
+		`UNWIND $batch AS row
+		 MATCH (f:GoFunc {id: row.id})
+		 SET f.profile_flat = row.flat, f.profile_cum = row.cum,
+		     f.profile_flat_pct = row.flat_pct, f.profile_cum_pct = row.cum_pct,
+		     f.profile_unit = row.unit
+		 FOREACH (_ IN CASE WHEN row.hot THEN [1] ELSE [] END | SET f:Hot)`,
+		funcs,
+	)
+	if err != nil {
+		return err
+	}
+	edges := make([]map[string]any, 0, len(p.Edges))
+	for e, v := range p.Edges {
+		edges = append(edges, map[string]any{
+			"caller": funcID(e[0]), "callee": funcID(e[1]), "value": v, "pct": pct(v), "hot": pct(v) >= hotPct,
+		})
+	}
+	return l.runBatch(
+		`UNWIND $batch AS row
+		 MATCH (:GoFunc {id: row.caller})-[r:ACCURATE_CALLS|CALLS_EXTERNAL]->(:GoFunc {id: row.callee})
+		 SET r.profile_value = row.value, r.profile_pct = row.pct, r.hot = row.hot`,
+		edges,
+	)
+}
+
+// LoadRuntimeCalls writes observed calls as RUNTIME_CALLS {count} edges
+// between existing GoFunc nodes; calls whose functions are not in the graph
+// are skipped. Counts add to those of earlier imports unless replace is set,
+// which deletes all RUNTIME_CALLS edges first.
+func (l *Neo4jLoader) LoadRuntimeCalls(calls []RuntimeCall, replace bool) error {
+	log.Printf("Loading %d runtime call edges...", len(calls))
+	if replace {
+		if err := l.runCypher("MATCH ()-[r:RUNTIME_CALLS]->() DELETE r", nil); err != nil {
+			return err
+		}
+	}
+	batch := make([]map[string]any, 0, len(calls))
+	for _, c := range calls {
+		batch = append(batch, map[string]any{"caller": funcID(c.Caller), "callee": funcID(c.Callee), "count": c.Count})
+	}
+	return l.runBatch(
+		`UNWIND $batch AS row
+		 MATCH (caller:GoFunc {id: row.caller}), (callee:GoFunc {id: row.callee})
+		 MERGE (caller)-[r:RUNTIME_CALLS]->(callee)
+		 SET r.count = coalesce(r.count, 0) + row.count, r.last_seen = datetime()`,
+		batch,
+	)
+}
+
+// ComputeDegrees writes in_degree/out_degree properties on every GoFunc
+// from its incoming and outgoing ACCURATE_CALLS relationships.
+func (l *Neo4jLoader) ComputeDegrees() error {
+	log.Println("Computing fan-in/fan-out...")
+	return l.runCypher(
+		`MATCH (f:GoFunc)
+		 SET f.in_degree = COUNT { (f)<-[:ACCURATE_CALLS]-() },
+		     f.out_degree = COUNT { (f)-[:ACCURATE_CALLS]->() }`,
+		nil,
+	)
+}
+
+// centralityGraph is the name of the in-memory GDS projection used by
+// ComputeCentrality.
+const centralityGraph = "go-callgraph"
+
+// ComputeCentrality projects the GoFunc call graph into the Graph Data
+// Science library and writes pagerank and betweenness scores back onto
+// GoFunc nodes. It is a no-op with a warning when GDS is not installed.
+func (l *Neo4jLoader) ComputeCentrality() error {
+	res, err := l.read("RETURN gds.version() AS version", nil)
+	if err != nil || len(res.Records) == 0 {
+		log.Printf("Warning: Graph Data Science plugin not available, skipping centrality (%v)", err)
+		return nil
+	}
+	version, _ := res.Records[0].Get("version")
+	log.Printf("Computing centrality with GDS %v...", version)
+
+	params := map[string]any{"graph": centralityGraph}
+	projection := "CALL gds.graph.project($graph, 'GoFunc', 'ACCURATE_CALLS') YIELD graphName RETURN graphName"
+	if l.Project != "" {
+		// A Cypher projection, scoped like any other statement, takes in only
+		// the project's functions; the graph name keeps projects apart.
+		params["graph"] = centralityGraph + "-" + l.Project
+		projection = `MATCH (a:GoFunc) OPTIONAL MATCH (a)-[:ACCURATE_CALLS]->(b:GoFunc)
+		 WITH gds.graph.project($graph, a, b) AS g RETURN g.graphName AS graphName`
+	}
+	queries := []string{
+		"CALL gds.graph.drop($graph, false) YIELD graphName RETURN graphName",
+		projection,
+		"CALL gds.pageRank.write($graph, {writeProperty: 'pagerank'}) YIELD nodePropertiesWritten RETURN nodePropertiesWritten",
+		"CALL gds.betweenness.write($graph, {writeProperty: 'betweenness'}) YIELD nodePropertiesWritten RETURN nodePropertiesWritten",
+	}
+	for _, q := range queries {
+		if err := l.runCypher(q, params); err != nil {
+			return fmt.Errorf("centrality: %w", err)
+		}
+	}
+	return l.runCypher("CALL gds.graph.drop($graph, false) YIELD graphName RETURN graphName", params)
+}
+
+// EmbeddingHashes returns the embedding_hash of the functions with a
+// stored embedding, by full name.
+func (l *Neo4jLoader) EmbeddingHashes() (map[string]string, error) {
+	res, err := l.read("MATCH (f:GoFunc) WHERE f.embedding_hash IS NOT NULL RETURN f.full_name AS name, f.embedding_hash AS hash", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedding hashes: %w", err)
+	}
+	hashes := make(map[string]string, len(res.Records))
+	for _, rec := range res.Records {
+		name, _, _ := neo4j.GetRecordValue[string](rec, "name")
+		hash, _, _ := neo4j.GetRecordValue[string](rec, "hash")
+		hashes[name] = hash
+	}
+	return hashes, nil
+}
+
+// LoadEmbeddings sets embedding and embedding_hash on GoFunc nodes and
+// ensures the go_func_embedding vector index over them exists, with cosine
+// similarity.
+func (l *Neo4jLoader) LoadEmbeddings(embeddings []FuncEmbedding) error {
+	if len(embeddings) == 0 {
+		return nil
+	}
+	log.Printf("Loading %d function embeddings...", len(embeddings))
+	batch := make([]map[string]any, 0, len(embeddings))
+	for _, e := range embeddings {
+		batch = append(batch, map[string]any{"id": funcID(e.FullName), "hash": e.Hash, "vector": e.Vector})
+	}
+	err := l.runBatch(
+		`UNWIND $batch AS row
+		 MATCH (f:GoFunc {id: row.id})
+		 SET f.embedding = row.vector, f.embedding_hash = row.hash`,
+		batch,
+	)
+	if err != nil {
+		return err
+	}
+	if version, err := l.ServerVersion(); err != nil {
+		return err
+	} else if !version.AtLeast(5, 11) {
+		log.Printf("Warning: Neo4j %s has no vector indexes (5.11 or later), embeddings are stored without one", version)
+		return nil
+	}
+	return l.runCypher(fmt.Sprintf(
+		"CREATE VECTOR INDEX go_func_embedding IF NOT EXISTS FOR (n:GoFunc) ON (n.embedding) "+
+			"OPTIONS {indexConfig: {`vector.dimensions`: %d, `vector.similarity_function`: 'cosine'}}",
+		len(embeddings[0].Vector)), nil)
+}
+
+// LoadImplements upserts IMPLEMENTS relationships from GoStruct and
+// GoNamedType nodes to GoInterface nodes, and SATISFIES relationships from each concrete method
+// to the interface it helps satisfy.
 func (l *Neo4jLoader) LoadImplements(impls []ImplementsEdge) error {
 	log.Printf("Loading %d implements edges...", len(impls))
 	batch := make([]map[string]any, 0, len(impls))
+	var satisfies []map[string]any
 	for _, e := range impls {
 		batch = append(batch, map[string]any{
-			"struct": e.Struct,
-			"iface":  e.Interface,
+			"struct":   typeID(e.Struct),
+			"iface":    typeID(e.Interface),
+			"receiver": e.Receiver,
+			"methods":  e.Methods,
+			"funcs":    e.MethodFuncs,
+			"build":    nullIfNone(e.BuildConfigs),
 		})
+		for i, fn := range e.MethodFuncs {
+			if fn == "" {
+				continue
+			}
+			satisfies = append(satisfies, map[string]any{
+				"id":       funcID(fn),
+				"iface":    typeID(e.Interface),
+				"method":   e.Methods[i],
+				"receiver": e.Receiver,
+			})
+		}
 	}
-	return l.runCypher(
+	err := l.runBatch(
+		`UNWIND $batch AS row
+		 MATCH (s:GoStruct|GoNamedType {id: row.struct}), (i:GoInterface {id: row.iface})
+		 MERGE (s)-[r:IMPLEMENTS]->(i)
+		 SET r.receiver = row.receiver, r.methods = row.methods, r.method_funcs = row.funcs,
+		     r.build_config = row.build`,
+		batch,
+	)
+	if err != nil {
+		return err
+	}
+	return l.runBatch(
+		`UNWIND $batch AS row
+		 MATCH (f:GoFunc {id: row.id}), (i:GoInterface {id: row.iface})
+		 MERGE (f)-[r:SATISFIES {method: row.method}]->(i)
+		 SET r.receiver = row.receiver`,
+		satisfies,
+	)
+}
+
+// LoadInitGraph links packages in initialization order with
+// INITIALIZES_BEFORE edges (imported package -> importer) and creates
+// INIT_CALLS edges from packages to the functions their initialization
+// calls, as returned by Collector.InitCalls. It must run after packages and
+// functions are loaded.
+func (l *Neo4jLoader) LoadInitGraph(pkgs map[string]*PackageNode, calls []CallEdge) error {
+	log.Printf("Loading init graph (%d init calls)...", len(calls))
+	var imports []map[string]any
+	for _, p := range pkgs {
+		for _, imp := range p.Imports {
+			imports = append(imports, map[string]any{"from": imp, "to": p.ImportPath})
+		}
+	}
+	err := l.runBatch(
+		`UNWIND $batch AS row
+		 MATCH (a:GoPackage {import_path: row.from}), (b:GoPackage {import_path: row.to})
+		 MERGE (a)-[:INITIALIZES_BEFORE]->(b)`,
+		imports,
+	)
+	if err != nil {
+		return err
+	}
+
+	batch := make([]map[string]any, 0, len(calls))
+	for _, c := range calls {
+		row := map[string]any{
+			"pkg": c.CallerFullName, "callee": funcID(c.CalleeFullName),
+			"count": c.Count, "build": nullIfNone(c.BuildConfigs),
+		}
+		addSiteProps(row, c.Sites)
+		batch = append(batch, row)
+	}
+	return l.runBatch(
+		`UNWIND $batch AS row
+		 MATCH (p:GoPackage {import_path: row.pkg}), (f:GoFunc {id: row.callee})
+		 MERGE (p)-[r:INIT_CALLS]->(f)
+		 SET r.site = row.sites[0], r.sites = row.sites,
+		     r.columns = row.columns, r.end_lines = row.end_lines, r.end_columns = row.end_columns,
+		     r.call_exprs = row.exprs, r.call_count = row.count, r.build_config = row.build`,
+		batch,
+	)
+}
+
+// LoadEndpoints upserts the HttpEndpoint nodes served by module and
+// HANDLED_BY edges to the functions handling them. A route registered
+// several times gets one edge per handler. Functions must be loaded first.
+func (l *Neo4jLoader) LoadEndpoints(module string, endpoints []HTTPEndpoint) error {
+	log.Printf("Loading %d HTTP endpoints...", len(endpoints))
+	batch := make([]map[string]any, 0, len(endpoints))
+	for _, e := range endpoints {
+		batch = append(batch, map[string]any{
+			"service": module, "key": e.Key(), "method": nullIfEmpty(e.Method), "path": e.Path,
+			"template": routeTemplate(e.Path), "framework": e.Framework,
+			"handler": funcID(e.Handler), "resolved": e.Handler != "",
+			"registrar": nullIfEmpty(e.Registrar), "site": e.Site.String(),
+			"build": nullIfNone(e.BuildConfigs),
+		})
+	}
+	return l.runBatch(
+		`UNWIND $batch AS row
+		 MERGE (e:HttpEndpoint {service: row.service, key: row.key})
+		 SET e.method = row.method, e.path = row.path, e.path_template = row.template,
+		     e.framework = row.framework
+		 WITH e, row WHERE row.resolved
+		 MATCH (f:GoFunc {id: row.handler})
+		 MERGE (e)-[r:HANDLED_BY]->(f)
+		 SET r.registered_in = row.registrar, r.site = row.site, r.build_config = row.build`,
+		batch,
+	)
+}
+
+// LoadGRPCServices upserts GrpcService and GrpcMethod nodes, keyed by proto
+// name so the graphs of several repositories join on them, with HAS_RPC
+// edges between them and IMPLEMENTED_BY edges to the serving types and
+// methods. Types and functions must be loaded first.
+func (l *Neo4jLoader) LoadGRPCServices(services map[string]*GRPCService) error {
+	log.Printf("Loading %d gRPC services...", len(services))
+	batch := make([]map[string]any, 0, len(services))
+	var methods, typeImpls, funcImpls []map[string]any
+	for _, svc := range services {
+		batch = append(batch, map[string]any{
+			"name": svc.Name, "pkg": svc.Package, "iface": nullIfEmpty(svc.Interface),
+			"build": nullIfNone(svc.BuildConfigs),
+		})
+		for _, key := range svc.Impls {
+			typeImpls = append(typeImpls, map[string]any{
+				"name": svc.Name, "id": typeID(key), "registered": svc.Registered,
+			})
+		}
+		for _, m := range svc.Methods {
+			full := m.FullMethod(svc.Name)
+			methods = append(methods, map[string]any{
+				"service": svc.Name, "full_name": full, "name": m.Name,
+				"client": m.ClientStreaming, "server": m.ServerStreaming,
+			})
+			for _, fn := range m.Impls {
+				if fn != "" {
+					funcImpls = append(funcImpls, map[string]any{"full_name": full, "id": funcID(fn)})
+				}
+			}
+		}
+	}
+	err := l.runBatch(
+		`UNWIND $batch AS row
+		 MERGE (s:GrpcService {name: row.name})
+		 SET s.go_package = row.pkg, s.interface = row.iface, s.build_config = row.build`,
+		batch,
+	)
+	if err != nil {
+		return err
+	}
+	err = l.runBatch(
+		`UNWIND $batch AS row
+		 MATCH (s:GrpcService {name: row.service})
+		 MERGE (m:GrpcMethod {full_name: row.full_name})
+		 SET m.name = row.name, m.service = row.service,
+		     m.client_streaming = row.client, m.server_streaming = row.server
+		 MERGE (s)-[:HAS_RPC]->(m)`,
+		methods,
+	)
+	if err != nil {
+		return err
+	}
+	err = l.runBatch(
+		`UNWIND $batch AS row
+		 MATCH (s:GrpcService {name: row.name}), (t:GoStruct|GoNamedType {id: row.id})
+		 MERGE (s)-[r:IMPLEMENTED_BY]->(t)
+		 SET r.registered = row.registered`,
+		typeImpls,
+	)
+	if err != nil {
+		return err
+	}
+	return l.runBatch(
+		`UNWIND $batch AS row
+		 MATCH (m:GrpcMethod {full_name: row.full_name}), (f:GoFunc {id: row.id})
+		 MERGE (m)-[:IMPLEMENTED_BY]->(f)`,
+		funcImpls,
+	)
+}
+
+// LoadQueries upserts SqlQuery nodes, one per statement text, and the
+// DbTable nodes they read and write, then links the executing functions
+// with EXECUTES edges carrying the call sites. Functions must be loaded
+// first.
+func (l *Neo4jLoader) LoadQueries(queries []SQLQuery) error {
+	log.Printf("Loading %d SQL query executions...", len(queries))
+	var nodes, tables []map[string]any
+	seen := make(map[string]bool)
+	batch := make([]map[string]any, 0, len(queries))
+	for _, q := range queries {
+		id := queryID(q.Text)
+		if !seen[id] {
+			seen[id] = true
+			nodes = append(nodes, map[string]any{
+				"id": id, "text": q.Text, "name": nullIfEmpty(q.Name), "kind": nullIfEmpty(q.Kind),
+			})
+			for _, t := range q.Reads {
+				tables = append(tables, map[string]any{"id": id, "table": t, "write": false})
+			}
+			for _, t := range q.Writes {
+				tables = append(tables, map[string]any{"id": id, "table": t, "write": true})
+			}
+		}
+		row := map[string]any{
+			"caller": funcID(q.Caller),
+			"id":     id,
+			"driver": nullIfEmpty(q.Driver),
+			"count":  len(q.Sites),
+			"build":  nullIfNone(q.BuildConfigs),
+		}
+		addSiteProps(row, q.Sites)
+		batch = append(batch, row)
+	}
+	err := l.runBatch(
+		`UNWIND $batch AS row
+		 MERGE (q:SqlQuery {id: row.id})
+		 SET q.text = row.text, q.name = row.name, q.kind = row.kind`,
+		nodes,
+	)
+	if err != nil {
+		return err
+	}
+	err = l.runBatch(
+		`UNWIND $batch AS row
+		 MATCH (q:SqlQuery {id: row.id})
+		 MERGE (t:DbTable {name: row.table})
+		 FOREACH (_ IN CASE WHEN row.write THEN [] ELSE [1] END | MERGE (q)-[:READS_TABLE]->(t))
+		 FOREACH (_ IN CASE WHEN row.write THEN [1] ELSE [] END | MERGE (q)-[:WRITES_TABLE]->(t))`,
+		tables,
+	)
+	if err != nil {
+		return err
+	}
+	return l.runBatch(
+		`UNWIND $batch AS row
+		 MATCH (f:GoFunc {id: row.caller}), (q:SqlQuery {id: row.id})
+		 MERGE (f)-[r:EXECUTES]->(q)
+		 SET r.driver = row.driver, r.site = row.sites[0], r.sites = row.sites,
+		     r.columns = row.columns, r.end_lines = row.end_lines, r.end_columns = row.end_columns,
+		     r.call_exprs = row.exprs, r.call_count = row.count, r.build_config = row.build`,
+		batch,
+	)
+}
+
+// LoadTopics upserts Topic nodes, keyed by system:name, and the
+// PUBLISHES_TO and CONSUMES_FROM edges of the functions naming them.
+// Functions must be loaded first.
+func (l *Neo4jLoader) LoadTopics(uses []TopicUse) error {
+	log.Printf("Loading %d message queue topic uses...", len(uses))
+	var publish, consume []map[string]any
+	for _, u := range uses {
+		row := map[string]any{
+			"func": funcID(u.Func), "key": u.Key(), "system": u.System, "topic": u.Topic,
+			"count": len(u.Sites), "build": nullIfNone(u.BuildConfigs),
+		}
+		addSiteProps(row, u.Sites)
+		if u.Role == topicPublish {
+			publish = append(publish, row)
+		} else {
+			consume = append(consume, row)
+		}
+	}
+	for _, rel := range []string{"PUBLISHES_TO", "CONSUMES_FROM"} {
+		batch := publish
+		if rel == "CONSUMES_FROM" {
+			batch = consume
+		}
+		err := l.runBatch(
+			`UNWIND $batch AS row
+			 MERGE (t:Topic {key: row.key})
+			 SET t.system = row.system, t.name = row.topic
+			 WITH t, row
+			 MATCH (f:GoFunc {id: row.func})
+			 MERGE (f)-[r:`+rel+`]->(t)
+			 SET r.site = row.sites[0], r.sites = row.sites,
+			     r.columns = row.columns, r.end_lines = row.end_lines, r.end_columns = row.end_columns,
+			     r.call_exprs = row.exprs, r.call_count = row.count, r.build_config = row.build`,
+			batch,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadConfigReads upserts EnvVar and ConfigKey nodes and the READS_CONFIG
+// edges to them from reading functions and from structs whose field tags
+// name environment variables. Functions and structs must be loaded first.
+func (l *Neo4jLoader) LoadConfigReads(reads []ConfigRead) error {
+	log.Printf("Loading %d configuration reads...", len(reads))
+	var envs, keys, tags []map[string]any
+	for _, r := range reads {
+		row := map[string]any{
+			"key": r.Key, "source": r.Source, "count": len(r.Sites), "build": nullIfNone(r.BuildConfigs),
+		}
+		switch {
+		case r.Func == "":
+			row["struct"], row["field"] = typeID(r.Struct), r.Field
+			tags = append(tags, row)
+			continue
+		case r.Kind == configEnv:
+			envs = append(envs, row)
+		default:
+			keys = append(keys, row)
+		}
+		row["func"] = funcID(r.Func)
+		addSiteProps(row, r.Sites)
+	}
+	for _, q := range []struct {
+		merge string
+		batch []map[string]any
+	}{
+		{"MERGE (n:EnvVar {name: row.key})", envs},
+		{"MERGE (n:ConfigKey {key: row.key})", keys},
+	} {
+		err := l.runBatch(
+			`UNWIND $batch AS row
+			 `+q.merge+`
+			 WITH n, row
+			 MATCH (f:GoFunc {id: row.func})
+			 MERGE (f)-[r:READS_CONFIG]->(n)
+			 SET r.source = row.source, r.site = row.sites[0], r.sites = row.sites,
+			     r.columns = row.columns, r.end_lines = row.end_lines, r.end_columns = row.end_columns,
+			     r.call_exprs = row.exprs, r.call_count = row.count, r.build_config = row.build`,
+			q.batch,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return l.runBatch(
+		`UNWIND $batch AS row
+		 MERGE (n:EnvVar {name: row.key})
+		 WITH n, row
+		 MATCH (s:GoStruct {id: row.struct})
+		 MERGE (s)-[r:READS_CONFIG {field: row.field}]->(n)
+		 SET r.source = row.source, r.build_config = row.build`,
+		tags,
+	)
+}
+
+// LoadWiring writes dependency injection wiring: PROVIDES edges from
+// constructors (or types, for wire.Struct, wire.FieldsOf and wire.Bind) to
+// the types they provide, and INJECTS edges from types to the constructors,
+// invoked functions and wire structs receiving them. Functions and types
+// must be loaded first.
+func (l *Neo4jLoader) LoadWiring(edges []DIEdge) error {
+	log.Printf("Loading %d dependency injection edges...", len(edges))
+	var provides, injects []map[string]any
+	for _, e := range edges {
+		id := funcID(e.Func)
+		if e.Func == "" {
+			id = typeID(e.Struct)
+		}
+		row := map[string]any{
+			"id": id, "type": typeID(e.Type), "framework": e.Framework,
+			"count": len(e.Sites), "build": nullIfNone(e.BuildConfigs),
+		}
+		addSiteProps(row, e.Sites)
+		if e.Kind == diProvides {
+			provides = append(provides, row)
+		} else {
+			injects = append(injects, row)
+		}
+	}
+	for _, q := range []struct {
+		merge string
+		batch []map[string]any
+	}{
+		{"MERGE (n)-[r:PROVIDES {framework: row.framework}]->(t)", provides},
+		{"MERGE (t)-[r:INJECTS {framework: row.framework}]->(n)", injects},
+	} {
+		err := l.runBatch(
+			`UNWIND $batch AS row
+			 MATCH (n:GoFunc|GoStruct|GoNamedType {id: row.id}), (t:GoStruct|GoInterface|GoNamedType {id: row.type})
+			 `+q.merge+`
+			 SET r.site = row.sites[0], r.sites = row.sites,
+			     r.columns = row.columns, r.end_lines = row.end_lines, r.end_columns = row.end_columns,
+			     r.call_exprs = row.exprs, r.call_count = row.count, r.build_config = row.build`,
+			q.batch,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadPanics sets panics and recovers on project functions and, when
+// propagate is set, may_panic and MAY_PANIC edges along the calls a panic
+// can travel back through. Functions and calls must be loaded first.
+func (l *Neo4jLoader) LoadPanics(funcs map[string]*FuncNode, calls []CallEdge, propagate bool) error {
+	log.Println("Loading panic and recover facts...")
+	batch := make([]map[string]any, 0, len(funcs))
+	for _, fn := range funcs {
+		row := map[string]any{"id": funcID(fn.FullName), "panics": fn.Panics, "recovers": fn.Recovers, "may_panic": nil}
+		if propagate {
+			row["may_panic"] = fn.MayPanic
+		}
+		batch = append(batch, row)
+	}
+	err := l.runBatch(
+		`UNWIND $batch AS row
+		 MATCH (f:GoFunc {id: row.id})
+		 SET f.panics = row.panics, f.recovers = row.recovers, f.may_panic = row.may_panic`,
+		batch,
+	)
+	if err != nil || !propagate {
+		return err
+	}
+	var edges []map[string]any
+	for _, c := range calls {
+		if c.MayPanic {
+			row := map[string]any{"caller": funcID(c.CallerFullName), "callee": funcID(c.CalleeFullName)}
+			addSiteProps(row, c.Sites)
+			edges = append(edges, row)
+		}
+	}
+	return l.runBatch(
+		`UNWIND $batch AS row
+		 MATCH (a:GoFunc {id: row.caller}), (b:GoFunc {id: row.callee})
+		 MERGE (a)-[r:MAY_PANIC]->(b)
+		 SET r.site = row.sites[0], r.sites = row.sites`,
+		edges,
+	)
+}
+
+// LoadLayers copies the layer of each package onto the files, types and
+// functions it contains, and replaces the Layer nodes, the IN_LAYER edges
+// from packages and the LAYER_DEPENDS_ON edges between layers. Packages,
+// files, types and functions must be loaded first.
+func (l *Neo4jLoader) LoadLayers(pkgs map[string]*PackageNode, layers []Layer, deps []LayerDependency) error {
+	log.Printf("Loading %d layers, %d layer dependencies...", len(layers), len(deps))
+	batch := make([]map[string]any, 0, len(pkgs))
+	for _, p := range pkgs {
+		batch = append(batch, map[string]any{"pkg": p.ImportPath, "layer": nullIfEmpty(p.Layer)})
+	}
+	for _, q := range []string{
+		"MATCH (p:GoPackage {import_path: row.pkg})-[:CONTAINS]->(n:GoFile)",
+		"MATCH (p:GoPackage {import_path: row.pkg})<-[:IN_PACKAGE]-(n)",
+	} {
+		err := l.runBatch(
+			`UNWIND $batch AS row
+			 `+q+`
+			 SET n.layer = row.layer`,
+			batch,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := l.runCypher("MATCH ()-[r:IN_LAYER|LAYER_DEPENDS_ON]->() DELETE r", nil); err != nil {
+		return err
+	}
+	if err := l.runCypher("MATCH (n:Layer) DELETE n", nil); err != nil {
+		return err
+	}
+	rows := make([]map[string]any, 0, len(layers))
+	for i, layer := range layers {
+		row := map[string]any{"name": layer.Name, "position": i + 1}
+		if layer.Unordered {
+			row["position"] = nil
+		}
+		rows = append(rows, row)
+	}
+	err := l.runBatch(
+		`UNWIND $batch AS row
+		 MERGE (l:Layer {name: row.name})
+		 SET l.position = row.position
+		 WITH l
+		 MATCH (p:GoPackage {layer: l.name})
+		 MERGE (p)-[:IN_LAYER]->(l)`,
+		rows,
+	)
+	if err != nil {
+		return err
+	}
+	rows = make([]map[string]any, 0, len(deps))
+	for _, d := range deps {
+		rows = append(rows, map[string]any{
+			"from": d.From, "to": d.To, "imports": d.Imports, "calls": d.Calls, "direction": d.Direction,
+		})
+	}
+	return l.runBatch(
+		`UNWIND $batch AS row
+		 MATCH (a:Layer {name: row.from}), (b:Layer {name: row.to})
+		 MERGE (a)-[r:LAYER_DEPENDS_ON]->(b)
+		 SET r.imports = row.imports, r.calls = row.calls, r.direction = row.direction`,
+		rows,
+	)
+}
+
+// LoadSyncUses upserts SyncVar nodes for the sync primitives of project
+// structs and variables, GUARDS edges from mutex fields to their struct
+// (with the fields they guard), and LOCKS edges from the functions calling
+// their methods (with the method as op). Functions and types must be
+// loaded first.
+func (l *Neo4jLoader) LoadSyncUses(uses []SyncUse) error {
+	log.Printf("Loading %d sync primitive uses...", len(uses))
+	var decls, calls []map[string]any
+	for _, u := range uses {
+		row := map[string]any{
+			"var": u.Var, "kind": u.Kind, "pkg": u.Package, "struct": nullIfEmpty(u.Struct), "name": u.Field,
+			"build": nullIfNone(u.BuildConfigs),
+		}
+		if u.Func == "" {
+			row["guards"] = syncKinds[u.Kind] && u.Struct != ""
+			row["struct_id"], row["fields"] = typeID(u.Struct), nullIfNone(u.Guarded)
+			decls = append(decls, row)
+			continue
+		}
+		row["func"], row["op"], row["count"] = funcID(u.Func), u.Op, len(u.Sites)
+		addSiteProps(row, u.Sites)
+		calls = append(calls, row)
+	}
+	err := l.runBatch(
+		`UNWIND $batch AS row
+		 MERGE (v:SyncVar {key: row.var})
+		 SET v.kind = row.kind, v.package = row.pkg, v.struct = row.struct, v.name = row.name,
+		     v.build_config = row.build
+		 WITH v, row WHERE row.guards
+		 MATCH (s:GoStruct {id: row.struct_id})
+		 MERGE (v)-[r:GUARDS]->(s)
+		 SET r.fields = row.fields, r.build_config = row.build`,
+		decls,
+	)
+	if err != nil {
+		return err
+	}
+	return l.runBatch(
+		`UNWIND $batch AS row
+		 MERGE (v:SyncVar {key: row.var})
+		 ON CREATE SET v.kind = row.kind, v.package = row.pkg, v.struct = row.struct, v.name = row.name
+		 WITH v, row
+		 MATCH (f:GoFunc {id: row.func})
+		 MERGE (f)-[r:LOCKS {op: row.op}]->(v)
+		 SET r.site = row.sites[0], r.sites = row.sites,
+		     r.columns = row.columns, r.end_lines = row.end_lines, r.end_columns = row.end_columns,
+		     r.call_exprs = row.exprs, r.call_count = row.count, r.build_config = row.build`,
+		calls,
+	)
+}
+
+// LoadErrorFlows writes PROPAGATES_ERROR_TO edges from functions whose
+// error their caller returns, as is or wrapped, to that caller, and
+// IGNORES_ERROR edges from callers discarding an error to the function
+// returning it. Functions must be loaded first.
+func (l *Neo4jLoader) LoadErrorFlows(flows []ErrorFlow) error {
+	log.Printf("Loading %d error flows...", len(flows))
+	var propagated, ignored []map[string]any
+	for _, f := range flows {
+		row := map[string]any{
+			"callee": funcID(f.Callee), "caller": funcID(f.Caller), "wrapped": f.Kind == errorWrapped,
+			"count": len(f.Sites), "build": nullIfNone(f.BuildConfigs),
+		}
+		addSiteProps(row, f.Sites)
+		if f.Kind == errorIgnored {
+			ignored = append(ignored, row)
+		} else {
+			propagated = append(propagated, row)
+		}
+	}
+	for _, q := range []struct {
+		merge string
+		batch []map[string]any
+	}{
+		{"MERGE (callee)-[r:PROPAGATES_ERROR_TO]->(caller) SET r.wrapped = row.wrapped,", propagated},
+		{"MERGE (caller)-[r:IGNORES_ERROR]->(callee) SET", ignored},
+	} {
+		err := l.runBatch(
+			`UNWIND $batch AS row
+			 MATCH (callee:GoFunc {id: row.callee}), (caller:GoFunc {id: row.caller})
+			 `+q.merge+` r.site = row.sites[0], r.sites = row.sites,
+			     r.columns = row.columns, r.end_lines = row.end_lines, r.end_columns = row.end_columns,
+			     r.call_exprs = row.exprs, r.call_count = row.count, r.build_config = row.build`,
+			q.batch,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadFuncValues writes the uses of functions as values: PASSES_FUNC edges
+// from the using function to the function value, keyed by kind and target
+// (the receiving function, Struct.Field or variable), and REGISTERED_AS
+// edges from the function value to the function it is passed to or the
+// struct it is stored in, so callbacks connect to what invokes them.
+// Functions and structs must be loaded first.
+func (l *Neo4jLoader) LoadFuncValues(uses []FuncValueUse) error {
+	log.Printf("Loading %d function value uses...", len(uses))
+	batch := make([]map[string]any, 0, len(uses))
+	var toFuncs, toStructs []map[string]any
+	for _, u := range uses {
+		target := u.Callee
+		switch u.Kind {
+		case funcValueField:
+			target = u.Struct + "." + u.Field
+		case funcValueGlobal:
+			target = u.Field
+		}
+		row := map[string]any{
+			"holder": funcID(u.Holder), "holder_name": u.Holder, "func": funcID(u.Func),
+			"kind": u.Kind, "target": target, "param": u.Param, "field": u.Field,
+			"count": len(u.Sites), "build": nullIfNone(u.BuildConfigs),
+		}
+		addSiteProps(row, u.Sites)
+		batch = append(batch, row)
+		switch {
+		case u.Callee != "":
+			row["callee"] = funcID(u.Callee)
+			toFuncs = append(toFuncs, row)
+		case u.Kind == funcValueField && u.Struct != "":
+			row["struct"] = typeID(u.Struct)
+			toStructs = append(toStructs, row)
+		}
+	}
+	err := l.runBatch(
+		`UNWIND $batch AS row
+		 MATCH (h:GoFunc {id: row.holder}), (f:GoFunc {id: row.func})
+		 MERGE (h)-[r:PASSES_FUNC {kind: row.kind, target: row.target}]->(f)
+		 SET r.param = row.param, r.site = row.sites[0], r.sites = row.sites,
+		     r.columns = row.columns, r.end_lines = row.end_lines, r.end_columns = row.end_columns,
+		     r.call_exprs = row.exprs, r.call_count = row.count, r.build_config = row.build`,
+		batch,
+	)
+	if err != nil {
+		return err
+	}
+	for _, q := range []struct {
+		match string
+		batch []map[string]any
+	}{
+		{"MATCH (t:GoFunc {id: row.callee}) MERGE (f)-[r:REGISTERED_AS {param: row.param}]->(t)", toFuncs},
+		{"MATCH (t:GoStruct {id: row.struct}) MERGE (f)-[r:REGISTERED_AS {field: row.field}]->(t)", toStructs},
+	} {
+		err := l.runBatch(
+			`UNWIND $batch AS row
+			 MATCH (f:GoFunc {id: row.func})
+			 `+q.match+`
+			 SET r.registered_in = row.holder_name, r.site = row.sites[0], r.sites = row.sites,
+			     r.call_count = row.count, r.build_config = row.build`,
+			q.batch,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadServiceCalls writes the calls module makes to other services: gRPC
+// client calls as CALLS_SERVICE edges to GrpcMethod nodes, and HTTP
+// requests as SENDS_REQUEST edges to HttpRequest nodes carrying the path
+// template and the pattern of the routes it can reach. LinkServices then
+// resolves requests to endpoints. Functions must be loaded first.
+func (l *Neo4jLoader) LoadServiceCalls(module string, calls []ServiceCall) error {
+	log.Printf("Loading %d outbound service calls...", len(calls))
+	var rpcs, requests []map[string]any
+	for _, sc := range calls {
+		row := map[string]any{
+			"func": funcID(sc.Func), "count": len(sc.Sites), "build": nullIfNone(sc.BuildConfigs),
+		}
+		addSiteProps(row, sc.Sites)
+		if sc.Protocol == protocolGRPC {
+			row["target"] = sc.Target
+			rpcs = append(rpcs, row)
+			continue
+		}
+		row["key"] = module + " " + sc.Key()
+		row["module"], row["method"], row["path"] = module, nullIfEmpty(sc.Method), sc.Path
+		row["pattern"] = pathPattern(sc.Path)
+		requests = append(requests, row)
+	}
+	err := l.runBatch(
 		`UNWIND $batch AS row
-		 MATCH (s:GoStruct {key: row.struct}), (i:GoInterface {key: row.iface})
-		 MERGE (s)-[:IMPLEMENTS]->(i)`,
-		map[string]any{"batch": batch},
+		 MATCH (f:GoFunc {id: row.func})
+		 MERGE (m:GrpcMethod {full_name: row.target})
+		 MERGE (f)-[r:CALLS_SERVICE]->(m)
+		 SET r.protocol = 'grpc', r.site = row.sites[0], r.sites = row.sites,
+		     r.columns = row.columns, r.end_lines = row.end_lines, r.end_columns = row.end_columns,
+		     r.call_exprs = row.exprs, r.call_count = row.count, r.build_config = row.build`,
+		rpcs,
 	)
+	if err != nil {
+		return err
+	}
+	return l.runBatch(
+		`UNWIND $batch AS row
+		 MERGE (h:HttpRequest {key: row.key})
+		 SET h.module = row.module, h.method = row.method, h.path = row.path, h.pattern = row.pattern
+		 WITH h, row
+		 MATCH (f:GoFunc {id: row.func})
+		 MERGE (f)-[r:SENDS_REQUEST]->(h)
+		 SET r.site = row.sites[0], r.sites = row.sites,
+		     r.columns = row.columns, r.end_lines = row.end_lines, r.end_columns = row.end_columns,
+		     r.call_exprs = row.exprs, r.call_count = row.count, r.build_config = row.build`,
+		requests,
+	)
+}
+
+// LinkServices resolves HTTP requests to the endpoints of other services
+// whose path template matches and whose method is compatible, adding
+// CALLS_SERVICE edges from the requesting functions, then summarizes all
+// cross-service calls as CALLS_SERVICE edges between GoModule nodes. It
+// works on whatever repositories are in the graph, so it is rerun after
+// each one is loaded, whatever their order.
+func (l *Neo4jLoader) LinkServices() error {
+	log.Println("Linking service calls across repositories...")
+	queries := []string{
+		`MATCH (f:GoFunc)-[s:SENDS_REQUEST]->(h:HttpRequest), (e:HttpEndpoint)
+		 WHERE e.service <> h.module AND e.path_template =~ h.pattern
+		   AND (h.method IS NULL OR e.method IS NULL OR e.method = h.method)
+		 MERGE (f)-[r:CALLS_SERVICE]->(e)
+		 SET r.protocol = 'http', r.site = s.site, r.sites = s.sites, r.call_count = s.call_count`,
+		`MATCH (f:GoFunc)-[:CALLS_SERVICE]->(e:HttpEndpoint)
+		 MATCH (f)-[:IN_PACKAGE]->(p:GoPackage)
+		 MATCH (a:GoModule {path: p.module}), (b:GoModule {path: e.service})
+		 WHERE a <> b
+		 MERGE (a)-[r:CALLS_SERVICE {protocol: 'http'}]->(b)`,
+		`MATCH (f:GoFunc)-[:CALLS_SERVICE]->(:GrpcMethod)-[:IMPLEMENTED_BY]->(impl:GoFunc)
+		 MATCH (f)-[:IN_PACKAGE]->(p:GoPackage), (impl)-[:IN_PACKAGE]->(q:GoPackage)
+		 MATCH (a:GoModule {path: p.module}), (b:GoModule {path: q.module})
+		 WHERE a <> b
+		 MERGE (a)-[r:CALLS_SERVICE {protocol: 'grpc'}]->(b)`,
+	}
+	for _, q := range queries {
+		if err := l.runCypher(q, nil); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestOrphanFuncs(t *testing.T) {
+	names, err := NewGraphNames(nil, "Acme", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		names   *GraphNames
+		project string
+		want    string
+	}{
+		{
+			name: "default names",
+			want: "MATCH (f:GoFunc) WHERE f.package IS NULL AND f.file IS NULL AND NOT f:External",
+		},
+		{
+			// The vulnerable symbols of LoadVulns are External, with
+			// the renamed label.
+			name:    "prefix and project",
+			names:   names,
+			project: "$project",
+			want:    "MATCH (f:AcmeGoFunc {project: $project}) WHERE f.package IS NULL AND f.file IS NULL AND NOT f:AcmeExternal",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.names.Rewrite(orphanFuncs)
+			if tt.project != "" {
+				got = scopeToProject(got, tt.project)
+			}
+			if got != tt.want {
+				t.Errorf("orphanFuncs\n got %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// lookupIndexVersion changes whenever LookupIndex changes shape.
+const lookupIndexVersion = 1
+
+// LookupIndex is the jump data of every function, written by export
+// lookup for editors to show callers and callees without Neo4j. Calls
+// refer to functions by their index in Symbols.
+type LookupIndex struct {
+	Version     int              `json:"version"`
+	GeneratedAt time.Time        `json:"generated_at"`
+	Symbols     []LookupSymbol   `json:"symbols"` // sorted by name
+	Files       map[string][]int `json:"files"`   // file -> symbols declared in it, by line
+}
+
+// LookupSymbol is a function of a LookupIndex.
+type LookupSymbol struct {
+	Name     string       `json:"name"`
+	File     string       `json:"file,omitempty"` // relative to the project root
+	Line     int          `json:"line,omitempty"`
+	EndLine  int          `json:"end_line,omitempty"`
+	External bool         `json:"external,omitempty"`
+	Callers  []LookupCall `json:"callers,omitempty"`
+	Callees  []LookupCall `json:"callees,omitempty"`
+}
+
+// LookupCall is the calls between a symbol and the one at Symbol.
+type LookupCall struct {
+	Symbol  int      `json:"symbol"`
+	Dynamic bool     `json:"dynamic,omitempty"`
+	Sites   []string `json:"sites,omitempty"` // file:line, relative to the project root
+}
+
+// lookupFunc is a function with its location, as read from a call graph.
+type lookupFunc struct {
+	Name          string
+	File          string
+	Line, EndLine int
+	External      bool
+}
+
+// BuildLookupIndex returns the lookup index of g. File paths under root
+// are made relative to it.
+func BuildLookupIndex(g callGraphReader, root string) (*LookupIndex, error) {
+	funcs, calls, err := g.allCalls()
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(funcs, func(a, b lookupFunc) int { return strings.Compare(a.Name, b.Name) })
+	rel := func(file string) string {
+		if r, err := filepath.Rel(root, file); err == nil && filepath.IsAbs(file) && !strings.HasPrefix(r, "..") {
+			return filepath.ToSlash(r)
+		}
+		return filepath.ToSlash(file)
+	}
+	relSite := func(site string) string {
+		if i := strings.LastIndexByte(site, ':'); i > 0 {
+			return rel(site[:i]) + site[i:]
+		}
+		return site
+	}
+
+	idx := &LookupIndex{Version: lookupIndexVersion, GeneratedAt: time.Now().UTC(), Files: make(map[string][]int)}
+	index := make(map[string]int, len(funcs))
+	for _, fn := range funcs {
+		index[fn.Name] = len(idx.Symbols)
+		sym := LookupSymbol{Name: fn.Name, Line: fn.Line, EndLine: fn.EndLine, External: fn.External}
+		if fn.File != "" {
+			sym.File = rel(fn.File)
+			idx.Files[sym.File] = append(idx.Files[sym.File], len(idx.Symbols))
+		}
+		idx.Symbols = append(idx.Symbols, sym)
+	}
+	for _, caller := range sortedKeys(calls) {
+		from, ok := index[caller]
+		if !ok {
+			continue
+		}
+		edges := calls[caller]
+		slices.SortFunc(edges, func(a, b queryEdge) int { return strings.Compare(a.Func, b.Func) })
+		for _, e := range edges {
+			to, ok := index[e.Func]
+			if !ok {
+				continue
+			}
+			sites := make([]string, len(e.Sites))
+			for i, s := range e.Sites {
+				sites[i] = relSite(s)
+			}
+			idx.Symbols[from].Callees = append(idx.Symbols[from].Callees, LookupCall{Symbol: to, Dynamic: e.Dynamic, Sites: sites})
+			idx.Symbols[to].Callers = append(idx.Symbols[to].Callers, LookupCall{Symbol: from, Dynamic: e.Dynamic, Sites: sites})
+		}
+	}
+	for _, syms := range idx.Files {
+		slices.SortStableFunc(syms, func(a, b int) int { return idx.Symbols[a].Line - idx.Symbols[b].Line })
+	}
+	return idx, nil
+}
+
+// allCalls implements callGraphReader on the analysed project.
+func (c *Collector) allCalls() ([]lookupFunc, map[string][]queryEdge, error) {
+	funcs := make([]lookupFunc, 0, len(c.Funcs)+len(c.ExternalFuncs))
+	for _, fn := range c.Funcs {
+		funcs = append(funcs, lookupFunc{Name: fn.FullName, File: fn.File, Line: fn.Line, EndLine: fn.EndLine})
+	}
+	for _, fn := range c.ExternalFuncs {
+		funcs = append(funcs, lookupFunc{Name: fn.FullName, External: true})
+	}
+	calls := make(map[string][]queryEdge)
+	for _, e := range c.Calls {
+		sites := make([]string, len(e.Sites))
+		for i, s := range e.Sites {
+			sites[i] = s.String()
+		}
+		calls[e.CallerFullName] = append(calls[e.CallerFullName],
+			queryEdge{Func: e.CalleeFullName, Dynamic: e.IsDynamic, External: e.External, Sites: sites})
+	}
+	return funcs, calls, nil
+}
+
+// allCalls implements callGraphReader.
+func (r *neo4jReader) allCalls() ([]lookupFunc, map[string][]queryEdge, error) {
+	recs, err := r.read(`MATCH (f:GoFunc)
+		 WHERE f.deleted IS NULL AND f.full_name IS NOT NULL
+		 RETURN f.full_name AS name, f.file AS file, f.line AS line, f.end_line AS end_line, f:External AS external`, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	funcs := make([]lookupFunc, 0, len(recs))
+	for _, rec := range recs {
+		var fn lookupFunc
+		fn.Name, _, _ = neo4j.GetRecordValue[string](rec, "name")
+		fn.File, _, _ = neo4j.GetRecordValue[string](rec, "file")
+		line, _, _ := neo4j.GetRecordValue[int64](rec, "line")
+		endLine, _, _ := neo4j.GetRecordValue[int64](rec, "end_line")
+		fn.Line, fn.EndLine = int(line), int(endLine)
+		fn.External, _, _ = neo4j.GetRecordValue[bool](rec, "external")
+		funcs = append(funcs, fn)
+	}
+	recs, err = r.read(`MATCH (f:GoFunc)-[r:ACCURATE_CALLS|CALLS_EXTERNAL]->(g:GoFunc)
+		 WHERE f.deleted IS NULL AND g.deleted IS NULL
+		 RETURN f.full_name AS caller, g.full_name AS callee, coalesce(r.is_dynamic, false) AS dynamic,
+		        type(r) = 'CALLS_EXTERNAL' AS external, coalesce(r.sites, []) AS sites`, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	calls := make(map[string][]queryEdge)
+	for _, rec := range recs {
+		caller, _, _ := neo4j.GetRecordValue[string](rec, "caller")
+		e := queryEdge{}
+		e.Func, _, _ = neo4j.GetRecordValue[string](rec, "callee")
+		e.Dynamic, _, _ = neo4j.GetRecordValue[bool](rec, "dynamic")
+		e.External, _, _ = neo4j.GetRecordValue[bool](rec, "external")
+		sites, _, _ := neo4j.GetRecordValue[[]any](rec, "sites")
+		for _, s := range sites {
+			if s, ok := s.(string); ok {
+				e.Sites = append(e.Sites, s)
+			}
+		}
+		calls[caller] = append(calls[caller], e)
+	}
+	return funcs, calls, nil
+}
+
+// runExportLookup implements export lookup.
+func runExportLookup(args []string) error {
+	cmd := flag.NewFlagSet("export lookup", flag.ExitOnError)
+	neo4jURI := cmd.String("neo4j-uri", "bolt://localhost:7687", "Neo4j URI: bolt:// for one server, neo4j:// to route in a cluster")
+	neo4jUser := cmd.String("neo4j-user", "neo4j", "Neo4j username")
+	neo4jPass := cmd.String("neo4j-pass", "", "Neo4j password; without it the project in --dir is analysed in memory")
+	dir := cmd.String("dir", ".", "Project root directory, which file paths are made relative to")
+	tags := cmd.String("tags", "", "Comma-separated build tags, when analysing in memory")
+	out := cmd.String("out", "", "Write the index to this file instead of stdout")
+	graphOpts := addGraphFlags(cmd)
+	cmd.Usage = func() {
+		fmt.Fprintln(cmd.Output(), "Usage: go-callgraph-neo4j export lookup [--out <file.json>] [flags]")
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+	if cmd.NArg() > 0 {
+		cmd.Usage()
+		os.Exit(1)
+	}
+	names, err := graphOpts.names()
+	if err != nil {
+		return err
+	}
+	absDir, err := filepath.Abs(*dir)
+	if err != nil {
+		return err
+	}
+	g, closeGraph, err := openCallGraph(*neo4jURI, *neo4jUser, *neo4jPass, names, *graphOpts.project, absDir, *tags)
+	if err != nil {
+		return err
+	}
+	defer closeGraph()
+	idx, err := BuildLookupIndex(g, absDir)
+	if err != nil {
+		return err
+	}
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("failed to create lookup index: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(idx); err != nil {
+		return err
+	}
+	log.Printf("Exported the callers and callees of %d functions", len(idx.Symbols))
+	return nil
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf16"
+)
+
+// lsifVersion is the version of the LSIF specification the index follows.
+const lsifVersion = "0.5.0"
+
+// lsifWriter writes the vertices and edges of an LSIF index as JSON lines,
+// numbering them in order.
+type lsifWriter struct {
+	enc *json.Encoder
+	id  int
+	err error
+}
+
+// emit writes element with the next id and returns the id.
+func (w *lsifWriter) emit(kind, label string, fields map[string]any) int {
+	w.id++
+	element := map[string]any{"id": w.id, "type": kind, "label": label}
+	for k, v := range fields {
+		element[k] = v
+	}
+	if w.err == nil {
+		w.err = w.enc.Encode(element)
+	}
+	return w.id
+}
+
+func (w *lsifWriter) vertex(label string, fields map[string]any) int {
+	return w.emit("vertex", label, fields)
+}
+
+// edge writes a one-to-one edge such as next or textDocument/definition.
+func (w *lsifWriter) edge(label string, out, in int) {
+	w.emit("edge", label, map[string]any{"outV": out, "inV": in})
+}
+
+// edges writes a one-to-many edge such as contains or item; fields are
+// added to it, such as the document of item edges.
+func (w *lsifWriter) edges(label string, out int, in []int, fields map[string]any) {
+	if len(in) == 0 {
+		return
+	}
+	all := map[string]any{"outV": out, "inVs": in}
+	for k, v := range fields {
+		all[k] = v
+	}
+	w.emit("edge", label, all)
+}
+
+// lsifDocument is a source file of the index with the ranges in it.
+type lsifDocument struct {
+	id     int
+	lines  []string
+	ranges map[[2]int]int // line and UTF-16 character -> range
+	order  []int
+}
+
+// lsifSymbol is a function or type of the index: its result set, the range
+// of its definition if it is in the project, and its references.
+type lsifSymbol struct {
+	resultSet int
+	defRange  int
+	defDoc    int
+	refs      map[int][]int // document -> ranges
+}
+
+// lsifIndex builds an LSIF index of a Collector.
+type lsifIndex struct {
+	w       *lsifWriter
+	c       *Collector
+	dir     string
+	docs    map[string]*lsifDocument
+	docIDs  []int
+	symbols map[string]*lsifSymbol
+	order   []string // symbol keys in order of creation
+	modules map[string]int
+}
+
+// WriteLSIF writes an LSIF index of the project analysed by c, whose root
+// is dir, for code navigation in Sourcegraph or an editor: the definitions
+// of functions and types with their signatures, the references of calls,
+// including those VTA resolved through interfaces and function values, and
+// the types implementing each interface. Calls into dependencies carry
+// import monikers naming the module and version, for cross-repository
+// navigation.
+func WriteLSIF(out io.Writer, c *Collector, dir string) error {
+	bw := bufio.NewWriter(out)
+	x := &lsifIndex{
+		w: &lsifWriter{enc: json.NewEncoder(bw)}, c: c, dir: dir,
+		docs: make(map[string]*lsifDocument), symbols: make(map[string]*lsifSymbol), modules: make(map[string]int),
+	}
+	x.w.vertex("metaData", map[string]any{
+		"version": lsifVersion, "projectRoot": fileURI(dir), "positionEncoding": "utf-16",
+		"toolInfo": map[string]any{"name": "go-callgraph-neo4j", "version": toolVersion()},
+	})
+	project := x.w.vertex("project", map[string]any{"kind": "go"})
+
+	for _, name := range sortedKeys(c.Funcs) {
+		fn := c.Funcs[name]
+		if fn.Synthetic != "" || !token.IsIdentifier(fn.Name) {
+			continue // wrappers and closures have no name in the source
+		}
+		after := ""
+		if fn.IsMethod {
+			after = ")" // the receiver
+		}
+		hover := "```go\n" + fn.Signature + "\n```"
+		if fn.Signature == "" {
+			hover = "```go\nfunc " + fn.Name + "\n```"
+		}
+		if fn.Doc != "" {
+			hover += "\n\n" + fn.Doc
+		}
+		x.define(name, fn.File, fn.Line, fn.Name, after, hover, fn.Exported, fn.Package)
+	}
+	for _, key := range sortedKeys(c.Structs) {
+		s := c.Structs[key]
+		x.define(key, s.File, s.Line, s.Name, "", "```go\ntype "+s.Name+" struct\n```", s.Exported, s.Package)
+	}
+	for _, key := range sortedKeys(c.Interfaces) {
+		i := c.Interfaces[key]
+		x.define(key, i.File, i.Line, i.Name, "", "```go\ntype "+i.Name+" interface\n```", i.Exported, i.Package)
+	}
+	for _, key := range sortedKeys(c.NamedTypes) {
+		t := c.NamedTypes[key]
+		x.define(key, t.File, t.Line, t.Name, "", "```go\ntype "+t.Name+" "+t.Underlying+"\n```", t.Exported, t.Package)
+	}
+
+	for _, call := range c.Calls {
+		if _, ok := c.Funcs[call.CallerFullName]; !ok {
+			continue
+		}
+		name := ""
+		if fn, ok := c.Funcs[call.CalleeFullName]; ok {
+			name = fn.Name
+		} else if ext, ok := c.ExternalFuncs[call.CalleeFullName]; ok {
+			name = ext.Name
+		}
+		sym := x.symbol(call.CalleeFullName)
+		if sym == nil || !token.IsIdentifier(name) {
+			continue
+		}
+		for _, site := range call.Sites {
+			doc, r, ok := x.callRange(site, name)
+			if !ok {
+				continue
+			}
+			if !call.IsDynamic {
+				// A range has a single result set, so the definition of
+				// a dynamic call, with its several callees, is left out;
+				// the call is among the references of each of them.
+				x.w.edge("next", r, sym.resultSet)
+			}
+			sym.refs[doc] = append(sym.refs[doc], r)
+		}
+	}
+
+	for _, key := range x.order {
+		sym := x.symbols[key]
+		if sym.defRange != 0 {
+			def := x.w.vertex("definitionResult", nil)
+			x.w.edge("textDocument/definition", sym.resultSet, def)
+			x.w.edges("item", def, []int{sym.defRange}, map[string]any{"document": sym.defDoc})
+		}
+		refs := x.w.vertex("referenceResult", nil)
+		x.w.edge("textDocument/references", sym.resultSet, refs)
+		if sym.defRange != 0 {
+			x.w.edges("item", refs, []int{sym.defRange}, map[string]any{"document": sym.defDoc, "property": "definitions"})
+		}
+		for _, doc := range sortedKeys(sym.refs) {
+			x.w.edges("item", refs, sym.refs[doc], map[string]any{"document": doc, "property": "references"})
+		}
+	}
+
+	impls := make(map[string]map[int][]int) // interface -> document -> ranges
+	for _, edge := range c.Implements {
+		iface, impl := x.symbols[edge.Interface], x.symbols[edge.Struct]
+		if iface == nil || impl == nil || impl.defRange == 0 {
+			continue
+		}
+		if impls[edge.Interface] == nil {
+			impls[edge.Interface] = make(map[int][]int)
+		}
+		impls[edge.Interface][impl.defDoc] = append(impls[edge.Interface][impl.defDoc], impl.defRange)
+	}
+	for _, key := range sortedKeys(impls) {
+		result := x.w.vertex("implementationResult", nil)
+		x.w.edge("textDocument/implementation", x.symbols[key].resultSet, result)
+		for _, doc := range sortedKeys(impls[key]) {
+			x.w.edges("item", result, impls[key][doc], map[string]any{"document": doc})
+		}
+	}
+
+	for _, path := range sortedKeys(x.docs) {
+		if doc := x.docs[path]; doc != nil {
+			x.w.edges("contains", doc.id, doc.order, nil)
+		}
+	}
+	x.w.edges("contains", project, x.docIDs, nil)
+	if x.w.err != nil {
+		return fmt.Errorf("cannot write LSIF index: %w", x.w.err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("cannot write LSIF index: %w", err)
+	}
+	return nil
+}
+
+// define adds the definition of the function or type key, named name at
+// line of file. The name is looked for on the line after the first
+// occurrence of after, which skips method receivers.
+func (x *lsifIndex) define(key, file string, line int, name, after, hover string, exported bool, pkg string) {
+	doc := x.document(file)
+	if doc == nil || line < 1 || line > len(doc.lines) {
+		return
+	}
+	text := doc.lines[line-1]
+	start := 0
+	if after != "" {
+		if i := strings.Index(text, after); i >= 0 {
+			start = i + len(after)
+		}
+	}
+	col := identifierIndex(text[start:], name, false)
+	if col < 0 {
+		return
+	}
+	r := x.rangeAt(doc, line, text, start+col, len(name))
+	sym := &lsifSymbol{resultSet: x.w.vertex("resultSet", nil), defRange: r, defDoc: doc.id, refs: make(map[int][]int)}
+	x.w.edge("next", r, sym.resultSet)
+	hoverID := x.w.vertex("hoverResult", map[string]any{
+		"result": map[string]any{"contents": map[string]any{"kind": "markdown", "value": hover}},
+	})
+	x.w.edge("textDocument/hover", sym.resultSet, hoverID)
+	if exported {
+		moniker := x.w.vertex("moniker", map[string]any{"scheme": "gomod", "identifier": key, "unique": "scheme", "kind": "export"})
+		x.w.edge("moniker", sym.resultSet, moniker)
+		if p := x.c.Packages[pkg]; p != nil && p.Module != "" {
+			x.w.edge("packageInformation", moniker, x.module(p.Module, ""))
+		}
+	}
+	x.symbols[key] = sym
+	x.order = append(x.order, key)
+}
+
+// symbol returns the symbol of the function called as key: its
+// definition, or for a dependency function a result set with an import
+// moniker. It returns nil for project functions without a definition.
+func (x *lsifIndex) symbol(key string) *lsifSymbol {
+	if sym, ok := x.symbols[key]; ok {
+		return sym
+	}
+	ext, ok := x.c.ExternalFuncs[key]
+	if !ok {
+		return nil
+	}
+	sym := &lsifSymbol{resultSet: x.w.vertex("resultSet", nil), refs: make(map[int][]int)}
+	moniker := x.w.vertex("moniker", map[string]any{"scheme": "gomod", "identifier": key, "unique": "scheme", "kind": "import"})
+	x.w.edge("moniker", sym.resultSet, moniker)
+	if ext.Module != "" {
+		x.w.edge("packageInformation", moniker, x.module(ext.Module, ext.Version))
+	}
+	x.symbols[key] = sym
+	x.order = append(x.order, key)
+	return sym
+}
+
+// module returns the packageInformation vertex of a module.
+func (x *lsifIndex) module(path, version string) int {
+	if id, ok := x.modules[path]; ok {
+		return id
+	}
+	if m := x.c.Modules[path]; m != nil && version == "" {
+		version = m.Version
+	}
+	id := x.w.vertex("packageInformation", map[string]any{"name": path, "manager": "gomod", "version": version})
+	x.modules[path] = id
+	return id
+}
+
+// callRange returns the document and range of the callee's name in a call
+// site, which may follow a receiver or package on a later line.
+func (x *lsifIndex) callRange(site CallSite, name string) (int, int, bool) {
+	doc := x.document(site.File)
+	if doc == nil || site.Line < 1 {
+		return 0, 0, false
+	}
+	i := identifierIndex(site.Expr, name, true)
+	if i < 0 {
+		return 0, 0, false
+	}
+	line, col := site.Line, site.Column-1+i
+	if nl := strings.LastIndexByte(site.Expr[:i], '\n'); nl >= 0 {
+		line += strings.Count(site.Expr[:i], "\n")
+		col = i - nl - 1
+	}
+	if line > len(doc.lines) || col+len(name) > len(doc.lines[line-1]) {
+		return 0, 0, false
+	}
+	return doc.id, x.rangeAt(doc, line, doc.lines[line-1], col, len(name)), true
+}
+
+// rangeAt returns the range of n bytes at byte column col of line, which
+// reads text, creating it the first time.
+func (x *lsifIndex) rangeAt(doc *lsifDocument, line int, text string, col, n int) int {
+	start := len(utf16.Encode([]rune(text[:col])))
+	key := [2]int{line, start}
+	if r, ok := doc.ranges[key]; ok {
+		return r
+	}
+	end := start + len(utf16.Encode([]rune(text[col:col+n])))
+	r := x.w.vertex("range", map[string]any{
+		"start": map[string]int{"line": line - 1, "character": start},
+		"end":   map[string]int{"line": line - 1, "character": end},
+	})
+	doc.ranges[key] = r
+	doc.order = append(doc.order, r)
+	return r
+}
+
+// document returns the document of file, relative to the project root,
+// reading its lines the first time; nil if it cannot be read.
+func (x *lsifIndex) document(file string) *lsifDocument {
+	if file == "" {
+		return nil
+	}
+	if doc, ok := x.docs[file]; ok {
+		return doc
+	}
+	path := file
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(x.dir, filepath.FromSlash(file))
+	}
+	data, ok := x.c.Overlay[path]
+	if !ok {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			x.docs[file] = nil
+			return nil
+		}
+	}
+	doc := &lsifDocument{
+		id:     x.w.vertex("document", map[string]any{"uri": fileURI(path), "languageId": "go"}),
+		lines:  strings.Split(string(data), "\n"),
+		ranges: make(map[[2]int]int),
+	}
+	x.docs[file] = doc
+	x.docIDs = append(x.docIDs, doc.id)
+	return doc
+}
+
+// identifierIndex returns the byte index of the first whole-word
+// occurrence of name in text, followed by ( or [ if call is set; -1 if
+// there is none.
+func identifierIndex(text, name string, call bool) int {
+	for from := 0; ; {
+		i := strings.Index(text[from:], name)
+		if i < 0 {
+			return -1
+		}
+		i += from
+		end := i + len(name)
+		before := i == 0 || !isIdentByte(text[i-1])
+		after := end == len(text) || !isIdentByte(text[end])
+		if call {
+			rest := strings.TrimLeft(text[end:], " \t")
+			after = strings.HasPrefix(rest, "(") || strings.HasPrefix(rest, "[")
+		}
+		if before && after {
+			return i
+		}
+		from = end
+	}
+}
+
+func isIdentByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= 0x80
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys[K cmp.Ordered, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// fileURI returns the file:// URI of an absolute path.
+func fileURI(path string) string {
+	return "file://" + filepath.ToSlash(path)
+}
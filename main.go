@@ -1,33 +1,517 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
 	"strings"
+	"syscall"
+	"time"
 
 	"golang.org/x/tools/go/packages"
 )
 
+// loadMode is what the analysis needs of the loaded packages.
+const loadMode = packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles |
+	packages.NeedImports | packages.NeedDeps | packages.NeedTypes |
+	packages.NeedSyntax | packages.NeedTypesInfo | packages.NeedTypesSizes |
+	packages.NeedModule
+
 func main() {
+	var mode string // "analyze" or "load" to run only that half of a load
+	if len(os.Args) > 1 {
+		switch cmd := os.Args[1]; cmd {
+		case "doctor", "init":
+			if err := runDoctor(cmd, os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "impact":
+			if err := runImpact(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "apidiff":
+			if err := runAPIDiff(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "affected-tests":
+			if err := runAffectedTests(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "query":
+			if err := runQuery(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "export":
+			if err := runExport(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "import":
+			if err := runImport(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "serve":
+			if err := runServe(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "report":
+			if err := runReport(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "runtime-calls":
+			if err := runRuntimeCalls(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "clean":
+			if err := runClean(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "orphans":
+			if err := runOrphans(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "validate":
+			if err := runValidate(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "analyze", "load":
+			// The analysis and the load run as usual, in two processes
+			// passing the analysis in a file.
+			mode = cmd
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+		}
+	}
+
 	var (
-		neo4jURI  = flag.String("neo4j-uri", "bolt://localhost:7687", "Neo4j bolt URI")
-		neo4jUser = flag.String("neo4j-user", "neo4j", "Neo4j username")
-		neo4jPass = flag.String("neo4j-pass", "", "Neo4j password")
-		clean     = flag.Bool("clean", false, "Clean existing accurate graph data before loading")
-		dir       = flag.String("dir", ".", "Project root directory")
+		config      = flag.String("config", "", "Config file of name = value flag settings (see the init command)")
+		neo4jURI    = flag.String("neo4j-uri", "bolt://localhost:7687", "Neo4j URI: bolt:// for one server, neo4j:// to route in a cluster")
+		neo4jUser   = flag.String("neo4j-user", "neo4j", "Neo4j username")
+		neo4jPass   = flag.String("neo4j-pass", "", "Neo4j password")
+		clean       = flag.Bool("clean", false, "Clean existing accurate graph data before loading")
+		verify      = flag.Bool("verify", false, "Read the graph back after loading and report nodes and sampled calls that did not make it; discrepancies make the exit status 1")
+		softDelete  = flag.Bool("soft-delete", false, "Mark packages, files, functions and types of earlier loads missing from this one deleted: true with deleted_at (without --clean)")
+		progress    = flag.String("progress", "auto", "Progress of long phases: auto (a bar on a terminal, else log lines), bar, log or off")
+		metricsAddr = flag.String("metrics-addr", "", "Serve Prometheus metrics at /metrics on this address (e.g. :9090) while running")
+		metricsFile = flag.String("metrics-file", "", "Write Prometheus metrics to this file at the end of the load, for the node exporter's textfile collector")
+		maxMemory   = flag.String("max-memory", "", "Keep the heap under this size (e.g. 20GiB), stopping with advice instead of running out of memory")
+		cacheDir    = flag.String("cache-dir", "", "Cache the analysis in this directory, keyed by the source and the flags affecting it, and reuse it while the code is unchanged")
+		cpuProfile  = flag.String("cpuprofile", "", "Write a CPU profile of the run to this file")
+		memProfile  = flag.String("memprofile", "", "Write a heap profile to this file at the end of the run")
+		traceFile   = flag.String("trace", "", "Write an execution trace of the run to this file")
+		resume      = flag.Bool("resume", false, "Resume an interrupted load of the same code with the same flags from its checkpoint instead of starting over")
+		dir         = flag.String("dir", ".", "Project root directory")
+		tags        = flag.String("tags", "", "Comma-separated build tags for package loading")
+		goos        = flag.String("goos", "", "GOOS for package loading (default: the host's)")
+		goarch      = flag.String("goarch", "", "GOARCH for package loading (default: the host's)")
+		matrix      = flag.String("build-matrix", "", "Analyse several build configurations and merge them: goos/goarch[:tag,tag];...")
+		strict      = flag.Bool("strict", false, "Fail on any package load or type-check error instead of loading what could be analysed")
+		overlayArg  = flag.String("overlay", "", "JSON file replacing file contents for analysis, in the go build -overlay format")
+		noDegrees   = flag.Bool("skip-degrees", false, "Skip writing in_degree/out_degree properties on functions")
+		centrality  = flag.Bool("compute-centrality", false, "Write GDS pagerank/betweenness scores onto functions (requires the GDS plugin)")
+		roots       = flag.String("roots", "", "Comma-separated package patterns (cmd/...) or function names; only functions reachable from them are loaded")
+		layerSpec   = flag.String("layers", "", "Top-down layer definitions: name=pattern[,pattern];name=...")
+		layerFile   = flag.String("layers-file", "", "File of top-down layer definitions, one \"name = pattern[, pattern]\" per line")
+		layerRep    = flag.Bool("layer-report", false, "Print the hot paths between --layers")
+		rulesFile   = flag.String("arch-rules", "", "Architecture rules file (\"internal/domain/... must not depend on internal/http/...\"); violations make the exit status 1")
+		modGraph    = flag.Bool("module-graph", false, "Also load the full module graph (go list -m all, go mod graph), not just go.mod requirements")
+		vulnRun     = flag.Bool("govulncheck", false, "Run govulncheck and mark vulnerable symbols (govulncheck must be on PATH)")
+		vulnJSON    = flag.String("govulncheck-json", "", "Ingest a saved `govulncheck -json ./...` output file instead of running govulncheck")
+		deprRep     = flag.Bool("deprecated-report", false, "Print all calls into deprecated functions")
+		ctxRep      = flag.Bool("context-report", false, "Print calls passing context.Background or TODO from functions given a context")
+		recRep      = flag.Bool("recursion-report", false, "Print directly and mutually recursive functions")
+		cycleRep    = flag.Bool("package-cycle-report", false, "Print dependency cycles between project packages, through imports and calls")
+		metricsRep  = flag.Bool("package-metrics-report", false, "Print the coupling, instability, abstractness and distance from the main sequence of project packages")
+		hotspotRep  = flag.Bool("hotspot-report", false, "Print the god functions and packages labelled :Hotspot, highest score first")
+		hotspotMax  = flag.String("hotspot-thresholds", "", "Comma-separated name=value overrides of the :Hotspot thresholds: fan-in, fan-out, statements, complexity, pkg-funcs, pkg-statements, pkg-afferent, pkg-efferent, signals")
+		skipGen     = flag.Bool("skip-generated", false, "Exclude packages, types and functions from files with a \"Code generated ... DO NOT EDIT.\" header")
+		ownersFile  = flag.String("codeowners", "", "CODEOWNERS file to take owners from (default: found in the repository)")
+		gitBlame    = flag.Bool("git-blame", false, "Record the last author and change time of files and functions from git blame")
+		coverFile   = flag.String("coverprofile", "", "Go coverage profile (go test -coverprofile) to set covered_pct on functions from")
+		pprofFile   = flag.String("pprof", "", "pprof profile (e.g. CPU) to weight functions and call edges with")
+		hotPct      = flag.Float64("hot-threshold", 5, "Label functions and edges with at least this percentage of --pprof samples as hot")
+		deadCode    = flag.Bool("dead-code", false, "Report functions unreachable from entry points and label them :Unreachable")
+		entryKinds  = flag.String("entry-points", "main,exported,tests", "Comma-separated dead-code entry point kinds: main, exported, tests")
+		withSource  = flag.Bool("with-source", false, "Store function source text on GoFunc nodes")
+		fullText    = flag.Bool("fulltext-index", false, "Create full-text indexes for substring and fuzzy search of function names and docs and type names")
+		embedURL    = flag.String("embed-url", "", "OpenAI-compatible embeddings endpoint (e.g. http://localhost:11434/v1/embeddings) to store function embeddings from; the API key is read from EMBEDDING_API_KEY")
+		embedModel  = flag.String("embed-model", "text-embedding-3-small", "Embedding model for --embed-url")
+		embedBatch  = flag.Int("embed-batch", 64, "Functions per --embed-url request")
+		sourceMax   = flag.Int("source-max-bytes", 4096, "Truncate stored function source to this many bytes (0 = no limit)")
+		ptrNames    = flag.Bool("pointer-receiver-names", false, "Name pointer-receiver methods pkg.(*T).Method instead of pkg.T.Method")
+		handlers    = flag.String("handler-signatures", defaultHandlerSignatures, "Semicolon-separated signatures of functions to label as handler entry points")
+		mqRules     = flag.String("mq-rules", "", "Semicolon-separated role:system=target#topic rules for message queue calls, added to the built-in ones")
+		mayPanic    = flag.Bool("may-panic", false, "Propagate panics through the call graph: set may_panic on functions and add MAY_PANIC edges")
+		labelSynth  = flag.Bool("label-synthetic", false, "Keep SSA wrappers, thunks and bound methods as GoFunc:Synthetic nodes instead of collapsing calls through them")
+		maxBatch    = flag.Int("batch-max-bytes", defaultMaxBatchBytes, "Maximum estimated size in bytes of a single load batch")
+		strategy    = flag.String("load-strategy", loadUnwind, "How batches are written: unwind (one transaction per batch) or apoc (relationships through apoc.periodic.iterate, when APOC is installed)")
+		apocBatch   = flag.Int("apoc-batch-size", defaultIterateBatchSize, "Rows per transaction of --load-strategy apoc")
+		maxTime     = flag.Duration("max-analysis-time", 0, "Stop call graph analysis after this long and load partial results (0 = unlimited)")
+		bloomFile   = flag.String("bloom-perspective", "", "Write a Neo4j Bloom perspective styling the graph, with search phrases, to this file after loading")
+		lsifFile    = flag.String("lsif", "", "Write an LSIF index of the definitions, references and implementations to this file, for code navigation in Sourcegraph")
+		outputFmt   = flag.String("output", "", "Stream the graph as it is collected in this format (ndjson: one node or relationship per JSON line) to the first argument, a file or - for stdout")
+		grpcAddr    = flag.String("grpc-addr", "", "After the analysis and load, serve the collected graph over gRPC at this address until interrupted")
+		catalogDir  = flag.String("query-catalog", "", "Write the catalog of saved Cypher queries, one .cypher file each for Neo4j Browser favorites, to this directory")
 	)
+	var envOverrides stringList
+	flag.Var(&envOverrides, "env", "KEY=VALUE environment override for package loading (repeatable), e.g. CGO_ENABLED=0")
+	var excludes stringList
+	flag.Var(&excludes, "exclude", "Module-relative package pattern (internal/gen/...) whose function bodies are not analysed, keeping its declarations (repeatable)")
+	graphOpts := addGraphFlags(flag.CommandLine)
+	var artifactPath string
+	switch mode {
+	case "analyze":
+		flag.StringVar(&artifactPath, "out", "", "File to write the analysis to, for load --in, instead of loading it")
+	case "load":
+		flag.StringVar(&artifactPath, "in", "", "File of an analysis written by analyze --out to load")
+	}
+	flag.Usage = func() {
+		switch mode {
+		case "analyze":
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s analyze --out <file> [flags] [packages]\n\nPackages are go package patterns relative to --dir (default ./...). With --output, the first argument is where the graph goes.\n\n", os.Args[0])
+		case "load":
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s load --in <file> --neo4j-pass <password> [flags]\n\nAnalysis flags are ignored: the analysis was done by analyze --out.\n\n", os.Args[0])
+		default:
+			fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [packages]\n\nPackages are go package patterns relative to --dir (default ./...). With --output, the first argument is where the graph goes.\n\n", os.Args[0])
+		}
+		flag.PrintDefaults()
+	}
 	flag.Parse()
+	startedAt := time.Now()
 
-	if *neo4jPass == "" {
+	if *config != "" {
+		if err := applyConfigFile(flag.CommandLine, *config); err != nil {
+			log.Fatal(err)
+		}
+	}
+	patterns := flag.Args()
+	var outputDest string
+	if *outputFmt != "" {
+		if *outputFmt != "ndjson" {
+			log.Fatalf("Invalid --output %q: want ndjson", *outputFmt)
+		}
+		if len(patterns) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: --output needs a file, or - for stdout, as first argument")
+			flag.Usage()
+			os.Exit(1)
+		}
+		outputDest, patterns = patterns[0], patterns[1:]
+	}
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	if mode != "" && artifactPath == "" {
+		fmt.Fprintf(os.Stderr, "Error: %s requires --%s\n", mode, map[string]string{"analyze": "out", "load": "in"}[mode])
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *neo4jPass == "" && (mode == "load" || mode == "" && *rulesFile == "" && *lsifFile == "" && *outputFmt == "" && *grpcAddr == "") {
 		fmt.Fprintln(os.Stderr, "Error: --neo4j-pass is required")
 		flag.Usage()
 		os.Exit(1)
 	}
 
+	names, err := graphOpts.names()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if progressMode, err = parseProgressMode(*progress); err != nil {
+		log.Fatal(err)
+	}
+	if *strategy != loadUnwind && *strategy != loadAPOC {
+		log.Fatalf("Invalid --load-strategy %q: want %s or %s", *strategy, loadUnwind, loadAPOC)
+	}
+	if *maxBatch <= 0 {
+		log.Fatalf("Invalid --batch-max-bytes %d: want a positive size", *maxBatch)
+	}
+	var memoryLimit int64
+	if *maxMemory != "" {
+		if memoryLimit, err = parseByteSize(*maxMemory); err != nil {
+			log.Fatalf("Invalid --max-memory: %v", err)
+		}
+	}
+	profiler, err := StartProfiler(*cpuProfile, *memProfile, *traceFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var metrics *Metrics
+	if *metricsAddr != "" || *metricsFile != "" {
+		metrics = NewMetrics()
+	}
+	if *metricsAddr != "" {
+		if err := metrics.Serve(*metricsAddr); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// An interrupt stops the analysis, or the load once the statement
+	// running completes; a second one quits at once.
+	signalled, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signalled.Done()
+		stop()
+		log.Println("Interrupted: stopping (interrupt again to quit at once)")
+	}()
+	// Going over --max-memory stops them the same way.
+	ctx := signalled
+	if memoryLimit > 0 {
+		ctx = limitMemory(ctx, memoryLimit)
+	}
+
+	// load loads art into Neo4j and reports whether the load was verified,
+	// or not checked.
+	load := func(art *GraphArtifact) bool {
+		collector := art.Collector
+		dead := art.deadFuncs()
+		if *embedURL != "" && art.EmbedTexts == nil {
+			log.Fatal("--embed-url needs an analysis written with --embed-url, which keeps the source to embed")
+		}
+		loader, err := NewNeo4jLoader(ctx, *neo4jURI, *neo4jUser, *neo4jPass)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer loader.Close()
+		loader.MaxBatchBytes = *maxBatch
+		loader.Names = names
+		loader.Project = *graphOpts.project
+		loader.Metrics = metrics
+		if *strategy == loadAPOC {
+			if err := loader.UseAPOCIterate(*apocBatch); err != nil {
+				log.Fatal(err)
+			}
+		}
+		loadedAt := time.Now()
+		endNeo4j := timePhase("neo4j")
+		metrics.SetAnalysis(art.Duration, collector.runCounts())
+		// finishMetrics records how the load ended for --metrics-file.
+		finishMetrics := func(success bool) {
+			metrics.Finish(time.Since(loadedAt), success)
+			if *metricsFile != "" {
+				if err := metrics.WriteFile(*metricsFile); err != nil {
+					log.Printf("Warning: %v", err)
+				}
+			}
+		}
+
+		runFlags := art.Flags
+		if mode == "load" {
+			runFlags = append(slices.Clone(runFlags), setFlags(flag.CommandLine)...)
+		}
+		fingerprint := loadFingerprint(art.Module, runFlags, art.GitSHA, art.GitDirty, collector.runCounts())
+		cpPath := checkpointPath(art.Dir, *graphOpts.project)
+		var checkpoint *Checkpoint
+		if *resume {
+			if checkpoint, err = ReadCheckpoint(cpPath); err != nil {
+				log.Fatal(err)
+			}
+			switch {
+			case checkpoint == nil:
+				log.Println("No checkpoint to resume from, loading from the start")
+			case checkpoint.Fingerprint != fingerprint:
+				log.Fatalf("Checkpoint %s is of a load of other code or with other flags; run without --resume to start over", cpPath)
+			default:
+				log.Printf("Resuming the load from its checkpoint: %s", checkpoint)
+			}
+		}
+		if checkpoint == nil {
+			checkpoint = NewCheckpoint(cpPath, fingerprint, loadedAt)
+		}
+		loader.Checkpoint = checkpoint
+		step := func(name string, run func() error) {
+			if err := loader.RunStep(name, false, run); err != nil {
+				finishMetrics(false)
+				fatalLoad(ctx, err)
+			}
+		}
+
+		if *clean {
+			step("clean", loader.CleanGraph)
+		}
+
+		step("indexes", loader.CreateIndexes)
+		step("ids", loader.MigrateIDs)
+		if *fullText {
+			step("fulltext_indexes", loader.CreateFullTextIndexes)
+		}
+		// A time-boxed analysis falls back to the static call graph when
+		// VTA does not finish.
+		algorithm := "vta"
+		if collector.Static {
+			algorithm = "static"
+		}
+		step("analysis", func() error {
+			return loader.LoadAnalysis(art.Module, algorithm, collector.Partial, collector.Coverage, art.Configs, art.Patterns)
+		})
+		step("packages", func() error { return loader.LoadPackages(collector.Packages) })
+		step("files", func() error { return loader.LoadFiles(collector.Files) })
+		step("structs", func() error { return loader.LoadStructs(collector.Structs) })
+		step("interfaces", func() error { return loader.LoadInterfaces(collector.Interfaces) })
+		step("named_types", func() error { return loader.LoadNamedTypes(collector.NamedTypes) })
+		step("aliases", func() error { return loader.LoadAliases(collector.Aliases) })
+		step("funcs", func() error { return loader.LoadFuncs(collector.Funcs) })
+		step("external_funcs", func() error { return loader.LoadExternalFuncs(collector.ExternalFuncs) })
+		step("calls", func() error { return loader.LoadCalls(collector.Calls) })
+		step("modules", func() error { return loader.LoadModules(collector.Modules, collector.Requires) })
+		if art.Vulnerabilities {
+			step("vulns", func() error { return loader.LoadVulns(collector.Vulns) })
+		}
+		step("implements", func() error { return loader.LoadImplements(collector.Implements) })
+		step("init_graph", func() error { return loader.LoadInitGraph(collector.Packages, collector.InitCalls()) })
+		step("entry_points", func() error { return loader.LabelEntryPoints(collector.Funcs) })
+		step("endpoints", func() error { return loader.LoadEndpoints(art.Module, collector.Endpoints) })
+		step("grpc_services", func() error { return loader.LoadGRPCServices(collector.GRPCServices) })
+		step("queries", func() error { return loader.LoadQueries(collector.Queries) })
+		step("topics", func() error { return loader.LoadTopics(collector.Topics) })
+		step("config_reads", func() error { return loader.LoadConfigReads(collector.ConfigReads) })
+		step("wiring", func() error { return loader.LoadWiring(collector.Wiring) })
+		step("panics", func() error { return loader.LoadPanics(collector.Funcs, collector.Calls, collector.MayPanic) })
+		step("layers", func() error {
+			return loader.LoadLayers(collector.Packages, art.Layers, collector.LayerDependencies(art.Layers))
+		})
+		step("sync_uses", func() error { return loader.LoadSyncUses(collector.SyncUses) })
+		step("error_flows", func() error { return loader.LoadErrorFlows(collector.ErrorFlows) })
+		step("func_values", func() error { return loader.LoadFuncValues(collector.FuncValues) })
+		step("service_calls", func() error { return loader.LoadServiceCalls(art.Module, collector.Outbound) })
+		step("link_services", loader.LinkServices)
+		if collector.Profile != nil {
+			step("profile", func() error { return loader.LoadProfile(collector.Profile, *hotPct) })
+		}
+		if art.DeadCode {
+			step("unreachable", func() error { return loader.MarkUnreachable(dead) })
+		}
+		if *softDelete && !*clean {
+			if collector.Partial {
+				log.Println("Warning: analysis is partial, not marking removed nodes")
+			} else {
+				step("removed", func() error { return loader.MarkRemoved(art.Module, collector.LiveNodes(), checkpoint.LoadedAt) })
+			}
+		}
+		if !*noDegrees {
+			step("degrees", loader.ComputeDegrees)
+		}
+		if *centrality {
+			step("centrality", loader.ComputeCentrality)
+		}
+
+		if *embedURL != "" {
+			client := &EmbeddingClient{
+				URL: *embedURL, Model: *embedModel, APIKey: os.Getenv("EMBEDDING_API_KEY"),
+				BatchSize: max(*embedBatch, 1), HTTP: &http.Client{Timeout: 2 * time.Minute},
+			}
+			// The functions embedded depend on the embeddings stored, so an
+			// interrupted embedding step starts over.
+			err := loader.RunStep("embeddings", true, func() error {
+				known, err := loader.EmbeddingHashes()
+				if err != nil {
+					return err
+				}
+				log.Printf("Computing embeddings with %s...", *embedModel)
+				embeddings, err := client.EmbedFuncs(ctx, art.EmbedTexts, known)
+				if err != nil {
+					return err
+				}
+				log.Printf("Embedded %d functions (%d unchanged)", len(embeddings), len(art.EmbedTexts)-len(embeddings))
+				return loader.LoadEmbeddings(embeddings)
+			})
+			if err != nil {
+				finishMetrics(false)
+				fatalLoad(ctx, err)
+			}
+		}
+		run := &AnalysisRun{
+			ID: newRunID(), Module: art.Module, Version: toolVersion(), Algorithm: algorithm,
+			GitSHA: art.GitSHA, GitDirty: art.GitDirty, Flags: runFlags, Patterns: art.Patterns, StartedAt: art.StartedAt,
+			AnalysisDuration: art.Duration, LoadDuration: time.Since(loadedAt),
+			Counts: collector.runCounts(),
+		}
+		step("analysis_run", func() error { return loader.LoadAnalysisRun(run, collector.Packages) })
+		endNeo4j()
+		if err := checkpoint.Remove(); err != nil {
+			log.Printf("Warning: cannot remove checkpoint: %v", err)
+		}
+		finishMetrics(true)
+		log.Printf("Recorded analysis %s", run)
+
+		var discrepancies []Discrepancy
+		if *verify {
+			discrepancies, err = VerifyLoad(loader, collector)
+			if err != nil {
+				log.Fatal(err)
+			}
+			logDiscrepancies(discrepancies)
+		}
+		if *catalogDir != "" {
+			if err := WriteQueryCatalog(*catalogDir, names, *graphOpts.project); err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("Query catalog written to %s", *catalogDir)
+		}
+		if *bloomFile != "" {
+			if err := WriteBloomPerspective(*bloomFile, art.Module, names, *graphOpts.project); err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("Bloom perspective written to %s", *bloomFile)
+		}
+
+		log.Println("Done! Graph loaded into Neo4j.")
+		log.Println("")
+		log.Println("Useful Cypher queries (all of them with --query-catalog):")
+		for _, q := range queryCatalog {
+			if q.Hint {
+				log.Println("  // " + q.Name)
+				if q.Params != "" {
+					log.Println("  " + q.Params)
+				}
+				log.Println("  " + strings.ReplaceAll(projectCypher(names.Rewrite(q.Cypher), *graphOpts.project), "\n", " "))
+				log.Println("")
+			}
+		}
+		return len(discrepancies) == 0
+	}
+
+	// finish logs the time per phase, writes the profiles and exits with
+	// status 1 if the run found problems.
+	finish := func(ok bool) {
+		log.Printf("Time per phase: %s (total %s)", phaseTimes, time.Since(startedAt).Round(time.Millisecond))
+		profiler.Stop()
+		if !ok {
+			os.Exit(1)
+		}
+	}
+
+	if mode == "load" {
+		art, err := ReadGraphArtifact(artifactPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Loading the analysis of %s from %s, analysed %s", art.Module, artifactPath, art.StartedAt.Format(time.RFC3339))
+		finish(load(art))
+		return
+	}
+
 	// Resolve absolute path and module name.
 	absDir, err := filepath.Abs(*dir)
 	if err != nil {
@@ -39,96 +523,482 @@ func main() {
 	if err != nil {
 		log.Fatalf("Cannot detect Go module: %v", err)
 	}
+
+	var kinds []string
+	if *deadCode {
+		kinds, err = parseEntryKinds(*entryKinds)
+		if err != nil {
+			log.Fatalf("Invalid --entry-points: %v", err)
+		}
+	}
+	configs, err := parseBuildConfigs(*matrix, *goos, *goarch, *tags)
+	if err != nil {
+		log.Fatalf("Invalid build configuration: %v", err)
+	}
+	layers, err := parseLayers(*layerSpec)
+	if err != nil {
+		log.Fatalf("Invalid --layers: %v", err)
+	}
+	if *layerFile != "" {
+		if len(layers) > 0 {
+			log.Fatal("--layers cannot be combined with --layers-file")
+		}
+		if layers, err = parseLayersFile(*layerFile); err != nil {
+			log.Fatalf("Invalid --layers-file: %v", err)
+		}
+	}
+	// Directives are only read by the analysis, so it is the one case
+	// left to check after it.
+	if *layerRep && len(layers) == 0 && !hasLayerDirectives(absDir) {
+		log.Fatal("--layer-report requires --layers, --layers-file or //callgraph:layer directives")
+	}
+	var rules []ArchRule
+	if *rulesFile != "" {
+		if rules, err = parseArchRules(*rulesFile); err != nil {
+			log.Fatalf("Invalid --arch-rules: %v", err)
+		}
+	}
+	topicRules, err := parseMQRules(defaultMQRules + ";" + *mqRules)
+	if err != nil {
+		log.Fatalf("Invalid --mq-rules: %v", err)
+	}
+	thresholds, err := parseHotspotThresholds(*hotspotMax)
+	if err != nil {
+		log.Fatalf("Invalid --hotspot-thresholds: %v", err)
+	}
 	log.Printf("Module: %s", modulePath)
 	log.Printf("Dir: %s", absDir)
+	log.Printf("Packages: %s", strings.Join(patterns, " "))
+
+	for _, kv := range envOverrides {
+		if k, _, ok := strings.Cut(kv, "="); !ok || k == "" {
+			log.Fatalf("Invalid --env %q: want KEY=VALUE", kv)
+		}
+	}
 
-	// Load packages.
-	log.Println("Loading packages (this may take a minute)...")
-	cfg := &packages.Config{
-		Mode: packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles |
-			packages.NeedImports | packages.NeedDeps | packages.NeedTypes |
-			packages.NeedSyntax | packages.NeedTypesInfo | packages.NeedTypesSizes,
-		Dir: absDir,
+	var overlay map[string][]byte
+	if *overlayArg != "" {
+		overlay, err = loadOverlay(*overlayArg, absDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Overlay: %d files", len(overlay))
 	}
-	pkgs, err := packages.Load(cfg, "./...")
-	if err != nil {
-		log.Fatalf("Failed to load packages: %v", err)
+
+	// With --output, the graph is written as it is collected. The reports
+	// go to stderr while it takes stdout.
+	var stream *ndjsonStream
+	closeOutput := func() error { return nil }
+	reports := io.Writer(os.Stdout)
+	if outputDest != "" {
+		out := os.Stdout
+		if outputDest == "-" {
+			reports = os.Stderr
+		} else {
+			if out, err = os.Create(outputDest); err != nil {
+				log.Fatal(err)
+			}
+			closeOutput = out.Close
+		}
+		stream = newNDJSONStream(out)
 	}
-	if n := packages.PrintErrors(pkgs); n > 0 {
-		log.Printf("Warning: %d package errors (continuing anyway)", n)
+
+	// newCollector returns a collector with the analysis options.
+	newCollector := func() *Collector {
+		collector := NewCollector(modulePath)
+		collector.WithSource = *withSource || *embedURL != "" // embeddings cover the body
+		collector.SourceMaxBytes = *sourceMax
+		collector.PointerReceivers = *ptrNames
+		collector.LabelSynthetic = *labelSynth
+		collector.MayPanic = *mayPanic
+		collector.HandlerSignatures = parseHandlerSignatures(*handlers)
+		collector.MQRules = topicRules
+		collector.Overlay = overlay
+		collector.Exclude = excludes
+		if stream != nil {
+			collector.Stream = stream
+		}
+		return collector
 	}
-	log.Printf("Loaded %d packages", len(pkgs))
 
-	// Collect data.
-	collector := NewCollector(modulePath)
+	// configEnv returns the environment overrides of the go commands run
+	// under one build configuration.
+	configEnv := func(bc BuildConfig) []string {
+		return append(slices.Clone(envOverrides), bc.Env()...)
+	}
 
-	log.Println("Collecting types (structs, interfaces, functions)...")
-	collector.CollectTypes(pkgs)
+	// analyze loads the packages under one build configuration and collects
+	// types, the call graph and interface implementations.
+	analyze := func(bc BuildConfig) *Collector {
+		// Each configuration gets the whole time box.
+		var deadline time.Time
+		if *maxTime > 0 {
+			deadline = time.Now().Add(*maxTime)
+		}
+		log.Println("Loading packages (this may take a minute)...")
+		cfg := &packages.Config{
+			Context:    ctx,
+			Mode:       loadMode,
+			Dir:        absDir,
+			BuildFlags: bc.BuildFlags(),
+			// Test functions are dead-code entry points, so load test variants.
+			Tests: hasEntryKind(kinds, entryTests),
+			// Later entries win, so overrides take precedence over the
+			// process env, and --goos/--goarch over both.
+			Env:     append(os.Environ(), configEnv(bc)...),
+			Overlay: overlay,
+		}
+		// The files parsed are the only measure of how far loading got.
+		parsing := startProgress("Loading packages", 0, "files parsed")
+		cfg.ParseFile = func(fset *token.FileSet, filename string, src []byte) (*ast.File, error) {
+			parsing.Add(1)
+			return parser.ParseFile(fset, filename, src, parser.AllErrors|parser.ParseComments)
+		}
+		endLoad := timePhase("load")
+		pkgs, err := packages.Load(cfg, patterns...)
+		parsing.Finish()
+		endLoad()
+		exitIfInterrupted(ctx)
+		if err != nil {
+			log.Fatalf("Failed to load packages: %v", err)
+		}
+		if n := packages.PrintErrors(pkgs); n > 0 {
+			if *strict {
+				log.Fatalf("%d package errors (--strict)", n)
+			}
+			log.Printf("Warning: %d package errors (continuing anyway; see analysis_errors on GoPackage nodes)", n)
+		}
+		log.Printf("Loaded %d packages", len(pkgs))
 
-	log.Println("Building SSA and call graph (VTA)...")
-	collector.CollectCallGraph(pkgs)
+		collector := newCollector()
+		collector.Deadline = deadline
+		collector.Context = ctx
 
-	log.Println("Checking interface implementations...")
-	collector.CollectImplementsFromPackages(pkgs)
+		log.Println("Collecting types (structs, interfaces, functions)...")
+		endTypes := timePhase("types")
+		collector.CollectTypes(pkgs)
+		collector.CollectDeprecations(pkgs)
+		endTypes()
 
-	// Stats.
-	log.Printf("Collected: %d packages, %d structs, %d interfaces, %d functions, %d calls, %d implements",
-		len(collector.Packages), len(collector.Structs), len(collector.Interfaces),
-		len(collector.Funcs), len(collector.Calls), len(collector.Implements))
+		log.Println("Building SSA and call graph (VTA)...")
+		if err := collector.CollectCallGraph(pkgs); err != nil {
+			log.Fatal(err)
+		}
+		exitIfInterrupted(ctx)
+		if collector.Static {
+			log.Println("Warning: VTA did not finish in time, using the static call graph (direct calls only)")
+		}
+		if collector.Partial {
+			log.Printf("Warning: analysis time exceeded, call graph is partial (coverage %.1f%%)", collector.Coverage*100)
+		}
 
-	// Load into Neo4j.
-	ctx := context.Background()
-	loader, err := NewNeo4jLoader(ctx, *neo4jURI, *neo4jUser, *neo4jPass)
-	if err != nil {
-		log.Fatal(err)
+		log.Println("Checking interface implementations...")
+		endImplements := timePhase("implements")
+		collector.CollectImplementsFromPackages(pkgs)
+		endImplements()
+		return collector
 	}
-	defer loader.Close()
 
-	if *clean {
-		if err := loader.CleanGraph(); err != nil {
+	var cacheKey string
+	var collector *Collector
+	if *cacheDir != "" {
+		proto := newCollector()
+		inputs := AnalysisInputs{
+			Module: modulePath, Patterns: patterns, Env: envOverrides, Tests: hasEntryKind(kinds, entryTests),
+			Overlay: overlay, WithSource: proto.WithSource, SourceMaxBytes: proto.SourceMaxBytes,
+			PointerReceivers: proto.PointerReceivers, LabelSynthetic: proto.LabelSynthetic, MayPanic: proto.MayPanic,
+			HandlerSignatures: proto.HandlerSignatures, MQRules: proto.MQRules, Exclude: proto.Exclude,
+		}
+		for _, bc := range configs {
+			inputs.Configs = append(inputs.Configs, bc.String())
+		}
+		if cacheKey, err = analysisCacheKey(absDir, inputs); err != nil {
 			log.Fatal(err)
 		}
+		if ok, err := ReadAnalysisCache(*cacheDir, cacheKey, proto); err != nil {
+			log.Printf("Warning: %v; analysing again", err)
+		} else if ok {
+			log.Printf("Analysis of unchanged code read from %s", *cacheDir)
+			collector = proto
+			if stream != nil {
+				WriteGraph(stream, collector) // nothing is collected to stream
+			}
+		}
+	}
+	if collector == nil {
+		if len(configs) == 1 {
+			collector = analyze(configs[0])
+		} else {
+			collectors := make([]*Collector, len(configs))
+			for i, bc := range configs {
+				log.Printf("Build configuration %s (%d/%d)", bc, i+1, len(configs))
+				collectors[i] = analyze(bc)
+			}
+			collector = MergeBuildConfigs(configs, collectors)
+			collector.Stream = collectors[0].Stream
+		}
+		// A time-boxed analysis that stopped early is not the analysis of
+		// the code, so it is not cached.
+		if cacheKey != "" && !collector.Partial {
+			if err := WriteAnalysisCache(*cacheDir, cacheKey, collector); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+		}
 	}
+	collector.CollectInitOrder()
+	entries := collector.MarkEntryPoints()
+	log.Printf("Entry points: %d main, %d init, %d TestMain, %d handlers",
+		entries[entryPointMain], entries[entryPointInit], entries[entryPointTestMain], entries[entryPointHandler])
 
-	if err := loader.CreateIndexes(); err != nil {
+	log.Println("Reading module requirements...")
+	// Module selection does not depend on the platform or tags, so the
+	// first configuration stands for all of them.
+	if err := collector.CollectModules(absDir, *modGraph, configEnv(configs[0])); err != nil {
 		log.Fatal(err)
 	}
-	if err := loader.LoadPackages(collector.Packages); err != nil {
-		log.Fatal(err)
+
+	if *vulnRun || *vulnJSON != "" {
+		log.Println("Collecting govulncheck findings...")
+		if *vulnJSON != "" {
+			data, err := os.ReadFile(*vulnJSON)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := collector.CollectVulns(bytes.NewReader(data)); err != nil {
+				log.Fatal(err)
+			}
+		} else {
+			// Reachable symbols differ between configurations, so
+			// govulncheck runs under each.
+			for _, bc := range configs {
+				data, err := runGovulncheck(absDir, configEnv(bc), bc.BuildFlags())
+				if err != nil {
+					log.Fatal(err)
+				}
+				if err := collector.CollectVulns(bytes.NewReader(data)); err != nil {
+					log.Fatal(err)
+				}
+			}
+		}
+		WriteVulnReport(reports, collector.Vulns)
 	}
-	if err := loader.LoadStructs(collector.Structs); err != nil {
-		log.Fatal(err)
+
+	log.Printf("Generated functions: %d", collector.MarkGenerated())
+	if *skipGen {
+		collector.SkipGenerated()
+		log.Printf("Skipped generated code, %d functions left", len(collector.Funcs))
 	}
-	if err := loader.LoadInterfaces(collector.Interfaces); err != nil {
+
+	if path, err := collector.CollectOwners(absDir, *ownersFile); err != nil {
 		log.Fatal(err)
+	} else if path != "" {
+		log.Printf("Owners from %s", path)
 	}
-	if err := loader.LoadFuncs(collector.Funcs); err != nil {
-		log.Fatal(err)
+	if *coverFile != "" {
+		n, err := collector.CollectCoverage(*coverFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Coverage for %d functions", n)
 	}
-	if err := loader.LoadCalls(collector.Calls); err != nil {
-		log.Fatal(err)
+	if *pprofFile != "" {
+		if err := collector.CollectProfile(*pprofFile); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Profile samples for %d functions (%d %s total)", len(collector.Profile.Cum), collector.Profile.Total, collector.Profile.Unit)
 	}
-	if err := loader.LoadImplements(collector.Implements); err != nil {
-		log.Fatal(err)
+	if *gitBlame {
+		log.Println("Running git blame...")
+		skipped, err := collector.CollectBlame(absDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if skipped > 0 {
+			log.Printf("Warning: git blame skipped %d files (untracked or outside the repository)", skipped)
+		}
+	}
+
+	if *roots != "" {
+		rootFuncs, err := collector.ResolveRoots(strings.Split(*roots, ","))
+		if err != nil {
+			log.Fatalf("Invalid --roots: %v", err)
+		}
+		collector.PruneToRoots(rootFuncs)
+		log.Printf("Pruned to %d functions reachable from %d roots", len(collector.Funcs), len(rootFuncs))
+	}
+
+	log.Println("Marking production-reachable functions...")
+	log.Printf("Production-reachable functions: %d", collector.MarkProdReachable())
+
+	cycles := collector.MarkPackageCycles()
+	log.Printf("Package dependency cycles: %d", len(cycles))
+	if *cycleRep {
+		collector.WritePackageCycleReport(reports, cycles)
+	}
+	pkgMetrics := collector.ComputePackageMetrics()
+	if *metricsRep {
+		WritePackageMetricsReport(reports, pkgMetrics)
+	}
+	godFuncs, godPkgs := collector.MarkHotspots(thresholds)
+	log.Printf("God functions: %d, god packages: %d", len(godFuncs), len(godPkgs))
+	if *hotspotRep {
+		WriteHotspotReport(reports, godFuncs, godPkgs)
+	}
+	sccs := collector.MarkRecursion()
+	log.Printf("Recursive function groups: %d", len(sccs))
+	if *recRep {
+		WriteRecursionReport(reports, sccs)
+	}
+	if *deprRep {
+		collector.WriteDeprecatedReport(reports, collector.DeprecatedCalls())
+	}
+	if *ctxRep {
+		collector.WriteContextReport(reports, collector.DetachedContextCalls())
 	}
 
-	log.Println("Done! Graph loaded into Neo4j.")
-	log.Println("")
-	log.Println("Useful Cypher queries:")
-	log.Println("  // All packages")
-	log.Println("  MATCH (p:GoPackage) RETURN p.name, p.import_path ORDER BY p.import_path")
-	log.Println("")
-	log.Println("  // Functions with most outgoing calls")
-	log.Println("  MATCH (f:GoFunc)-[r:ACCURATE_CALLS]->(target) RETURN f.full_name, count(target) as calls ORDER BY calls DESC LIMIT 20")
-	log.Println("")
-	log.Println("  // Who calls a specific function (with type-accurate resolution)")
-	log.Println("  MATCH (caller:GoFunc)-[:ACCURATE_CALLS]->(f:GoFunc {name: 'CreateOrder'}) RETURN caller.full_name, f.full_name")
-	log.Println("")
-	log.Println("  // Structs implementing an interface")
-	log.Println("  MATCH (s:GoStruct)-[:IMPLEMENTS]->(i:GoInterface) RETURN s.name, i.name")
-	log.Println("")
-	log.Println("  // Dynamic (interface) calls")
-	log.Println("  MATCH (f:GoFunc)-[r:ACCURATE_CALLS {is_dynamic: true}]->(target) RETURN f.full_name, target.full_name, r.site")
+	layers = collector.AssignLayers(layers)
+	if *layerRep && len(layers) == 0 {
+		log.Fatal("--layer-report requires --layers, --layers-file or //callgraph:layer directives")
+	}
+	if *layerRep {
+		transitions, chains := collector.LayerHotPaths(layers)
+		WriteLayerReport(reports, transitions, chains, 20)
+	}
+
+	var dead []*FuncNode
+	if *deadCode {
+		log.Println("Finding dead code...")
+		dead = collector.FindDeadCode(kinds)
+		WriteDeadCodeReport(reports, dead, len(collector.Funcs))
+	}
+
+	var violations []ArchViolation
+	if *rulesFile != "" {
+		log.Printf("Checking %d architecture rules...", len(rules))
+		violations = collector.CheckArchRules(rules)
+		WriteArchReport(reports, *rulesFile, violations)
+	}
+
+	if *lsifFile != "" {
+		f, err := os.Create(*lsifFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = WriteLSIF(f, collector, absDir)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("LSIF index written to %s", *lsifFile)
+	}
+
+	if stream != nil {
+		err := stream.Close()
+		if cerr := closeOutput(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if outputDest != "-" {
+			log.Printf("Graph written to %s", outputDest)
+		}
+	}
+
+	// Stats.
+	log.Printf("Collected: %d packages, %d files, %d structs, %d interfaces, %d named types, %d aliases, %d functions, %d calls, %d implements",
+		len(collector.Packages), len(collector.Files), len(collector.Structs), len(collector.Interfaces), len(collector.NamedTypes), len(collector.Aliases),
+		len(collector.Funcs), len(collector.Calls), len(collector.Implements))
+
+	// Embeddings are computed from the source even without --with-source,
+	// which only decides whether it is stored.
+	var embedTexts map[string]string
+	if *embedURL != "" {
+		embedTexts = make(map[string]string)
+		for name, fn := range collector.Funcs {
+			if fn.File != "" && fn.Synthetic == "" {
+				embedTexts[name] = embeddingText(fn)
+			}
+			if !*withSource {
+				fn.Source, fn.SourceTruncated = "", false
+			}
+		}
+	}
+
+	art := &GraphArtifact{
+		Dir: absDir, Module: modulePath, Patterns: patterns, Flags: setFlags(flag.CommandLine),
+		StartedAt: startedAt, Duration: time.Since(startedAt),
+		Collector: collector, Layers: layers,
+		Vulnerabilities: *vulnRun || *vulnJSON != "", DeadCode: *deadCode, EmbedTexts: embedTexts,
+	}
+	art.GitSHA, art.GitDirty = gitState(absDir)
+	for _, bc := range configs {
+		art.Configs = append(art.Configs, bc.String())
+	}
+	for _, fn := range dead {
+		art.Dead = append(art.Dead, fn.FullName)
+	}
+
+	if mode == "analyze" {
+		if err := WriteGraphArtifact(artifactPath, art); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Analysis written to %s; load it with load --in", artifactPath)
+		finish(len(violations) == 0)
+		return
+	}
+	// Without a password, nothing is loaded: only the architecture rules
+	// are checked, the LSIF index and JSON lines written and the graph
+	// served.
+	verified := true
+	if *neo4jPass != "" {
+		verified = load(art)
+	}
+	if *grpcAddr != "" {
+		if err := ServeGraphGRPC(ctx, *grpcAddr, collector); err != nil {
+			log.Fatal(err)
+		}
+	}
+	finish(len(violations) == 0 && verified)
+}
+
+// exitIfInterrupted exits if ctx was cancelled by an interrupt or
+// --max-memory during the analysis, before anything was loaded.
+func exitIfInterrupted(ctx context.Context) {
+	if ctx.Err() != nil {
+		log.Fatalf("%s during the analysis; nothing was loaded", stopReason(ctx))
+	}
+}
+
+// fatalLoad exits after a load step failed with err, telling how to finish
+// an interrupted load.
+func fatalLoad(ctx context.Context, err error) {
+	if errors.Is(err, context.Canceled) {
+		log.Fatalf("%s; the checkpoint records what was loaded, run again with --resume to finish", stopReason(ctx))
+	}
+	log.Fatal(err)
+}
+
+// stopReason tells why ctx was cancelled: an interrupt, or going over
+// --max-memory, which limitMemory logged with advice.
+func stopReason(ctx context.Context) string {
+	var memErr *memoryLimitError
+	if errors.As(context.Cause(ctx), &memErr) {
+		return "Stopped over --max-memory"
+	}
+	return "Interrupted"
+}
+
+// stringList is a flag.Value collecting every occurrence of a repeatable flag.
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
 }
 
 // detectModulePath reads the go.mod file in dir and returns the module path.
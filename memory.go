@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// byteUnits are the size suffixes parseByteSize accepts, longest first.
+var byteUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"TiB", 1 << 40}, {"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10},
+	{"TB", 1e12}, {"GB", 1e9}, {"MB", 1e6}, {"KB", 1e3},
+	{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10},
+	{"B", 1},
+}
+
+// parseByteSize parses a size such as 20GiB, 512MB, 16G or 1073741824.
+func parseByteSize(s string) (int64, error) {
+	number, unit := strings.TrimSpace(s), int64(1)
+	for _, u := range byteUnits {
+		if n, ok := strings.CutSuffix(number, u.suffix); ok {
+			number, unit = strings.TrimSpace(n), u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q: want a positive number of bytes, optionally with a unit such as MiB or GB", s)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// formatBytes formats n bytes in GiB or MiB.
+func formatBytes(n uint64) string {
+	if n >= 1<<30 {
+		return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30))
+	}
+	return fmt.Sprintf("%.0f MiB", float64(n)/(1<<20))
+}
+
+// memoryCheckInterval is how often limitMemory checks the live heap.
+const memoryCheckInterval = time.Second
+
+// memoryLimitError is the cause of the cancellation of the analysis or
+// load by limitMemory.
+type memoryLimitError struct {
+	live, limit uint64
+}
+
+func (e *memoryLimitError) Error() string {
+	return fmt.Sprintf("live heap of %s over --max-memory %s: analyse fewer packages with narrower patterns, or raise the limit",
+		formatBytes(e.live), formatBytes(e.limit))
+}
+
+// limitMemory makes the garbage collector keep the heap under limit bytes,
+// and returns a context of ctx cancelled with a *memoryLimitError when the
+// heap live after a collection still exceeds it, before the system runs
+// out of memory and kills the process without a word. The analysis then
+// stops and the load stops after its running statement, as on an
+// interrupt.
+func limitMemory(ctx context.Context, limit int64) context.Context {
+	debug.SetMemoryLimit(limit)
+	ctx, cancel := context.WithCancelCause(ctx)
+	sample := []metrics.Sample{{Name: "/gc/heap/live:bytes"}}
+	go func() {
+		ticker := time.NewTicker(memoryCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			metrics.Read(sample)
+			if sample[0].Value.Kind() != metrics.KindUint64 {
+				return // not supported by this Go version
+			}
+			if live := sample[0].Value.Uint64(); live > uint64(limit) {
+				err := &memoryLimitError{live: live, limit: uint64(limit)}
+				log.Printf("Stopping: %v", err)
+				cancel(err)
+				return
+			}
+		}
+	}()
+	return ctx
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// lookupPackage implements callGraphReader on the analysed project.
+func (c *Collector) lookupPackage(pkg string) ([]string, error) {
+	var names []string
+	for name, fn := range c.Funcs {
+		if fn.Package == pkg || strings.HasSuffix(fn.Package, "/"+pkg) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// lookupPackage implements callGraphReader.
+func (r *neo4jReader) lookupPackage(pkg string) ([]string, error) {
+	recs, err := r.read(`MATCH (f:GoFunc)
+		 WHERE NOT f:External AND f.deleted IS NULL AND (f.package = $pkg OR f.package ENDS WITH '/' + $pkg)
+		 RETURN f.full_name AS name ORDER BY name`,
+		map[string]any{"pkg": pkg})
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(recs))
+	for _, rec := range recs {
+		name, _, _ := neo4j.GetRecordValue[string](rec, "name")
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// resolveFocus returns the functions focus names in g: those of a function
+// symbol as resolveSymbol takes it or, failing that, of a package.
+func resolveFocus(g callGraphReader, focus string) ([]string, error) {
+	names, err := g.lookup(focus)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) > 0 {
+		return resolveSymbol(g, focus)
+	}
+	names, err = g.lookupPackage(focus)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no function or package matches %q", focus)
+	}
+	return names, nil
+}
+
+// funcPackage returns the import path of the package of the function
+// fullName: the part before the first dot after the last slash, ignoring
+// type arguments.
+func funcPackage(fullName string) string {
+	name := fullName
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		name = name[:i]
+	}
+	slash := strings.LastIndexByte(name, '/')
+	dot := strings.IndexByte(name[slash+1:], '.')
+	if dot < 0 {
+		return ""
+	}
+	return name[:slash+1+dot]
+}
+
+// Neighborhood returns the functions within depth calls of focus, through
+// the calls they make if callees is set and those made to them if callers
+// is, and the calls found between them. Calls to dependencies are only
+// followed if external is set. No more than maxFuncs functions are kept;
+// the last result reports that some were left out.
+func Neighborhood(g callGraphReader, focus []string, depth int, callers, callees, external bool, maxFuncs int) ([]string, []callHop, bool, error) {
+	included := make(map[string]bool)
+	for _, f := range focus {
+		included[f] = true
+	}
+	var calls []callHop
+	seenCall := make(map[[2]string]bool)
+	truncated := false
+	for _, reverse := range []bool{false, true} {
+		if reverse && !callers || !reverse && !callees {
+			continue
+		}
+		visited := make(map[string]bool)
+		level := focus
+		for _, f := range focus {
+			visited[f] = true
+		}
+		for d := 0; d < depth && len(level) > 0; d++ {
+			edges, err := g.expand(level, reverse)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			var next []string
+			for _, name := range level {
+				for _, e := range edges[name] {
+					if e.External && !external {
+						continue
+					}
+					if !included[e.Func] {
+						if len(included) >= maxFuncs {
+							truncated = true
+							continue
+						}
+						included[e.Func] = true
+					}
+					if !visited[e.Func] {
+						visited[e.Func] = true
+						next = append(next, e.Func)
+					}
+					hop := callHop{From: name, Edge: e}
+					if reverse {
+						hop.From, hop.Edge.Func = e.Func, name
+					}
+					if key := [2]string{hop.From, hop.Edge.Func}; !seenCall[key] {
+						seenCall[key] = true
+						calls = append(calls, hop)
+					}
+				}
+			}
+			level = next
+		}
+	}
+	funcs := make([]string, 0, len(included))
+	for name := range included {
+		funcs = append(funcs, name)
+	}
+	sort.Strings(funcs)
+	sort.Slice(calls, func(i, j int) bool {
+		if calls[i].From != calls[j].From {
+			return calls[i].From < calls[j].From
+		}
+		return calls[i].Edge.Func < calls[j].Edge.Func
+	})
+	return funcs, calls, truncated, nil
+}
+
+// mermaidLabel quotes s as a Mermaid node or subgraph label.
+func mermaidLabel(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+}
+
+// WriteMermaid prints funcs and calls as a Mermaid flowchart, the functions
+// grouped by package, the focus functions highlighted and dynamic calls
+// dotted.
+func WriteMermaid(w io.Writer, focus, funcs []string, calls []callHop) {
+	ids := make(map[string]string, len(funcs))
+	byPkg := make(map[string][]string)
+	for i, name := range funcs {
+		ids[name] = fmt.Sprintf("f%d", i)
+		byPkg[funcPackage(name)] = append(byPkg[funcPackage(name)], name)
+	}
+	pkgs := make([]string, 0, len(byPkg))
+	for pkg := range byPkg {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+
+	fmt.Fprintln(w, "flowchart LR")
+	for i, pkg := range pkgs {
+		fmt.Fprintf(w, "  subgraph p%d[%s]\n", i, mermaidLabel(pkg))
+		for _, name := range byPkg[pkg] {
+			label := strings.TrimPrefix(name, pkg+".")
+			fmt.Fprintf(w, "    %s[%s]\n", ids[name], mermaidLabel(label))
+		}
+		fmt.Fprintln(w, "  end")
+	}
+	for _, c := range calls {
+		arrow := "-->"
+		if c.Edge.Dynamic {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(w, "  %s %s %s\n", ids[c.From], arrow, ids[c.Edge.Func])
+	}
+	if len(focus) > 0 {
+		fmt.Fprintln(w, "  classDef focus fill:#fff3b0,stroke:#c90,stroke-width:2px")
+		focusIDs := make([]string, len(focus))
+		for i, f := range focus {
+			focusIDs[i] = ids[f]
+		}
+		fmt.Fprintf(w, "  class %s focus\n", strings.Join(focusIDs, ","))
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"unicode/utf8"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// collectSizeMetrics records lines-of-code, statement counts and cyclomatic
+// complexity for the functions declared in pkg and aggregates totals onto
+// its package node. With WithSource it also captures each function's
+// source text. It must run after the package's FuncNodes have been
+// registered.
+func (c *Collector) collectSizeMetrics(pkg *packages.Package) {
+	pkgNode := c.Packages[pkg.PkgPath]
+	for _, file := range pkg.Syntax {
+		tf := pkg.Fset.File(file.Pos())
+		if tf != nil {
+			pkgNode.Files++
+			pkgNode.LOC += tf.LineCount()
+		}
+		var src []byte
+		if c.WithSource && tf != nil {
+			var ok bool
+			if src, ok = c.Overlay[tf.Name()]; !ok {
+				src, _ = os.ReadFile(tf.Name()) // unreadable files just get no snippets
+			}
+		}
+		for _, decl := range file.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok || fd.Body == nil {
+				continue
+			}
+			obj, ok := pkg.TypesInfo.Defs[fd.Name].(*types.Func)
+			if !ok {
+				continue
+			}
+			fn, ok := c.Funcs[c.funcFullName(pkg.PkgPath, obj)]
+			if !ok {
+				continue
+			}
+			start := pkg.Fset.Position(fd.Pos())
+			end := pkg.Fset.Position(fd.End())
+			fn.EndLine = end.Line
+			fn.LOC = end.Line - start.Line + 1
+			fn.Statements = countStatements(fd.Body)
+			fn.Complexity = cyclomaticComplexity(fd.Body)
+			fn.Doc = fd.Doc.Text()
+			pkgNode.Statements += fn.Statements
+			if src != nil {
+				fn.Source, fn.SourceTruncated = snippet(src, start.Offset, end.Offset, c.SourceMaxBytes)
+			}
+		}
+	}
+}
+
+// snippet returns src[start:end], cut at the last line break that keeps it
+// within maxBytes (or at maxBytes if the first line is longer). maxBytes <= 0
+// means no limit.
+func snippet(src []byte, start, end, maxBytes int) (string, bool) {
+	if start < 0 || end > len(src) || start > end {
+		return "", false
+	}
+	text := src[start:end]
+	if maxBytes <= 0 || len(text) <= maxBytes {
+		return string(text), false
+	}
+	cut := maxBytes
+	if i := bytes.LastIndexByte(text[:maxBytes], '\n'); i > 0 {
+		cut = i + 1
+	}
+	for cut > 0 && !utf8.RuneStart(text[cut]) { // don't split a UTF-8 sequence
+		cut--
+	}
+	return string(text[:cut]), true
+}
+
+// funcFullName builds the FuncNode.FullName for a declared function or method.
+func (c *Collector) funcFullName(pkgPath string, fn *types.Func) string {
+	sig := fn.Type().(*types.Signature)
+	if recv := sig.Recv(); recv != nil {
+		if named, ptr := receiverNamed(recv.Type()); named != nil {
+			return c.intern(c.methodFullName(pkgPath, named.Obj().Name(), ptr, fn.Name()))
+		}
+	}
+	return c.intern(pkgPath + "." + fn.Name())
+}
+
+// countStatements counts the statements in body, including nested ones but
+// excluding the block statements that merely group them.
+func countStatements(body *ast.BlockStmt) int {
+	n := 0
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch node.(type) {
+		case nil, *ast.BlockStmt:
+		case ast.Stmt:
+			n++
+		}
+		return true
+	})
+	return n
+}
+
+// cyclomaticComplexity returns 1 plus the number of decision points in
+// body: if, for and range statements, non-default case and select clauses,
+// and && and || operators. Function literals count toward body, as they
+// are part of the function's logic.
+func cyclomaticComplexity(body *ast.BlockStmt) int {
+	n := 1
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt:
+			n++
+		case *ast.CaseClause:
+			if node.List != nil {
+				n++
+			}
+		case *ast.CommClause:
+			if node.Comm != nil {
+				n++
+			}
+		case *ast.BinaryExpr:
+			if node.Op == token.LAND || node.Op == token.LOR {
+				n++
+			}
+		}
+		return true
+	})
+	return n
+}
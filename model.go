@@ -1,10 +1,57 @@
 package main
 
+import "time"
+
 // PackageNode represents a Go package in the call graph.
 type PackageNode struct {
-	ImportPath string
-	Name       string
-	Dir        string
+	ImportPath    string
+	Name          string
+	Dir           string
+	Module        string
+	ProdReachable bool     // contains at least one production-reachable function
+	Generated     bool     // all files carry a "Code generated" header
+	BuildConfigs  []string // build configurations containing it; empty if all do
+	Layer         string
+	Files         int
+	LOC           int // total lines across all files
+	Statements    int // total statements across all function bodies
+
+	Errors []string // load and type-check errors; the package's part of the graph may be incomplete
+
+	LayerDirective string // layer named by a //callgraph:layer directive
+
+	Imports   []string // imported project packages
+	InitOrder int      // position in the package initialization order, from 1
+	InitFuncs int      // number of init() functions
+	CycleID   int      // number of its package dependency cycle; 0 if in none
+
+	// Package metrics, from ComputePackageMetrics.
+	Afferent     int     // project packages depending on it (Ca)
+	Efferent     int     // project packages it depends on (Ce)
+	Instability  float64 // Ce / (Ca + Ce)
+	Abstractness float64 // interfaces / types
+	Distance     float64 // |A + I - 1|, distance from the main sequence
+
+	Hotspot      []string // god package thresholds it exceeds, from MarkHotspots; empty if none
+	HotspotScore float64
+
+	Values []string // exported constants and variables, as "const Name Type = value" or "var Name Type", sorted
+}
+
+// FileNode represents a Go source file.
+type FileNode struct {
+	Path            string // relative to the project root
+	Package         string
+	LOC             int
+	Generated       bool   // carries a "Code generated" header
+	BuildConstraint string // //go:build expression; empty if unconstrained
+	BuildTags       []string
+
+	Owners       []string  // from CODEOWNERS
+	LastAuthor   string    // author of the most recent change, from git blame
+	LastModified time.Time // time of the most recent change, from git blame
+
+	BuildConfigs []string // build configurations including it; empty if all do
 }
 
 // StructNode represents a Go struct type.
@@ -15,16 +62,57 @@ type StructNode struct {
 	Line       int
 	Exported   bool
 	FieldCount int
+	Fields     []string // exported fields as "Name Type", embedded ones as the type, sorted
+	Deprecated string   // text of the "Deprecated:" paragraph; empty if not deprecated
+	Generated  bool     // declared in a file with a "Code generated" header
+
+	BuildConfigs []string // build configurations declaring it; empty if all do
 }
 
 // InterfaceNode represents a Go interface type.
 type InterfaceNode struct {
-	Name     string
-	Package  string
-	File     string
-	Line     int
-	Exported bool
-	Methods  int
+	Name       string
+	Package    string
+	File       string
+	Line       int
+	Exported   bool
+	Methods    int
+	MethodSet  []string // methods as Name(param types) results, sorted
+	Deprecated string   // text of the "Deprecated:" paragraph; empty if not deprecated
+	Generated  bool     // declared in a file with a "Code generated" header
+
+	BuildConfigs []string // build configurations declaring it; empty if all do
+}
+
+// NamedTypeNode represents a named Go type whose underlying type is neither
+// a struct nor an interface, e.g. type IDs []ID or type Status string.
+type NamedTypeNode struct {
+	Name       string
+	Package    string
+	File       string
+	Line       int
+	Exported   bool
+	Kind       string // slice, map, func, string, ...
+	Underlying string
+	Deprecated string // text of the "Deprecated:" paragraph; empty if not deprecated
+	Generated  bool   // declared in a file with a "Code generated" header
+
+	BuildConfigs []string // build configurations declaring it; empty if all do
+}
+
+// AliasNode represents a type alias (type Foo = bar.Baz).
+type AliasNode struct {
+	Name       string
+	Package    string
+	File       string
+	Line       int
+	Exported   bool
+	Target     string // key of the aliased named type; empty for unnamed types
+	TargetType string // aliased type as written, e.g. bar.Baz or []int
+	Deprecated string // text of the "Deprecated:" paragraph; empty if not deprecated
+	Generated  bool   // declared in a file with a "Code generated" header
+
+	BuildConfigs []string // build configurations declaring it; empty if all do
 }
 
 // FuncNode represents a Go function or method.
@@ -37,18 +125,284 @@ type FuncNode struct {
 	Exported bool
 	Receiver string // empty for standalone functions
 	IsMethod bool
+
+	ReceiverPtr bool   // method declared on *Receiver
+	Synthetic   string // SSA wrapper kind (wrapper, thunk, bound, instantiation), only with --label-synthetic
+	EntryPoint  string // entry point kind (main, init, test_main, handler); empty if not one
+
+	Signature    string // e.g. func(ctx context.Context, id string) (*Order, error)
+	APISignature string // Signature without parameter names, as apidiff compares it
+	Deprecated   string // text of the "Deprecated:" paragraph; empty if not deprecated
+	EndLine      int
+	LOC          int // lines from the func keyword to the closing brace
+	Statements   int
+	Complexity   int // cyclomatic complexity, closures included
+
+	Doc             string // doc comment text
+	Source          string // function text, only with --with-source
+	SourceTruncated bool
+
+	CoverStmts int     // statements in the coverage profile; 0 if not covered by it
+	CoveredPct float64 // percentage of CoverStmts executed
+
+	Owners       []string  // owners of the declaring file
+	LastAuthor   string    // author of the most recent change to its lines
+	LastModified time.Time // time of the most recent change to its lines
+
+	ProdReachable bool     // reachable from production entry points
+	Generated     bool     // declared in a file with a "Code generated" header
+	BuildConfigs  []string // build configurations declaring it; empty if all do
+	Unreachable   bool     // not reachable from any dead-code entry point
+
+	Panics   bool // calls panic
+	Recovers bool // defers a function calling recover
+	MayPanic bool // a panic can leave it, only with --may-panic
+
+	ReturnsError bool // a result implements error
+	TakesContext bool // the first parameter is a context.Context
+
+	Recursive bool // calls itself, directly or through other functions
+	SCCID     int  // number of its group of mutually recursive functions; 0 if not recursive
+
+	Hotspot      []string // god function thresholds it exceeds, from MarkHotspots; empty if none
+	HotspotScore float64
 }
 
-// CallEdge represents a call relationship between two functions.
+// ExternalFuncNode is a stub for a function in a dependency module or the
+// standard library.
+type ExternalFuncNode struct {
+	Name     string
+	FullName string
+	Package  string
+	Module   string // module path, "std" for the standard library
+	Version  string // module version from the build list; empty for std
+
+	Deprecated   string
+	ReturnsError bool     // a result implements error
+	TakesContext bool     // the first parameter is a context.Context
+	BuildConfigs []string // build configurations calling it; empty if all do
+}
+
+// CallEdge represents all calls from one function to another.
 type CallEdge struct {
 	CallerFullName string
 	CalleeFullName string
-	IsDynamic      bool // dispatched via interface
-	Site           string
+	IsDynamic      bool       // dispatched via interface at one or more sites
+	Sites          []CallSite // sorted by position
+	Count          int        // number of call sites
+	External       bool       // callee is an ExternalFuncNode
+	MayPanic       bool       // a panic can leave the callee, only with --may-panic
+	BuildConfigs   []string   // build configurations with this call; empty if all do
+
+	// DetachedContext lists the sites passing context.Background or
+	// context.TODO although the caller has a context to pass on.
+	DetachedContext []CallSite
+}
+
+// CallSite is the position and source text of one call expression.
+// Columns are 1-based byte offsets, as in go/token; the end is the position
+// just after the closing parenthesis.
+type CallSite struct {
+	File      string
+	Line      int
+	Column    int
+	EndLine   int // zero if the call expression was not found
+	EndColumn int
+	Expr      string // source text, truncated to maxCallExprBytes
 }
 
-// ImplementsEdge represents a struct implementing an interface.
+// ImplementsEdge represents a struct or named type implementing an interface.
 type ImplementsEdge struct {
-	Struct    string // full name of struct
+	Struct    string // full name of struct or named type
 	Interface string // full name of interface
+	Receiver  string // "value" if T satisfies the interface, "pointer" if only *T does
+
+	// Methods lists the interface's method names; MethodFuncs holds the
+	// FullName of the concrete method satisfying each one (possibly promoted
+	// from an embedded field).
+	Methods     []string
+	MethodFuncs []string
+
+	BuildConfigs []string // build configurations where it holds; empty if all do
+}
+
+// ModuleNode represents a Go module: the analysed main module or one of its
+// dependencies.
+type ModuleNode struct {
+	Path      string
+	Version   string // selected version; empty for the main module
+	Main      bool
+	Indirect  bool   // only required indirectly by the main module
+	Replace   string // replacement path[@version], if replaced
+	GoVersion string // go directive, main module only
+	Sum       string // h1: hash from go.sum
+}
+
+// RequireEdge represents a requirement of one module on another.
+type RequireEdge struct {
+	From     string // module path
+	To       string // module path
+	Version  string // required (minimum) version
+	Indirect bool
+}
+
+// HTTPEndpoint is a route registered with an HTTP router.
+type HTTPEndpoint struct {
+	Method    string // upper case; empty if the route accepts any method
+	Path      string
+	Framework string // net/http, chi, gin, echo or gorilla
+	Handler   string // full name of the handling function; empty if not resolved
+	Registrar string // full name of the function registering the route
+	Site      CallSite
+
+	BuildConfigs []string // build configurations registering it; empty if all do
+}
+
+// GRPCService is a gRPC service, found from the service descriptor that
+// protoc-gen-go-grpc generates for it.
+type GRPCService struct {
+	Name      string // fully qualified proto name: orders.v1.OrderService
+	Package   string // Go package declaring the descriptor
+	Interface string // type key of the generated server interface
+	Methods   []GRPCMethod
+
+	// Impls holds the type keys of the types serving the service: those
+	// passed to its registration function or, if the project registers none,
+	// the project types implementing the server interface.
+	Impls      []string
+	Registered bool // Impls come from registrations
+
+	BuildConfigs []string // build configurations declaring it; empty if all do
+}
+
+// GRPCMethod is one RPC of a GRPCService.
+type GRPCMethod struct {
+	Name            string
+	ClientStreaming bool
+	ServerStreaming bool
+	Impls           []string // full name of the implementing method of each service Impl; "" if none
+}
+
+// SQLQuery is a constant SQL statement executed by a project function.
+type SQLQuery struct {
+	Text   string   // statement text without comment lines, white space collapsed
+	Name   string   // query name from a sqlc "-- name: X" comment
+	Kind   string   // lower-case statement keyword: select, insert, update, ...
+	Reads  []string // tables read, lower case, schema-qualified if written so
+	Writes []string // tables written
+
+	Caller string     // full name of the executing function
+	Driver string     // database/sql, sqlx or pgx; empty when called through a project interface
+	Sites  []CallSite // sorted by position
+
+	BuildConfigs []string // build configurations executing it; empty if all do
+}
+
+// TopicUse is a function publishing to or consuming from a message queue
+// topic (a Kafka topic, NATS subject or RabbitMQ exchange or queue).
+type TopicUse struct {
+	Role   string // publish or consume
+	System string // kafka, nats, rabbitmq, ... as named by the matching MQRule
+	Topic  string
+	Func   string     // full name of the function naming the topic
+	Sites  []CallSite // sorted by position
+
+	BuildConfigs []string // build configurations using it; empty if all do
+}
+
+// ConfigRead is a function reading an environment variable or a
+// configuration key, or a struct field tagged with one.
+type ConfigRead struct {
+	Kind   string // env or config
+	Key    string // variable name, or lower-case configuration key
+	Source string // os, viper, koanf, or the struct tag (env, envconfig)
+
+	Func   string     // full name of the reading function; empty for tags
+	Struct string     // type key of the struct with the tagged field
+	Field  string     // name of the tagged field
+	Sites  []CallSite // sorted by position; empty for tags
+
+	BuildConfigs []string // build configurations reading it; empty if all do
+}
+
+// ServiceCall is a function calling another service through a gRPC client
+// or an HTTP request.
+type ServiceCall struct {
+	Protocol string // grpc or http
+	Target   string // gRPC full method name, /pkg.Service/Method; empty for HTTP
+	Method   string // HTTP method, upper case; empty if not known
+	Path     string // HTTP path template, {} standing for parts built at run time
+
+	Func  string     // full name of the calling function
+	Sites []CallSite // sorted by position
+
+	BuildConfigs []string // build configurations making it; empty if all do
+}
+
+// DIEdge is a dependency injection wiring fact: a provider making a type
+// available to the container, or a type the container injects into a
+// consumer.
+type DIEdge struct {
+	Kind      string // provides or injects
+	Framework string // wire, fx or dig
+	Type      string // type key of the provided or injected type
+
+	// The provider or consumer is a function (constructor, fx.Invoke
+	// target), or for wire.Struct, wire.FieldsOf and wire.Bind a type: the
+	// struct built or read, or the implementation bound to an interface.
+	Func   string // full name of the function
+	Struct string // type key of the type, when Func is empty
+
+	Sites []CallSite // registration calls, sorted by position
+
+	BuildConfigs []string // build configurations wiring it; empty if all do
+}
+
+// FuncValueUse is a function used as a value by another function: passed
+// as an argument, stored in a struct field, variable, slice or map, or
+// returned. Callbacks are reached through such uses rather than calls.
+type FuncValueUse struct {
+	Func   string // full name of the function used as a value
+	Holder string // full name of the function using it
+	Kind   string // arg, field, global, element, map or return
+
+	Callee string // full name of the function receiving it, for static calls
+	Param  string // name of the receiving parameter
+	Struct string // type key of the struct whose field stores it
+	Field  string // field name, or pkg.Var for package-level variables
+
+	Sites []CallSite // sorted by position
+
+	BuildConfigs []string // build configurations using it; empty if all do
+}
+
+// SyncUse is a sync.Mutex, RWMutex, WaitGroup or Once held in a struct
+// field or package-level variable, either declared or used by a function
+// calling one of its methods.
+type SyncUse struct {
+	Kind    string // Mutex, RWMutex, WaitGroup or Once
+	Var     string // struct type key or package path, a dot, and the field or variable name
+	Package string // package declaring the struct or variable
+	Struct  string // type key of the struct with the field; empty for variables
+	Field   string // field or variable name
+
+	Guarded []string // fields following a mutex in its group, for declarations
+
+	Func  string     // full name of the calling function; empty for declarations
+	Op    string     // method called: Lock, Unlock, RLock, Wait, Do, ...
+	Sites []CallSite // sorted by position; empty for declarations
+
+	BuildConfigs []string // build configurations with it; empty if all do
+}
+
+// ErrorFlow is what a function does with the error returned by a function
+// it calls: return it, wrap it into an error it returns, or ignore it.
+type ErrorFlow struct {
+	Callee string // full name of the function returning the error
+	Caller string // full name of the calling function
+	Kind   string // returned, wrapped or ignored
+
+	Sites []CallSite // sorted by position
+
+	BuildConfigs []string // build configurations with this flow; empty if all do
 }
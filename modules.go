@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// CollectModules parses go.mod (and go.sum, if present) in dir and records
+// the main module, its requirements and REQUIRES edges from the main
+// module. With moduleGraph it also runs `go list -m all` and `go mod graph`
+// to add the selected versions and the transitive requirement edges.
+func (c *Collector) CollectModules(dir string, moduleGraph bool, env []string) error {
+	data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return fmt.Errorf("cannot read go.mod: %w", err)
+	}
+	mf, err := modfile.Parse("go.mod", data, nil)
+	if err != nil {
+		return fmt.Errorf("cannot parse go.mod: %w", err)
+	}
+	if mf.Module == nil {
+		return fmt.Errorf("module directive not found in go.mod")
+	}
+
+	mainMod := &ModuleNode{Path: mf.Module.Mod.Path, Main: true}
+	if mf.Go != nil {
+		mainMod.GoVersion = mf.Go.Version
+	}
+	c.Modules[mainMod.Path] = mainMod
+
+	replaces := make(map[string]string)
+	for _, r := range mf.Replace {
+		replaces[r.Old.Path] = r.New.String()
+	}
+	for _, r := range mf.Require {
+		c.Modules[r.Mod.Path] = &ModuleNode{
+			Path:     r.Mod.Path,
+			Version:  r.Mod.Version,
+			Indirect: r.Indirect,
+			Replace:  replaces[r.Mod.Path],
+		}
+		c.Requires = append(c.Requires, RequireEdge{
+			From: mainMod.Path, To: r.Mod.Path, Version: r.Mod.Version, Indirect: r.Indirect,
+		})
+	}
+
+	if moduleGraph {
+		if err := c.collectModuleGraph(dir, mainMod.Path, env); err != nil {
+			return err
+		}
+	}
+
+	sums, err := readGoSum(filepath.Join(dir, "go.sum"))
+	if err != nil {
+		return err
+	}
+	for _, m := range c.Modules {
+		m.Sum = sums[m.Path+"@"+m.Version]
+	}
+	c.streamModules()
+	return nil
+}
+
+// collectModuleGraph adds the build list and all requirement edges between
+// selected module versions.
+func (c *Collector) collectModuleGraph(dir, mainPath string, env []string) error {
+	out, err := runGo(dir, env, "list", "-m", "all")
+	if err != nil {
+		return err
+	}
+	selected := map[string]string{mainPath: ""}
+	for _, line := range strings.Split(out, "\n") {
+		// path version [=> replacement [version]]
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] == mainPath {
+			continue
+		}
+		path, version := fields[0], fields[1]
+		selected[path] = version
+		m, ok := c.Modules[path]
+		if !ok {
+			m = &ModuleNode{Path: path, Indirect: true}
+			c.Modules[path] = m
+		}
+		m.Version = version
+		if len(fields) > 3 && fields[2] == "=>" {
+			m.Replace = strings.Join(fields[3:], "@")
+		}
+	}
+
+	out, err = runGo(dir, env, "mod", "graph")
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		from, to, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok {
+			continue
+		}
+		fromPath, fromVersion, _ := strings.Cut(from, "@")
+		toPath, toVersion, _ := strings.Cut(to, "@")
+		// The main module's edges come from go.mod; edges from versions
+		// that lost version selection don't shape the build.
+		if fromPath == mainPath || fromPath == "go" || toPath == "go" || toPath == "toolchain" {
+			continue
+		}
+		if v, ok := selected[fromPath]; !ok || v != fromVersion {
+			continue
+		}
+		c.Requires = append(c.Requires, RequireEdge{From: fromPath, To: toPath, Version: toVersion})
+	}
+	return nil
+}
+
+// runGo runs a go subcommand in dir and returns its standard output.
+func runGo(dir string, env []string, args ...string) (string, error) {
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("go %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// readGoSum returns the module zip hashes in a go.sum file keyed by
+// path@version. A missing file yields no hashes.
+func readGoSum(path string) (map[string]string, error) {
+	sums := make(map[string]string)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return sums, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 3 || strings.HasSuffix(fields[1], "/go.mod") {
+			continue
+		}
+		sums[fields[0]+"@"+fields[1]] = fields[2]
+	}
+	return sums, sc.Err()
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// Roles of a message queue call.
+const (
+	topicPublish = "publish"
+	topicConsume = "consume"
+)
+
+// MQRule matches the calls or struct literals naming a message queue topic.
+type MQRule struct {
+	Role   string // topicPublish or topicConsume
+	System string // kafka, nats, rabbitmq, ...
+
+	// Target is a function or method (pkg.Func, pkg.Type.Method), or a
+	// struct type (pkg.Type) whose literals name the topic.
+	Target string
+
+	// Args are the argument indexes to take the topic from, the first one
+	// holding a non-empty constant winning; none for struct types. Field is
+	// the struct field holding the topic, in the literal passed there or of
+	// the Target type.
+	Args  []int
+	Field string
+}
+
+// defaultMQRules are the built-in rules, which --mq-rules adds to: NATS
+// (core and JetStream), Kafka (sarama, kafka-go, confluent-kafka-go) and
+// RabbitMQ (amqp091-go, streadway/amqp).
+var defaultMQRules = mqRulesFor(
+	[]string{"github.com/nats-io/nats.go"},
+	"publish:nats=%s.Conn.Publish#0", "publish:nats=%s.Conn.Request#0", "publish:nats=%s.Conn.RequestWithContext#1",
+	"publish:nats=%s.JetStream.Publish#0", "publish:nats=%s.JetStream.PublishAsync#0",
+	"consume:nats=%s.Conn.Subscribe#0", "consume:nats=%s.Conn.SubscribeSync#0", "consume:nats=%s.Conn.ChanSubscribe#0",
+	"consume:nats=%s.Conn.QueueSubscribe#0", "consume:nats=%s.Conn.QueueSubscribeSync#0",
+	"consume:nats=%s.JetStream.Subscribe#0", "consume:nats=%s.JetStream.QueueSubscribe#0", "consume:nats=%s.JetStream.PullSubscribe#0",
+) + mqRulesFor(
+	[]string{"github.com/IBM/sarama", "github.com/Shopify/sarama"},
+	"publish:kafka=%s.ProducerMessage#Topic",
+	"consume:kafka=%s.Consumer.ConsumePartition#0", "consume:kafka=%s.ConsumerGroup.Consume#1",
+) + mqRulesFor(
+	[]string{"github.com/segmentio/kafka-go"},
+	"publish:kafka=%s.Writer#Topic", "publish:kafka=%s.Message#Topic", "consume:kafka=%s.ReaderConfig#Topic",
+) + mqRulesFor(
+	[]string{"github.com/confluentinc/confluent-kafka-go/kafka", "github.com/confluentinc/confluent-kafka-go/v2/kafka"},
+	"consume:kafka=%s.Consumer.Subscribe#0", "consume:kafka=%s.Consumer.SubscribeTopics#0",
+) + mqRulesFor(
+	[]string{"github.com/rabbitmq/amqp091-go", "github.com/streadway/amqp"},
+	"publish:rabbitmq=%s.Channel.Publish#0|1", "publish:rabbitmq=%s.Channel.PublishWithContext#1|2",
+	"consume:rabbitmq=%s.Channel.Consume#0", "consume:rabbitmq=%s.Channel.ConsumeWithContext#1",
+)
+
+// mqRulesFor instantiates rule templates for each package path, returning
+// them as a ;-terminated spec.
+func mqRulesFor(pkgPaths []string, templates ...string) string {
+	var s strings.Builder
+	for _, p := range pkgPaths {
+		for _, t := range templates {
+			s.WriteString(fmt.Sprintf(t, p) + ";")
+		}
+	}
+	return s.String()
+}
+
+// parseMQRules parses a --mq-rules spec: semicolon-separated
+// role:system=target#topic rules, where topic is an argument index, several
+// indexes separated by | (the first constant wins), an index followed by
+// .Field for a struct literal argument, or a field name for struct types.
+func parseMQRules(spec string) ([]MQRule, error) {
+	var rules []MQRule
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		invalid := fmt.Errorf("invalid rule %q: want publish|consume:system=target#topic", part)
+		head, rest, ok1 := strings.Cut(part, "=")
+		target, topic, ok2 := strings.Cut(rest, "#")
+		role, system, ok3 := strings.Cut(head, ":")
+		if !ok1 || !ok2 || !ok3 || system == "" || target == "" || topic == "" {
+			return nil, invalid
+		}
+		if role != topicPublish && role != topicConsume {
+			return nil, invalid
+		}
+		r := MQRule{Role: role, System: system, Target: target}
+		if topic[0] < '0' || topic[0] > '9' {
+			r.Field = topic
+		} else {
+			args, field, _ := strings.Cut(topic, ".")
+			r.Field = field
+			for _, a := range strings.Split(args, "|") {
+				i, err := strconv.Atoi(a)
+				if err != nil || i < 0 {
+					return nil, invalid
+				}
+				r.Args = append(r.Args, i)
+			}
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// Key returns the Topic node key, system:topic.
+func (u TopicUse) Key() string {
+	return u.System + ":" + u.Topic
+}
+
+// collectTopics records the message queue topics the project packages
+// among pkgs publish to or consume from, as matched by c.MQRules.
+func (c *Collector) collectTopics(funcs *syntaxFuncs, pkgs []*packages.Package, sites *callSiteIndex) {
+	if len(c.MQRules) == 0 {
+		return
+	}
+	rules := make(map[string][]MQRule)
+	for _, r := range c.MQRules {
+		rules[r.Target] = append(rules[r.Target], r)
+	}
+	index := make(map[string]int) // func|role|topic key -> position in c.Topics
+	add := func(u TopicUse, site CallSite) {
+		key := u.Func + "|" + u.Role + "|" + u.Key()
+		if i, ok := index[key]; ok {
+			c.Topics[i].Sites = append(c.Topics[i].Sites, site)
+			return
+		}
+		u.Sites = []CallSite{site}
+		index[key] = len(c.Topics)
+		c.Topics = append(c.Topics, u)
+	}
+
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if !c.isProjectPackage(pkg.PkgPath) || pkg.TypesInfo == nil {
+			return
+		}
+		info := pkg.TypesInfo
+		for _, file := range pkg.Syntax {
+			var stack []ast.Node
+			ast.Inspect(file, func(n ast.Node) bool {
+				if n == nil {
+					stack = stack[:len(stack)-1]
+					return true
+				}
+				stack = append(stack, n)
+				var matched []MQRule
+				var pos token.Pos
+				var topics func(r MQRule) []string
+				switch n := n.(type) {
+				case *ast.CallExpr:
+					fn, _ := typeutil.Callee(info, n).(*types.Func)
+					if fn == nil {
+						return true
+					}
+					matched, pos = rules[mqTarget(fn)], n.Lparen
+					topics = func(r MQRule) []string {
+						for _, i := range r.Args {
+							if i < len(n.Args) {
+								if t := mqTopics(info, n.Args[i], r.Field); len(t) > 0 {
+									return t
+								}
+							}
+						}
+						return nil
+					}
+				case *ast.CompositeLit:
+					matched, pos = rules[typeKeyOf(info.TypeOf(n))], n.Lbrace
+					topics = func(r MQRule) []string {
+						if r.Args != nil {
+							return nil
+						}
+						return mqTopics(info, n, r.Field)
+					}
+				}
+				for _, r := range matched {
+					for _, topic := range topics(r) {
+						u := TopicUse{Role: r.Role, System: r.System, Topic: topic, Func: funcs.enclosing(pkg, stack)}
+						add(u, sites.site(c, pkg.Fset, pos))
+					}
+				}
+				return true
+			})
+		}
+	})
+	for i := range c.Topics {
+		sortSites(c.Topics[i].Sites)
+	}
+}
+
+// mqTarget returns the name rules use for fn: pkg.Func or pkg.Type.Method,
+// whatever the receiver's pointerness.
+func mqTarget(fn *types.Func) string {
+	if fn.Pkg() == nil {
+		return ""
+	}
+	if recv := fn.Type().(*types.Signature).Recv(); recv != nil {
+		if named, _ := receiverNamed(recv.Type()); named != nil {
+			return fn.Pkg().Path() + "." + named.Obj().Name() + "." + fn.Name()
+		}
+	}
+	return fn.Pkg().Path() + "." + fn.Name()
+}
+
+// mqTopics returns the constant topics of expr: a string, a slice literal
+// of strings, or with field, that field of a struct literal or pointer to
+// one.
+func mqTopics(info *types.Info, expr ast.Expr, field string) []string {
+	expr = ast.Unparen(expr)
+	if u, ok := expr.(*ast.UnaryExpr); ok && u.Op == token.AND {
+		expr = ast.Unparen(u.X)
+	}
+	lit, _ := expr.(*ast.CompositeLit)
+	if field != "" {
+		if lit == nil {
+			return nil
+		}
+		for _, kv := range keyValues(lit) {
+			if kv.key == field {
+				return mqTopics(info, kv.value, "")
+			}
+		}
+		return nil
+	}
+	if lit != nil {
+		if _, ok := info.TypeOf(lit).Underlying().(*types.Slice); ok {
+			return nonEmpty(constStrings(info, lit.Elts))
+		}
+		return nil
+	}
+	if s, ok := constString(info, expr); ok && s != "" {
+		return []string{s}
+	}
+	return nil
+}
+
+// nonEmpty returns the non-empty strings of list.
+func nonEmpty(list []string) []string {
+	var s []string
+	for _, v := range list {
+		if v != "" {
+			s = append(s, v)
+		}
+	}
+	return s
+}
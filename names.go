@@ -0,0 +1,170 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// graphLabels lists the node labels the loader writes.
+var graphLabels = []string{
+	"GoFunc", "GoPackage", "GoStruct", "GoNamedType", "GoInterface", "GoAlias", "GoModule", "GoFile",
+	"GoAnalysis", "External", "Synthetic", "Unreachable", "Vulnerable", "EntryPoint", "Hot", "Hotspot",
+	"UnexportCandidate", "HttpEndpoint", "HttpRequest", "GrpcService", "GrpcMethod", "SqlQuery", "DbTable", "Topic",
+	"EnvVar", "ConfigKey", "SyncVar", "Layer", "AnalysisRun", "ArchiveImport",
+}
+
+// graphRelTypes lists the relationship types the loader writes.
+var graphRelTypes = []string{
+	"ACCURATE_CALLS", "CALLS_EXTERNAL", "RUNTIME_CALLS", "IMPLEMENTS", "SATISFIES", "ALIAS_OF",
+	"HAS_METHOD", "IN_PACKAGE", "CONTAINS", "DEFINED_IN", "REQUIRES", "IN_MODULE", "REACHES_VULN",
+	"INITIALIZES_BEFORE", "INIT_CALLS", "HANDLED_BY", "HAS_RPC", "IMPLEMENTED_BY", "EXECUTES",
+	"READS_TABLE", "WRITES_TABLE", "PUBLISHES_TO", "CONSUMES_FROM", "READS_CONFIG", "SENDS_REQUEST",
+	"CALLS_SERVICE", "PROVIDES", "INJECTS", "PASSES_FUNC", "REGISTERED_AS", "MAY_PANIC",
+	"PROPAGATES_ERROR_TO", "IGNORES_ERROR", "GUARDS", "LOCKS", "IN_LAYER", "LAYER_DEPENDS_ON",
+	"PRODUCED",
+}
+
+// graphIndexes lists the names of the indexes the loader creates.
+var graphIndexes = []string{
+	"go_pkg_path", "go_module_path", "go_file_path", "go_func_fullname", "go_func_id",
+	"go_struct_key", "go_struct_id", "go_iface_key", "go_iface_id", "go_named_key", "go_named_id",
+	"go_alias_key", "go_alias_id", "go_func_text", "go_type_text", "go_func_embedding",
+	"http_endpoint_key", "http_request_key", "grpc_service_name", "grpc_method_name", "sql_query_id",
+	"db_table_name", "topic_key", "env_var_name", "config_key_key", "sync_var_key", "analysis_run_id",
+	"archive_import_ref",
+}
+
+// identifier matches the names usable as labels and relationship types
+// without quoting.
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// GraphNames maps the labels, relationship types and index names of the
+// graph to the ones configured with --rename, --label-prefix and
+// --label-suffix, so that the graph can share a database with other tools
+// using the same names. A nil *GraphNames keeps the default names.
+type GraphNames struct {
+	names   map[string]string // default name -> configured name, for the changed ones
+	pattern *regexp.Regexp    // a changed name in Cypher, after its leading ':', '|', quote or INDEX
+}
+
+// NewGraphNames returns the names given renames of labels and relationship
+// types as Old=New pairs and a prefix and suffix added to the other labels
+// and, lower-cased, to index names. It returns nil if nothing changes.
+func NewGraphNames(renames []string, prefix, suffix string) (*GraphNames, error) {
+	for _, affix := range []string{prefix, suffix} {
+		if affix != "" && !identifier.MatchString(affix) {
+			return nil, fmt.Errorf("invalid label prefix or suffix %q: use letters, digits and underscores", affix)
+		}
+	}
+	known := make(map[string]bool)
+	for _, name := range append(graphLabels, graphRelTypes...) {
+		known[name] = true
+	}
+	names := make(map[string]string)
+	for _, r := range renames {
+		from, to, ok := strings.Cut(r, "=")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("invalid rename %q: want Old=New", r)
+		case !known[from]:
+			return nil, fmt.Errorf("invalid rename %q: %s is not a label or relationship type of the graph", r, from)
+		case !identifier.MatchString(to):
+			return nil, fmt.Errorf("invalid rename %q: use letters, digits and underscores", r)
+		}
+		names[from] = to
+	}
+	for _, label := range graphLabels {
+		if _, ok := names[label]; !ok && (prefix != "" || suffix != "") {
+			names[label] = prefix + label + suffix
+		}
+	}
+	if prefix != "" || suffix != "" {
+		for _, index := range graphIndexes {
+			name := index
+			if prefix != "" {
+				name = strings.ToLower(prefix) + "_" + name
+			}
+			if suffix != "" {
+				name += "_" + strings.ToLower(suffix)
+			}
+			names[index] = name
+		}
+	}
+	for from, to := range names {
+		if from == to {
+			delete(names, from)
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	changed := make([]string, 0, len(names))
+	for name := range names {
+		changed = append(changed, name)
+	}
+	// Longer names first, so that none is matched by a prefix of it.
+	sort.Slice(changed, func(i, j int) bool {
+		if len(changed[i]) != len(changed[j]) {
+			return len(changed[i]) > len(changed[j])
+		}
+		return changed[i] < changed[j]
+	})
+	return &GraphNames{
+		names:   names,
+		pattern: regexp.MustCompile(`([:|']|INDEX )(` + strings.Join(changed, "|") + `)\b`),
+	}, nil
+}
+
+// Name returns the configured name of a label, relationship type or index.
+func (n *GraphNames) Name(name string) string {
+	if n == nil {
+		return name
+	}
+	if to, ok := n.names[name]; ok {
+		return to
+	}
+	return name
+}
+
+// Rewrite returns cypher with the configured names: labels and
+// relationship types after ':' or '|', index names after INDEX, and
+// either of them in quotes, as in gds.graph.project('g', 'GoFunc', ...)
+// and type(r) = 'CALLS_EXTERNAL'.
+func (n *GraphNames) Rewrite(cypher string) string {
+	if n == nil {
+		return cypher
+	}
+	return n.pattern.ReplaceAllStringFunc(cypher, func(m string) string {
+		sub := n.pattern.FindStringSubmatch(m)
+		return sub[1] + n.names[sub[2]]
+	})
+}
+
+// graphFlags holds the flags choosing the graph in the database: its
+// names and its project.
+type graphFlags struct {
+	renames        stringList
+	prefix, suffix *string
+	project        *string
+}
+
+// addGraphFlags registers --rename, --label-prefix, --label-suffix and
+// --project on fs, for commands reading or writing the graph.
+func addGraphFlags(fs *flag.FlagSet) *graphFlags {
+	f := &graphFlags{
+		prefix:  fs.String("label-prefix", "", "Prefix added to every node label not renamed with --rename, and lower-cased to index names"),
+		suffix:  fs.String("label-suffix", "", "Suffix added to every node label not renamed with --rename, and lower-cased to index names"),
+		project: fs.String("project", "", "Project whose graph to read or write in a database shared with other projects; every node and relationship carries it as its project property"),
+	}
+	fs.Var(&f.renames, "rename", "Old=New renaming of a node label or relationship type (repeatable), e.g. GoFunc=Function or ACCURATE_CALLS=CALLS")
+	return f
+}
+
+// names returns the graph names the flags configure.
+func (f *graphFlags) names() (*GraphNames, error) {
+	return NewGraphNames(f.renames, *f.prefix, *f.suffix)
+}
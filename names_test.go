@@ -0,0 +1,107 @@
+package main
+
+import "testing"
+
+func TestGraphNamesRewrite(t *testing.T) {
+	tests := []struct {
+		name           string
+		renames        []string
+		prefix, suffix string
+		in, want       string
+	}{
+		{
+			name:    "label",
+			renames: []string{"GoFunc=Function"},
+			in:      "MATCH (f:GoFunc {id: $id})-[:ACCURATE_CALLS]->(g:GoFunc:External) RETURN g",
+			want:    "MATCH (f:Function {id: $id})-[:ACCURATE_CALLS]->(g:Function:External) RETURN g",
+		},
+		{
+			name:    "label that is a prefix of another",
+			renames: []string{"Hot=Warm"},
+			in:      "MATCH (f:GoFunc:Hot), (g:GoFunc:Hotspot) SET f:Hot REMOVE g:Hot",
+			want:    "MATCH (f:GoFunc:Warm), (g:GoFunc:Hotspot) SET f:Warm REMOVE g:Warm",
+		},
+		{
+			name:    "label that another is a prefix of",
+			renames: []string{"Hotspot=Risky"},
+			in:      "MATCH (f:GoFunc:Hot), (g:GoFunc:Hotspot) RETURN f, g",
+			want:    "MATCH (f:GoFunc:Hot), (g:GoFunc:Risky) RETURN f, g",
+		},
+		{
+			name:    "relationship types in a disjunction and in quotes",
+			renames: []string{"ACCURATE_CALLS=CALLS"},
+			in:      "MATCH (f)-[r:ACCURATE_CALLS|CALLS_EXTERNAL]->(g) WHERE type(r) = 'ACCURATE_CALLS' RETURN g",
+			want:    "MATCH (f)-[r:CALLS|CALLS_EXTERNAL]->(g) WHERE type(r) = 'CALLS' RETURN g",
+		},
+		{
+			name:   "prefix on labels, not on relationship types or properties",
+			prefix: "Acme",
+			in:     "MATCH (f:GoFunc)-[:IN_PACKAGE]->(p:GoPackage) WHERE f.GoFunc IS NULL RETURN p.import_path",
+			want:   "MATCH (f:AcmeGoFunc)-[:IN_PACKAGE]->(p:AcmeGoPackage) WHERE f.GoFunc IS NULL RETURN p.import_path",
+		},
+		{
+			name:   "index name",
+			prefix: "Acme",
+			in:     "CREATE INDEX go_func_id IF NOT EXISTS FOR (f:GoFunc) ON (f.id)",
+			want:   "CREATE INDEX acme_go_func_id IF NOT EXISTS FOR (f:AcmeGoFunc) ON (f.id)",
+		},
+		{
+			name:   "index name with a suffix",
+			prefix: "Acme",
+			suffix: "V2",
+			in:     "CREATE FULLTEXT INDEX go_func_text IF NOT EXISTS FOR (f:GoFunc) ON EACH [f.name]",
+			want:   "CREATE FULLTEXT INDEX acme_go_func_text_v2 IF NOT EXISTS FOR (f:AcmeGoFuncV2) ON EACH [f.name]",
+		},
+		{
+			name:   "index name in quotes",
+			suffix: "V2",
+			in:     "CALL db.index.fulltext.queryNodes('go_func_text', $q)",
+			want:   "CALL db.index.fulltext.queryNodes('go_func_text_v2', $q)",
+		},
+		{
+			name:   "graph projection",
+			prefix: "Acme",
+			in:     "CALL gds.graph.project('calls', 'GoFunc', 'ACCURATE_CALLS')",
+			want:   "CALL gds.graph.project('calls', 'AcmeGoFunc', 'ACCURATE_CALLS')",
+		},
+		{
+			name:   "archive import",
+			prefix: "Acme",
+			in:     "CREATE INDEX archive_import_ref IF NOT EXISTS FOR (n:ArchiveImport) ON (n.archive_ref)",
+			want:   "CREATE INDEX acme_archive_import_ref IF NOT EXISTS FOR (n:AcmeArchiveImport) ON (n.archive_ref)",
+		},
+		{
+			name: "default names",
+			in:   "MATCH (f:GoFunc:Hot) RETURN f",
+			want: "MATCH (f:GoFunc:Hot) RETURN f",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names, err := NewGraphNames(tt.renames, tt.prefix, tt.suffix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := names.Rewrite(tt.in); got != tt.want {
+				t.Errorf("Rewrite(%q)\n got %q\nwant %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewGraphNamesErrors(t *testing.T) {
+	tests := []struct {
+		renames []string
+		prefix  string
+	}{
+		{renames: []string{"GoFunc"}},
+		{renames: []string{"NotALabel=X"}},
+		{renames: []string{"GoFunc=Go Func"}},
+		{prefix: "Acme-"},
+	}
+	for _, tt := range tests {
+		if _, err := NewGraphNames(tt.renames, tt.prefix, ""); err == nil {
+			t.Errorf("NewGraphNames(%q, %q) succeeded", tt.renames, tt.prefix)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+// ndjsonNode and ndjsonRelationship are the lines written by
+// ndjsonStream, told apart by kind.
+type ndjsonNode struct {
+	Kind       string         `json:"kind"` // "node"
+	Key        string         `json:"key"`
+	Labels     []string       `json:"labels"`
+	Properties map[string]any `json:"properties"`
+}
+
+type ndjsonRelationship struct {
+	Kind       string         `json:"kind"` // "relationship"
+	Type       string         `json:"type"`
+	Start      string         `json:"start"`
+	StartLabel string         `json:"start_label"`
+	End        string         `json:"end"`
+	EndLabel   string         `json:"end_label"`
+	Properties map[string]any `json:"properties,omitempty"`
+}
+
+// GraphSink receives the nodes and relationships of the graph as the
+// collector finds them; see Collector.Stream.
+type GraphSink interface {
+	Node(GraphNode)
+	Edge(GraphEdge)
+}
+
+// ndjsonStream is a GraphSink writing each node and relationship to w as
+// a JSON line when it is received, so the graph is never held for the
+// output. Writing stops at the first error, which Close returns.
+type ndjsonStream struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+	err error
+}
+
+func newNDJSONStream(w io.Writer) *ndjsonStream {
+	buf := bufio.NewWriter(w)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	return &ndjsonStream{buf: buf, enc: enc}
+}
+
+func (s *ndjsonStream) Node(n GraphNode) {
+	if s.err == nil {
+		s.err = s.enc.Encode(ndjsonNode{Kind: "node", Key: n.Key, Labels: n.Labels, Properties: n.Props})
+	}
+}
+
+func (s *ndjsonStream) Edge(e GraphEdge) {
+	if s.err == nil {
+		s.err = s.enc.Encode(ndjsonRelationship{Kind: "relationship", Type: e.Type,
+			Start: e.Start, StartLabel: e.StartLabel, End: e.End, EndLabel: e.EndLabel, Properties: e.Props})
+	}
+}
+
+// Close flushes the lines written and returns the first error.
+func (s *ndjsonStream) Close() error {
+	if s.err == nil {
+		s.err = s.buf.Flush()
+	}
+	return s.err
+}
+
+// WriteGraph sends the whole graph of c to sink, for an analysis that was
+// not collected in this run, such as one read from the cache.
+func WriteGraph(sink GraphSink, c *Collector) {
+	c.WalkGraph(
+		func(n GraphNode) error { sink.Node(n); return nil },
+		func(e GraphEdge) error { sink.Edge(e); return nil })
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// overlayFile mirrors the JSON accepted by `go build -overlay` and gopls:
+// Replace maps a file path to the path of the file holding its contents.
+type overlayFile struct {
+	Replace map[string]string
+}
+
+// loadOverlay reads an overlay file and returns the replaced contents keyed
+// by absolute path, as packages.Config.Overlay expects. Relative paths are
+// resolved against dir, the directory packages are loaded from. The go
+// command's empty replacement (the file is deleted) cannot be expressed as
+// a packages overlay and is rejected.
+func loadOverlay(path, dir string) (map[string][]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read overlay: %w", err)
+	}
+	var of overlayFile
+	if err := json.Unmarshal(data, &of); err != nil {
+		return nil, fmt.Errorf("cannot parse overlay %s: %w", path, err)
+	}
+	abs := func(p string) string {
+		if filepath.IsAbs(p) {
+			return filepath.Clean(p)
+		}
+		return filepath.Join(dir, p)
+	}
+
+	overlay := make(map[string][]byte, len(of.Replace))
+	for file, replacement := range of.Replace {
+		if replacement == "" {
+			return nil, fmt.Errorf("overlay %s: deleting %s is not supported", path, file)
+		}
+		contents, err := os.ReadFile(abs(replacement))
+		if err != nil {
+			return nil, fmt.Errorf("overlay %s: %w", path, err)
+		}
+		overlay[abs(file)] = contents
+	}
+	return overlay, nil
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// codeownersLocations are the places GitHub and GitLab look for CODEOWNERS,
+// relative to the repository root, in order of precedence.
+var codeownersLocations = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// codeownersRule is one CODEOWNERS line: a path pattern and its owners.
+type codeownersRule struct {
+	pattern *regexp.Regexp
+	owners  []string
+}
+
+// repoRoot returns the root of the git work tree containing dir, or dir
+// itself if it is not inside one.
+func repoRoot(dir string) string {
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			return d
+		}
+		if filepath.Dir(d) == d {
+			return dir
+		}
+	}
+}
+
+// findCodeowners returns the CODEOWNERS file of the repository rooted at
+// root, or "" if there is none.
+func findCodeowners(root string) string {
+	for _, loc := range codeownersLocations {
+		path := filepath.Join(root, loc)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// parseCodeowners reads the rules of a CODEOWNERS file. Rules without
+// owners are kept: they unassign paths matched by earlier rules.
+func parseCodeowners(path string) ([]codeownersRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open CODEOWNERS: %w", err)
+	}
+	defer f.Close()
+
+	var rules []codeownersRule
+	sc := bufio.NewScanner(f)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		line := strings.TrimSpace(sc.Text())
+		// GitLab sections ([Section]) only group rules.
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "[") || strings.HasPrefix(line, "^[") {
+			continue
+		}
+		fields := strings.Fields(line)
+		var owners []string
+		for _, o := range fields[1:] {
+			if strings.HasPrefix(o, "#") {
+				break
+			}
+			owners = append(owners, o)
+		}
+		re, err := codeownersPattern(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		rules = append(rules, codeownersRule{pattern: re, owners: owners})
+	}
+	return rules, sc.Err()
+}
+
+// codeownersPattern compiles a gitignore-style CODEOWNERS pattern into a
+// regexp matching slash-separated paths relative to the repository root.
+// A pattern is anchored at the root if it starts with or contains a slash;
+// otherwise it matches at any depth. A pattern matching a directory also
+// matches everything below it.
+func codeownersPattern(pattern string) (*regexp.Regexp, error) {
+	dirOnly := strings.HasSuffix(pattern, "/")
+	p := strings.TrimSuffix(pattern, "/")
+	anchored := strings.Contains(p, "/")
+	p = strings.TrimPrefix(p, "/")
+
+	var b strings.Builder
+	b.WriteString("^")
+	if !anchored {
+		b.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(p); i++ {
+		switch {
+		case strings.HasPrefix(p[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(p[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case p[i] == '*':
+			b.WriteString("[^/]*")
+		case p[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(p[i : i+1]))
+		}
+	}
+	if dirOnly {
+		b.WriteString("/.*$")
+	} else {
+		b.WriteString("(?:/.*)?$")
+	}
+	return regexp.Compile(b.String())
+}
+
+// codeowners returns the owners of path; the last matching rule wins.
+func codeowners(rules []codeownersRule, path string) []string {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rules[i].pattern.MatchString(path) {
+			return rules[i].owners
+		}
+	}
+	return nil
+}
+
+// absFile returns the absolute path of a FileNode or FuncNode file, which
+// is relative to the module directory dir when relPath could shorten it.
+func absFile(dir, file string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(dir, file)
+}
+
+// CollectOwners assigns CODEOWNERS owners to files and to the functions
+// declared in them. path overrides the CODEOWNERS file found in the
+// repository containing dir, the module directory. Without a CODEOWNERS
+// file it does nothing and returns "".
+func (c *Collector) CollectOwners(dir, path string) (string, error) {
+	root := repoRoot(dir)
+	if path == "" {
+		if path = findCodeowners(root); path == "" {
+			return "", nil
+		}
+	}
+	rules, err := parseCodeowners(path)
+	if err != nil {
+		return "", err
+	}
+	for _, f := range c.Files {
+		rel, err := filepath.Rel(root, absFile(dir, f.Path))
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue // outside the repository, e.g. generated test mains
+		}
+		f.Owners = codeowners(rules, filepath.ToSlash(rel))
+	}
+	for _, fn := range c.Funcs {
+		if f, ok := c.Files[fn.File]; ok {
+			fn.Owners = f.Owners
+		}
+	}
+	return path, nil
+}
+
+// blameLine is the last change to one line of a file.
+type blameLine struct {
+	author string
+	time   time.Time
+}
+
+// CollectBlame runs git blame on every file and records the author and time
+// of the most recent change to each file and to each function's lines.
+// Files git cannot blame (untracked or outside the repository) are skipped;
+// the number skipped is returned.
+func (c *Collector) CollectBlame(dir string) (int, error) {
+	if _, err := runGit(dir, "rev-parse", "--is-inside-work-tree"); err != nil {
+		return 0, err
+	}
+	byFile := make(map[string][]*FuncNode)
+	for _, fn := range c.Funcs {
+		if fn.File != "" && fn.Line > 0 {
+			byFile[fn.File] = append(byFile[fn.File], fn)
+		}
+	}
+
+	skipped := 0
+	for _, f := range c.Files {
+		lines, err := blameFile(dir, absFile(dir, f.Path))
+		if err != nil {
+			skipped++
+			continue
+		}
+		f.LastAuthor, f.LastModified = lastChange(lines, 1, len(lines))
+		for _, fn := range byFile[f.Path] {
+			end := fn.EndLine
+			if end < fn.Line {
+				end = fn.Line
+			}
+			fn.LastAuthor, fn.LastModified = lastChange(lines, fn.Line, end)
+		}
+	}
+	return skipped, nil
+}
+
+// lastChange returns the author and time of the most recent change among
+// lines from..to (1-based, inclusive).
+func lastChange(lines []blameLine, from, to int) (string, time.Time) {
+	var last blameLine
+	for i := max(from, 1); i <= to && i <= len(lines); i++ {
+		if l := lines[i-1]; l.time.After(last.time) {
+			last = l
+		}
+	}
+	return last.author, last.time
+}
+
+// blameFile runs git blame on file and returns the last change of each line.
+func blameFile(dir, file string) ([]blameLine, error) {
+	out, err := runGit(dir, "blame", "--line-porcelain", "--", file)
+	if err != nil {
+		return nil, err
+	}
+	var lines []blameLine
+	var cur blameLine
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case strings.HasPrefix(line, "\t"):
+			lines = append(lines, cur)
+		case strings.HasPrefix(line, "author "):
+			cur.author = strings.TrimPrefix(line, "author ")
+		case strings.HasPrefix(line, "author-time "):
+			sec, err := strconv.ParseInt(strings.TrimPrefix(line, "author-time "), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("git blame %s: bad author-time: %w", file, err)
+			}
+			cur.time = time.Unix(sec, 0).UTC()
+		}
+	}
+	return lines, nil
+}
+
+// runGit runs a git subcommand in dir and returns its standard output.
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"go/ast"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// panicFacts caches what SSA functions do about panics.
+type panicFacts struct {
+	callsRecover map[*ssa.Function]bool
+}
+
+// panics reports whether fn calls panic directly. Functions of packages
+// whose SSA was not built, dependencies only, are read from their syntax.
+func panics(fn *ssa.Function) bool {
+	if fn.Blocks == nil {
+		decl, ok := fn.Syntax().(*ast.FuncDecl)
+		return ok && decl.Body != nil && callsPanic(decl.Body)
+	}
+	for _, b := range fn.Blocks {
+		for _, instr := range b.Instrs {
+			if _, ok := instr.(*ssa.Panic); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// callsPanic reports whether body calls panic outside of function literals.
+// Type information is not kept for dependencies, so a function named panic
+// shadowing the builtin counts too.
+func callsPanic(body *ast.BlockStmt) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.CallExpr:
+			if id, ok := n.Fun.(*ast.Ident); ok && id.Name == "panic" {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// recovers reports whether fn defers a function calling recover, which
+// stops panics from leaving fn.
+func (pf *panicFacts) recovers(fn *ssa.Function) bool {
+	for _, b := range fn.Blocks {
+		for _, instr := range b.Instrs {
+			if d, ok := instr.(*ssa.Defer); ok {
+				if callee := d.Call.StaticCallee(); callee != nil && pf.recoverCalled(callee) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// recoverCalled reports whether fn calls recover directly, which only has
+// an effect when fn is deferred.
+func (pf *panicFacts) recoverCalled(fn *ssa.Function) bool {
+	if r, ok := pf.callsRecover[fn]; ok {
+		return r
+	}
+	r := false
+	for _, b := range fn.Blocks {
+		for _, instr := range b.Instrs {
+			if call, ok := instr.(*ssa.Call); ok {
+				if bi, ok := call.Call.Value.(*ssa.Builtin); ok && bi.Name() == "recover" {
+					r = true
+				}
+			}
+		}
+	}
+	pf.callsRecover[fn] = r
+	return r
+}
+
+// panicEscapes returns the functions of cg that a panic can leave: those
+// calling panic, or calling such a function other than in a go statement,
+// unless they recover. Only explicit panic calls are considered, not
+// run-time errors such as nil dereferences. What dependency functions
+// call is not followed, as their SSA is not built.
+func panicEscapes(cg *callgraph.Graph) map[*ssa.Function]bool {
+	pf := &panicFacts{callsRecover: make(map[*ssa.Function]bool)}
+	recovers := make(map[*ssa.Function]bool)
+	escapes := make(map[*ssa.Function]bool)
+	var queue []*callgraph.Node
+	for fn, node := range cg.Nodes {
+		if fn == nil {
+			continue
+		}
+		recovers[fn] = pf.recovers(fn)
+		if panics(fn) && !recovers[fn] {
+			escapes[fn] = true
+			queue = append(queue, node)
+		}
+	}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, e := range node.In {
+			caller := e.Caller.Func
+			if _, isGo := e.Site.(*ssa.Go); isGo || escapes[caller] || recovers[caller] {
+				continue
+			}
+			escapes[caller] = true
+			queue = append(queue, e.Caller)
+		}
+	}
+	return escapes
+}
+
+// collectPanics records on the project functions of prog whether they call
+// panic and whether they recover, and with MayPanic whether a panic can
+// leave them.
+func (c *Collector) collectPanics(prog *ssa.Program) {
+	pf := &panicFacts{callsRecover: make(map[*ssa.Function]bool)}
+	for fn := range ssautil.AllFunctions(prog) {
+		if !c.isProjectPackage(c.ssaFuncPkg(fn)) {
+			continue
+		}
+		node, ok := c.Funcs[c.ssaFuncName(fn)]
+		if !ok {
+			continue
+		}
+		node.Panics = node.Panics || panics(fn)
+		node.Recovers = node.Recovers || pf.recovers(fn)
+		node.MayPanic = node.MayPanic || c.escapes[fn]
+	}
+}
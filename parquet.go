@@ -0,0 +1,484 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// parquetRowGroupRows is how many rows a Parquet row group holds at most.
+const parquetRowGroupRows = 100_000
+
+// Parquet physical types, repetitions, converted types and encodings, as
+// numbered by parquet.thrift.
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetOptional = 1
+
+	parquetUTF8            = 0
+	parquetTimestampMicros = 10
+
+	parquetPlain = 0
+	parquetRLE   = 3
+)
+
+// parquetColumn is an optional column of a Parquet dataset: its values by
+// row, nil where the row has none.
+type parquetColumn struct {
+	name   string
+	kind   string // bool, int64, double, string or timestamp
+	values []any
+}
+
+// ExportParquet writes the graph of l to dir as Parquet datasets:
+// nodes/<Label>.parquet per label and relationships/<TYPE>.parquet per
+// relationship type, under their default names. Nodes have an element_id
+// and labels column, relationships start_id, start_label, end_id and
+// end_label, and both a column per property. It returns how many nodes and
+// relationships it wrote.
+func ExportParquet(l *Neo4jLoader, dir string) (nodes, rels int, err error) {
+	version, err := l.ServerVersion()
+	if err != nil {
+		return 0, 0, err
+	}
+	defaults := defaultLabels(l.Names)
+	rowLabels := func(stored []any) []string {
+		var labels []string
+		for _, s := range stored {
+			if label, ok := defaults[fmt.Sprint(s)]; ok {
+				labels = append(labels, label)
+			}
+		}
+		return labels
+	}
+	for _, label := range graphLabels {
+		if slices.Contains(archiveMarkerLabels, label) {
+			continue
+		}
+		var rows []map[string]any
+		err := l.stream("MATCH (n:"+label+") RETURN "+elementID(version, "n")+" AS id, labels(n) AS labels, properties(n) AS props", nil,
+			func(rec *neo4j.Record) error {
+				id, _, _ := neo4j.GetRecordValue[string](rec, "id")
+				stored, _, _ := neo4j.GetRecordValue[[]any](rec, "labels")
+				props, _, _ := neo4j.GetRecordValue[map[string]any](rec, "props")
+				props["element_id"], props["labels"] = id, strings.Join(rowLabels(stored), ":")
+				rows = append(rows, props)
+				return nil
+			})
+		if err != nil {
+			return nodes, rels, fmt.Errorf("cannot export %s nodes: %w", label, err)
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		path := filepath.Join(dir, "nodes", label+".parquet")
+		if err := writeParquet(path, parquetColumns(rows, "element_id", "labels"), len(rows)); err != nil {
+			return nodes, rels, err
+		}
+		nodes += len(rows)
+	}
+	for _, relType := range graphRelTypes {
+		var rows []map[string]any
+		err := l.stream(`MATCH (a)-[r:`+relType+`]->(b)
+			 RETURN `+elementID(version, "a")+` AS start, labels(a) AS startLabels, `+elementID(version, "b")+` AS end, labels(b) AS endLabels, properties(r) AS props`, nil,
+			func(rec *neo4j.Record) error {
+				start, _, _ := neo4j.GetRecordValue[string](rec, "start")
+				end, _, _ := neo4j.GetRecordValue[string](rec, "end")
+				startLabels, _, _ := neo4j.GetRecordValue[[]any](rec, "startLabels")
+				endLabels, _, _ := neo4j.GetRecordValue[[]any](rec, "endLabels")
+				props, _, _ := neo4j.GetRecordValue[map[string]any](rec, "props")
+				props["start_id"], props["start_label"] = start, primaryLabel(rowLabels(startLabels))
+				props["end_id"], props["end_label"] = end, primaryLabel(rowLabels(endLabels))
+				rows = append(rows, props)
+				return nil
+			})
+		if err != nil {
+			return nodes, rels, fmt.Errorf("cannot export %s relationships: %w", relType, err)
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		path := filepath.Join(dir, "relationships", relType+".parquet")
+		if err := writeParquet(path, parquetColumns(rows, "start_id", "start_label", "end_id", "end_label"), len(rows)); err != nil {
+			return nodes, rels, err
+		}
+		rels += len(rows)
+	}
+	return nodes, rels, nil
+}
+
+// primaryLabel returns the first of labels that is not a marker label such
+// as External.
+func primaryLabel(labels []string) string {
+	for _, label := range labels {
+		if !slices.Contains(archiveMarkerLabels, label) {
+			return label
+		}
+	}
+	return ""
+}
+
+// parquetColumns returns the columns of rows: first, then the other keys
+// in sorted order. A column's kind is that of its values; integers mixed
+// with floats make a double column, and any other mix a string column.
+// Lists are written as JSON.
+func parquetColumns(rows []map[string]any, first ...string) []parquetColumn {
+	kinds := make(map[string]string)
+	for _, row := range rows {
+		for k, v := range row {
+			kind := parquetKind(v)
+			switch prev, ok := kinds[k]; {
+			case kind == "" || ok && prev == kind:
+			case !ok:
+				kinds[k] = kind
+			case prev == "int64" && kind == "double" || prev == "double" && kind == "int64":
+				kinds[k] = "double"
+			default:
+				kinds[k] = "string"
+			}
+		}
+	}
+	var rest []string
+	for k := range kinds {
+		if !slices.Contains(first, k) {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	columns := make([]parquetColumn, 0, len(kinds))
+	for _, name := range append(first, rest...) {
+		kind, ok := kinds[name]
+		if !ok {
+			kind = "string"
+		}
+		c := parquetColumn{name: name, kind: kind, values: make([]any, len(rows))}
+		for i, row := range rows {
+			c.values[i] = parquetValue(row[name], kind)
+		}
+		columns = append(columns, c)
+	}
+	return columns
+}
+
+// parquetKind returns the column kind of a property value, or "" for nil.
+func parquetKind(v any) string {
+	switch v.(type) {
+	case nil:
+		return ""
+	case bool:
+		return "bool"
+	case int64:
+		return "int64"
+	case float64:
+		return "double"
+	case time.Time:
+		return "timestamp"
+	}
+	return "string"
+}
+
+// parquetValue converts a property value to a value of a column of kind.
+func parquetValue(v any, kind string) any {
+	if v == nil {
+		return nil
+	}
+	switch kind {
+	case "double":
+		if i, ok := v.(int64); ok {
+			return float64(i)
+		}
+		return v
+	case "string":
+		switch v := v.(type) {
+		case string:
+			return v
+		case time.Time:
+			return v.Format(time.RFC3339Nano)
+		case []any:
+			data, err := json.Marshal(v)
+			if err != nil {
+				return fmt.Sprint(v)
+			}
+			return string(data)
+		}
+		return fmt.Sprint(v)
+	}
+	return v
+}
+
+// writeParquet writes columns of rows rows to path as an uncompressed
+// Parquet file with PLAIN-encoded values, a page per column chunk.
+func writeParquet(path string, columns []parquetColumn, rows int) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("cannot write %s: %w", path, err)
+	}
+	var file bytes.Buffer
+	file.WriteString("PAR1")
+	meta := &thriftCompact{}
+	meta.structBegin()
+	meta.i32(1, 1) // version
+	meta.listBegin(2, thriftStruct, len(columns)+1)
+	meta.structBegin()
+	meta.str(4, "schema")
+	meta.i32(5, int32(len(columns)))
+	meta.structEnd()
+	for _, c := range columns {
+		meta.structBegin()
+		meta.i32(1, c.physicalType())
+		meta.i32(3, parquetOptional)
+		meta.str(4, c.name)
+		switch c.kind {
+		case "string":
+			meta.i32(6, parquetUTF8)
+		case "timestamp":
+			meta.i32(6, parquetTimestampMicros)
+		}
+		meta.structEnd()
+	}
+	meta.i64(3, int64(rows))
+	groups := (rows + parquetRowGroupRows - 1) / parquetRowGroupRows
+	meta.listBegin(4, thriftStruct, groups)
+	for lo := 0; lo < rows; lo += parquetRowGroupRows {
+		hi := min(lo+parquetRowGroupRows, rows)
+		meta.structBegin()
+		meta.listBegin(1, thriftStruct, len(columns))
+		groupStart := file.Len()
+		for _, c := range columns {
+			offset := int64(file.Len())
+			page := c.page(lo, hi)
+			header := &thriftCompact{}
+			header.structBegin()
+			header.i32(1, 0) // DATA_PAGE
+			header.i32(2, int32(len(page)))
+			header.i32(3, int32(len(page)))
+			header.fieldStruct(5)
+			header.i32(1, int32(hi-lo))
+			header.i32(2, parquetPlain)
+			header.i32(3, parquetRLE)
+			header.i32(4, parquetRLE)
+			header.structEnd()
+			header.structEnd()
+			file.Write(header.Bytes())
+			file.Write(page)
+			size := int64(file.Len()) - offset
+
+			meta.structBegin()
+			meta.i64(2, offset)
+			meta.fieldStruct(3)
+			meta.i32(1, c.physicalType())
+			meta.listBegin(2, thriftI32, 2)
+			meta.zigzag(parquetPlain)
+			meta.zigzag(parquetRLE)
+			meta.listBegin(3, thriftBinary, 1)
+			meta.binary(c.name)
+			meta.i32(4, 0) // UNCOMPRESSED
+			meta.i64(5, int64(hi-lo))
+			meta.i64(6, size)
+			meta.i64(7, size)
+			meta.i64(9, offset)
+			meta.structEnd()
+			meta.structEnd()
+		}
+		meta.i64(2, int64(file.Len()-groupStart))
+		meta.i64(3, int64(hi-lo))
+		meta.structEnd()
+	}
+	meta.str(6, "go-callgraph-neo4j "+toolVersion())
+	meta.structEnd()
+	file.Write(meta.Bytes())
+	file.Write(binary.LittleEndian.AppendUint32(nil, uint32(meta.Len())))
+	file.WriteString("PAR1")
+	if err := os.WriteFile(path, file.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("cannot write %s: %w", path, err)
+	}
+	return nil
+}
+
+// physicalType returns the Parquet type storing the column.
+func (c *parquetColumn) physicalType() int32 {
+	switch c.kind {
+	case "bool":
+		return parquetBoolean
+	case "int64", "timestamp":
+		return parquetInt64
+	case "double":
+		return parquetDouble
+	}
+	return parquetByteArray
+}
+
+// page returns the data page of rows lo to hi of the column: definition
+// levels, run-length encoded, then the values present.
+func (c *parquetColumn) page(lo, hi int) []byte {
+	var levels []byte
+	for i := lo; i < hi; {
+		j := i
+		for j < hi && (c.values[j] == nil) == (c.values[i] == nil) {
+			j++
+		}
+		levels = binary.AppendUvarint(levels, uint64(j-i)<<1)
+		if c.values[i] == nil {
+			levels = append(levels, 0)
+		} else {
+			levels = append(levels, 1)
+		}
+		i = j
+	}
+	page := binary.LittleEndian.AppendUint32(nil, uint32(len(levels)))
+	page = append(page, levels...)
+	bit := 0
+	for _, v := range c.values[lo:hi] {
+		switch v := v.(type) {
+		case nil:
+		case bool:
+			if bit%8 == 0 {
+				page = append(page, 0)
+			}
+			if v {
+				page[len(page)-1] |= 1 << (bit % 8)
+			}
+			bit++
+		case int64:
+			page = binary.LittleEndian.AppendUint64(page, uint64(v))
+		case float64:
+			page = binary.LittleEndian.AppendUint64(page, math.Float64bits(v))
+		case time.Time:
+			page = binary.LittleEndian.AppendUint64(page, uint64(v.UnixMicro()))
+		case string:
+			page = binary.LittleEndian.AppendUint32(page, uint32(len(v)))
+			page = append(page, v...)
+		}
+	}
+	return page
+}
+
+// Thrift compact protocol types used by the Parquet metadata.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftCompact encodes Thrift structs in the compact protocol, as
+// Parquet stores its metadata.
+type thriftCompact struct {
+	bytes.Buffer
+	last  int16   // id of the last field written in the current struct
+	outer []int16 // last of the enclosing structs
+}
+
+func (t *thriftCompact) uvarint(v uint64) {
+	t.Write(binary.AppendUvarint(nil, v))
+}
+
+func (t *thriftCompact) zigzag(v int64) {
+	t.uvarint(uint64(v<<1 ^ v>>63))
+}
+
+func (t *thriftCompact) field(id int16, typ byte) {
+	if d := id - t.last; d > 0 && d <= 15 {
+		t.WriteByte(byte(d)<<4 | typ)
+	} else {
+		t.WriteByte(typ)
+		t.zigzag(int64(id))
+	}
+	t.last = id
+}
+
+func (t *thriftCompact) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.zigzag(int64(v))
+}
+
+func (t *thriftCompact) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.zigzag(v)
+}
+
+func (t *thriftCompact) str(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.binary(s)
+}
+
+// binary writes a string without a field header, as a list element.
+func (t *thriftCompact) binary(s string) {
+	t.uvarint(uint64(len(s)))
+	t.WriteString(s)
+}
+
+// listBegin starts a list field of n elements of type elem.
+func (t *thriftCompact) listBegin(id int16, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.WriteByte(byte(n)<<4 | elem)
+	} else {
+		t.WriteByte(0xf0 | elem)
+		t.uvarint(uint64(n))
+	}
+}
+
+// structBegin starts a struct without a field header: the outermost one,
+// or an element of a list.
+func (t *thriftCompact) structBegin() {
+	t.outer = append(t.outer, t.last)
+	t.last = 0
+}
+
+// fieldStruct starts a struct field.
+func (t *thriftCompact) fieldStruct(id int16) {
+	t.field(id, thriftStruct)
+	t.structBegin()
+}
+
+func (t *thriftCompact) structEnd() {
+	t.WriteByte(0)
+	t.last, t.outer = t.outer[len(t.outer)-1], t.outer[:len(t.outer)-1]
+}
+
+// runExportParquet implements export parquet.
+func runExportParquet(args []string) error {
+	cmd := flag.NewFlagSet("export parquet", flag.ExitOnError)
+	neo4jURI := cmd.String("neo4j-uri", "bolt://localhost:7687", "Neo4j URI: bolt:// for one server, neo4j:// to route in a cluster")
+	neo4jUser := cmd.String("neo4j-user", "neo4j", "Neo4j username")
+	neo4jPass := cmd.String("neo4j-pass", "", "Neo4j password")
+	out := cmd.String("out", "", "Directory to write the nodes and relationships datasets to")
+	graphOpts := addGraphFlags(cmd)
+	cmd.Usage = func() {
+		fmt.Fprintln(cmd.Output(), "Usage: go-callgraph-neo4j export parquet --out <dir> --neo4j-pass <password> [flags]")
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+	if *neo4jPass == "" || *out == "" || cmd.NArg() > 0 {
+		cmd.Usage()
+		os.Exit(1)
+	}
+	loader, err := openLoader(*neo4jURI, *neo4jUser, *neo4jPass, graphOpts)
+	if err != nil {
+		return err
+	}
+	defer loader.Close()
+	nodes, rels, err := ExportParquet(loader, *out)
+	if err != nil {
+		return err
+	}
+	log.Printf("Exported %d nodes and %d relationships to %s", nodes, rels, *out)
+	return nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// thriftReader decodes Thrift compact structs into maps by field id, the
+// reverse of thriftCompact.
+type thriftReader struct {
+	b   []byte
+	pos int
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b[r.pos:])
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+	u := r.uvarint()
+	return int64(u>>1) ^ -int64(u&1)
+}
+
+func (r *thriftReader) value(typ byte) any {
+	switch typ {
+	case thriftI32, thriftI64:
+		return r.zigzag()
+	case thriftBinary:
+		n := int(r.uvarint())
+		s := string(r.b[r.pos : r.pos+n])
+		r.pos += n
+		return s
+	case thriftList:
+		h := r.b[r.pos]
+		r.pos++
+		n := int(h >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := make([]any, n)
+		for i := range list {
+			list[i] = r.value(h & 0x0f)
+		}
+		return list
+	case thriftStruct:
+		return r.structure()
+	}
+	panic(fmt.Sprintf("unexpected thrift type %d", typ))
+}
+
+func (r *thriftReader) structure() map[int16]any {
+	fields := make(map[int16]any)
+	var last int16
+	for {
+		h := r.b[r.pos]
+		r.pos++
+		if h == 0 {
+			return fields
+		}
+		id := last + int16(h>>4)
+		if h>>4 == 0 {
+			id = int16(r.zigzag())
+		}
+		fields[id] = r.value(h & 0x0f)
+		last = id
+	}
+}
+
+// readParquet reads the columns of a file written by writeParquet, with
+// nil for absent values and timestamps as time.Time.
+func readParquet(t *testing.T, path string) (names []string, columns [][]any) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("PAR1")) || !bytes.HasSuffix(data, []byte("PAR1")) {
+		t.Fatalf("%s: missing PAR1 magic", path)
+	}
+	metaLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	meta := (&thriftReader{b: data[len(data)-8-metaLen : len(data)-8]}).structure()
+	schema := meta[2].([]any)
+	timestamp := make([]bool, len(schema)-1)
+	for i, el := range schema[1:] {
+		el := el.(map[int16]any)
+		names = append(names, el[4].(string))
+		timestamp[i] = el[6] == int64(parquetTimestampMicros)
+	}
+	columns = make([][]any, len(names))
+	for _, rg := range meta[4].([]any) {
+		for i, cc := range rg.(map[int16]any)[1].([]any) {
+			md := cc.(map[int16]any)[3].(map[int16]any)
+			offset, n := int(md[9].(int64)), int(md[5].(int64))
+			hr := &thriftReader{b: data[offset:]}
+			header := hr.structure()
+			page := data[offset+hr.pos : offset+hr.pos+int(header[3].(int64))]
+			columns[i] = append(columns[i], decodePage(t, page, md[1].(int64), timestamp[i], n)...)
+		}
+	}
+	if rows := int(meta[3].(int64)); len(names) > 0 && len(columns[0]) != rows {
+		t.Fatalf("%s: %d rows read, metadata says %d", path, len(columns[0]), rows)
+	}
+	return names, columns
+}
+
+// decodePage decodes n values of a PLAIN data page of physical type typ.
+func decodePage(t *testing.T, page []byte, typ int64, timestamp bool, n int) []any {
+	t.Helper()
+	levelsLen := int(binary.LittleEndian.Uint32(page))
+	lr := &thriftReader{b: page[4 : 4+levelsLen]}
+	var present []bool
+	for lr.pos < len(lr.b) {
+		h := lr.uvarint()
+		if h&1 != 0 {
+			t.Fatal("bit-packed definition levels")
+		}
+		level := lr.b[lr.pos]
+		lr.pos++
+		for range h >> 1 {
+			present = append(present, level == 1)
+		}
+	}
+	if len(present) != n {
+		t.Fatalf("%d definition levels, want %d", len(present), n)
+	}
+	values := page[4+levelsLen:]
+	out := make([]any, n)
+	bit := 0
+	for i, ok := range present {
+		if !ok {
+			continue
+		}
+		switch typ {
+		case parquetBoolean:
+			out[i] = values[bit/8]&(1<<(bit%8)) != 0
+			bit++
+		case parquetInt64:
+			v := int64(binary.LittleEndian.Uint64(values))
+			values = values[8:]
+			if timestamp {
+				out[i] = time.UnixMicro(v).UTC()
+			} else {
+				out[i] = v
+			}
+		case parquetDouble:
+			out[i] = math.Float64frombits(binary.LittleEndian.Uint64(values))
+			values = values[8:]
+		case parquetByteArray:
+			l := binary.LittleEndian.Uint32(values)
+			out[i] = string(values[4 : 4+l])
+			values = values[4+l:]
+		}
+	}
+	return out
+}
+
+func TestWriteParquetRoundTrip(t *testing.T) {
+	when := time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC)
+	rows := []map[string]any{
+		{"element_id": "4:a:1", "labels": "GoFunc", "loc": int64(12), "score": 1.5, "exported": true, "modified": when, "tags": []any{"a", "b"}},
+		{"element_id": "4:a:2", "labels": "GoFunc:External", "exported": false, "score": int64(2)},
+		{"element_id": "4:a:3", "labels": "GoFunc", "loc": int64(-7), "exported": true},
+	}
+	path := filepath.Join(t.TempDir(), "nodes", "GoFunc.parquet")
+	if err := writeParquet(path, parquetColumns(rows, "element_id", "labels"), len(rows)); err != nil {
+		t.Fatal(err)
+	}
+	names, columns := readParquet(t, path)
+	wantNames := []string{"element_id", "labels", "exported", "loc", "modified", "score", "tags"}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Fatalf("columns = %v, want %v", names, wantNames)
+	}
+	want := [][]any{
+		{"4:a:1", "4:a:2", "4:a:3"},
+		{"GoFunc", "GoFunc:External", "GoFunc"},
+		{true, false, true},
+		{int64(12), nil, int64(-7)},
+		{when, nil, nil},
+		{1.5, 2.0, nil},
+		{`["a","b"]`, nil, nil},
+	}
+	for i := range want {
+		if !reflect.DeepEqual(columns[i], want[i]) {
+			t.Errorf("column %s = %v, want %v", names[i], columns[i], want[i])
+		}
+	}
+}
+
+func TestWriteParquetRowGroups(t *testing.T) {
+	// More rows than a row group holds and more columns than the short
+	// form of a Thrift list.
+	const n, width = parquetRowGroupRows*2 + 1, 16
+	rows := make([]map[string]any, n)
+	for i := range rows {
+		rows[i] = make(map[string]any, width)
+		for c := range width {
+			if (i+c)%3 != 0 {
+				rows[i][fmt.Sprintf("c%02d", c)] = int64(i * c)
+			}
+		}
+	}
+	path := filepath.Join(t.TempDir(), "wide.parquet")
+	if err := writeParquet(path, parquetColumns(rows), n); err != nil {
+		t.Fatal(err)
+	}
+	names, columns := readParquet(t, path)
+	if len(names) != width {
+		t.Fatalf("%d columns, want %d", len(names), width)
+	}
+	for c, name := range names {
+		for i, got := range columns[c] {
+			want, _ := rows[i][name].(int64)
+			if got == nil && rows[i][name] != nil || got != nil && got.(int64) != want {
+				t.Fatalf("row %d column %s = %v, want %v", i, name, got, rows[i][name])
+			}
+		}
+	}
+}
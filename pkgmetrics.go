@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+)
+
+// packageDependencies returns the dependencies between project packages,
+// test packages aside, as (from, to) pairs: the packages each imports and
+// those whose functions it calls. It also returns the number of call sites
+// per pair, as packageCalls does.
+func (c *Collector) packageDependencies() (map[[2]string]bool, map[[2]string]int) {
+	deps := make(map[[2]string]bool)
+	for path, p := range c.Packages {
+		if isTestPackage(path) {
+			continue
+		}
+		for _, imp := range p.Imports {
+			if _, ok := c.Packages[imp]; ok {
+				deps[[2]string{path, imp}] = true
+			}
+		}
+	}
+	calls := c.packageCalls()
+	for pair := range calls {
+		if !isTestPackage(pair[0]) {
+			deps[pair] = true
+		}
+	}
+	return deps, calls
+}
+
+// ComputePackageMetrics sets Robert C. Martin's package metrics on the
+// project packages, test packages aside, and returns them sorted by
+// import path:
+//
+//   - afferent coupling (Ca): the packages depending on it;
+//   - efferent coupling (Ce): the packages it depends on;
+//   - instability, Ce / (Ca + Ce), from 0 for a package only depended on to
+//     1 for one only depending; 0 for a package with neither;
+//   - abstractness, the share of its interfaces among its types; 0 for a
+//     package without types;
+//   - distance from the main sequence, |A + I - 1|: near 1, a package is
+//     concrete and depended on (rigid) or abstract and unused (useless).
+//
+// Dependencies are imports and calls between project packages.
+func (c *Collector) ComputePackageMetrics() []*PackageNode {
+	deps, _ := c.packageDependencies()
+	for _, p := range c.Packages {
+		p.Afferent, p.Efferent = 0, 0
+	}
+	for pair := range deps {
+		from, ok1 := c.Packages[pair[0]]
+		to, ok2 := c.Packages[pair[1]]
+		if ok1 && ok2 {
+			from.Efferent++
+			to.Afferent++
+		}
+	}
+	types := make(map[string]int)
+	abstract := make(map[string]int)
+	for _, s := range c.Structs {
+		types[s.Package]++
+	}
+	for _, t := range c.NamedTypes {
+		types[t.Package]++
+	}
+	for _, i := range c.Interfaces {
+		types[i.Package]++
+		abstract[i.Package]++
+	}
+
+	var pkgs []*PackageNode
+	for path, p := range c.Packages {
+		if isTestPackage(path) {
+			continue
+		}
+		p.Instability, p.Abstractness = 0, 0
+		if p.Afferent+p.Efferent > 0 {
+			p.Instability = float64(p.Efferent) / float64(p.Afferent+p.Efferent)
+		}
+		if types[path] > 0 {
+			p.Abstractness = float64(abstract[path]) / float64(types[path])
+		}
+		p.Distance = math.Abs(p.Abstractness + p.Instability - 1)
+		pkgs = append(pkgs, p)
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].ImportPath < pkgs[j].ImportPath })
+	return pkgs
+}
+
+// WritePackageMetricsReport prints the metrics returned by
+// ComputePackageMetrics, farthest from the main sequence first, with their
+// average.
+func WritePackageMetricsReport(w io.Writer, pkgs []*PackageNode) {
+	fmt.Fprintf(w, "Package metrics: %d packages\n", len(pkgs))
+	if len(pkgs) == 0 {
+		return
+	}
+	sorted := append([]*PackageNode(nil), pkgs...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Distance > sorted[j].Distance })
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Package\tCa\tCe\tI\tA\tD")
+	var sumI, sumA, sumD float64
+	for _, p := range sorted {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.2f\t%.2f\t%.2f\n", p.ImportPath, p.Afferent, p.Efferent, p.Instability, p.Abstractness, p.Distance)
+		sumI, sumA, sumD = sumI+p.Instability, sumA+p.Abstractness, sumD+p.Distance
+	}
+	n := float64(len(sorted))
+	fmt.Fprintf(tw, "average\t\t\t%.2f\t%.2f\t%.2f\n", sumI/n, sumA/n, sumD/n)
+	tw.Flush()
+}
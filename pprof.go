@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// ProfileData holds pprof samples attributed to graph functions and call
+// edges. Values are in Unit (nanoseconds for CPU profiles).
+type ProfileData struct {
+	Unit  string
+	Total int64
+	Flat  map[string]int64    // function full name -> value sampled in the function itself
+	Cum   map[string]int64    // function full name -> value sampled in it or its callees
+	Edges map[[2]string]int64 // caller, callee -> value sampled through the call
+}
+
+// CollectProfile reads a pprof profile (typically CPU) and attributes its
+// samples to the functions and call edges of the graph. The profile's
+// default sample type is used, or its last one if it has no default.
+// Inlined frames count as their own functions, like in pprof.
+func (c *Collector) CollectProfile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot open profile: %w", err)
+	}
+	defer f.Close()
+	prof, err := profile.Parse(f)
+	if err != nil {
+		return fmt.Errorf("cannot parse profile %s: %w", path, err)
+	}
+	if len(prof.SampleType) == 0 {
+		return fmt.Errorf("profile %s has no sample types", path)
+	}
+	idx := len(prof.SampleType) - 1
+	for i, st := range prof.SampleType {
+		if st.Type == prof.DefaultSampleType {
+			idx = i
+		}
+	}
+
+	known := func(name string) bool {
+		if _, ok := c.Funcs[name]; ok {
+			return true
+		}
+		_, ok := c.ExternalFuncs[name]
+		return ok
+	}
+	data := &ProfileData{
+		Unit:  prof.SampleType[idx].Unit,
+		Flat:  make(map[string]int64),
+		Cum:   make(map[string]int64),
+		Edges: make(map[[2]string]int64),
+	}
+	for _, s := range prof.Sample {
+		v := s.Value[idx]
+		data.Total += v
+
+		// Frames from the leaf up; inlined calls come first within a
+		// location.
+		var frames []string
+		for _, loc := range s.Location {
+			for _, line := range loc.Line {
+				if line.Function != nil {
+					frames = append(frames, pprofFuncName(line.Function.Name, c.PointerReceivers))
+				}
+			}
+		}
+		if len(frames) > 0 && known(frames[0]) {
+			data.Flat[frames[0]] += v
+		}
+		// Recursion must not count a function or edge twice per sample.
+		seenFunc := make(map[string]bool)
+		seenEdge := make(map[[2]string]bool)
+		for i, name := range frames {
+			if known(name) && !seenFunc[name] {
+				seenFunc[name] = true
+				data.Cum[name] += v
+			}
+			if i+1 < len(frames) {
+				edge := [2]string{frames[i+1], name}
+				if known(edge[0]) && known(edge[1]) && !seenEdge[edge] {
+					seenEdge[edge] = true
+					data.Edges[edge] += v
+				}
+			}
+		}
+	}
+	c.Profile = data
+	return nil
+}
+
+// pprofFuncName converts a runtime function name as recorded in profiles
+// (pkg.(*T).Method.func1.2, pkg.F[...]) to the FuncNode full name
+// (pkg.T.Method$1$2, pkg.F). ptrRecv keeps the (*T) of pointer receivers,
+// matching Collector.PointerReceivers.
+func pprofFuncName(name string, ptrRecv bool) string {
+	name = strings.ReplaceAll(name, "[...]", "")
+	slash := strings.LastIndexByte(name, '/')
+	dot := strings.IndexByte(name[slash+1:], '.')
+	if dot < 0 {
+		return name
+	}
+	pkg, rest := name[:slash+1+dot], name[slash+1+dot+1:]
+	if !ptrRecv {
+		rest = strings.NewReplacer("(*", "", "(", "", ")", "").Replace(rest)
+	}
+
+	var b strings.Builder
+	b.WriteString(pkg)
+	closure := false
+	for _, seg := range strings.Split(rest, ".") {
+		switch {
+		case strings.HasPrefix(seg, "func") && isDigits(seg[len("func"):]):
+			b.WriteString("$" + seg[len("func"):])
+			closure = true
+		case closure && isDigits(seg):
+			b.WriteString("$" + seg)
+		default:
+			b.WriteString("." + seg)
+		}
+	}
+	return b.String()
+}
+
+// isDigits reports whether s is a non-empty string of ASCII digits.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// progressStyle is how long phases report their progress.
+type progressStyle int
+
+const (
+	progressOff progressStyle = iota
+	progressLog               // a log line every progressLogInterval
+	progressBar               // a bar redrawn in place on stderr
+)
+
+// progressMode is the progress style of this run, set by --progress.
+var progressMode = progressOff
+
+// parseProgressMode returns the style named by the --progress flag; auto
+// draws a bar on a terminal and logs otherwise.
+func parseProgressMode(name string) (progressStyle, error) {
+	switch name {
+	case "auto":
+		if fi, err := os.Stderr.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+			return progressBar, nil
+		}
+		return progressLog, nil
+	case "bar":
+		return progressBar, nil
+	case "log":
+		return progressLog, nil
+	case "off":
+		return progressOff, nil
+	}
+	return progressOff, fmt.Errorf("invalid --progress %q: want auto, bar, log or off", name)
+}
+
+const (
+	progressDelay       = 2 * time.Second // phases shorter than this report nothing
+	progressBarInterval = 250 * time.Millisecond
+	progressLogInterval = 10 * time.Second
+	progressBarWidth    = 30
+)
+
+// Progress reports how far a long phase got, as a percentage of its total
+// or, when the total is unknown, as a count and the time elapsed. Add is
+// cheap enough for hot loops: reporting happens on a ticker.
+type Progress struct {
+	name    string
+	unit    string
+	total   int64 // 0 when unknown
+	done    atomic.Int64
+	started time.Time
+
+	stop     chan struct{}
+	finished sync.WaitGroup
+	reported bool // written by the ticker only
+}
+
+// startProgress starts reporting the progress of phase name, counting
+// total units, or an unknown number with total 0. Without a unit, only the
+// time elapsed is reported.
+func startProgress(name string, total int, unit string) *Progress {
+	p := &Progress{name: name, unit: unit, total: int64(total), started: time.Now(), stop: make(chan struct{})}
+	if progressMode == progressOff {
+		return p
+	}
+	interval := progressLogInterval
+	if progressMode == progressBar {
+		interval = progressBarInterval
+	}
+	p.finished.Add(1)
+	go func() {
+		defer p.finished.Done()
+		select {
+		case <-time.After(progressDelay):
+		case <-p.stop:
+			return
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			p.report(false)
+			select {
+			case <-ticker.C:
+			case <-p.stop:
+				p.report(true)
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// Add counts n more units done.
+func (p *Progress) Add(n int) {
+	p.done.Add(int64(n))
+}
+
+// Finish stops reporting, with a last report if the phase reported before.
+func (p *Progress) Finish() {
+	if progressMode == progressOff {
+		return
+	}
+	close(p.stop)
+	p.finished.Wait()
+}
+
+// report writes the progress, ending the bar if last is set. The last
+// report is skipped if the phase never reported.
+func (p *Progress) report(last bool) {
+	if last && !p.reported {
+		return
+	}
+	p.reported = true
+	done, elapsed := p.done.Load(), time.Since(p.started).Round(time.Second)
+	if progressMode == progressLog {
+		switch {
+		case p.total > 0:
+			log.Printf("%s: %d%% (%d/%d %s), %s elapsed", p.name, 100*done/p.total, done, p.total, p.unit, elapsed)
+		case p.unit != "":
+			log.Printf("%s: %d %s, %s elapsed", p.name, done, p.unit, elapsed)
+		default:
+			log.Printf("%s: %s elapsed", p.name, elapsed)
+		}
+		return
+	}
+	line := fmt.Sprintf("%s: %s", p.name, elapsed)
+	if p.unit != "" {
+		line = fmt.Sprintf("%s: %d %s  %s", p.name, done, p.unit, elapsed)
+	}
+	if p.total > 0 {
+		filled := int(progressBarWidth * min(done, p.total) / p.total)
+		line = fmt.Sprintf("%s [%s%s] %3d%% %d/%d %s  %s", p.name, strings.Repeat("#", filled),
+			strings.Repeat(".", progressBarWidth-filled), 100*done/p.total, done, p.total, p.unit, elapsed)
+	}
+	end := ""
+	if last {
+		end = "\n"
+	}
+	fmt.Fprintf(os.Stderr, "\r\033[K%s%s", line, end)
+}
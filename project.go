@@ -0,0 +1,57 @@
+package main
+
+import (
+	"maps"
+	"regexp"
+	"strings"
+)
+
+// nodePattern matches a labeled node pattern up to its property map or end.
+var nodePattern = regexp.MustCompile(`\((\w*)(:\w+(?:[:|]\w+)*)\s*(\{\s*\}|\{|\))`)
+
+// relPattern matches a typed single-hop relationship pattern up to its
+// property map or end; variable-length patterns are left out.
+var relPattern = regexp.MustCompile(`\[(\w*)(:\w+(?:\|\w+)*)\s*(\{\s*\}|\{|\])`)
+
+// scopeToProject returns cypher with a project property equal to value, a
+// Cypher expression such as $project, added to every labeled node pattern
+// and typed relationship pattern. Matching such patterns reads only the
+// project's part of a shared database, and merging them stamps what they
+// create with the project. Index definitions are returned unchanged.
+func scopeToProject(cypher, value string) string {
+	if strings.HasPrefix(strings.TrimSpace(cypher), "CREATE ") && strings.Contains(cypher, " INDEX ") {
+		return cypher
+	}
+	scope := func(pattern *regexp.Regexp, end string) func(string) string {
+		return func(m string) string {
+			sub := pattern.FindStringSubmatch(m)
+			open := m[:1] + sub[1] + sub[2] + " {project: " + value
+			if sub[3] == "{" {
+				return open + ", "
+			}
+			if sub[3] == end {
+				return open + "}" + end
+			}
+			return open + "}" // an empty map
+		}
+	}
+	cypher = nodePattern.ReplaceAllStringFunc(cypher, scope(nodePattern, ")"))
+	return relPattern.ReplaceAllStringFunc(cypher, scope(relPattern, "]"))
+}
+
+// projectCypher returns cypher scoped to project as a literal, for queries
+// printed or saved for people to run, or cypher itself without a project.
+func projectCypher(cypher, project string) string {
+	if project == "" {
+		return cypher
+	}
+	return scopeToProject(cypher, "'"+strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(project)+"'")
+}
+
+// withProject returns a copy of params with the project parameter set.
+func withProject(params map[string]any, project string) map[string]any {
+	scoped := make(map[string]any, len(params)+1)
+	maps.Copy(scoped, params)
+	scoped["project"] = project
+	return scoped
+}
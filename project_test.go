@@ -0,0 +1,89 @@
+package main
+
+import "testing"
+
+func TestScopeToProject(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{
+			name: "labeled node",
+			in:   "MATCH (f:GoFunc) RETURN f",
+			want: "MATCH (f:GoFunc {project: $project}) RETURN f",
+		},
+		{
+			name: "node with properties",
+			in:   "MATCH (t:GoStruct:Hotspot {id: $id}) RETURN t",
+			want: "MATCH (t:GoStruct:Hotspot {project: $project, id: $id}) RETURN t",
+		},
+		{
+			name: "empty property map",
+			in:   "MERGE (a:GoAnalysis {}) SET a.loaded_at = datetime()",
+			want: "MERGE (a:GoAnalysis {project: $project}) SET a.loaded_at = datetime()",
+		},
+		{
+			name: "label disjunction",
+			in:   "MATCH (t:GoStruct|GoInterface) WHERE t.deleted IS NULL RETURN t",
+			want: "MATCH (t:GoStruct|GoInterface {project: $project}) WHERE t.deleted IS NULL RETURN t",
+		},
+		{
+			name: "label disjunction with properties",
+			in:   "UNWIND $batch AS row MATCH (t:GoStruct|GoNamedType {id: row.id}) SET t.api_usage = row.usage",
+			want: "UNWIND $batch AS row MATCH (t:GoStruct|GoNamedType {project: $project, id: row.id}) SET t.api_usage = row.usage",
+		},
+		{
+			name: "relationship type disjunction with properties",
+			in:   "MATCH (f:GoFunc)-[r:ACCURATE_CALLS|CALLS_EXTERNAL {is_dynamic: true}]->(g:GoFunc) RETURN r",
+			want: "MATCH (f:GoFunc {project: $project})-[r:ACCURATE_CALLS|CALLS_EXTERNAL {project: $project, is_dynamic: true}]->(g:GoFunc {project: $project}) RETURN r",
+		},
+		{
+			// Relationships only join nodes of one project, so a path
+			// from a scoped node stays in the project.
+			name: "variable-length relationship",
+			in:   "MATCH (f:GoFunc {id: $id})-[:ACCURATE_CALLS*1..5]->(g:GoFunc) RETURN g",
+			want: "MATCH (f:GoFunc {project: $project, id: $id})-[:ACCURATE_CALLS*1..5]->(g:GoFunc {project: $project}) RETURN g",
+		},
+		{
+			name: "variable-length relationship type disjunction",
+			in:   "MATCH p = (f:GoFunc)-[:ACCURATE_CALLS|CALLS_EXTERNAL*]->(g) RETURN p",
+			want: "MATCH p = (f:GoFunc {project: $project})-[:ACCURATE_CALLS|CALLS_EXTERNAL*]->(g) RETURN p",
+		},
+		{
+			name: "COUNT subquery",
+			in:   "MATCH (f:GoFunc) SET f.in_degree = COUNT { (f)<-[:ACCURATE_CALLS]-() }",
+			want: "MATCH (f:GoFunc {project: $project}) SET f.in_degree = COUNT { (f)<-[:ACCURATE_CALLS {project: $project}]-() }",
+		},
+		{
+			name: "COUNT subquery with MATCH",
+			in:   "MATCH (f:GoFunc) WHERE COUNT { MATCH (f)-[r:ACCURATE_CALLS]->(:GoFunc {exported: true}) } > 2 RETURN f",
+			want: "MATCH (f:GoFunc {project: $project}) WHERE COUNT { MATCH (f)-[r:ACCURATE_CALLS {project: $project}]->(:GoFunc {project: $project, exported: true}) } > 2 RETURN f",
+		},
+		{
+			name: "unlabeled and untyped patterns",
+			in:   "MATCH (f)-[r]->(g) RETURN r",
+			want: "MATCH (f)-[r]->(g) RETURN r",
+		},
+		{
+			name: "index",
+			in:   "CREATE INDEX go_func_id IF NOT EXISTS FOR (f:GoFunc) ON (f.id)",
+			want: "CREATE INDEX go_func_id IF NOT EXISTS FOR (f:GoFunc) ON (f.id)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scopeToProject(tt.in, "$project"); got != tt.want {
+				t.Errorf("scopeToProject(%q)\n got %q\nwant %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProjectCypher(t *testing.T) {
+	if got := projectCypher("MATCH (f:GoFunc) RETURN f", ""); got != "MATCH (f:GoFunc) RETURN f" {
+		t.Errorf("projectCypher without a project = %q", got)
+	}
+	want := `MATCH (f:GoFunc {project: 'it\'s'}) RETURN f`
+	if got := projectCypher("MATCH (f:GoFunc) RETURN f", "it's"); got != want {
+		t.Errorf("projectCypher = %q, want %q", got, want)
+	}
+}
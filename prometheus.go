@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// queryBuckets are the upper bounds, in seconds, of the Neo4j statement
+// latency histogram.
+var queryBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Metrics measures a run for Prometheus: how long analysis and loading
+// took, what was collected, and the latency and errors of the Neo4j
+// statements. Methods on a nil *Metrics do nothing.
+type Metrics struct {
+	mu sync.Mutex
+
+	analysisSeconds float64
+	loadSeconds     float64
+	counts          map[string]int
+	success         bool
+	finished        time.Time
+
+	queryCounts []int64 // per bucket of queryBuckets, and +Inf last
+	querySum    float64
+	queryErrors int64
+}
+
+// NewMetrics returns empty metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{queryCounts: make([]int64, len(queryBuckets)+1)}
+}
+
+// ObserveQuery records a Neo4j statement that took d and failed with err.
+func (m *Metrics) ObserveQuery(d time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := sort.SearchFloat64s(queryBuckets, d.Seconds())
+	m.queryCounts[i]++
+	m.querySum += d.Seconds()
+	if err != nil {
+		m.queryErrors++
+	}
+}
+
+// SetAnalysis records how long the analysis took and what it collected.
+func (m *Metrics) SetAnalysis(d time.Duration, counts map[string]int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.analysisSeconds, m.counts = d.Seconds(), counts
+}
+
+// Finish records the end of the load, which took d and succeeded or not.
+func (m *Metrics) Finish(d time.Duration, success bool) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.loadSeconds, m.success, m.finished = d.Seconds(), success, time.Now()
+}
+
+// Write writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) Write(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var b bytes.Buffer
+	metric := func(name, typ, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+	metric("callgraph_analysis_duration_seconds", "gauge", "Time the analysis of the code took.")
+	fmt.Fprintf(&b, "callgraph_analysis_duration_seconds %s\n", formatFloat(m.analysisSeconds))
+	metric("callgraph_load_duration_seconds", "gauge", "Time the load into Neo4j took.")
+	fmt.Fprintf(&b, "callgraph_load_duration_seconds %s\n", formatFloat(m.loadSeconds))
+
+	metric("callgraph_entities", "gauge", "Nodes and edges collected by the analysis, by kind.")
+	kinds := make([]string, 0, len(m.counts))
+	for kind := range m.counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Fprintf(&b, "callgraph_entities{kind=%q} %d\n", kind, m.counts[kind])
+	}
+
+	metric("callgraph_neo4j_query_duration_seconds", "histogram", "Latency of the Neo4j statements.")
+	var cumulative int64
+	for i, le := range queryBuckets {
+		cumulative += m.queryCounts[i]
+		fmt.Fprintf(&b, "callgraph_neo4j_query_duration_seconds_bucket{le=%q} %d\n", formatFloat(le), cumulative)
+	}
+	cumulative += m.queryCounts[len(queryBuckets)]
+	fmt.Fprintf(&b, "callgraph_neo4j_query_duration_seconds_bucket{le=\"+Inf\"} %d\n", cumulative)
+	fmt.Fprintf(&b, "callgraph_neo4j_query_duration_seconds_sum %s\n", formatFloat(m.querySum))
+	fmt.Fprintf(&b, "callgraph_neo4j_query_duration_seconds_count %d\n", cumulative)
+	metric("callgraph_neo4j_query_errors_total", "counter", "Neo4j statements that failed.")
+	fmt.Fprintf(&b, "callgraph_neo4j_query_errors_total %d\n", m.queryErrors)
+
+	if !m.finished.IsZero() {
+		success := 0
+		if m.success {
+			success = 1
+		}
+		metric("callgraph_load_success", "gauge", "Whether the load completed: 1, or 0 if it failed.")
+		fmt.Fprintf(&b, "callgraph_load_success %d\n", success)
+		metric("callgraph_load_finished_timestamp_seconds", "gauge", "Unix time the load ended.")
+		fmt.Fprintf(&b, "callgraph_load_finished_timestamp_seconds %d\n", m.finished.Unix())
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// formatFloat formats v as Prometheus expects.
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// ServeHTTP serves the metrics.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.Write(w)
+}
+
+// Serve listens on addr and serves the metrics at /metrics until the
+// process exits.
+func (m *Metrics) Serve(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("cannot serve metrics: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	go http.Serve(ln, mux)
+	return nil
+}
+
+// WriteFile writes the metrics to path, replacing the earlier file at once
+// as the node exporter's textfile collector requires.
+func (m *Metrics) WriteFile(path string) error {
+	var b bytes.Buffer
+	m.Write(&b)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("cannot write metrics: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("cannot write metrics: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// AnalysisRun describes one execution of the load, for the AnalysisRun
+// node recording where the graph came from.
+type AnalysisRun struct {
+	ID        string
+	Module    string
+	Version   string   // version of this tool
+	Algorithm string   // vta, or static when a time-boxed analysis stopped early
+	GitSHA    string   // HEAD of the analysed repository; empty outside git
+	GitDirty  bool     // the work tree had uncommitted changes
+	Flags     []string // flags set on the command line or in the config file
+	Patterns  []string
+
+	StartedAt        time.Time
+	AnalysisDuration time.Duration
+	LoadDuration     time.Duration
+
+	Counts map[string]int // loaded entities by kind
+}
+
+// newRunID returns a random identifier for an analysis run.
+func newRunID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// toolVersion returns the module version of this tool, with the VCS
+// revision it was built from when known.
+func toolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	version := info.Main.Version
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			version += " (" + s.Value + ")"
+		}
+	}
+	return version
+}
+
+// gitState returns the HEAD commit of the repository holding dir and
+// whether its work tree has uncommitted changes, or an empty SHA when dir
+// is not in a git repository.
+func gitState(dir string) (string, bool) {
+	sha, err := runGit(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", false
+	}
+	status, err := runGit(dir, "status", "--porcelain")
+	return strings.TrimSpace(sha), err == nil && strings.TrimSpace(status) != ""
+}
+
+// setFlags returns the flags set in fs as name=value, with the values of
+// passwords and keys left out.
+func setFlags(fs *flag.FlagSet) []string {
+	var set []string
+	fs.Visit(func(f *flag.Flag) {
+		value := f.Value.String()
+		if strings.Contains(f.Name, "pass") || strings.Contains(f.Name, "key") {
+			value = "***"
+		}
+		set = append(set, f.Name+"="+value)
+	})
+	return set
+}
+
+// runCounts returns the number of loaded entities by kind.
+func (c *Collector) runCounts() map[string]int {
+	return map[string]int{
+		"packages":       len(c.Packages),
+		"files":          len(c.Files),
+		"funcs":          len(c.Funcs),
+		"external_funcs": len(c.ExternalFuncs),
+		"types":          len(c.Structs) + len(c.Interfaces) + len(c.NamedTypes) + len(c.Aliases),
+		"calls":          len(c.Calls),
+		"implements":     len(c.Implements),
+	}
+}
+
+// props returns the properties of the run's node. Counts are stored as
+// count_<kind> and durations in seconds.
+func (r *AnalysisRun) props() map[string]any {
+	props := map[string]any{
+		"module": r.Module, "version": r.Version, "algorithm": r.Algorithm,
+		"git_sha": nullIfEmpty(r.GitSHA), "git_dirty": r.GitDirty,
+		"flags": r.Flags, "patterns": r.Patterns,
+		"started_at":       r.StartedAt,
+		"analysis_seconds": r.AnalysisDuration.Seconds(),
+		"load_seconds":     r.LoadDuration.Seconds(),
+	}
+	for kind, n := range r.Counts {
+		props["count_"+kind] = n
+	}
+	return props
+}
+
+// String summarizes the run for the log.
+func (r *AnalysisRun) String() string {
+	return fmt.Sprintf("run %s: analysis %s, load %s", r.ID,
+		r.AnalysisDuration.Round(time.Second), r.LoadDuration.Round(time.Second))
+}
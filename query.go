@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// maxSymbolMatches caps the functions a query symbol may resolve to.
+const maxSymbolMatches = 20
+
+// queryEdge is a call from or to a function expanded by a query.
+type queryEdge struct {
+	Func     string // full name of the function at the other end
+	Dynamic  bool   // dispatched through an interface at one or more sites
+	External bool   // the callee is a dependency or standard library function
+	Sites    []string
+}
+
+// callGraphReader is the call graph read by the query subcommand: a graph
+// loaded into Neo4j, or the project analysed in memory.
+type callGraphReader interface {
+	// lookup returns the full names of the functions symbol names: a full
+	// name, or its trailing part such as orders.Service.Create.
+	lookup(symbol string) ([]string, error)
+	// expand returns the calls made by each of names, or the calls to them
+	// if reverse is set.
+	expand(names []string, reverse bool) (map[string][]queryEdge, error)
+	// lookupInterface returns the keys of the interfaces symbol names.
+	lookupInterface(symbol string) ([]string, error)
+	// implementations returns the types implementing the interface iface,
+	// sorted by type.
+	implementations(iface string) ([]ImplementsEdge, error)
+	// lookupPackage returns the full names of the functions of the project
+	// packages pkg names: an import path, or its trailing part.
+	lookupPackage(pkg string) ([]string, error)
+	// allCalls returns every function, with its location, and the calls
+	// made by each.
+	allCalls() ([]lookupFunc, map[string][]queryEdge, error)
+	// apiGraph returns the project functions with their callers and the
+	// exported types, which the API surface is computed from.
+	apiGraph() (*apiGraph, error)
+}
+
+// symbolMatches reports whether the full name fullName matches a query
+// symbol: the full name itself, or a suffix after a dot or a slash.
+func symbolMatches(fullName, symbol string) bool {
+	return fullName == symbol || strings.HasSuffix(fullName, "."+symbol) || strings.HasSuffix(fullName, "/"+symbol)
+}
+
+// lookup implements callGraphReader on the analysed project.
+func (c *Collector) lookup(symbol string) ([]string, error) {
+	var names []string
+	for name := range c.Funcs {
+		if symbolMatches(name, symbol) {
+			names = append(names, name)
+		}
+	}
+	for name := range c.ExternalFuncs {
+		if symbolMatches(name, symbol) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// expand implements callGraphReader on the analysed project.
+func (c *Collector) expand(names []string, reverse bool) (map[string][]queryEdge, error) {
+	want := make(map[string]bool, len(names))
+	for _, n := range names {
+		want[n] = true
+	}
+	edges := make(map[string][]queryEdge)
+	for _, e := range c.Calls {
+		from, to := e.CallerFullName, e.CalleeFullName
+		if reverse {
+			from, to = to, from
+		}
+		if !want[from] {
+			continue
+		}
+		sites := make([]string, len(e.Sites))
+		for i, s := range e.Sites {
+			sites[i] = s.String()
+		}
+		edges[from] = append(edges[from], queryEdge{Func: to, Dynamic: e.IsDynamic, External: e.External, Sites: sites})
+	}
+	for _, es := range edges {
+		sort.Slice(es, func(i, j int) bool { return es[i].Func < es[j].Func })
+	}
+	return edges, nil
+}
+
+// neo4jReader reads a call graph loaded into Neo4j, with the names and
+// project of its loader.
+type neo4jReader struct {
+	loader *Neo4jLoader
+}
+
+// newNeo4jReader returns a reader of the graph loader is connected to,
+// with names and scoped to project.
+func newNeo4jReader(loader *Neo4jLoader, names *GraphNames, project string) *neo4jReader {
+	loader.Names, loader.Project = names, project
+	return &neo4jReader{loader: loader}
+}
+
+// read runs a read-only query and returns its records.
+func (r *neo4jReader) read(cypher string, params map[string]any) ([]*neo4j.Record, error) {
+	cypher, params, err := r.loader.prepare(cypher, params)
+	if err != nil {
+		return nil, err
+	}
+	res, err := neo4j.ExecuteQuery(r.loader.ctx, r.loader.driver, cypher, params,
+		neo4j.EagerResultTransformer, neo4j.ExecuteQueryWithReadersRouting())
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	return res.Records, nil
+}
+
+// lookup implements callGraphReader.
+func (r *neo4jReader) lookup(symbol string) ([]string, error) {
+	recs, err := r.read(`MATCH (f:GoFunc)
+		 WHERE f.deleted IS NULL
+		   AND (f.full_name = $symbol OR f.full_name ENDS WITH '.' + $symbol OR f.full_name ENDS WITH '/' + $symbol)
+		 RETURN DISTINCT f.full_name AS name ORDER BY name LIMIT $limit`,
+		map[string]any{"symbol": symbol, "limit": maxSymbolMatches + 1})
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(recs))
+	for _, rec := range recs {
+		name, _, _ := neo4j.GetRecordValue[string](rec, "name")
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// expand implements callGraphReader.
+func (r *neo4jReader) expand(names []string, reverse bool) (map[string][]queryEdge, error) {
+	pattern := "(f:GoFunc {full_name: name})-[r:ACCURATE_CALLS|CALLS_EXTERNAL]->(g:GoFunc)"
+	if reverse {
+		pattern = "(f:GoFunc {full_name: name})<-[r:ACCURATE_CALLS|CALLS_EXTERNAL]-(g:GoFunc)"
+	}
+	recs, err := r.read(`UNWIND $names AS name
+		 MATCH `+pattern+`
+		 WHERE g.deleted IS NULL
+		 RETURN name, g.full_name AS other, coalesce(r.is_dynamic, false) AS dynamic,
+		        type(r) = 'CALLS_EXTERNAL' AS external, coalesce(r.sites, []) AS sites
+		 ORDER BY name, other`,
+		map[string]any{"names": names})
+	if err != nil {
+		return nil, err
+	}
+	edges := make(map[string][]queryEdge)
+	for _, rec := range recs {
+		name, _, _ := neo4j.GetRecordValue[string](rec, "name")
+		e := queryEdge{}
+		e.Func, _, _ = neo4j.GetRecordValue[string](rec, "other")
+		e.Dynamic, _, _ = neo4j.GetRecordValue[bool](rec, "dynamic")
+		e.External, _, _ = neo4j.GetRecordValue[bool](rec, "external")
+		sites, _, _ := neo4j.GetRecordValue[[]any](rec, "sites")
+		for _, s := range sites {
+			if s, ok := s.(string); ok {
+				e.Sites = append(e.Sites, s)
+			}
+		}
+		edges[name] = append(edges[name], e)
+	}
+	return edges, nil
+}
+
+// resolveSymbol returns the functions symbol names in g, failing if there
+// are none or too many.
+func resolveSymbol(g callGraphReader, symbol string) ([]string, error) {
+	names, err := g.lookup(symbol)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(names) == 0:
+		return nil, fmt.Errorf("no function matches %q", symbol)
+	case len(names) > maxSymbolMatches:
+		return nil, fmt.Errorf("%q matches more than %d functions; qualify it with its package", symbol, maxSymbolMatches)
+	}
+	return names, nil
+}
+
+// callTree is a function and the calls expanded from it.
+type callTree struct {
+	Func     string
+	Edge     queryEdge   // the call leading to it; zero at the root
+	Children []*callTree // nil if not expanded
+	Repeated bool        // expanded elsewhere in the tree
+}
+
+// buildCallTree expands the calls made by root, or to it if reverse is
+// set, depth levels deep, one query per level. Functions met again are
+// marked Repeated instead of expanded twice.
+func buildCallTree(g callGraphReader, root string, depth int, reverse bool) (*callTree, error) {
+	tree := &callTree{Func: root}
+	seen := map[string]bool{root: true}
+	level := []*callTree{tree}
+	for d := 0; d < depth && len(level) > 0; d++ {
+		names := make([]string, len(level))
+		for i, t := range level {
+			names[i] = t.Func
+		}
+		edges, err := g.expand(names, reverse)
+		if err != nil {
+			return nil, err
+		}
+		var next []*callTree
+		for _, t := range level {
+			for _, e := range edges[t.Func] {
+				child := &callTree{Func: e.Func, Edge: e, Repeated: seen[e.Func]}
+				t.Children = append(t.Children, child)
+				if !child.Repeated {
+					seen[e.Func] = true
+					next = append(next, child)
+				}
+			}
+		}
+		level = next
+	}
+	return tree, nil
+}
+
+// describeEdge returns the annotations printed after a function reached
+// through e.
+func describeEdge(e queryEdge) string {
+	var s []string
+	if e.Dynamic {
+		s = append(s, "dynamic")
+	}
+	if e.External {
+		s = append(s, "external")
+	}
+	switch len(e.Sites) {
+	case 0:
+	case 1:
+		s = append(s, e.Sites[0])
+	default:
+		s = append(s, fmt.Sprintf("%s +%d", e.Sites[0], len(e.Sites)-1))
+	}
+	if len(s) == 0 {
+		return ""
+	}
+	return "  [" + strings.Join(s, ", ") + "]"
+}
+
+// writeCallTree prints t as an indented tree.
+func writeCallTree(w io.Writer, t *callTree) {
+	fmt.Fprintln(w, t.Func)
+	var walk func(t *callTree, prefix string)
+	walk = func(t *callTree, prefix string) {
+		for i, child := range t.Children {
+			branch, indent := "├── ", "│   "
+			if i == len(t.Children)-1 {
+				branch, indent = "└── ", "    "
+			}
+			repeated := ""
+			if child.Repeated {
+				repeated = " (see above)"
+			}
+			fmt.Fprintf(w, "%s%s%s%s%s\n", prefix, branch, child.Func, describeEdge(child.Edge), repeated)
+			walk(child, prefix+indent)
+		}
+	}
+	walk(t, "")
+}
+
+// parseInterspersed parses args with cmd, allowing flags after positional
+// arguments, and returns the positional arguments.
+func parseInterspersed(cmd *flag.FlagSet, args []string) []string {
+	var pos []string
+	for {
+		cmd.Parse(args)
+		if cmd.NArg() == 0 {
+			return pos
+		}
+		pos = append(pos, cmd.Arg(0))
+		args = cmd.Args()[1:]
+	}
+}
+
+// openCallGraph returns the call graph of project loaded into Neo4j with
+// names if pass is set, or else the project in dir analysed in memory, and
+// a function releasing it.
+func openCallGraph(uri, user, pass string, names *GraphNames, project, dir, tags string) (callGraphReader, func(), error) {
+	if pass != "" {
+		loader, err := NewNeo4jLoader(context.Background(), uri, user, pass)
+		if err != nil {
+			return nil, nil, err
+		}
+		return newNeo4jReader(loader, names, project), loader.Close, nil
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	collector, err := analyzeInMemory(absDir, tags, []string{"./..."}, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	return collector, func() {}, nil
+}
+
+// runQuery implements the query subcommand.
+func runQuery(args []string) error {
+	cmd := flag.NewFlagSet("query", flag.ExitOnError)
+	neo4jURI := cmd.String("neo4j-uri", "bolt://localhost:7687", "Neo4j URI: bolt:// for one server, neo4j:// to route in a cluster")
+	neo4jUser := cmd.String("neo4j-user", "neo4j", "Neo4j username")
+	neo4jPass := cmd.String("neo4j-pass", "", "Neo4j password; without it the project in --dir is analysed in memory")
+	dir := cmd.String("dir", ".", "Project root directory, when analysing in memory")
+	tags := cmd.String("tags", "", "Comma-separated build tags, when analysing in memory")
+	depth := cmd.Int("depth", 3, "Levels of calls to expand (callers, callees)")
+	from := cmd.String("from", "", "Calling function (path)")
+	to := cmd.String("to", "", "Called function (path)")
+	maxDepth := cmd.Int("max-depth", 6, "Longest path in calls (path)")
+	allPaths := cmd.Bool("all", false, "Print all paths up to --max-depth instead of the shortest ones (path)")
+	limit := cmd.Int("limit", 100, "Most paths (path) or rows (ask) to print")
+	llmURL := cmd.String("llm-url", "https://api.openai.com/v1/chat/completions", "OpenAI-compatible chat completions endpoint translating questions into Cypher (ask); the API key is read from LLM_API_KEY")
+	llmModel := cmd.String("llm-model", "gpt-4o-mini", "Model for --llm-url (ask)")
+	graphOpts := addGraphFlags(cmd)
+	cmd.Usage = func() {
+		fmt.Fprintln(cmd.Output(), "Usage: go-callgraph-neo4j query <callers|callees> <symbol> [flags]")
+		fmt.Fprintln(cmd.Output(), "       go-callgraph-neo4j query path --from <symbol> --to <symbol> [flags]")
+		fmt.Fprintln(cmd.Output(), "       go-callgraph-neo4j query implements <interface> [flags]")
+		fmt.Fprintln(cmd.Output(), "       go-callgraph-neo4j query resolve <interface.Method> [flags]")
+		fmt.Fprintln(cmd.Output(), "       go-callgraph-neo4j query ask <question> --neo4j-pass <password> [flags]")
+		cmd.PrintDefaults()
+	}
+	pos := parseInterspersed(cmd, args)
+	var valid bool
+	switch {
+	case len(pos) == 2 && (pos[0] == "callers" || pos[0] == "callees"):
+		valid = *depth >= 1
+	case len(pos) == 1 && pos[0] == "path":
+		valid = *from != "" && *to != "" && *maxDepth >= 1 && *limit >= 1
+	case len(pos) == 2 && pos[0] == "implements":
+		valid = true
+	case len(pos) == 2 && pos[0] == "resolve":
+		valid = strings.Contains(pos[1], ".")
+	case len(pos) == 2 && pos[0] == "ask":
+		valid = *limit >= 1
+	}
+	if !valid {
+		cmd.Usage()
+		os.Exit(1)
+	}
+	if pos[0] == "ask" && *neo4jPass == "" {
+		return fmt.Errorf("query ask reads a loaded graph: give --neo4j-pass")
+	}
+
+	names, err := graphOpts.names()
+	if err != nil {
+		return err
+	}
+
+	g, closeGraph, err := openCallGraph(*neo4jURI, *neo4jUser, *neo4jPass, names, *graphOpts.project, *dir, *tags)
+	if err != nil {
+		return err
+	}
+	defer closeGraph()
+
+	switch pos[0] {
+	case "ask":
+		t := &CypherTranslator{URL: *llmURL, Model: *llmModel, APIKey: os.Getenv("LLM_API_KEY")}
+		return askGraph(os.Stdout, g.(*neo4jReader), t, pos[1], *limit)
+	case "implements", "resolve":
+		return queryImplementations(os.Stdout, g, pos[0], pos[1])
+	case "path":
+		sources, err := resolveSymbol(g, *from)
+		if err != nil {
+			return err
+		}
+		targets, err := resolveSymbol(g, *to)
+		if err != nil {
+			return err
+		}
+		paths, truncated, err := FindCallPaths(g, sources, targets, *maxDepth, *allPaths, *limit)
+		if err != nil {
+			return err
+		}
+		writeCallPaths(os.Stdout, paths, truncated)
+		return nil
+	}
+
+	roots, err := resolveSymbol(g, pos[1])
+	if err != nil {
+		return err
+	}
+	for i, root := range roots {
+		if i > 0 {
+			fmt.Println()
+		}
+		tree, err := buildCallTree(g, root, *depth, pos[0] == "callers")
+		if err != nil {
+			return err
+		}
+		writeCallTree(os.Stdout, tree)
+	}
+	return nil
+}
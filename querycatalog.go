@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// catalogQuery is a saved Cypher query of the query catalog.
+type catalogQuery struct {
+	Name   string
+	Params string // :param commands setting its parameters; empty if it takes none
+	Cypher string
+	Hint   bool // printed after a load
+}
+
+// queryCatalog is the curated set of queries over the loaded graph.
+var queryCatalog = []catalogQuery{
+	{Name: "All packages", Hint: true,
+		Cypher: "MATCH (p:GoPackage) RETURN p.name, p.import_path ORDER BY p.import_path"},
+	{Name: "Who calls a function", Params: ":param func => 'example.com/app/internal/orders.Service.CreateOrder'", Hint: true,
+		Cypher: "MATCH (caller:GoFunc)-[r:ACCURATE_CALLS]->(f:GoFunc {full_name: $func})\nRETURN caller.full_name, r.is_dynamic, r.sites ORDER BY caller.full_name"},
+	{Name: "Transitive callers of a function", Params: ":param func => 'example.com/app/internal/orders.Service.CreateOrder'",
+		Cypher: "MATCH (caller:GoFunc)-[:ACCURATE_CALLS*1..5]->(f:GoFunc {full_name: $func})\nRETURN DISTINCT caller.full_name ORDER BY caller.full_name"},
+	{Name: "What a function calls", Params: ":param func => 'example.com/app/cmd/app.main'",
+		Cypher: "MATCH (f:GoFunc {full_name: $func})-[r:ACCURATE_CALLS|CALLS_EXTERNAL]->(callee:GoFunc)\nRETURN callee.full_name, type(r) = 'CALLS_EXTERNAL' AS external, r.is_dynamic ORDER BY callee.full_name"},
+	{Name: "Search functions (load with --fulltext-index)", Params: ":param text => 'create* order~'",
+		Cypher: "CALL db.index.fulltext.queryNodes('go_func_text', $text) YIELD node, score\nRETURN node.full_name, node.file, node.line, score ORDER BY score DESC LIMIT 25"},
+	{Name: "Functions similar to a function (load with --embed-url)", Params: ":param func => 'example.com/app/internal/orders.Service.CreateOrder'",
+		Cypher: "MATCH (f:GoFunc {full_name: $func})\nCALL db.index.vector.queryNodes('go_func_embedding', 11, f.embedding) YIELD node, score\nWHERE node <> f RETURN node.full_name, node.file, node.line, score ORDER BY score DESC"},
+	{Name: "Functions with most outgoing calls", Hint: true,
+		Cypher: "MATCH (f:GoFunc) RETURN f.full_name, f.out_degree ORDER BY f.out_degree DESC LIMIT 20"},
+	{Name: "Most called functions",
+		Cypher: "MATCH (f:GoFunc) WHERE NOT f:External RETURN f.full_name, f.in_degree ORDER BY f.in_degree DESC LIMIT 20"},
+	{Name: "God functions",
+		Cypher: "MATCH (f:GoFunc:Hotspot)\nRETURN f.full_name, f.hotspot_reasons, f.hotspot_score, f.in_degree, f.out_degree, f.statements, f.complexity, f.file, f.line\nORDER BY f.hotspot_score DESC LIMIT 25"},
+	{Name: "God packages",
+		Cypher: "MATCH (p:GoPackage:Hotspot)\nRETURN p.import_path, p.hotspot_reasons, p.hotspot_score, p.statements, p.afferent_coupling, p.efferent_coupling\nORDER BY p.hotspot_score DESC"},
+	{Name: "Structs implementing an interface", Hint: true,
+		Cypher: "MATCH (s:GoStruct)-[:IMPLEMENTS]->(i:GoInterface) RETURN s.name, i.name"},
+	{Name: "Dynamic (interface) calls", Hint: true,
+		Cypher: "MATCH (f:GoFunc)-[r:ACCURATE_CALLS {is_dynamic: true}]->(target) RETURN f.full_name, target.full_name, r.site"},
+	{Name: "Dead code (load with --dead-code)",
+		Cypher: "MATCH (f:GoFunc:Unreachable) RETURN f.package, f.full_name, f.file, f.line ORDER BY f.package, f.full_name"},
+	{Name: "Candidates for unexporting (label with report api --label)",
+		Cypher: "MATCH (n:UnexportCandidate)\nRETURN n.package, coalesce(n.full_name, n.key) AS symbol, n.api_usage, n.file, n.line ORDER BY n.package, symbol"},
+	{Name: "Package dependency cycles",
+		Cypher: "MATCH (p:GoPackage) WHERE p.cycle_id IS NOT NULL\nRETURN p.cycle_id, collect(p.import_path) AS packages ORDER BY p.cycle_id"},
+	{Name: "Recursive functions",
+		Cypher: "MATCH (f:GoFunc {recursive: true})\nRETURN f.scc_id, collect(f.full_name) AS functions ORDER BY size(functions) DESC"},
+	{Name: "Production graph only (no tests, tools/, examples/)", Hint: true,
+		Cypher: "MATCH (f:GoFunc {prod_reachable: true})-[:ACCURATE_CALLS]->(t:GoFunc {prod_reachable: true}) RETURN f.full_name, t.full_name"},
+}
+
+// nonSlug matches the runs of characters left out of catalog file names.
+var nonSlug = regexp.MustCompile(`[^a-z0-9]+`)
+
+// cypherText returns q as the text of a .cypher file: its name as the
+// leading comment, which Neo4j Browser takes as the favorite's name, then
+// its parameters, commented out, and its query with names, scoped to
+// project.
+func (q catalogQuery) cypherText(names *GraphNames, project string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "// %s\n", q.Name)
+	if q.Params != "" {
+		fmt.Fprintf(&b, "// Set the parameters first: %s\n", q.Params)
+	}
+	b.WriteString(projectCypher(names.Rewrite(q.Cypher), project))
+	b.WriteString("\n")
+	return b.String()
+}
+
+// WriteQueryCatalog writes each query of the catalog, with names and
+// scoped to project, to a .cypher file in dir, creating it, for importing
+// into Neo4j Browser favorites.
+func WriteQueryCatalog(dir string, names *GraphNames, project string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create query catalog directory: %w", err)
+	}
+	for i, q := range queryCatalog {
+		slug := strings.Trim(nonSlug.ReplaceAllString(strings.ToLower(q.Name), "-"), "-")
+		path := filepath.Join(dir, fmt.Sprintf("%02d-%s.cypher", i+1, slug))
+		if err := os.WriteFile(path, []byte(q.cypherText(names, project)), 0o644); err != nil {
+			return fmt.Errorf("failed to write query catalog: %w", err)
+		}
+	}
+	return nil
+}
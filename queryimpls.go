@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// lookupInterface implements callGraphReader on the analysed project.
+func (c *Collector) lookupInterface(symbol string) ([]string, error) {
+	var keys []string
+	for key := range c.Interfaces {
+		if symbolMatches(key, symbol) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// implementations implements callGraphReader on the analysed project.
+func (c *Collector) implementations(iface string) ([]ImplementsEdge, error) {
+	var impls []ImplementsEdge
+	for _, e := range c.Implements {
+		if e.Interface == iface {
+			impls = append(impls, e)
+		}
+	}
+	sort.Slice(impls, func(i, j int) bool { return impls[i].Struct < impls[j].Struct })
+	return impls, nil
+}
+
+// lookupInterface implements callGraphReader.
+func (r *neo4jReader) lookupInterface(symbol string) ([]string, error) {
+	recs, err := r.read(`MATCH (i:GoInterface)
+		 WHERE i.deleted IS NULL
+		   AND (i.key = $symbol OR i.key ENDS WITH '.' + $symbol OR i.key ENDS WITH '/' + $symbol)
+		 RETURN DISTINCT i.key AS key ORDER BY key LIMIT $limit`,
+		map[string]any{"symbol": symbol, "limit": maxSymbolMatches + 1})
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(recs))
+	for _, rec := range recs {
+		key, _, _ := neo4j.GetRecordValue[string](rec, "key")
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// implementations implements callGraphReader.
+func (r *neo4jReader) implementations(iface string) ([]ImplementsEdge, error) {
+	recs, err := r.read(`MATCH (t)-[r:IMPLEMENTS]->(:GoInterface {key: $iface})
+		 WHERE t.deleted IS NULL
+		 RETURN t.key AS type, r.receiver AS receiver, coalesce(r.methods, []) AS methods,
+		        coalesce(r.method_funcs, []) AS funcs
+		 ORDER BY type`,
+		map[string]any{"iface": iface})
+	if err != nil {
+		return nil, err
+	}
+	strs := func(v []any) []string {
+		s := make([]string, len(v))
+		for i, x := range v {
+			s[i], _ = x.(string)
+		}
+		return s
+	}
+	impls := make([]ImplementsEdge, 0, len(recs))
+	for _, rec := range recs {
+		e := ImplementsEdge{Interface: iface}
+		e.Struct, _, _ = neo4j.GetRecordValue[string](rec, "type")
+		e.Receiver, _, _ = neo4j.GetRecordValue[string](rec, "receiver")
+		methods, _, _ := neo4j.GetRecordValue[[]any](rec, "methods")
+		funcs, _, _ := neo4j.GetRecordValue[[]any](rec, "funcs")
+		e.Methods, e.MethodFuncs = strs(methods), strs(funcs)
+		impls = append(impls, e)
+	}
+	return impls, nil
+}
+
+// resolveInterface returns the interface symbol names in g, failing if
+// there are none or too many.
+func resolveInterface(g callGraphReader, symbol string) ([]string, error) {
+	keys, err := g.lookupInterface(symbol)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(keys) == 0:
+		return nil, fmt.Errorf("no interface matches %q", symbol)
+	case len(keys) > maxSymbolMatches:
+		return nil, fmt.Errorf("%q matches more than %d interfaces; qualify it with its package", symbol, maxSymbolMatches)
+	}
+	return keys, nil
+}
+
+// implementingType returns the type of e that satisfies its interface,
+// with a * if only the pointer does.
+func implementingType(e ImplementsEdge) string {
+	if e.Receiver == "pointer" {
+		return "*" + e.Struct
+	}
+	return e.Struct
+}
+
+// writeImplementations prints the types implementing iface.
+func writeImplementations(w io.Writer, iface string, impls []ImplementsEdge) {
+	fmt.Fprintf(w, "Implementations of %s: %d\n", iface, len(impls))
+	for _, e := range impls {
+		fmt.Fprintf(w, "  %s\n", implementingType(e))
+	}
+}
+
+// writeMethodResolution prints the concrete methods a call of method on
+// iface can dispatch to, with the implementing types they are reached
+// through; methods promoted from embedded fields belong to another type.
+func writeMethodResolution(w io.Writer, iface, method string, impls []ImplementsEdge) {
+	targets := make(map[string][]string) // concrete method -> implementing types
+	for _, e := range impls {
+		for i, m := range e.Methods {
+			if m == method && i < len(e.MethodFuncs) && e.MethodFuncs[i] != "" {
+				targets[e.MethodFuncs[i]] = append(targets[e.MethodFuncs[i]], implementingType(e))
+			}
+		}
+	}
+	names := make([]string, 0, len(targets))
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(w, "Methods a call of %s.%s may dispatch to: %d\n", iface, method, len(names))
+	for _, name := range names {
+		types := targets[name]
+		// A method declared on its only implementing type needs no note.
+		if len(types) == 1 && strings.HasPrefix(name, strings.TrimPrefix(types[0], "*")+".") {
+			fmt.Fprintf(w, "  %s\n", name)
+			continue
+		}
+		fmt.Fprintf(w, "  %s  [via %s]\n", name, strings.Join(types, ", "))
+	}
+}
+
+// queryImplementations runs query implements, listing the types
+// implementing an interface, or query resolve, listing the methods a call
+// of Interface.Method can dispatch to.
+func queryImplementations(w io.Writer, g callGraphReader, kind, symbol string) error {
+	method := ""
+	if kind == "resolve" {
+		i := strings.LastIndex(symbol, ".")
+		symbol, method = symbol[:i], symbol[i+1:]
+	}
+	keys, err := resolveInterface(g, symbol)
+	if err != nil {
+		return err
+	}
+	for i, key := range keys {
+		impls, err := g.implementations(key)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		if kind == "implements" {
+			writeImplementations(w, key, impls)
+			continue
+		}
+		if len(impls) > 0 && !slices.Contains(impls[0].Methods, method) {
+			return fmt.Errorf("interface %s has no method %s", key, method)
+		}
+		writeMethodResolution(w, key, method, impls)
+	}
+	return nil
+}
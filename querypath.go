@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+)
+
+// callHop is one call along a callPath.
+type callHop struct {
+	From string
+	Edge queryEdge
+}
+
+// callPath is a chain of calls from one function to another.
+type callPath []callHop
+
+// FindCallPaths returns the call paths from the functions in from to those
+// in to of at most maxDepth calls: the shortest ones, or all simple paths
+// if all is set, limit paths at most, ordered by length. It expands the
+// graph one level per query. The second result reports that limit cut the
+// paths short.
+func FindCallPaths(g callGraphReader, from, to []string, maxDepth int, all bool, limit int) ([]callPath, bool, error) {
+	targets := make(map[string]bool, len(to))
+	for _, t := range to {
+		targets[t] = true
+	}
+	adj := make(map[string][]queryEdge)
+	dist := make(map[string]int) // calls from the nearest source
+	level := slices.Clone(from)
+	for _, f := range from {
+		dist[f] = 0
+	}
+	bound := -1 // length of the shortest path found
+	for d := 0; d < maxDepth && len(level) > 0 && (all || bound < 0); d++ {
+		edges, err := g.expand(level, false)
+		if err != nil {
+			return nil, false, err
+		}
+		var next []string
+		for _, name := range level {
+			adj[name] = edges[name]
+			for _, e := range edges[name] {
+				if _, ok := dist[e.Func]; ok {
+					continue
+				}
+				dist[e.Func] = d + 1
+				if targets[e.Func] {
+					if bound < 0 {
+						bound = d + 1
+					}
+					continue // paths end at the first target
+				}
+				next = append(next, e.Func)
+			}
+		}
+		level = next
+	}
+	if bound < 0 {
+		return nil, false, nil
+	}
+	if all {
+		bound = maxDepth
+	}
+
+	// toTarget holds the calls from each function to the nearest target,
+	// for pruning paths that cannot arrive within bound.
+	toTarget := make(map[string]int)
+	reverse := make(map[string][]string)
+	for name, es := range adj {
+		for _, e := range es {
+			reverse[e.Func] = append(reverse[e.Func], name)
+		}
+	}
+	queue := slices.Clone(to)
+	for _, t := range to {
+		toTarget[t] = 0
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, caller := range reverse[name] {
+			if _, ok := toTarget[caller]; !ok {
+				toTarget[caller] = toTarget[name] + 1
+				queue = append(queue, caller)
+			}
+		}
+	}
+
+	var paths []callPath
+	truncated := false
+	onPath := make(map[string]bool)
+	var walk func(name string, path callPath)
+	walk = func(name string, path callPath) {
+		if truncated {
+			return
+		}
+		if targets[name] && len(path) > 0 {
+			if len(paths) == limit {
+				truncated = true
+				return
+			}
+			paths = append(paths, slices.Clone(path))
+			return
+		}
+		onPath[name] = true
+		defer delete(onPath, name)
+		for _, e := range adj[name] {
+			left, ok := toTarget[e.Func]
+			if !ok || onPath[e.Func] || len(path)+1+left > bound {
+				continue
+			}
+			walk(e.Func, append(path, callHop{From: name, Edge: e}))
+		}
+	}
+	sorted := slices.Clone(from)
+	sort.Strings(sorted)
+	for _, f := range sorted {
+		if _, ok := toTarget[f]; ok {
+			walk(f, nil)
+		}
+	}
+	sort.SliceStable(paths, func(i, j int) bool { return len(paths[i]) < len(paths[j]) })
+	return paths, truncated, nil
+}
+
+// writeCallPaths prints paths with the kind and first site of each call.
+func writeCallPaths(w io.Writer, paths []callPath, truncated bool) {
+	if len(paths) == 0 {
+		fmt.Fprintln(w, "No call path found.")
+		return
+	}
+	for i, p := range paths {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "Path %d (%d calls):\n  %s\n", i+1, len(p), p[0].From)
+		for _, hop := range p {
+			kind := "static"
+			if hop.Edge.Dynamic {
+				kind = "dynamic"
+			}
+			site := ""
+			if len(hop.Edge.Sites) > 0 {
+				site = "  (" + hop.Edge.Sites[0] + ")"
+			}
+			fmt.Fprintf(w, "    %-12s %s%s\n", "--"+kind+"-->", hop.Edge.Func, site)
+		}
+	}
+	if truncated {
+		fmt.Fprintf(w, "\nStopped after %d paths.\n", len(paths))
+	}
+}
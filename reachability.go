@@ -0,0 +1,360 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// nonProdDirs lists path segments whose packages never count as production
+// code (tooling, examples, test fixtures).
+var nonProdDirs = []string{"tools", "examples", "example", "testdata", "test", "tests"}
+
+// isProdPackage reports whether pkgPath is production code: a project
+// package that is neither a test package nor located under a non-production
+// directory.
+func (c *Collector) isProdPackage(pkgPath string) bool {
+	if !c.isProjectPackage(pkgPath) {
+		return false
+	}
+	if isTestPackage(pkgPath) {
+		return false
+	}
+	for _, seg := range strings.Split(c.relPath(pkgPath), "/") {
+		for _, dir := range nonProdDirs {
+			if seg == dir {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// prodEntryPoints returns the functions that seed production reachability:
+// main and init functions of production main packages. Modules without any
+// production main package are libraries, so their exported API is used instead.
+func (c *Collector) prodEntryPoints() []string {
+	var roots []string
+	for _, fn := range c.Funcs {
+		if !c.isProdPackage(fn.Package) {
+			continue
+		}
+		pkg, ok := c.Packages[fn.Package]
+		if !ok || pkg.Name != "main" || fn.IsMethod {
+			continue
+		}
+		if fn.Name == "main" || isInitFunc(fn.Name) {
+			roots = append(roots, fn.FullName)
+		}
+	}
+	if len(roots) > 0 {
+		return roots
+	}
+	for _, fn := range c.Funcs {
+		if c.isProdPackage(fn.Package) && fn.Exported && !isTestFile(fn.File) {
+			roots = append(roots, fn.FullName)
+		}
+	}
+	return roots
+}
+
+// isInitFunc reports whether name is a package initializer as named by SSA
+// ("init" for the synthetic package initializer, "init#N" for user inits).
+func isInitFunc(name string) bool {
+	return name == "init" || strings.HasPrefix(name, "init#")
+}
+
+// reachableFrom walks CALLS edges breadth-first from roots and returns the
+// set of project functions reached, roots included.
+func (c *Collector) reachableFrom(roots []string) map[string]bool {
+	adj := make(map[string][]string)
+	for _, e := range c.Calls {
+		adj[e.CallerFullName] = append(adj[e.CallerFullName], e.CalleeFullName)
+	}
+	// Closures are often invoked only by library code (callbacks), so treat
+	// each anonymous function as reachable from its enclosing function.
+	for name := range c.Funcs {
+		if i := strings.LastIndexByte(name, '$'); i > 0 {
+			adj[name[:i]] = append(adj[name[:i]], name)
+		}
+	}
+
+	seen := make(map[string]bool, len(roots))
+	queue := make([]string, 0, len(roots))
+	for _, r := range roots {
+		if _, ok := c.Funcs[r]; ok && !seen[r] {
+			seen[r] = true
+			queue = append(queue, r)
+		}
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, next := range adj[cur] {
+			if seen[next] {
+				continue
+			}
+			if _, ok := c.Funcs[next]; !ok {
+				continue
+			}
+			seen[next] = true
+			queue = append(queue, next)
+		}
+	}
+	return seen
+}
+
+// MarkProdReachable flags every function reachable from production entry
+// points, and every package containing one, with ProdReachable. It returns
+// the number of reachable functions.
+func (c *Collector) MarkProdReachable() int {
+	reachable := c.reachableFrom(c.prodEntryPoints())
+	n := 0
+	for name, fn := range c.Funcs {
+		fn.ProdReachable = reachable[name] && c.isProdPackage(fn.Package) && !isTestFile(fn.File)
+		if !fn.ProdReachable {
+			continue
+		}
+		n++
+		if pkg, ok := c.Packages[fn.Package]; ok {
+			pkg.ProdReachable = true
+		}
+	}
+	return n
+}
+
+// ResolveRoots turns --roots specs into function full names. A spec is
+// either a package pattern relative to the module root ("cmd/...",
+// "cmd/api"), selecting the main functions of matching main packages (or
+// their exported API when none is a main package), or a function symbol,
+// absolute ("example.com/app/pkg.Type.Method") or module-relative
+// ("pkg.Type.Method").
+func (c *Collector) ResolveRoots(specs []string) ([]string, error) {
+	var roots []string
+	for _, spec := range specs {
+		spec = strings.TrimPrefix(strings.TrimSpace(spec), "./")
+		if spec == "" {
+			continue
+		}
+		if fn, ok := c.lookupFunc(spec); ok {
+			roots = append(roots, fn.FullName)
+			continue
+		}
+		matched := c.packageRoots(spec)
+		if len(matched) == 0 {
+			return nil, fmt.Errorf("root %q matches no function or package", spec)
+		}
+		roots = append(roots, matched...)
+	}
+	return roots, nil
+}
+
+// lookupFunc finds a function by absolute or module-relative full name.
+func (c *Collector) lookupFunc(name string) (*FuncNode, bool) {
+	if fn, ok := c.Funcs[name]; ok {
+		return fn, true
+	}
+	fn, ok := c.Funcs[c.RootModule+"/"+name]
+	return fn, ok
+}
+
+// packageRoots returns the main functions of the main packages matching
+// pattern, or the exported functions of the matching packages if none is
+// a main package.
+func (c *Collector) packageRoots(pattern string) []string {
+	var mains, exported []string
+	for _, fn := range c.Funcs {
+		pkg, ok := c.Packages[fn.Package]
+		if !ok || !c.matchPackage(pattern, fn.Package) || fn.IsMethod && pkg.Name == "main" {
+			continue
+		}
+		if pkg.Name == "main" {
+			if fn.Name == "main" || isInitFunc(fn.Name) {
+				mains = append(mains, fn.FullName)
+			}
+		} else if fn.Exported {
+			exported = append(exported, fn.FullName)
+		}
+	}
+	if len(mains) > 0 {
+		return mains
+	}
+	return exported
+}
+
+// matchPackage reports whether pkgPath matches a module-relative package
+// pattern: "dir" matches exactly, "dir/..." matches dir and everything below.
+func (c *Collector) matchPackage(pattern, pkgPath string) bool {
+	prefix, recursive := strings.CutSuffix(strings.TrimPrefix(pattern, "./"), "...")
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "." {
+		prefix = ""
+	}
+	rel := c.relPath(pkgPath)
+	if recursive {
+		return prefix == "" || rel == prefix || strings.HasPrefix(rel, prefix+"/")
+	}
+	return rel == prefix
+}
+
+// PruneToRoots drops every function not reachable from roots, together with
+// the calls, packages, types and implements edges that no longer belong to
+// the remaining graph.
+func (c *Collector) PruneToRoots(roots []string) {
+	keep := c.reachableFrom(roots)
+
+	keptPkgs := make(map[string]bool)
+	for name, fn := range c.Funcs {
+		if !keep[name] {
+			delete(c.Funcs, name)
+			continue
+		}
+		keptPkgs[fn.Package] = true
+	}
+
+	for p := range c.Packages {
+		if !keptPkgs[p] {
+			delete(c.Packages, p)
+		}
+	}
+	for path, f := range c.Files {
+		if !keptPkgs[f.Package] {
+			delete(c.Files, path)
+		}
+	}
+	for k, s := range c.Structs {
+		if !keptPkgs[s.Package] {
+			delete(c.Structs, k)
+		}
+	}
+	for k, i := range c.Interfaces {
+		if !keptPkgs[i.Package] {
+			delete(c.Interfaces, k)
+		}
+	}
+	for k, t := range c.NamedTypes {
+		if !keptPkgs[t.Package] {
+			delete(c.NamedTypes, k)
+		}
+	}
+	for k, a := range c.Aliases {
+		if !keptPkgs[a.Package] {
+			delete(c.Aliases, k)
+		}
+	}
+	c.pruneEdges()
+}
+
+// pruneEdges drops call edges whose project end was removed from Funcs,
+// external stubs no longer referenced by any call, and implements edges
+// whose type or interface was removed.
+func (c *Collector) pruneEdges() {
+	// An edge survives if neither end is a removed project function.
+	removed := func(name string) bool {
+		_, ok := c.Funcs[name]
+		return !ok && c.isProjectPackage(name)
+	}
+	calls := c.Calls[:0]
+	for _, e := range c.Calls {
+		if !removed(e.CallerFullName) && !removed(e.CalleeFullName) {
+			calls = append(calls, e)
+		}
+	}
+	c.Calls = calls
+
+	referenced := make(map[string]bool)
+	for _, e := range c.Calls {
+		referenced[e.CallerFullName] = true
+		referenced[e.CalleeFullName] = true
+	}
+	for name := range c.ExternalFuncs {
+		if !referenced[name] {
+			delete(c.ExternalFuncs, name)
+		}
+	}
+
+	impls := c.Implements[:0]
+	for _, e := range c.Implements {
+		_, isStruct := c.Structs[e.Struct]
+		_, isNamed := c.NamedTypes[e.Struct]
+		if !isStruct && !isNamed {
+			continue
+		}
+		if _, ok := c.Interfaces[e.Interface]; !ok {
+			continue
+		}
+		impls = append(impls, e)
+	}
+	c.Implements = impls
+
+	endpoints := c.Endpoints[:0]
+	for _, e := range c.Endpoints {
+		if !removed(e.Handler) {
+			endpoints = append(endpoints, e)
+		}
+	}
+	c.Endpoints = endpoints
+
+	queries := c.Queries[:0]
+	for _, q := range c.Queries {
+		if !removed(q.Caller) {
+			queries = append(queries, q)
+		}
+	}
+	c.Queries = queries
+
+	topics := c.Topics[:0]
+	for _, u := range c.Topics {
+		if !removed(u.Func) {
+			topics = append(topics, u)
+		}
+	}
+	c.Topics = topics
+
+	reads := c.ConfigReads[:0]
+	for _, r := range c.ConfigReads {
+		if r.Func == "" || !removed(r.Func) {
+			reads = append(reads, r)
+		}
+	}
+	c.ConfigReads = reads
+
+	outbound := c.Outbound[:0]
+	for _, s := range c.Outbound {
+		if !removed(s.Func) {
+			outbound = append(outbound, s)
+		}
+	}
+	c.Outbound = outbound
+
+	wiring := c.Wiring[:0]
+	for _, e := range c.Wiring {
+		if e.Func == "" || !removed(e.Func) {
+			wiring = append(wiring, e)
+		}
+	}
+	c.Wiring = wiring
+
+	values := c.FuncValues[:0]
+	for _, u := range c.FuncValues {
+		if !removed(u.Holder) && !removed(u.Func) && !removed(u.Callee) {
+			values = append(values, u)
+		}
+	}
+	c.FuncValues = values
+
+	syncUses := c.SyncUses[:0]
+	for _, u := range c.SyncUses {
+		if u.Func == "" || !removed(u.Func) {
+			syncUses = append(syncUses, u)
+		}
+	}
+	c.SyncUses = syncUses
+
+	flows := c.ErrorFlows[:0]
+	for _, f := range c.ErrorFlows {
+		if !removed(f.Caller) && !removed(f.Callee) {
+			flows = append(flows, f)
+		}
+	}
+	c.ErrorFlows = flows
+}
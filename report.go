@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// runReport implements the report subcommand.
+func runReport(args []string) error {
+	cmd := flag.NewFlagSet("report", flag.ExitOnError)
+	dir := cmd.String("dir", ".", "Project root directory")
+	tags := cmd.String("tags", "", "Comma-separated build tags for package loading")
+	format := cmd.String("format", "text", "Output format: text, json or markdown")
+	top := cmd.Int("top", 10, "Rows per ranking")
+	out := cmd.String("out", "", "Write the report to this file instead of stdout")
+	baseline := cmd.String("baseline", "", "Baseline file to compare with, failing only on regressions; with it, the arguments are packages")
+	failOn := cmd.String("fail-on", "new-cycles,new-forbidden-deps,complexity-increase", "Comma-separated regressions failing --baseline: new-cycles, new-forbidden-deps, complexity-increase")
+	update := cmd.Bool("update-baseline", false, "Write the current state to --baseline instead of comparing with it")
+	rulesFile := cmd.String("arch-rules", "", "Architecture rules file whose violations --baseline tracks as forbidden dependencies")
+	entryPoints := cmd.String("entry-points", "main,exported,tests", "Comma-separated dead-code entry point kinds for the html report: main, exported, tests")
+	neo4jURI := cmd.String("neo4j-uri", "bolt://localhost:7687", "Neo4j URI of the api report: bolt:// for one server, neo4j:// to route in a cluster")
+	neo4jUser := cmd.String("neo4j-user", "neo4j", "Neo4j username of the api report")
+	neo4jPass := cmd.String("neo4j-pass", "", "Neo4j password; with it, the api report reads the loaded graph, counting callers from other modules loaded into it")
+	label := cmd.Bool("label", false, "Label the api report's candidates :UnexportCandidate and set api_usage on the exported symbols (requires --neo4j-pass)")
+	graphOpts := addGraphFlags(cmd)
+	cmd.Usage = func() {
+		fmt.Fprintln(cmd.Output(), "Usage: go-callgraph-neo4j report hotspots|html [flags] [packages]")
+		fmt.Fprintln(cmd.Output(), "       go-callgraph-neo4j report api [--neo4j-pass <password> [--label]] [flags]")
+		fmt.Fprintln(cmd.Output(), "       go-callgraph-neo4j report --baseline <baseline.json> [--update-baseline] [flags] [packages]")
+		cmd.PrintDefaults()
+	}
+	pos := parseInterspersed(cmd, args)
+	if *baseline != "" {
+		return runBaselineReport(*dir, *tags, *format, *baseline, *failOn, *rulesFile, *update, pos)
+	}
+	if len(pos) == 0 || (pos[0] != "hotspots" && pos[0] != "html" && pos[0] != "api") || *top < 1 ||
+		(*format != "text" && *format != "json" && *format != "markdown") ||
+		(pos[0] == "api" && (len(pos) > 1 || *label && *neo4jPass == "")) {
+		cmd.Usage()
+		os.Exit(1)
+	}
+	if pos[0] == "api" {
+		return runAPIReport(*neo4jURI, *neo4jUser, *neo4jPass, graphOpts, *dir, *tags, *format, *out, *label)
+	}
+	patterns := pos[1:]
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	kinds, err := parseEntryKinds(*entryPoints)
+	if err != nil {
+		return fmt.Errorf("invalid --entry-points: %w", err)
+	}
+	absDir, err := filepath.Abs(*dir)
+	if err != nil {
+		return err
+	}
+	// Tests are only needed as entry points of the dead code section.
+	tests := pos[0] == "html" && hasEntryKind(kinds, entryTests)
+	collector, err := analyzeInMemory(absDir, *tags, patterns, tests)
+	if err != nil {
+		return err
+	}
+	log.Printf("Generated functions: %d", collector.MarkGenerated())
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("failed to create report: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	h := collector.Hotspots(*top)
+	if pos[0] == "html" {
+		dead := collector.FindDeadCode(kinds)
+		pkgCycles := collector.MarkPackageCycles()
+		recursion := collector.MarkRecursion()
+		log.Printf("Unreachable functions: %d, package cycles: %d, recursive groups: %d", len(dead), len(pkgCycles), len(recursion))
+		if err := collector.WriteHTMLReport(w, h, dead, pkgCycles, recursion); err != nil {
+			return fmt.Errorf("failed to render report: %w", err)
+		}
+	} else {
+		switch *format {
+		case "json":
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(h)
+		case "markdown":
+			WriteHotspotsMarkdown(w, h)
+		default:
+			WriteHotspots(w, h)
+		}
+	}
+	return nil
+}
+
+// runAPIReport implements report api: it prints the API surface of the
+// project analysed in dir, or of the graph loaded into Neo4j if pass is
+// set, and labels the candidates for unexporting with label.
+func runAPIReport(uri, user, pass string, graphOpts *graphFlags, dir, tags, format, out string, label bool) error {
+	names, err := graphOpts.names()
+	if err != nil {
+		return err
+	}
+	g, closeGraph, err := openCallGraph(uri, user, pass, names, *graphOpts.project, dir, tags)
+	if err != nil {
+		return err
+	}
+	defer closeGraph()
+	api, err := g.apiGraph()
+	if err != nil {
+		return err
+	}
+	syms := BuildAPISurface(api)
+	if label {
+		loader, err := openLoader(uri, user, pass, graphOpts)
+		if err != nil {
+			return err
+		}
+		defer loader.Close()
+		if err := loader.LabelUnexportCandidates(syms); err != nil {
+			return err
+		}
+	}
+
+	w := io.Writer(os.Stdout)
+	if out != "" {
+		f, err := os.Create(out)
+		if err != nil {
+			return fmt.Errorf("failed to create report: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(append([]APISymbol{}, syms...))
+	case "markdown":
+		WriteAPISurfaceMarkdown(w, syms)
+	default:
+		WriteAPISurfaceReport(w, syms)
+	}
+	return nil
+}
+
+// runBaselineReport implements report --baseline: it writes the baseline
+// of the project with update, or else prints the regressions against it
+// and exits with status 1 if there are any.
+func runBaselineReport(dir, tags, format, baselinePath, failOn, rulesFile string, update bool, patterns []string) error {
+	kinds, err := parseFailOn(failOn)
+	if err != nil {
+		return fmt.Errorf("invalid --fail-on: %w", err)
+	}
+	var rules []ArchRule
+	if rulesFile != "" {
+		if rules, err = parseArchRules(rulesFile); err != nil {
+			return err
+		}
+	}
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	collector, err := analyzeInMemory(absDir, tags, patterns, false)
+	if err != nil {
+		return err
+	}
+	collector.MarkGenerated()
+	cur := collector.CurrentBaseline(collector.CheckArchRules(rules))
+	if update {
+		if err := WriteBaseline(baselinePath, cur); err != nil {
+			return fmt.Errorf("cannot write baseline: %w", err)
+		}
+		log.Printf("Baseline written to %s: %d package cycles, %d forbidden dependencies, %d functions",
+			baselinePath, len(cur.PackageCycles), len(cur.ForbiddenDeps), len(cur.FuncComplexity))
+		return nil
+	}
+	base, err := ReadBaseline(baselinePath)
+	if err != nil {
+		return err
+	}
+	regs := base.Regressions(cur, kinds)
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(append([]Regression{}, regs...)); err != nil {
+			return err
+		}
+	} else {
+		WriteRegressions(os.Stdout, baselinePath, regs)
+	}
+	if len(regs) > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// Key returns the HttpEndpoint node key: "METHOD path", with ANY for
+// routes that accept every method.
+func (e HTTPEndpoint) Key() string {
+	method := e.Method
+	if method == "" {
+		method = "ANY"
+	}
+	return method + " " + e.Path
+}
+
+// httpMethods are the methods recognized in router method names (gin's
+// GET, chi's Get) and in Go 1.22 net/http patterns ("GET /orders/{id}").
+var httpMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true,
+	"DELETE": true, "CONNECT": true, "OPTIONS": true, "TRACE": true,
+}
+
+// routeFramework returns the router framework a package belongs to, or ""
+// if it is not one whose routes are detected.
+func routeFramework(pkgPath string) string {
+	switch {
+	case pkgPath == "net/http":
+		return "net/http"
+	case strings.HasPrefix(pkgPath, "github.com/go-chi/chi"):
+		return "chi"
+	case strings.HasPrefix(pkgPath, "github.com/gin-gonic/gin"):
+		return "gin"
+	case strings.HasPrefix(pkgPath, "github.com/labstack/echo"):
+		return "echo"
+	case strings.HasPrefix(pkgPath, "github.com/gorilla/mux"):
+		return "gorilla"
+	}
+	return ""
+}
+
+// routeArgs locates the parts of a route registration among the arguments
+// of a router call. method is -1 when the method comes from the function
+// name (verb) or is not given.
+type routeArgs struct {
+	verb        string
+	method      int
+	path        int
+	handler     int
+	lastHandler bool // handlers are variadic and the last one handles the route (gin)
+}
+
+// routeArgsFor returns where the method, path and handler of a route are
+// passed to the router function name of framework, or false if the
+// function does not register routes.
+func routeArgsFor(framework, name string) (routeArgs, bool) {
+	gin := framework == "gin"
+	if verb := strings.ToUpper(name); httpMethods[verb] && (gin || framework == "echo" || framework == "chi") {
+		return routeArgs{verb: verb, method: -1, path: 0, handler: 1, lastHandler: gin}, true
+	}
+	switch {
+	case name == "Any" && (gin || framework == "echo"):
+		return routeArgs{method: -1, path: 0, handler: 1, lastHandler: gin}, true
+	case name == "Handle" && gin, name == "Add" && framework == "echo",
+		(name == "Method" || name == "MethodFunc") && framework == "chi":
+		return routeArgs{method: 0, path: 1, handler: 2, lastHandler: gin}, true
+	case (name == "Handle" || name == "HandleFunc") && !gin && framework != "echo":
+		return routeArgs{method: -1, path: 0, handler: 1}, true
+	}
+	return routeArgs{}, false
+}
+
+// routeCollector detects route registrations in one program.
+type routeCollector struct {
+	*syntaxFuncs
+	c     *Collector
+	sites *callSiteIndex
+}
+
+// collectRoutes detects HTTP route registrations in the project packages
+// among pkgs. Only constant paths are recognized; prefixes added by route
+// groups and subrouters are not resolved.
+func (c *Collector) collectRoutes(funcs *syntaxFuncs, pkgs []*packages.Package, sites *callSiteIndex) {
+	rc := &routeCollector{syntaxFuncs: funcs, c: c, sites: sites}
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if c.isProjectPackage(pkg.PkgPath) && pkg.TypesInfo != nil {
+			for _, file := range pkg.Syntax {
+				rc.file(pkg, file)
+			}
+		}
+	})
+}
+
+// file collects the routes registered in one file.
+func (rc *routeCollector) file(pkg *packages.Package, file *ast.File) {
+	info := pkg.TypesInfo
+	registered := make(map[*ast.CallExpr][]HTTPEndpoint)
+	var order []*ast.CallExpr
+	methods := make(map[*ast.CallExpr][]string) // gorilla registration -> .Methods(...)
+
+	var stack []ast.Node
+	ast.Inspect(file, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		stack = append(stack, n)
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		fn := typeutil.StaticCallee(info, call)
+		if fn == nil {
+			fn, _ = typeutil.Callee(info, call).(*types.Func) // interface methods (chi.Router)
+		}
+		if fn == nil || fn.Pkg() == nil {
+			return true
+		}
+		framework := routeFramework(fn.Pkg().Path())
+		if framework == "" {
+			return true
+		}
+		if framework == "gorilla" && fn.Name() == "Methods" {
+			if sel, ok := ast.Unparen(call.Fun).(*ast.SelectorExpr); ok {
+				if inner, ok := ast.Unparen(sel.X).(*ast.CallExpr); ok {
+					methods[inner] = append(methods[inner], constStrings(info, call.Args)...)
+				}
+			}
+			return true
+		}
+		if e, ok := rc.route(pkg, call, framework, fn.Name(), stack); ok {
+			registered[call] = []HTTPEndpoint{e}
+			order = append(order, call)
+		}
+		return true
+	})
+
+	for _, call := range order {
+		endpoints := registered[call]
+		for _, m := range methods[call] {
+			e := endpoints[0]
+			e.Method = strings.ToUpper(m)
+			rc.c.Endpoints = append(rc.c.Endpoints, e)
+		}
+		if len(methods[call]) == 0 {
+			rc.c.Endpoints = append(rc.c.Endpoints, endpoints...)
+		}
+	}
+}
+
+// route builds the endpoint registered by call, a call of the router
+// function name, if its path is a constant.
+func (rc *routeCollector) route(pkg *packages.Package, call *ast.CallExpr, framework, name string, stack []ast.Node) (HTTPEndpoint, bool) {
+	args, ok := routeArgsFor(framework, name)
+	if !ok || len(call.Args) <= args.handler {
+		return HTTPEndpoint{}, false
+	}
+	info := pkg.TypesInfo
+	path, ok := constString(info, call.Args[args.path])
+	if !ok {
+		return HTTPEndpoint{}, false
+	}
+	e := HTTPEndpoint{Method: args.verb, Path: path, Framework: framework}
+	if args.method >= 0 {
+		m, ok := constString(info, call.Args[args.method])
+		if !ok {
+			return HTTPEndpoint{}, false
+		}
+		e.Method = strings.ToUpper(m)
+	}
+	if framework == "net/http" {
+		// Go 1.22 patterns: "[METHOD ][HOST]/[PATH]".
+		if method, rest, ok := strings.Cut(path, " "); ok && httpMethods[method] {
+			e.Method, e.Path = method, strings.TrimSpace(rest)
+		}
+	}
+
+	handler := call.Args[args.handler]
+	if args.lastHandler {
+		if call.Ellipsis.IsValid() {
+			handler = nil // handlers passed as a slice
+		} else {
+			handler = call.Args[len(call.Args)-1]
+		}
+	}
+	if handler != nil {
+		e.Handler = rc.handler(pkg, handler)
+	}
+	e.Registrar = rc.enclosing(pkg, stack)
+	e.Site = rc.sites.site(rc.c, pkg.Fset, call.Lparen)
+	return e, true
+}
+
+// handler resolves a handler argument to the full name of the function
+// handling the route: a function, method value or function literal, or the
+// ServeHTTP method of a concrete http.Handler. It returns "" if the handler
+// is only known at run time.
+func (rc *routeCollector) handler(pkg *packages.Package, expr ast.Expr) string {
+	info := pkg.TypesInfo
+	expr = ast.Unparen(expr)
+	switch x := expr.(type) {
+	case *ast.FuncLit:
+		return rc.funcLit(x)
+	case *ast.CallExpr:
+		// Conversions such as http.HandlerFunc(f).
+		if tv, ok := info.Types[x.Fun]; ok && tv.IsType() && len(x.Args) == 1 {
+			return rc.handler(pkg, x.Args[0])
+		}
+	case *ast.Ident:
+		if fn, ok := info.Uses[x].(*types.Func); ok && fn.Pkg() != nil {
+			return rc.c.funcFullName(fn.Pkg().Path(), fn)
+		}
+	case *ast.SelectorExpr:
+		if sel, ok := info.Selections[x]; ok {
+			if fn, ok := sel.Obj().(*types.Func); ok && sel.Kind() == types.MethodVal && !types.IsInterface(sel.Recv()) {
+				return rc.c.funcFullName(fn.Pkg().Path(), fn)
+			}
+		} else if fn, ok := info.Uses[x.Sel].(*types.Func); ok && fn.Pkg() != nil {
+			return rc.c.funcFullName(fn.Pkg().Path(), fn) // pkg.Func
+		}
+	}
+
+	// A concrete http.Handler value: its ServeHTTP method handles the route.
+	if tv, ok := info.Types[expr]; ok && tv.Type != nil && !types.IsInterface(tv.Type) {
+		obj, _, _ := types.LookupFieldOrMethod(tv.Type, true, nil, "ServeHTTP")
+		if fn, ok := obj.(*types.Func); ok && fn.Pkg() != nil {
+			return rc.c.funcFullName(fn.Pkg().Path(), fn)
+		}
+	}
+	return ""
+}
+
+// constString returns the value of a constant string expression.
+func constString(info *types.Info, expr ast.Expr) (string, bool) {
+	tv, ok := info.Types[expr]
+	if !ok || tv.Value == nil || tv.Value.Kind() != constant.String {
+		return "", false
+	}
+	return constant.StringVal(tv.Value), true
+}
+
+// constStrings returns the constant string values among exprs.
+func constStrings(info *types.Info, exprs []ast.Expr) []string {
+	var s []string
+	for _, e := range exprs {
+		if v, ok := constString(info, e); ok {
+			s = append(s, v)
+		}
+	}
+	return s
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RuntimeCall is a caller -> callee call observed at run time.
+type RuntimeCall struct {
+	Caller string `json:"caller"`
+	Callee string `json:"callee"`
+	Count  int64  `json:"count"`
+}
+
+// parseCallLog reads an instrumented call log and adds its calls to
+// counts, keyed by caller and callee full name. Each line is either
+// "caller callee [count]" or a JSON object {"caller", "callee", "count"};
+// blank lines and lines starting with '#' are skipped. Names may be given
+// as recorded by the runtime (pkg.(*T).Method.func1) or as graph full
+// names. A missing count means 1. ptrRecv is as for pprofFuncName.
+func parseCallLog(r io.Reader, counts map[[2]string]int64, ptrRecv bool) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var call RuntimeCall
+		if strings.HasPrefix(line, "{") {
+			if err := json.Unmarshal([]byte(line), &call); err != nil {
+				return fmt.Errorf("line %d: %w", lineNo, err)
+			}
+		} else {
+			fields := strings.Fields(line)
+			if len(fields) < 2 || len(fields) > 3 {
+				return fmt.Errorf("line %d: want caller callee [count]", lineNo)
+			}
+			call.Caller, call.Callee = fields[0], fields[1]
+			if len(fields) == 3 {
+				n, err := strconv.ParseInt(fields[2], 10, 64)
+				if err != nil {
+					return fmt.Errorf("line %d: bad count: %w", lineNo, err)
+				}
+				call.Count = n
+			}
+		}
+		if call.Caller == "" || call.Callee == "" {
+			return fmt.Errorf("line %d: caller and callee are required", lineNo)
+		}
+		if call.Count == 0 {
+			call.Count = 1
+		}
+		counts[[2]string{pprofFuncName(call.Caller, ptrRecv), pprofFuncName(call.Callee, ptrRecv)}] += call.Count
+	}
+	return sc.Err()
+}
+
+// runtimeCalls turns call counts into RuntimeCalls, most frequent first.
+func runtimeCalls(counts map[[2]string]int64) []RuntimeCall {
+	calls := make([]RuntimeCall, 0, len(counts))
+	for pair, n := range counts {
+		calls = append(calls, RuntimeCall{Caller: pair[0], Callee: pair[1], Count: n})
+	}
+	sort.Slice(calls, func(i, j int) bool { return calls[i].Count > calls[j].Count })
+	return calls
+}
+
+// runRuntimeCalls implements the `runtime-calls` subcommand: it imports a
+// call log into an already loaded graph as RUNTIME_CALLS edges.
+func runRuntimeCalls(args []string) error {
+	cmd := flag.NewFlagSet("runtime-calls", flag.ExitOnError)
+	neo4jURI := cmd.String("neo4j-uri", "bolt://localhost:7687", "Neo4j URI: bolt:// for one server, neo4j:// to route in a cluster")
+	neo4jUser := cmd.String("neo4j-user", "neo4j", "Neo4j username")
+	neo4jPass := cmd.String("neo4j-pass", "", "Neo4j password")
+	replace := cmd.Bool("replace", false, "Delete existing RUNTIME_CALLS edges before importing instead of adding to their counts")
+	ptrRecv := cmd.Bool("pointer-receiver-names", false, "Match a graph loaded with --pointer-receiver-names")
+	graphOpts := addGraphFlags(cmd)
+	cmd.Usage = func() {
+		fmt.Fprintln(cmd.Output(), "Usage: go-callgraph-neo4j runtime-calls [flags] <call log>...")
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+	if *neo4jPass == "" || cmd.NArg() == 0 {
+		cmd.Usage()
+		os.Exit(1)
+	}
+
+	counts := make(map[[2]string]int64)
+	for _, path := range cmd.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("cannot open call log: %w", err)
+		}
+		err = parseCallLog(f, counts, *ptrRecv)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	calls := runtimeCalls(counts)
+	log.Printf("Parsed %d distinct runtime calls", len(calls))
+
+	loader, err := openLoader(*neo4jURI, *neo4jUser, *neo4jPass, graphOpts)
+	if err != nil {
+		return err
+	}
+	defer loader.Close()
+	return loader.LoadRuntimeCalls(calls, *replace)
+}
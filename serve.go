@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxGraphQLPage caps the first argument of list fields.
+const maxGraphQLPage = 1000
+
+// maxGraphQLBody caps the size of a POSTed GraphQL request.
+const maxGraphQLBody = 1 << 20
+
+// Timeouts of the GraphQL server, so that slow clients cannot hold its
+// connections: reading the headers, reading the whole request, and
+// writing the response, which includes running the query.
+const (
+	graphQLReadHeaderTimeout = 10 * time.Second
+	graphQLReadTimeout       = 30 * time.Second
+	graphQLWriteTimeout      = 2 * time.Minute
+)
+
+// gqlFuncProjection returns the properties of the GoFunc f read by the
+// Function type, with whether it is external.
+const gqlFuncProjection = "f {.*, external: f:External}"
+
+// newGraphQLSchema returns the GraphQL schema of the call graph read by r.
+func newGraphQLSchema(r *neo4jReader) *gqlSchema {
+	s := newGQLSchema()
+	page := func(args map[string]any) (int64, int64) {
+		first, _ := args["first"].(int64)
+		offset, _ := args["offset"].(int64)
+		return min(max(first, 0), maxGraphQLPage), max(offset, 0)
+	}
+	// rows runs a query returning one map per record in column key.
+	rows := func(cypher string, params map[string]any, key string) ([]any, error) {
+		recs, err := r.read(cypher, params)
+		if err != nil {
+			return nil, err
+		}
+		list := make([]any, 0, len(recs))
+		for _, rec := range recs {
+			v, _ := rec.Get(key)
+			list = append(list, v)
+		}
+		return list, nil
+	}
+	// one runs a query returning at most one map in column key.
+	one := func(cypher string, params map[string]any, key string) (any, error) {
+		list, err := rows(cypher, params, key)
+		if err != nil || len(list) == 0 {
+			return nil, err
+		}
+		return list[0], nil
+	}
+	prop := func(parent any, name string) any {
+		props, _ := parent.(map[string]any)
+		return props[name]
+	}
+	function := func(name any) (any, error) {
+		return one(`MATCH (f:GoFunc {full_name: $name}) WHERE f.deleted IS NULL
+			 RETURN `+gqlFuncProjection+` AS f LIMIT 1`, map[string]any{"name": name}, "f")
+	}
+	pkg := func(path any) (any, error) {
+		return one(`MATCH (p:GoPackage {import_path: $path}) WHERE p.deleted IS NULL RETURN p {.*} AS p`,
+			map[string]any{"path": path}, "p")
+	}
+	calls := func(reverse bool) func(context.Context, any, map[string]any) (any, error) {
+		pattern := "(:GoFunc {full_name: $name})-[r:ACCURATE_CALLS|CALLS_EXTERNAL]->(f:GoFunc)"
+		if reverse {
+			pattern = "(:GoFunc {full_name: $name})<-[r:ACCURATE_CALLS|CALLS_EXTERNAL]-(f:GoFunc)"
+		}
+		return func(_ context.Context, parent any, args map[string]any) (any, error) {
+			first, offset := page(args)
+			return rows(`MATCH `+pattern+`
+				 WHERE f.deleted IS NULL
+				 RETURN {function: `+gqlFuncProjection+`, dynamic: coalesce(r.is_dynamic, false),
+				         external: type(r) = 'CALLS_EXTERNAL', count: r.call_count, sites: coalesce(r.sites, [])} AS call
+				 ORDER BY f.full_name SKIP $offset LIMIT $first`,
+				map[string]any{"name": prop(parent, "full_name"), "first": first, "offset": offset}, "call")
+		}
+	}
+	pageArgs := []gqlArg{
+		{name: "first", typ: "Int", def: int64(100), doc: "Most items to return, up to 1000"},
+		{name: "offset", typ: "Int", def: int64(0), doc: "Items to skip"},
+	}
+	withPage := func(args ...gqlArg) []gqlArg { return append(args, pageArgs...) }
+
+	s.object("Function", "A Go function or method, of the project or of a dependency (external).",
+		&gqlField{name: "fullName", typ: "String!", prop: "full_name", doc: "package.Receiver.Method or package.Func"},
+		&gqlField{name: "name", typ: "String"},
+		&gqlField{name: "packagePath", typ: "String", prop: "package"},
+		&gqlField{name: "package", typ: "Package", doc: "Null for dependency packages",
+			resolve: func(_ context.Context, parent any, _ map[string]any) (any, error) {
+				if p := prop(parent, "package"); p != nil {
+					return pkg(p)
+				}
+				return nil, nil
+			}},
+		&gqlField{name: "external", typ: "Boolean!"},
+		&gqlField{name: "file", typ: "String"},
+		&gqlField{name: "line", typ: "Int"},
+		&gqlField{name: "endLine", typ: "Int", prop: "end_line"},
+		&gqlField{name: "signature", typ: "String"},
+		&gqlField{name: "doc", typ: "String"},
+		&gqlField{name: "exported", typ: "Boolean"},
+		&gqlField{name: "isMethod", typ: "Boolean", prop: "is_method"},
+		&gqlField{name: "receiver", typ: "String"},
+		&gqlField{name: "loc", typ: "Int"},
+		&gqlField{name: "statements", typ: "Int"},
+		&gqlField{name: "complexity", typ: "Int"},
+		&gqlField{name: "prodReachable", typ: "Boolean", prop: "prod_reachable"},
+		&gqlField{name: "deprecated", typ: "Boolean"},
+		&gqlField{name: "generated", typ: "Boolean"},
+		&gqlField{name: "coveredPct", typ: "Float", prop: "covered_pct"},
+		&gqlField{name: "callers", typ: "[Call!]!", args: withPage(), resolve: calls(true), doc: "Calls to the function"},
+		&gqlField{name: "callees", typ: "[Call!]!", args: withPage(), resolve: calls(false), doc: "Calls the function makes"},
+	)
+	s.object("Call", "The calls from one function to another.",
+		&gqlField{name: "function", typ: "Function!", doc: "The caller of callers, the callee of callees"},
+		&gqlField{name: "dynamic", typ: "Boolean!", doc: "Dispatched through an interface or function value at one or more sites"},
+		&gqlField{name: "external", typ: "Boolean!", doc: "The callee is a dependency function"},
+		&gqlField{name: "count", typ: "Int", doc: "Number of call sites"},
+		&gqlField{name: "sites", typ: "[String!]!", doc: "file:line of each call site"},
+	)
+	s.object("Package", "A project package.",
+		&gqlField{name: "importPath", typ: "String!", prop: "import_path"},
+		&gqlField{name: "name", typ: "String"},
+		&gqlField{name: "dir", typ: "String"},
+		&gqlField{name: "module", typ: "String"},
+		&gqlField{name: "loc", typ: "Int"},
+		&gqlField{name: "fileCount", typ: "Int", prop: "file_count"},
+		&gqlField{name: "layer", typ: "String"},
+		&gqlField{name: "prodReachable", typ: "Boolean", prop: "prod_reachable"},
+		&gqlField{name: "generated", typ: "Boolean"},
+		&gqlField{name: "functions", typ: "[Function!]!", args: withPage(),
+			resolve: func(_ context.Context, parent any, args map[string]any) (any, error) {
+				first, offset := page(args)
+				return rows(`MATCH (f:GoFunc)-[:IN_PACKAGE]->(:GoPackage {import_path: $path})
+					 WHERE f.deleted IS NULL
+					 RETURN `+gqlFuncProjection+` AS f ORDER BY f.full_name SKIP $offset LIMIT $first`,
+					map[string]any{"path": prop(parent, "import_path"), "first": first, "offset": offset}, "f")
+			}},
+	)
+	s.object("Interface", "A Go interface of the project.",
+		&gqlField{name: "fullName", typ: "String!", prop: "key", doc: "package.Name"},
+		&gqlField{name: "name", typ: "String"},
+		&gqlField{name: "packagePath", typ: "String", prop: "package"},
+		&gqlField{name: "file", typ: "String"},
+		&gqlField{name: "line", typ: "Int"},
+		&gqlField{name: "methodCount", typ: "Int", prop: "method_count"},
+		&gqlField{name: "implementations", typ: "[Implementation!]!",
+			resolve: func(_ context.Context, parent any, _ map[string]any) (any, error) {
+				key, _ := prop(parent, "key").(string)
+				impls, err := r.implementations(key)
+				if err != nil {
+					return nil, err
+				}
+				list := make([]any, len(impls))
+				for i, e := range impls {
+					methods := make([]any, len(e.Methods))
+					for j, m := range e.Methods {
+						method := map[string]any{"name": m}
+						if j < len(e.MethodFuncs) {
+							method["function_name"] = e.MethodFuncs[j]
+						}
+						methods[j] = method
+					}
+					list[i] = map[string]any{"type": e.Struct, "pointer": e.Receiver == "pointer", "methods": methods}
+				}
+				return list, nil
+			}},
+	)
+	s.object("Implementation", "A type implementing an interface.",
+		&gqlField{name: "type", typ: "String!", doc: "package.Name of the struct or named type"},
+		&gqlField{name: "pointer", typ: "Boolean!", doc: "Only the pointer type implements the interface"},
+		&gqlField{name: "methods", typ: "[ImplementedMethod!]!"},
+	)
+	s.object("ImplementedMethod", "An interface method and the function implementing it.",
+		&gqlField{name: "name", typ: "String!"},
+		&gqlField{name: "function", typ: "Function",
+			resolve: func(_ context.Context, parent any, _ map[string]any) (any, error) {
+				if name := prop(parent, "function_name"); name != nil && name != "" {
+					return function(name)
+				}
+				return nil, nil
+			}},
+	)
+
+	search := gqlArg{name: "search", typ: "String", doc: "Case-insensitive substring of the full name"}
+	query := s.object("Query", "",
+		&gqlField{name: "function", typ: "Function", args: []gqlArg{{name: "fullName", typ: "String!"}},
+			resolve: func(_ context.Context, _ any, args map[string]any) (any, error) {
+				return function(args["fullName"])
+			}},
+		&gqlField{name: "functions", typ: "[Function!]!", doc: "Functions by full name",
+			args: withPage(search, gqlArg{name: "package", typ: "String", doc: "Import path of their package"}),
+			resolve: func(_ context.Context, _ any, args map[string]any) (any, error) {
+				first, offset := page(args)
+				return rows(`MATCH (f:GoFunc)
+					 WHERE f.deleted IS NULL AND f.full_name IS NOT NULL
+					   AND ($search IS NULL OR toLower(f.full_name) CONTAINS toLower($search))
+					   AND ($package IS NULL OR f.package = $package)
+					 RETURN `+gqlFuncProjection+` AS f ORDER BY f.full_name SKIP $offset LIMIT $first`,
+					map[string]any{"search": args["search"], "package": args["package"], "first": first, "offset": offset}, "f")
+			}},
+		&gqlField{name: "package", typ: "Package", args: []gqlArg{{name: "importPath", typ: "String!"}},
+			resolve: func(_ context.Context, _ any, args map[string]any) (any, error) {
+				return pkg(args["importPath"])
+			}},
+		&gqlField{name: "packages", typ: "[Package!]!", doc: "Project packages by import path", args: withPage(search),
+			resolve: func(_ context.Context, _ any, args map[string]any) (any, error) {
+				first, offset := page(args)
+				return rows(`MATCH (p:GoPackage)
+					 WHERE p.deleted IS NULL AND ($search IS NULL OR toLower(p.import_path) CONTAINS toLower($search))
+					 RETURN p {.*} AS p ORDER BY p.import_path SKIP $offset LIMIT $first`,
+					map[string]any{"search": args["search"], "first": first, "offset": offset}, "p")
+			}},
+		&gqlField{name: "interface", typ: "Interface", args: []gqlArg{{name: "fullName", typ: "String!"}},
+			resolve: func(_ context.Context, _ any, args map[string]any) (any, error) {
+				return one(`MATCH (i:GoInterface {key: $key}) WHERE i.deleted IS NULL RETURN i {.*} AS i LIMIT 1`,
+					map[string]any{"key": args["fullName"]}, "i")
+			}},
+		&gqlField{name: "interfaces", typ: "[Interface!]!", doc: "Project interfaces by full name", args: withPage(search),
+			resolve: func(_ context.Context, _ any, args map[string]any) (any, error) {
+				first, offset := page(args)
+				return rows(`MATCH (i:GoInterface)
+					 WHERE i.deleted IS NULL AND ($search IS NULL OR toLower(i.key) CONTAINS toLower($search))
+					 RETURN i {.*} AS i ORDER BY i.key SKIP $offset LIMIT $first`,
+					map[string]any{"search": args["search"], "first": first, "offset": offset}, "i")
+			}},
+	)
+	s.setQuery(query)
+	return s
+}
+
+// graphQLHandler serves GraphQL requests on schema: POST of a JSON body
+// or GET with query parameters, as in GraphQL over HTTP. GET of
+// /graphql/schema returns the schema in SDL.
+func graphQLHandler(schema *gqlSchema) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/graphql/schema", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, schema.SDL())
+	})
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Query         string         `json:"query"`
+			OperationName string         `json:"operationName"`
+			Variables     map[string]any `json:"variables"`
+		}
+		switch req.Method {
+		case http.MethodPost:
+			if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxGraphQLBody)).Decode(&body); err != nil {
+				if tooLarge := (*http.MaxBytesError)(nil); errors.As(err, &tooLarge) {
+					http.Error(w, fmt.Sprintf("request body larger than %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+					return
+				}
+				http.Error(w, "invalid JSON body: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		case http.MethodGet:
+			q := req.URL.Query()
+			body.Query, body.OperationName = q.Get("query"), q.Get("operationName")
+			if v := q.Get("variables"); v != "" {
+				if err := json.Unmarshal([]byte(v), &body.Variables); err != nil {
+					http.Error(w, "invalid variables: "+err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if strings.TrimSpace(body.Query) == "" {
+			http.Error(w, "missing query", http.StatusBadRequest)
+			return
+		}
+		resp := schema.Execute(req.Context(), body.Query, body.OperationName, body.Variables)
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Printf("Warning: cannot write GraphQL response: %v", err)
+		}
+	})
+	return mux
+}
+
+// runServe implements the serve subcommand.
+func runServe(args []string) error {
+	cmd := flag.NewFlagSet("serve", flag.ExitOnError)
+	neo4jURI := cmd.String("neo4j-uri", "bolt://localhost:7687", "Neo4j URI: bolt:// for one server, neo4j:// to route in a cluster")
+	neo4jUser := cmd.String("neo4j-user", "neo4j", "Neo4j username")
+	neo4jPass := cmd.String("neo4j-pass", "", "Neo4j password")
+	addr := cmd.String("addr", ":8080", "Address to listen on")
+	graphql := cmd.Bool("graphql", false, "Serve a GraphQL API over the loaded graph at /graphql, its schema at /graphql/schema")
+	graphOpts := addGraphFlags(cmd)
+	cmd.Usage = func() {
+		fmt.Fprintln(cmd.Output(), "Usage: go-callgraph-neo4j serve --graphql --neo4j-pass <password> [flags]")
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+	if *neo4jPass == "" || !*graphql || cmd.NArg() > 0 {
+		cmd.Usage()
+		os.Exit(1)
+	}
+	names, err := graphOpts.names()
+	if err != nil {
+		return err
+	}
+	loader, err := NewNeo4jLoader(context.Background(), *neo4jURI, *neo4jUser, *neo4jPass)
+	if err != nil {
+		return err
+	}
+	defer loader.Close()
+	reader := newNeo4jReader(loader, names, *graphOpts.project)
+	log.Printf("Serving GraphQL at http://%s/graphql", displayAddr(*addr))
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           graphQLHandler(newGraphQLSchema(reader)),
+		ReadHeaderTimeout: graphQLReadHeaderTimeout,
+		ReadTimeout:       graphQLReadTimeout,
+		WriteTimeout:      graphQLWriteTimeout,
+	}
+	return srv.ListenAndServe()
+}
+
+// displayAddr returns a listen address as a host:port to browse to.
+func displayAddr(addr string) string {
+	if strings.HasPrefix(addr, ":") {
+		return "localhost" + addr
+	}
+	return addr
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"regexp"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// Protocols of a ServiceCall.
+const (
+	protocolGRPC = "grpc"
+	protocolHTTP = "http"
+)
+
+// Key identifies the call target within the calling function.
+func (s ServiceCall) Key() string {
+	if s.Protocol == protocolGRPC {
+		return s.Target
+	}
+	return s.Method + " " + s.Path
+}
+
+// collectServiceCalls records the calls project functions make to other
+// services: calls of generated gRPC client methods, found through clients
+// (client interface type key -> service), and HTTP requests whose URL has
+// a constant path.
+func (c *Collector) collectServiceCalls(funcs *syntaxFuncs, pkgs []*packages.Package, sites *callSiteIndex, clients map[string]*GRPCService) {
+	index := make(map[string]int) // func|protocol|key -> position in c.Outbound
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if !c.isProjectPackage(pkg.PkgPath) || pkg.TypesInfo == nil {
+			return
+		}
+		info := pkg.TypesInfo
+		for _, file := range pkg.Syntax {
+			var stack []ast.Node
+			ast.Inspect(file, func(n ast.Node) bool {
+				if n == nil {
+					stack = stack[:len(stack)-1]
+					return true
+				}
+				stack = append(stack, n)
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				fn, _ := typeutil.Callee(info, call).(*types.Func)
+				if fn == nil {
+					return true
+				}
+				sc, ok := grpcClientCall(fn, clients)
+				if !ok {
+					sc, ok = httpClientCall(info, call, fn)
+				}
+				if !ok {
+					return true
+				}
+				sc.Func = funcs.enclosing(pkg, stack)
+				site := sites.site(c, pkg.Fset, call.Lparen)
+				key := sc.Func + "|" + sc.Protocol + "|" + sc.Key()
+				if i, ok := index[key]; ok {
+					c.Outbound[i].Sites = append(c.Outbound[i].Sites, site)
+					return true
+				}
+				sc.Sites = []CallSite{site}
+				index[key] = len(c.Outbound)
+				c.Outbound = append(c.Outbound, sc)
+				return true
+			})
+		}
+	})
+	for i := range c.Outbound {
+		sortSites(c.Outbound[i].Sites)
+	}
+}
+
+// grpcClientCall reports the RPC called by a call of fn, a method of a
+// generated client interface.
+func grpcClientCall(fn *types.Func, clients map[string]*GRPCService) (ServiceCall, bool) {
+	recv := fn.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return ServiceCall{}, false
+	}
+	svc, ok := clients[typeKeyOf(recv.Type())]
+	if !ok {
+		return ServiceCall{}, false
+	}
+	for _, m := range svc.Methods {
+		if m.Name == fn.Name() {
+			return ServiceCall{Protocol: protocolGRPC, Target: m.FullMethod(svc.Name)}, true
+		}
+	}
+	return ServiceCall{}, false
+}
+
+// httpClientCall reports the request made by a call of fn if it is an
+// HTTP client function (net/http, resty) and its URL has a constant path.
+func httpClientCall(info *types.Info, call *ast.CallExpr, fn *types.Func) (ServiceCall, bool) {
+	if fn.Pkg() == nil {
+		return ServiceCall{}, false
+	}
+	method, methodArg, urlArg := "", -1, -1
+	switch path, name := fn.Pkg().Path(), fn.Name(); {
+	case path == "net/http" && (name == "Get" || name == "Head" || name == "Post" || name == "PostForm"):
+		method, urlArg = strings.ToUpper(strings.TrimSuffix(name, "Form")), 0
+	case path == "net/http" && name == "NewRequest":
+		methodArg, urlArg = 0, 1
+	case path == "net/http" && name == "NewRequestWithContext":
+		methodArg, urlArg = 1, 2
+	case strings.HasPrefix(path, "github.com/go-resty/resty") && name == "Execute":
+		methodArg, urlArg = 0, 1
+	case strings.HasPrefix(path, "github.com/go-resty/resty") && httpMethods[strings.ToUpper(name)]:
+		method, urlArg = strings.ToUpper(name), 0
+	default:
+		return ServiceCall{}, false
+	}
+	if urlArg >= len(call.Args) {
+		return ServiceCall{}, false
+	}
+	if methodArg >= 0 {
+		if m, ok := constString(info, call.Args[methodArg]); ok {
+			method = strings.ToUpper(m)
+		}
+	}
+	path, ok := urlPath(urlTemplate(info, call.Args[urlArg]))
+	if !ok {
+		return ServiceCall{}, false
+	}
+	return ServiceCall{Protocol: protocolHTTP, Method: method, Path: path}, true
+}
+
+// printfVerb matches a fmt verb with its flags, width and precision.
+var printfVerb = regexp.MustCompile(`%[-+# 0-9.*\[\]]*[a-zA-Z%]`)
+
+// urlTemplate returns the text of a URL expression with {} standing for
+// the parts only known at run time. Constants, concatenations and
+// fmt.Sprintf calls with a constant format are followed.
+func urlTemplate(info *types.Info, expr ast.Expr) string {
+	expr = ast.Unparen(expr)
+	if s, ok := constString(info, expr); ok {
+		return s
+	}
+	switch x := expr.(type) {
+	case *ast.BinaryExpr:
+		if x.Op == token.ADD {
+			return strings.ReplaceAll(urlTemplate(info, x.X)+urlTemplate(info, x.Y), "{}{}", "{}")
+		}
+	case *ast.CallExpr:
+		if fn, ok := typeutil.Callee(info, x).(*types.Func); ok && fn.Pkg() != nil && fn.Pkg().Path() == "fmt" && fn.Name() == "Sprintf" && len(x.Args) > 0 {
+			if format, ok := constString(info, x.Args[0]); ok {
+				return printfVerb.ReplaceAllStringFunc(format, func(verb string) string {
+					if verb == "%%" {
+						return "%"
+					}
+					return "{}"
+				})
+			}
+		}
+	}
+	return "{}"
+}
+
+// urlPath returns the path of a URL template, dropping the scheme and host
+// or a leading base URL known only at run time, and the query. It reports
+// false if the path has no constant segment to match routes by.
+func urlPath(tmpl string) (string, bool) {
+	if _, rest, ok := strings.Cut(tmpl, "://"); ok {
+		i := strings.Index(rest, "/")
+		if i < 0 {
+			return "", false
+		}
+		tmpl = rest[i:]
+	}
+	tmpl = strings.TrimPrefix(tmpl, "{}") // base URL
+	if i := strings.IndexAny(tmpl, "?#"); i >= 0 {
+		tmpl = tmpl[:i]
+	}
+	if !strings.HasPrefix(tmpl, "/") || strings.Trim(tmpl, "/{}") == "" {
+		return "", false
+	}
+	return tmpl, true
+}
+
+// routeTemplate normalizes a route path for matching request paths:
+// parameters ({id}, {path...}, :id) and wildcards (*, *path) become {}.
+func routeTemplate(path string) string {
+	segs := strings.Split(path, "/")
+	for i, s := range segs {
+		if strings.HasPrefix(s, ":") || strings.HasPrefix(s, "*") || (strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}")) {
+			segs[i] = "{}"
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+// pathPattern returns the regular expression matching the route templates
+// (see routeTemplate) that a request path template can reach: {} matches
+// within a segment, and constant segments also match route parameters.
+func pathPattern(path string) string {
+	segs := strings.Split(strings.TrimSuffix(path, "/"), "/")
+	for i, s := range segs {
+		switch {
+		case s == "{}":
+			segs[i] = `[^/]+`
+		case strings.Contains(s, "{}"):
+			parts := strings.Split(s, "{}")
+			for j, p := range parts {
+				parts[j] = regexp.QuoteMeta(p)
+			}
+			segs[i] = strings.Join(parts, `[^/]*`)
+		case s != "":
+			segs[i] = `(?:` + regexp.QuoteMeta(s) + `|\{\})`
+		}
+	}
+	return strings.Join(segs, "/") + "/?"
+}
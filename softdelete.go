@@ -0,0 +1,56 @@
+package main
+
+// LiveNodes lists the nodes of one label written by a load, by the values
+// of their key property. Package is the property holding the import path
+// of the package of a node.
+type LiveNodes struct {
+	Label, Key, Package string
+	Values              []string
+}
+
+// LiveNodes returns the packages, files, functions and types of the
+// analysis as the loader keys them, for telling those of earlier loads
+// that are gone.
+func (c *Collector) LiveNodes() []LiveNodes {
+	pkgs := LiveNodes{Label: "GoPackage", Key: "import_path", Package: "import_path"}
+	for _, p := range c.Packages {
+		pkgs.Values = append(pkgs.Values, p.ImportPath)
+	}
+	files := LiveNodes{Label: "GoFile", Key: "path", Package: "package"}
+	for _, f := range c.Files {
+		files.Values = append(files.Values, f.Path)
+	}
+	funcs := LiveNodes{Label: "GoFunc", Key: "id", Package: "package"}
+	for _, fn := range c.Funcs {
+		funcs.Values = append(funcs.Values, funcID(fn.FullName))
+	}
+	for _, fn := range c.ExternalFuncs {
+		funcs.Values = append(funcs.Values, funcID(fn.FullName))
+	}
+	live := []LiveNodes{pkgs, files, funcs}
+	for _, t := range []struct {
+		label string
+		keys  []string
+	}{
+		{"GoStruct", keysOf(c.Structs)},
+		{"GoInterface", keysOf(c.Interfaces)},
+		{"GoNamedType", keysOf(c.NamedTypes)},
+		{"GoAlias", keysOf(c.Aliases)},
+	} {
+		types := LiveNodes{Label: t.label, Key: "id", Package: "package"}
+		for _, key := range t.keys {
+			types.Values = append(types.Values, typeID(key))
+		}
+		live = append(live, types)
+	}
+	return live
+}
+
+// keysOf returns the keys of m.
+func keysOf[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
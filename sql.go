@@ -0,0 +1,343 @@
+package main
+
+import (
+	"go/ast"
+	"go/types"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// sqlDriver returns the database library a package belongs to, or "" if
+// it is not one whose queries are detected.
+func sqlDriver(pkgPath string) string {
+	switch {
+	case pkgPath == "database/sql":
+		return "database/sql"
+	case strings.HasPrefix(pkgPath, "github.com/jmoiron/sqlx"):
+		return "sqlx"
+	case strings.HasPrefix(pkgPath, "github.com/jackc/pgx"):
+		return "pgx"
+	}
+	return ""
+}
+
+// sqlMethods are the functions and methods taking a statement to execute,
+// in database/sql and the libraries mirroring it (sqlx, pgx), and in
+// project interfaces abstracting over them such as sqlc's DBTX.
+var sqlMethods = map[string]bool{
+	"Query": true, "QueryContext": true, "QueryRow": true, "QueryRowContext": true,
+	"Exec": true, "ExecContext": true, "Prepare": true, "PrepareContext": true,
+	// sqlx
+	"Get": true, "GetContext": true, "Select": true, "SelectContext": true,
+	"Queryx": true, "QueryxContext": true, "QueryRowx": true, "QueryRowxContext": true,
+	"NamedExec": true, "NamedExecContext": true, "NamedQuery": true, "NamedQueryContext": true,
+	"MustExec": true, "MustExecContext": true, "Preparex": true, "PreparexContext": true,
+	"PrepareNamed": true, "PrepareNamedContext": true,
+	// pgx
+	"Queue": true,
+}
+
+// sqlQueryParam returns the index of the statement parameter of a query
+// function: the string parameter named query or sql, or else the first
+// string parameter. It returns -1 if there is none.
+func sqlQueryParam(sig *types.Signature) int {
+	first := -1
+	for i := 0; i < sig.Params().Len(); i++ {
+		p := sig.Params().At(i)
+		if b, ok := p.Type().(*types.Basic); !ok || b.Kind() != types.String {
+			continue
+		}
+		if p.Name() == "query" || p.Name() == "sql" {
+			return i
+		}
+		if first < 0 {
+			first = i
+		}
+	}
+	return first
+}
+
+// collectQueries records the constant SQL statements executed in the
+// project packages among pkgs, one SQLQuery per statement and function.
+func (c *Collector) collectQueries(funcs *syntaxFuncs, pkgs []*packages.Package, sites *callSiteIndex) {
+	index := make(map[[2]string]int) // caller, text -> position in c.Queries
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if !c.isProjectPackage(pkg.PkgPath) || pkg.TypesInfo == nil {
+			return
+		}
+		info := pkg.TypesInfo
+		for _, file := range pkg.Syntax {
+			var stack []ast.Node
+			ast.Inspect(file, func(n ast.Node) bool {
+				if n == nil {
+					stack = stack[:len(stack)-1]
+					return true
+				}
+				stack = append(stack, n)
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				fn, _ := typeutil.Callee(info, call).(*types.Func)
+				if fn == nil || fn.Pkg() == nil || !sqlMethods[fn.Name()] {
+					return true
+				}
+				sig := fn.Type().(*types.Signature)
+				driver := sqlDriver(fn.Pkg().Path())
+				if driver == "" && (sig.Recv() == nil || !types.IsInterface(sig.Recv().Type()) || !c.isProjectPackage(fn.Pkg().Path())) {
+					return true
+				}
+				i := sqlQueryParam(sig)
+				if i < 0 || i >= len(call.Args) || (sig.Variadic() && i == sig.Params().Len()-1) {
+					return true
+				}
+				raw, ok := constString(info, call.Args[i])
+				if !ok {
+					return true
+				}
+				text := sqlText(raw)
+				if text == "" {
+					return true
+				}
+				caller := funcs.enclosing(pkg, stack)
+				site := sites.site(c, pkg.Fset, call.Lparen)
+				key := [2]string{caller, text}
+				if j, ok := index[key]; ok {
+					c.Queries[j].Sites = append(c.Queries[j].Sites, site)
+					return true
+				}
+				q := parseSQL(raw)
+				q.Text, q.Caller, q.Driver, q.Sites = text, caller, driver, []CallSite{site}
+				index[key] = len(c.Queries)
+				c.Queries = append(c.Queries, q)
+				return true
+			})
+		}
+	})
+	for i := range c.Queries {
+		sortSites(c.Queries[i].Sites)
+	}
+}
+
+// sqlText returns the text stored for a statement: lines holding only a
+// comment dropped, so that the rest survives collapsing the white space.
+func sqlText(raw string) string {
+	var lines []string
+	for _, line := range strings.Split(raw, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(strings.Fields(strings.Join(lines, "\n")), " ")
+}
+
+// sqlcName matches the query name comment that sqlc puts at the start of
+// generated statements.
+var sqlcName = regexp.MustCompile(`^\s*--\s*name:\s*(\w+)`)
+
+// sqlStatements are the keywords starting a statement; the first one
+// outside parentheses gives the statement kind.
+var sqlStatements = map[string]bool{
+	"SELECT": true, "INSERT": true, "UPDATE": true, "DELETE": true, "MERGE": true, "UPSERT": true,
+	"REPLACE": true, "CREATE": true, "ALTER": true, "DROP": true, "TRUNCATE": true, "COPY": true,
+}
+
+// sqlKeywords are the keywords that can follow a table name, so they are
+// not taken for its alias, or that precede a parenthesis without making it
+// a function call.
+var sqlKeywords = map[string]bool{
+	"WHERE": true, "JOIN": true, "INNER": true, "LEFT": true, "RIGHT": true, "FULL": true,
+	"OUTER": true, "CROSS": true, "NATURAL": true, "LATERAL": true, "ON": true, "USING": true,
+	"GROUP": true, "ORDER": true, "HAVING": true, "LIMIT": true, "OFFSET": true, "FETCH": true,
+	"WINDOW": true, "UNION": true, "INTERSECT": true, "EXCEPT": true, "FOR": true, "SET": true,
+	"VALUES": true, "SELECT": true, "RETURNING": true, "DEFAULT": true, "AS": true, "WHEN": true,
+	"IN": true, "EXISTS": true, "ANY": true, "ALL": true, "SOME": true, "NOT": true, "AND": true,
+	"OR": true, "FROM": true, "WITH": true, "DO": true, "CONFLICT": true, "OUTPUT": true,
+	"TABLE": true, "INTO": true, "ONLY": true, "IF": true, "THEN": true, "ELSE": true,
+}
+
+// parseSQL extracts the name, kind and tables of a SQL statement. It is a
+// tokenizer-level scan rather than a parser: tables are the names after
+// FROM, JOIN, USING (read) and INTO, UPDATE, DELETE FROM, TABLE (written),
+// excluding common table expressions. Dynamic SQL is out of its reach.
+func parseSQL(text string) SQLQuery {
+	var q SQLQuery
+	if m := sqlcName.FindStringSubmatch(text); m != nil {
+		q.Name = m[1]
+	}
+	toks := sqlTokens(text)
+	upper := func(i int) string {
+		if i < 0 || i >= len(toks) {
+			return ""
+		}
+		return strings.ToUpper(toks[i])
+	}
+
+	ctes := make(map[string]bool)
+	for i := range toks {
+		// WITH name AS ( ... )
+		if upper(i+1) == "AS" && upper(i+2) == "(" && isSQLIdent(toks[i]) {
+			ctes[strings.ToLower(toks[i])] = true
+		}
+	}
+
+	// table reads a table name at i, returning it and the index after it
+	// and its alias.
+	table := func(i int) (string, int) {
+		if upper(i) == "ONLY" || upper(i) == "LATERAL" {
+			i++
+		}
+		if i >= len(toks) || !isSQLIdent(toks[i]) || sqlKeywords[upper(i)] {
+			return "", i
+		}
+		name := sqlName(toks[i])
+		i++
+		if upper(i) == "AS" {
+			i += 2
+		} else if i < len(toks) && isSQLIdent(toks[i]) && !sqlKeywords[upper(i)] {
+			i++
+		}
+		return name, i
+	}
+	add := func(list *[]string, name string) {
+		if name != "" && !ctes[name] && !slices.Contains(*list, name) {
+			*list = append(*list, name)
+		}
+	}
+
+	var calls []bool // for each open parenthesis, whether it is a function call's
+	for i := 0; i < len(toks); i++ {
+		tok := upper(i)
+		switch tok {
+		case "(":
+			calls = append(calls, i > 0 && isSQLIdent(toks[i-1]) && !sqlKeywords[upper(i-1)] && !sqlStatements[upper(i-1)])
+			continue
+		case ")":
+			if len(calls) > 0 {
+				calls = calls[:len(calls)-1]
+			}
+			continue
+		}
+		if len(calls) > 0 && calls[len(calls)-1] {
+			continue // EXTRACT(YEAR FROM t), TRIM(BOTH FROM s)
+		}
+		if q.Kind == "" && len(calls) == 0 && sqlStatements[tok] {
+			q.Kind = strings.ToLower(tok)
+		}
+		switch tok {
+		case "FROM", "JOIN", "USING":
+			write := tok == "FROM" && upper(i-1) == "DELETE"
+			for j := i + 1; ; {
+				name, next := table(j)
+				if upper(next) == "(" && !write {
+					break // a table function
+				}
+				if write {
+					add(&q.Writes, name)
+				} else {
+					add(&q.Reads, name)
+				}
+				if name == "" || tok != "FROM" || upper(next) != "," {
+					break
+				}
+				j = next + 1
+			}
+		case "INTO", "UPDATE", "TABLE", "TRUNCATE":
+			if tok == "UPDATE" && (upper(i-1) == "DO" || upper(i-1) == "FOR" || upper(i-1) == "KEY") {
+				continue // ON CONFLICT DO UPDATE, SELECT ... FOR UPDATE
+			}
+			j := i + 1
+			if upper(j) == "IF" { // IF [NOT] EXISTS
+				for j < len(toks) && upper(j) != "EXISTS" {
+					j++
+				}
+				j++
+			}
+			name, _ := table(j)
+			add(&q.Writes, name)
+		}
+	}
+	return q
+}
+
+// sqlTokens splits SQL text into identifiers (with their quotes and
+// qualifiers), numbers, parameters and single punctuation characters,
+// dropping comments and string literals.
+func sqlTokens(text string) []string {
+	var toks []string
+	r := []rune(text)
+	for i := 0; i < len(r); {
+		ch := r[i]
+		switch {
+		case unicode.IsSpace(ch):
+			i++
+		case ch == '-' && i+1 < len(r) && r[i+1] == '-':
+			for i < len(r) && r[i] != '\n' {
+				i++
+			}
+		case ch == '/' && i+1 < len(r) && r[i+1] == '*':
+			for i += 2; i < len(r) && !(r[i-1] == '*' && r[i] == '/'); i++ {
+			}
+			i++
+		case ch == '\'':
+			for i++; i < len(r); i++ {
+				if r[i] == '\'' {
+					if i+1 < len(r) && r[i+1] == '\'' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			i++
+		case isSQLIdentRune(ch) || ch == '"' || ch == '`' || ch == '[':
+			start := i
+			for i < len(r) && (isSQLIdentRune(r[i]) || r[i] == '.' || r[i] == '"' || r[i] == '`' || r[i] == '[' || r[i] == ']') {
+				if q := closingQuote(r[i]); q != 0 {
+					for i++; i < len(r) && r[i] != q; i++ {
+					}
+				}
+				i++
+			}
+			toks = append(toks, string(r[start:min(i, len(r))]))
+		default:
+			toks = append(toks, string(ch))
+			i++
+		}
+	}
+	return toks
+}
+
+// closingQuote returns the character closing a quoted identifier opened
+// by ch, or 0 if ch opens none.
+func closingQuote(ch rune) rune {
+	switch ch {
+	case '"', '`':
+		return ch
+	case '[':
+		return ']'
+	}
+	return 0
+}
+
+// isSQLIdentRune reports whether ch can appear in an unquoted identifier.
+func isSQLIdentRune(ch rune) bool {
+	return ch == '_' || ch == '$' || unicode.IsLetter(ch) || unicode.IsDigit(ch)
+}
+
+// isSQLIdent reports whether tok is an identifier, rather than a number,
+// parameter ($1) or punctuation.
+func isSQLIdent(tok string) bool {
+	ch := []rune(tok)[0]
+	return ch == '_' || ch == '"' || ch == '`' || ch == '[' || unicode.IsLetter(ch)
+}
+
+// sqlName normalizes a table name: quotes dropped, lower case.
+func sqlName(tok string) string {
+	return strings.ToLower(strings.NewReplacer(`"`, "", "`", "", "[", "", "]", "").Replace(tok))
+}
@@ -0,0 +1,245 @@
+// Package subgraph fetches bounded subgraphs of a loaded call graph from
+// Neo4j into typed Go structs, ready for serialization to front-end
+// visualization formats.
+package subgraph
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// Direction selects which relationships are followed from the roots.
+type Direction int
+
+const (
+	Outgoing Direction = iota // callees
+	Incoming                  // callers
+	Both
+)
+
+// Node is a graph node identified by its stable key property.
+type Node struct {
+	ID         string         `json:"id"`
+	Labels     []string       `json:"labels"`
+	Properties map[string]any `json:"properties"`
+}
+
+// Edge is a relationship between two nodes, referenced by Node.ID.
+type Edge struct {
+	From       string         `json:"from"`
+	To         string         `json:"to"`
+	Type       string         `json:"type"`
+	Properties map[string]any `json:"properties,omitempty"`
+}
+
+// Graph is a fetched subgraph. Edges only reference nodes present in Nodes.
+type Graph struct {
+	Nodes     []Node `json:"nodes"`
+	Edges     []Edge `json:"edges"`
+	Truncated bool   `json:"truncated"` // MaxNodes was reached
+}
+
+// Query bounds the subgraph to fetch.
+type Query struct {
+	// Roots are id (GoFunc and type nodes), full_name (GoFunc), key
+	// (GoStruct, GoInterface, GoNamedType, GoAlias) or import_path
+	// (GoPackage) values of the starting nodes.
+	Roots     []string
+	Depth     int       // maximum hops from a root; 0 returns the roots only
+	Direction Direction // default Outgoing
+	RelTypes  []string  // relationship types to follow; default ACCURATE_CALLS
+	Labels    []string  // if set, every node on a path must carry one of these labels
+	ProdOnly  bool      // only follow nodes with prod_reachable = true
+	MaxNodes  int       // stop after this many nodes; default DefaultMaxNodes
+
+	// Names returns the name in the graph of a default label or
+	// relationship type, for a graph loaded with --rename, --label-prefix
+	// or --label-suffix. RelTypes and Labels take the default names. Nil
+	// keeps the default names.
+	Names func(name string) string
+	// Project selects the graph of a project loaded with --project.
+	// Relationships only join nodes of one project, so only the roots are
+	// looked up in it.
+	Project string
+}
+
+// DefaultMaxNodes bounds queries that don't set Query.MaxNodes.
+const DefaultMaxNodes = 500
+
+// MaxDepth caps Query.Depth to keep variable-length matches tractable.
+const MaxDepth = 10
+
+var identRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// rootKeys are the indexed properties roots are looked up by, per label.
+var rootKeys = []struct{ label, key string }{
+	{"GoFunc", "id"}, {"GoFunc", "full_name"},
+	{"GoStruct", "id"}, {"GoStruct", "key"},
+	{"GoInterface", "id"}, {"GoInterface", "key"},
+	{"GoNamedType", "id"}, {"GoNamedType", "key"},
+	{"GoAlias", "id"}, {"GoAlias", "key"},
+	{"GoPackage", "import_path"},
+}
+
+// Client reads subgraphs using an existing Neo4j driver.
+type Client struct {
+	driver neo4j.DriverWithContext
+}
+
+// NewClient returns a Client using driver. The caller keeps ownership of
+// the driver and must close it.
+func NewClient(driver neo4j.DriverWithContext) *Client {
+	return &Client{driver: driver}
+}
+
+// Fetch runs q and returns the deduplicated subgraph.
+func (c *Client) Fetch(ctx context.Context, q Query) (*Graph, error) {
+	cypher, params, err := buildCypher(q)
+	if err != nil {
+		return nil, err
+	}
+	res, err := neo4j.ExecuteQuery(ctx, c.driver, cypher, params,
+		neo4j.EagerResultTransformer, neo4j.ExecuteQueryWithReadersRouting())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch subgraph: %w", err)
+	}
+
+	g := &Graph{}
+	if len(res.Records) == 0 {
+		return g, nil
+	}
+	nodes, _, err := neo4j.GetRecordValue[[]any](res.Records[0], "nodes")
+	if err != nil {
+		return nil, fmt.Errorf("unexpected subgraph record: %w", err)
+	}
+	rels, _, err := neo4j.GetRecordValue[[]any](res.Records[0], "rels")
+	if err != nil {
+		return nil, fmt.Errorf("unexpected subgraph record: %w", err)
+	}
+	// The query returns one node more than the limit to tell that it
+	// was reached.
+	if limit := params["limit"].(int); len(nodes) == limit {
+		nodes, g.Truncated = nodes[:limit-1], true
+	}
+	ids := make(map[string]string) // element ID -> Node.ID
+	for _, v := range nodes {
+		n, ok := v.(neo4j.Node)
+		if !ok {
+			return nil, fmt.Errorf("unexpected subgraph node %T", v)
+		}
+		ids[n.ElementId] = nodeID(n)
+		g.Nodes = append(g.Nodes, Node{ID: ids[n.ElementId], Labels: n.Labels, Properties: n.Props})
+	}
+	for _, v := range rels {
+		r, ok := v.(neo4j.Relationship)
+		if !ok {
+			return nil, fmt.Errorf("unexpected subgraph relationship %T", v)
+		}
+		from, okFrom := ids[r.StartElementId]
+		to, okTo := ids[r.EndElementId]
+		if okFrom && okTo {
+			g.Edges = append(g.Edges, Edge{From: from, To: to, Type: r.Type, Properties: r.Props})
+		}
+	}
+	return g, nil
+}
+
+// buildCypher renders the query for q with its parameters. Depth, labels
+// and relationship types cannot be parameterized in Cypher, so they are
+// validated and inlined. The roots are looked up by the indexes of their
+// labels, the nodes within reach are kept nearest-first up to the limit
+// in the query, and the relationships between them are returned with
+// them, so only the bounded subgraph leaves the server.
+func buildCypher(q Query) (string, map[string]any, error) {
+	if len(q.Roots) == 0 {
+		return "", nil, fmt.Errorf("subgraph query needs at least one root")
+	}
+	if q.Depth < 0 || q.Depth > MaxDepth {
+		return "", nil, fmt.Errorf("subgraph depth %d out of range 0..%d", q.Depth, MaxDepth)
+	}
+	name := q.Names
+	if name == nil {
+		name = func(name string) string { return name }
+	}
+	relTypes := q.RelTypes
+	if len(relTypes) == 0 {
+		relTypes = []string{"ACCURATE_CALLS"}
+	}
+	types := make([]string, len(relTypes))
+	for i, t := range relTypes {
+		if types[i] = name(t); !identRe.MatchString(types[i]) {
+			return "", nil, fmt.Errorf("invalid relationship type %q", types[i])
+		}
+	}
+	labels := make([]string, len(q.Labels))
+	for i, l := range q.Labels {
+		labels[i] = name(l)
+	}
+	maxNodes := q.MaxNodes
+	if maxNodes <= 0 {
+		maxNodes = DefaultMaxNodes
+	}
+	params := map[string]any{"roots": q.Roots, "labels": labels, "limit": maxNodes + 1}
+
+	inProject := ""
+	if q.Project != "" {
+		inProject = " AND root.project = $project"
+		params["project"] = q.Project
+	}
+	roots := make([]string, len(rootKeys))
+	for i, k := range rootKeys {
+		label := name(k.label)
+		if !identRe.MatchString(label) {
+			return "", nil, fmt.Errorf("invalid label %q", label)
+		}
+		roots[i] = fmt.Sprintf("  MATCH (root:%s) WHERE root.%s IN $roots%s RETURN root", label, k.key, inProject)
+	}
+
+	typeList := strings.Join(types, "|")
+	rel := fmt.Sprintf("[:%s*0..%d]", typeList, q.Depth)
+	var pattern string
+	switch q.Direction {
+	case Incoming:
+		pattern = "(root)<-" + rel + "-(n)"
+	case Both:
+		pattern = "(root)-" + rel + "-(n)"
+	default:
+		pattern = "(root)-" + rel + "->(n)"
+	}
+
+	var conds []string
+	if len(q.Labels) > 0 {
+		conds = append(conds, "any(l IN labels(x) WHERE l IN $labels)")
+	}
+	if q.ProdOnly {
+		conds = append(conds, "x.prod_reachable = true")
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = "\nWHERE all(x IN nodes(p) WHERE " + strings.Join(conds, " AND ") + ")"
+	}
+
+	return `CALL {
+` + strings.Join(roots, "\n  UNION\n") + `
+}
+MATCH p = ` + pattern + where + `
+WITH n, min(length(p)) AS hops
+ORDER BY hops
+LIMIT $limit
+WITH collect(n) AS nodes
+RETURN nodes, reduce(rels = [], a IN nodes | rels + [(a)-[r:` + typeList + `]->(b) WHERE b IN nodes | r]) AS rels`, params, nil
+}
+
+// nodeID returns the stable key of n, falling back to its element ID.
+func nodeID(n neo4j.Node) string {
+	for _, k := range []string{"full_name", "key", "import_path"} {
+		if v, ok := n.Props[k].(string); ok && v != "" {
+			return v
+		}
+	}
+	return n.ElementId
+}
@@ -0,0 +1,140 @@
+package subgraph
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildCypher(t *testing.T) {
+	cypher, params, err := buildCypher(Query{Roots: []string{"example.com/app.Run"}, Depth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `CALL {
+  MATCH (root:GoFunc) WHERE root.id IN $roots RETURN root
+  UNION
+  MATCH (root:GoFunc) WHERE root.full_name IN $roots RETURN root
+  UNION
+  MATCH (root:GoStruct) WHERE root.id IN $roots RETURN root
+  UNION
+  MATCH (root:GoStruct) WHERE root.key IN $roots RETURN root
+  UNION
+  MATCH (root:GoInterface) WHERE root.id IN $roots RETURN root
+  UNION
+  MATCH (root:GoInterface) WHERE root.key IN $roots RETURN root
+  UNION
+  MATCH (root:GoNamedType) WHERE root.id IN $roots RETURN root
+  UNION
+  MATCH (root:GoNamedType) WHERE root.key IN $roots RETURN root
+  UNION
+  MATCH (root:GoAlias) WHERE root.id IN $roots RETURN root
+  UNION
+  MATCH (root:GoAlias) WHERE root.key IN $roots RETURN root
+  UNION
+  MATCH (root:GoPackage) WHERE root.import_path IN $roots RETURN root
+}
+MATCH p = (root)-[:ACCURATE_CALLS*0..2]->(n)
+WITH n, min(length(p)) AS hops
+ORDER BY hops
+LIMIT $limit
+WITH collect(n) AS nodes
+RETURN nodes, reduce(rels = [], a IN nodes | rels + [(a)-[r:ACCURATE_CALLS]->(b) WHERE b IN nodes | r]) AS rels`
+	if cypher != want {
+		t.Errorf("buildCypher\n got %s\nwant %s", cypher, want)
+	}
+	if params["limit"] != DefaultMaxNodes+1 {
+		t.Errorf("limit = %v, want %d", params["limit"], DefaultMaxNodes+1)
+	}
+	if _, ok := params["project"]; ok {
+		t.Errorf("project parameter without a project: %v", params)
+	}
+}
+
+func TestBuildCypherOptions(t *testing.T) {
+	tests := []struct {
+		name       string
+		q          Query
+		contains   []string
+		notContain []string
+		params     map[string]any
+	}{
+		{
+			name:     "incoming",
+			q:        Query{Roots: []string{"r"}, Depth: 1, Direction: Incoming},
+			contains: []string{"MATCH p = (root)<-[:ACCURATE_CALLS*0..1]-(n)\n"},
+		},
+		{
+			name:     "both directions and several types",
+			q:        Query{Roots: []string{"r"}, Depth: 3, Direction: Both, RelTypes: []string{"ACCURATE_CALLS", "CALLS_EXTERNAL"}},
+			contains: []string{"MATCH p = (root)-[:ACCURATE_CALLS|CALLS_EXTERNAL*0..3]-(n)\n", "[(a)-[r:ACCURATE_CALLS|CALLS_EXTERNAL]->(b) WHERE b IN nodes | r]"},
+		},
+		{
+			name:     "labels and production code",
+			q:        Query{Roots: []string{"r"}, Labels: []string{"GoFunc"}, ProdOnly: true},
+			contains: []string{"\nWHERE all(x IN nodes(p) WHERE any(l IN labels(x) WHERE l IN $labels) AND x.prod_reachable = true)\n"},
+			params:   map[string]any{"labels": []string{"GoFunc"}},
+		},
+		{
+			name:   "max nodes",
+			q:      Query{Roots: []string{"r"}, MaxNodes: 20},
+			params: map[string]any{"limit": 21},
+		},
+		{
+			name:       "project",
+			q:          Query{Roots: []string{"r"}, Project: "payments"},
+			contains:   []string{"MATCH (root:GoFunc) WHERE root.id IN $roots AND root.project = $project RETURN root", "MATCH (root:GoPackage) WHERE root.import_path IN $roots AND root.project = $project RETURN root"},
+			notContain: []string{"IN $roots RETURN"},
+			params:     map[string]any{"project": "payments"},
+		},
+		{
+			name: "names",
+			q: Query{Roots: []string{"r"}, Labels: []string{"GoFunc", "GoPackage"}, Names: func(name string) string {
+				if name == "ACCURATE_CALLS" {
+					return "CALLS"
+				}
+				return "Acme" + name
+			}},
+			contains:   []string{"MATCH (root:AcmeGoFunc) WHERE root.full_name IN $roots", "MATCH (root:AcmeGoPackage)", "[:CALLS*0..0]", "[(a)-[r:CALLS]->(b)"},
+			notContain: []string{"(root:GoFunc)", "ACCURATE_CALLS"},
+			params:     map[string]any{"labels": []string{"AcmeGoFunc", "AcmeGoPackage"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cypher, params, err := buildCypher(tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(cypher, s) {
+					t.Errorf("query does not contain %q:\n%s", s, cypher)
+				}
+			}
+			for _, s := range tt.notContain {
+				if strings.Contains(cypher, s) {
+					t.Errorf("query contains %q:\n%s", s, cypher)
+				}
+			}
+			for k, want := range tt.params {
+				if got := params[k]; !reflect.DeepEqual(got, want) {
+					t.Errorf("parameter %s = %v, want %v", k, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildCypherErrors(t *testing.T) {
+	for _, q := range []Query{
+		{},
+		{Roots: []string{"r"}, Depth: -1},
+		{Roots: []string{"r"}, Depth: MaxDepth + 1},
+		{Roots: []string{"r"}, RelTypes: []string{"CALLS]->() DETACH DELETE n //"}},
+		{Roots: []string{"r"}, Names: func(string) string { return "Bad Name" }},
+	} {
+		if cypher, _, err := buildCypher(q); err == nil {
+			t.Errorf("buildCypher(%+v) succeeded:\n%s", q, cypher)
+		}
+	}
+}
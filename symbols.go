@@ -0,0 +1,41 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Symbol IDs are the MERGE keys of GoFunc, type and SqlQuery nodes. An ID
+// is the first 16 bytes, hex-encoded, of the SHA-256 of "go:<kind>:<name>",
+// where name is the function full name (package path, receiver and name),
+// the type key (package path and name) or the statement text. Signatures
+// are deliberately left out: Go has no overloading, so they add nothing to
+// uniqueness, and a changed signature should not make a function a new
+// symbol. IDs are therefore the same across runs and machines, and other
+// tools can compute them.
+const (
+	funcSymbol = "func"
+	typeSymbol = "type" // structs, interfaces, named types and aliases
+	sqlSymbol  = "sql"  // SQL statements, named by their text
+)
+
+// symbolID returns the ID of the symbol of the given kind and name.
+func symbolID(kind, name string) string {
+	sum := sha256.Sum256([]byte("go:" + kind + ":" + name))
+	return hex.EncodeToString(sum[:16])
+}
+
+// funcID returns the ID of the function with the given full name.
+func funcID(fullName string) string {
+	return symbolID(funcSymbol, fullName)
+}
+
+// typeID returns the ID of the type with the given key.
+func typeID(key string) string {
+	return symbolID(typeSymbol, key)
+}
+
+// queryID returns the ID of the SQL statement with the given text.
+func queryID(text string) string {
+	return symbolID(sqlSymbol, text)
+}
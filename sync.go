@@ -0,0 +1,223 @@
+package main
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// syncKinds are the sync types tracked by SyncUse, and whether they guard
+// the fields declared after them.
+var syncKinds = map[string]bool{"Mutex": true, "RWMutex": true, "WaitGroup": false, "Once": false}
+
+// syncKind returns the name of the tracked sync type t is, or points to,
+// or "".
+func syncKind(t types.Type) string {
+	named, _ := receiverNamed(types.Unalias(t))
+	if named == nil || named.Obj().Pkg() == nil || named.Obj().Pkg().Path() != "sync" {
+		return ""
+	}
+	if _, ok := syncKinds[named.Obj().Name()]; !ok {
+		return ""
+	}
+	return named.Obj().Name()
+}
+
+// collectSyncUses records the sync.Mutex, RWMutex, WaitGroup and Once
+// struct fields and package-level variables declared in the project
+// packages among pkgs, and the project functions calling their methods.
+// Locals and parameters are left out, as only fields and variables are
+// shared in a way worth reviewing.
+func (c *Collector) collectSyncUses(funcs *syntaxFuncs, pkgs []*packages.Package, sites *callSiteIndex) {
+	index := make(map[string]int) // func|var|op -> position in c.SyncUses
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if !c.isProjectPackage(pkg.PkgPath) || pkg.TypesInfo == nil {
+			return
+		}
+		info := pkg.TypesInfo
+		for _, file := range pkg.Syntax {
+			for _, decl := range file.Decls {
+				if gd, ok := decl.(*ast.GenDecl); ok {
+					c.syncDecls(pkg, gd)
+				}
+			}
+			var stack []ast.Node
+			ast.Inspect(file, func(n ast.Node) bool {
+				if n == nil {
+					stack = stack[:len(stack)-1]
+					return true
+				}
+				stack = append(stack, n)
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				fn, _ := typeutil.Callee(info, call).(*types.Func)
+				sel, _ := ast.Unparen(call.Fun).(*ast.SelectorExpr)
+				if fn == nil || sel == nil || fn.Type().(*types.Signature).Recv() == nil ||
+					syncKind(fn.Type().(*types.Signature).Recv().Type()) == "" {
+					return true
+				}
+				u, ok := syncVar(info, sel)
+				if !ok || !c.isProjectPackage(u.Package) {
+					return true
+				}
+				u.Func, u.Op = funcs.enclosing(pkg, stack), fn.Name()
+				site := sites.site(c, pkg.Fset, call.Lparen)
+				key := u.Func + "|" + u.Var + "|" + u.Op
+				if i, ok := index[key]; ok {
+					c.SyncUses[i].Sites = append(c.SyncUses[i].Sites, site)
+					return true
+				}
+				u.Sites = []CallSite{site}
+				index[key] = len(c.SyncUses)
+				c.SyncUses = append(c.SyncUses, u)
+				return true
+			})
+		}
+	})
+	for i := range c.SyncUses {
+		sortSites(c.SyncUses[i].Sites)
+	}
+}
+
+// syncDecls records the sync fields of the struct types and the sync
+// package-level variables declared by decl, a top-level declaration. The
+// fields following a mutex up to the next blank line or sync field are
+// taken to be guarded by it, as is conventional.
+func (c *Collector) syncDecls(pkg *packages.Package, decl *ast.GenDecl) {
+	info := pkg.TypesInfo
+	for _, spec := range decl.Specs {
+		switch spec := spec.(type) {
+		case *ast.ValueSpec:
+			for _, name := range spec.Names {
+				if obj := info.Defs[name]; obj != nil && syncKind(obj.Type()) != "" {
+					c.SyncUses = append(c.SyncUses, SyncUse{
+						Kind: syncKind(obj.Type()), Var: pkg.PkgPath + "." + obj.Name(),
+						Package: pkg.PkgPath, Field: obj.Name(),
+					})
+				}
+			}
+		case *ast.TypeSpec:
+			obj := info.Defs[spec.Name]
+			st, ok := spec.Type.(*ast.StructType)
+			if obj == nil || !ok {
+				continue
+			}
+			structKey := pkg.PkgPath + "." + obj.Name()
+			guard := -1 // position in c.SyncUses of the mutex of the group
+			prevEnd := 0
+			for _, field := range st.Fields.List {
+				start := pkg.Fset.Position(field.Pos()).Line
+				if field.Doc != nil {
+					start = pkg.Fset.Position(field.Doc.Pos()).Line
+				}
+				if start > prevEnd+1 {
+					guard = -1 // a blank line ends the group
+				}
+				prevEnd = pkg.Fset.Position(field.End()).Line
+				kind := syncKind(info.TypeOf(field.Type))
+				names := fieldNames(info, field)
+				if kind == "" {
+					if guard >= 0 {
+						c.SyncUses[guard].Guarded = append(c.SyncUses[guard].Guarded, names...)
+					}
+					continue
+				}
+				guard = -1
+				for _, name := range names {
+					c.SyncUses = append(c.SyncUses, SyncUse{
+						Kind: kind, Var: structKey + "." + name,
+						Package: pkg.PkgPath, Struct: structKey, Field: name,
+					})
+					if syncKinds[kind] {
+						guard = len(c.SyncUses) - 1
+					}
+				}
+			}
+		}
+	}
+}
+
+// fieldNames returns the names of the fields declared by field, the type
+// name for an embedded field.
+func fieldNames(info *types.Info, field *ast.Field) []string {
+	if len(field.Names) == 0 {
+		if named, _ := receiverNamed(types.Unalias(info.TypeOf(field.Type))); named != nil {
+			return []string{named.Obj().Name()}
+		}
+		return nil
+	}
+	names := make([]string, len(field.Names))
+	for i, n := range field.Names {
+		names[i] = n.Name
+	}
+	return names
+}
+
+// syncVar returns the field or package-level variable whose sync method
+// sel selects: mu in s.mu.Lock(), mu.Lock() and pkg.Mu.Lock(), or the
+// embedded Mutex in s.Lock(). Locals and parameters are not reported.
+func syncVar(info *types.Info, sel *ast.SelectorExpr) (SyncUse, bool) {
+	// A method promoted from an embedded field.
+	if s := info.Selections[sel]; s != nil && len(s.Index()) > 1 {
+		return fieldVar(s.Recv(), s.Index()[:len(s.Index())-1])
+	}
+	var id *ast.Ident
+	switch x := ast.Unparen(sel.X).(type) {
+	case *ast.SelectorExpr:
+		if s := info.Selections[x]; s != nil {
+			if s.Kind() != types.FieldVal {
+				return SyncUse{}, false
+			}
+			return fieldVar(s.Recv(), s.Index())
+		}
+		id = x.Sel // a qualified identifier
+	case *ast.Ident:
+		id = x
+	default:
+		return SyncUse{}, false
+	}
+	v, ok := info.Uses[id].(*types.Var)
+	if !ok || v.Pkg() == nil || v.Parent() != v.Pkg().Scope() {
+		return SyncUse{}, false
+	}
+	return SyncUse{Kind: syncKind(v.Type()), Var: v.Pkg().Path() + "." + v.Name(), Package: v.Pkg().Path(), Field: v.Name()}, true
+}
+
+// fieldVar returns the field reached from a value of type t through the
+// field indexes of path, embedded fields first, if it belongs to a named
+// struct type.
+func fieldVar(t types.Type, path []int) (SyncUse, bool) {
+	for _, i := range path[:len(path)-1] {
+		st, ok := derefType(t).Underlying().(*types.Struct)
+		if !ok {
+			return SyncUse{}, false
+		}
+		t = st.Field(i).Type()
+	}
+	named, _ := receiverNamed(types.Unalias(t))
+	if named == nil || named.Obj().Pkg() == nil {
+		return SyncUse{}, false
+	}
+	st, ok := named.Underlying().(*types.Struct)
+	if !ok {
+		return SyncUse{}, false
+	}
+	f := st.Field(path[len(path)-1])
+	structKey := typeKeyOf(named)
+	return SyncUse{
+		Kind: syncKind(f.Type()), Var: structKey + "." + f.Name(),
+		Package: named.Obj().Pkg().Path(), Struct: structKey, Field: f.Name(),
+	}, true
+}
+
+// derefType returns the element type of pointer t, or t.
+func derefType(t types.Type) types.Type {
+	if p, ok := t.Underlying().(*types.Pointer); ok {
+		return p.Elem()
+	}
+	return t
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/callgraph"
+	"golang.org/x/tools/go/ssa"
+)
+
+// Kinds of SSA-generated functions standing in for a declared function.
+const (
+	syntheticWrapper       = "wrapper"       // promoted method or *T method set entry for a T method
+	syntheticThunk         = "thunk"         // method expression T.Method
+	syntheticBound         = "bound"         // method value x.Method
+	syntheticInstantiation = "instantiation" // generic instantiation wrapper
+)
+
+// syntheticKind classifies fn by its ssa.Function.Synthetic provenance.
+// Package initializers, generic instances and functions without syntax
+// are real code as far as the graph is concerned and return "".
+func syntheticKind(fn *ssa.Function) string {
+	switch s := fn.Synthetic; {
+	case strings.HasPrefix(s, "wrapper for "):
+		return syntheticWrapper
+	case strings.HasPrefix(s, "thunk for "):
+		return syntheticThunk
+	case strings.HasPrefix(s, "bound method wrapper for "):
+		return syntheticBound
+	case strings.HasPrefix(s, "instantiation wrapper of "):
+		return syntheticInstantiation
+	}
+	return ""
+}
+
+// syntheticTargets returns the non-synthetic functions a synthetic node
+// ends up calling, following chains such as a bound method wrapper that
+// calls a pointer wrapper.
+func syntheticTargets(node *callgraph.Node) []*callgraph.Node {
+	var targets []*callgraph.Node
+	seen := map[*callgraph.Node]bool{node: true}
+	var walk func(n *callgraph.Node)
+	walk = func(n *callgraph.Node) {
+		for _, e := range n.Out {
+			if seen[e.Callee] {
+				continue
+			}
+			seen[e.Callee] = true
+			if syntheticKind(e.Callee.Func) != "" {
+				walk(e.Callee)
+			} else {
+				targets = append(targets, e.Callee)
+			}
+		}
+	}
+	walk(node)
+	return targets
+}
+
+// syntheticName returns the package and full name of a synthetic function
+// of the given kind: the name of the method it stands in for, qualified by
+// the wrapper's own receiver type for wrappers and thunks, with "$kind"
+// appended (pkg.Outer.Method$wrapper). The package is "" when the function
+// belongs to no package, as for wrappers of error.Error.
+func (c *Collector) syntheticName(fn *ssa.Function, kind string) (string, string) {
+	obj, _ := fn.Object().(*types.Func)
+	if obj == nil {
+		return "", fn.String()
+	}
+	var recv types.Type
+	switch kind {
+	case syntheticWrapper:
+		recv = fn.Signature.Recv().Type()
+	case syntheticThunk:
+		recv = fn.Signature.Params().At(0).Type()
+	}
+	if named, ptr := receiverNamed(recv); named != nil && named.Obj().Pkg() != nil {
+		pkgPath := named.Obj().Pkg().Path()
+		return pkgPath, c.methodFullName(pkgPath, named.Obj().Name(), ptr, obj.Name()) + "$" + kind
+	}
+	if obj.Pkg() == nil {
+		return "", fn.String()
+	}
+	return obj.Pkg().Path(), c.funcFullName(obj.Pkg().Path(), obj) + "$" + kind
+}
+
+// ssaFuncPkg returns the package path of fn, or "" if it has none.
+func (c *Collector) ssaFuncPkg(fn *ssa.Function) string {
+	if fn.Pkg != nil {
+		return fn.Pkg.Pkg.Path()
+	}
+	if kind := syntheticKind(fn); kind != "" {
+		pkgPath, _ := c.syntheticName(fn, kind)
+		return pkgPath
+	}
+	return ""
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"strings"
+	"time"
+)
+
+// PhaseTimes is the time spent in each phase of a run, in the order the
+// phases first ran. Phases run once per build configuration add up.
+type PhaseTimes struct {
+	names []string
+	spent map[string]time.Duration
+}
+
+// phaseTimes are the phase times of this run, logged at the end.
+var phaseTimes = &PhaseTimes{spent: make(map[string]time.Duration)}
+
+// timePhase starts timing phase name and returns the function ending it.
+func timePhase(name string) func() {
+	started := time.Now()
+	return func() {
+		if _, ok := phaseTimes.spent[name]; !ok {
+			phaseTimes.names = append(phaseTimes.names, name)
+		}
+		phaseTimes.spent[name] += time.Since(started)
+	}
+}
+
+// String lists the phases with their times, e.g. "load 12.1s, ssa 3.4s".
+func (t *PhaseTimes) String() string {
+	parts := make([]string, len(t.names))
+	for i, name := range t.names {
+		parts[i] = fmt.Sprintf("%s %s", name, t.spent[name].Round(time.Millisecond))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Profiler writes the CPU profile, heap profile and execution trace of the
+// run asked for with --cpuprofile, --memprofile and --trace.
+type Profiler struct {
+	cpu, trace *os.File
+	memPath    string
+}
+
+// StartProfiler starts CPU profiling and tracing into the files given,
+// skipping those left empty. The heap profile is written by Stop.
+func StartProfiler(cpuPath, memPath, tracePath string) (*Profiler, error) {
+	p := &Profiler{memPath: memPath}
+	if cpuPath != "" {
+		f, err := os.Create(cpuPath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot write CPU profile: %w", err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("cannot start CPU profile: %w", err)
+		}
+		p.cpu = f
+	}
+	if tracePath != "" {
+		f, err := os.Create(tracePath)
+		if err != nil {
+			p.Stop()
+			return nil, fmt.Errorf("cannot write trace: %w", err)
+		}
+		if err := trace.Start(f); err != nil {
+			f.Close()
+			p.Stop()
+			return nil, fmt.Errorf("cannot start trace: %w", err)
+		}
+		p.trace = f
+	}
+	return p, nil
+}
+
+// Stop ends CPU profiling and tracing and writes the heap profile. Errors
+// are logged as warnings: the run itself succeeded.
+func (p *Profiler) Stop() {
+	if p.cpu != nil {
+		pprof.StopCPUProfile()
+		if err := p.cpu.Close(); err != nil {
+			log.Printf("Warning: cannot write CPU profile: %v", err)
+		}
+		p.cpu = nil
+	}
+	if p.trace != nil {
+		trace.Stop()
+		if err := p.trace.Close(); err != nil {
+			log.Printf("Warning: cannot write trace: %v", err)
+		}
+		p.trace = nil
+	}
+	if p.memPath != "" {
+		if err := writeHeapProfile(p.memPath); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+		p.memPath = ""
+	}
+}
+
+// writeHeapProfile writes the heap profile to path after a collection, so
+// that it shows the memory still in use.
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("cannot write heap profile: %w", err)
+	}
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return fmt.Errorf("cannot write heap profile: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("cannot write heap profile: %w", err)
+	}
+	return nil
+}
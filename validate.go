@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/neo4j/neo4j-go-driver/v5/neo4j"
+)
+
+// validationCheck is a consistency check of the stored graph: a query
+// collecting the problems it finds, one string each, as found.
+type validationCheck struct {
+	Name, Description, Cypher string
+}
+
+// validationChecks lists the checks run by the validate subcommand.
+var validationChecks = []validationCheck{
+	{"dangling_calls", "Calls to or from functions that were never loaded or are marked deleted",
+		`MATCH (a:GoFunc)-[:ACCURATE_CALLS|CALLS_EXTERNAL]->(b:GoFunc)
+		 WHERE a.package IS NULL OR b.package IS NULL OR a.deleted OR b.deleted
+		 WITH collect(coalesce(a.full_name, a.id) + ' -> ' + coalesce(b.full_name, b.id)) AS found`},
+	{"funcs_without_package", "Project functions without an IN_PACKAGE edge to their package",
+		`MATCH (f:GoFunc) WHERE NOT f:External AND f.deleted IS NULL AND NOT EXISTS { (f)-[:IN_PACKAGE]->(:GoPackage) }
+		 WITH collect(coalesce(f.full_name, f.id)) AS found`},
+	{"implements_missing_type", "IMPLEMENTS edges from or to a type that was never loaded or is marked deleted",
+		`MATCH (t)-[:IMPLEMENTS]->(i)
+		 WHERE NOT i:GoInterface OR t.key IS NULL OR i.key IS NULL OR t.deleted OR i.deleted
+		 WITH collect(coalesce(t.key, t.id) + ' -> ' + coalesce(i.key, i.id)) AS found`},
+	{"duplicate_full_names", "Full names shared by several GoFunc nodes",
+		`MATCH (f:GoFunc) WHERE f.full_name IS NOT NULL
+		 WITH f.full_name AS name, count(*) AS n WHERE n > 1
+		 WITH collect(name + ' (' + toString(n) + ' nodes)') AS found`},
+}
+
+// ValidationResult is the outcome of one check.
+type ValidationResult struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Count       int64    `json:"count"`
+	Samples     []string `json:"samples"` // the first problems found
+}
+
+// ValidationReport is the outcome of validating the stored graph.
+type ValidationReport struct {
+	Valid  bool               `json:"valid"`
+	Checks []ValidationResult `json:"checks"`
+}
+
+// ValidateGraph runs the consistency checks over the graph of l and
+// returns their results with at most samples problems each.
+func ValidateGraph(l *Neo4jLoader, samples int) (*ValidationReport, error) {
+	report := &ValidationReport{Valid: true}
+	for _, check := range validationChecks {
+		res, err := l.read(check.Cypher+"\n RETURN size(found) AS count, found[0..$samples] AS samples",
+			map[string]any{"samples": samples})
+		if err != nil {
+			return nil, fmt.Errorf("check %s failed: %w", check.Name, err)
+		}
+		count, _, _ := neo4j.GetRecordValue[int64](res.Records[0], "count")
+		found, _, _ := neo4j.GetRecordValue[[]any](res.Records[0], "samples")
+		result := ValidationResult{Name: check.Name, Description: check.Description, Count: count, Samples: []string{}}
+		for _, s := range found {
+			result.Samples = append(result.Samples, fmt.Sprint(s))
+		}
+		report.Checks = append(report.Checks, result)
+		if count > 0 {
+			report.Valid = false
+		}
+	}
+	return report, nil
+}
+
+// WriteValidationReport prints report as text: each check with its count
+// and sample problems.
+func WriteValidationReport(w io.Writer, report *ValidationReport) {
+	for _, c := range report.Checks {
+		status := "ok"
+		if c.Count > 0 {
+			status = fmt.Sprintf("%d found", c.Count)
+		}
+		fmt.Fprintf(w, "%s: %s\n", c.Name, status)
+		for _, s := range c.Samples {
+			fmt.Fprintf(w, "  %s\n", s)
+		}
+		if int64(len(c.Samples)) < c.Count {
+			fmt.Fprintf(w, "  ... and %d more\n", c.Count-int64(len(c.Samples)))
+		}
+	}
+}
+
+// runValidate implements the validate subcommand.
+func runValidate(args []string) error {
+	cmd := flag.NewFlagSet("validate", flag.ExitOnError)
+	neo4jURI := cmd.String("neo4j-uri", "bolt://localhost:7687", "Neo4j URI: bolt:// for one server, neo4j:// to route in a cluster")
+	neo4jUser := cmd.String("neo4j-user", "neo4j", "Neo4j username")
+	neo4jPass := cmd.String("neo4j-pass", "", "Neo4j password")
+	format := cmd.String("format", "json", "Output format: json or text")
+	samples := cmd.Int("samples", 20, "Problems listed per check")
+	graphOpts := addGraphFlags(cmd)
+	cmd.Usage = func() {
+		fmt.Fprintln(cmd.Output(), "Usage: go-callgraph-neo4j validate --neo4j-pass <password> [flags]")
+		fmt.Fprintln(cmd.Output(), "The exit status is 1 if a check finds problems.")
+		cmd.PrintDefaults()
+	}
+	cmd.Parse(args)
+	if *neo4jPass == "" || cmd.NArg() > 0 || *samples < 0 || (*format != "json" && *format != "text") {
+		cmd.Usage()
+		os.Exit(1)
+	}
+
+	loader, err := openLoader(*neo4jURI, *neo4jUser, *neo4jPass, graphOpts)
+	if err != nil {
+		return err
+	}
+	defer loader.Close()
+	report, err := ValidateGraph(loader, *samples)
+	if err != nil {
+		return err
+	}
+	if *format == "text" {
+		WriteValidationReport(os.Stdout, report)
+	} else {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	}
+	if !report.Valid {
+		loader.Close()
+		os.Exit(1)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+)
+
+// verifySample is how many calls VerifyLoad checks edge by edge.
+const verifySample = 500
+
+// Discrepancy is a difference between the collected data and the graph
+// read back after loading it.
+type Discrepancy struct {
+	Check  string // nodes, calls or endpoints
+	Detail string
+}
+
+// VerifyLoad reads the graph back after a load of c and returns where it
+// differs from c: nodes missing or duplicated, sampled calls without an
+// edge, and call ends left as placeholders because the function they name
+// was not loaded.
+func VerifyLoad(l *Neo4jLoader, c *Collector) ([]Discrepancy, error) {
+	var found []Discrepancy
+	for _, nodes := range c.LiveNodes() {
+		n, err := l.CountNodes(nodes)
+		if err != nil {
+			return nil, err
+		}
+		switch want := int64(len(nodes.Values)); {
+		case n < want:
+			found = append(found, Discrepancy{"nodes", fmt.Sprintf("%d of %d %s nodes missing", want-n, want, nodes.Label)})
+		case n > want:
+			found = append(found, Discrepancy{"nodes", fmt.Sprintf("%d duplicate %s nodes", n-want, nodes.Label)})
+		}
+	}
+
+	missing, err := l.MissingCalls(sampleCalls(c.Calls, verifySample))
+	if err != nil {
+		return nil, err
+	}
+	for _, call := range missing {
+		found = append(found, Discrepancy{"calls", fmt.Sprintf("no edge for call %s -> %s", call.CallerFullName, call.CalleeFullName)})
+	}
+
+	seen := make(map[string]bool)
+	var ends []string
+	for _, call := range c.Calls {
+		for _, name := range []string{call.CallerFullName, call.CalleeFullName} {
+			if !seen[name] {
+				seen[name] = true
+				ends = append(ends, funcID(name))
+			}
+		}
+	}
+	placeholders, err := l.Placeholders(ends)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(placeholders)
+	for _, name := range placeholders {
+		found = append(found, Discrepancy{"endpoints", fmt.Sprintf("call end %s matched no loaded function", name)})
+	}
+	return found, nil
+}
+
+// sampleCalls returns at most n calls spread evenly over calls ordered by
+// caller and callee, so that repeated loads check the same ones.
+func sampleCalls(calls []CallEdge, n int) []CallEdge {
+	sorted := append([]CallEdge(nil), calls...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].CallerFullName != sorted[j].CallerFullName {
+			return sorted[i].CallerFullName < sorted[j].CallerFullName
+		}
+		return sorted[i].CalleeFullName < sorted[j].CalleeFullName
+	})
+	if len(sorted) <= n {
+		return sorted
+	}
+	sample := make([]CallEdge, n)
+	for i := range sample {
+		sample[i] = sorted[i*len(sorted)/n]
+	}
+	return sample
+}
+
+// maxLoggedDiscrepancies is how many discrepancies of a check are logged.
+const maxLoggedDiscrepancies = 20
+
+// logDiscrepancies logs the discrepancies, at most maxLoggedDiscrepancies
+// of each check.
+func logDiscrepancies(found []Discrepancy) {
+	if len(found) == 0 {
+		log.Println("Verified the load: no discrepancies")
+		return
+	}
+	log.Printf("Verifying the load found %d discrepancies:", len(found))
+	perCheck := make(map[string]int)
+	for _, d := range found {
+		perCheck[d.Check]++
+		if perCheck[d.Check] <= maxLoggedDiscrepancies {
+			log.Printf("  %s: %s", d.Check, d.Detail)
+		}
+	}
+	for check, n := range perCheck {
+		if n > maxLoggedDiscrepancies {
+			log.Printf("  %s: %d more", check, n-maxLoggedDiscrepancies)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// VulnFinding is a govulncheck finding resolved to graph symbols.
+type VulnFinding struct {
+	OSV          string
+	Module       string
+	Version      string
+	FixedVersion string
+	Symbol       string // full name of the vulnerable function; empty for module/package-level findings
+	Entry        string // full name of the project function the call trace starts from
+}
+
+// govulncheckFrame mirrors a trace frame in govulncheck -json output.
+type govulncheckFrame struct {
+	Module   string `json:"module"`
+	Version  string `json:"version"`
+	Package  string `json:"package"`
+	Function string `json:"function"`
+	Receiver string `json:"receiver"`
+}
+
+// govulncheckMessage mirrors the subset of govulncheck -json stream
+// messages used here.
+type govulncheckMessage struct {
+	Finding *struct {
+		OSV          string             `json:"osv"`
+		FixedVersion string             `json:"fixed_version"`
+		Trace        []govulncheckFrame `json:"trace"`
+	} `json:"finding"`
+}
+
+// frameName builds the FuncNode.FullName for a trace frame.
+func (c *Collector) frameName(f govulncheckFrame) string {
+	if f.Function == "" {
+		return ""
+	}
+	if recv := strings.TrimPrefix(f.Receiver, "*"); recv != "" {
+		return c.methodFullName(f.Package, recv, recv != f.Receiver, f.Function)
+	}
+	return f.Package + "." + f.Function
+}
+
+// runGovulncheck runs `govulncheck -json ./...` in dir with env and build
+// flags, and returns its output.
+func runGovulncheck(dir string, env, flags []string) ([]byte, error) {
+	cmd := exec.Command("govulncheck", append(append([]string{"-json"}, flags...), "./...")...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	// govulncheck may exit non-zero when it reports vulnerabilities; only
+	// fail if it produced nothing to parse.
+	if err != nil && len(out) == 0 {
+		return nil, fmt.Errorf("govulncheck: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// CollectVulns parses a govulncheck -json stream and records its findings.
+// Only symbol-level findings (the vulnerable function is called) carry a
+// Symbol and an Entry; module- and package-level findings mark just the
+// module. Findings already recorded, such as those of another build
+// configuration, are not recorded again.
+func (c *Collector) CollectVulns(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	seen := make(map[VulnFinding]bool)
+	for _, f := range c.Vulns {
+		seen[f] = true
+	}
+	for {
+		var msg govulncheckMessage
+		if err := dec.Decode(&msg); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("cannot parse govulncheck output: %w", err)
+		}
+		if msg.Finding == nil || len(msg.Finding.Trace) == 0 {
+			continue
+		}
+		vuln := msg.Finding.Trace[0]
+		f := VulnFinding{
+			OSV:          msg.Finding.OSV,
+			Module:       vuln.Module,
+			Version:      vuln.Version,
+			FixedVersion: msg.Finding.FixedVersion,
+			Symbol:       c.frameName(vuln),
+		}
+		if f.Symbol != "" {
+			// The trace runs from the vulnerable symbol back to the
+			// outermost project function.
+			for i := len(msg.Finding.Trace) - 1; i > 0; i-- {
+				if fr := msg.Finding.Trace[i]; c.isProjectPackage(fr.Package) {
+					f.Entry = c.frameName(fr)
+					break
+				}
+			}
+		}
+		if !seen[f] {
+			seen[f] = true
+			c.Vulns = append(c.Vulns, f)
+		}
+	}
+	return nil
+}
+
+// WriteVulnReport prints the findings grouped by OSV ID.
+func WriteVulnReport(w io.Writer, vulns []VulnFinding) {
+	byOSV := make(map[string][]VulnFinding)
+	for _, v := range vulns {
+		byOSV[v.OSV] = append(byOSV[v.OSV], v)
+	}
+	ids := make([]string, 0, len(byOSV))
+	for id := range byOSV {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	fmt.Fprintf(w, "Vulnerabilities: %d\n", len(ids))
+	for _, id := range ids {
+		fs := byOSV[id]
+		fix := fs[0].FixedVersion
+		if fix == "" {
+			fix = "none"
+		}
+		fmt.Fprintf(w, "\n%s in %s@%s (fixed in %s)\n", id, fs[0].Module, fs[0].Version, fix)
+		reached := false
+		for _, f := range fs {
+			if f.Symbol != "" && f.Entry != "" {
+				fmt.Fprintf(w, "  %s reaches %s\n", f.Entry, f.Symbol)
+				reached = true
+			}
+		}
+		if !reached {
+			fmt.Fprintln(w, "  not reached from project code")
+		}
+	}
+}